@@ -0,0 +1,62 @@
+package bootstrap
+
+// 本文件承载 Core 框架中与 `backoff` 相关的通用逻辑。
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// ReconnectBackoff 为上行链路重连提供带抖动的指数退避：每次失败间隔翻倍直到 max，
+// 连接稳定存活至少 max 后再断开则回到 min。父链路与 Client 共用同一实现；非并发安全。
+type ReconnectBackoff struct {
+	min    time.Duration
+	max    time.Duration
+	jitter float64 // 抖动比例，实际间隔落在 base*(1±jitter) 内
+
+	cur   time.Duration
+	randf func() float64 // 返回 [0,1)，测试可替换
+}
+
+// NewReconnectBackoff 规范化参数：min<=0 取 1s，max<min 取 min，jitter 限定在 [0,1]。
+func NewReconnectBackoff(min, max time.Duration, jitter float64) *ReconnectBackoff {
+	if min <= 0 {
+		min = time.Second
+	}
+	if max < min {
+		max = min
+	}
+	if jitter < 0 {
+		jitter = 0
+	}
+	if jitter > 1 {
+		jitter = 1
+	}
+	return &ReconnectBackoff{min: min, max: max, jitter: jitter, cur: min, randf: rand.Float64}
+}
+
+// Next 返回本次应等待的时长，并把下一次的基准间隔翻倍（不超过 max）。
+func (b *ReconnectBackoff) Next() time.Duration {
+	base := b.cur
+	if b.cur < b.max {
+		b.cur *= 2
+		if b.cur > b.max {
+			b.cur = b.max
+		}
+	}
+	if b.jitter == 0 {
+		return base
+	}
+	delta := float64(base) * b.jitter * (2*b.randf() - 1)
+	return base + time.Duration(delta)
+}
+
+// Reset 把基准间隔恢复到 min。
+func (b *ReconnectBackoff) Reset() { b.cur = b.min }
+
+// Connected 在连接断开时调用：存活时长达到 max 视为稳定，退避重新从 min 开始。
+func (b *ReconnectBackoff) Connected(lived time.Duration) {
+	if lived >= b.max {
+		b.Reset()
+	}
+}
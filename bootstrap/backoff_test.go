@@ -0,0 +1,55 @@
+package bootstrap
+
+// 本文件覆盖 Core 框架中与 `backoff` 相关的行为。
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestReconnectBackoffGrowsCapsAndResets(t *testing.T) {
+	b := NewReconnectBackoff(time.Second, 8*time.Second, 0)
+	var got []time.Duration
+	for i := 0; i < 5; i++ {
+		got = append(got, b.Next())
+	}
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second}
+	if !slices.Equal(got, want) {
+		t.Fatalf("intervals=%v, want %v", got, want)
+	}
+	b.Connected(5 * time.Second)
+	if d := b.Next(); d != 8*time.Second {
+		t.Fatalf("short-lived connection should not reset backoff, got %v", d)
+	}
+	b.Connected(8 * time.Second)
+	if d := b.Next(); d != time.Second {
+		t.Fatalf("long-lived connection should reset backoff to min, got %v", d)
+	}
+}
+
+func TestReconnectBackoffJitterWithinBounds(t *testing.T) {
+	const jitter = 0.3
+	b := NewReconnectBackoff(time.Second, 16*time.Second, jitter)
+	for _, r := range []float64{0, 0.5, 0.999999} {
+		b.Reset()
+		b.randf = func() float64 { return r }
+		d := b.Next()
+		if lo, hi := 700*time.Millisecond, 1300*time.Millisecond; d < lo || d > hi {
+			t.Fatalf("rand=%v interval=%v, want within [%v,%v]", r, d, lo, hi)
+		}
+	}
+	b = NewReconnectBackoff(time.Second, 16*time.Second, jitter)
+	for i := 0; i < 1000; i++ {
+		base := b.cur
+		d := b.Next()
+		lo := time.Duration(float64(base) * (1 - jitter))
+		hi := time.Duration(float64(base) * (1 + jitter))
+		if d < lo || d > hi {
+			t.Fatalf("iteration %d: interval=%v outside [%v,%v]", i, d, lo, hi)
+		}
+		if i%7 == 6 {
+			b.Reset()
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package bootstrap
+
+// 本文件承载 Core 框架中与 `bind` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+)
+
+// NodeBinder 是 RegisterAndBind 所需的最小服务能力，core.IServer 均满足。
+type NodeBinder interface {
+	UpdateNodeID(uint32)
+	Config() core.IConfig
+}
+
+// RegisterAndBind 执行 SelfRegister，成功后把分配的 node_id 写回 srv（UpdateNodeID），
+// 并把父节点下发的 credential 存入 parent.credential，供父链路后续 login 复用。
+// opts 的 Timeout/DoLogin 等语义与 SelfRegister 相同；失败时不修改 srv。
+func RegisterAndBind(ctx context.Context, srv NodeBinder, opts SelfRegisterOptions) (uint32, string, error) {
+	if srv == nil {
+		return 0, "", errors.New("server required")
+	}
+	if opts.Credential == "" {
+		if cfg := srv.Config(); cfg != nil {
+			opts.Credential, _ = cfg.Get(coreconfig.KeyParentCredential)
+		}
+	}
+	nodeID, cred, err := SelfRegister(ctx, opts)
+	if err != nil {
+		return 0, "", err
+	}
+	srv.UpdateNodeID(nodeID)
+	if cred != "" {
+		if cfg := srv.Config(); cfg != nil {
+			cfg.Set(coreconfig.KeyParentCredential, cred)
+		}
+	}
+	return nodeID, cred, nil
+}
@@ -0,0 +1,158 @@
+package bootstrap
+
+// 本文件覆盖 Core 框架中与 `bind` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+)
+
+// stubBinder 记录 UpdateNodeID 调用。
+type stubBinder struct {
+	cfg     core.IConfig
+	updates []uint32
+}
+
+func (s *stubBinder) UpdateNodeID(id uint32) { s.updates = append(s.updates, id) }
+func (s *stubBinder) Config() core.IConfig   { return s.cfg }
+
+// serveRegister 在 side 上应答一次 register（可选 login），并把收到的 login data 交给 logins。
+func serveRegister(side net.Conn, regData map[string]any, withLogin bool, logins chan<- map[string]any) error {
+	codec := header.HeaderTcpCodec{}
+	reply := func(reqHdr core.IHeader, action string, data map[string]any) error {
+		body, _ := json.Marshal(map[string]any{"action": action, "data": data})
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorOKResp).WithSubProto(2).WithMsgID(reqHdr.GetMsgID())
+		frame, err := codec.Encode(hdr, body)
+		if err != nil {
+			return err
+		}
+		_, err = side.Write(frame)
+		return err
+	}
+	hdr, body, err := codec.Decode(side)
+	if err != nil {
+		return err
+	}
+	if msg, err := decodeBootstrapEnvelope(body); err != nil || msg.Action != "register" {
+		return fmt.Errorf("first frame is not register: %v", err)
+	}
+	if err := reply(hdr, "register_resp", regData); err != nil || !withLogin {
+		return err
+	}
+	hdr, body, err = codec.Decode(side)
+	if err != nil {
+		return err
+	}
+	msg, err := decodeBootstrapEnvelope(body)
+	if err != nil || msg.Action != "login" {
+		return fmt.Errorf("second frame is not login: %v", err)
+	}
+	logins <- msg.Data
+	return reply(hdr, "login_resp", map[string]any{"code": 1})
+}
+
+func pipeDialer(client net.Conn) func(context.Context) (core.IConnection, error) {
+	return func(context.Context) (core.IConnection, error) {
+		return tcp_listener.NewTCPConnection(client), nil
+	}
+}
+
+func TestRegisterAndBindUpdatesNodeIDAndStashesCredential(t *testing.T) {
+	client, side := net.Pipe()
+	defer side.Close()
+	logins := make(chan map[string]any, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serveRegister(side, map[string]any{"code": 1, "node_id": 9, "status": "approved", "credential": "cred-9"}, true, logins)
+	}()
+
+	srv := &stubBinder{cfg: config.NewMap(nil)}
+	nodeID, cred, err := RegisterAndBind(context.Background(), srv, SelfRegisterOptions{
+		SelfID:  "device-bind",
+		DoLogin: true,
+		Timeout: 2 * time.Second,
+		Dial:    pipeDialer(client),
+	})
+	if err != nil {
+		t.Fatalf("RegisterAndBind: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("stub parent: %v", err)
+	}
+	if nodeID != 9 || cred != "cred-9" {
+		t.Fatalf("got node=%d cred=%q, want 9 cred-9", nodeID, cred)
+	}
+	if len(srv.updates) != 1 || srv.updates[0] != 9 {
+		t.Fatalf("UpdateNodeID calls=%v, want [9]", srv.updates)
+	}
+	if got, _ := srv.cfg.Get(config.KeyParentCredential); got != "cred-9" {
+		t.Fatalf("parent.credential=%q, want cred-9", got)
+	}
+	if login := <-logins; login["credential"] != "cred-9" || login["device_id"] != "device-bind" {
+		t.Fatalf("login data=%v, want register credential reused", login)
+	}
+}
+
+func TestRegisterAndBindReusesStoredCredentialForLogin(t *testing.T) {
+	client, side := net.Pipe()
+	defer side.Close()
+	logins := make(chan map[string]any, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- serveRegister(side, map[string]any{"code": 1, "node_id": 4, "status": "approved"}, true, logins)
+	}()
+
+	srv := &stubBinder{cfg: config.NewMap(map[string]string{config.KeyParentCredential: "saved"})}
+	if _, _, err := RegisterAndBind(context.Background(), srv, SelfRegisterOptions{
+		SelfID:  "device-saved",
+		DoLogin: true,
+		Timeout: 2 * time.Second,
+		Dial:    pipeDialer(client),
+	}); err != nil {
+		t.Fatalf("RegisterAndBind: %v", err)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("stub parent: %v", err)
+	}
+	if login := <-logins; login["credential"] != "saved" {
+		t.Fatalf("login data=%v, want stored credential", login)
+	}
+	if len(srv.updates) != 1 || srv.updates[0] != 4 {
+		t.Fatalf("UpdateNodeID calls=%v, want [4]", srv.updates)
+	}
+	if got, _ := srv.cfg.Get(config.KeyParentCredential); got != "saved" {
+		t.Fatalf("parent.credential=%q, want unchanged", got)
+	}
+}
+
+func TestRegisterAndBindLeavesServerUntouchedOnFailure(t *testing.T) {
+	client, side := net.Pipe()
+	defer side.Close()
+	go func() {
+		_ = serveRegister(side, map[string]any{"code": 4001, "status": "rejected", "reason": "denied"}, false, nil)
+	}()
+
+	srv := &stubBinder{cfg: config.NewMap(nil)}
+	_, _, err := RegisterAndBind(context.Background(), srv, SelfRegisterOptions{
+		SelfID:  "device-rejected",
+		Timeout: 2 * time.Second,
+		Dial:    pipeDialer(client),
+	})
+	var statusErr *RegisterStatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != "rejected" {
+		t.Fatalf("err=%v, want rejected RegisterStatusError", err)
+	}
+	if len(srv.updates) != 0 {
+		t.Fatalf("UpdateNodeID called %v on failure", srv.updates)
+	}
+}
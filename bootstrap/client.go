@@ -0,0 +1,236 @@
+package bootstrap
+
+// 本文件承载 Core 框架中与 `client` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/reader"
+)
+
+// ErrClientNotConnected 表示 Client 当前没有可用连接（未启动、已关闭或正在重连）。
+var ErrClientNotConnected = errors.New("client not connected")
+
+// ClientOptions 配置 Client：拨号与 register/login 握手沿用 SelfRegisterOptions，读取循环沿用 reader.Options。
+type ClientOptions struct {
+	SelfRegisterOptions
+	// Reader 为握手后读取循环的参数；Logger 缺省沿用 SelfRegisterOptions.Logger。
+	Reader reader.Options
+	// Reconnect 开启后连接断开会按退避重新拨号并重新握手；关闭时断开即结束（见 Done/Err）。
+	Reconnect       bool
+	ReconnectMin    time.Duration
+	ReconnectMax    time.Duration
+	ReconnectJitter float64
+}
+
+// Client 是 SelfRegister 的长连接版本：握手完成后保留连接，供客户端应用继续收发帧。
+type Client struct {
+	opts   ClientOptions
+	reader *reader.TCPReader
+
+	mu      sync.RWMutex
+	conn    core.IConnection
+	nodeID  uint32
+	recvH   core.ReceiveHandler
+	started bool
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error
+}
+
+// NewClient 校验并补齐参数，返回尚未连接的 Client。
+func NewClient(opts ClientOptions) (*Client, error) {
+	if opts.Dial == nil && opts.ParentAddr == "" {
+		return nil, errors.New("parent address required")
+	}
+	if opts.SelfID == "" {
+		return nil, errors.New("self id required")
+	}
+	opts.SelfRegisterOptions = normalizeSelfRegisterOptions(opts.SelfRegisterOptions)
+	if opts.Reader.Logger == nil {
+		opts.Reader.Logger = opts.Logger
+	}
+	return &Client{
+		opts:   opts,
+		reader: reader.NewTCPWithOptions(opts.Reader),
+		done:   make(chan struct{}),
+	}, nil
+}
+
+// Start 同步完成首次拨号与握手，成功后在后台运行读取循环。
+// 首次握手失败直接返回错误（不进入重连），调用方可修正后再次 Start。
+func (c *Client) Start(ctx context.Context) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.mu.Lock()
+	if c.started {
+		c.mu.Unlock()
+		return errors.New("client already started")
+	}
+	c.started = true
+	c.mu.Unlock()
+
+	rctx, cancel := context.WithCancel(ctx)
+	conn, err := c.connect(rctx)
+	if err != nil {
+		cancel()
+		c.mu.Lock()
+		c.started = false
+		c.mu.Unlock()
+		return err
+	}
+	c.mu.Lock()
+	c.cancel = cancel
+	c.mu.Unlock()
+	go c.run(rctx, conn)
+	return nil
+}
+
+// OnReceive 注册握手后收到业务帧的回调；重连后自动挂到新连接上。
+// payload 的所有权规则与 reader.Options 一致。
+func (c *Client) OnReceive(h core.ReceiveHandler) {
+	c.mu.Lock()
+	c.recvH = h
+	c.mu.Unlock()
+}
+
+// Send 用握手时的编解码器在当前连接上发送一帧；SourceID 为 0 时自动填入分配到的 node_id。
+func (c *Client) Send(hdr core.IHeader, payload []byte) error {
+	if hdr == nil {
+		return errors.New("nil header")
+	}
+	c.mu.RLock()
+	conn, nodeID := c.conn, c.nodeID
+	c.mu.RUnlock()
+	if conn == nil {
+		return ErrClientNotConnected
+	}
+	if hdr.SourceID() == 0 {
+		hdr = hdr.Clone().WithSourceID(nodeID)
+	}
+	return conn.SendWithHeader(hdr, payload, c.opts.Codec)
+}
+
+// NodeID 返回最近一次握手分配的 node_id，未握手时为 0。
+func (c *Client) NodeID() uint32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.nodeID
+}
+
+// Conn 返回当前连接；未连接或重连期间为 nil。
+func (c *Client) Conn() core.IConnection {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// Done 在 Client 停止（Close、ctx 取消或未开启重连时连接断开）后关闭。
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err 返回导致 Client 停止的错误，仅在 Done 关闭后有意义。
+func (c *Client) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err
+}
+
+// Close 停止读取循环与重连并关闭连接，等待后台循环退出；未启动时为空操作。
+func (c *Client) Close() error {
+	c.mu.RLock()
+	cancel := c.cancel
+	c.mu.RUnlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-c.done
+	return nil
+}
+
+// connect 拨号并在 opts.Timeout 内完成 register/login，成功后把连接设为当前连接。
+func (c *Client) connect(ctx context.Context) (core.IConnection, error) {
+	hctx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+	defer cancel()
+	conn, err := dialSelfRegisterConn(hctx, c.opts.SelfRegisterOptions, true)
+	if err != nil {
+		return nil, err
+	}
+	nodeID, _, err := registerOnConn(hctx, conn, c.opts.SelfRegisterOptions)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	conn.OnReceive(c.dispatch)
+	c.mu.Lock()
+	c.conn = conn
+	c.nodeID = nodeID
+	c.mu.Unlock()
+	return conn, nil
+}
+
+// dispatch 把读取循环交付的帧转给当前注册的回调。
+func (c *Client) dispatch(conn core.IConnection, hdr core.IHeader, payload []byte) {
+	c.mu.RLock()
+	h := c.recvH
+	c.mu.RUnlock()
+	if h != nil {
+		h(conn, hdr, payload)
+	}
+}
+
+// run 运行读取循环；开启 Reconnect 时断开后按退避重新拨号握手，直到 ctx 结束。
+func (c *Client) run(ctx context.Context, conn core.IConnection) {
+	defer close(c.done)
+	var backoff *ReconnectBackoff
+	if c.opts.Reconnect {
+		backoff = NewReconnectBackoff(c.opts.ReconnectMin, c.opts.ReconnectMax, c.opts.ReconnectJitter)
+	}
+	for {
+		connectedAt := time.Now()
+		err := c.reader.ReadLoop(ctx, conn, c.opts.Codec)
+		_ = conn.Close()
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+		if ctx.Err() != nil || backoff == nil {
+			c.stop(err)
+			return
+		}
+		backoff.Connected(time.Since(connectedAt))
+		c.opts.Logger.Warn("client connection closed, reconnecting", "self_id", c.opts.SelfID, "err", err)
+		for conn = nil; conn == nil; {
+			if !waitBackoff(ctx, backoff.Next()) {
+				c.stop(ctx.Err())
+				return
+			}
+			if conn, err = c.connect(ctx); err != nil {
+				c.opts.Logger.Debug("client reconnect failed", "self_id", c.opts.SelfID, "err", err)
+			}
+		}
+	}
+}
+
+// stop 记录停止原因。
+func (c *Client) stop(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.mu.Unlock()
+}
+
+// waitBackoff 等待 d 或 ctx 结束，返回 false 表示 ctx 已取消。
+func waitBackoff(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,132 @@
+package bootstrap_test
+
+// 本文件覆盖 Core 框架中与 `client` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/bootstrap"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/server"
+)
+
+// authEchoProcess 在 SubProto=2 上应答 register/login，其余帧原样回显给发送方。
+type authEchoProcess struct {
+	*process.SimpleProcess
+	mu      sync.Mutex
+	actions []string
+}
+
+func (p *authEchoProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	reply := (&header.HeaderTcp{}).
+		WithMajor(header.MajorOKResp).
+		WithSubProto(hdr.SubProto()).
+		WithSourceID(1).
+		WithTargetID(hdr.SourceID()).
+		WithMsgID(hdr.GetMsgID())
+	body := payload
+	if hdr.SubProto() == 2 {
+		var msg struct {
+			Action string `json:"action"`
+		}
+		_ = json.Unmarshal(payload, &msg)
+		p.mu.Lock()
+		p.actions = append(p.actions, msg.Action)
+		p.mu.Unlock()
+		data := map[string]any{"code": 1}
+		if msg.Action == "register" {
+			data = map[string]any{"code": 1, "node_id": 7, "status": "approved"}
+		}
+		body, _ = json.Marshal(map[string]any{"action": msg.Action + "_resp", "data": data})
+	}
+	_ = core.ServerFromContext(ctx).Send(ctx, conn.ID(), reply, body)
+}
+
+func TestClientRoundTripAfterLogin(t *testing.T) {
+	lst := tcp_listener.New("127.0.0.1:0")
+	proc := &authEchoProcess{SimpleProcess: process.NewSimple(nil)}
+	srv, err := server.New(server.Options{
+		Process:  proc,
+		Codec:    header.HeaderTcpCodec{},
+		Listener: lst,
+		Config:   config.NewMap(nil),
+		Manager:  connmgr.New(),
+	})
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for lst.Addr() == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if lst.Addr() == nil {
+		t.Fatal("listener did not start")
+	}
+
+	client, err := bootstrap.NewClient(bootstrap.ClientOptions{
+		SelfRegisterOptions: bootstrap.SelfRegisterOptions{
+			ParentAddr: lst.Addr().String(),
+			SelfID:     "device-client",
+			DoLogin:    true,
+			Timeout:    2 * time.Second,
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	recv := make(chan core.IHeader, 1)
+	payloads := make(chan string, 1)
+	client.OnReceive(func(_ core.IConnection, hdr core.IHeader, payload []byte) {
+		recv <- hdr
+		payloads <- string(payload)
+	})
+	if err := client.Start(context.Background()); err != nil {
+		t.Fatalf("client Start: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	if got := client.NodeID(); got != 7 {
+		t.Fatalf("NodeID=%d, want 7", got)
+	}
+
+	msg := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithTargetID(1).WithMsgID(99)
+	if err := client.Send(msg, []byte("ping")); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case hdr := <-recv:
+		if hdr.GetMsgID() != 99 || hdr.TargetID() != 7 {
+			t.Fatalf("reply msg=%d target=%d, want msg=99 target=7", hdr.GetMsgID(), hdr.TargetID())
+		}
+		if got := <-payloads; got != "ping" {
+			t.Fatalf("reply payload=%q, want %q", got, "ping")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("echo reply not received")
+	}
+	proc.mu.Lock()
+	actions := append([]string(nil), proc.actions...)
+	proc.mu.Unlock()
+	if len(actions) != 2 || actions[0] != "register" || actions[1] != "login" {
+		t.Fatalf("handshake actions=%v, want [register login]", actions)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := client.Send(msg, nil); err != bootstrap.ErrClientNotConnected {
+		t.Fatalf("Send after Close err=%v, want ErrClientNotConnected", err)
+	}
+}
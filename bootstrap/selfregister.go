@@ -27,6 +27,8 @@ type SelfRegisterOptions struct {
 	DialTimeout time.Duration
 	DoLogin     bool
 	Logger      *slog.Logger
+	Codec       core.IHeaderCodec // 可选：register/login 帧使用的编解码器，缺省 HeaderTcpCodec
+	Credential  string            // 可选：login 时携带的凭证，通常来自此前 register 的返回（见 RegisterAndBind）
 }
 
 // RegisterStatusError reports a non-approved register outcome.
@@ -60,7 +62,22 @@ func (e *RegisterStatusError) Error() string {
 	return fmt.Sprintf("register %s: %s", status, detail)
 }
 
-// SelfRegister 通过 SubProto=2 的 register/login 获取 node_id（旧版会返回 credential，现已不要求）。
+// LoginError reports a non-success login response, keeping the handler's code so callers can tell
+// a credential mismatch apart from other failures (e.g. drop a stale stored credential and re-register).
+type LoginError struct {
+	Code int
+	Msg  string
+}
+
+// Error 保持旧版 "login failed: <msg>" 文本，便于现有日志检索。
+func (e *LoginError) Error() string {
+	if e == nil {
+		return "login failed"
+	}
+	return "login failed: " + e.Msg
+}
+
+// SelfRegister 通过 SubProto=2 的 register/login 获取 node_id 与父节点下发的 credential（新版父节点可能不再下发，此时为空）。
 // 适用于有父节点且未预设 node_id 的 Hub/节点。
 func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string, error) {
 	if ctx == nil {
@@ -72,6 +89,39 @@ func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string
 	if opts.SelfID == "" {
 		return 0, "", errors.New("self id required")
 	}
+	opts = normalizeSelfRegisterOptions(opts)
+
+	cctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	conn, err := dialSelfRegisterConn(cctx, opts, false)
+	if err != nil {
+		return 0, "", err
+	}
+	defer conn.Close()
+	return registerOnConn(cctx, conn, opts)
+}
+
+// RegisterOnConn 在一条已建立的连接上执行 SubProto=2 的 register（可选 login），返回分配的 node_id。
+// 与 SelfRegister 不同，它不拨号也不关闭连接，供父链路在握手完成后继续复用该连接；
+// 超时（opts.Timeout）或 ctx 取消时会关闭连接以打断阻塞读取。
+func RegisterOnConn(ctx context.Context, conn core.IConnection, opts SelfRegisterOptions) (uint32, string, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if conn == nil {
+		return 0, "", errors.New("conn required")
+	}
+	if opts.SelfID == "" {
+		return 0, "", errors.New("self id required")
+	}
+	opts = normalizeSelfRegisterOptions(opts)
+	cctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+	return registerOnConn(cctx, conn, opts)
+}
+
+// normalizeSelfRegisterOptions 补齐超时、日志与编解码器的默认值。
+func normalizeSelfRegisterOptions(opts SelfRegisterOptions) SelfRegisterOptions {
 	if opts.Timeout <= 0 {
 		opts.Timeout = 10 * time.Second
 	}
@@ -81,16 +131,15 @@ func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string
 	if opts.Logger == nil {
 		opts.Logger = slog.Default()
 	}
-
-	cctx, cancel := context.WithTimeout(ctx, opts.Timeout)
-	defer cancel()
-	conn, err := dialSelfRegisterConn(cctx, opts)
-	if err != nil {
-		return 0, "", err
+	if opts.Codec == nil {
+		opts.Codec = header.HeaderTcpCodec{}
 	}
-	defer conn.Close()
+	return opts
+}
 
-	codec := header.HeaderTcpCodec{}
+// registerOnConn 是 register/login 交换的共同实现，ctx 已带总超时。
+func registerOnConn(cctx context.Context, conn core.IConnection, opts SelfRegisterOptions) (uint32, string, error) {
+	codec := opts.Codec
 	msgID := uint32(1)
 
 	// register
@@ -111,7 +160,7 @@ func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string
 	if err := sendFrame(cctx, conn, codec, regHdr, regPayload); err != nil {
 		return 0, "", err
 	}
-	rHdr, rBody, err := recvFrame(cctx, conn, codec)
+	rHdr, rBody, err := recvResponse(cctx, conn, codec, msgID, "register_resp", opts.Logger)
 	if err != nil {
 		return 0, "", err
 	}
@@ -122,12 +171,21 @@ func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string
 
 	if opts.DoLogin {
 		msgID++
+		loginData := map[string]any{
+			"device_id": opts.SelfID,
+			// 新版登录需签名支持，这里仅保留占位，实际流程应在调用处构造签名。
+		}
+		// 优先使用本次 register 下发的凭证，否则沿用调用方保存的旧凭证。
+		loginCred := strings.TrimSpace(cred)
+		if loginCred == "" {
+			loginCred = strings.TrimSpace(opts.Credential)
+		}
+		if loginCred != "" {
+			loginData["credential"] = loginCred
+		}
 		loginPayload, _ := json.Marshal(map[string]any{
 			"action": "login",
-			"data": map[string]any{
-				"device_id": opts.SelfID,
-				// 新版登录需签名支持，这里仅保留占位，实际流程应在调用处构造签名。
-			},
+			"data":   loginData,
 		})
 		loginHdr := (&header.HeaderTcp{}).
 			WithMajor(header.MajorCmd).
@@ -138,7 +196,7 @@ func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string
 		if err := sendFrame(cctx, conn, codec, loginHdr, loginPayload); err != nil {
 			return 0, "", err
 		}
-		_, loginResp, err := recvFrame(cctx, conn, codec)
+		_, loginResp, err := recvResponse(cctx, conn, codec, msgID, "login_resp", opts.Logger)
 		if err != nil {
 			return 0, "", err
 		}
@@ -151,7 +209,8 @@ func SelfRegister(ctx context.Context, opts SelfRegisterOptions) (uint32, string
 }
 
 // dialSelfRegisterConn 优先复用调用方注入的 dialer，否则退回旧版 TCP 直连。
-func dialSelfRegisterConn(ctx context.Context, opts SelfRegisterOptions) (core.IConnection, error) {
+// persistent 为 true 时连接会在握手后继续使用，不设置覆盖整条连接的 I/O deadline。
+func dialSelfRegisterConn(ctx context.Context, opts SelfRegisterOptions, persistent bool) (core.IConnection, error) {
 	if opts.Dial != nil {
 		conn, err := opts.Dial(ctx)
 		if err != nil {
@@ -168,19 +227,21 @@ func dialSelfRegisterConn(ctx context.Context, opts SelfRegisterOptions) (core.I
 	if err != nil {
 		return nil, err
 	}
-	_ = raw.SetDeadline(time.Now().Add(opts.Timeout))
+	if !persistent {
+		_ = raw.SetDeadline(time.Now().Add(opts.Timeout))
+	}
 	return tcp_listener.NewTCPConnection(raw), nil
 }
 
 // sendFrame 在 context 保护下发送一帧 bootstrap 请求。
-func sendFrame(ctx context.Context, conn core.IConnection, codec header.HeaderTcpCodec, hdr core.IHeader, payload []byte) error {
+func sendFrame(ctx context.Context, conn core.IConnection, codec core.IHeaderCodec, hdr core.IHeader, payload []byte) error {
 	return runConnOp(ctx, conn, func() error {
 		return conn.SendWithHeader(hdr, payload, codec)
 	})
 }
 
 // recvFrame 同步读取一帧响应，并在超时时主动关闭连接打断阻塞读取。
-func recvFrame(ctx context.Context, conn core.IConnection, codec header.HeaderTcpCodec) (core.IHeader, []byte, error) {
+func recvFrame(ctx context.Context, conn core.IConnection, codec core.IHeaderCodec) (core.IHeader, []byte, error) {
 	type decodeResult struct {
 		hdr  core.IHeader
 		body []byte
@@ -202,6 +263,34 @@ func recvFrame(ctx context.Context, conn core.IConnection, codec header.HeaderTc
 	}
 }
 
+// recvResponse 读取与请求 msgID 对应的 SubProto=2 响应；共享链路上先到达的广播、转发等无关帧被跳过，
+// 直到匹配的响应到达或 ctx 超时。
+func recvResponse(ctx context.Context, conn core.IConnection, codec core.IHeaderCodec, msgID uint32, action string, log *slog.Logger) (core.IHeader, []byte, error) {
+	for {
+		hdr, body, err := recvFrame(ctx, conn, codec)
+		if err != nil {
+			return nil, nil, err
+		}
+		if hdr != nil && hdr.SubProto() == 2 && hdr.GetMsgID() == msgID && responseAction(body) == action {
+			return hdr, body, nil
+		}
+		if hdr != nil {
+			log.Debug("self register skip unrelated frame", "want", action, "subproto", hdr.SubProto(), "msg_id", hdr.GetMsgID())
+		}
+	}
+}
+
+// responseAction 提取 JSON 信封中的 action，非 JSON 负载返回空串。
+func responseAction(body []byte) string {
+	var msg struct {
+		Action string `json:"action"`
+	}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return ""
+	}
+	return msg.Action
+}
+
 // runConnOp 为单次连接操作补上超时感知，避免 bootstrap 卡在底层 I/O。
 func runConnOp(ctx context.Context, conn core.IConnection, op func() error) error {
 	done := make(chan error, 1)
@@ -228,12 +317,13 @@ func parseRegisterResp(_ core.IHeader, body []byte) (uint32, string, error) {
 		return 0, "", err
 	}
 	var resp struct {
-		Code      int    `json:"code"`
-		NodeID    uint32 `json:"node_id"`
-		Msg       string `json:"msg"`
-		Status    string `json:"status"`
-		RequestID string `json:"request_id"`
-		Reason    string `json:"reason"`
+		Code       int    `json:"code"`
+		NodeID     uint32 `json:"node_id"`
+		Credential string `json:"credential"`
+		Msg        string `json:"msg"`
+		Status     string `json:"status"`
+		RequestID  string `json:"request_id"`
+		Reason     string `json:"reason"`
 	}
 	if err := json.Unmarshal(msg.Data, &resp); err != nil {
 		return 0, "", err
@@ -250,7 +340,7 @@ func parseRegisterResp(_ core.IHeader, body []byte) (uint32, string, error) {
 				Msg:       resp.Msg,
 			}
 		}
-		return resp.NodeID, "", nil
+		return resp.NodeID, resp.Credential, nil
 	case "pending", "rejected":
 		return 0, "", &RegisterStatusError{
 			Code:      resp.Code,
@@ -261,11 +351,11 @@ func parseRegisterResp(_ core.IHeader, body []byte) (uint32, string, error) {
 		}
 	case "":
 		if resp.Code == 1 && resp.NodeID != 0 {
-			return resp.NodeID, "", nil
+			return resp.NodeID, resp.Credential, nil
 		}
 	default:
 		if resp.Code == 1 && resp.NodeID != 0 {
-			return resp.NodeID, "", nil
+			return resp.NodeID, resp.Credential, nil
 		}
 	}
 	return 0, "", &RegisterStatusError{
@@ -277,7 +367,7 @@ func parseRegisterResp(_ core.IHeader, body []byte) (uint32, string, error) {
 	}
 }
 
-// assertLoginOK 只校验 bootstrap 登录占位请求是否拿到成功 code。
+// assertLoginOK 校验 bootstrap 登录是否拿到成功 code，失败时返回带原始 code 的 *LoginError。
 func assertLoginOK(body []byte) error {
 	var msg struct {
 		Action string          `json:"action"`
@@ -294,7 +384,7 @@ func assertLoginOK(body []byte) error {
 		return err
 	}
 	if resp.Code != 1 {
-		return errors.New("login failed: " + resp.Msg)
+		return &LoginError{Code: resp.Code, Msg: resp.Msg}
 	}
 	return nil
 }
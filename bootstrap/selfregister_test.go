@@ -83,6 +83,19 @@ func TestParseRegisterRespRejected(t *testing.T) {
 	}
 }
 
+func TestAssertLoginOKKeepsFailureCode(t *testing.T) {
+	body, _ := json.Marshal(map[string]any{"action": "login_resp", "data": map[string]any{"code": 4001, "msg": "invalid credential"}})
+	err := assertLoginOK(body)
+	var loginErr *LoginError
+	if !errors.As(err, &loginErr) || loginErr.Code != 4001 || err.Error() != "login failed: invalid credential" {
+		t.Fatalf("assertLoginOK err=%v, want LoginError code 4001", err)
+	}
+	ok, _ := json.Marshal(map[string]any{"action": "login_resp", "data": map[string]any{"code": 1}})
+	if err := assertLoginOK(ok); err != nil {
+		t.Fatalf("assertLoginOK success: %v", err)
+	}
+}
+
 func TestSelfRegisterUsesInjectedDialer(t *testing.T) {
 	client, server := net.Pipe()
 	defer server.Close()
@@ -248,6 +261,63 @@ func TestSelfRegisterReturnsRegisterStatusErrorFromInjectedDialer(t *testing.T)
 	}
 }
 
+func TestSelfRegisterSkipsInterleavedFrames(t *testing.T) {
+	client, side := net.Pipe()
+	defer side.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		codec := header.HeaderTcpCodec{}
+		write := func(hdr core.IHeader, body []byte) error {
+			frame, err := codec.Encode(hdr, body)
+			if err != nil {
+				return err
+			}
+			_, err = side.Write(frame)
+			return err
+		}
+		reqHdr, _, err := codec.Decode(side)
+		if err != nil {
+			errCh <- err
+			return
+		}
+		// 共享链路上先到的噪声：其他子协议的广播、同子协议但 msg_id 不同的帧、非 JSON 负载。
+		noise := []struct {
+			hdr  core.IHeader
+			body []byte
+		}{
+			{(&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithMsgID(reqHdr.GetMsgID()), []byte(`{"action":"broadcast","data":{"x":1}}`)},
+			{(&header.HeaderTcp{}).WithMajor(header.MajorOKResp).WithSubProto(2).WithMsgID(reqHdr.GetMsgID() + 100), mustRegisterResp(t, map[string]any{"code": 1, "node_id": 99})},
+			{(&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(2).WithMsgID(reqHdr.GetMsgID()), []byte("not json")},
+		}
+		for _, n := range noise {
+			if err := write(n.hdr, n.body); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		resp := (&header.HeaderTcp{}).WithMajor(header.MajorOKResp).WithSubProto(2).WithMsgID(reqHdr.GetMsgID())
+		errCh <- write(resp, mustRegisterResp(t, map[string]any{"code": 1, "node_id": 12, "status": "approved"}))
+	}()
+
+	nodeID, _, err := SelfRegister(context.Background(), SelfRegisterOptions{
+		SelfID:  "device-busy",
+		Timeout: 2 * time.Second,
+		Dial: func(context.Context) (core.IConnection, error) {
+			return tcp_listener.NewTCPConnection(client), nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("SelfRegister: %v", err)
+	}
+	if nodeID != 12 {
+		t.Fatalf("node id=%d, want 12 from the matching response", nodeID)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("stub parent: %v", err)
+	}
+}
+
 type bootstrapEnvelope struct {
 	Action string         `json:"action"`
 	Data   map[string]any `json:"data"`
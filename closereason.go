@@ -0,0 +1,47 @@
+package core
+
+// 本文件承载 Core 框架中与 `closereason` 相关的通用逻辑。
+
+// CloseReason 描述连接被关闭的原因类别，随 conn.closed 事件发布。
+type CloseReason string
+
+const (
+	CloseReasonUnknown        CloseReason = "unknown"
+	CloseReasonClientEOF      CloseReason = "client_eof"        // 对端正常关闭
+	CloseReasonReadError      CloseReason = "read_error"        // 读取/解码失败
+	CloseReasonIdleTimeout    CloseReason = "idle_timeout"      // 读超时（空闲或慢帧）
+	CloseReasonServerShutdown CloseReason = "server_shutdown"   // 本端停止服务
+	CloseReasonKicked         CloseReason = "kicked"            // 被管理器主动踢下线（如 nodeID 被接管）
+	CloseReasonHeartbeat      CloseReason = "heartbeat_timeout" // 连续多次心跳 ping 未收到 pong
+	CloseReasonDrained        CloseReason = "drained"           // 排空宽限期结束后由本端关闭（滚动升级）
+	CloseReasonWriteTimeout   CloseReason = "write_timeout"     // 写截止时间打断了半帧，流已失去帧边界
+	CloseReasonBindRejected   CloseReason = "bind_rejected"     // 接入时的身份绑定被冲突或重复连接策略拒绝
+)
+
+// MetaCloseReasonKey 连接元数据中记录关闭原因的键。
+const MetaCloseReasonKey = "closeReason"
+
+// MarkCloseReason 记录连接关闭原因；已有原因时保持不变（先到者为准），返回最终生效的原因。
+func MarkCloseReason(conn IConnection, reason CloseReason) CloseReason {
+	if conn == nil {
+		return reason
+	}
+	if existing := CloseReasonOf(conn); existing != CloseReasonUnknown {
+		return existing
+	}
+	conn.SetMeta(MetaCloseReasonKey, reason)
+	return reason
+}
+
+// CloseReasonOf 读取连接上记录的关闭原因，未记录时返回 CloseReasonUnknown。
+func CloseReasonOf(conn IConnection) CloseReason {
+	if conn == nil {
+		return CloseReasonUnknown
+	}
+	if v, ok := conn.GetMeta(MetaCloseReasonKey); ok {
+		if r, ok2 := v.(CloseReason); ok2 && r != "" {
+			return r
+		}
+	}
+	return CloseReasonUnknown
+}
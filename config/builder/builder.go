@@ -9,3 +9,25 @@ type Builder interface {
 	Load() (core.IConfig, error)
 	Reload() (core.IConfig, error)
 }
+
+// reloadTarget 由支持区分运行期覆盖的配置实现（如 *config.MapConfig）。
+type reloadTarget interface {
+	ReloadFrom(fresh core.IConfig) core.IConfig
+}
+
+// ReloadInto 执行 b.Reload 并把结果合并进 existing，返回合并后的配置：
+// existing 支持 ReloadFrom 时保留其运行期 Set 写入的键，否则退回 Merge 全量覆盖；existing 为 nil 时直接返回新配置。
+// b 出错时 existing 保持不变。
+func ReloadInto(b Builder, existing core.IConfig) (core.IConfig, error) {
+	fresh, err := b.Reload()
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return fresh, nil
+	}
+	if t, ok := existing.(reloadTarget); ok {
+		return t.ReloadFrom(fresh), nil
+	}
+	return existing.Merge(fresh), nil
+}
@@ -0,0 +1,63 @@
+package builder
+
+// 本文件承载 Core 框架中与 `watch` 相关的通用逻辑。
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+)
+
+// Watcher 在被触发（手动调用 Reload 或收到 SIGHUP 等信号）时重新执行 Builder.Reload，
+// 经 ReloadInto 把新值合并进运行中的 Target 配置（运行期 Set 写入的键保留），并经 config.NotifyChanged 通知订阅者（如 permission.SharedConfig）。
+type Watcher struct {
+	b      Builder
+	target core.IConfig
+	log    *slog.Logger
+}
+
+// NewWatcher 创建重载器；target 为服务实际持有的配置实例，nil 时直接通知重载得到的新实例。
+func NewWatcher(b Builder, target core.IConfig, logger *slog.Logger) *Watcher {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Watcher{b: b, target: target, log: logger}
+}
+
+// Reload 立即重载一次；Builder 出错时保持原配置不变并返回错误。
+func (w *Watcher) Reload() error {
+	cfg, err := ReloadInto(w.b, w.target)
+	if err != nil {
+		return err
+	}
+	config.NotifyChanged(cfg)
+	return nil
+}
+
+// WatchSignals 阻塞直到 ctx 结束，每收到一次 sigs 中的信号就重载一次；重载失败只记日志。
+func (w *Watcher) WatchSignals(ctx context.Context, sigs ...os.Signal) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	defer signal.Stop(ch)
+	w.run(ctx, ch)
+}
+
+// run 消费触发通道，便于测试绕开真实信号。
+func (w *Watcher) run(ctx context.Context, trigger <-chan os.Signal) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case sig := <-trigger:
+			if err := w.Reload(); err != nil {
+				w.log.Warn("config reload failed", "signal", sig, "err", err)
+				continue
+			}
+			w.log.Info("config reloaded", "signal", sig)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package builder
+
+// 本文件覆盖 Core 框架中与 `watch` 相关的行为。
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+)
+
+func TestWatcherReloadKeepsRuntimeSetKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hub.yaml")
+	write := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("write yaml: %v", err)
+		}
+	}
+	write("process.channel_count: \"2\"\n")
+	yb := YAMLBuilder{Path: path}
+	loaded, err := yb.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	live := config.NewMap(nil)
+	live.Merge(loaded)
+
+	// 运维在运行期调整限流，文件里没有该键。
+	live.Set(config.KeyAuthRoleRates, "node:50")
+	write("process.channel_count: \"6\"\n")
+	var notified core.IConfig
+	cancel := config.SubscribeChanges(func(c core.IConfig) { notified = c })
+	defer cancel()
+	if err := NewWatcher(yb, live, nil).Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if notified != live {
+		t.Fatalf("notified %T, want the live config", notified)
+	}
+	if got, _ := live.Get(config.KeyAuthRoleRates); got != "node:50" {
+		t.Fatalf("runtime %s=%q after reload, want node:50", config.KeyAuthRoleRates, got)
+	}
+	if got, _ := live.Get(config.KeyProcChannelCount); got != "6" {
+		t.Fatalf("file %s=%q after reload, want 6", config.KeyProcChannelCount, got)
+	}
+}
+
+// mergeOnly 只实现 IConfig，不支持 ReloadFrom。
+type mergeOnly struct{ merged core.IConfig }
+
+func (m *mergeOnly) Get(string) (string, bool)             { return "", false }
+func (m *mergeOnly) Set(string, string)                    {}
+func (m *mergeOnly) Keys() []string                        { return nil }
+func (m *mergeOnly) Merge(other core.IConfig) core.IConfig { m.merged = other; return m }
+
+func TestReloadIntoFallsBackToMerge(t *testing.T) {
+	yb := YAMLBuilder{Path: filepath.Join(t.TempDir(), "missing.yaml")}
+	target := &mergeOnly{}
+	if got, err := ReloadInto(yb, target); err != nil || got != target || target.merged == nil {
+		t.Fatalf("ReloadInto=%v,%v merged=%v", got, err, target.merged)
+	}
+	if fresh, err := ReloadInto(yb, nil); err != nil || fresh == nil {
+		t.Fatalf("ReloadInto(nil)=%v,%v", fresh, err)
+	}
+}
@@ -11,18 +11,26 @@ import (
 
 // MapConfig stores key/value pairs in memory and implements core.IConfig.
 type MapConfig struct {
-	mu   sync.RWMutex
-	data map[string]string
+	mu      sync.RWMutex
+	data    map[string]string
+	runtime map[string]struct{} // 经 Set 在运行期写入的键，ReloadFrom 不覆盖
 }
 
 const (
 	KeyProcChannelCount                   = "process.channel_count"
 	KeyProcWorkersPerChan                 = "process.workers_per_channel"
 	KeyProcChannelBuffer                  = "process.channel_buffer"
+	KeyProcPanicBackoffMS                 = "process.panic_backoff_ms"     // handler panic 后 worker 的初始暂停，0 表示不暂停
+	KeyProcPanicBackoffMaxMS              = "process.panic_backoff_max_ms" // 连续 panic 时暂停的上限
+	KeyProcNoHandlerPolicy                = "process.no_handler_policy"    // fallback|drop|error，子协议无专用 handler 时的处理
+	KeyProcReplyNoHandler                 = "process.reply_no_handler"     // fallback 策略下无默认处理器时是否对本节点 Cmd 帧回 4040 错误
+	KeyProcLatencyHistogram               = "process.latency_histogram"    // 是否按子协议统计 handler 耗时直方图
+	KeyProcEnqueueTimeoutMS               = "process.enqueue_timeout_ms"   // >0 时队列满则阻塞读取协程至多该时长（背压），0 表示立即丢弃
 	KeyAuthDefaultRole                    = "auth.default_role"
 	KeyAuthDefaultPerms                   = "auth.default_perms"
 	KeyAuthNodeRoles                      = "auth.node_roles" // 格式：1:admin;2:node
-	KeyAuthRolePerms                      = "auth.role_perms" // 格式：admin:p1,p2;node:p3
+	KeyAuthRolePerms                      = "auth.role_perms" // 格式：admin:p1,p2;node:p3；支持 var.* 末段通配与 !perm 拒绝
+	KeyAuthRoleRates                      = "auth.role_rates" // 格式：admin:0;node:200，按角色限制每个节点每秒帧数，0 或缺省表示不限
 	KeyAuthRegisterRequireApproval        = "auth.register.require_approval"
 	KeyAuthRegisterPendingTTLSec          = "auth.register.pending_ttl_sec"
 	KeyAuthRegisterPermitTTLSec           = "auth.register.permit_ttl_sec"
@@ -31,27 +39,82 @@ const (
 	KeyAuthBootstrapFirstRegisterDeviceID = "auth.bootstrap.first_register.device_id"
 	KeyAuthBootstrapFirstRegisterPubKey   = "auth.bootstrap.first_register.pubkey"
 	KeyAuthBootstrapFirstRegisterEpoch    = "auth.bootstrap.first_register.epoch"
+	KeyAuthDuplicateLoginPolicy           = "auth.duplicate_login_policy"    // kick_old/reject_new/allow_both
+	KeyAuthSessionTTLSec                  = "auth.session_ttl_sec"           // 登录会话有效期，0 表示不过期
+	KeyAuthSessionHeartbeatExtends        = "auth.session_heartbeat_extends" // 心跳帧是否为会话续期
+	KeyAuthLoginRatePerMin                = "auth.login_rate_per_min"        // 每连接/每 IP 每分钟 login 次数，0 表示不限
+	KeyAuthRegisterRatePerMin             = "auth.register_rate_per_min"     // 每连接/每 IP 每分钟 register 次数，0 表示不限
+	KeyAuthLoginMaxFailures               = "auth.login_max_failures"        // 连续凭证失败多少次后临时锁定，0 表示不锁定
+	KeyAuthLoginLockoutSec                = "auth.login_lockout_sec"         // 达到失败上限后锁定的秒数
+	KeyAuthNodeIDStrategy                 = "auth.node_id_strategy"          // counter/range/parent，节点号分配策略
+	KeyAuthNodeIDRange                    = "auth.node_id_range"             // range 模式本地号段，如 10000-19999；留空则向父节点 alloc_range 申请
+	KeyAuthNodeIDBlockSize                = "auth.node_id_block_size"        // 作为父节点为每个子 hub 分配的号段大小
+	KeyAuthNodeIDPoolStart                = "auth.node_id_pool_start"        // 作为父节点分配子 hub 号段的起点，应高于本地 counter 可能用到的号
 	KeySendChannelCount                   = "send.channel_count"
 	KeySendWorkersPerChan                 = "send.workers_per_channel"
 	KeySendChannelBuffer                  = "send.channel_buffer"
 	KeySendConnBuffer                     = "send.conn_buffer"
 	KeySendEnqueueTimeoutMS               = "send.enqueue_timeout_ms"
+	KeySendMaxQueuedFrames                = "send.max_queued_frames"   // 全局排队帧数上限，0 表示不限制
+	KeySendMaxQueuedBytes                 = "send.max_queued_bytes"    // 全局排队字节上限，0 表示不限制
+	KeySendOverflowPolicy                 = "send.overflow_policy"     // block|drop
+	KeySendCoalesceMaxFrames              = "send.coalesce_max_frames" // 单次写出合并的最大帧数，<=1 表示不合并
+	KeySendCoalesceMaxBytes               = "send.coalesce_max_bytes"  // 单次合并写出的字节预算
+	KeySendNodeRetryAttempts              = "send.node_retry_attempts" // SendToNode 找不到节点时的额外重试次数，0 表示不重试
+	KeySendNodeRetryDelayMS               = "send.node_retry_delay_ms" // SendToNode 两次重试之间的等待
 	KeyRoutingForwardRemote               = "routing.forward_remote"
-	KeyProcQueueStrategy                  = "process.queue_strategy" // conn|subproto|source_target|roundrobin
+	KeyRoutingForwardToChild              = "routing.forward_to_child"       // 是否向下转发给子节点（含广播），留空沿用 forward_remote
+	KeyRoutingForwardToParent             = "routing.forward_to_parent"      // 是否向上转发给父节点，留空沿用 forward_remote
+	KeyRoutingLoopDetect                  = "routing.loop_detect"            // 转发时在扩展头记录途经节点并丢弃回环帧
+	KeyRoutingPathMax                     = "routing.path_max"               // 途经路径最多保留的节点数
+	KeyRoutingBroadcastDedupSize          = "routing.broadcast_dedup_size"   // 广播去重记住的 (source,msgID) 数量，0 表示关闭
+	KeyRoutingBroadcastDedupTTLMS         = "routing.broadcast_dedup_ttl_ms" // 广播去重记录的有效期
+	KeyRoutingSubProtoPolicy              = "routing.subproto_policy"        // 按子协议的转发策略，如 "5:forward;7:local_only;9:no_broadcast"
+	KeyRoutingRouteCacheSize              = "routing.route_cache_size"       // 选路结果缓存的目标数，0 表示关闭
+	KeyRoutingRouteCacheNegTTLMS          = "routing.route_cache_neg_ttl_ms" // 不可达目标的缓存有效期，0 表示不缓存
+	KeyProcQueueStrategy                  = "process.queue_strategy"         // conn|subproto|source_target|roundrobin
+	KeyProcLargeFrameBytes                = "process.large_frame_bytes"      // >0 时 payload 不小于该值的帧分流到专用的最后一个队列
 	KeyDefaultForwardEnable               = "routing.default_forward_enable"
 	KeyDefaultForwardTarget               = "routing.default_forward_target"
-	KeyDefaultForwardMap                  = "routing.default_forward_map"
+	KeyDefaultForwardMap                  = "routing.default_forward_map"             // 格式：子协议:节点;子协议:节点
+	KeyDefaultForwardPreserveSource       = "routing.default_forward_preserve_source" // 默认转发时保留原始 SourceID，false 时改写为本节点
 	KeyParentEnable                       = "parent.enable"
 	KeyParentAddr                         = "parent.addr"
+	KeyParentAddrs                        = "parent.addrs"       // 逗号分隔的多个父节点地址，按顺序故障切换
+	KeyParentHotStandby                   = "parent.hot_standby" // 是否对下一个父节点保持热备链路
 	KeyParentJoinPermit                   = "parent.join_permit"
 	KeyParentReconnectSec                 = "parent.reconnect_sec"
-	KeyAuthNodePrivKey                    = "auth.node_privkey" // base64 DER p256 private key
-	KeyAuthNodePubKey                     = "auth.node_pubkey"  // base64 DER p256 public key
+	KeyParentReconnectMinSec              = "parent.reconnect_min_sec" // 0 表示沿用 parent.reconnect_sec
+	KeyParentReconnectMaxSec              = "parent.reconnect_max_sec"
+	KeyParentReconnectJitter              = "parent.reconnect_jitter" // 抖动比例 0~1
+	KeyParentSelfID                       = "parent.self_id"          // 非空时父链路建立后先以该 device_id 注册
+	KeyParentLogin                        = "parent.login"            // 注册成功后是否继续 login
+	KeyParentAuthTimeoutSec               = "parent.auth_timeout_sec"
+	KeyParentCredential                   = "parent.credential"       // 自注册获得的凭证，父链路 login 时携带（见 bootstrap.RegisterAndBind）
+	KeyParentHeartbeatSec                 = "parent.heartbeat_sec"    // >0 时按该间隔向父链路发 ping（子协议取 reader.heartbeat_subproto）
+	KeyParentHeartbeatMisses              = "parent.heartbeat_misses" // 连续多少次 ping 未收到 pong 即断开父链路并重连
+	KeyAuthNodePrivKey                    = "auth.node_privkey"       // base64 DER p256 private key
+	KeyAuthNodePubKey                     = "auth.node_pubkey"        // base64 DER p256 public key
 	KeyAuthTrustedNodes                   = "auth.trusted_nodes"
+	KeyReaderReadTimeoutSec               = "reader.read_timeout_sec"   // 0 表示不启用空闲读超时
+	KeyReaderFrameTimeoutSec              = "reader.frame_timeout_sec"  // 0 表示不限制单帧耗时
+	KeyReaderBufferSize                   = "reader.buffer_size"        // bufio 大小；<0 关闭缓冲
+	KeyReaderPayloadPool                  = "reader.payload_pool"       // 开启后 payload 在回调返回后被复用
+	KeyReaderCopyOnDispatch               = "reader.copy_on_dispatch"   // 开启 payload_pool 时分发前拷贝 payload
+	KeyReaderStreamReceive                = "reader.stream_receive"     // 带流式标记的帧以 io.Reader 交付
+	KeyReaderHeartbeatSubProto            = "reader.heartbeat_subproto" // 非 0 时空闲超时前先发心跳 ping
+	KeyHeaderNegotiate                    = "header.negotiate"          // 连接建立后是否做头版本协商
+	KeyHeaderVersions                     = "header.versions"           // 本端支持的头版本，格式：2,1
+	KeyHeaderNegotiateTimeoutMS           = "header.negotiate_timeout_ms"
+	KeyConnHalfCloseGraceMS               = "conn.half_close_grace_ms"   // 对端半关闭后继续发送积压响应的宽限期，0 表示收到 EOF 即整体关闭
+	KeyConnLoopbackID                     = "conn.loopback_id"           // 非空时以该连接 ID 注册本节点的回环连接，发往本节点的 Send 交给本地处理流程
+	KeyKickSendBye                        = "kick.send_bye"              // KickNode 关闭连接前是否先发送告别帧
+	KeyDebugRecentFrames                  = "debug.recent_frames"        // 每条连接保留的最近接收帧数，0 表示关闭
+	KeyDebugRecentPayloadBytes            = "debug.recent_payload_bytes" // 接收历史中每帧保留的 payload 前缀字节数
 )
 
 const (
-	DefaultAuthRolePerms                  = "superadmin:*;admin:file.read,file.write,flow.set,flow.delete,flow.run,flow.read,exec.call,exec.cap.query,exec.cap.sync,var.private_set,var.revoke,var.subscribe,auth.revoke,auth.pending.list,auth.register.approve,auth.register.reject,auth.permit.issue,auth.permit.revoke;node:file.read,file.write,flow.set,flow.run,flow.read,exec.call,exec.cap.query,exec.cap.sync"
+	DefaultAuthRolePerms                  = "superadmin:*;admin:file.read,file.write,flow.set,flow.delete,flow.run,flow.read,exec.call,exec.cap.query,exec.cap.sync,var.private_set,var.revoke,var.subscribe,auth.revoke,auth.pending.list,auth.register.approve,auth.register.reject,auth.permit.issue,auth.permit.revoke,sys.read,sys.write;node:file.read,file.write,flow.set,flow.run,flow.read,exec.call,exec.cap.query,exec.cap.sync"
 	DefaultAuthBootstrapFirstRegisterRole = "superadmin"
 )
 
@@ -64,10 +127,17 @@ func NewMap(data map[string]string) *MapConfig {
 	ensureDefault(mc.data, KeyProcChannelCount, "1")
 	ensureDefault(mc.data, KeyProcWorkersPerChan, "1")
 	ensureDefault(mc.data, KeyProcChannelBuffer, "64")
+	ensureDefault(mc.data, KeyProcPanicBackoffMS, "10")
+	ensureDefault(mc.data, KeyProcPanicBackoffMaxMS, "1000")
+	ensureDefault(mc.data, KeyProcLatencyHistogram, "false")
+	ensureDefault(mc.data, KeyProcNoHandlerPolicy, "fallback")
+	ensureDefault(mc.data, KeyProcReplyNoHandler, "false")
+	ensureDefault(mc.data, KeyProcEnqueueTimeoutMS, "0")
 	ensureDefault(mc.data, KeyAuthDefaultRole, "node")
 	ensureDefault(mc.data, KeyAuthDefaultPerms, "")
 	ensureDefault(mc.data, KeyAuthNodeRoles, "")
 	ensureDefault(mc.data, KeyAuthRolePerms, DefaultAuthRolePerms)
+	ensureDefault(mc.data, KeyAuthRoleRates, "")
 	ensureDefault(mc.data, KeyAuthRegisterRequireApproval, "false")
 	ensureDefault(mc.data, KeyAuthRegisterPendingTTLSec, "86400")
 	ensureDefault(mc.data, KeyAuthRegisterPermitTTLSec, "3600")
@@ -76,20 +146,74 @@ func NewMap(data map[string]string) *MapConfig {
 	ensureDefault(mc.data, KeyAuthBootstrapFirstRegisterDeviceID, "")
 	ensureDefault(mc.data, KeyAuthBootstrapFirstRegisterPubKey, "")
 	ensureDefault(mc.data, KeyAuthBootstrapFirstRegisterEpoch, "0")
+	ensureDefault(mc.data, KeyAuthDuplicateLoginPolicy, "kick_old")
+	ensureDefault(mc.data, KeyAuthSessionTTLSec, "0")
+	ensureDefault(mc.data, KeyAuthSessionHeartbeatExtends, "false")
+	ensureDefault(mc.data, KeyAuthLoginRatePerMin, "30")
+	ensureDefault(mc.data, KeyAuthRegisterRatePerMin, "10")
+	ensureDefault(mc.data, KeyAuthLoginMaxFailures, "5")
+	ensureDefault(mc.data, KeyAuthLoginLockoutSec, "300")
+	ensureDefault(mc.data, KeyAuthNodeIDStrategy, "counter")
+	ensureDefault(mc.data, KeyAuthNodeIDRange, "")
+	ensureDefault(mc.data, KeyAuthNodeIDBlockSize, "10000")
+	ensureDefault(mc.data, KeyAuthNodeIDPoolStart, "1000000")
 	ensureDefault(mc.data, KeySendChannelCount, "1")
 	ensureDefault(mc.data, KeySendWorkersPerChan, "1")
 	ensureDefault(mc.data, KeySendChannelBuffer, "64")
 	ensureDefault(mc.data, KeySendConnBuffer, "64")
 	ensureDefault(mc.data, KeySendEnqueueTimeoutMS, "100")
+	ensureDefault(mc.data, KeySendMaxQueuedFrames, "0")
+	ensureDefault(mc.data, KeySendMaxQueuedBytes, "0")
+	ensureDefault(mc.data, KeySendOverflowPolicy, "block")
+	ensureDefault(mc.data, KeySendCoalesceMaxFrames, "0")
+	ensureDefault(mc.data, KeySendCoalesceMaxBytes, "65536")
+	ensureDefault(mc.data, KeySendNodeRetryAttempts, "0")
+	ensureDefault(mc.data, KeySendNodeRetryDelayMS, "20")
 	ensureDefault(mc.data, KeyRoutingForwardRemote, "true")
+	ensureDefault(mc.data, KeyRoutingForwardToChild, "")
+	ensureDefault(mc.data, KeyRoutingForwardToParent, "")
+	ensureDefault(mc.data, KeyRoutingLoopDetect, "false")
+	ensureDefault(mc.data, KeyRoutingPathMax, "16")
+	ensureDefault(mc.data, KeyRoutingBroadcastDedupSize, "0")
+	ensureDefault(mc.data, KeyRoutingBroadcastDedupTTLMS, "30000")
+	ensureDefault(mc.data, KeyRoutingSubProtoPolicy, "")
+	ensureDefault(mc.data, KeyRoutingRouteCacheSize, "1024")
+	ensureDefault(mc.data, KeyRoutingRouteCacheNegTTLMS, "1000")
 	ensureDefault(mc.data, KeyProcQueueStrategy, "conn")
+	ensureDefault(mc.data, KeyProcLargeFrameBytes, "0")
 	ensureDefault(mc.data, KeyDefaultForwardEnable, "")
 	ensureDefault(mc.data, KeyDefaultForwardTarget, "")
 	ensureDefault(mc.data, KeyDefaultForwardMap, "")
+	ensureDefault(mc.data, KeyDefaultForwardPreserveSource, "false")
 	ensureDefault(mc.data, KeyParentEnable, "false")
 	ensureDefault(mc.data, KeyParentAddr, "")
+	ensureDefault(mc.data, KeyParentAddrs, "")
+	ensureDefault(mc.data, KeyParentHotStandby, "false")
 	ensureDefault(mc.data, KeyParentJoinPermit, "")
 	ensureDefault(mc.data, KeyParentReconnectSec, "3")
+	ensureDefault(mc.data, KeyParentReconnectMinSec, "0")
+	ensureDefault(mc.data, KeyParentReconnectMaxSec, "60")
+	ensureDefault(mc.data, KeyParentReconnectJitter, "0.2")
+	ensureDefault(mc.data, KeyParentSelfID, "")
+	ensureDefault(mc.data, KeyParentLogin, "false")
+	ensureDefault(mc.data, KeyParentAuthTimeoutSec, "10")
+	ensureDefault(mc.data, KeyParentHeartbeatSec, "0")
+	ensureDefault(mc.data, KeyParentHeartbeatMisses, "3")
+	ensureDefault(mc.data, KeyReaderReadTimeoutSec, "0")
+	ensureDefault(mc.data, KeyReaderFrameTimeoutSec, "0")
+	ensureDefault(mc.data, KeyReaderBufferSize, "4096")
+	ensureDefault(mc.data, KeyReaderPayloadPool, "false")
+	ensureDefault(mc.data, KeyReaderCopyOnDispatch, "false")
+	ensureDefault(mc.data, KeyReaderStreamReceive, "false")
+	ensureDefault(mc.data, KeyReaderHeartbeatSubProto, "0")
+	ensureDefault(mc.data, KeyHeaderNegotiate, "false")
+	ensureDefault(mc.data, KeyHeaderVersions, "2,1")
+	ensureDefault(mc.data, KeyHeaderNegotiateTimeoutMS, "2000")
+	ensureDefault(mc.data, KeyConnHalfCloseGraceMS, "0")
+	ensureDefault(mc.data, KeyConnLoopbackID, "")
+	ensureDefault(mc.data, KeyKickSendBye, "true")
+	ensureDefault(mc.data, KeyDebugRecentFrames, "0")
+	ensureDefault(mc.data, KeyDebugRecentPayloadBytes, "0")
 	return mc
 }
 
@@ -121,18 +245,28 @@ func (m *MapConfig) Get(key string) (string, bool) {
 }
 
 // Set updates a key at runtime.
+// 写入的键被标记为运行期覆盖（见 IsRuntime），此后 ReloadFrom 不再用重载源的值覆盖它。
 func (m *MapConfig) Set(key, val string) {
 	m.mu.Lock()
 	m.data[key] = val
+	if m.runtime == nil {
+		m.runtime = make(map[string]struct{})
+	}
+	m.runtime[key] = struct{}{}
 	m.mu.Unlock()
 }
 
 // Merge overlays another config into current config and returns itself.
+// *MapConfig 直接拷贝底层 map；其他实现按 other.Keys() 逐键经 other.Get 读取，先读完再加锁写入，
+// 因此 other 包装了 m 本身时也不会死锁。
 func (m *MapConfig) Merge(other core.IConfig) core.IConfig {
 	if m == nil || other == nil {
 		return m
 	}
-	if o, ok := other.(*MapConfig); ok && o != nil {
+	if o, ok := other.(*MapConfig); ok {
+		if o == nil || o == m {
+			return m
+		}
 		o.mu.RLock()
 		m.mu.Lock()
 		for k, v := range o.data {
@@ -142,7 +276,14 @@ func (m *MapConfig) Merge(other core.IConfig) core.IConfig {
 		o.mu.RUnlock()
 		return m
 	}
-	// Unable to enumerate other implementations; return as is.
+	keys := other.Keys()
+	data := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if v, ok := other.Get(k); ok {
+			data[k] = v
+		}
+	}
+	m.MergeFile(data)
 	return m
 }
 
@@ -3,8 +3,12 @@ package config
 // 本文件覆盖 Core 框架中与 `config` 相关的行为。
 
 import (
+	"maps"
+	"slices"
 	"strings"
 	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
 )
 
 func TestNewMap_DefaultAuthRoleHierarchy(t *testing.T) {
@@ -32,3 +36,69 @@ func TestNewMap_DefaultAuthRoleHierarchy(t *testing.T) {
 		}
 	}
 }
+
+// envConfig 是只实现 core.IConfig 的非 MapConfig 配置，模拟从环境变量派生的配置源。
+type envConfig map[string]string
+
+func (e envConfig) Get(key string) (string, bool)         { v, ok := e[key]; return v, ok }
+func (e envConfig) Merge(other core.IConfig) core.IConfig { return e }
+func (e envConfig) Set(key, val string)                   { e[key] = val }
+func (e envConfig) Keys() []string                        { return slices.Sorted(maps.Keys(e)) }
+
+func TestMapConfigMergeNonMapConfig(t *testing.T) {
+	cfg := NewMap(map[string]string{KeyProcChannelCount: "2", "custom.keep": "yes"})
+	env := envConfig{KeyProcChannelCount: "8", "custom.env": "from-env", "custom.empty": ""}
+
+	if got := cfg.Merge(env); got != core.IConfig(cfg) {
+		t.Fatalf("Merge returned %T, want the receiver", got)
+	}
+	for key, want := range map[string]string{
+		KeyProcChannelCount: "8",
+		"custom.env":        "from-env",
+		"custom.empty":      "",
+		"custom.keep":       "yes",
+	} {
+		if got, ok := cfg.Get(key); !ok || got != want {
+			t.Fatalf("%s=%q (ok=%v), want %q", key, got, ok, want)
+		}
+	}
+
+	// MapConfig 快速路径与自身合并均保持可用。
+	cfg.Merge(NewMap(map[string]string{"custom.map": "1"}))
+	cfg.Merge(cfg)
+	if v, _ := cfg.Get("custom.map"); v != "1" {
+		t.Fatalf("custom.map=%q after MapConfig merge", v)
+	}
+}
+
+func TestMapConfigReloadFromKeepsRuntimeSets(t *testing.T) {
+	live := NewMap(map[string]string{KeyAuthRoleRates: "node:100", KeyProcChannelCount: "2"})
+	live.Set(KeyAuthRoleRates, "node:5")
+	live.MergeFile(map[string]string{KeyProcChannelBuffer: "8"})
+	if !live.IsRuntime(KeyAuthRoleRates) || live.IsRuntime(KeyProcChannelBuffer) || live.IsRuntime(KeyProcChannelCount) {
+		t.Fatalf("runtime keys=%v, want only %s", live.RuntimeKeys(), KeyAuthRoleRates)
+	}
+
+	fresh := NewMap(map[string]string{KeyAuthRoleRates: "node:200", KeyProcChannelCount: "4"})
+	live.ReloadFrom(fresh)
+	for key, want := range map[string]string{
+		KeyAuthRoleRates:        "node:5", // 运行期覆盖保留
+		KeyProcChannelCount:     "4",      // 文件值刷新
+		KeyProcChannelBuffer:    "64",     // 重载源只剩默认值时回到默认
+		KeyAuthDefaultRole:      "node",
+		KeyRoutingForwardRemote: "true",
+	} {
+		if got, _ := live.Get(key); got != want {
+			t.Fatalf("%s=%q after reload, want %q", key, got, want)
+		}
+	}
+
+	live.ClearRuntime(KeyAuthRoleRates)
+	live.ReloadFrom(fresh)
+	if got, _ := live.Get(KeyAuthRoleRates); got != "node:200" || len(live.RuntimeKeys()) != 0 {
+		t.Fatalf("after ClearRuntime %s=%q runtime=%v", KeyAuthRoleRates, got, live.RuntimeKeys())
+	}
+	if live.ReloadFrom(live) != live {
+		t.Fatal("self reload should return the config unchanged")
+	}
+}
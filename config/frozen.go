@@ -0,0 +1,72 @@
+package config
+
+// 本文件承载 Core 框架中与 `frozen` 相关的通用逻辑。
+
+import (
+	"fmt"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// FrozenConfig 是任意 IConfig 的只读视图：Get/Keys 实时反映底层配置，Set 与 Merge 不生效。
+// 用于把共享的运行时配置交给只应读取的组件，避免其意外改写全局配置；底层配置自身仍可被持有者修改。
+type FrozenConfig struct {
+	inner  core.IConfig
+	strict bool
+}
+
+// Freeze 返回 cfg 的只读视图，Set/Merge 静默忽略；cfg 已是 FrozenConfig 时原样返回。
+func Freeze(cfg core.IConfig) *FrozenConfig {
+	if f, ok := cfg.(*FrozenConfig); ok {
+		return f
+	}
+	return &FrozenConfig{inner: cfg}
+}
+
+// FreezeStrict 与 Freeze 相同，但 Set/Merge 直接 panic，便于在开发与测试中定位误写。
+func FreezeStrict(cfg core.IConfig) *FrozenConfig {
+	if f, ok := cfg.(*FrozenConfig); ok {
+		cfg = f.inner
+	}
+	return &FrozenConfig{inner: cfg, strict: true}
+}
+
+// IsFrozen 判断 cfg 是否为只读视图。
+func IsFrozen(cfg core.IConfig) bool {
+	_, ok := cfg.(*FrozenConfig)
+	return ok
+}
+
+// Unwrap 返回被冻结的底层配置，供按配置实例建索引的组件（如 permission.SharedConfig）与 NotifyChanged 的通知对齐。
+func (f *FrozenConfig) Unwrap() core.IConfig { return f.inner }
+
+// Get 读取底层配置。
+func (f *FrozenConfig) Get(key string) (string, bool) {
+	if f.inner == nil {
+		return "", false
+	}
+	return f.inner.Get(key)
+}
+
+// Keys 返回底层配置的全部键。
+func (f *FrozenConfig) Keys() []string {
+	if f.inner == nil {
+		return nil
+	}
+	return f.inner.Keys()
+}
+
+// Set 不修改配置（FreezeStrict 创建时 panic）。
+func (f *FrozenConfig) Set(key, _ string) {
+	if f.strict {
+		panic(fmt.Sprintf("config: Set(%q) on frozen config", key))
+	}
+}
+
+// Merge 不修改配置并返回自身（FreezeStrict 创建时 panic）。
+func (f *FrozenConfig) Merge(core.IConfig) core.IConfig {
+	if f.strict {
+		panic("config: Merge on frozen config")
+	}
+	return f
+}
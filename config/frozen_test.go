@@ -0,0 +1,49 @@
+package config
+
+// 本文件覆盖 Core 框架中与 `frozen` 相关的行为。
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFrozenConfigIgnoresWritesAndTracksUnderlying(t *testing.T) {
+	base := NewMap(map[string]string{"custom.k": "v1"})
+	frozen := Freeze(base)
+
+	frozen.Set("custom.k", "changed")
+	frozen.Set("custom.new", "x")
+	if got := frozen.Merge(NewMap(map[string]string{"custom.k": "merged"})); got != frozen {
+		t.Fatalf("Merge returned %T, want the frozen view", got)
+	}
+	if v, _ := base.Get("custom.k"); v != "v1" {
+		t.Fatalf("underlying custom.k=%q, want unchanged v1", v)
+	}
+	if _, ok := base.Get("custom.new"); ok {
+		t.Fatal("Set through frozen view added a key")
+	}
+
+	// 持有者对底层配置的修改对只读视图可见。
+	base.Set("custom.k", "v2")
+	if v, ok := frozen.Get("custom.k"); !ok || v != "v2" {
+		t.Fatalf("frozen custom.k=%q ok=%v, want v2", v, ok)
+	}
+	if !slices.Equal(frozen.Keys(), base.Keys()) {
+		t.Fatal("Keys differ from the underlying config")
+	}
+	if !IsFrozen(frozen) || IsFrozen(base) || Freeze(frozen) != frozen {
+		t.Fatal("IsFrozen/Freeze mismatch")
+	}
+	if frozen.Unwrap() != any(base) {
+		t.Fatal("Unwrap did not return the underlying config")
+	}
+}
+
+func TestFreezeStrictPanicsOnSet(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Set on strict frozen config did not panic")
+		}
+	}()
+	FreezeStrict(NewMap(nil)).Set("custom.k", "v")
+}
@@ -0,0 +1,49 @@
+package config
+
+// 本文件承载 Core 框架中与 `notify` 相关的通用逻辑。
+
+import (
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+var changeSubs struct {
+	mu   sync.Mutex
+	next int
+	fns  map[int]func(core.IConfig)
+}
+
+// SubscribeChanges 订阅进程内的配置变更通知（通常由 builder.Watcher 在重载后发出），
+// fn 收到发生变化的配置实例；返回的 cancel 取消订阅。
+func SubscribeChanges(fn func(core.IConfig)) (cancel func()) {
+	if fn == nil {
+		return func() {}
+	}
+	changeSubs.mu.Lock()
+	if changeSubs.fns == nil {
+		changeSubs.fns = make(map[int]func(core.IConfig))
+	}
+	changeSubs.next++
+	id := changeSubs.next
+	changeSubs.fns[id] = fn
+	changeSubs.mu.Unlock()
+	return func() {
+		changeSubs.mu.Lock()
+		delete(changeSubs.fns, id)
+		changeSubs.mu.Unlock()
+	}
+}
+
+// NotifyChanged 通知所有订阅者 cfg 已更新；订阅者在调用方协程内同步执行。
+func NotifyChanged(cfg core.IConfig) {
+	changeSubs.mu.Lock()
+	fns := make([]func(core.IConfig), 0, len(changeSubs.fns))
+	for _, fn := range changeSubs.fns {
+		fns = append(fns, fn)
+	}
+	changeSubs.mu.Unlock()
+	for _, fn := range fns {
+		fn(cfg)
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+// 本文件承载 Core 框架中与 `reload` 相关的通用逻辑。
+
+import (
+	"sort"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// IsRuntime 判断 key 是否为经 Set 写入的运行期覆盖。MergeFile/Merge 写入的键视为来自文件或环境变量，不做标记。
+func (m *MapConfig) IsRuntime(key string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.runtime[key]
+	return ok
+}
+
+// RuntimeKeys 返回全部运行期覆盖的键（有序）。
+func (m *MapConfig) RuntimeKeys() []string {
+	m.mu.RLock()
+	keys := make([]string, 0, len(m.runtime))
+	for k := range m.runtime {
+		keys = append(keys, k)
+	}
+	m.mu.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// ClearRuntime 取消 keys 的运行期覆盖标记，当前值保留，下次 ReloadFrom 时恢复为重载源的值；
+// 不传参数时清除全部标记。
+func (m *MapConfig) ClearRuntime(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(keys) == 0 {
+		m.runtime = nil
+		return
+	}
+	for _, k := range keys {
+		delete(m.runtime, k)
+	}
+}
+
+// ReloadFrom 用重载得到的 fresh 刷新当前配置并返回自身：来自文件/环境变量的键（含默认值）被覆盖，
+// 经 Set 写入的运行期覆盖保持不变。与 Merge 一样先读完 fresh 再加锁写入，fresh 包装了 m 本身时也不会死锁。
+func (m *MapConfig) ReloadFrom(fresh core.IConfig) core.IConfig {
+	if m == nil || fresh == nil {
+		return m
+	}
+	if o, ok := fresh.(*MapConfig); ok && o == m {
+		return m
+	}
+	keys := fresh.Keys()
+	data := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if v, ok := fresh.Get(k); ok {
+			data[k] = v
+		}
+	}
+	m.mu.Lock()
+	for k, v := range data {
+		if _, sticky := m.runtime[k]; sticky {
+			continue
+		}
+		m.data[k] = v
+	}
+	m.mu.Unlock()
+	return m
+}
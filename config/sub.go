@@ -0,0 +1,76 @@
+package config
+
+// 本文件承载 Core 框架中与 `sub` 相关的通用逻辑。
+
+import (
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// SubConfig 是 IConfig 上带前缀的子视图：Get/Set 自动在 key 前拼接 "<prefix>."，Keys 只列出该前缀下的键并去掉前缀。
+// 组件据此只需认识短键（如 "channel_count"），挂到哪个前缀下由调用方决定；读写均实时作用于底层配置。
+type SubConfig struct {
+	inner  core.IConfig
+	prefix string // 含结尾的 "."
+}
+
+// Sub 返回前缀为 prefix 的子视图，如 Sub("send").Get("channel_count") 读取 "send.channel_count"；
+// prefix 结尾的 "." 可省略，为空时返回 m 本身。
+func (m *MapConfig) Sub(prefix string) core.IConfig {
+	return newSubConfig(m, prefix)
+}
+
+func newSubConfig(inner core.IConfig, prefix string) core.IConfig {
+	prefix = strings.TrimSuffix(strings.TrimSpace(prefix), ".")
+	if prefix == "" {
+		return inner
+	}
+	return &SubConfig{inner: inner, prefix: prefix + "."}
+}
+
+// Prefix 返回子视图的完整前缀（不含结尾的 "."）。
+func (s *SubConfig) Prefix() string { return strings.TrimSuffix(s.prefix, ".") }
+
+// Sub 在当前前缀下继续嵌套，如 cfg.Sub("send").Sub("budget") 对应 "send.budget."。
+func (s *SubConfig) Sub(prefix string) core.IConfig {
+	prefix = strings.TrimSuffix(strings.TrimSpace(prefix), ".")
+	if prefix == "" {
+		return s
+	}
+	return &SubConfig{inner: s.inner, prefix: s.prefix + prefix + "."}
+}
+
+// Get 读取底层配置中的 "<prefix>.<key>"。
+func (s *SubConfig) Get(key string) (string, bool) {
+	return s.inner.Get(s.prefix + key)
+}
+
+// Set 写入底层配置中的 "<prefix>.<key>"。
+func (s *SubConfig) Set(key, val string) {
+	s.inner.Set(s.prefix+key, val)
+}
+
+// Keys 返回底层配置中位于前缀下的键（已去掉前缀），顺序与底层 Keys 一致。
+func (s *SubConfig) Keys() []string {
+	var out []string
+	for _, k := range s.inner.Keys() {
+		if short, ok := strings.CutPrefix(k, s.prefix); ok && short != "" {
+			out = append(out, short)
+		}
+	}
+	return out
+}
+
+// Merge 把 other 的每个键加上前缀后写入底层配置，返回自身。
+func (s *SubConfig) Merge(other core.IConfig) core.IConfig {
+	if other == nil {
+		return s
+	}
+	for _, k := range other.Keys() {
+		if v, ok := other.Get(k); ok {
+			s.Set(k, v)
+		}
+	}
+	return s
+}
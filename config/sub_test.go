@@ -0,0 +1,60 @@
+package config
+
+// 本文件覆盖 Core 框架中与 `sub` 相关的行为。
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSubConfigMapsShortKeysUnderPrefix(t *testing.T) {
+	cfg := NewMap(map[string]string{KeySendChannelCount: "3"})
+	send := cfg.Sub("send")
+
+	if v, ok := send.Get("channel_count"); !ok || v != "3" {
+		t.Fatalf("Sub(send).Get(channel_count)=%q,%v, want 3", v, ok)
+	}
+	send.Set("channel_count", "8")
+	if v, _ := cfg.Get(KeySendChannelCount); v != "8" {
+		t.Fatalf("%s=%q after Sub Set, want 8", KeySendChannelCount, v)
+	}
+	cfg.Set(KeySendChannelBuffer, "99")
+	if v, _ := send.Get("channel_buffer"); v != "99" {
+		t.Fatalf("Sub view missed parent update: %q", v)
+	}
+	if _, ok := send.Get(KeySendChannelCount); ok {
+		t.Fatal("full key resolved through sub view")
+	}
+	if trailing := cfg.Sub("send."); !slices.Equal(trailing.Keys(), send.Keys()) {
+		t.Fatalf("Sub(\"send.\") keys differ from Sub(\"send\")")
+	}
+	if cfg.Sub("") != cfg {
+		t.Fatal("Sub(\"\") should return the config itself")
+	}
+}
+
+func TestSubConfigKeysAndMerge(t *testing.T) {
+	cfg := &MapConfig{data: map[string]string{
+		"send.a":      "1",
+		"send.b.c":    "2",
+		"sender.x":    "3",
+		"process.a":   "4",
+		"send":        "5",
+		"send.budget": "6",
+	}}
+	send := cfg.Sub("send")
+	if got := send.Keys(); !slices.Equal(got, []string{"a", "b.c", "budget"}) {
+		t.Fatalf("Keys()=%v", got)
+	}
+	nested := send.(*SubConfig).Sub("b")
+	if v, ok := nested.Get("c"); !ok || v != "2" || nested.(*SubConfig).Prefix() != "send.b" {
+		t.Fatalf("nested Get(c)=%q,%v prefix=%q", v, ok, nested.(*SubConfig).Prefix())
+	}
+
+	send.Merge(&MapConfig{data: map[string]string{"a": "10", "d": "11"}})
+	for k, want := range map[string]string{"send.a": "10", "send.d": "11", "process.a": "4"} {
+		if v, _ := cfg.Get(k); v != want {
+			t.Fatalf("%s=%q after Merge, want %q", k, v, want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package core
+
+// 本文件承载 Core 框架中与 `connid` 相关的通用逻辑。
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+)
+
+// ConnIDGenerator 为新建连接生成 ID。ID 在连接构造时生成一次并在整个生命周期内保持不变，
+// 连接管理器索引与 SendDispatcher 的按连接写入器都以它为键，因此必须在进程内唯一。
+type ConnIDGenerator func(local, remote net.Addr) string
+
+// AddrConnID 为默认生成器，沿用 "local->remote" 形式。
+// 它不保证唯一（同一元组的快速重连、或承载层地址相同时会冲突），且会把地址带入日志与指标。
+func AddrConnID(local, remote net.Addr) string {
+	return fmt.Sprintf("%s->%s", addrString(local), addrString(remote))
+}
+
+// CounterConnID 返回以单调计数生成 "<prefix><n>" 的生成器，n 自 1 起。
+func CounterConnID(prefix string) ConnIDGenerator {
+	var seq atomic.Uint64
+	return func(net.Addr, net.Addr) string {
+		return prefix + strconv.FormatUint(seq.Add(1), 10)
+	}
+}
+
+// UUIDConnID 生成随机 UUIDv4 作为连接 ID，不携带任何地址信息。
+func UUIDConnID(net.Addr, net.Addr) string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return "<nil>"
+	}
+	return a.String()
+}
@@ -0,0 +1,30 @@
+package core
+
+// 本文件覆盖 Core 框架中与 `connid` 相关的行为。
+
+import (
+	"net"
+	"regexp"
+	"testing"
+)
+
+func TestConnIDGenerators(t *testing.T) {
+	local := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000}
+	remote := &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5555}
+	if got := AddrConnID(local, remote); got != "10.0.0.1:9000->10.0.0.2:5555" {
+		t.Fatalf("AddrConnID=%q", got)
+	}
+	gen := CounterConnID("n")
+	if a, b := gen(local, remote), gen(local, remote); a != "n1" || b != "n2" {
+		t.Fatalf("counter ids=%q,%q", a, b)
+	}
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := UUIDConnID(local, remote)
+		if !uuid.MatchString(id) || seen[id] {
+			t.Fatalf("UUIDConnID=%q (dup=%v)", id, seen[id])
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,215 @@
+package core
+
+// 本文件承载 Core 框架中与 `connmeta` 相关的通用逻辑。
+
+// 连接元数据中节点身份相关的键；值的规范存储类型分别为 uint32 与 string。
+const (
+	MetaNodeIDKey   = "nodeID"
+	MetaDeviceIDKey = "deviceID"
+	// MetaCertBoundKey 为 true 表示节点身份在接入时取自已校验的 TLS 客户端证书，login 可跳过。
+	MetaCertBoundKey = "certBound"
+	// MetaCertIdentityKey 暂存监听器从已校验客户端证书映射出的身份（CertIdentity），
+	// 由服务端在开始读取前经 BindConnIdentity 绑定。
+	MetaCertIdentityKey = "certIdentity"
+)
+
+// CertIdentity 是从 TLS 客户端证书映射出、尚待绑定的节点身份。
+type CertIdentity struct {
+	NodeID   uint32
+	DeviceID string
+}
+
+// ReservedMetaKey 报告 key 是否为框架写入的身份/状态元数据键；连接对元数据条目数的限制不应拒绝这些键，
+// 否则登录绑定、角色标记等会被静默丢弃。
+func ReservedMetaKey(key string) bool {
+	switch key {
+	case MetaNodeIDKey, MetaDeviceIDKey, MetaRoleKey, MetaParentStandbyKey, MetaCertBoundKey, MetaCertIdentityKey,
+		MetaCloseReasonKey, MetaSessionExpiryKey, MetaSessionTTLKey, MetaDrainingKey:
+		return true
+	default:
+		return false
+	}
+}
+
+// ConnCertIdentity 读取连接上待绑定的证书身份。
+func ConnCertIdentity(conn IConnection) (CertIdentity, bool) {
+	if conn == nil {
+		return CertIdentity{}, false
+	}
+	v, _ := conn.GetMeta(MetaCertIdentityKey)
+	id, ok := v.(CertIdentity)
+	return id, ok && (id.NodeID != 0 || id.DeviceID != "")
+}
+
+// BindConnIdentity 是登录完成时绑定身份的通用例程：写入 nodeID/deviceID 元数据并经 cm 建立索引，
+// 由管理器执行 DuplicatePolicy 并触发 OnNodeBound。cm 实现 INodeBinder 时同时执行冲突策略，
+// 被拒绝时回滚元数据并返回该错误。
+func BindConnIdentity(cm IConnectionManager, conn IConnection, nodeID uint32, deviceID string) error {
+	if conn == nil {
+		return nil
+	}
+	if nodeID != 0 {
+		SetConnNodeID(conn, nodeID)
+	}
+	if deviceID != "" {
+		SetConnDeviceID(conn, deviceID)
+	}
+	if nodeID != 0 {
+		if nb, ok := cm.(INodeBinder); ok {
+			if err := nb.TryBindNode(nodeID, conn); err != nil {
+				SetConnNodeID(conn, 0)
+				if deviceID != "" {
+					SetConnDeviceID(conn, "")
+				}
+				return err
+			}
+		} else if cm != nil {
+			cm.UpdateNodeIndex(nodeID, conn)
+		}
+	}
+	if deviceID != "" && cm != nil {
+		cm.UpdateDeviceIndex(deviceID, conn)
+	}
+	return nil
+}
+
+// ConnNodeID 读取连接绑定的节点号，未绑定或类型无法识别时返回 0。
+// 除规范的 uint32 外，兼容历史上写入的 uint64/int/int64（负数视为未绑定）。
+func ConnNodeID(conn IConnection) uint32 {
+	if conn == nil {
+		return 0
+	}
+	if v, ok := conn.GetMeta(MetaNodeIDKey); ok {
+		if id, ok2 := MetaUint32(v); ok2 {
+			return id
+		}
+	}
+	return 0
+}
+
+// SetConnNodeID 以规范类型 uint32 写入节点号。
+func SetConnNodeID(conn IConnection, id uint32) {
+	if conn != nil {
+		conn.SetMeta(MetaNodeIDKey, id)
+	}
+}
+
+// ConnDeviceID 读取连接绑定的设备 ID，未绑定时返回空串。
+func ConnDeviceID(conn IConnection) string {
+	return metaString(conn, MetaDeviceIDKey)
+}
+
+// SetConnDeviceID 写入设备 ID。
+func SetConnDeviceID(conn IConnection, id string) {
+	if conn != nil {
+		conn.SetMeta(MetaDeviceIDKey, id)
+	}
+}
+
+// ConnCertBound 判断连接身份是否在接入时由 TLS 客户端证书绑定。
+func ConnCertBound(conn IConnection) bool {
+	if conn == nil {
+		return false
+	}
+	v, _ := conn.GetMeta(MetaCertBoundKey)
+	bound, _ := v.(bool)
+	return bound
+}
+
+// ClearConnIdentity 解除连接的节点/设备身份（logout）：清空相关元数据，
+// 并从 cm 的节点、设备索引中只摘除该连接（cm 实现 IConnUnbinder 时；同一身份的其他连接保持可达），
+// 否则在索引仍指向该连接时删除整条映射；返回解除前的 nodeID 与 deviceID，便于向父节点同步。
+func ClearConnIdentity(cm IConnectionManager, conn IConnection) (nodeID uint32, deviceID string) {
+	if conn == nil {
+		return 0, ""
+	}
+	nodeID, deviceID = ConnNodeID(conn), ConnDeviceID(conn)
+	SetConnNodeID(conn, 0)
+	SetConnDeviceID(conn, "")
+	conn.SetMeta(MetaCertBoundKey, false)
+	if cm == nil {
+		return nodeID, deviceID
+	}
+	if ub, ok := cm.(IConnUnbinder); ok {
+		ub.UnbindNode(nodeID, conn)
+		ub.UnbindDevice(deviceID, conn)
+		return nodeID, deviceID
+	}
+	if nodeID != 0 {
+		if c, ok := cm.GetByNode(nodeID); ok && c == conn {
+			cm.UpdateNodeIndex(nodeID, nil)
+		}
+	}
+	if deviceID != "" {
+		if c, ok := cm.GetByDevice(deviceID); ok && c == conn {
+			cm.UpdateDeviceIndex(deviceID, nil)
+		}
+	}
+	return nodeID, deviceID
+}
+
+// MetaDrainingKey 标记连接处于排空状态（bool）：不再分发新收到的帧，已在处理的请求照常完成。
+const MetaDrainingKey = "draining"
+
+// ConnDraining 报告连接是否处于排空状态。
+func ConnDraining(conn IConnection) bool {
+	if conn == nil {
+		return false
+	}
+	v, ok := conn.GetMeta(MetaDrainingKey)
+	return ok && v == true
+}
+
+// SetConnDraining 把连接标记为排空状态。
+func SetConnDraining(conn IConnection) {
+	if conn != nil {
+		conn.SetMeta(MetaDrainingKey, true)
+	}
+}
+
+// ConnRole 读取连接角色（RoleParent/RoleChild/RoleLocal），未设置时返回空串。
+func ConnRole(conn IConnection) string {
+	return metaString(conn, MetaRoleKey)
+}
+
+// SetConnRole 写入连接角色。
+func SetConnRole(conn IConnection, role string) {
+	if conn != nil {
+		conn.SetMeta(MetaRoleKey, role)
+	}
+}
+
+// MetaUint32 把动态元数据值转换为 uint32，兼容常见整数类型；负数或其他类型返回 false。
+func MetaUint32(v any) (uint32, bool) {
+	switch vv := v.(type) {
+	case uint32:
+		return vv, true
+	case uint64:
+		return uint32(vv), true
+	case int:
+		if vv < 0 {
+			return 0, false
+		}
+		return uint32(vv), true
+	case int64:
+		if vv < 0 {
+			return 0, false
+		}
+		return uint32(vv), true
+	default:
+		return 0, false
+	}
+}
+
+// metaString 读取字符串类型的元数据，缺失或类型不符时返回空串。
+func metaString(conn IConnection, key string) string {
+	if conn == nil {
+		return ""
+	}
+	if v, ok := conn.GetMeta(key); ok {
+		if s, ok2 := v.(string); ok2 {
+			return s
+		}
+	}
+	return ""
+}
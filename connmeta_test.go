@@ -0,0 +1,60 @@
+package core
+
+// 本文件覆盖 Core 框架中与 `connmeta` 相关的行为。
+
+import "testing"
+
+// metaConn 只实现元数据读写，其余方法未使用。
+type metaConn struct {
+	IConnection
+	meta map[string]any
+}
+
+func (c *metaConn) SetMeta(key string, val any) { c.meta[key] = val }
+func (c *metaConn) GetMeta(key string) (any, bool) {
+	v, ok := c.meta[key]
+	return v, ok
+}
+
+func TestConnNodeIDAcceptsLegacyIntegerTypes(t *testing.T) {
+	cases := []struct {
+		name string
+		val  any
+		want uint32
+	}{
+		{"uint32", uint32(7), 7},
+		{"uint64", uint64(8), 8},
+		{"int", 9, 9},
+		{"int64", int64(10), 10},
+		{"negative int", -1, 0},
+		{"string", "11", 0},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &metaConn{meta: map[string]any{MetaNodeIDKey: tc.val}}
+			if got := ConnNodeID(c); got != tc.want {
+				t.Fatalf("ConnNodeID=%d, want %d", got, tc.want)
+			}
+		})
+	}
+	if ConnNodeID(nil) != 0 {
+		t.Fatalf("ConnNodeID(nil) should be 0")
+	}
+}
+
+func TestConnMetaSettersUseCanonicalTypes(t *testing.T) {
+	c := &metaConn{meta: map[string]any{}}
+	SetConnNodeID(c, 42)
+	SetConnDeviceID(c, "dev-1")
+	SetConnRole(c, RoleChild)
+	if _, ok := c.meta[MetaNodeIDKey].(uint32); !ok {
+		t.Fatalf("nodeID stored as %T, want uint32", c.meta[MetaNodeIDKey])
+	}
+	if ConnNodeID(c) != 42 || ConnDeviceID(c) != "dev-1" || ConnRole(c) != RoleChild {
+		t.Fatalf("got node=%d device=%q role=%q", ConnNodeID(c), ConnDeviceID(c), ConnRole(c))
+	}
+	c.meta[MetaDeviceIDKey] = 123
+	if ConnDeviceID(c) != "" {
+		t.Fatalf("non-string deviceID should read as empty")
+	}
+}
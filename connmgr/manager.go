@@ -3,8 +3,16 @@ package connmgr
 // 本文件承载 Core 框架中与 `manager` 相关的通用逻辑。
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 )
@@ -12,10 +20,78 @@ import (
 var (
 	errCompatLinkRequiresConnection = errors.New("compat link manager requires link to implement IConnection")
 
+	// ErrNodeIDConflict 表示 nodeID 已绑定到另一条存活连接，且当前策略拒绝抢占。
+	ErrNodeIDConflict = errors.New("node id already bound to another connection")
+
+	// ErrDuplicateConn 表示同一 nodeID/deviceID 已有另一条存活直连，且 DuplicatePolicy 为 RejectNew。
+	ErrDuplicateConn = errors.New("duplicate connection for the same node or device")
+
 	_ core.IConnectionManager = (*Manager)(nil)
 	_ core.ILinkManager       = (*Manager)(nil)
+	_ core.IMultiNodeIndex    = (*Manager)(nil)
+)
+
+// NodeBindPolicy 决定 TryBindNode 遇到 nodeID 已被其他存活连接占用时的处理方式。
+type NodeBindPolicy int
+
+const (
+	// NodeBindTakeover 新连接接管 nodeID，并通过 OnNodeConflict 钩子通知（默认，兼容旧行为）。
+	NodeBindTakeover NodeBindPolicy = iota
+	// NodeBindReject 保留旧绑定，TryBindNode 返回 ErrNodeIDConflict。
+	NodeBindReject
+)
+
+// DuplicatePolicy 决定同一 nodeID/deviceID 出现两条存活直连（如客户端重连时旧连接尚未断开）时的处理方式。
+type DuplicatePolicy int
+
+const (
+	// DuplicateKickOld 关闭并移除旧连接，通过 OnReplaced 钩子通知（默认）。
+	DuplicateKickOld DuplicatePolicy = iota
+	// DuplicateRejectNew 保留旧连接与索引，新连接不入索引。
+	DuplicateRejectNew
+	// DuplicateAllowBoth 两条连接同时保留；nodeID 下并存，deviceID 指向最新连接。
+	DuplicateAllowBoth
 )
 
+// String 返回策略在配置中的名字。
+func (p DuplicatePolicy) String() string {
+	switch p {
+	case DuplicateRejectNew:
+		return "reject_new"
+	case DuplicateAllowBoth:
+		return "allow_both"
+	default:
+		return "kick_old"
+	}
+}
+
+// DuplicatePolicyFromConfig 解析 kick_old/reject_new/allow_both，未知值退回 kick_old。
+func DuplicatePolicyFromConfig(raw string) DuplicatePolicy {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "reject_new":
+		return DuplicateRejectNew
+	case "allow_both":
+		return DuplicateAllowBoth
+	default:
+		return DuplicateKickOld
+	}
+}
+
+// NodeSelectPolicy 决定 nodeID 存在多条可达连接时 GetByNode 返回哪一条。
+type NodeSelectPolicy int
+
+const (
+	// NodeSelectMostRecent 返回最近绑定的连接（默认）。
+	NodeSelectMostRecent NodeSelectPolicy = iota
+	// NodeSelectRoundRobin 在全部可达连接间轮询。
+	NodeSelectRoundRobin
+	// NodeSelectPreferred 优先返回元数据 MetaPreferredKey 为 true 的连接，没有则退回最近绑定。
+	NodeSelectPreferred
+)
+
+// MetaPreferredKey 标记 NodeSelectPreferred 策略下的首选连接。
+const MetaPreferredKey = "preferred"
+
 // Manager is the in-memory connection/link manager implementation.
 //
 // Compatibility notes:
@@ -27,16 +103,26 @@ type Manager struct {
 	conns     map[string]core.IConnection
 	hooks     core.ConnectionHooks
 	linkHooks core.LinkHooks
-	nodeIndex map[uint32]core.IConnection
+	nodeIndex map[uint32][]core.IConnection  // 每个 nodeID 的可达连接，按绑定时间从旧到新
+	connNodes map[string]map[uint32]struct{} // nodeIndex 的反向索引：连接 ID -> 经其可达的 nodeID
 	devIndex  map[string]core.IConnection
+	addedAt   map[string]time.Time // 加入管理器的时间，连接未实现 IActivityTracker 时作为建立时间
+	bindPol   NodeBindPolicy
+	dupPol    DuplicatePolicy
+	selectPol NodeSelectPolicy
+	rr        atomic.Uint32
+
+	closeWorkers int // CloseAll 并发关闭的 worker 数，<=0 按 GOMAXPROCS 推导
 }
 
 // New 初始化内存版连接/链路索引表。
 func New() *Manager {
 	return &Manager{
 		conns:     make(map[string]core.IConnection),
-		nodeIndex: make(map[uint32]core.IConnection),
+		nodeIndex: make(map[uint32][]core.IConnection),
+		connNodes: make(map[string]map[uint32]struct{}),
 		devIndex:  make(map[string]core.IConnection),
+		addedAt:   make(map[string]time.Time),
 	}
 }
 
@@ -54,6 +140,34 @@ func (m *Manager) SetLinkHooks(h core.LinkHooks) {
 	m.mu.Unlock()
 }
 
+// SetNodeBindPolicy 设置 TryBindNode 的冲突处理策略。
+func (m *Manager) SetNodeBindPolicy(p NodeBindPolicy) {
+	m.mu.Lock()
+	m.bindPol = p
+	m.mu.Unlock()
+}
+
+// SetDuplicatePolicy 设置同一 nodeID/deviceID 出现重复直连时的处理策略。
+func (m *Manager) SetDuplicatePolicy(p DuplicatePolicy) {
+	m.mu.Lock()
+	m.dupPol = p
+	m.mu.Unlock()
+}
+
+// SetNodeSelectPolicy 设置 nodeID 有多条可达连接时 GetByNode 的选择策略。
+func (m *Manager) SetNodeSelectPolicy(p NodeSelectPolicy) {
+	m.mu.Lock()
+	m.selectPol = p
+	m.mu.Unlock()
+}
+
+// SetCloseConcurrency 设置 CloseAll 并发关闭连接的 worker 数；n<=0 恢复按 GOMAXPROCS 推导。
+func (m *Manager) SetCloseConcurrency(n int) {
+	m.mu.Lock()
+	m.closeWorkers = n
+	m.mu.Unlock()
+}
+
 // Add 注册一条新连接，并同步更新 node/device 反向索引与生命周期钩子。
 func (m *Manager) Add(conn core.IConnection) error {
 	if conn == nil {
@@ -65,6 +179,7 @@ func (m *Manager) Add(conn core.IConnection) error {
 		return errors.New("conn exists")
 	}
 	m.conns[conn.ID()] = conn
+	m.addedAt[conn.ID()] = time.Now()
 	m.addNodeIndexLocked(conn)
 	m.addDeviceIndexLocked(conn)
 	h := m.hooks
@@ -93,11 +208,34 @@ func (m *Manager) addNodeIndexLocked(conn core.IConnection) {
 	if conn == nil {
 		return
 	}
-	if nodeID, ok := conn.GetMeta("nodeID"); ok {
-		if nid, ok2 := nodeID.(uint32); ok2 && nid != 0 {
-			m.nodeIndex[nid] = conn
+	if nid := core.ConnNodeID(conn); nid != 0 {
+		m.setNodeSetLocked(nid, []core.IConnection{conn})
+	}
+}
+
+// setNodeSetLocked 替换 nodeID 的可达连接集合，并同步维护反向索引；空集合即删除该 nodeID。
+func (m *Manager) setNodeSetLocked(nodeID uint32, set []core.IConnection) {
+	for _, c := range m.nodeIndex[nodeID] {
+		if nodes := m.connNodes[c.ID()]; nodes != nil {
+			delete(nodes, nodeID)
+			if len(nodes) == 0 {
+				delete(m.connNodes, c.ID())
+			}
 		}
 	}
+	if len(set) == 0 {
+		delete(m.nodeIndex, nodeID)
+		return
+	}
+	m.nodeIndex[nodeID] = set
+	for _, c := range set {
+		nodes := m.connNodes[c.ID()]
+		if nodes == nil {
+			nodes = make(map[uint32]struct{})
+			m.connNodes[c.ID()] = nodes
+		}
+		nodes[nodeID] = struct{}{}
+	}
 }
 
 // addDeviceIndexLocked 从连接元数据中提取 deviceID，建立设备级查找索引。
@@ -105,10 +243,8 @@ func (m *Manager) addDeviceIndexLocked(conn core.IConnection) {
 	if conn == nil {
 		return
 	}
-	if devID, ok := conn.GetMeta("deviceID"); ok {
-		if s, ok2 := devID.(string); ok2 && s != "" {
-			m.devIndex[s] = conn
-		}
+	if s := core.ConnDeviceID(conn); s != "" {
+		m.devIndex[s] = conn
 	}
 }
 
@@ -123,6 +259,7 @@ func (m *Manager) Remove(id string) error {
 	m.removeNodeIndexLocked(conn)
 	m.removeDeviceIndexLocked(conn)
 	delete(m.conns, id)
+	delete(m.addedAt, id)
 	h := m.hooks
 	lh := m.linkHooks
 	m.mu.Unlock()
@@ -140,16 +277,34 @@ func (m *Manager) RemoveLink(id string) error {
 	return m.Remove(id)
 }
 
-// removeNodeIndexLocked 从 node 索引中删掉指向当前连接的全部项。
+// removeNodeIndexLocked 从 node 索引中删掉指向当前连接的全部项；其余可达连接保留。
 func (m *Manager) removeNodeIndexLocked(conn core.IConnection) {
 	if conn == nil {
 		return
 	}
-	for nid, c := range m.nodeIndex {
+	for nid := range m.connNodes[conn.ID()] {
+		set := m.nodeIndex[nid]
+		if rest := withoutConn(set, conn); len(rest) != len(set) {
+			m.setNodeSetLocked(nid, rest)
+		}
+	}
+}
+
+// withoutConn 返回去掉 conn 后的新切片（不修改入参，避免影响已交出的快照）。
+func withoutConn(set []core.IConnection, conn core.IConnection) []core.IConnection {
+	idx := -1
+	for i, c := range set {
 		if c == conn {
-			delete(m.nodeIndex, nid)
+			idx = i
+			break
 		}
 	}
+	if idx < 0 {
+		return set
+	}
+	out := make([]core.IConnection, 0, len(set)-1)
+	out = append(out, set[:idx]...)
+	return append(out, set[idx+1:]...)
 }
 
 // removeDeviceIndexLocked 从 device 索引中删掉指向当前连接的全部项。
@@ -180,11 +335,111 @@ func (m *Manager) GetLink(id string) (core.ILink, bool) {
 	return conn, true
 }
 
+// GetByNode 按 NodeSelectPolicy 从 nodeID 的可达连接中选出一条。
 func (m *Manager) GetByNode(id uint32) (core.IConnection, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	c, ok := m.nodeIndex[id]
-	return c, ok
+	set := m.nodeIndex[id]
+	switch len(set) {
+	case 0:
+		return nil, false
+	case 1:
+		return set[0], true
+	}
+	switch m.selectPol {
+	case NodeSelectRoundRobin:
+		return set[int(m.rr.Add(1)-1)%len(set)], true
+	case NodeSelectPreferred:
+		for i := len(set) - 1; i >= 0; i-- {
+			if v, ok := set[i].GetMeta(MetaPreferredKey); ok {
+				if b, ok2 := v.(bool); ok2 && b {
+					return set[i], true
+				}
+			}
+		}
+	}
+	return set[len(set)-1], true
+}
+
+// GetAllByNode 返回 nodeID 的全部可达连接，按绑定时间从新到旧。
+func (m *Manager) GetAllByNode(id uint32) []core.IConnection {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	set := m.nodeIndex[id]
+	out := make([]core.IConnection, 0, len(set))
+	for i := len(set) - 1; i >= 0; i-- {
+		out = append(out, set[i])
+	}
+	return out
+}
+
+// AppendNodeIndex 为 nodeID 追加一条可达连接，不触发冲突策略也不踢除旧连接；
+// 已存在的连接会被移到末尾，成为最近绑定。
+func (m *Manager) AppendNodeIndex(nodeID uint32, conn core.IConnection) {
+	if nodeID == 0 || conn == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set := withoutConn(m.nodeIndex[nodeID], conn)
+	out := make([]core.IConnection, 0, len(set)+1)
+	out = append(out, set...)
+	m.setNodeSetLocked(nodeID, append(out, conn))
+}
+
+// NodesOfConn 经反向索引返回可经 connID 到达的全部 nodeID（升序）。
+func (m *Manager) NodesOfConn(connID string) []uint32 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	nodes := m.connNodes[connID]
+	if len(nodes) == 0 {
+		return nil
+	}
+	out := make([]uint32, 0, len(nodes))
+	for nid := range nodes {
+		out = append(out, nid)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+// UnbindNode 仅从 nodeID 的可达集合中摘除 conn，其余连接（多会话并存时）保持可达。
+func (m *Manager) UnbindNode(nodeID uint32, conn core.IConnection) {
+	if nodeID == 0 || conn == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	set := m.nodeIndex[nodeID]
+	if rest := withoutConn(set, conn); len(rest) != len(set) {
+		m.setNodeSetLocked(nodeID, rest)
+	}
+}
+
+// UnbindDevice 在 deviceID 指向 conn 时摘除映射；若仍有其他存活连接登记了同一 deviceID，
+// 改指向其中最近加入的一条。
+func (m *Manager) UnbindDevice(devID string, conn core.IConnection) {
+	if devID == "" || conn == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.devIndex[devID] != conn {
+		return
+	}
+	delete(m.devIndex, devID)
+	var next core.IConnection
+	for id, c := range m.conns {
+		if c == conn || core.ConnDeviceID(c) != devID {
+			continue
+		}
+		if next == nil || m.addedAt[id].After(m.addedAt[next.ID()]) {
+			next = c
+		}
+	}
+	if next != nil {
+		m.devIndex[devID] = next
+	}
 }
 
 // GetLinkByNode returns the link view for a node mapping.
@@ -196,39 +451,106 @@ func (m *Manager) GetLinkByNode(id uint32) (core.ILink, bool) {
 	return conn, true
 }
 
-// UpdateNodeIndex 更新 nodeID 到连接的映射；直连冲突时会主动关闭旧连接。
+// UpdateNodeIndex 以“覆盖”语义更新 nodeID 的映射：之前的全部可达连接都被替换为 conn；
+// 与另一条存活直连重复时按 DuplicatePolicy 处理（默认关闭旧连接）。
 func (m *Manager) UpdateNodeIndex(nodeID uint32, conn core.IConnection) {
+	_ = m.bindNode(nodeID, conn, false)
+}
+
+// TryBindNode 将 nodeID 绑定到 conn，供登录流程识别冒用：
+// 若该 nodeID 已绑定到另一条仍在管理器中的连接，按 NodeBindPolicy 拒绝（返回 ErrNodeIDConflict）
+// 或接管并触发 OnNodeConflict 钩子；接管时旧连接若为同 nodeID 的直连，再按 DuplicatePolicy 处理
+// （RejectNew 返回 ErrDuplicateConn）。
+func (m *Manager) TryBindNode(nodeID uint32, conn core.IConnection) error {
+	if conn == nil {
+		return errors.New("conn nil")
+	}
+	return m.bindNode(nodeID, conn, true)
+}
+
+// bindNode 是 UpdateNodeIndex/TryBindNode 的共同实现；checkConflict 为 true 时执行冲突策略。
+func (m *Manager) bindNode(nodeID uint32, conn core.IConnection, checkConflict bool) error {
 	if nodeID == 0 {
-		return
+		return nil
 	}
 	isDirectBind := func(c core.IConnection) bool {
-		if c == nil {
-			return false
-		}
-		if v, ok := c.GetMeta("nodeID"); ok {
-			if nid, ok2 := asUint32(v); ok2 && nid != 0 && nid == nodeID {
-				return true
-			}
-		}
-		return false
+		return c != nil && core.ConnNodeID(c) == nodeID
 	}
 
-	var oldDirectConnID string
+	var (
+		oldDirect []core.IConnection
+		conflict  core.IConnection
+	)
 	m.mu.Lock()
 	if conn == nil {
-		delete(m.nodeIndex, nodeID)
+		m.setNodeSetLocked(nodeID, nil)
 		m.mu.Unlock()
-		return
+		return nil
 	}
 	existing := m.nodeIndex[nodeID]
-	m.nodeIndex[nodeID] = conn
-	if existing != nil && existing != conn && isDirectBind(conn) && isDirectBind(existing) {
-		oldDirectConnID = existing.ID()
+	if checkConflict {
+		// 从最近绑定往前找第一条仍存活的其他连接作为冲突对象。
+		for i := len(existing) - 1; i >= 0; i-- {
+			old := existing[i]
+			if old == conn {
+				continue
+			}
+			if m.isLiveLocked(old) {
+				if m.bindPol == NodeBindReject {
+					m.mu.Unlock()
+					return ErrNodeIDConflict
+				}
+				conflict = old
+				break
+			}
+		}
+	}
+	if isDirectBind(conn) {
+		for _, old := range existing {
+			if old != conn && isDirectBind(old) && m.isLiveLocked(old) {
+				oldDirect = append(oldDirect, old)
+			}
+		}
+	}
+	set := []core.IConnection{conn}
+	if len(oldDirect) > 0 {
+		switch m.dupPol {
+		case DuplicateRejectNew:
+			m.mu.Unlock()
+			return ErrDuplicateConn
+		case DuplicateAllowBoth:
+			set = append(oldDirect, conn)
+			oldDirect = nil
+		}
 	}
+	m.setNodeSetLocked(nodeID, set)
+	h := m.hooks
 	m.mu.Unlock()
 
-	if oldDirectConnID != "" {
-		_ = m.Remove(oldDirectConnID)
+	if conflict != nil && h.OnNodeConflict != nil {
+		h.OnNodeConflict(nodeID, conflict, conn)
+	}
+	m.replace(oldDirect, conn, h)
+	if h.OnNodeBound != nil && isDirectBind(conn) {
+		h.OnNodeBound(nodeID, conn)
+	}
+	return nil
+}
+
+// isLiveLocked 判断连接是否仍登记在管理器中（索引项可能残留已移除的连接）。
+func (m *Manager) isLiveLocked(c core.IConnection) bool {
+	live, ok := m.conns[c.ID()]
+	return ok && live == c
+}
+
+// replace 按 DuplicateKickOld 关闭并移除被新连接顶替的旧直连，并触发 OnReplaced 钩子。
+func (m *Manager) replace(olds []core.IConnection, conn core.IConnection, h core.ConnectionHooks) {
+	for _, old := range olds {
+		core.MarkCloseReason(old, core.CloseReasonKicked)
+		_ = m.Remove(old.ID())
+		if h.OnReplaced != nil {
+			h.OnReplaced(old, conn)
+		}
 	}
 }
 
@@ -280,22 +602,39 @@ func (m *Manager) GetLinkByDevice(devID string) (core.ILink, bool) {
 	return conn, true
 }
 
-// UpdateDeviceIndex 更新 deviceID 到连接的映射，供登录后快速反查。
+// UpdateDeviceIndex 更新 deviceID 到连接的映射，供登录后快速反查；重复直连按 DuplicatePolicy 处理。
 func (m *Manager) UpdateDeviceIndex(devID string, conn core.IConnection) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+	_ = m.TryBindDevice(devID, conn)
+}
+
+// TryBindDevice 将 deviceID 绑定到 conn；若该 deviceID 仍有另一条存活直连，
+// 按 DuplicatePolicy 拒绝（返回 ErrDuplicateConn）、踢除旧连接或两者并存。
+func (m *Manager) TryBindDevice(devID string, conn core.IConnection) error {
 	if devID == "" {
-		return
+		return nil
 	}
+	m.mu.Lock()
 	if conn == nil {
-		if existing, ok := m.devIndex[devID]; ok {
-			if existing != nil {
-				delete(m.devIndex, devID)
-			}
+		delete(m.devIndex, devID)
+		m.mu.Unlock()
+		return nil
+	}
+	var olds []core.IConnection
+	if old, ok := m.devIndex[devID]; ok && old != conn && core.ConnDeviceID(old) == devID && m.isLiveLocked(old) {
+		switch m.dupPol {
+		case DuplicateRejectNew:
+			m.mu.Unlock()
+			return ErrDuplicateConn
+		case DuplicateKickOld:
+			olds = []core.IConnection{old}
 		}
-		return
 	}
 	m.devIndex[devID] = conn
+	h := m.hooks
+	m.mu.Unlock()
+
+	m.replace(olds, conn, h)
+	return nil
 }
 
 // UpdateDeviceLink updates device->link mapping through the compatibility manager.
@@ -312,6 +651,12 @@ func (m *Manager) UpdateDeviceLink(devID string, link core.ILink) error {
 	return nil
 }
 
+var (
+	_ core.IConnSnapshotter = (*Manager)(nil)
+	_ core.IConnNodeIndex   = (*Manager)(nil)
+	_ core.IContextCloser   = (*Manager)(nil)
+)
+
 // Range 在释放主锁后遍历连接快照，避免回调期间长时间持锁。
 func (m *Manager) Range(fn func(core.IConnection) bool) {
 	m.mu.RLock()
@@ -334,6 +679,52 @@ func (m *Manager) RangeLinks(fn func(core.ILink) bool) {
 	})
 }
 
+// SnapshotConnections 返回全部连接的只读快照。主锁内只复制连接列表，
+// 元数据在释放主锁后读取，因此快照期间被移除的连接仍会以移除前的状态出现。
+func (m *Manager) SnapshotConnections() []core.ConnInfo {
+	m.mu.RLock()
+	conns := make([]core.IConnection, 0, len(m.conns))
+	added := make([]time.Time, 0, len(m.conns))
+	for id, c := range m.conns {
+		conns = append(conns, c)
+		added = append(added, m.addedAt[id])
+	}
+	m.mu.RUnlock()
+	out := make([]core.ConnInfo, 0, len(conns))
+	for i, c := range conns {
+		info := core.ConnInfoOf(c)
+		if info.ConnectedAt.IsZero() {
+			info.ConnectedAt = added[i]
+		}
+		out = append(out, info)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// SnapshotIndexes 返回 node/device 索引的纯数据拷贝；node 的连接 ID 按绑定时间从旧到新。
+func (m *Manager) SnapshotIndexes() core.ConnIndexSnapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	snap := core.ConnIndexSnapshot{
+		Nodes:   make(map[uint32][]string, len(m.nodeIndex)),
+		Devices: make(map[string]string, len(m.devIndex)),
+	}
+	for nid, set := range m.nodeIndex {
+		ids := make([]string, 0, len(set))
+		for _, c := range set {
+			ids = append(ids, c.ID())
+		}
+		snap.Nodes[nid] = ids
+	}
+	for dev, c := range m.devIndex {
+		if c != nil {
+			snap.Devices[dev] = c.ID()
+		}
+	}
+	return snap
+}
+
 func (m *Manager) Count() int {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -351,47 +742,76 @@ func (m *Manager) Broadcast(data []byte) error {
 
 // CloseAll 关闭并清空全部连接与索引，通常用于 server 停止阶段。
 func (m *Manager) CloseAll() error {
+	return m.CloseAllContext(context.Background())
+}
+
+// CloseAllContext 摘除全部连接后用有界 worker 池并发关闭（TLS 等 Close 可能阻塞在写 close_notify），
+// 每条连接的 OnRemove 钩子恰好触发一次。ctx 结束时立即返回 ctx.Err()，剩余连接在后台继续关闭；
+// 否则返回各连接 Close 错误的合并结果（忽略已关闭的连接）。
+func (m *Manager) CloseAllContext(ctx context.Context) error {
 	m.mu.Lock()
 	conns := make([]core.IConnection, 0, len(m.conns))
 	for _, c := range m.conns {
 		conns = append(conns, c)
 	}
 	m.conns = make(map[string]core.IConnection)
-	m.nodeIndex = make(map[uint32]core.IConnection)
+	m.nodeIndex = make(map[uint32][]core.IConnection)
+	m.connNodes = make(map[string]map[uint32]struct{})
 	m.devIndex = make(map[string]core.IConnection)
+	m.addedAt = make(map[string]time.Time)
 	h := m.hooks
 	lh := m.linkHooks
+	workers := m.closeWorkers
 	m.mu.Unlock()
-	for _, c := range conns {
-		if h.OnRemove != nil {
-			h.OnRemove(c)
-		}
-		if lh.OnRemove != nil {
-			lh.OnRemove(c)
-		}
-		_ = c.Close()
+	if len(conns) == 0 {
+		return nil
 	}
-	return nil
-}
-
-// asUint32 兼容常见整数元数据类型，便于从动态 meta 中取 nodeID。
-func asUint32(v any) (uint32, bool) {
-	switch vv := v.(type) {
-	case uint32:
-		return vv, true
-	case uint64:
-		return uint32(vv), true
-	case int:
-		if vv < 0 {
-			return 0, false
-		}
-		return uint32(vv), true
-	case int64:
-		if vv < 0 {
-			return 0, false
-		}
-		return uint32(vv), true
-	default:
-		return 0, false
+	if workers <= 0 {
+		workers = max(8, 4*runtime.GOMAXPROCS(0))
+	}
+	workers = min(workers, len(conns))
+
+	var (
+		errMu sync.Mutex
+		errs  []error
+		wg    sync.WaitGroup
+	)
+	jobs := make(chan core.IConnection)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range jobs {
+				if h.OnRemove != nil {
+					h.OnRemove(c)
+				}
+				if lh.OnRemove != nil {
+					lh.OnRemove(c)
+				}
+				if err := c.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+					errMu.Lock()
+					errs = append(errs, fmt.Errorf("close %s: %w", c.ID(), err))
+					errMu.Unlock()
+				}
+			}
+		}()
 	}
+	// 投递不受 ctx 约束：连接已从管理器摘除，必须全部关闭，ctx 只决定调用方等多久。
+	go func() {
+		for _, c := range conns {
+			jobs <- c
+		}
+		close(jobs)
+	}()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return errors.Join(errs...)
 }
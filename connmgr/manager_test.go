@@ -4,11 +4,17 @@ package connmgr
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"maps"
 	"net"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 )
@@ -202,6 +208,9 @@ func TestManager_UpdateNodeIndex_DirectConflictClosesOld(t *testing.T) {
 	if !c1.closed.Load() {
 		t.Fatalf("expected c1 to be closed")
 	}
+	if got := core.CloseReasonOf(c1); got != core.CloseReasonKicked {
+		t.Fatalf("c1 close reason=%q, want %q", got, core.CloseReasonKicked)
+	}
 	if _, ok := m.Get("c1"); ok {
 		t.Fatalf("expected c1 removed from manager")
 	}
@@ -242,6 +251,105 @@ func TestManager_UpdateNodeIndex_DescendantOverwriteDoesNotCloseOld(t *testing.T
 	}
 }
 
+func TestManager_TryBindNode_RejectPolicyKeepsExisting(t *testing.T) {
+	m := New()
+	m.SetNodeBindPolicy(NodeBindReject)
+
+	a := newStubConn("a")
+	b := newStubConn("b")
+	if err := m.Add(a); err != nil {
+		t.Fatalf("Add a: %v", err)
+	}
+	if err := m.Add(b); err != nil {
+		t.Fatalf("Add b: %v", err)
+	}
+	if err := m.TryBindNode(10, a); err != nil {
+		t.Fatalf("TryBindNode(10, a): %v", err)
+	}
+	if err := m.TryBindNode(10, b); err != ErrNodeIDConflict {
+		t.Fatalf("TryBindNode(10, b) err=%v, want ErrNodeIDConflict", err)
+	}
+	if got, ok := m.GetByNode(10); !ok || got.ID() != "a" {
+		t.Fatalf("expected node 10 still maps to a, got ok=%v conn=%v", ok, got)
+	}
+	if a.closed.Load() {
+		t.Fatalf("expected a not to be closed")
+	}
+	// 重复绑定到同一连接不算冲突。
+	if err := m.TryBindNode(10, a); err != nil {
+		t.Fatalf("rebind same conn: %v", err)
+	}
+}
+
+func TestManager_TryBindNode_TakeoverEmitsConflict(t *testing.T) {
+	m := New()
+
+	a := newStubConn("a")
+	b := newStubConn("b")
+	var gotNode uint32
+	var gotOld, gotNew string
+	m.SetHooks(core.ConnectionHooks{OnNodeConflict: func(nodeID uint32, old, new core.IConnection) {
+		gotNode, gotOld, gotNew = nodeID, old.ID(), new.ID()
+	}})
+	if err := m.Add(a); err != nil {
+		t.Fatalf("Add a: %v", err)
+	}
+	if err := m.Add(b); err != nil {
+		t.Fatalf("Add b: %v", err)
+	}
+	if err := m.TryBindNode(10, a); err != nil {
+		t.Fatalf("TryBindNode(10, a): %v", err)
+	}
+	if err := m.TryBindNode(10, b); err != nil {
+		t.Fatalf("TryBindNode(10, b): %v", err)
+	}
+	if gotNode != 10 || gotOld != "a" || gotNew != "b" {
+		t.Fatalf("conflict hook got node=%d old=%q new=%q", gotNode, gotOld, gotNew)
+	}
+	if got, ok := m.GetByNode(10); !ok || got.ID() != "b" {
+		t.Fatalf("expected node 10 maps to b, got ok=%v conn=%v", ok, got)
+	}
+}
+
+func TestManager_NodeBoundHookOnlyForDirectBind(t *testing.T) {
+	m := New()
+
+	a := newStubConn("a")
+	core.SetConnNodeID(a, 10)
+	var bound []string
+	m.SetHooks(core.ConnectionHooks{OnNodeBound: func(nodeID uint32, conn core.IConnection) {
+		bound = append(bound, fmt.Sprintf("%d@%s", nodeID, conn.ID()))
+	}})
+	if err := m.Add(a); err != nil {
+		t.Fatalf("Add a: %v", err)
+	}
+	m.UpdateNodeIndex(10, a)
+	// 后代节点经 a 路由，不是 a 自身的登录。
+	m.AddNodeIndex(11, a)
+	if err := m.TryBindNode(10, a); err != nil {
+		t.Fatalf("TryBindNode(10, a): %v", err)
+	}
+	if want := []string{"10@a", "10@a"}; !slices.Equal(bound, want) {
+		t.Fatalf("bound=%v, want %v", bound, want)
+	}
+}
+
+func TestManager_TryBindNode_StaleEntryIsNotConflict(t *testing.T) {
+	m := New()
+	m.SetNodeBindPolicy(NodeBindReject)
+
+	a := newStubConn("a")
+	b := newStubConn("b")
+	if err := m.Add(b); err != nil {
+		t.Fatalf("Add b: %v", err)
+	}
+	// a 不在管理器中，视为已失效的索引项。
+	m.UpdateNodeIndex(10, a)
+	if err := m.TryBindNode(10, b); err != nil {
+		t.Fatalf("TryBindNode over stale entry: %v", err)
+	}
+}
+
 func TestStubTypes_Compile(t *testing.T) {
 	var _ core.ILink = (*stubConn)(nil)
 	var _ core.IConnection = (*stubConn)(nil)
@@ -249,3 +357,506 @@ func TestStubTypes_Compile(t *testing.T) {
 	var _ core.ILinkManager = (*Manager)(nil)
 	_ = context.Background()
 }
+
+func TestManager_NodeIndex_OverwriteVersusAppend(t *testing.T) {
+	m := New()
+	a, b, c := newStubConn("a"), newStubConn("b"), newStubConn("c")
+	for _, conn := range []*stubConn{a, b, c} {
+		if err := m.Add(conn); err != nil {
+			t.Fatalf("Add(%s): %v", conn.ID(), err)
+		}
+	}
+
+	m.AppendNodeIndex(9, a)
+	m.AppendNodeIndex(9, b)
+	if got := connIDs(m.GetAllByNode(9)); got != "b,a" {
+		t.Fatalf("after append GetAllByNode=%s, want b,a", got)
+	}
+	if got, _ := m.GetByNode(9); got != b {
+		t.Fatalf("GetByNode should return most recent append, got %v", got.ID())
+	}
+	// 重复追加视为重新绑定，移到最新位置而不是产生重复项。
+	m.AppendNodeIndex(9, a)
+	if got := connIDs(m.GetAllByNode(9)); got != "a,b" {
+		t.Fatalf("after re-append GetAllByNode=%s, want a,b", got)
+	}
+
+	// UpdateNodeIndex 是覆盖语义：所有旧的可达连接都被替换。
+	m.UpdateNodeIndex(9, c)
+	if got := connIDs(m.GetAllByNode(9)); got != "c" {
+		t.Fatalf("after overwrite GetAllByNode=%s, want c", got)
+	}
+	if a.closed.Load() || b.closed.Load() {
+		t.Fatalf("overwrite of non-direct bindings must not close old connections")
+	}
+}
+
+func TestManager_NodeIndex_RemoveKeepsRemainingConns(t *testing.T) {
+	m := New()
+	a, b := newStubConn("a"), newStubConn("b")
+	_ = m.Add(a)
+	_ = m.Add(b)
+	m.AppendNodeIndex(9, a)
+	m.AppendNodeIndex(9, b)
+
+	if err := m.Remove(b.ID()); err != nil {
+		t.Fatalf("Remove(b): %v", err)
+	}
+	if got := connIDs(m.GetAllByNode(9)); got != "a" {
+		t.Fatalf("after removing b GetAllByNode=%s, want a", got)
+	}
+	if got, ok := m.GetByNode(9); !ok || got != a {
+		t.Fatalf("GetByNode should fall back to remaining conn a")
+	}
+	if err := m.Remove(a.ID()); err != nil {
+		t.Fatalf("Remove(a): %v", err)
+	}
+	if _, ok := m.GetByNode(9); ok {
+		t.Fatalf("nodeID should be unreachable after all conns removed")
+	}
+	if got := m.GetAllByNode(9); len(got) != 0 {
+		t.Fatalf("GetAllByNode after cleanup=%v, want empty", got)
+	}
+}
+
+func TestManager_NodeSelectPolicies(t *testing.T) {
+	m := New()
+	a, b, c := newStubConn("a"), newStubConn("b"), newStubConn("c")
+	for _, conn := range []*stubConn{a, b, c} {
+		_ = m.Add(conn)
+		m.AppendNodeIndex(9, conn)
+	}
+
+	m.SetNodeSelectPolicy(NodeSelectRoundRobin)
+	seen := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		got, _ := m.GetByNode(9)
+		seen[got.ID()]++
+	}
+	if seen["a"] != 2 || seen["b"] != 2 || seen["c"] != 2 {
+		t.Fatalf("round robin distribution=%v, want 2 each", seen)
+	}
+
+	m.SetNodeSelectPolicy(NodeSelectPreferred)
+	if got, _ := m.GetByNode(9); got != c {
+		t.Fatalf("preferred without marker should fall back to most recent, got %s", got.ID())
+	}
+	a.SetMeta(MetaPreferredKey, true)
+	if got, _ := m.GetByNode(9); got != a {
+		t.Fatalf("preferred policy should return marked conn a, got %s", got.ID())
+	}
+}
+
+func connIDs(conns []core.IConnection) string {
+	ids := make([]string, 0, len(conns))
+	for _, c := range conns {
+		ids = append(ids, c.ID())
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestManager_NodeIndex_AcceptsLegacyIntNodeID(t *testing.T) {
+	m := New()
+	c := newStubConn("legacy")
+	c.SetMeta(core.MetaNodeIDKey, 12) // 旧 handler 以 int 写入
+	if err := m.Add(c); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if got, ok := m.GetByNode(12); !ok || got.ID() != "legacy" {
+		t.Fatalf("GetByNode(12)=%v,%v, want legacy", got, ok)
+	}
+
+	other := newStubConn("other")
+	if err := m.Add(other); err != nil {
+		t.Fatalf("Add other: %v", err)
+	}
+	other.SetMeta(core.MetaNodeIDKey, int64(12))
+	m.UpdateNodeIndex(12, other)
+	if !c.closed.Load() {
+		t.Fatalf("int-typed direct bind should be treated as conflicting owner and closed")
+	}
+}
+
+func TestManager_SnapshotConnectionsAndIndexes(t *testing.T) {
+	m := New()
+	child := newStubConn("child")
+	core.SetConnNodeID(child, 21)
+	core.SetConnDeviceID(child, "dev-21")
+	core.SetConnRole(child, core.RoleChild)
+	parent := newStubConn("parent")
+	core.SetConnRole(parent, core.RoleParent)
+	before := time.Now()
+	for _, c := range []*stubConn{child, parent} {
+		if err := m.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	m.AppendNodeIndex(30, child) // 经 child 可达的下游节点
+
+	infos := m.SnapshotConnections()
+	if len(infos) != 2 || infos[0].ID != "child" || infos[1].ID != "parent" {
+		t.Fatalf("snapshot=%+v, want child and parent sorted by id", infos)
+	}
+	got := infos[0]
+	if got.NodeID != 21 || got.DeviceID != "dev-21" || got.Role != core.RoleChild {
+		t.Fatalf("child info=%+v", got)
+	}
+	if got.ConnectedAt.Before(before) {
+		t.Fatalf("ConnectedAt=%v, want manager add time (>= %v)", got.ConnectedAt, before)
+	}
+
+	idx := m.SnapshotIndexes()
+	if ids := idx.Nodes[21]; len(ids) != 1 || ids[0] != "child" {
+		t.Fatalf("node 21 index=%v, want [child]", ids)
+	}
+	if ids := idx.Nodes[30]; len(ids) != 1 || ids[0] != "child" {
+		t.Fatalf("node 30 index=%v, want [child]", ids)
+	}
+	if idx.Devices["dev-21"] != "child" {
+		t.Fatalf("device index=%v", idx.Devices)
+	}
+	idx.Nodes[21][0] = "mutated"
+	if again := m.SnapshotIndexes(); again.Nodes[21][0] != "child" {
+		t.Fatalf("snapshot shares storage with manager")
+	}
+}
+
+func TestManager_SnapshotToleratesConcurrentRemoval(t *testing.T) {
+	m := New()
+	for i := 0; i < 50; i++ {
+		c := newStubConn(fmt.Sprintf("c%d", i))
+		core.SetConnNodeID(c, uint32(i+1))
+		_ = m.Add(c)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			_ = m.Remove(fmt.Sprintf("c%d", i))
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if n := len(m.SnapshotConnections()); n != 0 {
+				t.Fatalf("snapshot after removal has %d conns, want 0", n)
+			}
+			return
+		default:
+			_ = m.SnapshotConnections()
+			_ = m.SnapshotIndexes()
+		}
+	}
+}
+
+func TestManager_NodesOfConnTracksBindAndRemove(t *testing.T) {
+	m := New()
+	a, b := newStubConn("a"), newStubConn("b")
+	_ = m.Add(a)
+	_ = m.Add(b)
+	m.AppendNodeIndex(4, a)
+	m.AppendNodeIndex(4, b)
+	m.AppendNodeIndex(5, a)
+	if got := m.NodesOfConn("a"); len(got) != 2 || got[0] != 4 || got[1] != 5 {
+		t.Fatalf("NodesOfConn(a)=%v, want [4 5]", got)
+	}
+	m.UpdateNodeIndex(4, b) // 覆盖后 a 不再可达 4
+	if got := m.NodesOfConn("a"); len(got) != 1 || got[0] != 5 {
+		t.Fatalf("NodesOfConn(a) after overwrite=%v, want [5]", got)
+	}
+	_ = m.Remove("b")
+	if got := m.NodesOfConn("b"); got != nil {
+		t.Fatalf("NodesOfConn(b) after remove=%v, want nil", got)
+	}
+	if _, ok := m.GetByNode(4); ok {
+		t.Fatalf("node 4 should be unreachable after its only conn is removed")
+	}
+}
+
+// slowCloseConn 模拟 Close 阻塞（如 TLS 写 close_notify）的连接。
+type slowCloseConn struct {
+	*stubConn
+	delay time.Duration
+}
+
+func (c *slowCloseConn) Close() error {
+	time.Sleep(c.delay)
+	return c.stubConn.Close()
+}
+
+func addSlowConns(t *testing.T, m *Manager, n int, delay time.Duration) []*slowCloseConn {
+	t.Helper()
+	conns := make([]*slowCloseConn, n)
+	for i := range conns {
+		conns[i] = &slowCloseConn{stubConn: newStubConn(fmt.Sprintf("slow-%d", i)), delay: delay}
+		if err := m.Add(conns[i]); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	return conns
+}
+
+// countRemoves 统计每条连接 OnRemove 的触发次数。
+func countRemoves(m *Manager) func() map[string]int {
+	var mu sync.Mutex
+	counts := make(map[string]int)
+	m.SetHooks(core.ConnectionHooks{OnRemove: func(c core.IConnection) {
+		mu.Lock()
+		counts[c.ID()]++
+		mu.Unlock()
+	}})
+	return func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(counts)
+	}
+}
+
+func TestManager_CloseAllClosesSlowConnsConcurrently(t *testing.T) {
+	m := New()
+	m.SetCloseConcurrency(100)
+	conns := addSlowConns(t, m, 1000, 20*time.Millisecond)
+	removes := countRemoves(m)
+
+	start := time.Now()
+	if err := m.CloseAll(); err != nil {
+		t.Fatalf("CloseAll: %v", err)
+	}
+	// 串行需要约 20s；100 个 worker 约 200ms。
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("CloseAll took %s, want bounded by worker pool", elapsed)
+	}
+	for _, c := range conns {
+		if !c.closed.Load() {
+			t.Fatalf("%s not closed", c.ID())
+		}
+	}
+	counts := removes()
+	if len(counts) != len(conns) {
+		t.Fatalf("OnRemove fired for %d conns, want %d", len(counts), len(conns))
+	}
+	for id, n := range counts {
+		if n != 1 {
+			t.Fatalf("OnRemove for %s fired %d times, want 1", id, n)
+		}
+	}
+	if m.Count() != 0 {
+		t.Fatalf("Count=%d after CloseAll, want 0", m.Count())
+	}
+}
+
+func TestManager_CloseAllContextReturnsAtDeadline(t *testing.T) {
+	m := New()
+	m.SetCloseConcurrency(2)
+	conns := addSlowConns(t, m, 20, 20*time.Millisecond)
+	removes := countRemoves(m)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := m.CloseAllContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("CloseAllContext err=%v, want DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 150*time.Millisecond {
+		t.Fatalf("CloseAllContext returned after %s, want near the 30ms deadline", elapsed)
+	}
+	// 截止后剩余连接仍在后台关闭完毕，且钩子不重复。
+	deadline := time.Now().Add(2 * time.Second)
+	for len(removes()) < len(conns) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, c := range conns {
+		if removes()[c.ID()] != 1 {
+			t.Fatalf("OnRemove for %s fired %d times, want 1", c.ID(), removes()[c.ID()])
+		}
+	}
+}
+
+func TestManager_CloseAllJoinsCloseErrors(t *testing.T) {
+	m := New()
+	bad := &failCloseConn{stubConn: newStubConn("bad")}
+	_ = m.Add(bad)
+	_ = m.Add(newStubConn("good"))
+	err := m.CloseAll()
+	if !errors.Is(err, errCloseFailed) || !strings.Contains(err.Error(), "bad") {
+		t.Fatalf("CloseAll err=%v, want joined close error for bad", err)
+	}
+}
+
+var errCloseFailed = errors.New("close failed")
+
+type failCloseConn struct{ *stubConn }
+
+func (c *failCloseConn) Close() error { return errCloseFailed }
+
+// loginTwice 模拟同一设备先后从两条 socket 登录：连接加入后写入元数据，再更新 node/device 索引。
+func loginTwice(t *testing.T, m *Manager) (first, second *stubConn, errs [2]error) {
+	t.Helper()
+	first, second = newStubConn("sock-1"), newStubConn("sock-2")
+	for i, c := range []*stubConn{first, second} {
+		if err := m.Add(c); err != nil {
+			t.Fatalf("Add %s: %v", c.ID(), err)
+		}
+		core.SetConnNodeID(c, 42)
+		core.SetConnDeviceID(c, "dev-42")
+		if err := m.TryBindNode(42, c); err != nil {
+			errs[i] = err
+			continue
+		}
+		errs[i] = m.TryBindDevice("dev-42", c)
+	}
+	return first, second, errs
+}
+
+func TestManager_DuplicateLoginKickOld(t *testing.T) {
+	m := New()
+	var replaced []string
+	m.SetHooks(core.ConnectionHooks{OnReplaced: func(old, new core.IConnection) {
+		replaced = append(replaced, old.ID()+"->"+new.ID())
+	}})
+	first, _, errs := loginTwice(t, m)
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("bind errs=%v", errs)
+	}
+	if !first.closed.Load() {
+		t.Fatalf("expected first socket closed")
+	}
+	if _, ok := m.Get("sock-1"); ok {
+		t.Fatalf("expected first socket removed")
+	}
+	if c, ok := m.GetByDevice("dev-42"); !ok || c.ID() != "sock-2" {
+		t.Fatalf("device maps to %v,%v, want sock-2", c, ok)
+	}
+	if c, ok := m.GetByNode(42); !ok || c.ID() != "sock-2" {
+		t.Fatalf("node maps to %v,%v, want sock-2", c, ok)
+	}
+	if len(replaced) != 1 || replaced[0] != "sock-1->sock-2" {
+		t.Fatalf("replaced=%v, want exactly [sock-1->sock-2]", replaced)
+	}
+}
+
+func TestManager_ClearConnIdentityUnroutesNode(t *testing.T) {
+	m := New()
+	m.SetDuplicatePolicy(DuplicateRejectNew)
+	c := newStubConn("sock-1")
+	other := newStubConn("sock-2")
+	for _, conn := range []*stubConn{c, other} {
+		if err := m.Add(conn); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	core.SetConnNodeID(c, 42)
+	core.SetConnDeviceID(c, "dev-42")
+	m.UpdateNodeIndex(42, c)
+	m.UpdateDeviceIndex("dev-42", c)
+	core.SetConnNodeID(other, 7)
+	m.UpdateNodeIndex(7, other)
+
+	nodeID, devID := core.ClearConnIdentity(m, c)
+	if nodeID != 42 || devID != "dev-42" {
+		t.Fatalf("cleared identity=%d/%q, want 42/dev-42", nodeID, devID)
+	}
+	if _, ok := m.GetByNode(42); ok {
+		t.Fatal("node 42 still routable after logout")
+	}
+	if _, ok := m.GetByDevice("dev-42"); ok {
+		t.Fatal("dev-42 still routable after logout")
+	}
+	if core.ConnNodeID(c) != 0 || core.ConnDeviceID(c) != "" {
+		t.Fatalf("meta not cleared: node=%d dev=%q", core.ConnNodeID(c), core.ConnDeviceID(c))
+	}
+	if _, ok := m.Get("sock-1"); !ok {
+		t.Fatal("logout must keep the connection itself")
+	}
+	if got, ok := m.GetByNode(7); !ok || got != other {
+		t.Fatal("unrelated node index affected")
+	}
+
+	// 同一 ID 随后可在另一条连接上重新登录而不被视为重复。
+	core.SetConnNodeID(other, 42)
+	if err := m.TryBindNode(42, other); err != nil {
+		t.Fatalf("rebind after logout: %v", err)
+	}
+
+	// 多会话并存（allow_both）时只摘除登出的那条连接。
+	m = New()
+	m.SetDuplicatePolicy(DuplicateAllowBoth)
+	first, second, errs := loginTwice(t, m)
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("bind errs=%v", errs)
+	}
+
+	// 登出较新的会话：节点与设备都应回落到仍在线的 sock-1。
+	if nodeID, devID := core.ClearConnIdentity(m, second); nodeID != 42 || devID != "dev-42" {
+		t.Fatalf("cleared identity=%d/%q, want 42/dev-42", nodeID, devID)
+	}
+	if all := m.GetAllByNode(42); len(all) != 1 || all[0] != first {
+		t.Fatalf("GetAllByNode=%v, want [sock-1]", all)
+	}
+	if c, ok := m.GetByDevice("dev-42"); !ok || c != first {
+		t.Fatalf("device maps to %v,%v, want sock-1", c, ok)
+	}
+	if nodes := m.NodesOfConn("sock-2"); len(nodes) != 0 {
+		t.Fatalf("NodesOfConn(sock-2)=%v, want none", nodes)
+	}
+
+	core.ClearConnIdentity(m, first)
+	if _, ok := m.GetByNode(42); ok {
+		t.Fatal("node 42 still routable after both sessions logged out")
+	}
+	if _, ok := m.GetByDevice("dev-42"); ok {
+		t.Fatal("dev-42 still routable after both sessions logged out")
+	}
+}
+
+func TestManager_DuplicateLoginRejectNew(t *testing.T) {
+	m := New()
+	m.SetDuplicatePolicy(DuplicateRejectNew)
+	first, second, errs := loginTwice(t, m)
+	if errs[0] != nil || !errors.Is(errs[1], ErrDuplicateConn) {
+		t.Fatalf("bind errs=%v, want [nil ErrDuplicateConn]", errs)
+	}
+	if first.closed.Load() || second.closed.Load() {
+		t.Fatalf("reject policy must not close either socket")
+	}
+	if c, ok := m.GetByNode(42); !ok || c.ID() != "sock-1" {
+		t.Fatalf("node maps to %v,%v, want sock-1", c, ok)
+	}
+	if c, ok := m.GetByDevice("dev-42"); !ok || c.ID() != "sock-1" {
+		t.Fatalf("device maps to %v,%v, want sock-1", c, ok)
+	}
+	// 旧连接断开后，新连接可以正常绑定。
+	_ = m.Remove("sock-1")
+	if err := m.TryBindDevice("dev-42", second); err != nil {
+		t.Fatalf("bind after old removed: %v", err)
+	}
+}
+
+func TestManager_DuplicateLoginAllowBoth(t *testing.T) {
+	m := New()
+	m.SetDuplicatePolicy(DuplicateAllowBoth)
+	first, _, errs := loginTwice(t, m)
+	if errs[0] != nil || errs[1] != nil {
+		t.Fatalf("bind errs=%v", errs)
+	}
+	if first.closed.Load() {
+		t.Fatalf("allow_both must keep the first socket open")
+	}
+	all := m.GetAllByNode(42)
+	if len(all) != 2 || all[0].ID() != "sock-2" || all[1].ID() != "sock-1" {
+		t.Fatalf("GetAllByNode=%v, want [sock-2 sock-1]", all)
+	}
+	if c, ok := m.GetByDevice("dev-42"); !ok || c.ID() != "sock-2" {
+		t.Fatalf("device maps to %v,%v, want sock-2", c, ok)
+	}
+}
+
+func TestDuplicatePolicyFromConfig(t *testing.T) {
+	for raw, want := range map[string]DuplicatePolicy{
+		"kick_old": DuplicateKickOld, " Reject_New ": DuplicateRejectNew, "allow_both": DuplicateAllowBoth, "bogus": DuplicateKickOld,
+	} {
+		if got := DuplicatePolicyFromConfig(raw); got != want {
+			t.Fatalf("DuplicatePolicyFromConfig(%q)=%v, want %v", raw, got, want)
+		}
+	}
+}
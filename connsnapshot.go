@@ -0,0 +1,75 @@
+package core
+
+// 本文件承载 Core 框架中与 `connsnapshot` 相关的通用逻辑。
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnInfo 是单条连接在某一时刻的只读快照，供管理端展示。
+type ConnInfo struct {
+	ID           string    `json:"id"`
+	NodeID       uint32    `json:"node_id"`
+	DeviceID     string    `json:"device_id,omitempty"`
+	Role         string    `json:"role,omitempty"`
+	RemoteAddr   string    `json:"remote_addr,omitempty"`
+	ConnectedAt  time.Time `json:"connected_at"`
+	LastActivity time.Time `json:"last_activity"`
+}
+
+// ConnIndexSnapshot 是 node/device 索引的纯数据拷贝，值为连接 ID。
+type ConnIndexSnapshot struct {
+	Nodes   map[uint32][]string `json:"nodes"`
+	Devices map[string]string   `json:"devices"`
+}
+
+// ConnInfoOf 从连接元数据与可选的 IActivityTracker 组装快照，conn 为 nil 时返回零值。
+func ConnInfoOf(conn IConnection) ConnInfo {
+	if conn == nil {
+		return ConnInfo{}
+	}
+	info := ConnInfo{
+		ID:       conn.ID(),
+		NodeID:   ConnNodeID(conn),
+		DeviceID: ConnDeviceID(conn),
+		Role:     ConnRole(conn),
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	if t, ok := conn.(IActivityTracker); ok {
+		info.ConnectedAt = t.ConnectedAt()
+		info.LastActivity = t.LastActivity()
+	}
+	return info
+}
+
+// ActivityClock 是 IActivityTracker 的可嵌入实现，Touch 可在收发热路径上无锁调用。
+type ActivityClock struct {
+	connected atomic.Int64
+	last      atomic.Int64
+}
+
+// MarkConnected 记录连接建立时间，同时作为首次活动时间。
+func (a *ActivityClock) MarkConnected() {
+	now := time.Now().UnixNano()
+	a.connected.Store(now)
+	a.last.Store(now)
+}
+
+// Touch 记录一次收发活动。
+func (a *ActivityClock) Touch() { a.last.Store(time.Now().UnixNano()) }
+
+// ConnectedAt 返回连接建立时间，未记录时为零值。
+func (a *ActivityClock) ConnectedAt() time.Time { return unixNanoTime(a.connected.Load()) }
+
+// LastActivity 返回最近一次收发时间，未记录时为零值。
+func (a *ActivityClock) LastActivity() time.Time { return unixNanoTime(a.last.Load()) }
+
+func unixNanoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
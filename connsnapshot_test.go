@@ -0,0 +1,37 @@
+package core
+
+// 本文件覆盖 Core 框架中与 `connsnapshot` 相关的行为。
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// trackedConn 在 metaConn 基础上提供地址与活动时间。
+type trackedConn struct {
+	metaConn
+	ActivityClock
+}
+
+func (c *trackedConn) ID() string { return "tracked" }
+func (c *trackedConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 9000}
+}
+
+func TestConnInfoOfReadsMetaAndActivity(t *testing.T) {
+	c := &trackedConn{metaConn: metaConn{meta: map[string]any{MetaNodeIDKey: 5, MetaRoleKey: RoleParent}}}
+	if info := ConnInfoOf(c); !info.ConnectedAt.IsZero() || !info.LastActivity.IsZero() {
+		t.Fatalf("untouched clock should report zero times, got %+v", info)
+	}
+	c.MarkConnected()
+	time.Sleep(time.Millisecond)
+	c.Touch()
+	info := ConnInfoOf(c)
+	if info.ID != "tracked" || info.NodeID != 5 || info.Role != RoleParent || info.RemoteAddr != "10.0.0.1:9000" {
+		t.Fatalf("info=%+v", info)
+	}
+	if !info.LastActivity.After(info.ConnectedAt) {
+		t.Fatalf("LastActivity=%v should be after ConnectedAt=%v", info.LastActivity, info.ConnectedAt)
+	}
+}
@@ -21,3 +21,43 @@ func ServerFromContext(ctx context.Context) IServer {
 	}
 	return nil
 }
+
+type sendAuditedKey struct{}
+
+// WithSendAudited 标记经此 ctx 发出的帧已由调用方审计并补齐字段，Server.Send/Broadcast 将跳过 IProcess.OnSend，
+// Broadcast 也不再为每条连接克隆 header（快速路径，适合转发等无需逐连接改写的场景）。
+func WithSendAudited(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, sendAuditedKey{}, true)
+}
+
+// SendAudited 判断 ctx 是否带有 WithSendAudited 标记。
+func SendAudited(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(sendAuditedKey{}).(bool)
+	return v
+}
+
+type sourceVerifiedKey struct{}
+
+// WithSourceVerified 标记 ctx 所属帧的 SourceID 已由分发层按连接身份校验（handler 未声明 AllowSourceMismatch），
+// 鉴权可据此信任 hdr.SourceID；未标记时应以连接绑定的 nodeID 为准。
+func WithSourceVerified(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, sourceVerifiedKey{}, true)
+}
+
+// SourceVerified 判断 ctx 是否带有 WithSourceVerified 标记。
+func SourceVerified(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	v, _ := ctx.Value(sourceVerifiedKey{}).(bool)
+	return v
+}
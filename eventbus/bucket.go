@@ -12,15 +12,22 @@ type bucket struct {
 	handlers map[string]Handler
 	mu       sync.RWMutex
 	cancel   context.CancelFunc
+	wild     *topicTrie // 总线共享的通配订阅，分发时按事件名求匹配
+	overflow OverflowPolicy
+	stats    bucketCounters
+	report   func(topic string, recovered any) // 处理器 panic 的上报入口
 }
 
 // newBucket 为单个事件名创建独立队列与 worker 组。
-func newBucket(opts Options) *bucket {
+func newBucket(opts Options, wild *topicTrie, overflow OverflowPolicy, report func(string, any)) *bucket {
 	ctx, cancel := context.WithCancel(context.Background())
 	b := &bucket{
 		ch:       make(chan Event, opts.DefaultBuffer),
 		handlers: make(map[string]Handler),
 		cancel:   cancel,
+		wild:     wild,
+		overflow: overflow,
+		report:   report,
 	}
 	workers := opts.DefaultWorkers
 	if workers <= 0 {
@@ -58,20 +65,50 @@ func (b *bucket) loop(ctx context.Context) {
 	}
 }
 
-// dispatch 在读锁下遍历订阅者，并用 panic 保护避免单个处理器拖垮整个事件桶。
+// push 按溢出策略把事件放入队列；block 为 false 时即使策略为 Block 也不等待。
+// 返回 ErrEventDropped 表示事件被丢弃，ctx 结束时返回 ctx.Err()。
+func (b *bucket) push(ctx context.Context, ev Event, block bool) error {
+	dropped, err := pushChan(ctx, b.ch, ev, b.overflow, block)
+	b.stats.dropped.Add(dropped)
+	if err == nil {
+		b.stats.published.Add(1)
+	}
+	return err
+}
+
+// hasSubscribers 判断事件名 key 是否有精确或通配订阅者。
+func (b *bucket) hasSubscribers(key string) bool {
+	b.mu.RLock()
+	n := len(b.handlers)
+	b.mu.RUnlock()
+	return n > 0 || (b.wild != nil && len(b.wild.match(key)) > 0)
+}
+
+// snapshot 返回该桶的计数。
+func (b *bucket) snapshot() TopicStats {
+	return TopicStats{
+		Published: b.stats.published.Load(),
+		Dropped:   b.stats.dropped.Load(),
+		Handled:   b.stats.handled.Load(),
+		Panics:    b.stats.panics.Load(),
+		Queued:    len(b.ch),
+	}
+}
+
+// dispatch 先在读锁下调用精确订阅者，再调用匹配事件名的通配订阅者；
+// 每个处理器都有 panic 保护，panic 会被计数并上报，不会拖垮整个事件桶。
 func (b *bucket) dispatch(ctx context.Context, ev Event) {
 	b.mu.RLock()
 	for _, h := range b.handlers {
-		func(handler Handler) {
-			defer func() {
-				if r := recover(); r != nil {
-					// ignore panic to protect loop
-				}
-			}()
-			handler(ctx, ev)
-		}(h)
+		safeCall(ctx, h, ev, b.report)
 	}
 	b.mu.RUnlock()
+	if b.wild != nil {
+		for _, h := range b.wild.match(ev.Name) {
+			safeCall(ctx, h, ev, b.report)
+		}
+	}
+	b.stats.handled.Add(1)
 }
 
 // close 取消 bucket 的上下文，让后台 worker 尽快退出。
@@ -4,6 +4,7 @@ package eventbus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
@@ -11,27 +12,52 @@ import (
 	"time"
 )
 
+// ErrNoResponder 表示 Request 的事件名当前没有任何订阅者。
+var ErrNoResponder = errors.New("eventbus: no responder")
+
 // Event 描述一条事件。
 type Event struct {
 	Name string
 	Data any
 	Meta map[string]any
 	Time time.Time
+	// Respond 仅在经 Request 发出的事件上非空，订阅者调用它回答请求；
+	// 只有第一次调用生效，其余（包括其他订阅者的回答）被忽略。可在处理函数返回后异步调用。
+	Respond func(any)
+
+	retainSeq uint64 // 非 0 表示经 PublishRetained 发布，见 retain.go
 }
 
+// IsRequest 判断事件是否为需要回答的请求。
+func (e Event) IsRequest() bool { return e.Respond != nil }
+
 // Handler 事件处理函数。
 type Handler func(ctx context.Context, evt Event)
 
 // IBus 事件总线接口。
 type IBus interface {
-	// Publish 将事件发布到异步队列，若 ctx 结束则返回错误。
+	// Publish 将事件发布到异步队列；队列已满时按该事件名的溢出策略阻塞或丢弃（丢弃新事件时返回 ErrEventDropped）。
 	Publish(ctx context.Context, name string, data any, meta map[string]any) error
+	// TryPublish 非阻塞发布，事件被丢弃时返回 false；DropOldest 策略下会挤掉最早的排队事件。
+	TryPublish(ctx context.Context, name string, data any, meta map[string]any) bool
+	// PublishRetained 与 Publish 相同，并把事件保留为该事件名的最后值，之后的订阅者会先收到它。
+	PublishRetained(ctx context.Context, name string, data any, meta map[string]any) error
+	// ClearRetained 清除事件名的保留事件。
+	ClearRetained(name string)
 	// PublishSync 同步触发，直接在当前 goroutine 调用订阅者。
 	PublishSync(ctx context.Context, name string, data any, meta map[string]any)
-	// Subscribe 注册事件处理函数，返回 token。
+	// Request 发出请求事件并阻塞到第一个回答或 ctx 结束（应为 ctx 设置超时）；
+	// 没有订阅者时立即返回 ErrNoResponder。请求与普通事件共用队列与溢出策略。
+	Request(ctx context.Context, name string, data any) (any, error)
+	// Subscribe 注册事件处理函数，返回 token；name 可使用 "*"/"#" 通配段（见 topic.go）。
+	// 存在匹配的保留事件时，Subscribe 返回前会先把它们交给 h。
 	Subscribe(name string, h Handler) string
-	// Unsubscribe 通过 token 取消订阅。
+	// SubscribeWithOptions 与 Subscribe 相同，但可为该订阅指定独立队列与 worker（见 SubOptions）。
+	SubscribeWithOptions(name string, h Handler, opts SubOptions) string
+	// Unsubscribe 通过 token 取消订阅，name 需与订阅时一致（含通配段）。
 	Unsubscribe(name, token string)
+	// Stats 返回发布、丢弃与已处理事件的计数。
+	Stats() Stats
 	// Close 关闭总线，停止所有 worker。
 	Close()
 }
@@ -42,14 +68,23 @@ type Options struct {
 	DefaultBuffer int
 	// 默认每个事件的 worker 数。
 	DefaultWorkers int
+	// Overflow 事件队列已满时的默认策略（默认阻塞）。
+	Overflow OverflowPolicy
+	// TopicOverflow 按具体事件名覆盖溢出策略，例如 {"conn.closed": OverflowDropOldest}。
+	TopicOverflow map[string]OverflowPolicy
+	// OnPanic 可选：处理器 panic 时以事件名与 recover 值回调；无论是否设置，panic 都会计入 Stats。
+	OnPanic func(topic string, recovered any)
 }
 
 type bus struct {
-	mu      sync.RWMutex
-	buckets map[string]*bucket
-	opts    Options
-	closed  atomic.Bool
-	counter atomic.Uint64
+	mu       sync.RWMutex
+	buckets  map[string]*bucket
+	wild     *topicTrie
+	opts     Options
+	closed   atomic.Bool
+	counter  atomic.Uint64
+	async    map[string]*asyncSub // token -> Async 订阅，受 mu 保护
+	retained retainStore
 }
 
 // New 创建事件总线。
@@ -60,9 +95,18 @@ func New(opts Options) IBus {
 	if opts.DefaultWorkers <= 0 {
 		opts.DefaultWorkers = 1
 	}
+	if len(opts.TopicOverflow) > 0 {
+		topics := make(map[string]OverflowPolicy, len(opts.TopicOverflow))
+		for name, p := range opts.TopicOverflow {
+			topics[normalize(name)] = p
+		}
+		opts.TopicOverflow = topics
+	}
 	return &bus{
 		buckets: make(map[string]*bucket),
+		wild:    newTopicTrie(),
 		opts:    opts,
+		async:   make(map[string]*asyncSub),
 	}
 }
 
@@ -80,14 +124,26 @@ func (b *bus) Publish(ctx context.Context, name string, data any, meta map[strin
 	if key == "" {
 		return nil
 	}
+	if isWildcard(key) {
+		return fmt.Errorf("eventbus: cannot publish to wildcard topic %q", key)
+	}
 	bkt := b.getOrCreateBucket(key)
 	ev := Event{Name: key, Data: data, Meta: meta, Time: time.Now()}
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case bkt.ch <- ev:
-		return nil
+	return bkt.push(ctx, ev, true)
+}
+
+// TryPublish 与 Publish 相同但从不阻塞，适合在连接拆除等不能被慢订阅者拖住的路径上使用。
+func (b *bus) TryPublish(ctx context.Context, name string, data any, meta map[string]any) bool {
+	if b.closed.Load() {
+		return false
 	}
+	key := normalize(name)
+	if key == "" || isWildcard(key) {
+		return false
+	}
+	bkt := b.getOrCreateBucket(key)
+	ev := Event{Name: key, Data: data, Meta: meta, Time: time.Now()}
+	return bkt.push(ctx, ev, false) == nil
 }
 
 // PublishSync 直接在当前 goroutine 内调用订阅者，适合需要同步可见性的路径。
@@ -96,16 +152,54 @@ func (b *bus) PublishSync(ctx context.Context, name string, data any, meta map[s
 		return
 	}
 	key := normalize(name)
-	if key == "" {
+	if key == "" || isWildcard(key) {
 		return
 	}
 	bkt := b.getOrCreateBucket(key)
 	ev := Event{Name: key, Data: data, Meta: meta, Time: time.Now()}
+	bkt.stats.published.Add(1)
 	bkt.dispatch(ctx, ev)
 }
 
+// Request 经事件桶队列投递一条带 Respond 的事件，等待第一个回答。
+func (b *bus) Request(ctx context.Context, name string, data any) (any, error) {
+	if b.closed.Load() {
+		return nil, fmt.Errorf("eventbus closed")
+	}
+	key := normalize(name)
+	if key == "" || isWildcard(key) {
+		return nil, fmt.Errorf("eventbus: invalid request topic %q", name)
+	}
+	bkt := b.getOrCreateBucket(key)
+	if !bkt.hasSubscribers(key) {
+		return nil, ErrNoResponder
+	}
+	replies := make(chan any, 1)
+	var answered atomic.Bool
+	ev := Event{Name: key, Data: data, Time: time.Now(), Respond: func(v any) {
+		if answered.CompareAndSwap(false, true) {
+			replies <- v
+		}
+	}}
+	if err := bkt.push(ctx, ev, true); err != nil {
+		return nil, err
+	}
+	select {
+	case v := <-replies:
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
 // Subscribe 为指定事件名注册处理器，并返回可反注册的 token。
 func (b *bus) Subscribe(name string, h Handler) string {
+	return b.SubscribeWithOptions(name, h, SubOptions{})
+}
+
+// SubscribeWithOptions 注册处理器；Async 订阅先建独立队列，再把投递函数挂到桶或通配树上，
+// 最后回放匹配的保留事件。
+func (b *bus) SubscribeWithOptions(name string, h Handler, opts SubOptions) string {
 	if b.closed.Load() {
 		return ""
 	}
@@ -116,26 +210,103 @@ func (b *bus) Subscribe(name string, h Handler) string {
 	if key == "" {
 		return ""
 	}
-	bkt := b.getOrCreateBucket(key)
+	var segs []string
+	if isWildcard(key) {
+		var ok bool
+		if segs, ok = splitPattern(key); !ok {
+			return ""
+		}
+	}
 	token := fmt.Sprintf("%s#%d", key, b.counter.Add(1))
-	bkt.addHandler(token, h)
+	if opts.Async {
+		sub := newAsyncSub(b, h, opts)
+		b.mu.Lock()
+		if b.closed.Load() {
+			b.mu.Unlock()
+			sub.stop()
+			return ""
+		}
+		b.async[token] = sub
+		b.mu.Unlock()
+		h = sub.handle
+	}
+	// 先注册再取保留事件：两者之间发布的保留事件既会回放也会排队，由 gate 去重，不会漏收。
+	gate := newReplayGate(h)
+	if segs != nil {
+		b.wild.add(segs, token, gate.handle)
+	} else {
+		b.getOrCreateBucket(key).addHandler(token, gate.handle)
+	}
+	gate.replay(context.Background(), b.retained.matching(key, segs), b.reportPanic)
 	return token
 }
 
-// Unsubscribe 按 token 移除订阅，避免后续事件继续命中旧 handler。
+// Unsubscribe 按 token 移除订阅，避免后续事件继续命中旧 handler；Async 订阅的 worker 一并停止。
 func (b *bus) Unsubscribe(name, token string) {
 	key := normalize(name)
 	if key == "" || token == "" {
 		return
 	}
+	if isWildcard(key) {
+		if segs, ok := splitPattern(key); ok {
+			b.wild.remove(segs, token)
+		}
+	} else {
+		b.mu.RLock()
+		bkt := b.buckets[key]
+		b.mu.RUnlock()
+		if bkt != nil {
+			bkt.removeHandler(token)
+		}
+	}
+	b.mu.Lock()
+	sub := b.async[token]
+	delete(b.async, token)
+	b.mu.Unlock()
+	if sub != nil {
+		sub.stop()
+	}
+}
+
+// reportPanic 计数并转交 Options.OnPanic。
+func (b *bus) reportPanic(topic string, recovered any) {
 	b.mu.RLock()
-	bkt := b.buckets[key]
+	bkt := b.buckets[topic]
 	b.mu.RUnlock()
 	if bkt != nil {
-		bkt.removeHandler(token)
+		bkt.stats.panics.Add(1)
+	}
+	if b.opts.OnPanic != nil {
+		b.opts.OnPanic(topic, recovered)
+	}
+}
+
+// countDropped 把 Async 订阅者队列的丢弃计入对应事件名。
+func (b *bus) countDropped(topic string, n uint64) {
+	b.mu.RLock()
+	bkt := b.buckets[topic]
+	b.mu.RUnlock()
+	if bkt != nil {
+		bkt.stats.dropped.Add(n)
 	}
 }
 
+// Stats 汇总各事件桶的计数；总线关闭后返回空快照。
+func (b *bus) Stats() Stats {
+	out := Stats{Topics: make(map[string]TopicStats)}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for name, bkt := range b.buckets {
+		ts := bkt.snapshot()
+		out.Topics[name] = ts
+		out.Published += ts.Published
+		out.Dropped += ts.Dropped
+		out.Handled += ts.Handled
+		out.Panics += ts.Panics
+	}
+	return out
+}
+
 // Close 停止全部 bucket worker，并拒绝后续 publish/subscribe。
 func (b *bus) Close() {
 	if !b.closed.CompareAndSwap(false, true) {
@@ -146,7 +317,13 @@ func (b *bus) Close() {
 		bkt.close()
 	}
 	b.buckets = nil
+	subs := b.async
+	b.async = nil
 	b.mu.Unlock()
+	for _, sub := range subs {
+		sub.stop()
+	}
+	b.wild.reset()
 }
 
 // getOrCreateBucket 惰性创建事件桶，把不同事件名的队列与 worker 隔离开。
@@ -163,7 +340,11 @@ func (b *bus) getOrCreateBucket(key string) *bucket {
 	if bkt, ok := b.buckets[key]; ok {
 		return bkt
 	}
-	bkt := newBucket(b.opts)
+	overflow := b.opts.Overflow
+	if p, ok := b.opts.TopicOverflow[key]; ok {
+		overflow = p
+	}
+	bkt := newBucket(b.opts, b.wild, overflow, b.reportPanic)
 	b.buckets[key] = bkt
 	return bkt
 }
@@ -0,0 +1,167 @@
+package eventbus
+
+// 本文件覆盖 Core 框架中与 `bus` 相关的行为。
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder 收集事件名，供断言命中集合与顺序。
+type recorder struct {
+	mu    sync.Mutex
+	names []string
+}
+
+func (r *recorder) handler(_ context.Context, evt Event) {
+	r.mu.Lock()
+	r.names = append(r.names, evt.Name)
+	r.mu.Unlock()
+}
+
+func (r *recorder) snapshot() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.names...)
+}
+
+func publishSyncAll(b IBus, names ...string) {
+	for _, n := range names {
+		b.PublishSync(context.Background(), n, nil, nil)
+	}
+}
+
+func TestBusWildcardMatching(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	cases := map[string][]string{
+		"conn.*":        {"conn.closed", "conn.replaced"},
+		"conn.#":        {"conn", "conn.closed", "conn.replaced", "conn.a.b"},
+		"*.closed":      {"conn.closed", "link.closed"},
+		"#":             {"conn", "conn.closed", "conn.replaced", "conn.a.b", "link.closed"},
+		"*":             {"conn", "conn.closed", "conn.replaced", "conn.a.b", "link.closed"},
+		"conn.closed":   {"conn.closed"},
+		"conn.*.b":      {"conn.a.b"},
+		"link.*.closed": nil,
+	}
+	recs := make(map[string]*recorder)
+	for pattern := range cases {
+		r := &recorder{}
+		recs[pattern] = r
+		if tok := b.Subscribe(pattern, r.handler); tok == "" {
+			t.Fatalf("Subscribe(%q) returned empty token", pattern)
+		}
+	}
+	publishSyncAll(b, "conn", "conn.closed", "conn.replaced", "conn.a.b", "link.closed")
+	for pattern, want := range cases {
+		if got := recs[pattern].snapshot(); !slices.Equal(got, want) {
+			t.Fatalf("pattern %q got %v, want %v", pattern, got, want)
+		}
+	}
+}
+
+func TestBusWildcardRejectsInvalidPatternAndPublish(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	if tok := b.Subscribe("conn.#.closed", func(context.Context, Event) {}); tok != "" {
+		t.Fatalf("non-terminal # accepted with token %q", tok)
+	}
+	if err := b.Publish(context.Background(), "conn.*", nil, nil); err == nil {
+		t.Fatalf("publish to wildcard topic succeeded")
+	}
+}
+
+func TestBusWildcardUnsubscribe(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	wild, exact := &recorder{}, &recorder{}
+	tok := b.Subscribe("conn.*", wild.handler)
+	b.Subscribe("conn.closed", exact.handler)
+
+	publishSyncAll(b, "conn.closed")
+	b.Unsubscribe("conn.*", tok)
+	publishSyncAll(b, "conn.closed")
+
+	if got := wild.snapshot(); len(got) != 1 {
+		t.Fatalf("wildcard handler calls=%v, want 1 before unsubscribe only", got)
+	}
+	if got := exact.snapshot(); len(got) != 2 {
+		t.Fatalf("exact handler calls=%v, want 2", got)
+	}
+	if n := b.(*bus).wild.size.Load(); n != 0 {
+		t.Fatalf("trie size=%d after unsubscribe, want 0", n)
+	}
+	if len(b.(*bus).wild.root.children) != 0 {
+		t.Fatalf("empty trie nodes not pruned")
+	}
+}
+
+func TestBusAsyncFanOutToExactAndWildcard(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	const n = 200
+	all, conn, exact := &recorder{}, &recorder{}, &recorder{}
+	b.Subscribe("#", all.handler)
+	b.Subscribe("conn.*", conn.handler)
+	b.Subscribe("conn.closed", exact.handler)
+
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		_ = b.Publish(ctx, "conn.closed", i, nil)
+		_ = b.Publish(ctx, "node.up", i, nil)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(all.snapshot()) < 2*n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := len(all.snapshot()); got != 2*n {
+		t.Fatalf("# received %d events, want %d", got, 2*n)
+	}
+	if got := len(conn.snapshot()); got != n {
+		t.Fatalf("conn.* received %d events, want %d", got, n)
+	}
+	if got := len(exact.snapshot()); got != n {
+		t.Fatalf("exact received %d events, want %d", got, n)
+	}
+}
+
+func TestBusAsyncWildcardSeesEventsInPublishOrder(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	const n = 100
+	var (
+		mu  sync.Mutex
+		got []int
+	)
+	b.Subscribe("conn.*", func(_ context.Context, evt Event) {
+		mu.Lock()
+		got = append(got, evt.Data.(int))
+		mu.Unlock()
+	})
+	for i := 0; i < n; i++ {
+		_ = b.Publish(context.Background(), "conn.closed", i, nil)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		done := len(got) == n
+		mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != n {
+		t.Fatalf("received %d events, want %d", len(got), n)
+	}
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("event %d out of order: got %d", i, v)
+		}
+	}
+}
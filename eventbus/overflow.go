@@ -0,0 +1,74 @@
+package eventbus
+
+// 本文件承载 Core 框架中与 `overflow` 相关的通用逻辑。
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+)
+
+// ErrEventDropped 表示事件桶已满且溢出策略为 DropNewest，本次发布被丢弃。
+var ErrEventDropped = errors.New("eventbus: event dropped")
+
+// OverflowPolicy 定义事件桶队列已满时 Publish 的行为。
+type OverflowPolicy int
+
+const (
+	// OverflowBlock 阻塞等待队列空位，受 ctx 约束（默认，兼容旧行为）。
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest 丢弃本次发布的事件，Publish 返回 ErrEventDropped。
+	OverflowDropNewest
+	// OverflowDropOldest 丢弃队列中最早的事件为本次发布腾出空位。
+	OverflowDropOldest
+)
+
+// String 返回策略在配置中的名字。
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	default:
+		return "block"
+	}
+}
+
+// OverflowPolicyFromConfig 解析 block/drop_newest/drop_oldest，未知值退回 block。
+func OverflowPolicyFromConfig(raw string) OverflowPolicy {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "drop_newest":
+		return OverflowDropNewest
+	case "drop_oldest":
+		return OverflowDropOldest
+	default:
+		return OverflowBlock
+	}
+}
+
+// TopicStats 为单个事件名的计数。
+type TopicStats struct {
+	Published uint64 `json:"published"` // 成功入队（或同步分发）的事件数
+	Dropped   uint64 `json:"dropped"`   // 因队列已满被丢弃的事件数
+	Handled   uint64 `json:"handled"`   // 已分发完毕的事件数（每个事件计一次，与订阅者数量无关）
+	Panics    uint64 `json:"panics"`    // 处理器 panic 次数（含 Async 订阅者）
+	Queued    int    `json:"queued"`    // 当前排队中的事件数
+}
+
+// Stats 为总线级计数快照，Topics 按归一化后的事件名索引。
+type Stats struct {
+	Published uint64                `json:"published"`
+	Dropped   uint64                `json:"dropped"`
+	Handled   uint64                `json:"handled"`
+	Panics    uint64                `json:"panics"`
+	Topics    map[string]TopicStats `json:"topics"`
+}
+
+// bucketCounters 为单个事件桶的原子计数。
+type bucketCounters struct {
+	published atomic.Uint64
+	dropped   atomic.Uint64
+	handled   atomic.Uint64
+	panics    atomic.Uint64
+}
@@ -0,0 +1,127 @@
+package eventbus
+
+// 本文件覆盖 Core 框架中与 `overflow` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockedBus 返回一个缓冲为 1 的总线，"t" 的唯一订阅者阻塞到 release 关闭，
+// 并已取走第一条事件（数据 0），使队列可被精确填满；seen 返回订阅者收到的数据。
+func blockedBus(t *testing.T, opts Options) (b IBus, release chan struct{}, seen func() []int) {
+	t.Helper()
+	opts.DefaultBuffer = 1
+	b = New(opts)
+	release = make(chan struct{})
+	started := make(chan struct{}, 1)
+	var (
+		mu  sync.Mutex
+		got []int
+	)
+	b.Subscribe("t", func(_ context.Context, evt Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		mu.Lock()
+		got = append(got, evt.Data.(int))
+		mu.Unlock()
+	})
+	seen = func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), got...)
+	}
+	t.Cleanup(func() {
+		select {
+		case <-release:
+		default:
+			close(release)
+		}
+		b.Close()
+	})
+	if err := b.Publish(context.Background(), "t", 0, nil); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	<-started
+	return b, release, seen
+}
+
+func TestBusOverflowDropNewest(t *testing.T) {
+	b, _, _ := blockedBus(t, Options{Overflow: OverflowDropNewest})
+	ctx := context.Background()
+	if err := b.Publish(ctx, "t", 1, nil); err != nil {
+		t.Fatalf("publish into free slot: %v", err)
+	}
+	if err := b.Publish(ctx, "t", 2, nil); !errors.Is(err, ErrEventDropped) {
+		t.Fatalf("publish err=%v, want ErrEventDropped", err)
+	}
+	st := b.Stats()
+	if st.Published != 2 || st.Dropped != 1 || st.Topics["t"].Queued != 1 {
+		t.Fatalf("stats=%+v", st)
+	}
+}
+
+func TestBusOverflowDropOldestKeepsNewest(t *testing.T) {
+	b, release, seen := blockedBus(t, Options{TopicOverflow: map[string]OverflowPolicy{" T ": OverflowDropOldest}})
+	for i := 1; i <= 3; i++ {
+		if err := b.Publish(context.Background(), "t", i, nil); err != nil {
+			t.Fatalf("publish %d: %v", i, err)
+		}
+	}
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().Handled < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := seen(); !slices.Equal(got, []int{0, 3}) {
+		t.Fatalf("handled=%v, want [0 3]", got)
+	}
+	if st := b.Stats(); st.Dropped != 2 || st.Published != 4 {
+		t.Fatalf("stats=%+v", st)
+	}
+}
+
+func TestBusTryPublishNeverBlocks(t *testing.T) {
+	b, release, _ := blockedBus(t, Options{}) // 默认 Block 策略
+	ctx := context.Background()
+	if !b.TryPublish(ctx, "t", 1, nil) {
+		t.Fatalf("TryPublish into free slot failed")
+	}
+	start := time.Now()
+	if b.TryPublish(ctx, "t", 2, nil) {
+		t.Fatalf("TryPublish into full queue succeeded")
+	}
+	if time.Since(start) > 100*time.Millisecond {
+		t.Fatalf("TryPublish blocked for %v", time.Since(start))
+	}
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for b.Stats().Handled < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	st := b.Stats()
+	if st.Published != 2 || st.Dropped != 1 || st.Handled != 2 {
+		t.Fatalf("stats=%+v", st)
+	}
+}
+
+func TestOverflowPolicyFromConfig(t *testing.T) {
+	for raw, want := range map[string]OverflowPolicy{
+		"":             OverflowBlock,
+		"block":        OverflowBlock,
+		"Drop_Newest":  OverflowDropNewest,
+		" drop_oldest": OverflowDropOldest,
+		"bogus":        OverflowBlock,
+	} {
+		if got := OverflowPolicyFromConfig(raw); got != want {
+			t.Fatalf("OverflowPolicyFromConfig(%q)=%v, want %v", raw, got, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package eventbus
+
+// 本文件覆盖 Core 框架中与 `request` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBusRequestNoResponder(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	b.Subscribe("other", func(context.Context, Event) {})
+	if _, err := b.Request(context.Background(), "conn.lookup", 1); !errors.Is(err, ErrNoResponder) {
+		t.Fatalf("err=%v, want ErrNoResponder", err)
+	}
+}
+
+func TestBusRequestTimeout(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	b.Subscribe("conn.lookup", func(context.Context, Event) {}) // 从不回答
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := b.Request(ctx, "conn.lookup", 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err=%v, want deadline exceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("request returned after %v", time.Since(start))
+	}
+}
+
+func TestBusRequestFirstReplyWins(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	b.Subscribe("conn.lookup", func(_ context.Context, evt Event) { evt.Respond("exact") })
+	b.Subscribe("conn.*", func(_ context.Context, evt Event) { evt.Respond("wildcard") })
+	b.Subscribe("conn.#", func(_ context.Context, evt Event) {
+		if !evt.IsRequest() {
+			t.Errorf("request event without Respond")
+		}
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	got, err := b.Request(ctx, "conn.lookup", nil)
+	if err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	// 精确订阅者先于通配订阅者被调用，因此它的回答胜出。
+	if got != "exact" {
+		t.Fatalf("reply=%v, want exact", got)
+	}
+}
+
+func TestBusRequestConcurrent(t *testing.T) {
+	b := New(Options{DefaultWorkers: 4})
+	defer b.Close()
+	b.Subscribe("double", func(_ context.Context, evt Event) {
+		n := evt.Data.(int)
+		go evt.Respond(n * 2) // 回答可以在处理函数返回后异步给出
+	})
+	const n = 100
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			got, err := b.Request(ctx, "double", i)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if got != i*2 {
+				errs <- errors.New("mismatched reply")
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("request failed: %v", err)
+	}
+}
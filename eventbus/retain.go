@@ -0,0 +1,148 @@
+package eventbus
+
+// 本文件承载 Core 框架中与 `retain` 相关的通用逻辑。
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 保留事件：PublishRetained 在正常发布之外记住每个事件名的最后一条事件，之后的订阅者在收到任何
+// 实时事件之前先收到它（通配订阅收到全部匹配事件名的保留事件，按事件名排序）。适合 "parent.ready"
+// 这类只在启动期发布一次、但晚注册的组件也需要知道的状态。保留事件按事件名覆盖，可用 ClearRetained 清除。
+
+// retainStore 保存各事件名的保留事件。
+type retainStore struct {
+	mu     sync.RWMutex
+	events map[string]Event
+	seq    atomic.Uint64 // 为保留事件编号，订阅时据此去重“已回放又在队列中”的同一事件
+}
+
+// set 记录 key 的保留事件并返回带编号的副本。
+func (s *retainStore) set(ev Event) Event {
+	ev.retainSeq = s.seq.Add(1)
+	s.mu.Lock()
+	if s.events == nil {
+		s.events = make(map[string]Event)
+	}
+	s.events[ev.Name] = ev
+	s.mu.Unlock()
+	return ev
+}
+
+func (s *retainStore) clear(key string) {
+	s.mu.Lock()
+	delete(s.events, key)
+	s.mu.Unlock()
+}
+
+// matching 返回与订阅名匹配的保留事件，按事件名排序；segs 为 nil 表示精确订阅 key。
+func (s *retainStore) matching(key string, segs []string) []Event {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if segs == nil {
+		if ev, ok := s.events[key]; ok {
+			return []Event{ev}
+		}
+		return nil
+	}
+	var out []Event
+	for name, ev := range s.events {
+		if matchPattern(segs, strings.Split(name, ".")) {
+			out = append(out, ev)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// matchPattern 判断通配段 segs 是否匹配事件名的各段，规则与 topicTrie 相同。
+func matchPattern(segs, name []string) bool {
+	for i, seg := range segs {
+		switch seg {
+		case wildcardMany:
+			return true
+		case wildcardOne:
+			if i >= len(name) {
+				return false
+			}
+		default:
+			if i >= len(name) || name[i] != seg {
+				return false
+			}
+		}
+	}
+	return len(segs) == len(name)
+}
+
+// replayGate 包裹新订阅者：回放保留事件期间挡住实时事件，保证保留事件先到；
+// 回放过的保留事件若仍在队列中，随后的实时投递会被跳过，订阅者不会收到两次。
+type replayGate struct {
+	h        Handler
+	mu       sync.Mutex
+	ready    atomic.Bool
+	replayed map[string]uint64 // 事件名 -> 已回放的保留编号，ready 之后只读
+}
+
+// newReplayGate 创建处于回放中（未就绪）的门，调用方必须随后调用 replay。
+func newReplayGate(h Handler) *replayGate {
+	g := &replayGate{h: h}
+	g.mu.Lock()
+	return g
+}
+
+func (g *replayGate) handle(ctx context.Context, ev Event) {
+	if !g.ready.Load() {
+		// 回放期间 mu 由 replay 持有，这里只为等它结束。
+		g.mu.Lock()
+		g.mu.Unlock()
+	}
+	if ev.retainSeq != 0 && ev.retainSeq <= g.replayed[ev.Name] {
+		return
+	}
+	g.h(ctx, ev)
+}
+
+// replay 依次把保留事件交给订阅者，然后放行实时事件。
+func (g *replayGate) replay(ctx context.Context, events []Event, report func(string, any)) {
+	defer g.mu.Unlock()
+	defer g.ready.Store(true)
+	if len(events) == 0 {
+		return
+	}
+	g.replayed = make(map[string]uint64, len(events))
+	for _, ev := range events {
+		g.replayed[ev.Name] = ev.retainSeq
+		safeCall(ctx, g.h, ev, report)
+	}
+}
+
+// PublishRetained 与 Publish 相同，并把该事件记为 name 的保留事件（覆盖旧值）；
+// 即使实时投递因溢出被丢弃，保留事件仍会更新。
+func (b *bus) PublishRetained(ctx context.Context, name string, data any, meta map[string]any) error {
+	if b.closed.Load() {
+		return fmt.Errorf("eventbus closed")
+	}
+	key := normalize(name)
+	if key == "" {
+		return nil
+	}
+	if isWildcard(key) {
+		return fmt.Errorf("eventbus: cannot publish to wildcard topic %q", key)
+	}
+	bkt := b.getOrCreateBucket(key)
+	ev := b.retained.set(Event{Name: key, Data: data, Meta: meta, Time: time.Now()})
+	return bkt.push(ctx, ev, true)
+}
+
+// ClearRetained 清除 name 的保留事件，之后的订阅者不再收到回放；已排队的实时事件不受影响。
+func (b *bus) ClearRetained(name string) {
+	if key := normalize(name); key != "" {
+		b.retained.clear(key)
+	}
+}
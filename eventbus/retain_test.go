@@ -0,0 +1,90 @@
+package eventbus
+
+// 本文件覆盖 Core 框架中与 `retain` 相关的行为。
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// collect 订阅 name 并把收到的事件数据按到达顺序写入通道。
+func collect(b IBus, name string) <-chan any {
+	got := make(chan any, 16)
+	b.Subscribe(name, func(_ context.Context, evt Event) { got <- evt.Data })
+	return got
+}
+
+func expectData(t *testing.T, got <-chan any, want ...any) {
+	t.Helper()
+	for i, w := range want {
+		select {
+		case v := <-got:
+			if v != w {
+				t.Fatalf("event %d data=%v, want %v", i, v, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d (%v) not delivered", i, w)
+		}
+	}
+	select {
+	case v := <-got:
+		t.Fatalf("unexpected extra event %v", v)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestBusRetainedSubscribeBeforeAndAfterPublishSymmetric(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	early := collect(b, "parent.ready")
+	if err := b.PublishRetained(context.Background(), "parent.ready", "p1", nil); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	late := collect(b, "parent.ready")
+	expectData(t, early, "p1")
+	expectData(t, late, "p1") // 回放，且不会因队列中的同一事件再收到一次
+}
+
+func TestBusRetainedDeliveredBeforeLiveEvents(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	if err := b.PublishRetained(context.Background(), "parent.ready", "retained", nil); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+	got := collect(b, "parent.ready")
+	for i := 0; i < 3; i++ {
+		_ = b.Publish(context.Background(), "parent.ready", i, nil)
+	}
+	expectData(t, got, "retained", 0, 1, 2)
+}
+
+func TestBusRetainedOverwriteClearAndWildcard(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	ctx := context.Background()
+	_ = b.PublishRetained(ctx, "parent.ready", "old", nil)
+	_ = b.PublishRetained(ctx, "parent.ready", "new", nil)
+	_ = b.PublishRetained(ctx, "node.ready", "node", nil)
+	_ = b.Publish(ctx, "parent.lost", "not retained", nil)
+
+	expectData(t, collect(b, "parent.ready"), "new")
+	expectData(t, collect(b, "*.ready"), "node", "new") // 按事件名排序回放
+	expectData(t, collect(b, "parent.#"), "new")
+
+	b.ClearRetained("Parent.Ready")
+	expectData(t, collect(b, "parent.ready"))
+	expectData(t, collect(b, "#"), "node")
+}
+
+func TestBusRetainedReplayWithAsyncSubscriber(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	for i := 0; i < 3; i++ {
+		_ = b.PublishRetained(context.Background(), fmt.Sprintf("svc.%d", i), i, nil)
+	}
+	got := make(chan any, 8)
+	b.SubscribeWithOptions("svc.*", func(_ context.Context, evt Event) { got <- evt.Data }, SubOptions{Async: true})
+	expectData(t, got, 0, 1, 2)
+}
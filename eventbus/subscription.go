@@ -0,0 +1,121 @@
+package eventbus
+
+// 本文件承载 Core 框架中与 `subscription` 相关的通用逻辑。
+
+import (
+	"context"
+	"sync"
+)
+
+// SubOptions 为单个订阅的分发参数。
+//
+// 默认（Async=false）订阅者在事件桶的 worker 上与同名其他订阅者串行执行，慢订阅者会拖慢同桶其他人。
+// Async=true 时订阅者拥有独立队列与 worker：桶 worker 只负责把事件投递到该队列，慢订阅者只拖慢自己。
+type SubOptions struct {
+	Async bool
+	// Buffer 独立队列长度，<=0 时取总线的 DefaultBuffer；仅 Async 生效。
+	Buffer int
+	// Workers 独立 worker 数，<=0 时为 1；大于 1 时该订阅者收到事件的顺序不再保证。仅 Async 生效。
+	Workers int
+	// Overflow 独立队列已满时的策略。默认 Block 会反压到事件桶；需要彻底隔离时使用 DropNewest/DropOldest，
+	// 丢弃计入该事件名的 Dropped。
+	Overflow OverflowPolicy
+}
+
+// asyncSub 为 Async 订阅持有独立队列与 worker。
+type asyncSub struct {
+	ch       chan Event
+	h        Handler
+	overflow OverflowPolicy
+	bus      *bus
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+func newAsyncSub(b *bus, h Handler, opts SubOptions) *asyncSub {
+	if opts.Buffer <= 0 {
+		opts.Buffer = b.opts.DefaultBuffer
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &asyncSub{ch: make(chan Event, opts.Buffer), h: h, overflow: opts.Overflow, bus: b, cancel: cancel}
+	for i := 0; i < opts.Workers; i++ {
+		s.wg.Add(1)
+		go s.loop(ctx)
+	}
+	return s
+}
+
+// loop 消费独立队列并调用订阅者。
+func (s *asyncSub) loop(ctx context.Context) {
+	defer s.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-s.ch:
+			safeCall(ctx, s.h, ev, s.bus.reportPanic)
+		}
+	}
+}
+
+// handle 是注册到事件桶/通配树中的 Handler：只把事件投递到独立队列。
+func (s *asyncSub) handle(ctx context.Context, ev Event) {
+	dropped, _ := pushChan(ctx, s.ch, ev, s.overflow, true)
+	if dropped > 0 {
+		s.bus.countDropped(ev.Name, dropped)
+	}
+}
+
+// stop 停止独立 worker；队列中尚未处理的事件被丢弃。
+func (s *asyncSub) stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// pushChan 按溢出策略把事件放入 ch，返回被丢弃的事件数（DropOldest 挤掉的旧事件或 DropNewest 丢掉的本事件）。
+// 本事件被丢弃时返回 ErrEventDropped，ctx 结束时返回 ctx.Err()。
+func pushChan(ctx context.Context, ch chan Event, ev Event, policy OverflowPolicy, block bool) (uint64, error) {
+	select {
+	case ch <- ev:
+		return 0, nil
+	default:
+	}
+	switch {
+	case policy == OverflowDropOldest:
+		var dropped uint64
+		for {
+			select {
+			case ch <- ev:
+				return dropped, nil
+			default:
+			}
+			select {
+			case <-ch:
+				dropped++
+			default:
+			}
+		}
+	case policy == OverflowBlock && block:
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case ch <- ev:
+			return 0, nil
+		}
+	default:
+		return 1, ErrEventDropped
+	}
+}
+
+// safeCall 调用单个处理器；处理器 panic 时交给 report 记录，保护调用方的循环不被打断。
+func safeCall(ctx context.Context, handler Handler, ev Event, report func(topic string, recovered any)) {
+	defer func() {
+		if r := recover(); r != nil && report != nil {
+			report(ev.Name, r)
+		}
+	}()
+	handler(ctx, ev)
+}
@@ -0,0 +1,105 @@
+package eventbus
+
+// 本文件覆盖 Core 框架中与 `subscription` 相关的行为。
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBusAsyncSubscriberIsolatesSlowConsumer(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	release := make(chan struct{})
+	defer close(release)
+	b.SubscribeWithOptions("conn.closed", func(context.Context, Event) { <-release }, SubOptions{Async: true, Overflow: OverflowDropNewest})
+	fast := make(chan int, 16)
+	b.Subscribe("conn.closed", func(_ context.Context, evt Event) { fast <- evt.Data.(int) })
+
+	for i := 0; i < 10; i++ {
+		if err := b.Publish(context.Background(), "conn.closed", i, nil); err != nil {
+			t.Fatalf("publish: %v", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		select {
+		case got := <-fast:
+			if got != i {
+				t.Fatalf("fast subscriber got %d, want %d", got, i)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("fast subscriber delayed by sleeping subscriber after %d events", i)
+		}
+	}
+}
+
+func TestBusAsyncUnsubscribeStopsWorker(t *testing.T) {
+	b := New(Options{})
+	defer b.Close()
+	var mu sync.Mutex
+	calls := 0
+	tok := b.SubscribeWithOptions("conn.*", func(context.Context, Event) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+	}, SubOptions{Async: true, Workers: 2})
+	b.PublishSync(context.Background(), "conn.closed", nil, nil)
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := calls
+		mu.Unlock()
+		if n == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	b.Unsubscribe("conn.*", tok)
+	if n := len(b.(*bus).async); n != 0 {
+		t.Fatalf("async subs=%d after unsubscribe", n)
+	}
+	b.PublishSync(context.Background(), "conn.closed", nil, nil)
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Fatalf("calls=%d, want 1", calls)
+	}
+}
+
+func TestBusReportsHandlerPanics(t *testing.T) {
+	type report struct {
+		topic string
+		value any
+	}
+	reports := make(chan report, 4)
+	b := New(Options{OnPanic: func(topic string, v any) { reports <- report{topic, v} }})
+	defer b.Close()
+	b.Subscribe("boom", func(context.Context, Event) { panic("sync") })
+	b.SubscribeWithOptions("boom", func(context.Context, Event) { panic("async") }, SubOptions{Async: true})
+	ok := make(chan struct{}, 1)
+	b.Subscribe("boom", func(context.Context, Event) { ok <- struct{}{} })
+
+	_ = b.Publish(context.Background(), "boom", nil, nil)
+	got := map[any]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case r := <-reports:
+			if r.topic != "boom" {
+				t.Fatalf("panic topic=%q", r.topic)
+			}
+			got[r.value] = true
+		case <-time.After(time.Second):
+			t.Fatalf("panic not reported, got %v", got)
+		}
+	}
+	if !got["sync"] || !got["async"] {
+		t.Fatalf("reported=%v, want sync and async", got)
+	}
+	<-ok // 其他订阅者不受影响
+	if p := b.Stats().Panics; p != 2 {
+		t.Fatalf("panics=%d, want 2", p)
+	}
+}
@@ -0,0 +1,153 @@
+package eventbus
+
+// 本文件承载 Core 框架中与 `topic` 相关的通用逻辑。
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 层级主题：事件名按 "." 切分为段，订阅名可使用通配段：
+//   - "*" 匹配恰好一段，例如 "conn.*" 匹配 conn.closed、conn.replaced，但不匹配 conn 或 conn.a.b；
+//   - "#" 只能作为最后一段，匹配零或多段，例如 "conn.#" 匹配 conn、conn.closed、conn.a.b；
+//   - 单独的 "*" 与 "#" 等价，匹配所有事件。
+//
+// 发布总是针对具体事件名；不含通配段的订阅仍走原有的按名分桶，通配订阅存放在段前缀树中，
+// 发布分发时按段遍历前缀树求出匹配的订阅者。
+
+const (
+	wildcardOne  = "*"
+	wildcardMany = "#"
+)
+
+// isWildcard 判断订阅名是否包含通配段。
+func isWildcard(key string) bool {
+	for _, seg := range strings.Split(key, ".") {
+		if seg == wildcardOne || seg == wildcardMany {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPattern 把通配订阅名切分为段；"#" 不在末尾时返回 false。
+func splitPattern(key string) ([]string, bool) {
+	if key == wildcardOne {
+		return []string{wildcardMany}, true
+	}
+	segs := strings.Split(key, ".")
+	for i, seg := range segs {
+		if seg == wildcardMany && i != len(segs)-1 {
+			return nil, false
+		}
+	}
+	return segs, true
+}
+
+type topicNode struct {
+	children map[string]*topicNode
+	handlers map[string]Handler // 以该节点为终点的通配订阅
+}
+
+func newTopicNode() *topicNode {
+	return &topicNode{children: make(map[string]*topicNode), handlers: make(map[string]Handler)}
+}
+
+// topicTrie 按段存储通配订阅，支持按具体事件名求匹配的订阅者。
+type topicTrie struct {
+	mu   sync.RWMutex
+	root *topicNode
+	size atomic.Int64 // 订阅总数，为 0 时发布路径可跳过查找
+}
+
+func newTopicTrie() *topicTrie {
+	return &topicTrie{root: newTopicNode()}
+}
+
+// add 注册一条通配订阅。
+func (t *topicTrie) add(segs []string, token string, h Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := t.root
+	for _, seg := range segs {
+		child := n.children[seg]
+		if child == nil {
+			child = newTopicNode()
+			n.children[seg] = child
+		}
+		n = child
+	}
+	n.handlers[token] = h
+	t.size.Add(1)
+}
+
+// remove 删除一条通配订阅，并回收不再有订阅的空节点。
+func (t *topicTrie) remove(segs []string, token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	path := make([]*topicNode, 0, len(segs)+1)
+	n := t.root
+	path = append(path, n)
+	for _, seg := range segs {
+		n = n.children[seg]
+		if n == nil {
+			return
+		}
+		path = append(path, n)
+	}
+	if _, ok := n.handlers[token]; !ok {
+		return
+	}
+	delete(n.handlers, token)
+	t.size.Add(-1)
+	for i := len(segs); i > 0; i-- {
+		node := path[i]
+		if len(node.handlers) > 0 || len(node.children) > 0 {
+			break
+		}
+		delete(path[i-1].children, segs[i-1])
+	}
+}
+
+// match 返回与具体事件名匹配的全部通配订阅者。
+func (t *topicTrie) match(name string) []Handler {
+	if t.size.Load() == 0 {
+		return nil
+	}
+	segs := strings.Split(name, ".")
+	var out []Handler
+	t.mu.RLock()
+	t.collect(t.root, segs, &out)
+	t.mu.RUnlock()
+	return out
+}
+
+// collect 自 n 起匹配剩余段 segs，把命中的订阅者追加到 out。
+func (t *topicTrie) collect(n *topicNode, segs []string, out *[]Handler) {
+	if many := n.children[wildcardMany]; many != nil {
+		for _, h := range many.handlers {
+			*out = append(*out, h)
+		}
+	}
+	if len(segs) == 0 {
+		for _, h := range n.handlers {
+			*out = append(*out, h)
+		}
+		return
+	}
+	if child := n.children[segs[0]]; child != nil {
+		t.collect(child, segs[1:], out)
+	}
+	if one := n.children[wildcardOne]; one != nil {
+		t.collect(one, segs[1:], out)
+	}
+}
+
+// reset 清空全部通配订阅。
+func (t *topicTrie) reset() {
+	t.mu.Lock()
+	t.root = newTopicNode()
+	t.size.Store(0)
+	t.mu.Unlock()
+}
@@ -0,0 +1,106 @@
+// Package events 定义 Server 在事件总线上发布的生命周期事件名及其类型化载荷。
+//
+// 订阅方可按事件名断言 eventbus.Event.Data 的具体类型，例如：
+//
+//	bus.Subscribe(events.ConnAuthenticated, func(_ context.Context, evt eventbus.Event) {
+//		data := evt.Data.(events.ConnAuthenticatedData)
+//		...
+//	})
+//
+// 较早的 conn.closed、conn.replaced、frame.error、parent.ready 仍以 map[string]any 发布，保持兼容。
+package events
+
+// 生命周期事件名。除 ServerStopping 以 PublishSync 同步发布外，其余均为非阻塞发布，队列已满时可能被丢弃。
+const (
+	// ServerStarted 在 Server.Start 完成装配后发布，载荷为 ServerStartedData。
+	ServerStarted = "server.started"
+	// ServerStopping 在 Server.Stop 开始拆除前同步发布（订阅者返回前 Stop 不会继续），载荷为 ServerStoppingData。
+	ServerStopping = "server.stopping"
+	// ConnAdded 在连接加入管理器后发布，载荷为 ConnAddedData。
+	ConnAdded = "conn.added"
+	// ConnAuthenticated 在登录流程写入连接的 nodeID 元数据并以该 nodeID 绑定索引后发布，载荷为 ConnAuthenticatedData。
+	ConnAuthenticated = "conn.authenticated"
+	// ParentConnected 在父链路完成注册（含热备提升）后发布，载荷为 ParentConnectedData。
+	ParentConnected = "parent.connected"
+	// ParentLost 在活动父链路断开后发布，载荷为 ParentLostData。
+	ParentLost = "parent.lost"
+	// SendFailed 在 Server.Send/Broadcast 的帧入队或写出失败时发布，载荷为 SendFailedData。
+	SendFailed = "send.failed"
+	// DispatcherQueueFull 在分发队列已满、入站帧被丢弃时发布，载荷为 DispatcherQueueFullData。
+	DispatcherQueueFull = "dispatcher.queue_full"
+	// ConfigChanged 在运行期修改单个配置项（如管理端 set_config）后发布，载荷为 ConfigChangedData。
+	ConfigChanged = "config.changed"
+	// ParentReady 父链路就绪时以保留方式发布、断开时清除，载荷为 map[string]any{"addr","conn_id","node_id"}；
+	// 与 server.EventParentReady 相同，供无法引用 server 包的组件订阅。
+	ParentReady = "parent.ready"
+)
+
+// ServerStartedData 描述刚启动的服务。
+type ServerStartedData struct {
+	Name     string
+	NodeID   uint32
+	Protocol string // 监听器协议，如 "tcp"
+}
+
+// ServerStoppingData 描述即将停止的服务。
+type ServerStoppingData struct {
+	Name        string
+	NodeID      uint32
+	Connections int // 停止时仍在管理器中的连接数
+}
+
+// ConnAddedData 描述新加入的连接。
+type ConnAddedData struct {
+	ConnID     string
+	RemoteAddr string
+	Protocol   string // 接入该连接的监听器协议；本节点拨出的父链路为空
+	Role       string // core.RoleChild / core.RoleParent 等
+}
+
+// ConnAuthenticatedData 描述完成登录的连接身份。
+type ConnAuthenticatedData struct {
+	ConnID   string
+	NodeID   uint32
+	DeviceID string
+}
+
+// ParentConnectedData 描述当前生效的父链路。
+type ParentConnectedData struct {
+	Addr     string
+	ConnID   string
+	NodeID   uint32 // 父节点分配给本节点的 node_id，未注册时为 0
+	Promoted bool   // 是否由热备链路提升而来
+}
+
+// ParentLostData 描述断开的父链路。
+type ParentLostData struct {
+	Addr   string
+	ConnID string
+	NodeID uint32
+}
+
+// SendFailedData 描述一次失败的发送。
+type SendFailedData struct {
+	ConnID   string
+	NodeID   uint32 // 目标连接绑定的 nodeID
+	SubProto uint8
+	MsgID    uint32
+	Error    string
+}
+
+// DispatcherQueueFullData 描述一次因分发队列已满而丢弃的入站帧。
+type DispatcherQueueFullData struct {
+	ConnID   string
+	Queue    int
+	Priority uint8
+	SubProto uint8
+	MsgID    uint32
+}
+
+// ConfigChangedData 描述一次运行期配置修改；敏感键的值已脱敏。
+type ConfigChangedData struct {
+	Key    string
+	Old    string
+	Value  string
+	NodeID uint32 // 发起修改的节点，本地修改时为 0
+}
@@ -2,7 +2,10 @@ package core
 
 // 本文件承载 Core 框架中与 `frame` 相关的通用逻辑。
 
-import "io"
+import (
+	"bufio"
+	"io"
+)
 
 // Frame is the transport-neutral in-memory frame representation.
 //
@@ -22,3 +25,33 @@ type IFrameReader interface {
 type IFrameWriter interface {
 	WriteFrame(w io.Writer, codec IHeaderCodec, frame Frame) error
 }
+
+// IBatchFrameDecoder is an optional codec capability: decode up to maxFrames
+// frames that are already buffered, so the read loop can dispatch a batch.
+type IBatchFrameDecoder interface {
+	DecodeBatch(r *bufio.Reader, maxFrames int) ([]Frame, error)
+}
+
+// IPooledFrameDecoder is an optional codec capability: decode one frame using a
+// caller-owned header scratch buffer and payload allocator (e.g. backed by a pool).
+type IPooledFrameDecoder interface {
+	DecodeWith(r io.Reader, scratch []byte, alloc func(n int) []byte) (IHeader, []byte, error)
+}
+
+// IHeaderDecoder is an optional codec capability: decode only the frame header and
+// leave the payload (PayloadLen bytes) in the stream for incremental consumption.
+type IHeaderDecoder interface {
+	DecodeHeader(r io.Reader, scratch []byte) (IHeader, error)
+}
+
+// StreamReceiveHandler 流式接收回调：body 限定为该帧的 payload，只在回调期间有效；
+// 回调返回后未读完的部分会被读取循环丢弃，以保持帧对齐。
+type StreamReceiveHandler func(conn IConnection, header IHeader, body io.Reader)
+
+// IStreamReceiver 可选能力：连接可以把标记为流式的大帧以 io.Reader 形式交给处理器，
+// 而不是整帧缓冲后经 DispatchReceive 交付。
+type IStreamReceiver interface {
+	OnReceiveStream(h StreamReceiveHandler)
+	// DispatchStream 调用已注册的流式回调；未注册时返回 false 且不读取 body。
+	DispatchStream(header IHeader, body io.Reader) bool
+}
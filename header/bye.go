@@ -0,0 +1,36 @@
+package header
+
+// 本文件承载 Core 框架中与 `bye` 相关的通用逻辑。
+
+import (
+	"bytes"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// 告别帧：本端主动断开连接前发给对端的最后一帧，告知断开原因，便于对端区分被踢与网络故障。
+//
+// 与版本报价相同，以控制帧承载（Major=Cmd、SubProto=0、Source/Target=0），
+// payload 为 "MFHB" + reason（UTF-8，可为空）。不识别告别帧的节点会在预路由阶段丢弃它。
+
+var byeMagic = []byte("MFHB")
+
+// NewByeFrame 构造一帧告别帧，返回的头与 payload 可交给任意 codec 编码发送。
+func NewByeFrame(reason string) (core.IHeader, []byte) {
+	payload := make([]byte, 0, len(byeMagic)+len(reason))
+	payload = append(payload, byeMagic...)
+	payload = append(payload, reason...)
+	hdr := (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(0)
+	return hdr, payload
+}
+
+// ParseBye 判断一帧是否为告别帧，并返回其中携带的断开原因。
+func ParseBye(hdr core.IHeader, payload []byte) (string, bool) {
+	if hdr == nil || hdr.Major() != MajorCmd || hdr.SubProto() != 0 || hdr.SourceID() != 0 {
+		return "", false
+	}
+	if !bytes.HasPrefix(payload, byeMagic) {
+		return "", false
+	}
+	return string(payload[len(byeMagic):]), true
+}
@@ -0,0 +1,50 @@
+package header
+
+// 本文件承载 Core 框架中与 `control` 相关的通用逻辑。
+
+import core "github.com/yttydcs/myflowhub-core"
+
+// 无负载控制帧：带 FlagControl 且 payload 为空的帧，用于 ping、ack 等无需负载的信令。
+// 与告别帧、版本报价这类靠 payload 魔数识别的控制帧不同，仅凭头部即可识别，无需读取或分配 payload。
+//
+// 约定：Cmd + FlagACKRequired 为需要回执的控制请求（如 ping），接收端以同 MsgID 的
+// OKResp 控制帧（ack）应答；读取循环可直接消化这两类帧而不进入子协议分发（见 reader 的控制帧快速路径）。
+
+// NewControlFrame 构造子协议 sub 上的控制帧（Major=Cmd），flags 会与 FlagControl 合并。
+func NewControlFrame(sub uint8, flags uint8) *HeaderTcp {
+	h := &HeaderTcp{}
+	h.WithMajor(MajorCmd).WithSubProto(sub).WithFlags(flags | FlagControl).WithPayloadLength(0)
+	return h
+}
+
+// NewControlAck 构造对控制请求 req 的回执：同子协议、同 MsgID 的 OKResp 控制帧，源/目标对调。
+func NewControlAck(req core.IHeader) *HeaderTcp {
+	h := &HeaderTcp{}
+	h.WithMajor(MajorOKResp).
+		WithSubProto(req.SubProto()).
+		WithFlags(FlagControl).
+		WithMsgID(req.GetMsgID()).
+		WithSourceID(req.TargetID()).
+		WithTargetID(req.SourceID()).
+		WithTraceID(req.GetTraceID()).
+		WithPayloadLength(0)
+	return h
+}
+
+// IsControl 判断该头是否描述一帧控制帧。
+func (h HeaderTcp) IsControl() bool { return h.Flags&FlagControl != 0 && h.PayloadLen == 0 }
+
+// IsControl 判断任意 IHeader 是否为控制帧；nil 返回 false。
+func IsControl(h core.IHeader) bool {
+	return h != nil && h.GetFlags()&FlagControl != 0 && h.PayloadLength() == 0
+}
+
+// IsControlRequest 判断是否为需要回执的控制请求（Cmd + FlagACKRequired）。
+func IsControlRequest(h core.IHeader) bool {
+	return IsControl(h) && h.Major() == MajorCmd && h.GetFlags()&FlagACKRequired != 0
+}
+
+// IsControlAck 判断是否为控制回执（OKResp 控制帧）。
+func IsControlAck(h core.IHeader) bool {
+	return IsControl(h) && h.Major() == MajorOKResp
+}
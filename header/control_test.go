@@ -0,0 +1,41 @@
+package header
+
+// 本文件覆盖 Core 框架中与 `control` 相关的行为。
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestControlFrameRoundTripsWithoutPayload(t *testing.T) {
+	req := NewControlFrame(7, FlagACKRequired)
+	req.WithMsgID(42).WithSourceID(3).WithTargetID(9)
+	codec := HeaderTcpCodec{}
+	frame, err := codec.Encode(req, nil)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if len(frame) != headerTcpSize {
+		t.Fatalf("control frame is %d bytes, want bare header %d", len(frame), headerTcpSize)
+	}
+	got, payload, err := codec.Decode(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(payload) != 0 || !IsControl(got) || !IsControlRequest(got) || IsControlAck(got) {
+		t.Fatalf("decoded control request misclassified: flags=%08b payload=%d", got.GetFlags(), len(payload))
+	}
+	if h, ok := got.(*HeaderTcp); !ok || !h.IsControl() || h.SubProto() != 7 || h.GetMsgID() != 42 {
+		t.Fatalf("decoded header=%+v", got)
+	}
+
+	ack := NewControlAck(got)
+	if !IsControlAck(ack) || ack.GetMsgID() != 42 || ack.SourceID() != 9 || ack.TargetID() != 3 || ack.SubProto() != 7 {
+		t.Fatalf("ack=%+v, want OKResp control echoing msg 42 with swapped ends", ack)
+	}
+
+	plain := (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(7).WithFlags(FlagControl).WithPayloadLength(4)
+	if IsControl(plain) || IsControl(nil) {
+		t.Fatal("frame with payload or nil header treated as control")
+	}
+}
@@ -0,0 +1,122 @@
+package header
+
+// 本文件承载 Core 框架中与 `ext` 相关的通用逻辑。
+
+import (
+	"encoding/binary"
+	"slices"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// 扩展头区（HdrLen>32 部分）按 TLV 编排：Type[1] Len[1] Value[Len]。
+// 未识别的 Type 会被跳过，格式损坏时忽略剩余扩展，保持对旧实现“读取并忽略”的兼容。
+const (
+	// ExtTypeVisitedPath 记录帧已途经的节点 ID 列表（每项 4 字节大端），用于转发环路检测。
+	ExtTypeVisitedPath uint8 = 0x01
+	// ExtTypeTargetDevice 携带目标设备 ID（UTF-8），用于按设备而不是节点 ID 单播。
+	ExtTypeTargetDevice uint8 = 0x02
+
+	// MaxTargetDeviceLen 为目标设备 ID 的最大字节数；与途经路径同时存在时路径会相应截短以满足 HdrLen<=255。
+	MaxTargetDeviceLen = 64
+
+	// MaxVisitedPath 为扩展头能容纳的最多途经节点数（受 HdrLen<=255 限制）。
+	MaxVisitedPath = (255 - headerTcpSize - 2) / 4
+)
+
+// ExtensionBytes 返回 h 的扩展头编码，无扩展字段时返回 nil。
+func (h *HeaderTcp) ExtensionBytes() []byte {
+	if h == nil || (len(h.Path) == 0 && h.TargetDevice == "") {
+		return nil
+	}
+	var ext []byte
+	if dev := h.TargetDevice; dev != "" {
+		if len(dev) > MaxTargetDeviceLen {
+			dev = dev[:MaxTargetDeviceLen]
+		}
+		ext = append(ext, ExtTypeTargetDevice, byte(len(dev)))
+		ext = append(ext, dev...)
+	}
+	if len(h.Path) == 0 {
+		return ext
+	}
+	path := h.Path
+	if room := (255 - headerTcpSize - len(ext) - 2) / 4; len(path) > room {
+		path = path[len(path)-room:]
+	}
+	ext = append(ext, ExtTypeVisitedPath, byte(4*len(path)))
+	for _, id := range path {
+		ext = binary.BigEndian.AppendUint32(ext, id)
+	}
+	return ext
+}
+
+// parseExtension 从扩展头区还原已知字段。
+func (h *HeaderTcp) parseExtension(ext []byte) {
+	for len(ext) >= 2 {
+		typ, n := ext[0], int(ext[1])
+		if len(ext) < 2+n {
+			return
+		}
+		val := ext[2 : 2+n]
+		if typ == ExtTypeVisitedPath && n%4 == 0 && n > 0 {
+			h.Path = make([]uint32, n/4)
+			for i := range h.Path {
+				h.Path[i] = binary.BigEndian.Uint32(val[4*i:])
+			}
+		}
+		if typ == ExtTypeTargetDevice && n > 0 {
+			h.TargetDevice = string(val)
+		}
+		ext = ext[2+n:]
+	}
+}
+
+// VisitedPath 返回帧记录的途经节点（从早到晚）；非 HeaderTcp 或未记录时返回 nil。
+func VisitedPath(h core.IHeader) []uint32 {
+	if tcp, ok := h.(*HeaderTcp); ok && tcp != nil {
+		return tcp.Path
+	}
+	return nil
+}
+
+// PathContains 判断帧是否已途经 nodeID。
+func PathContains(h core.IHeader, nodeID uint32) bool {
+	return slices.Contains(VisitedPath(h), nodeID)
+}
+
+// AppendVisited 把 nodeID 追加到帧的途经路径末尾；超过 maxLen（<=0 或超过上限时取 MaxVisitedPath）
+// 时丢弃最早的记录。总是分配新切片，避免与其他克隆共享底层数组。返回 false 表示 h 不支持扩展头。
+func AppendVisited(h core.IHeader, nodeID uint32, maxLen int) bool {
+	tcp, ok := h.(*HeaderTcp)
+	if !ok || tcp == nil {
+		return false
+	}
+	if maxLen <= 0 || maxLen > MaxVisitedPath {
+		maxLen = MaxVisitedPath
+	}
+	path := append(slices.Clone(tcp.Path), nodeID)
+	if len(path) > maxLen {
+		path = path[len(path)-maxLen:]
+	}
+	tcp.Path = path
+	return true
+}
+
+// TargetDevice 返回帧携带的目标设备 ID；非 HeaderTcp 或未设置时返回空串。
+func TargetDevice(h core.IHeader) string {
+	if tcp, ok := h.(*HeaderTcp); ok && tcp != nil {
+		return tcp.TargetDevice
+	}
+	return ""
+}
+
+// SetTargetDevice 设置按设备单播的目标设备 ID（空串表示清除）。返回 false 表示 h 不支持扩展头或 ID 超过 MaxTargetDeviceLen。
+func SetTargetDevice(h core.IHeader, deviceID string) bool {
+	tcp, ok := h.(*HeaderTcp)
+	if !ok || tcp == nil || len(deviceID) > MaxTargetDeviceLen {
+		return false
+	}
+	tcp.TargetDevice = deviceID
+	return true
+}
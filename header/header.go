@@ -3,9 +3,11 @@ package header
 // 本文件承载 Core 框架中与 `header` 相关的通用逻辑。
 
 import (
+	"bufio"
 	"encoding/binary"
 	"errors"
 	"io"
+	"slices"
 	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
@@ -17,10 +19,11 @@ import (
 //
 // 说明：
 // - Magic：用于快速判帧与防止错位读。
-// - Ver/HdrLen：用于版本与扩展；当前 v2 固定 HdrLen=32，可向后追加字段（HdrLen>32 时 decoder 会读取并忽略扩展区）。
+// - Ver/HdrLen：用于版本与扩展；基础头 32 字节，HdrLen>32 时其后为 TLV 扩展区（见 ext.go），未知类型会被忽略。
 // - TypeFmt：bit0..1=Major；bit2..7=SubProto。
+// - Flags：bit0=ACKRequired；bit1=Compressed；bit2=Streamed；bit3=More；bit4=Control；bit5=ExpectResponse；bit6=FireAndForget；bit7 保留。
 // - HopLimit：每发生一次“转发”递减 1，用于防环；0 视为未设置，按 DefaultHopLimit 处理。
-// - RouteFlags：预留路由标志位（当前不定义语义）。
+// - RouteFlags：bit0..1=Priority（0..3，越大越优先）；bit2=LocalOnly（只在直连的本节点处理、从不转发）；bit3=TraceRoute（逐跳追加途经记录）；其余位保留。
 // - TraceID：跨 hop 关联日志与观测；0 视为未设置，可由发送链路自动填充。
 type HeaderTcp struct {
 	Magic      uint16
@@ -36,6 +39,11 @@ type HeaderTcp struct {
 	TraceID    uint32
 	Timestamp  uint32
 	PayloadLen uint32
+
+	// Path 为扩展头中的途经节点列表（可选），用于转发环路检测。
+	Path []uint32
+	// TargetDevice 为扩展头中的目标设备 ID（可选），非空时按设备而不是 Target 节点 ID 单播。
+	TargetDevice string
 }
 
 // 大类常量（TypeFmt bit0..1）
@@ -52,13 +60,101 @@ const (
 	DefaultHopLimit    uint8  = 16
 )
 
-// Flags 预留位（可按需扩展）
+// Flags 位定义（bit7 保留）
 const (
 	FlagACKRequired uint8 = 1 << 0 // 需回执
 	FlagCompressed  uint8 = 1 << 1 // 负载压缩
-	// 其他位保留
+	FlagStreamed    uint8 = 1 << 2 // 负载按流交付：接收端可不整帧缓冲（见 DecodeHeader）
+	FlagMore        uint8 = 1 << 3 // 多帧响应：同一 MsgID 之后还有帧，终止帧清除该位（见 kit.ResponseWriter）
+	FlagControl     uint8 = 1 << 4 // 无 payload 的控制帧（见 control.go），接收端可不经业务分发直接处理
+	// FlagExpectResponse 标记请求帧：发送方等待同 MsgID 的 OKResp/ErrResp。
+	FlagExpectResponse uint8 = 1 << 5
+	// FlagFireAndForget 标记纯通知帧：接收端不应回包（含错误回包），与 FlagExpectResponse 互斥。
+	// 二者都未设置的帧保持旧语义，由子协议自行约定是否应答。
+	FlagFireAndForget uint8 = 1 << 6
+	// bit7 保留
+)
+
+// 请求/通知语义位，BuildTCPResponse 生成的回包会清除这两位。
+const responseModeMask = FlagExpectResponse | FlagFireAndForget
+
+// HasMore 判断响应帧之后是否还有同一 MsgID 的后续帧；nil 视为终止帧。
+func HasMore(h core.IHeader) bool {
+	return h != nil && h.GetFlags()&FlagMore != 0
+}
+
+// WantsResponse 判断任意 IHeader 是否带 FlagExpectResponse；nil 返回 false。
+func WantsResponse(h core.IHeader) bool {
+	return h != nil && h.GetFlags()&FlagExpectResponse != 0
+}
+
+// IsFireAndForget 判断任意 IHeader 是否带 FlagFireAndForget；nil 返回 false。
+func IsFireAndForget(h core.IHeader) bool {
+	return h != nil && h.GetFlags()&FlagFireAndForget != 0
+}
+
+// WantsResponse 判断发送方是否等待回包（FlagExpectResponse）。
+func (h HeaderTcp) WantsResponse() bool { return h.Flags&FlagExpectResponse != 0 }
+
+// IsFireAndForget 判断该帧是否为不需应答的通知（FlagFireAndForget）。
+func (h HeaderTcp) IsFireAndForget() bool { return h.Flags&FlagFireAndForget != 0 }
+
+// WithExpectResponse 设置或清除 FlagExpectResponse；设置时同时清除 FlagFireAndForget，其余标志位不变。
+func (h *HeaderTcp) WithExpectResponse(v bool) core.IHeader {
+	h.Flags &^= responseModeMask
+	if v {
+		h.Flags |= FlagExpectResponse
+	}
+	return h
+}
+
+// WithFireAndForget 设置或清除 FlagFireAndForget；设置时同时清除 FlagExpectResponse，其余标志位不变。
+func (h *HeaderTcp) WithFireAndForget(v bool) core.IHeader {
+	h.Flags &^= responseModeMask
+	if v {
+		h.Flags |= FlagFireAndForget
+	}
+	return h
+}
+
+// RouteFlags 位定义（bit4..7 保留）
+const (
+	RoutePriorityMask uint8 = 0x03
+	// RouteFlagLocalOnly 标记只由收到该帧的节点本地处理、绝不转发的帧（如诊断探测）：
+	// TargetID 为本节点或 0 时按本地帧分发，指向其他节点时直接丢弃。
+	RouteFlagLocalOnly uint8 = 0x04
+	// RouteFlagTraceRoute 标记路由探测帧：每个转发它的节点把自身 nodeID 与时间戳追加到 payload（见 traceroute.go）。
+	RouteFlagTraceRoute uint8 = 0x08
+
+	PriorityNormal   uint8 = 0 // 缺省优先级，未设置的帧均按此处理
+	PriorityElevated uint8 = 1
+	PriorityHigh     uint8 = 2
+	PriorityUrgent   uint8 = 3
+	PriorityLevels         = 4
 )
 
+// PriorityOf 从任意 IHeader 的 RouteFlags 取优先级；nil 视为 PriorityNormal。
+func PriorityOf(h core.IHeader) uint8 {
+	if h == nil {
+		return PriorityNormal
+	}
+	return h.GetRouteFlags() & RoutePriorityMask
+}
+
+// IsLocalOnly 判断帧是否带 RouteFlagLocalOnly；nil 视为 false。
+func IsLocalOnly(h core.IHeader) bool {
+	return h != nil && h.GetRouteFlags()&RouteFlagLocalOnly != 0
+}
+
+// Priority 返回帧优先级（RouteFlags 的 bit0..1）。
+func (h HeaderTcp) Priority() uint8 { return h.RouteFlags & RoutePriorityMask }
+
+// WithPriority 设置帧优先级（超出 0..3 的值按低两位截断，不会修改其他路由标志位）。
+func (h *HeaderTcp) WithPriority(p uint8) core.IHeader {
+	h.RouteFlags = (h.RouteFlags &^ RoutePriorityMask) | (p & RoutePriorityMask)
+	return h
+}
+
 // Major 返回消息大类（TypeFmt 的 bit0..1）。
 func (h HeaderTcp) Major() uint8 { return h.TypeFmt & 0x03 }
 
@@ -103,11 +199,24 @@ func (h *HeaderTcp) Clone() core.IHeader {
 		return &HeaderTcp{}
 	}
 	clone := *h
+	clone.Path = slices.Clone(h.Path)
 	return &clone
 }
 
-// HeaderTcpCodec 提供 HeaderTcp 的编解码。
-type HeaderTcpCodec struct{}
+// HeaderTcpCodec 提供 HeaderTcp 的编解码；每次调用都会上报给 SetCodecMetrics 安装的钩子。
+//
+// 解码约定：Decode/DecodeWith/DecodeHeader/DecodeBatch 成功时返回的 core.IHeader 具体类型
+// 恒为 *HeaderTcp（HeaderTcp 值类型不实现 core.IHeader），调用方可直接断言 h.(*HeaderTcp)；
+// 失败时返回 nil 接口而非类型化的 nil 指针。
+type HeaderTcpCodec struct {
+	// MaxPayload 单帧 payload 上限（字节），超出时编解码返回 ErrPayloadTooLarge；0 表示不限制。
+	MaxPayload uint32
+}
+
+var (
+	_ core.IBatchFrameDecoder  = HeaderTcpCodec{}
+	_ core.IPooledFrameDecoder = HeaderTcpCodec{}
+)
 
 const headerTcpSize = 32
 
@@ -116,10 +225,36 @@ var (
 	ErrHeaderVersionInvalid = errors.New("header version invalid")
 	ErrHeaderLenInvalid     = errors.New("header length invalid")
 	ErrHeaderTooLarge       = errors.New("header too large")
+	ErrPayloadTooLarge      = errors.New("payload too large")
 )
 
 // Encode 将 HeaderTcp 与 payload 编码为 [header || payload]。
-func (HeaderTcpCodec) Encode(header core.IHeader, payload []byte) ([]byte, error) {
+func (c HeaderTcpCodec) Encode(header core.IHeader, payload []byte) ([]byte, error) {
+	buf, err := c.encodeHeader(header, len(payload), len(payload))
+	if err == nil {
+		buf = append(buf, payload...)
+	}
+	observeEncode(len(buf), err)
+	return buf, err
+}
+
+// EncodeHeader 只编码帧头（含扩展区），供需要把头与 payload 分开写出的路径使用；
+// 指标按整帧大小上报。
+func (c HeaderTcpCodec) EncodeHeader(header core.IHeader, payloadLen int) ([]byte, error) {
+	buf, err := c.encodeHeader(header, payloadLen, 0)
+	size := 0
+	if err == nil {
+		size = len(buf) + payloadLen
+	}
+	observeEncode(size, err)
+	return buf, err
+}
+
+// encodeHeader 编码帧头，返回的切片额外预留 reserve 字节容量供调用方追加 payload。
+func (c HeaderTcpCodec) encodeHeader(header core.IHeader, payloadLen, reserve int) ([]byte, error) {
+	if c.MaxPayload > 0 && uint64(payloadLen) > uint64(c.MaxPayload) {
+		return nil, ErrPayloadTooLarge
+	}
 	var h HeaderTcp
 	if hp, ok := header.(*HeaderTcp); ok && hp != nil {
 		h = *hp
@@ -135,20 +270,18 @@ func (HeaderTcpCodec) Encode(header core.IHeader, payload []byte) ([]byte, error
 			Target:     header.TargetID(),
 			TraceID:    header.GetTraceID(),
 			Timestamp:  header.GetTimestamp(),
-			PayloadLen: header.PayloadLength(),
 		}
 	}
 	if h.HopLimit == 0 {
 		h.HopLimit = DefaultHopLimit
 	}
-	if uint32(len(payload)) != h.PayloadLen {
-		h.PayloadLen = uint32(len(payload))
-	}
+	h.PayloadLen = uint32(payloadLen)
+	ext := h.ExtensionBytes()
 	h.Magic = HeaderTcpMagicV2
 	h.Ver = HeaderTcpVersionV2
-	h.HdrLen = headerTcpSize
+	h.HdrLen = uint8(headerTcpSize + len(ext))
 
-	buf := make([]byte, headerTcpSize+len(payload))
+	buf := make([]byte, int(h.HdrLen), int(h.HdrLen)+reserve)
 	binary.BigEndian.PutUint16(buf[0:2], h.Magic)
 	buf[2] = h.Ver
 	buf[3] = h.HdrLen
@@ -162,39 +295,103 @@ func (HeaderTcpCodec) Encode(header core.IHeader, payload []byte) ([]byte, error
 	binary.BigEndian.PutUint32(buf[20:24], h.TraceID)
 	binary.BigEndian.PutUint32(buf[24:28], h.Timestamp)
 	binary.BigEndian.PutUint32(buf[28:32], h.PayloadLen)
-	copy(buf[headerTcpSize:], payload)
+	copy(buf[headerTcpSize:], ext)
 	return buf, nil
 }
 
 // Decode 从 reader 解码出一帧：先读头（最小 32B；允许 hdr_len>32 的扩展头），再按 PayloadLen 读取负载。
-func (HeaderTcpCodec) Decode(r io.Reader) (core.IHeader, []byte, error) {
-	prefix := make([]byte, 4)
-	if _, err := io.ReadFull(r, prefix); err != nil {
+func (c HeaderTcpCodec) Decode(r io.Reader) (core.IHeader, []byte, error) {
+	return c.DecodeWith(r, nil, nil)
+}
+
+// DecodeWith 与 Decode 语义一致，但允许调用方复用缓冲以减少分配：
+//   - scratch 用作头部暂存区，长度不足 255 时会临时分配；解码返回后即可复用；
+//   - alloc 返回长度为 n 的 payload 缓冲（如取自池），为 nil 时使用 make。
+func (c HeaderTcpCodec) DecodeWith(r io.Reader, scratch []byte, alloc func(n int) []byte) (core.IHeader, []byte, error) {
+	h, payload, err := c.decodeWith(r, scratch, alloc)
+	size := 0
+	if err == nil {
+		size = int(h.HdrLen) + len(payload)
+	}
+	observeDecode(size, err)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, payload, nil
+}
+
+// DecodeHeader 只解码帧头，payload 留在 r 中由调用方按 PayloadLen 自行消费（流式接收）。
+// 带 FlagStreamed 的帧不受 MaxPayload 限制——该上限用于约束整帧缓冲的内存，流式消费不缓冲整帧。
+func (c HeaderTcpCodec) DecodeHeader(r io.Reader, scratch []byte) (core.IHeader, error) {
+	h, err := c.decodeHeader(r, scratch)
+	if err == nil && h.Flags&FlagStreamed == 0 && c.MaxPayload > 0 && h.PayloadLen > c.MaxPayload {
+		err = ErrPayloadTooLarge
+	}
+	size := 0
+	if err == nil {
+		size = int(h.HdrLen) + int(h.PayloadLen)
+	}
+	observeDecode(size, err)
+	if err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (c HeaderTcpCodec) decodeWith(r io.Reader, scratch []byte, alloc func(n int) []byte) (*HeaderTcp, []byte, error) {
+	h, err := c.decodeHeader(r, scratch)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.MaxPayload > 0 && h.PayloadLen > c.MaxPayload {
+		return nil, nil, ErrPayloadTooLarge
+	}
+	if h.PayloadLen == 0 {
+		return h, nil, nil
+	}
+	var payload []byte
+	if alloc != nil {
+		payload = alloc(int(h.PayloadLen))
+	} else {
+		payload = make([]byte, h.PayloadLen)
+	}
+	if _, err := io.ReadFull(r, payload); err != nil {
 		return nil, nil, err
 	}
+	return h, payload, nil
+}
+
+// decodeHeader 读取并校验帧头（最小 32B，允许扩展头）。
+func (c HeaderTcpCodec) decodeHeader(r io.Reader, scratch []byte) (*HeaderTcp, error) {
+	if len(scratch) < 255 {
+		scratch = make([]byte, 255)
+	}
+	prefix := scratch[:4]
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, err
+	}
 	magic := binary.BigEndian.Uint16(prefix[0:2])
 	ver := prefix[2]
 	hdrLen := prefix[3]
 	if magic != HeaderTcpMagicV2 {
-		return nil, nil, ErrHeaderMagicMismatch
+		return nil, ErrHeaderMagicMismatch
 	}
 	if ver != HeaderTcpVersionV2 {
-		return nil, nil, ErrHeaderVersionInvalid
+		return nil, ErrHeaderVersionInvalid
 	}
 	if hdrLen < headerTcpSize {
-		return nil, nil, ErrHeaderLenInvalid
+		return nil, ErrHeaderLenInvalid
 	}
 	// 防御：避免恶意 hdrLen 导致内存放大
 	if hdrLen > 255 {
-		return nil, nil, ErrHeaderTooLarge
+		return nil, ErrHeaderTooLarge
 	}
-	hdr := make([]byte, hdrLen)
-	copy(hdr[:4], prefix)
+	hdr := scratch[:hdrLen]
 	if _, err := io.ReadFull(r, hdr[4:]); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	h := HeaderTcp{
+	h := &HeaderTcp{
 		Magic:      magic,
 		Ver:        ver,
 		HdrLen:     hdrLen,
@@ -209,17 +406,65 @@ func (HeaderTcpCodec) Decode(r io.Reader) (core.IHeader, []byte, error) {
 		Timestamp:  binary.BigEndian.Uint32(hdr[24:28]),
 		PayloadLen: binary.BigEndian.Uint32(hdr[28:32]),
 	}
+	if hdrLen > headerTcpSize {
+		h.parseExtension(hdr[headerTcpSize:])
+	}
 	if h.HopLimit == 0 {
 		h.HopLimit = DefaultHopLimit
 	}
-	if h.PayloadLen == 0 {
-		return &h, nil, nil
+	return h, nil
+}
+
+// DecodeBatch 从带缓冲的 reader 中一次解出至多 maxFrames 帧，降低读取循环的单帧开销。
+//
+// 首帧按 Decode 语义阻塞读取；之后只在缓冲区内已有完整帧时继续解码，
+// 遇到跨越缓冲区边界的半帧即停止且不消费其字节，留待下一次调用。
+// 若后续帧解码失败，返回已解出的帧与该错误，调用方应先处理帧再处理错误。
+// 同一连接必须复用同一个 *bufio.Reader，否则缓冲区内的残余字节会丢失。
+func (c HeaderTcpCodec) DecodeBatch(r *bufio.Reader, maxFrames int) ([]core.Frame, error) {
+	if maxFrames <= 0 {
+		maxFrames = 1
 	}
-	payload := make([]byte, h.PayloadLen)
-	if _, err := io.ReadFull(r, payload); err != nil {
-		return nil, nil, err
+	hdr, payload, err := c.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	frames := make([]core.Frame, 0, maxFrames)
+	frames = append(frames, core.Frame{Header: hdr, Payload: payload})
+	for len(frames) < maxFrames && bufferedFrameReady(r) {
+		hdr, payload, err := c.Decode(r)
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, core.Frame{Header: hdr, Payload: payload})
+	}
+	return frames, nil
+}
+
+// bufferedFrameReady 仅窥视缓冲区，判断下一帧是否已完整到达（不触发底层读取）。
+// 头部非法时返回 true，让 Decode 给出具体错误。
+func bufferedFrameReady(r *bufio.Reader) bool {
+	n := r.Buffered()
+	if n < 4 {
+		return false
+	}
+	prefix, err := r.Peek(4)
+	if err != nil {
+		return false
+	}
+	if binary.BigEndian.Uint16(prefix[0:2]) != HeaderTcpMagicV2 || prefix[2] != HeaderTcpVersionV2 || prefix[3] < headerTcpSize {
+		return true
+	}
+	hdrLen := int(prefix[3])
+	if n < hdrLen {
+		return false
+	}
+	hdr, err := r.Peek(hdrLen)
+	if err != nil {
+		return false
 	}
-	return &h, payload, nil
+	payloadLen := binary.BigEndian.Uint32(hdr[28:32])
+	return uint64(n) >= uint64(hdrLen)+uint64(payloadLen)
 }
 
 func CloneToTCP(src core.IHeader) *HeaderTcp {
@@ -228,6 +473,7 @@ func CloneToTCP(src core.IHeader) *HeaderTcp {
 	}
 	if existing, ok := src.(*HeaderTcp); ok && existing != nil {
 		clone := *existing
+		clone.Path = slices.Clone(existing.Path)
 		return &clone
 	}
 	clone := &HeaderTcp{}
@@ -263,8 +509,17 @@ func CloneToTCPForForward(src core.IHeader) (*HeaderTcp, bool) {
 	return clone, true
 }
 
+// BuildTCPResponse 以 req 为模板构造回包头：源/目标对调，保留 MsgID/TraceID，HopLimit 重置，
+// 并清除 FlagExpectResponse/FlagFireAndForget，避免对端把回包当作新的请求再应答；
+// 同时清除 RouteFlagTraceRoute，回程途经的节点不会再改写回包 payload。
+// 回包是一条新的路由：途经路径从空开始、不携带 TargetDevice，否则开启环路检测时
+// 回程经过请求来时的 hub 会被当作环路丢弃。
 func BuildTCPResponse(req core.IHeader, payloadLen uint32, sub uint8) *HeaderTcp {
 	resp := CloneToTCP(req)
+	resp.Flags &^= responseModeMask
+	resp.RouteFlags &^= RouteFlagTraceRoute
+	resp.Path = nil
+	resp.TargetDevice = ""
 	resp.WithMajor(MajorOKResp).
 		WithSubProto(sub).
 		WithSourceID(req.TargetID()).
@@ -3,8 +3,11 @@ package header
 // 本文件覆盖 Core 框架中与 `header` 相关的行为。
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"testing"
 )
 
@@ -147,3 +150,280 @@ func TestHeaderTcpCodec_Decode_RejectsShortHdrLen(t *testing.T) {
 		t.Fatalf("expected ErrHeaderLenInvalid, got=%v", err)
 	}
 }
+
+func TestHeaderTcpCodec_DecodeBatch_StopsAtPartialFrame(t *testing.T) {
+	codec := HeaderTcpCodec{}
+	var stream []byte
+	for i := 1; i <= 4; i++ {
+		h := &HeaderTcp{}
+		h.WithMajor(MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2).WithMsgID(uint32(i))
+		frame, err := codec.Encode(h, bytes.Repeat([]byte{byte(i)}, i*3))
+		if err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		stream = append(stream, frame...)
+	}
+	// 第一段包含 3 个完整帧 + 第 4 帧的一半，模拟缓冲区边界上的半帧。
+	split := len(stream) - 10
+	br := bufio.NewReader(io.MultiReader(bytes.NewReader(stream[:split]), bytes.NewReader(stream[split:])))
+
+	frames, err := codec.DecodeBatch(br, 8)
+	if err != nil {
+		t.Fatalf("DecodeBatch error: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("first batch size: got=%d want=3", len(frames))
+	}
+	for i, f := range frames {
+		if f.Header.GetMsgID() != uint32(i+1) || len(f.Payload) != (i+1)*3 {
+			t.Fatalf("frame %d mismatch: msg=%d len=%d", i, f.Header.GetMsgID(), len(f.Payload))
+		}
+	}
+
+	frames, err = codec.DecodeBatch(br, 8)
+	if err != nil {
+		t.Fatalf("DecodeBatch error: %v", err)
+	}
+	if len(frames) != 1 || frames[0].Header.GetMsgID() != 4 || !bytes.Equal(frames[0].Payload, bytes.Repeat([]byte{4}, 12)) {
+		t.Fatalf("second batch mismatch: %+v", frames)
+	}
+
+	if _, err := codec.DecodeBatch(br, 8); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, got=%v", err)
+	}
+}
+
+func TestHeaderTcpCodec_DecodeBatch_RespectsMax(t *testing.T) {
+	codec := HeaderTcpCodec{}
+	var stream []byte
+	for i := 1; i <= 5; i++ {
+		h := &HeaderTcp{}
+		h.WithMajor(MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2).WithMsgID(uint32(i))
+		frame, err := codec.Encode(h, []byte("x"))
+		if err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		stream = append(stream, frame...)
+	}
+	br := bufio.NewReader(bytes.NewReader(stream))
+	frames, err := codec.DecodeBatch(br, 2)
+	if err != nil || len(frames) != 2 {
+		t.Fatalf("DecodeBatch(2): n=%d err=%v", len(frames), err)
+	}
+	frames, err = codec.DecodeBatch(br, 10)
+	if err != nil || len(frames) != 3 || frames[2].Header.GetMsgID() != 5 {
+		t.Fatalf("DecodeBatch(10): n=%d err=%v", len(frames), err)
+	}
+}
+
+func TestHeaderTcp_PriorityInRouteFlags(t *testing.T) {
+	h := (&HeaderTcp{RouteFlags: 0xF0}).WithPriority(PriorityUrgent).(*HeaderTcp)
+	if h.Priority() != PriorityUrgent || h.RouteFlags != 0xF3 {
+		t.Fatalf("priority=%d routeFlags=%#x, want 3 and 0xf3", h.Priority(), h.RouteFlags)
+	}
+	h.WithPriority(PriorityElevated)
+	if h.RouteFlags != 0xF1 {
+		t.Fatalf("routeFlags=%#x, want 0xf1 (other bits preserved)", h.RouteFlags)
+	}
+	raw, err := HeaderTcpCodec{}.Encode(h, nil)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, _, err := HeaderTcpCodec{}.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if PriorityOf(got) != PriorityElevated {
+		t.Fatalf("decoded priority=%d, want %d", PriorityOf(got), PriorityElevated)
+	}
+	if PriorityOf(nil) != PriorityNormal {
+		t.Fatalf("PriorityOf(nil) should be PriorityNormal")
+	}
+}
+
+func TestHeaderTcp_ResponseModeFlags(t *testing.T) {
+	h := (&HeaderTcp{Flags: FlagACKRequired | FlagCompressed}).WithExpectResponse(true).(*HeaderTcp)
+	if !h.WantsResponse() || h.IsFireAndForget() || h.Flags != FlagACKRequired|FlagCompressed|FlagExpectResponse {
+		t.Fatalf("flags=%#x after WithExpectResponse(true)", h.Flags)
+	}
+	h.WithFireAndForget(true)
+	if h.WantsResponse() || !IsFireAndForget(h) || h.Flags != FlagACKRequired|FlagCompressed|FlagFireAndForget {
+		t.Fatalf("flags=%#x after WithFireAndForget(true), want modes exclusive and other bits kept", h.Flags)
+	}
+	h.WithFireAndForget(false)
+	if h.Flags != FlagACKRequired|FlagCompressed {
+		t.Fatalf("flags=%#x after clearing, want %#x", h.Flags, FlagACKRequired|FlagCompressed)
+	}
+	if WantsResponse(nil) || IsFireAndForget(nil) {
+		t.Fatal("nil header reports a response mode")
+	}
+
+	req := (&HeaderTcp{Flags: FlagACKRequired}).WithExpectResponse(true).WithMajor(MajorCmd).WithSourceID(7).WithTargetID(1).WithMsgID(9)
+	raw, err := HeaderTcpCodec{}.Encode(req, nil)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, _, err := HeaderTcpCodec{}.Decode(bytes.NewReader(raw))
+	if err != nil || !WantsResponse(got) {
+		t.Fatalf("decoded flags=%#x err=%v, want FlagExpectResponse kept on the wire", got.GetFlags(), err)
+	}
+	resp := BuildTCPResponse(got, 0, got.SubProto())
+	if resp.WantsResponse() || resp.IsFireAndForget() || resp.Flags != FlagACKRequired || resp.GetMsgID() != 9 {
+		t.Fatalf("response flags=%#x msg=%d, want response-mode bits cleared", resp.Flags, resp.GetMsgID())
+	}
+}
+
+func TestHeaderTcp_VisitedPathExtensionRoundTrip(t *testing.T) {
+	h := (&HeaderTcp{}).WithMajor(MajorMsg).WithSourceID(1).WithTargetID(2)
+	for _, id := range []uint32{10, 20, 30, 40} {
+		if !AppendVisited(h, id, 3) {
+			t.Fatalf("AppendVisited(%d) rejected HeaderTcp", id)
+		}
+	}
+	raw, err := HeaderTcpCodec{}.Encode(h, []byte("hi"))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if raw[3] != headerTcpSize+2+4*3 {
+		t.Fatalf("hdr_len=%d, want %d", raw[3], headerTcpSize+2+4*3)
+	}
+	got, payload, err := HeaderTcpCodec{}.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if path := VisitedPath(got); len(path) != 3 || path[0] != 20 || path[2] != 40 {
+		t.Fatalf("path=%v, want [20 30 40] (oldest dropped)", path)
+	}
+	if string(payload) != "hi" {
+		t.Fatalf("payload=%q, want hi", payload)
+	}
+	if !PathContains(got, 30) || PathContains(got, 10) {
+		t.Fatalf("PathContains mismatch for %v", VisitedPath(got))
+	}
+	clone := got.Clone()
+	AppendVisited(clone, 50, 0)
+	if len(VisitedPath(got)) != 3 {
+		t.Fatalf("appending to clone mutated original path: %v", VisitedPath(got))
+	}
+	CloneToTCP(got).Path[0] = 99
+	if VisitedPath(got)[0] != 20 {
+		t.Fatalf("CloneToTCP shares path with original: %v", VisitedPath(got))
+	}
+	SetTargetDevice(got, "dev-1")
+	if resp := BuildTCPResponse(got, 0, got.SubProto()); len(resp.Path) != 0 || resp.TargetDevice != "" {
+		t.Fatalf("response path=%v device=%q, want both empty", resp.Path, resp.TargetDevice)
+	}
+}
+
+func TestHeaderTcp_TargetDeviceExtensionRoundTrip(t *testing.T) {
+	h := (&HeaderTcp{}).WithMajor(MajorMsg).WithSourceID(1)
+	if !SetTargetDevice(h, "dev-7") || SetTargetDevice(h, string(make([]byte, MaxTargetDeviceLen+1))) {
+		t.Fatal("SetTargetDevice length check mismatch")
+	}
+	for i := uint32(1); i <= MaxVisitedPath; i++ {
+		AppendVisited(h, i, 0)
+	}
+	raw, err := HeaderTcpCodec{}.Encode(h, nil)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	got, _, err := HeaderTcpCodec{}.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if TargetDevice(got) != "dev-7" {
+		t.Fatalf("target device=%q, want dev-7", TargetDevice(got))
+	}
+	// 设备 ID 占用扩展区后，途经路径截去最早的记录以满足 HdrLen<=255。
+	path := VisitedPath(got)
+	if len(path) >= MaxVisitedPath || path[len(path)-1] != MaxVisitedPath {
+		t.Fatalf("path len=%d last=%d, want truncated keeping newest", len(path), path[len(path)-1])
+	}
+}
+
+func TestHeaderTcpCodec_DecodeHeader_StreamedBypassesMaxPayload(t *testing.T) {
+	codec := HeaderTcpCodec{MaxPayload: 16}
+	for _, tc := range []struct {
+		flags   uint8
+		wantErr error
+	}{
+		{flags: 0, wantErr: ErrPayloadTooLarge},
+		{flags: FlagStreamed, wantErr: nil},
+	} {
+		h := &HeaderTcp{}
+		h.WithMajor(MajorMsg).WithSubProto(1).WithFlags(tc.flags)
+		head, err := (HeaderTcpCodec{}).EncodeHeader(h, 1024)
+		if err != nil {
+			t.Fatalf("encode error: %v", err)
+		}
+		got, err := codec.DecodeHeader(bytes.NewReader(head), nil)
+		if !errors.Is(err, tc.wantErr) {
+			t.Fatalf("flags=%#x err=%v, want %v", tc.flags, err, tc.wantErr)
+		}
+		if err == nil && got.PayloadLength() != 1024 {
+			t.Fatalf("PayloadLength=%d, want 1024", got.PayloadLength())
+		}
+	}
+}
+
+func TestHeaderTcpCodec_DecodeReturnsPointer(t *testing.T) {
+	codec := HeaderTcpCodec{}
+	h := &HeaderTcp{}
+	h.WithMajor(MajorCmd).WithSubProto(3).WithSourceID(1).WithTargetID(2)
+	frame, err := codec.Encode(h, []byte("x"))
+	if err != nil {
+		t.Fatalf("encode error: %v", err)
+	}
+	v1Frame, err := (HeaderTcpV1Codec{}).Encode(h, []byte("x"))
+	if err != nil {
+		t.Fatalf("encode v1 error: %v", err)
+	}
+
+	decoders := map[string]func() (any, error){
+		"Decode": func() (any, error) {
+			got, _, err := codec.Decode(bytes.NewReader(frame))
+			return got, err
+		},
+		"DecodeWith": func() (any, error) {
+			got, _, err := codec.DecodeWith(bytes.NewReader(frame), make([]byte, 255), nil)
+			return got, err
+		},
+		"DecodeHeader": func() (any, error) {
+			return codec.DecodeHeader(bytes.NewReader(frame), nil)
+		},
+		"DecodeBatch": func() (any, error) {
+			frames, err := codec.DecodeBatch(bufio.NewReader(bytes.NewReader(frame)), 4)
+			if err != nil || len(frames) != 1 {
+				return nil, fmt.Errorf("frames=%d err=%v", len(frames), err)
+			}
+			return frames[0].Header, nil
+		},
+		"V1Decode": func() (any, error) {
+			got, _, err := (HeaderTcpV1Codec{}).Decode(bytes.NewReader(v1Frame))
+			return got, err
+		},
+	}
+	for name, decode := range decoders {
+		got, err := decode()
+		if err != nil {
+			t.Fatalf("%s error: %v", name, err)
+		}
+		vh, ok := got.(*HeaderTcp)
+		if !ok || vh == nil {
+			t.Fatalf("%s returned %T, want *HeaderTcp", name, got)
+		}
+		if vh.SubProto() != 3 || vh.SourceID() != 1 || vh.TargetID() != 2 {
+			t.Fatalf("%s header mismatch: %+v", name, *vh)
+		}
+	}
+
+	// 失败路径必须返回 nil 接口，避免调用方拿到类型化的 nil 指针。
+	got, _, err := codec.Decode(bytes.NewReader([]byte{0, 0, 0, 0}))
+	if err == nil || got != nil {
+		t.Fatalf("bad frame decode: got=%#v err=%v", got, err)
+	}
+	gotHdr, err := codec.DecodeHeader(bytes.NewReader([]byte{0, 0, 0, 0}), nil)
+	if err == nil || gotHdr != nil {
+		t.Fatalf("bad frame decode header: got=%#v err=%v", gotHdr, err)
+	}
+}
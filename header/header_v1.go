@@ -0,0 +1,90 @@
+package header
+
+// 本文件承载 Core 框架中与 `header_v1` 相关的通用逻辑。
+
+import (
+	"encoding/binary"
+	"io"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// HeaderTcpV1Codec 编解码历史 HeaderTcp v1（24 字节，无 magic/ver 自描述）：
+// TypeFmt[1] Flags[1] MsgID[4] Source[4] Target[4] Timestamp[4] PayloadLen[4] Reserved[2]
+//
+// 用于网关 hub 桥接仍在发送 v1 的旧节点：
+//   - Decode 产出 *HeaderTcp（v2 内存表示），HopLimit 取 DefaultHopLimit，TraceID/RouteFlags 置 0，
+//     因此可直接交给 HeaderTcpCodec 重新编码为 v2；
+//   - Encode 接受任意 IHeader 并写出 v1 头。v2→v1 方向会丢弃 v1 中不存在的字段：
+//     HopLimit、RouteFlags、TraceID（以及 v2 扩展头区）；Reserved 固定写 0。
+//
+// TypeFmt/Flags/MsgID/Source/Target/Timestamp/PayloadLen 两个方向均无损映射。
+type HeaderTcpV1Codec struct{}
+
+const headerTcpV1Size = 24
+
+var _ core.IHeaderCodec = HeaderTcpV1Codec{}
+
+// Encode 将 header 与 payload 编码为 v1 帧 [header(24B) || payload]。
+func (HeaderTcpV1Codec) Encode(header core.IHeader, payload []byte) ([]byte, error) {
+	h := CloneToTCP(header)
+	buf := make([]byte, headerTcpV1Size+len(payload))
+	buf[0] = h.TypeFmt
+	buf[1] = h.Flags
+	binary.BigEndian.PutUint32(buf[2:6], h.MsgID)
+	binary.BigEndian.PutUint32(buf[6:10], h.Source)
+	binary.BigEndian.PutUint32(buf[10:14], h.Target)
+	binary.BigEndian.PutUint32(buf[14:18], h.Timestamp)
+	binary.BigEndian.PutUint32(buf[18:22], uint32(len(payload)))
+	// buf[22:24] 为 Reserved，保持 0。
+	copy(buf[headerTcpV1Size:], payload)
+	return buf, nil
+}
+
+// Decode 从 reader 读取一帧 v1 数据，并以 v2 的 HeaderTcp 表示返回。
+func (HeaderTcpV1Codec) Decode(r io.Reader) (core.IHeader, []byte, error) {
+	hdr := make([]byte, headerTcpV1Size)
+	if _, err := io.ReadFull(r, hdr); err != nil {
+		return nil, nil, err
+	}
+	h := HeaderTcp{
+		Magic:      HeaderTcpMagicV2,
+		Ver:        HeaderTcpVersionV2,
+		HdrLen:     headerTcpSize,
+		TypeFmt:    hdr[0],
+		Flags:      hdr[1],
+		HopLimit:   DefaultHopLimit,
+		MsgID:      binary.BigEndian.Uint32(hdr[2:6]),
+		Source:     binary.BigEndian.Uint32(hdr[6:10]),
+		Target:     binary.BigEndian.Uint32(hdr[10:14]),
+		Timestamp:  binary.BigEndian.Uint32(hdr[14:18]),
+		PayloadLen: binary.BigEndian.Uint32(hdr[18:22]),
+	}
+	if h.PayloadLen == 0 {
+		return &h, nil, nil
+	}
+	payload := make([]byte, h.PayloadLen)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+	return &h, payload, nil
+}
+
+// TranslateV1ToV2 从 r 读取一帧 v1 数据并重新编码为 v2 帧。
+func TranslateV1ToV2(r io.Reader) ([]byte, error) {
+	return translateFrame(r, HeaderTcpV1Codec{}, HeaderTcpCodec{})
+}
+
+// TranslateV2ToV1 从 r 读取一帧 v2 数据并重新编码为 v1 帧（HopLimit/RouteFlags/TraceID 被丢弃）。
+func TranslateV2ToV1(r io.Reader) ([]byte, error) {
+	return translateFrame(r, HeaderTcpCodec{}, HeaderTcpV1Codec{})
+}
+
+// translateFrame 用 from 解出一帧、再用 to 编码，payload 原样透传。
+func translateFrame(r io.Reader, from, to core.IHeaderCodec) ([]byte, error) {
+	hdr, payload, err := from.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	return to.Encode(hdr, payload)
+}
@@ -0,0 +1,103 @@
+package header
+
+// 本文件覆盖 Core 框架中与 `header_v1` 相关的行为。
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTranslateV1ToV2_RoundTrip(t *testing.T) {
+	src := &HeaderTcp{}
+	src.WithMajor(MajorCmd).
+		WithSubProto(2).
+		WithFlags(FlagACKRequired | FlagCompressed).
+		WithMsgID(0xDEADBEEF).
+		WithSourceID(11).
+		WithTargetID(22).
+		WithTimestamp(1700000002)
+	payload := []byte("legacy")
+
+	v1, err := (HeaderTcpV1Codec{}).Encode(src, payload)
+	if err != nil {
+		t.Fatalf("encode v1: %v", err)
+	}
+	if got, want := len(v1), headerTcpV1Size+len(payload); got != want {
+		t.Fatalf("v1 length mismatch: got=%d want=%d", got, want)
+	}
+
+	v2, err := TranslateV1ToV2(bytes.NewReader(v1))
+	if err != nil {
+		t.Fatalf("translate v1->v2: %v", err)
+	}
+	gotH, gotPayload, err := (HeaderTcpCodec{}).Decode(bytes.NewReader(v2))
+	if err != nil {
+		t.Fatalf("decode v2: %v", err)
+	}
+	h := gotH.(*HeaderTcp)
+	if h.TypeFmt != src.TypeFmt || h.Flags != src.Flags || h.MsgID != src.MsgID ||
+		h.Source != src.Source || h.Target != src.Target || h.Timestamp != src.Timestamp {
+		t.Fatalf("overlapping fields mismatch: got=%+v want=%+v", *h, *src)
+	}
+	if h.HopLimit != DefaultHopLimit || h.TraceID != 0 || h.RouteFlags != 0 {
+		t.Fatalf("v2-only fields: hop=%d trace=%d route=%d", h.HopLimit, h.TraceID, h.RouteFlags)
+	}
+	if !bytes.Equal(gotPayload, payload) || h.PayloadLen != uint32(len(payload)) {
+		t.Fatalf("payload mismatch: got=%q len=%d", gotPayload, h.PayloadLen)
+	}
+
+	back, err := TranslateV2ToV1(bytes.NewReader(v2))
+	if err != nil {
+		t.Fatalf("translate v2->v1: %v", err)
+	}
+	if !bytes.Equal(back, v1) {
+		t.Fatalf("v1 round trip mismatch:\n got=%x\nwant=%x", back, v1)
+	}
+}
+
+func TestTranslateV2ToV1_DropsV2OnlyFields(t *testing.T) {
+	src := &HeaderTcp{}
+	src.WithMajor(MajorMsg).
+		WithSubProto(9).
+		WithFlags(FlagACKRequired).
+		WithHopLimit(3).
+		WithRouteFlags(0x5A).
+		WithMsgID(7).
+		WithSourceID(0x01020304).
+		WithTargetID(0x0A0B0C0D).
+		WithTraceID(0x11223344).
+		WithTimestamp(1700000003)
+	payload := []byte("hello v1")
+
+	v2, err := (HeaderTcpCodec{}).Encode(src, payload)
+	if err != nil {
+		t.Fatalf("encode v2: %v", err)
+	}
+	v1, err := TranslateV2ToV1(bytes.NewReader(v2))
+	if err != nil {
+		t.Fatalf("translate v2->v1: %v", err)
+	}
+	if got, want := len(v1), headerTcpV1Size+len(payload); got != want {
+		t.Fatalf("v1 length mismatch: got=%d want=%d", got, want)
+	}
+
+	again, err := TranslateV1ToV2(bytes.NewReader(v1))
+	if err != nil {
+		t.Fatalf("translate v1->v2: %v", err)
+	}
+	gotH, gotPayload, err := (HeaderTcpCodec{}).Decode(bytes.NewReader(again))
+	if err != nil {
+		t.Fatalf("decode v2: %v", err)
+	}
+	h := gotH.(*HeaderTcp)
+	if h.Major() != MajorMsg || h.SubProto() != 9 || h.Flags != FlagACKRequired || h.MsgID != 7 ||
+		h.Source != 0x01020304 || h.Target != 0x0A0B0C0D || h.Timestamp != 1700000003 {
+		t.Fatalf("overlapping fields mismatch: %+v", *h)
+	}
+	if h.HopLimit != DefaultHopLimit || h.RouteFlags != 0 || h.TraceID != 0 {
+		t.Fatalf("expected v2-only fields reset, got hop=%d route=0x%X trace=0x%X", h.HopLimit, h.RouteFlags, h.TraceID)
+	}
+	if !bytes.Equal(gotPayload, payload) {
+		t.Fatalf("payload mismatch: got=%q want=%q", gotPayload, payload)
+	}
+}
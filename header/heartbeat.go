@@ -0,0 +1,65 @@
+package header
+
+// 本文件承载 Core 框架中与 `heartbeat` 相关的通用逻辑。
+
+import (
+	"bytes"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// 心跳帧：读取循环空闲超时前向对端发送 ping，对端读取循环直接回 pong，不进入业务处理。
+//
+// 以控制帧承载（Major=Cmd、SubProto=配置的心跳子协议、Source/Target=0），
+// payload 为 "MFHP"（ping）或 "MFHO"（pong）。双方需配置相同的心跳子协议号。
+
+// MetaLastPongKey 连接元数据中记录最近一次收到 pong 的时间（time.Time），由读取循环写入。
+const MetaLastPongKey = "lastPong"
+
+var (
+	pingMagic = []byte("MFHP")
+	pongMagic = []byte("MFHO")
+)
+
+// NewPingFrame 构造一帧心跳 ping。
+func NewPingFrame(subProto uint8) (core.IHeader, []byte) {
+	return (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(subProto), append([]byte(nil), pingMagic...)
+}
+
+// NewPongFrame 构造一帧心跳 pong。
+func NewPongFrame(subProto uint8) (core.IHeader, []byte) {
+	return (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(subProto), append([]byte(nil), pongMagic...)
+}
+
+// ParseHeartbeat 判断一帧是否为 subProto 上的心跳帧；ok 为 true 时 ping 区分 ping/pong。
+func ParseHeartbeat(hdr core.IHeader, payload []byte, subProto uint8) (ping, ok bool) {
+	if hdr == nil || subProto == 0 || hdr.Major() != MajorCmd || hdr.SubProto() != subProto || hdr.SourceID() != 0 {
+		return false, false
+	}
+	switch {
+	case bytes.Equal(payload, pingMagic):
+		return true, true
+	case bytes.Equal(payload, pongMagic):
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+// MarkPong 记录连接刚收到一帧 pong。
+func MarkPong(conn core.IConnection) {
+	if conn != nil {
+		conn.SetMeta(MetaLastPongKey, time.Now())
+	}
+}
+
+// LastPong 返回连接最近一次收到 pong 的时间，从未收到时为零值。
+func LastPong(conn core.IConnection) time.Time {
+	if conn == nil {
+		return time.Time{}
+	}
+	v, _ := conn.GetMeta(MetaLastPongKey)
+	t, _ := v.(time.Time)
+	return t
+}
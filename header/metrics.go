@@ -0,0 +1,179 @@
+package header
+
+// 本文件承载 Core 框架中与 `metrics` 相关的通用逻辑。
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+)
+
+// CodecErrKind 是编解码错误的分类，供协议健康度面板按类型计数。
+type CodecErrKind uint8
+
+const (
+	CodecErrNone            CodecErrKind = iota
+	CodecErrMagic                        // 魔数不匹配
+	CodecErrVersion                      // 版本号非法
+	CodecErrLen                          // 头长度非法或头过大
+	CodecErrPayloadTooLarge              // payload 超过 codec 的 MaxPayload
+	CodecErrIO                           // 帧中途读取失败（截断、超时等）
+	CodecErrOther
+	codecErrKinds
+)
+
+// String 返回分类在指标标签中的名字。
+func (k CodecErrKind) String() string {
+	switch k {
+	case CodecErrNone:
+		return "none"
+	case CodecErrMagic:
+		return "magic"
+	case CodecErrVersion:
+		return "version"
+	case CodecErrLen:
+		return "len"
+	case CodecErrPayloadTooLarge:
+		return "payload_too_large"
+	case CodecErrIO:
+		return "io"
+	default:
+		return "other"
+	}
+}
+
+// ClassifyCodecErr 把编解码返回的错误归入 CodecErrKind。
+func ClassifyCodecErr(err error) CodecErrKind {
+	switch {
+	case err == nil:
+		return CodecErrNone
+	case errors.Is(err, ErrHeaderMagicMismatch):
+		return CodecErrMagic
+	case errors.Is(err, ErrHeaderVersionInvalid):
+		return CodecErrVersion
+	case errors.Is(err, ErrHeaderLenInvalid), errors.Is(err, ErrHeaderTooLarge):
+		return CodecErrLen
+	case errors.Is(err, ErrPayloadTooLarge):
+		return CodecErrPayloadTooLarge
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return CodecErrIO
+	default:
+		var ne interface{ Timeout() bool }
+		if errors.As(err, &ne) {
+			return CodecErrIO
+		}
+		return CodecErrOther
+	}
+}
+
+// CodecMetrics 接收编解码观测；size 为完整帧字节数（失败时为 0）。
+// 实现会在读写热路径上被同步调用，必须并发安全且足够轻量。
+type CodecMetrics interface {
+	ObserveEncode(size int, kind CodecErrKind)
+	ObserveDecode(size int, kind CodecErrKind)
+}
+
+type noopCodecMetrics struct{}
+
+func (noopCodecMetrics) ObserveEncode(int, CodecErrKind) {}
+func (noopCodecMetrics) ObserveDecode(int, CodecErrKind) {}
+
+type codecMetricsHolder struct{ m CodecMetrics }
+
+var codecMetrics atomic.Pointer[codecMetricsHolder]
+
+func init() { codecMetrics.Store(&codecMetricsHolder{m: noopCodecMetrics{}}) }
+
+// SetCodecMetrics 为本包的 codec 安装全局观测钩子；传 nil 恢复为空操作。
+func SetCodecMetrics(m CodecMetrics) {
+	if m == nil {
+		m = noopCodecMetrics{}
+	}
+	codecMetrics.Store(&codecMetricsHolder{m: m})
+}
+
+func observeEncode(size int, err error) {
+	codecMetrics.Load().m.ObserveEncode(size, ClassifyCodecErr(err))
+}
+
+// observeDecode 上报一次解码；帧边界上的 io.EOF 是对端正常关闭，不计入。
+func observeDecode(size int, err error) {
+	if err == io.EOF {
+		return
+	}
+	codecMetrics.Load().m.ObserveDecode(size, ClassifyCodecErr(err))
+}
+
+var codecSizeBuckets = [...]int{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
+// CodecSizeBuckets 返回 CodecStats 帧大小直方图的桶上界（字节，含），最后一个桶之外计入 +Inf。
+func CodecSizeBuckets() []int { return append([]int(nil), codecSizeBuckets[:]...) }
+
+// CodecStats 是 CodecMetrics 的内存实现：按方向统计调用次数、各类错误次数与成功帧的大小分布。
+type CodecStats struct {
+	encode codecDirStats
+	decode codecDirStats
+}
+
+type codecDirStats struct {
+	calls   atomic.Uint64
+	errs    [codecErrKinds]atomic.Uint64
+	buckets [len(codecSizeBuckets) + 1]atomic.Uint64
+	bytes   atomic.Uint64
+}
+
+// CodecDirSnapshot 为单一方向的统计快照。
+type CodecDirSnapshot struct {
+	Calls   uint64            `json:"calls"`
+	Bytes   uint64            `json:"bytes"`
+	Errors  map[string]uint64 `json:"errors"`
+	Buckets []uint64          `json:"buckets"` // 与 CodecSizeBuckets 对齐，末位为 +Inf
+}
+
+// CodecStatsSnapshot 为 CodecStats 的只读拷贝。
+type CodecStatsSnapshot struct {
+	Encode CodecDirSnapshot `json:"encode"`
+	Decode CodecDirSnapshot `json:"decode"`
+}
+
+var _ CodecMetrics = (*CodecStats)(nil)
+
+func (s *CodecStats) ObserveEncode(size int, kind CodecErrKind) { s.encode.observe(size, kind) }
+func (s *CodecStats) ObserveDecode(size int, kind CodecErrKind) { s.decode.observe(size, kind) }
+
+// Snapshot 返回当前计数；各计数独立读取，并发写入时不保证彼此严格一致。
+func (s *CodecStats) Snapshot() CodecStatsSnapshot {
+	return CodecStatsSnapshot{Encode: s.encode.snapshot(), Decode: s.decode.snapshot()}
+}
+
+func (d *codecDirStats) observe(size int, kind CodecErrKind) {
+	d.calls.Add(1)
+	if kind != CodecErrNone {
+		d.errs[kind].Add(1)
+		return
+	}
+	d.bytes.Add(uint64(size))
+	i := 0
+	for i < len(codecSizeBuckets) && size > codecSizeBuckets[i] {
+		i++
+	}
+	d.buckets[i].Add(1)
+}
+
+func (d *codecDirStats) snapshot() CodecDirSnapshot {
+	out := CodecDirSnapshot{
+		Calls:   d.calls.Load(),
+		Bytes:   d.bytes.Load(),
+		Errors:  make(map[string]uint64),
+		Buckets: make([]uint64, len(d.buckets)),
+	}
+	for k := CodecErrKind(1); k < codecErrKinds; k++ {
+		if v := d.errs[k].Load(); v > 0 {
+			out.Errors[k.String()] = v
+		}
+	}
+	for i := range d.buckets {
+		out.Buckets[i] = d.buckets[i].Load()
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package header
+
+// 本文件覆盖 Core 框架中与 `metrics` 相关的行为。
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// recordingMetrics 记录每次观测，供断言上报内容。
+type recordingMetrics struct {
+	mu      sync.Mutex
+	encodes []int
+	decodes []int
+	errs    map[CodecErrKind]int
+}
+
+func (r *recordingMetrics) ObserveEncode(size int, kind CodecErrKind) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.encodes = append(r.encodes, size)
+	r.errs[kind]++
+}
+
+func (r *recordingMetrics) ObserveDecode(size int, kind CodecErrKind) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decodes = append(r.decodes, size)
+	r.errs[kind]++
+}
+
+func installRecording(t *testing.T) *recordingMetrics {
+	t.Helper()
+	rec := &recordingMetrics{errs: make(map[CodecErrKind]int)}
+	SetCodecMetrics(rec)
+	t.Cleanup(func() { SetCodecMetrics(nil) })
+	return rec
+}
+
+func TestCodecMetrics_BadMagicDecodeCountsMagicError(t *testing.T) {
+	rec := installRecording(t)
+	codec := HeaderTcpCodec{}
+	frame, err := codec.Encode((&HeaderTcp{}).WithMajor(MajorMsg).WithSubProto(1), []byte("abc"))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if len(rec.encodes) != 1 || rec.encodes[0] != len(frame) {
+		t.Fatalf("encode observations=%v, want [%d]", rec.encodes, len(frame))
+	}
+	if _, _, err := codec.Decode(bytes.NewReader(frame)); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	frame[0] = 0
+	if _, _, err := codec.Decode(bytes.NewReader(frame)); !errors.Is(err, ErrHeaderMagicMismatch) {
+		t.Fatalf("decode err=%v, want magic mismatch", err)
+	}
+	if rec.errs[CodecErrMagic] != 1 {
+		t.Fatalf("magic errors=%d, want 1", rec.errs[CodecErrMagic])
+	}
+	if len(rec.decodes) != 2 || rec.decodes[0] != len(frame) || rec.decodes[1] != 0 {
+		t.Fatalf("decode observations=%v, want [%d 0]", rec.decodes, len(frame))
+	}
+	// 帧边界上的 EOF 属于正常关闭，不计入。
+	if _, _, err := codec.Decode(bytes.NewReader(nil)); err == nil {
+		t.Fatalf("decode of empty stream succeeded")
+	}
+	if len(rec.decodes) != 2 {
+		t.Fatalf("clean EOF was observed: %v", rec.decodes)
+	}
+}
+
+func TestCodecMetrics_PayloadTooLarge(t *testing.T) {
+	rec := installRecording(t)
+	big, err := HeaderTcpCodec{}.Encode(&HeaderTcp{}, bytes.Repeat([]byte{1}, 64))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	limited := HeaderTcpCodec{MaxPayload: 16}
+	if _, err := limited.Encode(&HeaderTcp{}, bytes.Repeat([]byte{1}, 64)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("encode err=%v, want ErrPayloadTooLarge", err)
+	}
+	if _, _, err := limited.Decode(bytes.NewReader(big)); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Fatalf("decode err=%v, want ErrPayloadTooLarge", err)
+	}
+	if rec.errs[CodecErrPayloadTooLarge] != 2 {
+		t.Fatalf("payload_too_large errors=%d, want 2", rec.errs[CodecErrPayloadTooLarge])
+	}
+}
+
+func TestCodecStats_SnapshotCountsAndBuckets(t *testing.T) {
+	stats := &CodecStats{}
+	SetCodecMetrics(stats)
+	t.Cleanup(func() { SetCodecMetrics(nil) })
+
+	codec := HeaderTcpCodec{}
+	small, _ := codec.Encode(&HeaderTcp{}, []byte("x"))
+	large, _ := codec.Encode(&HeaderTcp{}, bytes.Repeat([]byte{1}, 2000))
+	_, _, _ = codec.Decode(bytes.NewReader(small))
+	_, _, _ = codec.Decode(bytes.NewReader(large[:100]))
+
+	snap := stats.Snapshot()
+	if snap.Encode.Calls != 2 || snap.Encode.Bytes != uint64(len(small)+len(large)) {
+		t.Fatalf("encode snapshot=%+v", snap.Encode)
+	}
+	// small 落在 <=64 桶，large 落在 <=4K 桶。
+	if snap.Encode.Buckets[0] != 1 || snap.Encode.Buckets[3] != 1 {
+		t.Fatalf("encode buckets=%v", snap.Encode.Buckets)
+	}
+	if snap.Decode.Calls != 2 || snap.Decode.Errors["io"] != 1 {
+		t.Fatalf("decode snapshot=%+v", snap.Decode)
+	}
+}
@@ -0,0 +1,162 @@
+package header
+
+// 本文件承载 Core 框架中与 `negotiate` 相关的通用逻辑。
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// 头版本协商：连接建立后双方各发一帧“版本报价”，取双方都支持的最高版本。
+//
+// 报价帧本身始终以 v2 帧承载（Major=Cmd、SubProto=0、Source/Target=0），
+// payload 为 "MFHV" + count[1] + versions[count]。未实现协商的 v2 节点会把它当作
+// source=0 的非认证帧在预路由阶段丢弃，因此不会破坏既有链路；发起方收不到应答时回退 v2。
+const (
+	// HeaderTcpVersionV1 为历史 24 字节头版本号（v1 头本身不携带该字段）。
+	HeaderTcpVersionV1 uint8 = 1
+
+	// MetaHeaderVersionKey 连接元数据中记录协商结果的键（值为 uint8）。
+	MetaHeaderVersionKey = "headerVersion"
+)
+
+var versionOfferMagic = []byte("MFHV")
+
+var (
+	ErrNotVersionOffer    = errors.New("frame is not a header version offer")
+	ErrNoCommonVersion    = errors.New("no common header version")
+	ErrVersionOfferFormat = errors.New("header version offer malformed")
+	// ErrOfferReplyTruncated 表示读取对端首帧时只读到一部分（如超时落在帧中间），
+	// 流已失去帧边界，不能再回退 v2 继续使用该连接。
+	ErrOfferReplyTruncated = errors.New("header version offer reply truncated")
+)
+
+// SupportedVersions 返回本实现可编解码的头版本（降序）。
+func SupportedVersions() []uint8 {
+	return []uint8{HeaderTcpVersionV2, HeaderTcpVersionV1}
+}
+
+// CodecForVersion 返回指定头版本对应的 codec；未知版本返回 nil。
+func CodecForVersion(ver uint8) core.IHeaderCodec {
+	switch ver {
+	case HeaderTcpVersionV2:
+		return HeaderTcpCodec{}
+	case HeaderTcpVersionV1:
+		return HeaderTcpV1Codec{}
+	default:
+		return nil
+	}
+}
+
+// EncodeVersionOffer 把本端支持的版本列表编码为一帧 v2 报价帧。
+func EncodeVersionOffer(versions []uint8) ([]byte, error) {
+	if len(versions) == 0 || len(versions) > 255 {
+		return nil, ErrVersionOfferFormat
+	}
+	payload := make([]byte, 0, len(versionOfferMagic)+1+len(versions))
+	payload = append(payload, versionOfferMagic...)
+	payload = append(payload, byte(len(versions)))
+	payload = append(payload, versions...)
+	hdr := (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(0)
+	return HeaderTcpCodec{}.Encode(hdr, payload)
+}
+
+// ParseVersionOffer 判断一帧是否为版本报价，并解析出对端支持的版本列表。
+func ParseVersionOffer(hdr core.IHeader, payload []byte) ([]uint8, error) {
+	if hdr == nil || hdr.Major() != MajorCmd || hdr.SubProto() != 0 || hdr.SourceID() != 0 {
+		return nil, ErrNotVersionOffer
+	}
+	if !bytes.HasPrefix(payload, versionOfferMagic) {
+		return nil, ErrNotVersionOffer
+	}
+	rest := payload[len(versionOfferMagic):]
+	if len(rest) < 1 || len(rest[1:]) != int(rest[0]) || rest[0] == 0 {
+		return nil, ErrVersionOfferFormat
+	}
+	return append([]uint8(nil), rest[1:]...), nil
+}
+
+// SelectVersion 返回双方都支持的最高版本。
+func SelectVersion(local, remote []uint8) (uint8, bool) {
+	common := make([]uint8, 0, len(local))
+	for _, l := range local {
+		for _, r := range remote {
+			if l == r {
+				common = append(common, l)
+				break
+			}
+		}
+	}
+	if len(common) == 0 {
+		return 0, false
+	}
+	sort.Slice(common, func(i, j int) bool { return common[i] > common[j] })
+	return common[0], true
+}
+
+// OfferVersions 发起方流程：写出本端报价，读取对端报价并选出共同最高版本。
+// 读取到的首帧若不是报价（对端未实现协商），返回 ErrNotVersionOffer 及该帧，调用方应回退 v2 并照常分发它；
+// 一字节都未读到就失败（如超时）时原样返回读取错误，同样可回退；已读到部分字节后失败则返回 ErrOfferReplyTruncated。
+// 超时控制由调用方在 rw 上设置 deadline。
+func OfferVersions(rw io.ReadWriter, local []uint8) (uint8, core.IHeader, []byte, error) {
+	offer, err := EncodeVersionOffer(local)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	if err := core.WriteAll(rw, offer); err != nil {
+		return 0, nil, nil, err
+	}
+	cr := &countingReader{r: rw}
+	hdr, payload, err := HeaderTcpCodec{}.Decode(cr)
+	if err != nil {
+		if cr.n > 0 {
+			return 0, nil, nil, fmt.Errorf("%w: %v", ErrOfferReplyTruncated, err)
+		}
+		return 0, nil, nil, err
+	}
+	remote, err := ParseVersionOffer(hdr, payload)
+	if errors.Is(err, ErrNotVersionOffer) {
+		return 0, hdr, payload, err
+	}
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	ver, ok := SelectVersion(local, remote)
+	if !ok {
+		return 0, nil, nil, ErrNoCommonVersion
+	}
+	return ver, nil, nil, nil
+}
+
+// countingReader 记录已读字节数，用于区分“对端沉默”与“读到半帧”。
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+// AnswerVersionOffer 应答方流程：根据已读到的对端报价选出版本，并回写仅含该版本的报价。
+func AnswerVersionOffer(w io.Writer, local, remote []uint8) (uint8, error) {
+	ver, ok := SelectVersion(local, remote)
+	if !ok {
+		return 0, ErrNoCommonVersion
+	}
+	reply, err := EncodeVersionOffer([]uint8{ver})
+	if err != nil {
+		return 0, err
+	}
+	if err := core.WriteAll(w, reply); err != nil {
+		return 0, err
+	}
+	return ver, nil
+}
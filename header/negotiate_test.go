@@ -0,0 +1,147 @@
+package header
+
+// 本文件覆盖 Core 框架中与 `negotiate` 相关的行为。
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSelectVersion_HighestCommon(t *testing.T) {
+	cases := []struct {
+		local, remote []uint8
+		want          uint8
+		ok            bool
+	}{
+		{[]uint8{2, 1}, []uint8{1, 2}, 2, true},
+		{[]uint8{2, 1}, []uint8{1}, 1, true},
+		{[]uint8{1, 2}, []uint8{2}, 2, true},
+		{[]uint8{2}, []uint8{1}, 0, false},
+	}
+	for _, tc := range cases {
+		got, ok := SelectVersion(tc.local, tc.remote)
+		if got != tc.want || ok != tc.ok {
+			t.Fatalf("SelectVersion(%v,%v)=(%d,%v), want (%d,%v)", tc.local, tc.remote, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestOfferVersions_V1OnlyPeerSelectsV1Codec(t *testing.T) {
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+
+	peerErr := make(chan error, 1)
+	go func() {
+		hdr, payload, err := HeaderTcpCodec{}.Decode(peer)
+		if err != nil {
+			peerErr <- err
+			return
+		}
+		remote, err := ParseVersionOffer(hdr, payload)
+		if err != nil {
+			peerErr <- err
+			return
+		}
+		_, err = AnswerVersionOffer(peer, []uint8{HeaderTcpVersionV1}, remote)
+		peerErr <- err
+	}()
+
+	ver, _, _, err := OfferVersions(local, SupportedVersions())
+	if err != nil {
+		t.Fatalf("OfferVersions: %v", err)
+	}
+	if err := <-peerErr; err != nil {
+		t.Fatalf("peer: %v", err)
+	}
+	if ver != HeaderTcpVersionV1 {
+		t.Fatalf("selected version=%d, want %d", ver, HeaderTcpVersionV1)
+	}
+	if _, ok := CodecForVersion(ver).(HeaderTcpV1Codec); !ok {
+		t.Fatalf("codec for v%d = %T, want HeaderTcpV1Codec", ver, CodecForVersion(ver))
+	}
+}
+
+func TestOfferVersions_LegacyPeerFirstFrameReturned(t *testing.T) {
+	local, peer := net.Pipe()
+	defer local.Close()
+	defer peer.Close()
+
+	go func() {
+		if _, _, err := (HeaderTcpCodec{}).Decode(peer); err != nil {
+			return
+		}
+		frame, _ := HeaderTcpCodec{}.Encode((&HeaderTcp{}).WithMajor(MajorMsg).WithSourceID(3).WithMsgID(8), []byte("hi"))
+		_, _ = peer.Write(frame)
+	}()
+	_, hdr, payload, err := OfferVersions(local, SupportedVersions())
+	if !errors.Is(err, ErrNotVersionOffer) {
+		t.Fatalf("err=%v, want ErrNotVersionOffer", err)
+	}
+	if hdr == nil || hdr.GetMsgID() != 8 || string(payload) != "hi" {
+		t.Fatalf("returned frame=%v/%q, want msg 8 with payload hi", hdr, payload)
+	}
+}
+
+func TestOfferVersions_PartialReplyIsFatal(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		partial   bool
+		truncated bool
+	}{
+		{name: "silent_peer", partial: false, truncated: false},
+		{name: "half_header", partial: true, truncated: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			local, peer := net.Pipe()
+			defer local.Close()
+			defer peer.Close()
+			go func() {
+				if _, _, err := (HeaderTcpCodec{}).Decode(peer); err != nil || !tc.partial {
+					return
+				}
+				_, _ = peer.Write([]byte{0x02, 0x00, 0x00})
+			}()
+			_ = local.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+			_, hdr, _, err := OfferVersions(local, SupportedVersions())
+			if err == nil || hdr != nil {
+				t.Fatalf("OfferVersions err=%v hdr=%v, want read error and no frame", err, hdr)
+			}
+			if got := errors.Is(err, ErrOfferReplyTruncated); got != tc.truncated {
+				t.Fatalf("truncated=%v (err=%v), want %v", got, err, tc.truncated)
+			}
+		})
+	}
+}
+
+func TestParseVersionOffer_RejectsRegularFrame(t *testing.T) {
+	hdr := (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(0).WithSourceID(5)
+	if _, err := ParseVersionOffer(hdr, []byte("MFHV\x01\x02")); !errors.Is(err, ErrNotVersionOffer) {
+		t.Fatalf("expected ErrNotVersionOffer for non-zero source, got %v", err)
+	}
+	hdr = (&HeaderTcp{}).WithMajor(MajorCmd).WithSubProto(0)
+	if _, err := ParseVersionOffer(hdr, []byte("MFHV\x02\x02")); !errors.Is(err, ErrVersionOfferFormat) {
+		t.Fatalf("expected ErrVersionOfferFormat for truncated list, got %v", err)
+	}
+}
+
+func TestByeFrameRoundTrip(t *testing.T) {
+	hdr, payload := NewByeFrame("maintenance")
+	frame, err := HeaderTcpCodec{}.Encode(hdr, payload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	gotHdr, gotPayload, err := HeaderTcpCodec{}.Decode(bytes.NewReader(frame))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if reason, ok := ParseBye(gotHdr, gotPayload); !ok || reason != "maintenance" {
+		t.Fatalf("ParseBye=%q,%v", reason, ok)
+	}
+	if _, ok := ParseBye(gotHdr, []byte("MFHV\x01\x02")); ok {
+		t.Fatalf("version offer parsed as bye")
+	}
+}
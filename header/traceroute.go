@@ -0,0 +1,55 @@
+package header
+
+// 本文件承载 Core 框架中与 `traceroute` 相关的通用逻辑。
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// 路由探测帧（RouteFlagTraceRoute）的 payload 为若干条途经记录的顺序拼接，每条 TraceHopSize 字节：
+// NodeID[4] UnixMilli[8]，均为大端。发起方发出空 payload，转发节点在转发前追加自身记录，
+// 目标节点的处理器追加最后一条后把完整记录作为回包返回（见 kit/handlers.TraceRouteHandler）。
+
+// TraceHopSize 为单条途经记录的字节数。
+const TraceHopSize = 12
+
+// ErrBadTracePayload 表示 payload 长度不是 TraceHopSize 的整数倍。
+var ErrBadTracePayload = errors.New("header: bad traceroute payload")
+
+// TraceHop 是一条途经记录。
+type TraceHop struct {
+	NodeID uint32
+	At     time.Time
+}
+
+// IsTraceRoute 判断帧是否带 RouteFlagTraceRoute；nil 视为 false。
+func IsTraceRoute(h core.IHeader) bool {
+	return h != nil && h.GetRouteFlags()&RouteFlagTraceRoute != 0
+}
+
+// AppendTraceHop 返回在 payload 之后追加一条记录的新切片；payload 可能被多处共享，因此从不原地扩展。
+func AppendTraceHop(payload []byte, nodeID uint32, at time.Time) []byte {
+	out := make([]byte, len(payload), len(payload)+TraceHopSize)
+	copy(out, payload)
+	out = binary.BigEndian.AppendUint32(out, nodeID)
+	return binary.BigEndian.AppendUint64(out, uint64(at.UnixMilli()))
+}
+
+// ParseTraceHops 按顺序解析 payload 中的途经记录。
+func ParseTraceHops(payload []byte) ([]TraceHop, error) {
+	if len(payload)%TraceHopSize != 0 {
+		return nil, ErrBadTracePayload
+	}
+	hops := make([]TraceHop, 0, len(payload)/TraceHopSize)
+	for b := payload; len(b) > 0; b = b[TraceHopSize:] {
+		hops = append(hops, TraceHop{
+			NodeID: binary.BigEndian.Uint32(b[0:4]),
+			At:     time.UnixMilli(int64(binary.BigEndian.Uint64(b[4:12]))),
+		})
+	}
+	return hops, nil
+}
@@ -0,0 +1,49 @@
+package header
+
+// 本文件覆盖 Core 框架中与 `traceroute` 相关的行为。
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTraceHopsAppendAndParse(t *testing.T) {
+	at := time.UnixMilli(1_700_000_000_123)
+	first := AppendTraceHop(nil, 1, at)
+	both := AppendTraceHop(first[:len(first):len(first)], 2, at.Add(time.Second))
+	if len(first) != TraceHopSize || len(both) != 2*TraceHopSize {
+		t.Fatalf("lens first=%d both=%d", len(first), len(both))
+	}
+	hops, err := ParseTraceHops(both)
+	if err != nil {
+		t.Fatalf("ParseTraceHops: %v", err)
+	}
+	want := []TraceHop{{NodeID: 1, At: at}, {NodeID: 2, At: at.Add(time.Second)}}
+	if len(hops) != 2 || hops[0].NodeID != want[0].NodeID || !hops[0].At.Equal(want[0].At) ||
+		hops[1].NodeID != want[1].NodeID || !hops[1].At.Equal(want[1].At) {
+		t.Fatalf("hops=%+v, want %+v", hops, want)
+	}
+
+	// 追加从不写入调用方的底层数组。
+	shared := make([]byte, 0, 64)
+	shared = append(shared, first...)
+	_ = AppendTraceHop(shared, 9, at)
+	if got := shared[:cap(shared)][TraceHopSize]; got != 0 {
+		t.Fatalf("AppendTraceHop wrote into caller's spare capacity")
+	}
+	if _, err := ParseTraceHops(both[:TraceHopSize+1]); !errors.Is(err, ErrBadTracePayload) {
+		t.Fatalf("truncated payload err=%v, want ErrBadTracePayload", err)
+	}
+}
+
+func TestBuildTCPResponseClearsTraceRoute(t *testing.T) {
+	req := (&HeaderTcp{}).WithRouteFlags(RouteFlagTraceRoute | PriorityHigh).WithMajor(MajorMsg).WithSourceID(7).WithTargetID(2)
+	if !IsTraceRoute(req) || IsTraceRoute(nil) {
+		t.Fatal("IsTraceRoute mismatch")
+	}
+	resp := BuildTCPResponse(req, 0, req.SubProto())
+	if IsTraceRoute(resp) || resp.Priority() != PriorityHigh {
+		t.Fatalf("response route flags=%#x, want trace bit cleared and priority kept", resp.RouteFlags)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"io"
 	"net"
+	"time"
 
 	"github.com/yttydcs/myflowhub-core/eventbus"
 )
@@ -90,12 +91,19 @@ type IProcess interface {
 	OnListen(conn IConnection)
 	// OnReceive 在收到一帧数据后触发
 	OnReceive(ctx context.Context, conn IConnection, hdr IHeader, payload []byte)
-	// OnSend 在发送一帧数据前触发，可用于审计/修改
+	// OnSend 在发送一帧数据前按连接逐帧触发，可用于审计或改写 hdr（如 SourceID/TraceID），改写结果即为实际编码写出的内容；
+	// 返回错误时该连接上的这一帧不发送。Broadcast 为每条连接传入独立的 hdr 克隆；ctx 带 WithSendAudited 标记时跳过。
 	OnSend(ctx context.Context, conn IConnection, hdr IHeader, payload []byte) error
 	// OnClose 在连接移除/关闭后触发
 	OnClose(conn IConnection)
 }
 
+// ISyncPayloadProcess 为 IProcess 的可选能力：声明 OnReceive 返回前已用完 payload（不排队、不经异步发送队列转发）。
+// 未实现时服务端视其为异步消费者，开启 reader.payload_pool 时强制 reader.copy_on_dispatch，避免池化缓冲被提前复用。
+type ISyncPayloadProcess interface {
+	ConsumesPayloadSync() bool
+}
+
 // ISubProcess 子协议处理接口：Dispatcher 根据 SubProto 路由到对应实现。
 type ISubProcess interface {
 	// SubProto 返回该 handler 负责的子协议编号（0-63）
@@ -117,6 +125,19 @@ type SubProcessAction interface {
 	Handle(context.Context, IConnection, IHeader, json.RawMessage)
 }
 
+// PermContext 描述一次权限判定的调用方上下文，随判定结果一起交给审计钩子。
+type PermContext struct {
+	Action   string // 触发判定的 action 名
+	ConnID   string
+	SubProto uint8
+}
+
+// IPermissionChecker 权限判定接口，由 kit/permission.Config 实现；定义在此以免 subproto 反向依赖 permission。
+type IPermissionChecker interface {
+	// HasCtx 判断 nodeID 是否拥有 perm，pc 仅用于审计，不影响判定结果
+	HasCtx(nodeID uint32, perm string, pc PermContext) bool
+}
+
 // IHeaderCodec 头编解码接口：不同协议实现各自的头部序列化与反序列化。
 type IHeaderCodec interface {
 	// Encode 将 header 与 payload 编码为单个帧字节切片
@@ -146,6 +167,27 @@ type IPipe interface {
 	io.ReadWriteCloser
 }
 
+// IReadDeadlinePipe 可选能力：支持读超时的 pipe（如 TCP/QUIC），供读取循环做空闲与慢帧保护。
+type IReadDeadlinePipe interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// IWriteDeadlinePipe 可选能力：支持写超时的 pipe，供发送端把调用方 ctx 的 deadline 作用到实际写出。
+type IWriteDeadlinePipe interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// IBuffersPipe 可选能力：支持一次写出多段数据的 pipe（如 TCP 上的 writev），供发送端合并小帧减少系统调用。
+type IBuffersPipe interface {
+	WriteBuffers(bufs *net.Buffers) (int64, error)
+}
+
+// IHalfCloser 可选能力：支持单向关闭的连接（如 TCP），对端半关闭后可停止读取、继续把积压的响应写完再发 FIN。
+type IHalfCloser interface {
+	CloseRead() error
+	CloseWrite() error
+}
+
 // IConnection 连接接口：封装实际连接与其元数据，支持发送、接收事件、关闭与元数据的读写。
 type IConnection interface {
 	ISender
@@ -170,6 +212,8 @@ type IConnection interface {
 	// Reader 相关
 	Reader() IReader
 	SetReader(IReader)
+	// DispatchReceive 把读取器解出的帧交给 receive handler。payload 是否可在返回后继续持有取决于读取器：
+	// 启用 payload 复用的读取器会在返回后回收缓冲，handler 需在回调内用完或自行拷贝（见 reader.Options）。
 	DispatchReceive(IHeader, []byte)
 }
 
@@ -205,10 +249,58 @@ type IConnectionManager interface {
 	UpdateDeviceIndex(deviceID string, conn IConnection)
 }
 
+// IMultiNodeIndex 为可选能力：同一 nodeID 可经由多条连接到达（多会话、冗余上行）。
+// UpdateNodeIndex 仍是“覆盖”语义；AppendNodeIndex 追加一条可达连接，GetByNode 按实现的选择策略返回其一。
+type IMultiNodeIndex interface {
+	// AppendNodeIndex 为 nodeID 追加一条可达连接（已存在则视为最新绑定）
+	AppendNodeIndex(nodeID uint32, conn IConnection)
+	// GetAllByNode 返回 nodeID 的全部可达连接，按绑定时间从新到旧
+	GetAllByNode(nodeID uint32) []IConnection
+}
+
+// IContextCloser 为可选能力：CloseAll 的带截止时间版本，供服务停止时遵守关闭期限。
+type IContextCloser interface {
+	CloseAllContext(ctx context.Context) error
+}
+
+// IConnNodeIndex 为可选能力：按连接反查经其可达的全部 nodeID（多节点共用一条连接时）。
+type IConnNodeIndex interface {
+	NodesOfConn(connID string) []uint32
+}
+
+// INodeBinder 为可选能力：登录绑定 nodeID 时执行冲突与重复连接策略，被拒绝时返回错误。
+type INodeBinder interface {
+	TryBindNode(nodeID uint32, conn IConnection) error
+}
+
+// IConnUnbinder 为可选能力：登出时只摘除指定连接的节点/设备映射，同一身份的其他连接保持可达。
+type IConnUnbinder interface {
+	UnbindNode(nodeID uint32, conn IConnection)
+	UnbindDevice(deviceID string, conn IConnection)
+}
+
+// IConnSnapshotter 为可选能力：导出连接与索引的只读快照，供管理端展示。
+type IConnSnapshotter interface {
+	SnapshotConnections() []ConnInfo
+	SnapshotIndexes() ConnIndexSnapshot
+}
+
+// IActivityTracker 为连接的可选能力：记录建立时间与最近一次收发时间。
+type IActivityTracker interface {
+	ConnectedAt() time.Time
+	LastActivity() time.Time
+}
+
 // ConnectionHooks 连接事件钩子。
 type ConnectionHooks struct {
 	OnAdd    func(IConnection)
 	OnRemove func(IConnection)
+	// OnNodeConflict 在 nodeID 被另一条存活连接接管时触发（old 为原绑定连接）。
+	OnNodeConflict func(nodeID uint32, old, new IConnection)
+	// OnReplaced 在同一 nodeID/deviceID 的旧直连被新连接顶替并移除后触发。
+	OnReplaced func(old, new IConnection)
+	// OnNodeBound 在连接以自身元数据中的 nodeID 成功绑定索引后触发（即登录完成）；后代节点的路由绑定不触发。
+	OnNodeBound func(nodeID uint32, conn IConnection)
 }
 
 // IListener 监听者接口：每种协议对应一个监听者，用于接受新连接并加入连接管理器。
@@ -0,0 +1,140 @@
+package binding
+
+// 本文件承载 Core 框架中与 `file` 相关的通用逻辑。
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// fileState is the on-disk JSON layout of FileStore.
+type fileState struct {
+	NextID   uint32            `json:"next_id"`
+	Bindings map[string]uint32 `json:"bindings"`
+}
+
+// FileStore is a Store backed by one JSON file. Every mutation rewrites the whole file through
+// a synced temp file and an atomic rename, so a crash mid-write leaves either the old or the new
+// content, never a torn file; a leftover temp file is discarded on open.
+type FileStore struct {
+	path string
+
+	mu    sync.Mutex
+	state fileState
+}
+
+// NewFileStore opens path, creating an empty store when the file does not exist yet.
+// A file that exists but does not parse is reported rather than silently reset.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, state: fileState{Bindings: make(map[string]uint32)}}
+	_ = os.Remove(s.tmpPath()) // interrupted write from a previous run
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(raw, &s.state); err != nil {
+		return nil, fmt.Errorf("binding store %s: %w", path, err)
+	}
+	if s.state.Bindings == nil {
+		s.state.Bindings = make(map[string]uint32)
+	}
+	return s, nil
+}
+
+// Load returns a copy of all bindings.
+func (s *FileStore) Load() (map[string]uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.state.Bindings), nil
+}
+
+// Save records or replaces a binding and persists it before returning.
+func (s *FileStore) Save(deviceID string, nodeID uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.state.Bindings[deviceID]
+	s.state.Bindings[deviceID] = nodeID
+	if err := s.flushLocked(); err != nil {
+		if had {
+			s.state.Bindings[deviceID] = prev
+		} else {
+			delete(s.state.Bindings, deviceID)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a binding and persists the change; unknown device IDs are ignored.
+func (s *FileStore) Delete(deviceID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, had := s.state.Bindings[deviceID]
+	if !had {
+		return nil
+	}
+	delete(s.state.Bindings, deviceID)
+	if err := s.flushLocked(); err != nil {
+		s.state.Bindings[deviceID] = prev
+		return err
+	}
+	return nil
+}
+
+// NextID returns the persisted counter.
+func (s *FileStore) NextID() (uint32, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.NextID, nil
+}
+
+// SaveNextID persists the counter.
+func (s *FileStore) SaveNextID(id uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.state.NextID
+	s.state.NextID = id
+	if err := s.flushLocked(); err != nil {
+		s.state.NextID = prev
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) tmpPath() string { return s.path + ".tmp" }
+
+// flushLocked writes the full state to the temp file, syncs it and renames it over path.
+func (s *FileStore) flushLocked() error {
+	raw, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	tmp := s.tmpPath()
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(raw); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
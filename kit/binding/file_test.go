@@ -0,0 +1,98 @@
+package binding
+
+// 本文件覆盖 Core 框架中与 `file` 相关的行为。
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestFileStoreConcurrentSavesSurviveReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bindings.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	const n = 32
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.Save(fmt.Sprintf("dev-%d", i), uint32(100+i)); err != nil {
+				t.Errorf("Save: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := s.Delete("dev-0"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := s.SaveNextID(50); err != nil {
+		t.Fatalf("SaveNextID: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	got, _ := reopened.Load()
+	if len(got) != n-1 || got["dev-5"] != 105 {
+		t.Fatalf("reopened bindings len=%d dev-5=%d, want %d/105", len(got), got["dev-5"], n-1)
+	}
+	if _, ok := got["dev-0"]; ok {
+		t.Fatal("deleted binding restored")
+	}
+	// 计数器落后于已持久化的最大 nodeID 时，从最大值之后继续分配。
+	if next, err := RestoreNextID(reopened, 2); err != nil || next != 100+n {
+		t.Fatalf("RestoreNextID=%d,%v want %d", next, err, 100+n)
+	}
+}
+
+func TestFileStoreRecoversFromInterruptedWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bindings.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	if err := s.Save("dev-a", 7); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// 模拟下一次写入在 rename 前崩溃：临时文件只写了一半。
+	if err := os.WriteFile(path+".tmp", []byte(`{"next_id":9,"bindings":{"dev-a":7,"dev-`), 0o600); err != nil {
+		t.Fatalf("write tmp: %v", err)
+	}
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("reopen after crash: %v", err)
+	}
+	if got, _ := reopened.Load(); len(got) != 1 || got["dev-a"] != 7 {
+		t.Fatalf("bindings after crash=%v, want last committed state", got)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("stale temp file kept: %v", err)
+	}
+
+	// 正式文件本身损坏时报错而不是静默清空。
+	if err := os.WriteFile(path, []byte(`{"bindings":`), 0o600); err != nil {
+		t.Fatalf("corrupt: %v", err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Fatal("corrupt store opened without error")
+	}
+}
+
+func TestRestoreNextIDMemoryStore(t *testing.T) {
+	s := NewMemoryStore()
+	if next, _ := RestoreNextID(s, 2); next != 2 {
+		t.Fatalf("empty store next=%d, want floor 2", next)
+	}
+	_ = s.Save("dev", 10)
+	_ = s.SaveNextID(20)
+	if next, _ := RestoreNextID(s, 2); next != 20 {
+		t.Fatalf("next=%d, want persisted counter 20", next)
+	}
+}
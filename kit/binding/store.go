@@ -0,0 +1,92 @@
+package binding
+
+// 本文件承载 Core 框架中与 `store` 相关的通用逻辑。
+
+import (
+	"maps"
+	"sync"
+)
+
+// Store persists the deviceID -> nodeID bindings a login handler assigns, plus its next-ID
+// counter, so a hub restart keeps handing out the same node IDs. A handler should write through
+// on every new or changed binding and call RestoreNextID at startup.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns a copy of all persisted bindings.
+	Load() (map[string]uint32, error)
+	Save(deviceID string, nodeID uint32) error
+	Delete(deviceID string) error
+	// NextID returns the persisted next-ID counter, 0 when never saved.
+	NextID() (uint32, error)
+	SaveNextID(id uint32) error
+}
+
+// RestoreNextID returns the first node ID safe to assign after a restart: the larger of floor,
+// the persisted counter and one above the highest persisted binding.
+func RestoreNextID(s Store, floor uint32) (uint32, error) {
+	persisted, err := s.NextID()
+	if err != nil {
+		return 0, err
+	}
+	next := max(floor, persisted)
+	bindings, err := s.Load()
+	if err != nil {
+		return 0, err
+	}
+	for _, id := range bindings {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	return next, nil
+}
+
+// MemoryStore is the default in-process Store; bindings do not survive a restart.
+type MemoryStore struct {
+	mu       sync.RWMutex
+	bindings map[string]uint32
+	nextID   uint32
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{bindings: make(map[string]uint32)}
+}
+
+// Load returns a copy of all bindings.
+func (m *MemoryStore) Load() (map[string]uint32, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return maps.Clone(m.bindings), nil
+}
+
+// Save records or replaces a binding.
+func (m *MemoryStore) Save(deviceID string, nodeID uint32) error {
+	m.mu.Lock()
+	m.bindings[deviceID] = nodeID
+	m.mu.Unlock()
+	return nil
+}
+
+// Delete removes a binding; unknown device IDs are ignored.
+func (m *MemoryStore) Delete(deviceID string) error {
+	m.mu.Lock()
+	delete(m.bindings, deviceID)
+	m.mu.Unlock()
+	return nil
+}
+
+// NextID returns the stored counter.
+func (m *MemoryStore) NextID() (uint32, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.nextID, nil
+}
+
+// SaveNextID stores the counter.
+func (m *MemoryStore) SaveNextID(id uint32) error {
+	m.mu.Lock()
+	m.nextID = id
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,90 @@
+package handlers
+
+// 本文件承载 Core 框架中与 `handlers` 相关的通用逻辑。
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+// SubProto numbers of the demo handlers. Downstream apps copying a handler should pick their own
+// number and keep it next to these, so one place lists every subproto a hub registers.
+const (
+	SubProtoTraceRoute uint8 = 58
+	SubProtoPing       uint8 = 59
+	SubProtoEcho       uint8 = 60
+	SubProtoUpper      uint8 = 61
+)
+
+// ErrNoServer is logged when a handler runs without a server in its context (e.g. called directly
+// in a test); responses are never written to the connection behind the dispatcher's back.
+var ErrNoServer = errors.New("no server in context")
+
+// EchoHandler replies to every frame with its payload unchanged. It is the minimal template for a
+// raw (non-action) subproto handler: embed subproto.BaseSubProcess, override SubProto/OnReceive,
+// and answer through Respond.
+type EchoHandler struct {
+	subproto.BaseSubProcess
+	log *slog.Logger
+}
+
+// NewEchoHandler creates the echo handler; a nil logger uses slog.Default.
+func NewEchoHandler(log *slog.Logger) *EchoHandler {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &EchoHandler{log: log}
+}
+
+// SubProto returns SubProtoEcho.
+func (h *EchoHandler) SubProto() uint8 { return SubProtoEcho }
+
+// OnReceive echoes payload back to the sender.
+func (h *EchoHandler) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	if err := Respond(ctx, conn, hdr, SubProtoEcho, payload); err != nil {
+		h.log.Warn("echo response failed", "conn", conn.ID(), "err", err)
+	}
+}
+
+// UpperHandler replies with the payload converted to upper case.
+type UpperHandler struct {
+	subproto.BaseSubProcess
+	log *slog.Logger
+}
+
+// NewUpperHandler creates the upper-case handler; a nil logger uses slog.Default.
+func NewUpperHandler(log *slog.Logger) *UpperHandler {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &UpperHandler{log: log}
+}
+
+// SubProto returns SubProtoUpper.
+func (h *UpperHandler) SubProto() uint8 { return SubProtoUpper }
+
+// OnReceive replies with the upper-cased payload.
+func (h *UpperHandler) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	if err := Respond(ctx, conn, hdr, SubProtoUpper, bytes.ToUpper(payload)); err != nil {
+		h.log.Warn("upper response failed", "conn", conn.ID(), "err", err)
+	}
+}
+
+// Respond sends payload as the response to req on conn. The header comes from
+// header.BuildTCPResponse (MsgID/TraceID kept, HopLimit reset) with SourceID set to the local
+// node, and the frame goes through srv.Send so OnSend auditing and the SendDispatcher apply.
+func Respond(ctx context.Context, conn core.IConnection, req core.IHeader, sub uint8, payload []byte) error {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return ErrNoServer
+	}
+	resp := header.BuildTCPResponse(req, uint32(len(payload)), sub)
+	resp.WithSourceID(srv.NodeID())
+	return srv.Send(ctx, conn.ID(), resp, payload)
+}
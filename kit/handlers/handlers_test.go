@@ -0,0 +1,171 @@
+package handlers
+
+// 本文件覆盖 Core 框架中与 `handlers` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/server"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+type pipeListener struct {
+	conn core.IConnection
+}
+
+func (l *pipeListener) Protocol() string { return "pipe" }
+func (l *pipeListener) Addr() net.Addr   { return nil }
+func (l *pipeListener) Close() error     { return nil }
+func (l *pipeListener) Listen(ctx context.Context, cm core.IConnectionManager) error {
+	if err := cm.Add(l.conn); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// auditProcess 作为 Dispatcher 的基础流程，记录经过 OnSend 的响应头。
+type auditProcess struct {
+	mu   sync.Mutex
+	sent []core.IHeader
+}
+
+func (p *auditProcess) OnListen(core.IConnection)                                         {}
+func (p *auditProcess) OnReceive(context.Context, core.IConnection, core.IHeader, []byte) {}
+func (p *auditProcess) OnClose(core.IConnection)                                          {}
+func (p *auditProcess) OnSend(_ context.Context, _ core.IConnection, hdr core.IHeader, _ []byte) error {
+	p.mu.Lock()
+	p.sent = append(p.sent, hdr)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *auditProcess) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sent)
+}
+
+// startHub 启动挂载 handlers 的 hub（节点 1），返回以节点 7 身份接入的客户端一端。
+func startHub(t *testing.T, base core.IProcess, handlers ...core.ISubProcess) net.Conn {
+	t.Helper()
+	disp, err := process.NewDispatcher(process.DispatchOptions{ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 16, Base: base})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	for _, h := range handlers {
+		if err := disp.RegisterHandler(h); err != nil {
+			t.Fatalf("RegisterHandler: %v", err)
+		}
+	}
+	srvSide, client := net.Pipe()
+	t.Cleanup(func() { _ = srvSide.Close(); _ = client.Close() })
+	conn := tcp_listener.NewTCPConnection(srvSide)
+	core.SetConnNodeID(conn, 7)
+	srv, err := server.New(server.Options{
+		NodeID:   1,
+		Process:  disp,
+		Codec:    header.HeaderTcpCodec{},
+		Listener: &pipeListener{conn: conn},
+		Manager:  connmgr.New(),
+		Config:   config.NewMap(nil),
+	})
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+	return client
+}
+
+func TestEchoAndUpperRespondThroughServer(t *testing.T) {
+	audit := &auditProcess{}
+	client := startHub(t, audit, NewEchoHandler(nil), NewUpperHandler(nil))
+
+	for i, tc := range []struct {
+		sub        uint8
+		body, want string
+	}{
+		{sub: SubProtoEcho, body: "ping", want: "ping"},
+		{sub: SubProtoUpper, body: "ping", want: "PING"},
+	} {
+		req := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(tc.sub).
+			WithSourceID(7).WithTargetID(1).WithMsgID(uint32(100 + i)).WithTraceID(0xABCD).WithHopLimit(3)
+		frame, _ := header.HeaderTcpCodec{}.Encode(req, []byte(tc.body))
+		if _, err := client.Write(frame); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		got, body, err := header.HeaderTcpCodec{}.Decode(client)
+		if err != nil {
+			t.Fatalf("sub=%d reply: %v", tc.sub, err)
+		}
+		if string(body) != tc.want {
+			t.Fatalf("sub=%d body=%q, want %q", tc.sub, body, tc.want)
+		}
+		if got.Major() != header.MajorOKResp || got.SubProto() != tc.sub || got.GetMsgID() != req.GetMsgID() {
+			t.Fatalf("sub=%d reply header major=%d sub=%d msg=%d", tc.sub, got.Major(), got.SubProto(), got.GetMsgID())
+		}
+		if got.SourceID() != 1 || got.TargetID() != 7 || got.GetTraceID() != 0xABCD || got.GetHopLimit() != header.DefaultHopLimit {
+			t.Fatalf("sub=%d reply src=%d tgt=%d trace=%#x hop=%d", tc.sub, got.SourceID(), got.TargetID(), got.GetTraceID(), got.GetHopLimit())
+		}
+	}
+	if n := audit.count(); n != 2 {
+		t.Fatalf("OnSend saw %d responses, want 2", n)
+	}
+}
+
+func TestRespondWithoutServer(t *testing.T) {
+	req := (&header.HeaderTcp{}).WithSourceID(7).WithTargetID(1)
+	if err := Respond(context.Background(), nil, req, SubProtoEcho, nil); !errors.Is(err, ErrNoServer) {
+		t.Fatalf("Respond err=%v, want ErrNoServer", err)
+	}
+}
+
+func TestPingHandlerActions(t *testing.T) {
+	client := startHub(t, nil, NewPingHandler())
+	call := func(payload string) subproto.Envelope {
+		t.Helper()
+		req := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(SubProtoPing).WithSourceID(7).WithTargetID(1)
+		frame, _ := header.HeaderTcpCodec{}.Encode(req, []byte(payload))
+		if _, err := client.Write(frame); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, body, err := header.HeaderTcpCodec{}.Decode(client)
+		if err != nil {
+			t.Fatalf("%s reply: %v", payload, err)
+		}
+		var env subproto.Envelope
+		if err := json.Unmarshal(body, &env); err != nil {
+			t.Fatalf("reply envelope %q: %v", body, err)
+		}
+		return env
+	}
+
+	var pong PongResp
+	if env := call(`{"action":"ping"}`); env.Action != "ping_resp" || json.Unmarshal(env.Data, &pong) != nil || pong != (PongResp{Code: 1, NodeID: 1}) {
+		t.Fatalf("ping reply %s %s", env.Action, env.Data)
+	}
+	if env := call(`{"action":"echo","data":{"x":1}}`); env.Action != "echo_resp" || string(env.Data) != `{"code":1,"data":{"x":1}}` {
+		t.Fatalf("echo reply %s %s", env.Action, env.Data)
+	}
+	var resp subproto.ErrorResp
+	if env := call(`{"action":"missing"}`); env.Action != "missing_resp" || json.Unmarshal(env.Data, &resp) != nil || resp.Code != subproto.CodeNotFound {
+		t.Fatalf("unknown action reply %s %s", env.Action, env.Data)
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+// 本文件承载 Core 框架中与 `ping` 相关的通用逻辑。
+
+import (
+	"context"
+	"encoding/json"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/subproto"
+	"github.com/yttydcs/myflowhub-core/subproto/kit"
+)
+
+// Actions of PingHandler; replies are "<action>_resp".
+const (
+	ActionPing = "ping"
+	ActionEcho = "echo"
+)
+
+// PongResp is the reply to ping.
+type PongResp struct {
+	Code   int    `json:"code"`
+	NodeID uint32 `json:"node_id"`
+}
+
+// EchoResp is the reply to echo; Data is the request data unchanged.
+type EchoResp struct {
+	Code int             `json:"code"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// PingHandler is the reference action handler: it embeds subproto.ActionBaseSubProcess and only
+// registers actions. Envelope parsing, RequireAuth checks, panic recovery and error replies come
+// from the embedded OnReceive; actions answer through the subproto.Reply they are given.
+type PingHandler struct {
+	subproto.ActionBaseSubProcess
+}
+
+// NewPingHandler creates the handler with ping and echo registered; echo requires a logged-in node.
+func NewPingHandler() *PingHandler {
+	h := &PingHandler{}
+	h.RegisterAction(kit.NewReplyAction(ActionPing, h.handlePing))
+	h.RegisterAction(kit.NewReplyAction(ActionEcho, h.handleEcho, kit.WithRequireAuth(true)))
+	return h
+}
+
+// SubProto returns SubProtoPing.
+func (h *PingHandler) SubProto() uint8 { return SubProtoPing }
+
+func (h *PingHandler) handlePing(ctx context.Context, _ core.IConnection, _ core.IHeader, _ json.RawMessage, reply subproto.Reply) {
+	resp := PongResp{Code: subproto.CodeOK}
+	if srv := core.ServerFromContext(ctx); srv != nil {
+		resp.NodeID = srv.NodeID()
+	}
+	_ = reply(resp)
+}
+
+func (h *PingHandler) handleEcho(_ context.Context, _ core.IConnection, _ core.IHeader, data json.RawMessage, reply subproto.Reply) {
+	_ = reply(EchoResp{Code: subproto.CodeOK, Data: data})
+}
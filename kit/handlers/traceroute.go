@@ -0,0 +1,78 @@
+package handlers
+
+// 本文件承载 Core 框架中与 `traceroute` 相关的通用逻辑。
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/protoerr"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+// NewTraceRouteProbe builds a traceroute probe from source to target. The probe is a MajorMsg
+// frame so the core forwarding path carries it (Cmd frames are dispatched hop by hop); every hub
+// that forwards it appends its hop, and the target's TraceRouteHandler answers with the full path.
+// Send it with an empty payload.
+func NewTraceRouteProbe(source, target uint32) *header.HeaderTcp {
+	h := &header.HeaderTcp{RouteFlags: header.RouteFlagTraceRoute}
+	h.WithExpectResponse(true).
+		WithMajor(header.MajorMsg).
+		WithSubProto(SubProtoTraceRoute).
+		WithSourceID(source).
+		WithTargetID(target)
+	return h
+}
+
+// TraceRouteHandler answers traceroute probes addressed to this node: it appends its own hop and
+// replies with an OKResp whose payload is the accumulated path (decode with header.ParseTraceHops).
+// Register it on every hub a probe may cross: the dispatcher only forwards subprotos it has a
+// handler for.
+type TraceRouteHandler struct {
+	subproto.BaseSubProcess
+	log *slog.Logger
+}
+
+// NewTraceRouteHandler creates the traceroute handler; a nil logger uses slog.Default.
+func NewTraceRouteHandler(log *slog.Logger) *TraceRouteHandler {
+	if log == nil {
+		log = slog.Default()
+	}
+	return &TraceRouteHandler{log: log}
+}
+
+// SubProto returns SubProtoTraceRoute.
+func (h *TraceRouteHandler) SubProto() uint8 { return SubProtoTraceRoute }
+
+// AllowSourceMismatch is true: probes are relayed by hubs whose node index does not know the
+// originator, and a probe only reveals the path back to whoever sent it.
+func (h *TraceRouteHandler) AllowSourceMismatch() bool { return true }
+
+// OnReceive answers probes; responses and frames without RouteFlagTraceRoute are ignored.
+func (h *TraceRouteHandler) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	if hdr.Major() != header.MajorMsg || !header.IsTraceRoute(hdr) {
+		return
+	}
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		h.log.Warn("traceroute reply failed", "conn", conn.ID(), "err", ErrNoServer)
+		return
+	}
+	var (
+		resp *header.HeaderTcp
+		body []byte
+	)
+	if _, err := header.ParseTraceHops(payload); err != nil {
+		resp, body = protoerr.BuildErrFrame(hdr, protoerr.CodeBadPayload, err.Error())
+	} else {
+		body = header.AppendTraceHop(payload, srv.NodeID(), time.Now())
+		resp = header.BuildTCPResponse(hdr, uint32(len(body)), SubProtoTraceRoute)
+	}
+	resp.WithSourceID(srv.NodeID())
+	if err := srv.Send(ctx, conn.ID(), resp, body); err != nil {
+		h.log.Warn("traceroute reply failed", "conn", conn.ID(), "err", err)
+	}
+}
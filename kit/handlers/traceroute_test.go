@@ -0,0 +1,120 @@
+package handlers
+
+// 本文件覆盖 Core 框架中与 `traceroute` 相关的行为。
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/server"
+)
+
+// startRoutingHub 启动带预路由与 TraceRouteHandler 的 hub，conn 为其唯一的下游连接；parent 非 nil 时作为子 hub 拨向它。
+func startRoutingHub(t *testing.T, nodeID uint32, conn, parent core.IConnection) core.IServer {
+	t.Helper()
+	disp, err := process.NewDispatcher(process.DispatchOptions{
+		ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 16,
+		Base: process.NewPreRoutingProcess(nil),
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	if err := disp.RegisterHandler(NewTraceRouteHandler(nil)); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	cfg := map[string]string{}
+	opts := server.Options{
+		NodeID:   nodeID,
+		Process:  disp,
+		Codec:    header.HeaderTcpCodec{},
+		Listener: &pipeListener{conn: conn},
+		Manager:  connmgr.New(),
+	}
+	if parent != nil {
+		cfg[config.KeyParentEnable] = "true"
+		cfg[config.KeyParentAddrs] = "parent"
+		opts.ParentDialer = func(context.Context, string) (core.IConnection, error) { return parent, nil }
+	}
+	opts.Config = config.NewMap(cfg)
+	srv, err := server.New(opts)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+	return srv
+}
+
+// hasParent 判断 srv 是否已建立父链路。
+func hasParent(srv core.IServer) bool {
+	found := false
+	srv.ConnManager().Range(func(c core.IConnection) bool {
+		found = core.ConnRole(c) == core.RoleParent
+		return !found
+	})
+	return found
+}
+
+func TestTraceRouteAcrossTwoHubs(t *testing.T) {
+	ids := core.CounterConnID("trace-") // 全部为 pipe->pipe，按地址生成的 ID 会冲突
+	pipe := func() (net.Conn, net.Conn) {
+		a, b := net.Pipe()
+		t.Cleanup(func() { _ = a.Close(); _ = b.Close() })
+		return a, b
+	}
+
+	// 客户端 7 —— hub 1 —(父链路)— hub 2
+	downSide, upSide := pipe()
+	down := tcp_listener.NewTCPConnectionWithID(downSide, ids)
+	core.SetConnNodeID(down, 1)
+	startRoutingHub(t, 2, down, nil)
+
+	hubSide, client := pipe()
+	clientConn := tcp_listener.NewTCPConnectionWithID(hubSide, ids)
+	core.SetConnNodeID(clientConn, 7)
+	child := startRoutingHub(t, 1, clientConn, tcp_listener.NewTCPConnectionWithID(upSide, ids))
+	deadline := time.Now().Add(2 * time.Second)
+	for !hasParent(child) {
+		if time.Now().After(deadline) {
+			t.Fatal("hub 1 never connected to its parent")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	probe := NewTraceRouteProbe(7, 2).WithMsgID(77)
+	frame, _ := header.HeaderTcpCodec{}.Encode(probe, nil)
+	before := time.Now().Add(-time.Second)
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("write probe: %v", err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	resp, body, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil {
+		t.Fatalf("traceroute reply: %v", err)
+	}
+	if resp.Major() != header.MajorOKResp || resp.SourceID() != 2 || resp.TargetID() != 7 || resp.GetMsgID() != 77 || header.IsTraceRoute(resp) {
+		t.Fatalf("reply header major=%d src=%d tgt=%d msg=%d flags=%#x", resp.Major(), resp.SourceID(), resp.TargetID(), resp.GetMsgID(), resp.GetRouteFlags())
+	}
+	hops, err := header.ParseTraceHops(body)
+	if err != nil {
+		t.Fatalf("ParseTraceHops: %v", err)
+	}
+	if len(hops) != 2 || hops[0].NodeID != 1 || hops[1].NodeID != 2 {
+		t.Fatalf("path=%+v, want hubs [1 2]", hops)
+	}
+	for _, h := range hops {
+		if h.At.Before(before) || h.At.After(time.Now().Add(time.Second)) {
+			t.Fatalf("hop %d timestamp %v out of range", h.NodeID, h.At)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package loginguard
+
+// 本文件承载 Core 框架中与 `config` 相关的通用逻辑。
+
+import (
+	"strconv"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+)
+
+// LoginOptionsFromConfig reads auth.login_rate_per_min and the lockout keys.
+func LoginOptionsFromConfig(cfg core.IConfig) Options {
+	return Options{
+		RatePerMin:  readInt(cfg, config.KeyAuthLoginRatePerMin),
+		MaxFailures: readInt(cfg, config.KeyAuthLoginMaxFailures),
+		Lockout:     time.Duration(readInt(cfg, config.KeyAuthLoginLockoutSec)) * time.Second,
+	}
+}
+
+// RegisterOptionsFromConfig reads auth.register_rate_per_min. Register has no credential to
+// fail, so only rate limiting applies.
+func RegisterOptionsFromConfig(cfg core.IConfig) Options {
+	return Options{RatePerMin: readInt(cfg, config.KeyAuthRegisterRatePerMin)}
+}
+
+func readInt(cfg core.IConfig, key string) int {
+	if cfg == nil {
+		return 0
+	}
+	raw, ok := cfg.Get(key)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		return 0
+	}
+	return v
+}
@@ -0,0 +1,251 @@
+package loginguard
+
+// 本文件承载 Core 框架中与 `guard` 相关的通用逻辑。
+
+import (
+	"container/list"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// Response codes a login handler returns for rejected attempts, distinct from credential errors
+// so clients can back off instead of retrying immediately.
+const (
+	CodeRateLimited = 4290
+	CodeLockedOut   = 4291
+)
+
+// DefaultMaxKeys bounds how many connection/IP keys a Guard tracks before evicting the least
+// recently seen one.
+const DefaultMaxKeys = 4096
+
+// Decision is the outcome of Guard.Allow.
+type Decision uint8
+
+const (
+	Allowed Decision = iota
+	Throttled
+	LockedOut
+)
+
+// String returns the decision name used in logs.
+func (d Decision) String() string {
+	switch d {
+	case Throttled:
+		return "throttled"
+	case LockedOut:
+		return "locked_out"
+	default:
+		return "allowed"
+	}
+}
+
+// Code returns the response code for a rejected decision, 0 for Allowed.
+func (d Decision) Code() int {
+	switch d {
+	case Throttled:
+		return CodeRateLimited
+	case LockedOut:
+		return CodeLockedOut
+	default:
+		return 0
+	}
+}
+
+// Options configures a Guard.
+type Options struct {
+	// RatePerMin is the sustained attempts per minute allowed for each key; <=0 disables rate limiting.
+	RatePerMin int
+	// Burst is the token bucket size; <=0 uses RatePerMin.
+	Burst int
+	// MaxFailures consecutive failures lock a key out for Lockout; <=0 disables lockout.
+	MaxFailures int
+	Lockout     time.Duration
+	// MaxKeys bounds the tracked keys (LRU); <=0 uses DefaultMaxKeys.
+	MaxKeys int
+	// Now overrides the clock in tests.
+	Now func() time.Time
+}
+
+// Stats is a snapshot of the Guard counters for monitoring.
+type Stats struct {
+	Allowed   uint64 `json:"allowed"`
+	Throttled uint64 `json:"throttled"`
+	LockedOut uint64 `json:"locked_out"`
+	Lockouts  uint64 `json:"lockouts"` // keys that entered lockout
+	Tracked   int    `json:"tracked"`
+}
+
+// Guard rate-limits and locks out repeated register/login attempts per key, typically both the
+// connection ID and the remote IP (see Keys). State is an LRU bounded by MaxKeys, so a flood of
+// distinct sources evicts old entries instead of growing memory. Safe for concurrent use.
+type Guard struct {
+	opts  Options
+	rate  float64 // tokens per second
+	burst float64
+
+	mu    sync.Mutex
+	order *list.List // front = most recently seen
+	items map[string]*list.Element
+
+	allowed   atomic.Uint64
+	throttled atomic.Uint64
+	lockedOut atomic.Uint64
+	lockouts  atomic.Uint64
+}
+
+type entry struct {
+	key         string
+	tokens      float64
+	last        time.Time
+	failures    int
+	lockedUntil time.Time
+}
+
+// New creates a Guard.
+func New(opts Options) *Guard {
+	if opts.MaxKeys <= 0 {
+		opts.MaxKeys = DefaultMaxKeys
+	}
+	if opts.Burst <= 0 {
+		opts.Burst = opts.RatePerMin
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	return &Guard{
+		opts:  opts,
+		rate:  float64(opts.RatePerMin) / 60,
+		burst: float64(opts.Burst),
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Allow checks every key and, only if all pass, consumes one attempt from each. retryAfter is how
+// long the client should wait when the attempt is rejected. Empty keys are ignored.
+func (g *Guard) Allow(keys ...string) (d Decision, retryAfter time.Duration) {
+	now := g.opts.Now()
+	g.mu.Lock()
+	entries := make([]*entry, 0, len(keys))
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		e := g.touch(k, now)
+		entries = append(entries, e)
+		if now.Before(e.lockedUntil) {
+			d, retryAfter = LockedOut, max(retryAfter, e.lockedUntil.Sub(now))
+			continue
+		}
+		if g.rate > 0 && e.tokens < 1 && d != LockedOut {
+			d = Throttled
+			retryAfter = max(retryAfter, time.Duration((1-e.tokens)/g.rate*float64(time.Second)))
+		}
+	}
+	if d == Allowed && g.rate > 0 {
+		for _, e := range entries {
+			e.tokens--
+		}
+	}
+	g.mu.Unlock()
+
+	switch d {
+	case Throttled:
+		g.throttled.Add(1)
+	case LockedOut:
+		g.lockedOut.Add(1)
+	default:
+		g.allowed.Add(1)
+	}
+	return d, retryAfter
+}
+
+// Failure records a failed credential check; MaxFailures consecutive failures lock the key out.
+func (g *Guard) Failure(keys ...string) {
+	if g.opts.MaxFailures <= 0 {
+		return
+	}
+	now := g.opts.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range keys {
+		if k == "" {
+			continue
+		}
+		e := g.touch(k, now)
+		e.failures++
+		if e.failures >= g.opts.MaxFailures {
+			e.failures = 0
+			e.lockedUntil = now.Add(g.opts.Lockout)
+			g.lockouts.Add(1)
+		}
+	}
+}
+
+// Success resets the consecutive failure count of the keys.
+func (g *Guard) Success(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, k := range keys {
+		if el, ok := g.items[k]; ok {
+			el.Value.(*entry).failures = 0
+		}
+	}
+}
+
+// Stats returns the current counters.
+func (g *Guard) Stats() Stats {
+	g.mu.Lock()
+	tracked := g.order.Len()
+	g.mu.Unlock()
+	return Stats{
+		Allowed:   g.allowed.Load(),
+		Throttled: g.throttled.Load(),
+		LockedOut: g.lockedOut.Load(),
+		Lockouts:  g.lockouts.Load(),
+		Tracked:   tracked,
+	}
+}
+
+// touch returns the key's entry with its bucket refilled to now, creating it (and evicting the
+// least recently seen entry) when needed. Caller holds g.mu.
+func (g *Guard) touch(key string, now time.Time) *entry {
+	if el, ok := g.items[key]; ok {
+		g.order.MoveToFront(el)
+		e := el.Value.(*entry)
+		if g.rate > 0 {
+			e.tokens = min(g.burst, e.tokens+now.Sub(e.last).Seconds()*g.rate)
+		}
+		e.last = now
+		return e
+	}
+	e := &entry{key: key, tokens: g.burst, last: now}
+	g.items[key] = g.order.PushFront(e)
+	for g.order.Len() > g.opts.MaxKeys {
+		oldest := g.order.Back()
+		g.order.Remove(oldest)
+		delete(g.items, oldest.Value.(*entry).key)
+	}
+	return e
+}
+
+// Keys returns the per-connection and per-remote-IP keys for conn.
+func Keys(conn core.IConnection) []string {
+	if conn == nil {
+		return nil
+	}
+	keys := []string{"conn:" + conn.ID()}
+	if addr := conn.RemoteAddr(); addr != nil {
+		host, _, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			host = addr.String()
+		}
+		keys = append(keys, "ip:"+host)
+	}
+	return keys
+}
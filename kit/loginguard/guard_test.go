@@ -0,0 +1,93 @@
+package loginguard
+
+// 本文件覆盖 Core 框架中与 `guard` 相关的行为。
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/config"
+)
+
+type testClock struct{ t time.Time }
+
+func (c *testClock) now() time.Time          { return c.t }
+func (c *testClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestGuardRateLimitsPerKeyAndSharedIP(t *testing.T) {
+	clk := &testClock{t: time.Unix(0, 0)}
+	g := New(Options{RatePerMin: 2, Now: clk.now})
+
+	for i := 0; i < 2; i++ {
+		if d, _ := g.Allow("conn:a", "ip:1.2.3.4"); d != Allowed {
+			t.Fatalf("attempt %d: %v, want allowed", i, d)
+		}
+	}
+	// 另一条连接来自同一 IP，同样被 IP 桶限住。
+	d, retry := g.Allow("conn:b", "ip:1.2.3.4")
+	if d != Throttled || d.Code() != CodeRateLimited {
+		t.Fatalf("third attempt from same IP: %v, want throttled", d)
+	}
+	if retry <= 0 || retry > 30*time.Second {
+		t.Fatalf("retryAfter=%s, want (0,30s]", retry)
+	}
+	// 被拒的尝试不消耗 conn:b 的令牌。
+	if d, _ := g.Allow("conn:b", "ip:5.6.7.8"); d != Allowed {
+		t.Fatalf("conn:b from another IP: %v, want allowed", d)
+	}
+	clk.advance(30 * time.Second)
+	if d, _ := g.Allow("conn:a", "ip:1.2.3.4"); d != Allowed {
+		t.Fatalf("after refill: %v, want allowed", d)
+	}
+	if s := g.Stats(); s.Allowed != 4 || s.Throttled != 1 {
+		t.Fatalf("stats=%+v, want allowed 4 throttled 1", s)
+	}
+}
+
+func TestGuardLocksOutAfterConsecutiveFailures(t *testing.T) {
+	clk := &testClock{t: time.Unix(0, 0)}
+	g := New(Options{MaxFailures: 3, Lockout: time.Minute, Now: clk.now})
+
+	g.Failure("ip:9.9.9.9")
+	g.Failure("ip:9.9.9.9")
+	g.Success("ip:9.9.9.9") // 成功清零连续失败计数
+	g.Failure("ip:9.9.9.9")
+	g.Failure("ip:9.9.9.9")
+	if d, _ := g.Allow("ip:9.9.9.9"); d != Allowed {
+		t.Fatalf("after reset: %v, want allowed", d)
+	}
+	g.Failure("ip:9.9.9.9")
+	d, retry := g.Allow("ip:9.9.9.9")
+	if d != LockedOut || d.Code() != CodeLockedOut || retry != time.Minute {
+		t.Fatalf("after 3 failures: %v retry=%s, want locked out for 1m", d, retry)
+	}
+	clk.advance(time.Minute)
+	if d, _ := g.Allow("ip:9.9.9.9"); d != Allowed {
+		t.Fatalf("after lockout expiry: %v, want allowed", d)
+	}
+	if s := g.Stats(); s.Lockouts != 1 || s.LockedOut != 1 {
+		t.Fatalf("stats=%+v, want one lockout and one locked-out attempt", s)
+	}
+}
+
+func TestGuardStateIsBounded(t *testing.T) {
+	g := New(Options{RatePerMin: 1, MaxKeys: 8})
+	for i := 0; i < 100; i++ {
+		g.Allow(fmt.Sprintf("ip:10.0.0.%d", i))
+	}
+	if n := g.Stats().Tracked; n != 8 {
+		t.Fatalf("tracked=%d, want bounded at 8", n)
+	}
+}
+
+func TestOptionsFromConfigDefaults(t *testing.T) {
+	cfg := config.NewMap(nil)
+	login := LoginOptionsFromConfig(cfg)
+	if login.RatePerMin != 30 || login.MaxFailures != 5 || login.Lockout != 5*time.Minute {
+		t.Fatalf("login options=%+v", login)
+	}
+	if reg := RegisterOptionsFromConfig(cfg); reg.RatePerMin != 10 || reg.MaxFailures != 0 {
+		t.Fatalf("register options=%+v", reg)
+	}
+}
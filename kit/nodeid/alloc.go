@@ -0,0 +1,315 @@
+package nodeid
+
+// 本文件承载 Core 框架中与 `alloc` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/kit/binding"
+)
+
+// Allocation strategies selected by auth.node_id_strategy.
+const (
+	// StrategyCounter hands out FirstNodeID upwards, stopping below the child block pool.
+	StrategyCounter = "counter"
+	// StrategyRange hands out IDs from a block configured locally or assigned by the parent.
+	StrategyRange = "range"
+	// StrategyParent forwards every register to the parent and only caches the result.
+	StrategyParent = "parent"
+)
+
+// FirstNodeID is the first ID a counter allocator assigns; 1 is the root hub.
+const FirstNodeID uint32 = 2
+
+var (
+	// ErrExhausted is returned once every ID of the range has been assigned.
+	ErrExhausted = errors.New("node id range exhausted")
+	// ErrNoRange is returned by a range allocator that is still waiting for its block.
+	ErrNoRange = errors.New("node id range not assigned")
+)
+
+// Allocator hands out node IDs for newly registered devices. A login handler selects one with
+// FromConfig and calls Allocate instead of bumping a local counter, so sibling hubs under one
+// parent never assign the same ID. Implementations are safe for concurrent use.
+type Allocator interface {
+	Allocate(ctx context.Context, deviceID string) (uint32, error)
+}
+
+// Range is an inclusive block of node IDs.
+type Range struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+}
+
+// ParseRange parses "start-end", e.g. "10000-19999".
+func ParseRange(raw string) (Range, error) {
+	lo, hi, ok := strings.Cut(strings.TrimSpace(raw), "-")
+	if !ok {
+		return Range{}, fmt.Errorf("invalid node id range %q", raw)
+	}
+	start, err1 := strconv.ParseUint(strings.TrimSpace(lo), 10, 32)
+	end, err2 := strconv.ParseUint(strings.TrimSpace(hi), 10, 32)
+	r := Range{Start: uint32(start), End: uint32(end)}
+	if err1 != nil || err2 != nil || !r.Valid() {
+		return Range{}, fmt.Errorf("invalid node id range %q", raw)
+	}
+	return r, nil
+}
+
+// Valid reports whether r is non-empty and does not include the reserved ID 0.
+func (r Range) Valid() bool { return r.Start != 0 && r.Start <= r.End }
+
+// Size returns the number of IDs in r.
+func (r Range) Size() uint64 {
+	if !r.Valid() {
+		return 0
+	}
+	return uint64(r.End) - uint64(r.Start) + 1
+}
+
+// Contains reports whether id lies in r.
+func (r Range) Contains(id uint32) bool { return r.Valid() && id >= r.Start && id <= r.End }
+
+// Overlaps reports whether r and o share any ID.
+func (r Range) Overlaps(o Range) bool {
+	return r.Valid() && o.Valid() && r.Start <= o.End && o.Start <= r.End
+}
+
+// String returns the "start-end" form accepted by ParseRange.
+func (r Range) String() string { return fmt.Sprintf("%d-%d", r.Start, r.End) }
+
+// RangeStats reports the capacity of a RangeAllocator.
+type RangeStats struct {
+	Range     Range  `json:"range"`
+	Assigned  bool   `json:"assigned"` // false while waiting for the parent's alloc_range reply
+	Next      uint32 `json:"next"`
+	Remaining uint64 `json:"remaining"`
+}
+
+// RangeAllocator assigns IDs sequentially from one Range. With a Store, the counter and the
+// bindings already inside the range are honoured on SetRange, so a restart does not reuse IDs.
+type RangeAllocator struct {
+	store binding.Store
+
+	mu       sync.Mutex
+	r        Range
+	next     uint64 // uint64 so that End == MaxUint32 can be exhausted without wrapping
+	assigned bool
+}
+
+// NewRangeAllocator creates an allocator without a range; Allocate fails with ErrNoRange until
+// SetRange (directly or via RangeSync) provides one. store may be nil.
+func NewRangeAllocator(store binding.Store) *RangeAllocator {
+	return &RangeAllocator{store: store}
+}
+
+// SetRange switches to r, skipping IDs the store shows as already used inside it.
+func (a *RangeAllocator) SetRange(r Range) error {
+	if !r.Valid() {
+		return fmt.Errorf("invalid node id range %s", r)
+	}
+	next := uint64(r.Start)
+	if a.store != nil {
+		persisted, err := a.store.NextID()
+		if err != nil {
+			return err
+		}
+		if r.Contains(persisted) {
+			next = max(next, uint64(persisted))
+		}
+		bindings, err := a.store.Load()
+		if err != nil {
+			return err
+		}
+		for _, id := range bindings {
+			if r.Contains(id) {
+				next = max(next, uint64(id)+1)
+			}
+		}
+	}
+	a.mu.Lock()
+	a.r, a.next, a.assigned = r, next, true
+	a.mu.Unlock()
+	return nil
+}
+
+// Allocate returns the next free ID of the range. deviceID is unused: binding a device to its
+// ID stays with the caller.
+func (a *RangeAllocator) Allocate(_ context.Context, _ string) (uint32, error) {
+	a.mu.Lock()
+	if !a.assigned {
+		a.mu.Unlock()
+		return 0, ErrNoRange
+	}
+	if a.next > uint64(a.r.End) {
+		a.mu.Unlock()
+		return 0, ErrExhausted
+	}
+	id := uint32(a.next)
+	a.next++
+	next := a.next
+	a.mu.Unlock()
+	// The ID is consumed even if persisting fails, so it is never handed out twice.
+	if a.store != nil && next <= math.MaxUint32 {
+		if err := a.store.SaveNextID(uint32(next)); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// Assigned reports whether the allocator has a range.
+func (a *RangeAllocator) Assigned() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.assigned
+}
+
+// Stats returns the current range and its remaining capacity.
+func (a *RangeAllocator) Stats() RangeStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st := RangeStats{Range: a.r, Assigned: a.assigned}
+	if !a.assigned {
+		return st
+	}
+	if a.next <= uint64(a.r.End) {
+		st.Next = uint32(a.next)
+		st.Remaining = uint64(a.r.End) - a.next + 1
+	}
+	return st
+}
+
+// AssistFunc registers deviceID at the parent (assist_register) and returns the node ID the
+// parent assigned.
+type AssistFunc func(ctx context.Context, deviceID string) (uint32, error)
+
+// DelegatedAllocator leaves ID assignment to the parent and caches the result per device, so a
+// device re-registering at this hub gets its ID without another round trip. With a Store the
+// cache is written through and reloaded by NewDelegatedAllocator.
+type DelegatedAllocator struct {
+	assist AssistFunc
+	store  binding.Store
+
+	mu    sync.Mutex
+	cache map[string]uint32
+}
+
+// NewDelegatedAllocator creates a parent-delegated allocator; store may be nil.
+func NewDelegatedAllocator(assist AssistFunc, store binding.Store) (*DelegatedAllocator, error) {
+	if assist == nil {
+		return nil, errors.New("parent node id strategy requires an assist func")
+	}
+	a := &DelegatedAllocator{assist: assist, store: store, cache: make(map[string]uint32)}
+	if store != nil {
+		bindings, err := store.Load()
+		if err != nil {
+			return nil, err
+		}
+		a.cache = bindings
+	}
+	return a, nil
+}
+
+// Allocate returns the cached ID of deviceID or asks the parent for one.
+func (a *DelegatedAllocator) Allocate(ctx context.Context, deviceID string) (uint32, error) {
+	a.mu.Lock()
+	id, ok := a.cache[deviceID]
+	a.mu.Unlock()
+	if ok && deviceID != "" {
+		return id, nil
+	}
+	id, err := a.assist(ctx, deviceID)
+	if err != nil {
+		return 0, err
+	}
+	if id == 0 {
+		return 0, errors.New("parent assigned node id 0")
+	}
+	if deviceID == "" {
+		return id, nil
+	}
+	a.mu.Lock()
+	a.cache[deviceID] = id
+	a.mu.Unlock()
+	if a.store != nil {
+		if err := a.store.Save(deviceID, id); err != nil {
+			return 0, err
+		}
+	}
+	return id, nil
+}
+
+// Forget drops the cached ID of deviceID, e.g. after the parent revoked it.
+func (a *DelegatedAllocator) Forget(deviceID string) {
+	a.mu.Lock()
+	delete(a.cache, deviceID)
+	a.mu.Unlock()
+	if a.store != nil {
+		_ = a.store.Delete(deviceID)
+	}
+}
+
+// Options carries the dependencies FromConfig cannot read from config.
+type Options struct {
+	// Store persists the counter (counter/range) or the cached bindings (parent); nil keeps
+	// state in memory only.
+	Store binding.Store
+	// Assist is required by the parent strategy.
+	Assist AssistFunc
+}
+
+// FromConfig selects the allocator named by auth.node_id_strategy:
+//   - counter: FirstNodeID up to just below auth.node_id_pool_start;
+//   - range: auth.node_id_range, or, when empty, a block the parent assigns via RangeSync;
+//   - parent: every register is delegated through opts.Assist.
+func FromConfig(cfg core.IConfig, opts Options) (Allocator, error) {
+	strategy := StrategyCounter
+	if raw, ok := cfg.Get(config.KeyAuthNodeIDStrategy); ok && strings.TrimSpace(raw) != "" {
+		strategy = strings.ToLower(strings.TrimSpace(raw))
+	}
+	switch strategy {
+	case StrategyCounter:
+		a := NewRangeAllocator(opts.Store)
+		end := uint32(math.MaxUint32)
+		if start := readUint32(cfg, config.KeyAuthNodeIDPoolStart); start > FirstNodeID {
+			end = start - 1
+		}
+		return a, a.SetRange(Range{Start: FirstNodeID, End: end})
+	case StrategyRange:
+		a := NewRangeAllocator(opts.Store)
+		raw, _ := cfg.Get(config.KeyAuthNodeIDRange)
+		if strings.TrimSpace(raw) == "" {
+			return a, nil
+		}
+		r, err := ParseRange(raw)
+		if err != nil {
+			return nil, err
+		}
+		return a, a.SetRange(r)
+	case StrategyParent:
+		return NewDelegatedAllocator(opts.Assist, opts.Store)
+	default:
+		return nil, fmt.Errorf("unknown node id strategy %q", strategy)
+	}
+}
+
+func readUint32(cfg core.IConfig, key string) uint32 {
+	raw, ok := cfg.Get(key)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(v)
+}
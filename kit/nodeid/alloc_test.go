@@ -0,0 +1,109 @@
+package nodeid
+
+// 本文件覆盖 Core 框架中与 `alloc` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/kit/binding"
+)
+
+func TestParseRange(t *testing.T) {
+	r, err := ParseRange(" 10000 - 19999 ")
+	if err != nil || r != (Range{Start: 10000, End: 19999}) || r.Size() != 10000 {
+		t.Fatalf("ParseRange = %v, %v", r, err)
+	}
+	for _, bad := range []string{"", "10", "0-5", "9-3", "a-b"} {
+		if _, err := ParseRange(bad); err == nil {
+			t.Fatalf("ParseRange(%q) accepted", bad)
+		}
+	}
+}
+
+func TestRangeAllocatorExhaustsAndResumesFromStore(t *testing.T) {
+	ctx := context.Background()
+	store := binding.NewMemoryStore()
+	_ = store.Save("dev-old", 12)
+	a := NewRangeAllocator(store)
+	if _, err := a.Allocate(ctx, "x"); !errors.Is(err, ErrNoRange) {
+		t.Fatalf("Allocate before SetRange: %v, want ErrNoRange", err)
+	}
+	if err := a.SetRange(Range{Start: 10, End: 14}); err != nil {
+		t.Fatalf("SetRange: %v", err)
+	}
+	if st := a.Stats(); st.Next != 13 || st.Remaining != 2 {
+		t.Fatalf("Stats = %+v, want next 13 remaining 2 (12 is bound)", st)
+	}
+	for _, want := range []uint32{13, 14} {
+		if id, err := a.Allocate(ctx, "x"); err != nil || id != want {
+			t.Fatalf("Allocate = %d, %v, want %d", id, err, want)
+		}
+	}
+	if _, err := a.Allocate(ctx, "x"); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("Allocate past end: %v, want ErrExhausted", err)
+	}
+	if st := a.Stats(); st.Remaining != 0 {
+		t.Fatalf("Remaining = %d after exhaustion", st.Remaining)
+	}
+
+	restarted := NewRangeAllocator(store)
+	_ = restarted.SetRange(Range{Start: 10, End: 20})
+	if id, _ := restarted.Allocate(ctx, "y"); id != 15 {
+		t.Fatalf("after restart Allocate = %d, want 15", id)
+	}
+}
+
+func TestDelegatedAllocatorCachesParentAnswer(t *testing.T) {
+	calls := 0
+	a, err := NewDelegatedAllocator(func(_ context.Context, deviceID string) (uint32, error) {
+		calls++
+		return uint32(100 + calls), nil
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewDelegatedAllocator: %v", err)
+	}
+	ctx := context.Background()
+	first, _ := a.Allocate(ctx, "dev-a")
+	again, _ := a.Allocate(ctx, "dev-a")
+	other, _ := a.Allocate(ctx, "dev-b")
+	if first != 101 || again != 101 || other != 102 || calls != 2 {
+		t.Fatalf("ids = %d,%d,%d calls=%d", first, again, other, calls)
+	}
+	a.Forget("dev-a")
+	if id, _ := a.Allocate(ctx, "dev-a"); id != 103 {
+		t.Fatalf("after Forget Allocate = %d, want a fresh parent answer", id)
+	}
+}
+
+func TestFromConfigSelectsStrategy(t *testing.T) {
+	counter, err := FromConfig(config.NewMap(map[string]string{config.KeyAuthNodeIDPoolStart: "100"}), Options{})
+	if err != nil {
+		t.Fatalf("counter: %v", err)
+	}
+	if st := counter.(*RangeAllocator).Stats(); st.Range != (Range{Start: FirstNodeID, End: 99}) {
+		t.Fatalf("counter range = %v, want it to stop below the pool", st.Range)
+	}
+	ranged, err := FromConfig(config.NewMap(map[string]string{
+		config.KeyAuthNodeIDStrategy: "range",
+		config.KeyAuthNodeIDRange:    "500-599",
+	}), Options{})
+	if err != nil {
+		t.Fatalf("range: %v", err)
+	}
+	if id, _ := ranged.Allocate(context.Background(), "d"); id != 500 {
+		t.Fatalf("range Allocate = %d, want 500", id)
+	}
+	pending, _ := FromConfig(config.NewMap(map[string]string{config.KeyAuthNodeIDStrategy: "range"}), Options{})
+	if pending.(*RangeAllocator).Assigned() {
+		t.Fatal("range without auth.node_id_range should wait for the parent")
+	}
+	if _, err := FromConfig(config.NewMap(map[string]string{config.KeyAuthNodeIDStrategy: "parent"}), Options{}); err == nil {
+		t.Fatal("parent strategy without Assist accepted")
+	}
+	if _, err := FromConfig(config.NewMap(map[string]string{config.KeyAuthNodeIDStrategy: "dice"}), Options{}); err == nil {
+		t.Fatal("unknown strategy accepted")
+	}
+}
@@ -0,0 +1,313 @@
+package nodeid
+
+// 本文件承载 Core 框架中与 `rangesync` 相关的通用逻辑。
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"maps"
+	"math"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/events"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/subproto"
+	"github.com/yttydcs/myflowhub-core/subproto/kit"
+)
+
+// Actions of the range protocol, carried on the auth subproto.
+const (
+	// ActionAllocRange (child -> parent) asks for the child hub's node ID block.
+	ActionAllocRange = "alloc_range"
+	// ActionAllocRangeResp (parent -> child) carries AllocRangeResp.
+	ActionAllocRangeResp = "alloc_range_resp"
+
+	// AuthSubProto is the subproto the range actions are registered on.
+	AuthSubProto uint8 = 2
+)
+
+// ErrPoolExhausted is returned when no further block fits below MaxUint32.
+var ErrPoolExhausted = errors.New("node id block pool exhausted")
+
+// AllocRangeResp is the payload of ActionAllocRangeResp; Code 1 means success.
+type AllocRangeResp struct {
+	Code  int    `json:"code"`
+	Msg   string `json:"msg,omitempty"`
+	Start uint32 `json:"start,omitempty"`
+	End   uint32 `json:"end,omitempty"`
+}
+
+// BlockPool hands out disjoint, fixed-size blocks to child hubs on a parent. A child keeps its
+// block across reconnects. The table lives in memory only: the caller must persist Assignments
+// (e.g. after every alloc_range) and Restore it on start, or a restarted parent hands blocks that
+// are still in use to other children.
+type BlockPool struct {
+	size     uint64
+	reserved []Range
+
+	mu     sync.Mutex
+	next   uint64
+	end    uint64 // last ID a block may use
+	byNode map[uint32]Range
+}
+
+// NewBlockPool creates a pool starting at start; blocks overlapping a reserved range (e.g. the
+// parent's own range) are skipped.
+func NewBlockPool(start, size uint32, reserved ...Range) *BlockPool {
+	return &BlockPool{
+		size:     uint64(max(size, 1)),
+		reserved: reserved,
+		next:     uint64(max(start, 1)),
+		end:      math.MaxUint32,
+		byNode:   make(map[uint32]Range),
+	}
+}
+
+// BlockPoolFromConfig creates a pool from auth.node_id_pool_start and auth.node_id_block_size.
+// On a hub that is itself assigned a block by its parent, RangeSync confines the pool to that
+// block (see Subdivide), so the start only matters on the root.
+func BlockPoolFromConfig(cfg core.IConfig, reserved ...Range) *BlockPool {
+	return NewBlockPool(readUint32(cfg, config.KeyAuthNodeIDPoolStart), readUint32(cfg, config.KeyAuthNodeIDBlockSize), reserved...)
+}
+
+// Assign returns nodeID's block, carving a new one on first request.
+func (p *BlockPool) Assign(nodeID uint32) (Range, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.byNode[nodeID]; ok {
+		return r, nil
+	}
+	for {
+		end := p.next + p.size - 1
+		if end > p.end {
+			return Range{}, ErrPoolExhausted
+		}
+		r := Range{Start: uint32(p.next), End: uint32(end)}
+		p.next = end + 1
+		if !p.overlapsLocked(r) {
+			p.byNode[nodeID] = r
+			return r, nil
+		}
+	}
+}
+
+// Subdivide confines the pool to r, the block this hub was assigned by its own parent. The first
+// block of r is kept for the hub's own devices and returned; children's blocks are carved from
+// the rest. Restored blocks outside r are dropped, as their IDs belong to another hub.
+func (p *BlockPool) Subdivide(r Range) (own Range) {
+	own = r
+	if r.Size() > p.size {
+		own.End = uint32(uint64(r.Start) + p.size - 1)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.next, p.end = uint64(own.End)+1, uint64(r.End)
+	for node, used := range p.byNode {
+		if used.Start <= own.End || used.End > r.End {
+			delete(p.byNode, node)
+			continue
+		}
+		p.next = max(p.next, uint64(used.End)+1)
+	}
+	return own
+}
+
+// Assignments returns a copy of the node -> block table.
+func (p *BlockPool) Assignments() map[uint32]Range {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return maps.Clone(p.byNode)
+}
+
+// Restore reloads a persisted table; later blocks are carved above every restored one.
+func (p *BlockPool) Restore(assignments map[uint32]Range) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for node, r := range assignments {
+		p.byNode[node] = r
+		p.next = max(p.next, uint64(r.End)+1)
+	}
+}
+
+func (p *BlockPool) overlapsLocked(r Range) bool {
+	for _, res := range p.reserved {
+		if r.Overlaps(res) {
+			return true
+		}
+	}
+	for _, used := range p.byNode {
+		if r.Overlaps(used) {
+			return true
+		}
+	}
+	return false
+}
+
+// RangeSync runs the alloc_range protocol. With a Pool it answers children's alloc_range; with
+// an Allocator that has no range yet it requests one whenever parent.ready fires. A hub in the
+// middle of a tree may do both: it keeps the first block of the range it is assigned and hands
+// its children blocks from the rest. Until its own range has arrived it refuses alloc_range with
+// code 5003, and the child asks again on its next parent.ready.
+type RangeSync struct {
+	pool  *BlockPool
+	alloc *RangeAllocator
+	log   *slog.Logger
+	enc   *subproto.ActionBaseSubProcess // envelope encoding only
+
+	mu     sync.Mutex
+	srv    core.IServer
+	detach func()
+}
+
+// RangeSyncOptions configures NewRangeSync.
+type RangeSyncOptions struct {
+	Logger *slog.Logger
+	// Envelope is the envelope codec used when the connection does not select one; nil means JSON.
+	Envelope subproto.EnvelopeCodec
+	// Pool serves child hubs; nil rejects alloc_range. Its assignments are not persisted here,
+	// see BlockPool.
+	Pool *BlockPool
+	// Allocator receives the block assigned by the parent; nil never requests one.
+	Allocator *RangeAllocator
+}
+
+// NewRangeSync creates the range protocol component.
+func NewRangeSync(opts RangeSyncOptions) *RangeSync {
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return &RangeSync{pool: opts.Pool, alloc: opts.Allocator, log: log, enc: &subproto.ActionBaseSubProcess{Envelope: opts.Envelope}}
+}
+
+// Actions returns the range actions for registration on the auth subprocess.
+func (s *RangeSync) Actions() []core.SubProcessAction {
+	return []core.SubProcessAction{
+		kit.NewAction(ActionAllocRange, s.handleAllocRange, kit.WithRequireAuth(true)),
+		kit.NewAction(ActionAllocRangeResp, s.handleAllocRangeResp),
+	}
+}
+
+// Attach requests a block from the parent whenever parent.ready fires until one is assigned.
+// The returned func (also called by a repeated Attach) stops it.
+func (s *RangeSync) Attach(srv core.IServer) (detach func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detach != nil {
+		s.detach()
+	}
+	s.srv = srv
+	bus := srv.EventBus()
+	tok := bus.Subscribe(events.ParentReady, s.onParentReady)
+	var once sync.Once
+	s.detach = func() { once.Do(func() { bus.Unsubscribe(events.ParentReady, tok) }) }
+	return s.detach
+}
+
+func (s *RangeSync) server() core.IServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.srv
+}
+
+func (s *RangeSync) onParentReady(ctx context.Context, evt eventbus.Event) {
+	if s.alloc == nil || s.alloc.Assigned() {
+		return
+	}
+	data, _ := evt.Data.(map[string]any)
+	connID, _ := data["conn_id"].(string)
+	srv := s.server()
+	if connID == "" || srv == nil {
+		return
+	}
+	conn, ok := srv.ConnManager().Get(connID)
+	if !ok {
+		return
+	}
+	if err := s.send(ctx, srv, conn, ActionAllocRange, nil); err != nil {
+		s.log.Warn("alloc_range request failed", "conn", connID, "err", err)
+	}
+}
+
+// handleAllocRange assigns the requesting child hub its block, keyed by its node ID.
+func (s *RangeSync) handleAllocRange(ctx context.Context, conn core.IConnection, _ core.IHeader, _ json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		srv = s.server()
+	}
+	if srv == nil {
+		return
+	}
+	resp := AllocRangeResp{Code: 1}
+	nodeID := core.ConnNodeID(conn)
+	switch {
+	case s.pool == nil:
+		resp = AllocRangeResp{Code: 4004, Msg: "node id ranges not served here"}
+	case nodeID == 0:
+		resp = AllocRangeResp{Code: 4001, Msg: "not logged in"}
+	case s.alloc != nil && !s.alloc.Assigned():
+		resp = AllocRangeResp{Code: 5003, Msg: "node id range not assigned yet"}
+	default:
+		r, err := s.pool.Assign(nodeID)
+		if err != nil {
+			resp = AllocRangeResp{Code: 5000, Msg: err.Error()}
+		} else {
+			resp.Start, resp.End = r.Start, r.End
+		}
+	}
+	if err := s.send(ctx, srv, conn, ActionAllocRangeResp, resp); err != nil {
+		s.log.Warn("alloc_range reply failed", "conn", conn.ID(), "err", err)
+	}
+}
+
+// handleAllocRangeResp applies the block assigned by the parent.
+func (s *RangeSync) handleAllocRangeResp(_ context.Context, conn core.IConnection, _ core.IHeader, data json.RawMessage) {
+	if core.ConnRole(conn) != core.RoleParent {
+		s.log.Warn("alloc_range_resp from non-parent ignored", "conn", conn.ID())
+		return
+	}
+	if s.alloc == nil {
+		return
+	}
+	var resp AllocRangeResp
+	if err := json.Unmarshal(data, &resp); err != nil {
+		s.log.Warn("invalid alloc_range_resp", "conn", conn.ID(), "err", err)
+		return
+	}
+	if resp.Code != 1 {
+		s.log.Warn("alloc_range rejected", "code", resp.Code, "msg", resp.Msg)
+		return
+	}
+	r := Range{Start: resp.Start, End: resp.End}
+	if !r.Valid() {
+		s.log.Warn("invalid node id range assigned", "range", r.String())
+		return
+	}
+	own := r
+	if s.pool != nil {
+		own = s.pool.Subdivide(r)
+	}
+	if err := s.alloc.SetRange(own); err != nil {
+		s.log.Warn("apply node id range failed", "range", own.String(), "err", err)
+		return
+	}
+	s.log.Info("node id range assigned", "range", r.String(), "own", own.String())
+}
+
+func (s *RangeSync) send(ctx context.Context, srv core.IServer, conn core.IConnection, action string, data any) error {
+	payload, err := s.enc.EncodeAction(conn, action, data)
+	if err != nil {
+		return err
+	}
+	hdr := (&header.HeaderTcp{}).
+		WithMajor(header.MajorCmd).
+		WithSubProto(AuthSubProto).
+		WithSourceID(srv.NodeID()).
+		WithTargetID(core.ConnNodeID(conn))
+	return srv.Send(ctx, conn.ID(), hdr, payload)
+}
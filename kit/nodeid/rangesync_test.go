@@ -0,0 +1,220 @@
+package nodeid
+
+// 本文件覆盖 Core 框架中与 `rangesync` 相关的行为。
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/server"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+func TestBlockPoolSkipsReservedAndKeepsBlocks(t *testing.T) {
+	p := NewBlockPool(100, 50, Range{Start: 120, End: 160})
+	a, _ := p.Assign(7)
+	b, _ := p.Assign(8)
+	again, _ := p.Assign(7)
+	if a != (Range{Start: 200, End: 249}) || b != (Range{Start: 250, End: 299}) || again != a {
+		t.Fatalf("blocks a=%v b=%v again=%v", a, b, again)
+	}
+	restored := NewBlockPool(100, 50)
+	restored.Restore(p.Assignments())
+	if c, _ := restored.Assign(9); c.Start != 300 {
+		t.Fatalf("block after restore = %v, want above restored blocks", c)
+	}
+}
+
+func TestBlockPoolSubdivideConfinesToAssignedRange(t *testing.T) {
+	p := NewBlockPool(1000000, 100)
+	p.Restore(map[uint32]Range{7: {Start: 1000000, End: 1000099}, 8: {Start: 5200, End: 5299}})
+	own := p.Subdivide(Range{Start: 5000, End: 5399})
+	if own != (Range{Start: 5000, End: 5099}) {
+		t.Fatalf("own = %v, want first block of the assigned range", own)
+	}
+	if _, ok := p.Assignments()[7]; ok {
+		t.Fatal("block outside the assigned range kept")
+	}
+	a, _ := p.Assign(9)
+	if a != (Range{Start: 5300, End: 5399}) {
+		t.Fatalf("block = %v, want above the kept restored block", a)
+	}
+	if _, err := p.Assign(10); err != ErrPoolExhausted {
+		t.Fatalf("Assign beyond the assigned range err=%v, want ErrPoolExhausted", err)
+	}
+}
+
+// authProcess 是测试用的 SubProto=2 处理器，只承载 alloc_range action。
+type authProcess struct {
+	subproto.ActionBaseSubProcess
+}
+
+func (p *authProcess) SubProto() uint8           { return AuthSubProto }
+func (p *authProcess) AllowSourceMismatch() bool { return true }
+func (p *authProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	_ = p.DispatchAction(ctx, conn, hdr, payload)
+}
+
+type pipeListener struct {
+	conns []core.IConnection
+}
+
+func (l *pipeListener) Protocol() string { return "pipe" }
+func (l *pipeListener) Addr() net.Addr   { return nil }
+func (l *pipeListener) Close() error     { return nil }
+func (l *pipeListener) Listen(ctx context.Context, cm core.IConnectionManager) error {
+	for _, c := range l.conns {
+		if err := cm.Add(c); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// startHub 启动挂载 alloc_range 的 hub；parent 非 nil 时作为子 hub 拨向它。
+func startHub(t *testing.T, nodeID uint32, opts RangeSyncOptions, lst core.IListener, parent core.IConnection) {
+	t.Helper()
+	rs := NewRangeSync(opts)
+	auth := &authProcess{}
+	for _, act := range rs.Actions() {
+		auth.RegisterAction(act)
+	}
+	disp, err := process.NewDispatcher(process.DispatchOptions{ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 16})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	if err := disp.RegisterHandler(auth); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	cfg := map[string]string{}
+	srvOpts := server.Options{
+		NodeID:   nodeID,
+		Process:  disp,
+		Codec:    header.HeaderTcpCodec{},
+		Listener: lst,
+		Manager:  connmgr.New(),
+	}
+	if parent != nil {
+		cfg[config.KeyParentEnable] = "true"
+		cfg[config.KeyParentAddrs] = "parent"
+		srvOpts.ParentDialer = func(context.Context, string) (core.IConnection, error) { return parent, nil }
+	}
+	srvOpts.Config = config.NewMap(cfg)
+	srv, err := server.New(srvOpts)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	detach := rs.Attach(srv)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		detach()
+		_ = srv.Stop(context.Background())
+	})
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSiblingHubsNeverAssignTheSameID(t *testing.T) {
+	cfg := config.NewMap(map[string]string{
+		config.KeyAuthNodeIDStrategy:  "range",
+		config.KeyAuthNodeIDBlockSize: "100",
+	})
+	newAlloc := func() *RangeAllocator {
+		a, err := FromConfig(cfg, Options{})
+		if err != nil {
+			t.Fatalf("FromConfig: %v", err)
+		}
+		return a.(*RangeAllocator)
+	}
+	parentAlloc := newAlloc()
+	if err := parentAlloc.SetRange(Range{Start: FirstNodeID, End: 999}); err != nil {
+		t.Fatalf("SetRange: %v", err)
+	}
+
+	var downlinks, uplinks []core.IConnection
+	ids := core.CounterConnID("down-") // 全部为 pipe->pipe，按地址生成的 ID 会冲突
+	for i := range 2 {
+		parentSide, childSide := net.Pipe()
+		t.Cleanup(func() { _ = parentSide.Close(); _ = childSide.Close() })
+		down := tcp_listener.NewTCPConnectionWithID(parentSide, ids)
+		core.SetConnNodeID(down, uint32(20+i))
+		downlinks = append(downlinks, down)
+		uplinks = append(uplinks, tcp_listener.NewTCPConnection(childSide))
+	}
+	pool := BlockPoolFromConfig(cfg, parentAlloc.Stats().Range)
+	startHub(t, 1, RangeSyncOptions{Pool: pool}, &pipeListener{conns: downlinks}, nil)
+	children := []*RangeAllocator{newAlloc(), newAlloc()}
+	for i, child := range children {
+		startHub(t, uint32(20+i), RangeSyncOptions{Allocator: child}, &pipeListener{}, uplinks[i])
+	}
+	waitFor(t, "child ranges", func() bool { return children[0].Assigned() && children[1].Assigned() })
+
+	seen := make(map[uint32]string)
+	ctx := context.Background()
+	for name, a := range map[string]*RangeAllocator{"parent": parentAlloc, "child-20": children[0], "child-21": children[1]} {
+		for {
+			id, err := a.Allocate(ctx, "")
+			if err != nil {
+				break
+			}
+			if prev, dup := seen[id]; dup {
+				t.Fatalf("node id %d assigned by both %s and %s", id, prev, name)
+			}
+			seen[id] = name
+		}
+	}
+	if len(seen) != 998+100+100 {
+		t.Fatalf("assigned %d ids, want every id of the three ranges", len(seen))
+	}
+}
+
+func TestDelegatedHubSubAllocatesInsideItsRange(t *testing.T) {
+	rootCfg := config.NewMap(map[string]string{config.KeyAuthNodeIDBlockSize: "1000"})
+	midCfg := config.NewMap(map[string]string{config.KeyAuthNodeIDBlockSize: "100"})
+
+	link := func(nodeID uint32) (down, up core.IConnection) {
+		parentSide, childSide := net.Pipe()
+		t.Cleanup(func() { _ = parentSide.Close(); _ = childSide.Close() })
+		down = tcp_listener.NewTCPConnectionWithID(parentSide, core.CounterConnID(fmt.Sprintf("down-%d-", nodeID)))
+		core.SetConnNodeID(down, nodeID)
+		return down, tcp_listener.NewTCPConnection(childSide)
+	}
+	rootDown, midUp := link(20)
+	midDown, leafUp := link(30)
+
+	startHub(t, 1, RangeSyncOptions{Pool: BlockPoolFromConfig(rootCfg)}, &pipeListener{conns: []core.IConnection{rootDown}}, nil)
+	midAlloc, leafAlloc := NewRangeAllocator(nil), NewRangeAllocator(nil)
+	startHub(t, 20, RangeSyncOptions{Pool: BlockPoolFromConfig(midCfg), Allocator: midAlloc}, &pipeListener{conns: []core.IConnection{midDown}}, midUp)
+	waitFor(t, "mid range", midAlloc.Assigned)
+	startHub(t, 30, RangeSyncOptions{Allocator: leafAlloc}, &pipeListener{}, leafUp)
+	waitFor(t, "leaf range", leafAlloc.Assigned)
+
+	midRange := Range{Start: 1000000, End: 1000999}
+	if got := midAlloc.Stats().Range; got != (Range{Start: 1000000, End: 1000099}) {
+		t.Fatalf("mid own range = %v, want first block of %v", got, midRange)
+	}
+	if got := leafAlloc.Stats().Range; got != (Range{Start: 1000100, End: 1000199}) {
+		t.Fatalf("leaf range = %v, want a block inside %v after the mid hub's own", got, midRange)
+	}
+}
@@ -0,0 +1,30 @@
+package permission
+
+// 本文件承载 Core 框架中与 `actionauth` 相关的通用逻辑。
+
+import (
+	"context"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+// Importing this package makes SharedAuthFunc the default for action handlers without Auth/Perms.
+func init() { subproto.SetDefaultAuthFunc(SharedAuthFunc) }
+
+// SharedAuthFunc is a subproto.AuthFunc checking the frame's subject (see subproto.CheckPermission:
+// the node bound to conn, or hdr.SourceID once the dispatcher verified it) against SharedConfig of
+// the server config found in ctx.
+// Actions that do not declare a permission (subproto.PermissionAction) are allowed: for them
+// RequireAuth only means "logged in", which the handler checks itself.
+func SharedAuthFunc(ctx context.Context, conn core.IConnection, hdr core.IHeader, act core.SubProcessAction) bool {
+	if pa, ok := act.(subproto.PermissionAction); !ok || strings.TrimSpace(pa.Permission()) == "" {
+		return true
+	}
+	var cfg core.IConfig
+	if srv := core.ServerFromContext(ctx); srv != nil {
+		cfg = srv.Config()
+	}
+	return subproto.CheckPermission(ctx, SharedConfig(cfg), conn, hdr, act)
+}
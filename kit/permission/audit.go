@@ -0,0 +1,68 @@
+package permission
+
+// 本文件承载 Core 框架中与 `audit` 相关的通用逻辑。
+
+import (
+	"log/slog"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// Decision is one permission check as reported to the audit hook.
+type Decision struct {
+	NodeID   uint32
+	Perm     string
+	Role     string // role the node resolved to at decision time
+	Allowed  bool
+	Action   string // caller-supplied context, see core.PermContext
+	ConnID   string
+	SubProto uint8
+	Time     time.Time
+}
+
+// SetAuditFunc installs fn to receive every decision made by Has/HasCtx, allowed or denied;
+// nil removes it. fn runs synchronously on the checking goroutine, so it should hand off slow
+// work (e.g. persistence) elsewhere. A panicking hook is recovered and logged.
+func (c *Config) SetAuditFunc(fn func(Decision)) {
+	if c == nil {
+		return
+	}
+	if fn == nil {
+		c.audit.Store(nil)
+		return
+	}
+	c.audit.Store(&fn)
+}
+
+// HasCtx is Has with caller context attached for the audit hook; pc does not affect the result.
+// When no audit hook is installed it costs the same as Has.
+func (c *Config) HasCtx(nodeID uint32, perm string, pc core.PermContext) bool {
+	allowed := perm == "" || nodeID == 0 || allows(c.ResolvePerms(nodeID), perm)
+	if c == nil {
+		return allowed
+	}
+	if fn := c.audit.Load(); fn != nil {
+		c.emitAudit(*fn, Decision{
+			NodeID:   nodeID,
+			Perm:     perm,
+			Role:     c.ResolveRole(nodeID),
+			Allowed:  allowed,
+			Action:   pc.Action,
+			ConnID:   pc.ConnID,
+			SubProto: pc.SubProto,
+			Time:     time.Now(),
+		})
+	}
+	return allowed
+}
+
+// emitAudit calls the hook, containing any panic so a faulty hook cannot break permission checks.
+func (c *Config) emitAudit(fn func(Decision), d Decision) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Default().Error("permission audit hook panicked", "panic", r, "node", d.NodeID, "perm", d.Perm)
+		}
+	}()
+	fn(d)
+}
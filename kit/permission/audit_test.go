@@ -0,0 +1,126 @@
+package permission
+
+// 本文件覆盖 Core 框架中与 `audit` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/subproto"
+	"github.com/yttydcs/myflowhub-core/subproto/kit"
+)
+
+func newAuditConfig() *Config {
+	return NewConfig(config.NewMap(map[string]string{
+		config.KeyAuthDefaultPerms: "",
+		config.KeyAuthNodeRoles:    "7:viewer",
+		config.KeyAuthRolePerms:    "viewer:var.subscribe",
+	}))
+}
+
+func TestAuditFuncReceivesDecisions(t *testing.T) {
+	c := newAuditConfig()
+	if c.Has(7, VarRevoke) {
+		t.Fatal("viewer granted var.revoke")
+	}
+	var got []Decision
+	c.SetAuditFunc(func(d Decision) { got = append(got, d) })
+	c.Has(7, VarSubscribe)
+	c.HasCtx(7, VarRevoke, core.PermContext{Action: "revoke", ConnID: "c1", SubProto: 4})
+	c.SetAuditFunc(nil)
+	c.Has(7, VarRevoke)
+
+	if len(got) != 2 {
+		t.Fatalf("got %d decisions, want 2: %+v", len(got), got)
+	}
+	if d := got[0]; !d.Allowed || d.Perm != VarSubscribe || d.Role != "viewer" {
+		t.Fatalf("allowed decision=%+v", d)
+	}
+	d := got[1]
+	if d.Allowed || d.NodeID != 7 || d.Perm != VarRevoke || d.Role != "viewer" ||
+		d.Action != "revoke" || d.ConnID != "c1" || d.SubProto != 4 || d.Time.IsZero() {
+		t.Fatalf("denied decision=%+v", d)
+	}
+}
+
+func TestAuditFuncPanicDoesNotBreakHas(t *testing.T) {
+	c := newAuditConfig()
+	c.SetAuditFunc(func(Decision) { panic("audit sink down") })
+	if !c.Has(7, VarSubscribe) || c.Has(7, VarRevoke) {
+		t.Fatal("decision changed by panicking audit hook")
+	}
+}
+
+func TestDispatchActionChecksPermissionForRequireAuth(t *testing.T) {
+	c := newAuditConfig()
+	var denied []Decision
+	c.SetAuditFunc(func(d Decision) {
+		if !d.Allowed {
+			denied = append(denied, d)
+		}
+	})
+	ran := map[string]bool{}
+	handler := func(name string) kit.ActionHandler {
+		return func(context.Context, core.IConnection, core.IHeader, json.RawMessage) { ran[name] = true }
+	}
+	p := &subproto.ActionBaseSubProcess{Perms: c}
+	p.RegisterAction(kit.NewAction("subscribe", handler("subscribe"), kit.WithPermission(VarSubscribe)))
+	p.RegisterAction(kit.NewAction("revoke", handler("revoke"), kit.WithPermission(VarRevoke)))
+	p.RegisterAction(kit.NewAction("ping", handler("ping")))
+
+	srvSide, client := net.Pipe()
+	defer client.Close()
+	defer srvSide.Close()
+	conn := tcp_listener.NewTCPConnection(srvSide)
+	core.SetConnNodeID(conn, 7)
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(4)
+
+	for _, action := range []string{"subscribe", "ping"} {
+		if err := p.DispatchAction(context.Background(), conn, hdr, []byte(`{"action":"`+action+`"}`)); err != nil {
+			t.Fatalf("%s: %v", action, err)
+		}
+	}
+	err := p.DispatchAction(context.Background(), conn, hdr, []byte(`{"action":"revoke"}`))
+	if !errors.Is(err, subproto.ErrPermissionDenied) {
+		t.Fatalf("revoke err=%v, want ErrPermissionDenied", err)
+	}
+	if !ran["subscribe"] || !ran["ping"] || ran["revoke"] {
+		t.Fatalf("handlers ran=%v", ran)
+	}
+	if len(denied) != 1 || denied[0].Action != "revoke" || denied[0].ConnID != conn.ID() || denied[0].SubProto != 4 {
+		t.Fatalf("denied decisions=%+v", denied)
+	}
+}
+
+func TestCheckPermissionTrustsSourceOnlyWhenVerified(t *testing.T) {
+	c := NewConfig(config.NewMap(map[string]string{
+		config.KeyAuthDefaultPerms: "",
+		config.KeyAuthNodeRoles:    "7:viewer;9:admin",
+		config.KeyAuthRolePerms:    "viewer:var.subscribe;admin:*",
+	}))
+	act := kit.NewAction("revoke", nil, kit.WithPermission(VarRevoke))
+	srvSide, client := net.Pipe()
+	defer client.Close()
+	defer srvSide.Close()
+	conn := tcp_listener.NewTCPConnection(srvSide)
+	// 登录为 7 的连接声称来源是管理员 9。
+	forged := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(2).WithSourceID(9)
+
+	if subproto.CheckPermission(context.Background(), c, conn, forged, act) {
+		t.Fatal("unauthenticated connection granted permission")
+	}
+	core.SetConnNodeID(conn, 7)
+	if subproto.CheckPermission(context.Background(), c, conn, forged, act) {
+		t.Fatal("unverified SourceID granted the claimed node's permissions")
+	}
+	if !subproto.CheckPermission(core.WithSourceVerified(context.Background()), c, conn, forged, act) {
+		t.Fatal("verified SourceID not used as the subject")
+	}
+}
@@ -7,13 +7,19 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	core "github.com/yttydcs/myflowhub-core"
 	coreconfig "github.com/yttydcs/myflowhub-core/config"
 )
 
 const (
-	Wildcard            = "*"
+	Wildcard = "*"
+	// DenyPrefix marks a deny entry, e.g. "!auth.revoke" or "!var.*".
+	DenyPrefix = "!"
+	// segmentWildcard as the last segment matches everything below the prefix, e.g. "var.*".
+	segmentWildcard = ".*"
+
 	AuthRevoke          = "auth.revoke"
 	AuthPendingList     = "auth.pending.list"
 	AuthRegisterApprove = "auth.register.approve"
@@ -31,6 +37,9 @@ type Snapshot struct {
 	DefaultPerms []string            `json:"default_perms,omitempty"`
 	NodeRoles    map[uint32]string   `json:"node_roles,omitempty"`
 	RolePerms    map[string][]string `json:"role_perms,omitempty"`
+	// Revision increases on every change of the source Config; receivers ignore snapshots
+	// whose revision is not newer than the last one they applied (see ApplySyncedSnapshot).
+	Revision uint64 `json:"revision,omitempty"`
 }
 
 // Config stores role -> permission mappings and supports runtime updates.
@@ -40,9 +49,26 @@ type Config struct {
 	defaultPerms []string
 	nodeRoles    map[uint32]string
 	rolePerms    map[string][]string
+
+	// entries last read from the core config; Reload diffs against them so that
+	// runtime state learned via UpsertNode/ApplySnapshot survives a config reload.
+	cfgNodeRoles map[uint32]string
+	cfgRolePerms map[string][]string
+
+	revision  uint64 // local revision, bumped on every mutation
+	syncedRev uint64 // revision of the last snapshot applied via ApplySyncedSnapshot
+
+	listenerMu sync.Mutex
+	listeners  map[uint64]func(Snapshot)
+	nextListen uint64
+
+	audit atomic.Pointer[func(Decision)] // see SetAuditFunc
 }
 
-var sharedConfigs sync.Map
+var (
+	sharedConfigs    sync.Map
+	subscribeReloads sync.Once
+)
 
 // NewConfig builds an isolated config instance.
 func NewConfig(cfg core.IConfig) *Config {
@@ -51,6 +77,7 @@ func NewConfig(cfg core.IConfig) *Config {
 		defaultPerms: []string{Wildcard},
 		nodeRoles:    make(map[uint32]string),
 		rolePerms:    make(map[string][]string),
+		revision:     1,
 	}
 	c.Load(cfg)
 	return c
@@ -70,6 +97,7 @@ func SharedConfig(cfg core.IConfig) *Config {
 			return inst
 		}
 	}
+	subscribeReloads.Do(func() { coreconfig.SubscribeChanges(reloadShared) })
 	inst := NewConfig(cfg)
 	actual, _ := sharedConfigs.LoadOrStore(key, inst)
 	if cfgPtr, ok := actual.(*Config); ok {
@@ -78,7 +106,16 @@ func SharedConfig(cfg core.IConfig) *Config {
 	return inst
 }
 
+// sharedKey identifies the config instance; read-only wrappers (config.Freeze) are unwrapped
+// first so that the key matches the underlying config passed to config.NotifyChanged on reload.
 func sharedKey(cfg core.IConfig) uintptr {
+	for {
+		w, ok := cfg.(interface{ Unwrap() core.IConfig })
+		if !ok || w.Unwrap() == nil {
+			break
+		}
+		cfg = w.Unwrap()
+	}
 	val := reflect.ValueOf(cfg)
 	if !val.IsValid() {
 		return 0
@@ -89,13 +126,77 @@ func sharedKey(cfg core.IConfig) uintptr {
 	return val.Pointer()
 }
 
-// Load hydrates the config from the provided source.
+// reloadShared reloads the shared instance bound to cfg after a config-changed notification.
+func reloadShared(cfg core.IConfig) {
+	key := sharedKey(cfg)
+	if key == 0 {
+		return
+	}
+	if existing, ok := sharedConfigs.Load(key); ok {
+		if inst, ok2 := existing.(*Config); ok2 {
+			inst.Reload(cfg)
+		}
+	}
+}
+
+// Load hydrates the config from the provided source, replacing node roles and role perms.
 func (c *Config) Load(cfg core.IConfig) {
 	if c == nil || cfg == nil {
 		return
 	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	defer c.notify(c.changedLocked)
+	c.loadDefaultsLocked(cfg)
+	if raw, ok := cfg.Get(coreconfig.KeyAuthNodeRoles); ok {
+		c.cfgNodeRoles = parseNodeRoles(raw)
+		c.nodeRoles = cloneNodeRoles(c.cfgNodeRoles)
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyAuthRolePerms); ok {
+		c.cfgRolePerms = parseRolePerms(raw)
+		c.rolePerms = cloneRolePerms(c.cfgRolePerms)
+	}
+	ensureMaps(c)
+}
+
+// Reload re-reads the auth.* keys after the core config changed (e.g. SIGHUP via builder.Watcher).
+// Unlike Load it diffs against the previously loaded values: node roles and role perms that the
+// old config declared but the new one drops are removed, changed ones are overwritten, and entries
+// learned at runtime (UpsertNode, synced snapshots) are kept.
+func (c *Config) Reload(cfg core.IConfig) {
+	if c == nil || cfg == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.notify(c.changedLocked)
+	c.loadDefaultsLocked(cfg)
+	ensureMaps(c)
+	if raw, ok := cfg.Get(coreconfig.KeyAuthNodeRoles); ok {
+		next := parseNodeRoles(raw)
+		for id, role := range c.cfgNodeRoles {
+			if _, keep := next[id]; !keep && c.nodeRoles[id] == role {
+				delete(c.nodeRoles, id)
+			}
+		}
+		for id, role := range next {
+			c.nodeRoles[id] = role
+		}
+		c.cfgNodeRoles = next
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyAuthRolePerms); ok {
+		next := parseRolePerms(raw)
+		for role, perms := range c.cfgRolePerms {
+			if _, keep := next[role]; !keep && reflect.DeepEqual(c.rolePerms[role], perms) {
+				delete(c.rolePerms, role)
+			}
+		}
+		for role, perms := range next {
+			c.rolePerms[role] = cloneStrings(perms)
+		}
+		c.cfgRolePerms = next
+	}
+}
+
+func (c *Config) loadDefaultsLocked(cfg core.IConfig) {
 	if raw, ok := cfg.Get(coreconfig.KeyAuthDefaultRole); ok && strings.TrimSpace(raw) != "" {
 		c.defaultRole = strings.TrimSpace(raw)
 	} else if c.defaultRole == "" {
@@ -109,13 +210,6 @@ func (c *Config) Load(cfg core.IConfig) {
 			c.defaultPerms = nil
 		}
 	}
-	if raw, ok := cfg.Get(coreconfig.KeyAuthNodeRoles); ok {
-		c.nodeRoles = parseNodeRoles(raw)
-	}
-	if raw, ok := cfg.Get(coreconfig.KeyAuthRolePerms); ok {
-		c.rolePerms = parseRolePerms(raw)
-	}
-	ensureMaps(c)
 }
 
 // Snapshot returns a deep copy of the current state.
@@ -130,15 +224,18 @@ func (c *Config) Snapshot() Snapshot {
 		DefaultPerms: cloneStrings(c.defaultPerms),
 		NodeRoles:    cloneNodeRoles(c.nodeRoles),
 		RolePerms:    cloneRolePerms(c.rolePerms),
+		Revision:     c.revision,
 	}
 }
 
-// ApplySnapshot overwrites the config with the provided snapshot.
+// ApplySnapshot overwrites the config with the provided snapshot; nil/empty fields keep their
+// current value and s.Revision is ignored (the local revision is bumped instead).
 func (c *Config) ApplySnapshot(s Snapshot) {
 	if c == nil {
 		return
 	}
 	c.mu.Lock()
+	defer c.notify(c.changedLocked)
 	if strings.TrimSpace(s.DefaultRole) != "" {
 		c.defaultRole = strings.TrimSpace(s.DefaultRole)
 	}
@@ -152,9 +249,107 @@ func (c *Config) ApplySnapshot(s Snapshot) {
 		c.rolePerms = cloneRolePerms(s.RolePerms)
 	}
 	ensureMaps(c)
+}
+
+// ApplySyncedSnapshot applies a snapshot received from the upstream hub. It is ignored (returning
+// false) unless s.Revision is newer than the last synced revision, so reordered or replayed pushes
+// cannot roll the state back. Role definitions are replaced wholesale; node roles are merged over
+// the local cache, since removals travel separately as invalidations.
+func (c *Config) ApplySyncedSnapshot(s Snapshot) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	if s.Revision <= c.syncedRev {
+		c.mu.Unlock()
+		return false
+	}
+	defer c.notify(c.changedLocked)
+	c.syncedRev = s.Revision
+	if role := strings.TrimSpace(s.DefaultRole); role != "" {
+		c.defaultRole = role
+	}
+	c.defaultPerms = cloneStrings(s.DefaultPerms)
+	c.rolePerms = cloneRolePerms(s.RolePerms)
+	ensureMaps(c)
+	for id, role := range s.NodeRoles {
+		c.nodeRoles[id] = role
+	}
+	return true
+}
+
+// ResetSyncedRevision forgets the last synced revision so the next upstream snapshot is accepted
+// regardless of its revision, e.g. after switching to a different parent.
+func (c *Config) ResetSyncedRevision() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.syncedRev = 0
 	c.mu.Unlock()
 }
 
+// Revision returns the current local revision.
+func (c *Config) Revision() uint64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.revision
+}
+
+// OnChange registers fn to be called with a fresh snapshot after every change. Callbacks run
+// synchronously on the mutating goroutine, after the lock is released, and must not block.
+// The returned func removes the listener.
+func (c *Config) OnChange(fn func(Snapshot)) (cancel func()) {
+	if c == nil || fn == nil {
+		return func() {}
+	}
+	c.listenerMu.Lock()
+	if c.listeners == nil {
+		c.listeners = make(map[uint64]func(Snapshot))
+	}
+	c.nextListen++
+	id := c.nextListen
+	c.listeners[id] = fn
+	c.listenerMu.Unlock()
+	return func() {
+		c.listenerMu.Lock()
+		delete(c.listeners, id)
+		c.listenerMu.Unlock()
+	}
+}
+
+// changedLocked bumps the revision, captures a snapshot and releases the write lock.
+// It must be called with c.mu held, typically as `defer c.notify(c.changedLocked)`.
+func (c *Config) changedLocked() Snapshot {
+	c.revision++
+	snap := Snapshot{
+		DefaultRole:  c.defaultRole,
+		DefaultPerms: cloneStrings(c.defaultPerms),
+		NodeRoles:    cloneNodeRoles(c.nodeRoles),
+		RolePerms:    cloneRolePerms(c.rolePerms),
+		Revision:     c.revision,
+	}
+	c.mu.Unlock()
+	return snap
+}
+
+// notify runs changed (which releases the lock) and fans the snapshot out to listeners.
+func (c *Config) notify(changed func() Snapshot) {
+	snap := changed()
+	c.listenerMu.Lock()
+	fns := make([]func(Snapshot), 0, len(c.listeners))
+	for _, fn := range c.listeners {
+		fns = append(fns, fn)
+	}
+	c.listenerMu.Unlock()
+	for _, fn := range fns {
+		fn(snap)
+	}
+}
+
 // UpsertNode records the authoritative role/perms for the node.
 func (c *Config) UpsertNode(nodeID uint32, role string, perms []string) {
 	if c == nil || nodeID == 0 {
@@ -162,17 +357,16 @@ func (c *Config) UpsertNode(nodeID uint32, role string, perms []string) {
 	}
 	role = strings.TrimSpace(role)
 	c.mu.Lock()
+	defer c.notify(c.changedLocked)
 	ensureMaps(c)
 	if role == "" {
 		delete(c.nodeRoles, nodeID)
-		c.mu.Unlock()
 		return
 	}
 	c.nodeRoles[nodeID] = role
 	if len(perms) > 0 {
 		c.rolePerms[role] = cloneStrings(perms)
 	}
-	c.mu.Unlock()
 }
 
 // InvalidateNodes removes cached role data for supplied node IDs (all if empty).
@@ -181,9 +375,9 @@ func (c *Config) InvalidateNodes(nodeIDs []uint32) {
 		return
 	}
 	c.mu.Lock()
+	defer c.notify(c.changedLocked)
 	if len(nodeIDs) == 0 {
 		c.nodeRoles = make(map[uint32]string)
-		c.mu.Unlock()
 		return
 	}
 	if c.nodeRoles != nil {
@@ -191,7 +385,6 @@ func (c *Config) InvalidateNodes(nodeIDs []uint32) {
 			delete(c.nodeRoles, id)
 		}
 	}
-	c.mu.Unlock()
 }
 
 // ResolveRole returns the effective role for the node (or default).
@@ -213,7 +406,7 @@ func (c *Config) resolveRoleLocked(nodeID uint32) string {
 	return c.defaultRole
 }
 
-// ResolvePerms returns the permissions tied to the node's role.
+// ResolvePerms returns the normalized permissions tied to the node's role (see NormalizePerms).
 func (c *Config) ResolvePerms(nodeID uint32) []string {
 	if c == nil {
 		return nil
@@ -222,9 +415,9 @@ func (c *Config) ResolvePerms(nodeID uint32) []string {
 	defer c.mu.RUnlock()
 	role := c.resolveRoleLocked(nodeID)
 	if perms, ok := c.rolePerms[role]; ok {
-		return cloneStrings(perms)
+		return NormalizePerms(perms)
 	}
-	return cloneStrings(c.defaultPerms)
+	return NormalizePerms(c.defaultPerms)
 }
 
 // ResolvePermsForRole returns the permissions currently bound to the supplied role.
@@ -266,20 +459,78 @@ func (c *Config) HasRole(role string) bool {
 }
 
 // Has reports whether a node can perform the specified permission string.
+//
+// Entries of the node's resolved permission list are matched with this precedence:
+//  1. deny: any "!"-prefixed entry matching perm ("!auth.revoke", "!var.*", "!*") refuses it;
+//  2. exact allow: an entry equal to perm;
+//  3. wildcard allow: "*" or a trailing-segment wildcard ("var.*" matches var.private_set and
+//     var.a.b, but not "var" itself or "variable.x");
+//  4. default: anything unmatched is refused.
+//
+// An empty perm or a zero nodeID is always allowed. Decisions are reported to the audit hook
+// (see SetAuditFunc); use HasCtx to attach the calling action and connection.
 func (c *Config) Has(nodeID uint32, perm string) bool {
-	if perm == "" || nodeID == 0 {
+	return c.HasCtx(nodeID, perm, core.PermContext{})
+}
+
+// allows evaluates perm against a normalized list using the precedence documented on Has.
+func allows(perms []string, perm string) bool {
+	allowed := false
+	for _, entry := range perms {
+		if pattern, deny := strings.CutPrefix(entry, DenyPrefix); deny {
+			if matchPerm(pattern, perm) {
+				return false
+			}
+			continue
+		}
+		if matchPerm(entry, perm) {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+// matchPerm reports whether a single allow/deny pattern (without the deny prefix) covers perm.
+func matchPerm(pattern, perm string) bool {
+	if pattern == Wildcard || pattern == perm {
 		return true
 	}
-	perms := c.ResolvePerms(nodeID)
+	if prefix, ok := strings.CutSuffix(pattern, segmentWildcard); ok && prefix != "" {
+		return strings.HasPrefix(perm, prefix+".")
+	}
+	return false
+}
+
+// NormalizePerms trims entries, folds "! perm" into "!perm", and drops empty or duplicate entries
+// while keeping the original order.
+func NormalizePerms(perms []string) []string {
 	if len(perms) == 0 {
-		return false
+		return nil
 	}
+	out := make([]string, 0, len(perms))
+	seen := make(map[string]struct{}, len(perms))
 	for _, entry := range perms {
-		if entry == Wildcard || entry == perm {
-			return true
+		entry = strings.TrimSpace(entry)
+		if rest, deny := strings.CutPrefix(entry, DenyPrefix); deny {
+			rest = strings.TrimSpace(rest)
+			if rest == "" {
+				continue
+			}
+			entry = DenyPrefix + rest
+		}
+		if entry == "" {
+			continue
+		}
+		if _, dup := seen[entry]; dup {
+			continue
 		}
+		seen[entry] = struct{}{}
+		out = append(out, entry)
 	}
-	return false
+	if len(out) == 0 {
+		return nil
+	}
+	return out
 }
 
 // NodeRoles returns a copy of current node-role mapping.
@@ -297,26 +548,7 @@ func SourceNodeID(hdr core.IHeader, conn core.IConnection) uint32 {
 	if hdr != nil && hdr.SourceID() != 0 {
 		return hdr.SourceID()
 	}
-	if conn == nil {
-		return 0
-	}
-	if v, ok := conn.GetMeta("nodeID"); ok {
-		switch val := v.(type) {
-		case uint32:
-			return val
-		case uint64:
-			return uint32(val)
-		case int:
-			if val >= 0 {
-				return uint32(val)
-			}
-		case int64:
-			if val >= 0 {
-				return uint32(val)
-			}
-		}
-	}
-	return 0
+	return core.ConnNodeID(conn)
 }
 
 func parseList(raw string) []string {
@@ -0,0 +1,151 @@
+package permission
+
+// 本文件覆盖 Core 框架中与 `permission` 相关的行为。
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/config/builder"
+)
+
+func TestHasPrecedence(t *testing.T) {
+	cases := []struct {
+		name  string
+		perms string
+		perm  string
+		want  bool
+	}{
+		{"exact allow", "var.revoke", VarRevoke, true},
+		{"unmatched defaults to deny", "var.revoke", AuthRevoke, false},
+		{"empty list denies", "", AuthRevoke, false},
+		{"global wildcard", "*", AuthRevoke, true},
+		{"segment wildcard", "var.*", VarPrivateSet, true},
+		{"segment wildcard nested", "auth.*", AuthRegisterApprove, true},
+		{"segment wildcard excludes bare prefix", "var.*", "var", false},
+		{"segment wildcard respects dot boundary", "var.*", "variable.set", false},
+		{"segment wildcard other namespace", "var.*", AuthRevoke, false},
+		{"deny beats global wildcard", "*, !auth.revoke", AuthRevoke, false},
+		{"deny leaves others allowed", "*, !auth.revoke", AuthPermitIssue, true},
+		{"deny beats exact allow", "auth.revoke, !auth.revoke", AuthRevoke, false},
+		{"deny order independent", "!auth.revoke, auth.revoke", AuthRevoke, false},
+		{"wildcard deny beats exact allow", "var.revoke, !var.*", VarRevoke, false},
+		{"wildcard deny scoped to prefix", "*, !var.*", AuthRevoke, true},
+		{"deny all", "*, !*", VarSubscribe, false},
+		{"deny without allow", "!auth.revoke", AuthPermitIssue, false},
+		{"spaced deny normalized", "*, ! auth.revoke", AuthRevoke, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := NewConfig(config.NewMap(map[string]string{
+				config.KeyAuthNodeRoles: "7:tester",
+				config.KeyAuthRolePerms: "tester:" + tc.perms,
+			}))
+			if got := c.Has(7, tc.perm); got != tc.want {
+				t.Fatalf("Has(%q) with [%s] = %v, want %v", tc.perm, tc.perms, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHasAllowsEmptyPermAndZeroNode(t *testing.T) {
+	c := NewConfig(config.NewMap(map[string]string{config.KeyAuthDefaultPerms: "!*"}))
+	if !c.Has(0, AuthRevoke) || !c.Has(7, "") {
+		t.Fatal("empty perm or zero node should always be allowed")
+	}
+	if c.Has(7, AuthRevoke) {
+		t.Fatal("default perms !* should deny")
+	}
+}
+
+func TestResolvePermsNormalizes(t *testing.T) {
+	c := NewConfig(nil)
+	c.UpsertNode(7, "ops", []string{" var.* ", "", "! auth.revoke", "var.*", "!", "auth.revoke"})
+	want := []string{"var.*", "!auth.revoke", "auth.revoke"}
+	if got := c.ResolvePerms(7); !slices.Equal(got, want) {
+		t.Fatalf("ResolvePerms=%q, want %q", got, want)
+	}
+}
+
+func TestReloadFlipsRolePermsFromYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hub.yaml")
+	write := func(rolePerms string) {
+		t.Helper()
+		body := "auth.default_perms: \"\"\nauth.node_roles: \"5:ops\"\nauth.role_perms: \"" + rolePerms + "\"\n"
+		if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+			t.Fatalf("write yaml: %v", err)
+		}
+	}
+	write("ops:var.revoke")
+	yb := builder.YAMLBuilder{Path: path}
+	loaded, err := yb.Load()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	live := config.NewMap(nil)
+	live.Merge(loaded)
+	perms := SharedConfig(live)
+	if !perms.Has(5, VarRevoke) || perms.Has(5, AuthRevoke) {
+		t.Fatal("initial role perms not applied")
+	}
+
+	write("ops:auth.revoke")
+	if err := builder.NewWatcher(yb, live, nil).Reload(); err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if perms.Has(5, VarRevoke) || !perms.Has(5, AuthRevoke) {
+		t.Fatal("role perms not flipped after reload")
+	}
+}
+
+func TestReloadReachesSharedConfigOfFrozenView(t *testing.T) {
+	live := config.NewMap(map[string]string{
+		config.KeyAuthDefaultPerms: "",
+		config.KeyAuthNodeRoles:    "5:ops",
+		config.KeyAuthRolePerms:    "ops:var.revoke",
+	})
+	// 服务开启 FreezeConfig 时 srv.Config() 为只读视图，而 Watcher 通知的是底层配置。
+	perms := SharedConfig(config.Freeze(live))
+	if perms != SharedConfig(live) {
+		t.Fatal("frozen view and underlying config resolve to different shared instances")
+	}
+	live.Set(config.KeyAuthRolePerms, "ops:auth.revoke")
+	config.NotifyChanged(live)
+	if perms.Has(5, VarRevoke) || !perms.Has(5, AuthRevoke) {
+		t.Fatal("revocation not applied to the shared config of the frozen view")
+	}
+}
+
+func TestReloadKeepsRuntimeEntries(t *testing.T) {
+	src := config.NewMap(map[string]string{
+		config.KeyAuthDefaultPerms: "",
+		config.KeyAuthNodeRoles:    "1:admin;2:ops",
+		config.KeyAuthRolePerms:    "admin:*;ops:var.revoke",
+	})
+	c := NewConfig(src)
+	c.UpsertNode(9, "guest", []string{VarSubscribe})
+	rev := c.Revision()
+
+	src.Set(config.KeyAuthNodeRoles, "1:ops")
+	src.Set(config.KeyAuthRolePerms, "ops:var.*")
+	c.Reload(src)
+
+	if got := c.ResolveRole(2); got != "node" {
+		t.Fatalf("dropped node role = %q, want default", got)
+	}
+	if got := c.ResolveRole(1); got != "ops" || !c.Has(1, VarPrivateSet) || c.Has(1, AuthRevoke) {
+		t.Fatalf("node 1 role=%q after reload", got)
+	}
+	if c.HasRole("admin") {
+		t.Fatal("role dropped from config still defined")
+	}
+	if c.ResolveRole(9) != "guest" || !c.Has(9, VarSubscribe) {
+		t.Fatal("runtime entry lost on reload")
+	}
+	if c.Revision() <= rev {
+		t.Fatal("reload did not bump revision")
+	}
+}
@@ -0,0 +1,61 @@
+package permission
+
+// 本文件覆盖 Core 框架中与 `ratelimit` 相关的行为。
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+)
+
+func TestRoleRateLimiterThrottlesNodeRoleOnly(t *testing.T) {
+	perms := NewConfig(config.NewMap(map[string]string{
+		config.KeyAuthNodeRoles: "1:admin;2:node",
+	}))
+	l := RoleRateLimiterFromConfig(perms, config.NewMap(map[string]string{
+		config.KeyAuthRoleRates: "admin:0;node:5",
+	}))
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+
+	conn := func(nodeID uint32) core.IConnection {
+		a, b := net.Pipe()
+		t.Cleanup(func() { _ = a.Close(); _ = b.Close() })
+		c := tcp_listener.NewTCPConnection(a)
+		core.SetConnNodeID(c, nodeID)
+		return c
+	}
+	admin, node := conn(1), conn(2)
+	ctx := context.Background()
+
+	passed := 0
+	for range 20 {
+		if !l.PreRoute(ctx, admin, nil) {
+			t.Fatal("admin frame throttled")
+		}
+		if l.PreRoute(ctx, node, nil) {
+			passed++
+		}
+	}
+	if passed != 5 {
+		t.Fatalf("node frames passed=%d, want burst of 5", passed)
+	}
+	if got := l.Throttled(); got != 15 {
+		t.Fatalf("Throttled()=%d, want 15", got)
+	}
+
+	now = now.Add(400 * time.Millisecond)
+	if !l.PreRoute(ctx, node, nil) || !l.PreRoute(ctx, node, nil) || l.PreRoute(ctx, node, nil) {
+		t.Fatal("node bucket should refill 2 tokens after 400ms at 5/s")
+	}
+
+	perms.UpsertNode(2, "admin", nil)
+	if !l.PreRoute(ctx, node, nil) {
+		t.Fatal("node promoted to admin should no longer be throttled")
+	}
+}
@@ -0,0 +1,214 @@
+package permission
+
+// 本文件承载 Core 框架中与 `sync` 相关的通用逻辑。
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/events"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/subproto"
+	"github.com/yttydcs/myflowhub-core/subproto/kit"
+)
+
+// Actions of the permission sync protocol, carried on the auth subproto.
+const (
+	// ActionPermsPull (child -> parent) asks for the full snapshot; the parent answers with
+	// ActionPermsPush and keeps pushing to that connection on every later change.
+	ActionPermsPull = "perms_pull"
+	// ActionPermsPush (parent -> child) carries a Snapshot; stale revisions are ignored.
+	ActionPermsPush = "perms_push"
+	// ActionPermsInvalidate (parent -> children, broadcast) drops cached node roles; data is
+	// InvalidateData. Each hub applies it and forwards it to its own subscribed children.
+	ActionPermsInvalidate = "perms_invalidate"
+
+	// AuthSubProto is the subproto the sync actions are registered on.
+	AuthSubProto uint8 = 2
+
+	// metaSyncSubscriber marks child connections that pulled the snapshot and receive pushes.
+	metaSyncSubscriber = "perms_sync"
+)
+
+// InvalidateData is the payload of ActionPermsInvalidate; empty NodeIDs means all nodes.
+type InvalidateData struct {
+	NodeIDs []uint32 `json:"node_ids,omitempty"`
+}
+
+// Sync propagates a Config from a parent hub to its child hubs.
+//
+// On the parent it answers perms_pull and pushes the snapshot to every subscribed child whenever
+// the Config changes. On the child it pulls on parent.ready and applies pushes from the parent
+// link only. A hub in the middle of a tree does both, so changes cascade down.
+type Sync struct {
+	cfg *Config
+	log *slog.Logger
+	enc *subproto.ActionBaseSubProcess // envelope encoding only
+
+	mu     sync.Mutex
+	srv    core.IServer
+	detach func()
+}
+
+// SyncOptions configures NewSync.
+type SyncOptions struct {
+	Logger *slog.Logger
+	// Envelope is the envelope codec used when the connection does not select one; nil means JSON.
+	Envelope subproto.EnvelopeCodec
+}
+
+// NewSync creates a sync component bound to cfg.
+func NewSync(cfg *Config, opts SyncOptions) *Sync {
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return &Sync{cfg: cfg, log: log, enc: &subproto.ActionBaseSubProcess{Envelope: opts.Envelope}}
+}
+
+// Actions returns the sync actions for registration on the auth subprocess.
+func (s *Sync) Actions() []core.SubProcessAction {
+	return []core.SubProcessAction{
+		kit.NewAction(ActionPermsPull, s.handlePull, kit.WithRequireAuth(true)),
+		kit.NewAction(ActionPermsPush, s.handlePush),
+		kit.NewAction(ActionPermsInvalidate, s.handleInvalidate),
+	}
+}
+
+// Attach starts syncing on srv: pull from the parent whenever parent.ready fires and push local
+// changes to subscribed children. The returned func (also called by a repeated Attach) stops both.
+func (s *Sync) Attach(srv core.IServer) (detach func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detach != nil {
+		s.detach()
+	}
+	s.srv = srv
+	bus := srv.EventBus()
+	tok := bus.Subscribe(events.ParentReady, s.onParentReady)
+	cancel := s.cfg.OnChange(s.pushAll)
+	var once sync.Once
+	s.detach = func() {
+		once.Do(func() {
+			bus.Unsubscribe(events.ParentReady, tok)
+			cancel()
+		})
+	}
+	return s.detach
+}
+
+// Invalidate drops cached roles for nodeIDs (all if empty) and broadcasts the invalidation to
+// subscribed children.
+func (s *Sync) Invalidate(ctx context.Context, nodeIDs []uint32) {
+	s.cfg.InvalidateNodes(nodeIDs)
+	s.broadcast(ctx, ActionPermsInvalidate, InvalidateData{NodeIDs: nodeIDs})
+}
+
+func (s *Sync) server() core.IServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.srv
+}
+
+// onParentReady pulls the snapshot from a freshly established parent link. The new parent may
+// count revisions differently, so the synced revision is reset first.
+func (s *Sync) onParentReady(ctx context.Context, evt eventbus.Event) {
+	data, _ := evt.Data.(map[string]any)
+	connID, _ := data["conn_id"].(string)
+	srv := s.server()
+	if connID == "" || srv == nil {
+		return
+	}
+	s.cfg.ResetSyncedRevision()
+	conn, ok := srv.ConnManager().Get(connID)
+	if !ok {
+		return
+	}
+	if err := s.send(ctx, srv, conn, ActionPermsPull, nil); err != nil {
+		s.log.Warn("perms pull failed", "conn", connID, "err", err)
+	}
+}
+
+// handlePull subscribes the child connection and replies with the current snapshot.
+func (s *Sync) handlePull(ctx context.Context, conn core.IConnection, _ core.IHeader, _ json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		srv = s.server()
+	}
+	if srv == nil {
+		return
+	}
+	conn.SetMeta(metaSyncSubscriber, true)
+	if err := s.send(ctx, srv, conn, ActionPermsPush, s.cfg.Snapshot()); err != nil {
+		s.log.Warn("perms push failed", "conn", conn.ID(), "err", err)
+	}
+}
+
+// handlePush applies a snapshot sent by the parent.
+func (s *Sync) handlePush(_ context.Context, conn core.IConnection, _ core.IHeader, data json.RawMessage) {
+	if core.ConnRole(conn) != core.RoleParent {
+		s.log.Warn("perms push from non-parent ignored", "conn", conn.ID())
+		return
+	}
+	var snap Snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		s.log.Warn("invalid perms push", "conn", conn.ID(), "err", err)
+		return
+	}
+	if !s.cfg.ApplySyncedSnapshot(snap) {
+		s.log.Debug("stale perms push ignored", "conn", conn.ID(), "revision", snap.Revision)
+	}
+}
+
+// handleInvalidate applies an invalidation from the parent and forwards it downstream.
+func (s *Sync) handleInvalidate(ctx context.Context, conn core.IConnection, _ core.IHeader, data json.RawMessage) {
+	if core.ConnRole(conn) != core.RoleParent {
+		s.log.Warn("perms invalidate from non-parent ignored", "conn", conn.ID())
+		return
+	}
+	var req InvalidateData
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.log.Warn("invalid perms invalidate", "conn", conn.ID(), "err", err)
+			return
+		}
+	}
+	s.Invalidate(ctx, req.NodeIDs)
+}
+
+// pushAll sends snap to every subscribed child; it is the Config.OnChange listener.
+func (s *Sync) pushAll(snap Snapshot) {
+	s.broadcast(context.Background(), ActionPermsPush, snap)
+}
+
+func (s *Sync) broadcast(ctx context.Context, action string, data any) {
+	srv := s.server()
+	if srv == nil {
+		return
+	}
+	srv.ConnManager().Range(func(conn core.IConnection) bool {
+		if v, ok := conn.GetMeta(metaSyncSubscriber); ok && v == true && core.ConnRole(conn) != core.RoleParent {
+			if err := s.send(ctx, srv, conn, action, data); err != nil {
+				s.log.Warn("perms sync send failed", "action", action, "conn", conn.ID(), "err", err)
+			}
+		}
+		return true
+	})
+}
+
+func (s *Sync) send(ctx context.Context, srv core.IServer, conn core.IConnection, action string, data any) error {
+	payload, err := s.enc.EncodeAction(conn, action, data)
+	if err != nil {
+		return err
+	}
+	hdr := (&header.HeaderTcp{}).
+		WithMajor(header.MajorCmd).
+		WithSubProto(AuthSubProto).
+		WithSourceID(srv.NodeID()).
+		WithTargetID(core.ConnNodeID(conn))
+	return srv.Send(ctx, conn.ID(), hdr, payload)
+}
@@ -0,0 +1,162 @@
+package permission
+
+// 本文件覆盖 Core 框架中与 `sync` 相关的行为。
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/server"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+func TestApplySyncedSnapshotIgnoresStaleRevisions(t *testing.T) {
+	c := NewConfig(nil)
+	if !c.ApplySyncedSnapshot(Snapshot{RolePerms: map[string][]string{"node": {"a"}}, Revision: 5}) {
+		t.Fatal("first snapshot rejected")
+	}
+	if c.ApplySyncedSnapshot(Snapshot{RolePerms: map[string][]string{"node": {"b"}}, Revision: 4}) {
+		t.Fatal("stale snapshot applied")
+	}
+	if !c.Has(1, "a") || c.Has(1, "b") {
+		t.Fatalf("perms=%v, want [a]", c.ResolvePerms(1))
+	}
+	c.ResetSyncedRevision()
+	if !c.ApplySyncedSnapshot(Snapshot{RolePerms: map[string][]string{"node": {"b"}}, Revision: 1}) {
+		t.Fatal("snapshot after reset rejected")
+	}
+}
+
+func TestConfigOnChangeReportsIncreasingRevisions(t *testing.T) {
+	c := NewConfig(nil)
+	var got []uint64
+	cancel := c.OnChange(func(s Snapshot) { got = append(got, s.Revision) })
+	c.UpsertNode(7, "admin", []string{"*"})
+	c.InvalidateNodes([]uint32{7})
+	cancel()
+	c.UpsertNode(8, "admin", nil)
+	if len(got) != 2 || got[1] <= got[0] || got[1] != c.Revision()-1 {
+		t.Fatalf("revisions=%v, current=%d", got, c.Revision())
+	}
+}
+
+// authProcess 是测试用的 SubProto=2 处理器，只承载 perms 同步 action。
+type authProcess struct {
+	subproto.ActionBaseSubProcess
+}
+
+func (p *authProcess) SubProto() uint8           { return AuthSubProto }
+func (p *authProcess) AllowSourceMismatch() bool { return true }
+func (p *authProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	_ = p.DispatchAction(ctx, conn, hdr, payload)
+}
+
+type pipeListener struct {
+	conns []core.IConnection
+}
+
+func (l *pipeListener) Protocol() string { return "pipe" }
+func (l *pipeListener) Addr() net.Addr   { return nil }
+func (l *pipeListener) Close() error     { return nil }
+func (l *pipeListener) Listen(ctx context.Context, cm core.IConnectionManager) error {
+	for _, c := range l.conns {
+		if err := cm.Add(c); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// startHub 启动挂载 perms 同步的 hub；parent 非 nil 时作为子 hub 拨向它。
+func startHub(t *testing.T, nodeID uint32, perms *Config, lst core.IListener, parent core.IConnection) *Sync {
+	t.Helper()
+	sync := NewSync(perms, SyncOptions{})
+	auth := &authProcess{}
+	for _, act := range sync.Actions() {
+		auth.RegisterAction(act)
+	}
+	disp, err := process.NewDispatcher(process.DispatchOptions{ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 16})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	if err := disp.RegisterHandler(auth); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	cfg := map[string]string{}
+	opts := server.Options{
+		NodeID:   nodeID,
+		Process:  disp,
+		Codec:    header.HeaderTcpCodec{},
+		Listener: lst,
+		Manager:  connmgr.New(),
+	}
+	if parent != nil {
+		cfg[config.KeyParentEnable] = "true"
+		cfg[config.KeyParentAddrs] = "parent"
+		opts.ParentDialer = func(context.Context, string) (core.IConnection, error) { return parent, nil }
+	}
+	opts.Config = config.NewMap(cfg)
+	srv, err := server.New(opts)
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	detach := sync.Attach(srv)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		detach()
+		_ = srv.Stop(context.Background())
+	})
+	return sync
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSyncPropagatesParentChangesToChildHub(t *testing.T) {
+	parentSide, childSide := net.Pipe()
+	t.Cleanup(func() { _ = parentSide.Close(); _ = childSide.Close() })
+	downlink := tcp_listener.NewTCPConnection(parentSide)
+	core.SetConnNodeID(downlink, 20)
+
+	parentPerms := NewConfig(config.NewMap(map[string]string{
+		config.KeyAuthDefaultPerms: "",
+		config.KeyAuthNodeRoles:    "7:viewer",
+		config.KeyAuthRolePerms:    "viewer:var.subscribe",
+	}))
+	childPerms := NewConfig(config.NewMap(map[string]string{config.KeyAuthDefaultPerms: ""}))
+	parentSync := startHub(t, 1, parentPerms, &pipeListener{conns: []core.IConnection{downlink}}, nil)
+	startHub(t, 20, childPerms, &pipeListener{}, tcp_listener.NewTCPConnection(childSide))
+
+	waitFor(t, "initial pull", func() bool { return childPerms.ResolveRole(7) == "viewer" })
+	if !childPerms.Has(7, VarSubscribe) || childPerms.Has(7, VarPrivateSet) {
+		t.Fatalf("child perms for viewer = %v, want [%s]", childPerms.ResolvePerms(7), VarSubscribe)
+	}
+
+	parentPerms.UpsertNode(7, "admin", []string{"var.*"})
+	waitFor(t, "role change push", func() bool { return childPerms.Has(7, VarPrivateSet) })
+
+	parentSync.Invalidate(context.Background(), []uint32{7})
+	waitFor(t, "invalidation", func() bool { return childPerms.ResolveRole(7) == "node" })
+	if childPerms.Has(7, VarPrivateSet) {
+		t.Fatal("child still grants the revoked role's perms")
+	}
+}
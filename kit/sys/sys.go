@@ -0,0 +1,382 @@
+package sys
+
+// 本文件承载 Core 框架中与 `sys` 相关的通用逻辑。
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/events"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/subproto"
+	"github.com/yttydcs/myflowhub-core/subproto/kit"
+)
+
+// DefaultSubProto is the subproto SysHandler registers on unless Options.SubProto overrides it.
+const DefaultSubProto uint8 = 62
+
+// Permissions gating the actions: read-only introspection vs. changes to the running hub.
+const (
+	PermRead  = "sys.read"
+	PermWrite = "sys.write"
+)
+
+// Actions of the sys subprotocol. Each reply is sent as "<action>_resp".
+const (
+	ActionStats      = "stats"
+	ActionListConns  = "list_conns"
+	ActionListRoutes = "list_routes"
+	ActionGetConfig  = "get_config"
+	ActionSetConfig  = "set_config"
+	ActionKickConn   = "kick_conn"
+)
+
+// Reply codes; CodeOK follows the other action protocols.
+const (
+	CodeOK         = 1
+	CodeBadRequest = 4000
+	CodeDenied     = 4003
+	CodeNotFound   = 4004
+)
+
+// Redacted replaces the value of secret config keys in get_config and config.changed.
+const Redacted = "***"
+
+// Resp is the common part of every reply.
+type Resp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg,omitempty"`
+}
+
+// StatsResp is the reply to stats.
+type StatsResp struct {
+	Resp
+	NodeID      uint32                            `json:"node_id"`
+	Connections int                               `json:"connections"`
+	Dispatcher  *DispatcherStats                  `json:"dispatcher,omitempty"`
+	SubProtos   map[uint8]process.SubProtoMetrics `json:"subprotos,omitempty"`
+}
+
+// DispatcherStats is the topology of the inbound dispatcher.
+type DispatcherStats struct {
+	Channels int `json:"channels"`
+	Workers  int `json:"workers"`
+	Buffer   int `json:"buffer"`
+}
+
+// ListConnsResp is the reply to list_conns, sorted by connection ID.
+type ListConnsResp struct {
+	Resp
+	Conns []core.ConnInfo `json:"conns"`
+}
+
+// ListRoutesResp is the reply to list_routes: the exact node/device indexes, the subtree
+// summary routes and the active parent link (empty when there is none).
+type ListRoutesResp struct {
+	Resp
+	Nodes        map[uint32][]string    `json:"nodes"`
+	Devices      map[string]string      `json:"devices"`
+	Subtrees     []process.SubtreeRoute `json:"subtrees"`
+	ParentConnID string                 `json:"parent_conn_id,omitempty"`
+}
+
+// GetConfigReq selects keys; empty returns every key.
+type GetConfigReq struct {
+	Keys []string `json:"keys,omitempty"`
+}
+
+// GetConfigResp is the reply to get_config; secret values are Redacted.
+type GetConfigResp struct {
+	Resp
+	Config map[string]string `json:"config"`
+}
+
+// SetConfigReq sets one key.
+type SetConfigReq struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// KickConnReq closes one connection; Reason is sent in the bye frame.
+type KickConnReq struct {
+	ConnID string `json:"conn_id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Options configures NewSysHandler.
+type Options struct {
+	Logger *slog.Logger
+	// Perms checks sys.read / sys.write; nil denies every action, since an unguarded sys
+	// subprotocol would let any node reconfigure the hub.
+	Perms core.IPermissionChecker
+	// Routes is the routing table listed by list_routes; nil lists only the indexes.
+	Routes *process.RoutingTable
+	// SubProto overrides DefaultSubProto.
+	SubProto uint8
+	// Envelope is the envelope codec used when the connection does not select one; nil means JSON.
+	Envelope subproto.EnvelopeCodec
+}
+
+// SysHandler answers runtime introspection and control requests for the hub it runs on.
+type SysHandler struct {
+	subproto.ActionBaseSubProcess
+	log    *slog.Logger
+	sub    uint8
+	routes *process.RoutingTable
+}
+
+// NewSysHandler creates the handler with every action registered.
+func NewSysHandler(opts Options) *SysHandler {
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	sub := opts.SubProto
+	if sub == 0 {
+		sub = DefaultSubProto
+	}
+	h := &SysHandler{log: log, sub: sub, routes: opts.Routes}
+	h.Envelope = opts.Envelope
+	h.Perms = opts.Perms
+	if h.Perms == nil {
+		h.Perms = denyAll{}
+	}
+	h.RegisterAction(kit.NewAction(ActionStats, h.handleStats, kit.WithPermission(PermRead)))
+	h.RegisterAction(kit.NewAction(ActionListConns, h.handleListConns, kit.WithPermission(PermRead)))
+	h.RegisterAction(kit.NewAction(ActionListRoutes, h.handleListRoutes, kit.WithPermission(PermRead)))
+	h.RegisterAction(kit.NewAction(ActionGetConfig, h.handleGetConfig, kit.WithPermission(PermRead)))
+	h.RegisterAction(kit.NewAction(ActionSetConfig, h.handleSetConfig, kit.WithPermission(PermWrite)))
+	h.RegisterAction(kit.NewAction(ActionKickConn, h.handleKickConn, kit.WithPermission(PermWrite)))
+	return h
+}
+
+// SubProto returns the subproto the handler is registered on.
+func (h *SysHandler) SubProto() uint8 { return h.sub }
+
+// OnReceive dispatches the action and answers denied or unknown actions with an error reply.
+// Connections that have not logged in are denied outright: the permission checker treats node 0
+// as the local hub and would allow everything.
+func (h *SysHandler) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	var err error
+	if core.ConnNodeID(conn) == 0 {
+		err = fmt.Errorf("%w: not logged in", subproto.ErrPermissionDenied)
+	} else {
+		err = h.DispatchAction(ctx, conn, hdr, payload)
+	}
+	if err == nil {
+		return
+	}
+	env, _ := h.EnvelopeCodec(conn).Decode(payload)
+	resp := Resp{Code: CodeBadRequest, Msg: err.Error()}
+	switch {
+	case errors.Is(err, subproto.ErrPermissionDenied):
+		resp.Code = CodeDenied
+	case errors.Is(err, subproto.ErrUnknownAction):
+		resp.Code = CodeNotFound
+	}
+	h.log.Debug("sys request rejected", "conn", conn.ID(), "action", env.Action, "err", err)
+	h.reply(ctx, conn, hdr, env.Action, resp)
+}
+
+func (h *SysHandler) handleStats(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	resp := StatsResp{Resp: Resp{Code: CodeOK}, NodeID: srv.NodeID(), Connections: srv.ConnManager().Count()}
+	if d, ok := srv.Process().(*process.DispatcherProcess); ok {
+		channels, workers, buffer := d.ConfigSnapshot()
+		resp.Dispatcher = &DispatcherStats{Channels: channels, Workers: workers, Buffer: buffer}
+		resp.SubProtos = d.Metrics()
+	}
+	h.reply(ctx, conn, hdr, ActionStats, resp)
+}
+
+func (h *SysHandler) handleListConns(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	var conns []core.ConnInfo
+	if snap, ok := srv.(core.IConnSnapshotter); ok {
+		conns = snap.SnapshotConnections()
+	} else {
+		srv.ConnManager().Range(func(c core.IConnection) bool {
+			conns = append(conns, core.ConnInfoOf(c))
+			return true
+		})
+	}
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ID < conns[j].ID })
+	h.reply(ctx, conn, hdr, ActionListConns, ListConnsResp{Resp: Resp{Code: CodeOK}, Conns: conns})
+}
+
+func (h *SysHandler) handleListRoutes(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	resp := ListRoutesResp{Resp: Resp{Code: CodeOK}, Subtrees: h.routes.Subtrees()}
+	if snap, ok := srv.(core.IConnSnapshotter); ok {
+		idx := snap.SnapshotIndexes()
+		resp.Nodes, resp.Devices = idx.Nodes, idx.Devices
+	}
+	if resp.Subtrees == nil {
+		resp.Subtrees = []process.SubtreeRoute{}
+	}
+	srv.ConnManager().Range(func(c core.IConnection) bool {
+		if core.ConnRole(c) != core.RoleParent {
+			return true
+		}
+		if standby, _ := c.GetMeta(core.MetaParentStandbyKey); standby == true && resp.ParentConnID != "" {
+			return true
+		}
+		resp.ParentConnID = c.ID()
+		return true
+	})
+	h.reply(ctx, conn, hdr, ActionListRoutes, resp)
+}
+
+func (h *SysHandler) handleGetConfig(ctx context.Context, conn core.IConnection, hdr core.IHeader, data json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	var req GetConfigReq
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &req); err != nil {
+			h.reply(ctx, conn, hdr, ActionGetConfig, Resp{Code: CodeBadRequest, Msg: err.Error()})
+			return
+		}
+	}
+	cfg := srv.Config()
+	keys := req.Keys
+	if len(keys) == 0 && cfg != nil {
+		keys = cfg.Keys()
+	}
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if cfg == nil {
+			break
+		}
+		if v, ok := cfg.Get(k); ok {
+			out[k] = redact(k, v)
+		}
+	}
+	h.reply(ctx, conn, hdr, ActionGetConfig, GetConfigResp{Resp: Resp{Code: CodeOK}, Config: out})
+}
+
+// handleSetConfig applies the change through IConfig.Set, publishes config.changed on the
+// event bus and notifies in-process config subscribers (e.g. permission.SharedConfig).
+func (h *SysHandler) handleSetConfig(ctx context.Context, conn core.IConnection, hdr core.IHeader, data json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	var req SetConfigReq
+	if err := json.Unmarshal(data, &req); err != nil || strings.TrimSpace(req.Key) == "" {
+		h.reply(ctx, conn, hdr, ActionSetConfig, Resp{Code: CodeBadRequest, Msg: "key required"})
+		return
+	}
+	cfg := srv.Config()
+	if cfg == nil {
+		h.reply(ctx, conn, hdr, ActionSetConfig, Resp{Code: CodeNotFound, Msg: "no config"})
+		return
+	}
+	if config.IsFrozen(cfg) {
+		h.reply(ctx, conn, hdr, ActionSetConfig, Resp{Code: CodeDenied, Msg: "config is read-only"})
+		return
+	}
+	key := strings.TrimSpace(req.Key)
+	old, _ := cfg.Get(key)
+	cfg.Set(key, req.Value)
+	source := sourceNodeID(conn, hdr)
+	h.log.Info("config set via sys", "key", key, "node", source, "conn", conn.ID())
+	if bus := srv.EventBus(); bus != nil {
+		bus.TryPublish(ctx, events.ConfigChanged, events.ConfigChangedData{
+			Key:    key,
+			Old:    redact(key, old),
+			Value:  redact(key, req.Value),
+			NodeID: source,
+		}, nil)
+	}
+	config.NotifyChanged(cfg)
+	h.reply(ctx, conn, hdr, ActionSetConfig, Resp{Code: CodeOK})
+}
+
+// kickConner is implemented by server.Server; other servers fall back to removing the conn.
+type kickConner interface {
+	KickConn(connID, reason string) bool
+}
+
+func (h *SysHandler) handleKickConn(ctx context.Context, conn core.IConnection, hdr core.IHeader, data json.RawMessage) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil {
+		return
+	}
+	var req KickConnReq
+	if err := json.Unmarshal(data, &req); err != nil || req.ConnID == "" {
+		h.reply(ctx, conn, hdr, ActionKickConn, Resp{Code: CodeBadRequest, Msg: "conn_id required"})
+		return
+	}
+	if req.ConnID == conn.ID() {
+		h.reply(ctx, conn, hdr, ActionKickConn, Resp{Code: CodeBadRequest, Msg: "cannot kick the requesting conn"})
+		return
+	}
+	kicked := false
+	if k, ok := srv.(kickConner); ok {
+		kicked = k.KickConn(req.ConnID, req.Reason)
+	} else if target, ok := srv.ConnManager().Get(req.ConnID); ok {
+		core.MarkCloseReason(target, core.CloseReasonKicked)
+		kicked = srv.ConnManager().Remove(req.ConnID) == nil
+	}
+	if !kicked {
+		h.reply(ctx, conn, hdr, ActionKickConn, Resp{Code: CodeNotFound, Msg: "conn not found"})
+		return
+	}
+	h.log.Info("conn kicked via sys", "target", req.ConnID, "node", sourceNodeID(conn, hdr))
+	h.reply(ctx, conn, hdr, ActionKickConn, Resp{Code: CodeOK})
+}
+
+func (h *SysHandler) reply(ctx context.Context, conn core.IConnection, hdr core.IHeader, action string, data any) {
+	payload, err := h.EncodeAction(conn, action+"_resp", data)
+	if err != nil {
+		h.log.Warn("encode sys reply failed", "action", action, "err", err)
+		return
+	}
+	kit.SendResponse(ctx, h.log, conn, hdr, payload, h.sub)
+}
+
+// secretKeyParts mark config keys whose values never leave the hub.
+var secretKeyParts = []string{"privkey", "credential", "secret", "password", "token"}
+
+func redact(key, value string) string {
+	if value == "" {
+		return value
+	}
+	k := strings.ToLower(key)
+	for _, part := range secretKeyParts {
+		if strings.Contains(k, part) {
+			return Redacted
+		}
+	}
+	return value
+}
+
+func sourceNodeID(conn core.IConnection, hdr core.IHeader) uint32 {
+	if hdr != nil && hdr.SourceID() != 0 {
+		return hdr.SourceID()
+	}
+	return core.ConnNodeID(conn)
+}
+
+// denyAll is the checker used when Options.Perms is nil.
+type denyAll struct{}
+
+func (denyAll) HasCtx(uint32, string, core.PermContext) bool { return false }
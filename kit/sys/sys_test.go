@@ -0,0 +1,242 @@
+package sys
+
+// 本文件覆盖 Core 框架中与 `sys` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/events"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/kit/permission"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/server"
+	"github.com/yttydcs/myflowhub-core/subproto"
+)
+
+type pipeListener struct {
+	conns []core.IConnection
+}
+
+func (l *pipeListener) Protocol() string { return "pipe" }
+func (l *pipeListener) Addr() net.Addr   { return nil }
+func (l *pipeListener) Close() error     { return nil }
+func (l *pipeListener) Listen(ctx context.Context, cm core.IConnectionManager) error {
+	for _, c := range l.conns {
+		if err := cm.Add(c); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// sysHub 是挂载 SysHandler 的单节点 hub，clients 按节点号索引各自的客户端一端。
+type sysHub struct {
+	srv     *server.Server
+	cfg     core.IConfig
+	clients map[uint32]net.Conn
+	conns   map[uint32]core.IConnection
+}
+
+func startSysHub(t *testing.T, nodes ...uint32) *sysHub {
+	t.Helper()
+	perms := permission.NewConfig(config.NewMap(map[string]string{
+		config.KeyAuthNodeRoles: "5:admin;6:viewer",
+		config.KeyAuthRolePerms: "admin:sys.read,sys.write;viewer:sys.read",
+	}))
+	routes := process.NewRoutingTable()
+	h := NewSysHandler(Options{Perms: perms, Routes: routes})
+	disp, err := process.NewDispatcher(process.DispatchOptions{ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 16})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	if err := disp.RegisterHandler(h); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	hub := &sysHub{clients: make(map[uint32]net.Conn), conns: make(map[uint32]core.IConnection)}
+	ids := core.CounterConnID("c-") // 全部为 pipe->pipe，按地址生成的 ID 会冲突
+	var conns []core.IConnection
+	for _, node := range nodes {
+		srvSide, client := net.Pipe()
+		t.Cleanup(func() { _ = srvSide.Close(); _ = client.Close() })
+		c := tcp_listener.NewTCPConnectionWithID(srvSide, ids)
+		core.SetConnNodeID(c, node)
+		conns = append(conns, c)
+		hub.clients[node], hub.conns[node] = client, c
+	}
+	hub.cfg = config.NewMap(map[string]string{config.KeyAuthNodePrivKey: "c2VjcmV0"})
+	hub.srv, err = server.New(server.Options{
+		NodeID:   1,
+		Process:  disp,
+		Codec:    header.HeaderTcpCodec{},
+		Listener: &pipeListener{conns: conns},
+		Manager:  connmgr.New(),
+		Config:   hub.cfg,
+	})
+	if err != nil {
+		t.Fatalf("server.New: %v", err)
+	}
+	if err := hub.srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = hub.srv.Stop(context.Background()) })
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.srv.ConnManager().Count() < len(nodes) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	for node, c := range hub.conns {
+		hub.srv.ConnManager().UpdateNodeIndex(node, c)
+	}
+	if len(nodes) > 0 {
+		if err := routes.AddSubtree(0x10000000, 8, hub.conns[nodes[len(nodes)-1]].ID()); err != nil {
+			t.Fatalf("AddSubtree: %v", err)
+		}
+	}
+	return hub
+}
+
+// call 以 node 的身份发送一个 sys action，返回回包的 action 名并把 data 解到 out。
+func (h *sysHub) call(t *testing.T, node uint32, action string, data, out any) string {
+	t.Helper()
+	payload, err := (&subproto.ActionBaseSubProcess{}).EncodeAction(nil, action, data)
+	if err != nil {
+		t.Fatalf("encode %s: %v", action, err)
+	}
+	req := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(DefaultSubProto).
+		WithSourceID(node).WithTargetID(1).WithMsgID(uint32(len(action)))
+	frame, _ := header.HeaderTcpCodec{}.Encode(req, payload)
+	client := h.clients[node]
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("write %s: %v", action, err)
+	}
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	hdr, body, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil {
+		t.Fatalf("%s reply: %v", action, err)
+	}
+	if hdr.Major() != header.MajorOKResp || hdr.SubProto() != DefaultSubProto || hdr.GetMsgID() != req.GetMsgID() {
+		t.Fatalf("%s reply header major=%d sub=%d msg=%d", action, hdr.Major(), hdr.SubProto(), hdr.GetMsgID())
+	}
+	var env subproto.Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		t.Fatalf("%s reply envelope: %v", action, err)
+	}
+	if err := json.Unmarshal(env.Data, out); err != nil {
+		t.Fatalf("%s reply data %s: %v", action, env.Data, err)
+	}
+	return env.Action
+}
+
+func TestSysReadActions(t *testing.T) {
+	hub := startSysHub(t, 5, 6, 7)
+
+	var stats StatsResp
+	if act := hub.call(t, 6, ActionStats, nil, &stats); act != "stats_resp" || stats.Code != CodeOK {
+		t.Fatalf("stats action=%s resp=%+v", act, stats)
+	}
+	if stats.NodeID != 1 || stats.Connections != 3 || stats.Dispatcher == nil || stats.Dispatcher.Channels != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if m, ok := stats.SubProtos[DefaultSubProto]; !ok || m.Received == 0 {
+		t.Fatalf("stats subprotos = %+v, want the sys subproto counted", stats.SubProtos)
+	}
+
+	var conns ListConnsResp
+	hub.call(t, 6, ActionListConns, nil, &conns)
+	if conns.Code != CodeOK || len(conns.Conns) != 3 || conns.Conns[0].ID > conns.Conns[1].ID {
+		t.Fatalf("list_conns = %+v", conns)
+	}
+
+	var routes ListRoutesResp
+	hub.call(t, 6, ActionListRoutes, nil, &routes)
+	victim := hub.conns[7].ID()
+	if routes.Code != CodeOK || len(routes.Nodes[7]) != 1 || routes.Nodes[7][0] != victim {
+		t.Fatalf("list_routes nodes = %+v", routes.Nodes)
+	}
+	if len(routes.Subtrees) != 1 || routes.Subtrees[0] != (process.SubtreeRoute{Base: 0x10000000, Bits: 8, ConnID: victim}) {
+		t.Fatalf("list_routes subtrees = %+v", routes.Subtrees)
+	}
+
+	var cfg GetConfigResp
+	hub.call(t, 6, ActionGetConfig, GetConfigReq{Keys: []string{config.KeyAuthNodePrivKey, config.KeyProcChannelCount, "missing"}}, &cfg)
+	if cfg.Code != CodeOK || len(cfg.Config) != 2 || cfg.Config[config.KeyAuthNodePrivKey] != Redacted || cfg.Config[config.KeyProcChannelCount] != "1" {
+		t.Fatalf("get_config = %+v", cfg)
+	}
+	var all GetConfigResp
+	hub.call(t, 6, ActionGetConfig, nil, &all)
+	if len(all.Config) != len(hub.cfg.Keys()) {
+		t.Fatalf("get_config without keys returned %d of %d keys", len(all.Config), len(hub.cfg.Keys()))
+	}
+}
+
+func TestSysWriteActionsRequireSysWrite(t *testing.T) {
+	hub := startSysHub(t, 5, 6, 7)
+	changed := make(chan events.ConfigChangedData, 1)
+	hub.srv.EventBus().Subscribe(events.ConfigChanged, func(_ context.Context, evt eventbus.Event) {
+		changed <- evt.Data.(events.ConfigChangedData)
+	})
+
+	var resp Resp
+	if act := hub.call(t, 6, ActionSetConfig, SetConfigReq{Key: config.KeyProcChannelCount, Value: "4"}, &resp); act != "set_config_resp" || resp.Code != CodeDenied {
+		t.Fatalf("viewer set_config action=%s resp=%+v, want denied", act, resp)
+	}
+	if v, _ := hub.cfg.Get(config.KeyProcChannelCount); v != "1" {
+		t.Fatalf("denied set_config changed the value to %q", v)
+	}
+	hub.call(t, 6, ActionKickConn, KickConnReq{ConnID: hub.conns[7].ID()}, &resp)
+	if resp.Code != CodeDenied {
+		t.Fatalf("viewer kick_conn = %+v, want denied", resp)
+	}
+
+	hub.call(t, 5, ActionSetConfig, SetConfigReq{Key: config.KeyProcChannelCount, Value: "4"}, &resp)
+	if resp.Code != CodeOK {
+		t.Fatalf("admin set_config = %+v", resp)
+	}
+	if v, _ := hub.cfg.Get(config.KeyProcChannelCount); v != "4" {
+		t.Fatalf("set_config value = %q, want 4", v)
+	}
+	select {
+	case evt := <-changed:
+		if evt != (events.ConfigChangedData{Key: config.KeyProcChannelCount, Old: "1", Value: "4", NodeID: 5}) {
+			t.Fatalf("config.changed = %+v", evt)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("config.changed not published")
+	}
+
+	victim := hub.conns[7].ID()
+	hub.call(t, 5, ActionKickConn, KickConnReq{ConnID: victim, Reason: "maintenance"}, &resp)
+	if resp.Code != CodeOK {
+		t.Fatalf("admin kick_conn = %+v", resp)
+	}
+	if _, ok := hub.srv.ConnManager().Get(victim); ok {
+		t.Fatal("kicked conn still in manager")
+	}
+	hub.call(t, 5, ActionKickConn, KickConnReq{ConnID: victim}, &resp)
+	if resp.Code != CodeNotFound {
+		t.Fatalf("kick_conn of a gone conn = %+v, want not found", resp)
+	}
+
+	hub.call(t, 5, "reboot", nil, &resp)
+	if resp.Code != CodeNotFound {
+		t.Fatalf("unknown action = %+v, want not found", resp)
+	}
+}
+
+func TestSysDeniesNodeWithoutSysPerms(t *testing.T) {
+	hub := startSysHub(t, 8)
+	var resp Resp
+	hub.call(t, 8, ActionStats, nil, &resp)
+	if resp.Code != CodeDenied {
+		t.Fatalf("stats from a plain node = %+v, want denied", resp)
+	}
+}
@@ -0,0 +1,48 @@
+package quic_listener
+
+// 本文件承载 Core 框架中与 `certbind` 相关的通用逻辑。
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"strconv"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// CertBinder 从已校验的客户端叶子证书中提取节点身份；ok=false 表示不映射任何身份。
+type CertBinder func(cert *x509.Certificate) (nodeID uint32, deviceID string, ok bool)
+
+// CommonNameBinder 按证书 CN 映射身份：十进制数字视为 nodeID，其他非空值视为 deviceID。
+func CommonNameBinder(cert *x509.Certificate) (uint32, string, bool) {
+	if cert == nil {
+		return 0, "", false
+	}
+	cn := strings.TrimSpace(cert.Subject.CommonName)
+	if cn == "" {
+		return 0, "", false
+	}
+	if id, err := strconv.ParseUint(cn, 10, 32); err == nil {
+		if id == 0 {
+			return 0, "", false
+		}
+		return uint32(id), "", true
+	}
+	return 0, cn, true
+}
+
+// bindPeerCert 仅在客户端证书已通过 CA 校验时按 binder 记下待绑定身份（core.MetaCertIdentityKey），
+// 返回是否映射出身份。nodeID/deviceID 不在此写入，由服务端按登录流程绑定（见 core.BindConnIdentity），
+// 以免绕过重复连接策略与 conn.authenticated。
+func bindPeerCert(conn core.IConnection, state tls.ConnectionState, binder CertBinder) bool {
+	if binder == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 {
+		return false
+	}
+	nodeID, deviceID, ok := binder(state.PeerCertificates[0])
+	if !ok || (nodeID == 0 && deviceID == "") {
+		return false
+	}
+	conn.SetMeta(core.MetaCertIdentityKey, core.CertIdentity{NodeID: nodeID, DeviceID: deviceID})
+	return true
+}
@@ -0,0 +1,151 @@
+package quic_listener
+
+// 本文件覆盖 Core 框架中与 `certbind` 相关的行为。
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// writeClientCertChain 生成 CA 与由其签发、CN 为 commonName 的客户端证书，返回 PEM 文件路径。
+func writeClientCertChain(t *testing.T, commonName string) (caFile, certFile, keyFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	writePEM := func(name, typ string, der []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+		return path
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ca key: %v", err)
+	}
+	caTpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "myflowhub-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTpl, caTpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create ca: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate client key: %v", err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("create client cert: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal client key: %v", err)
+	}
+	return writePEM("ca.pem", "CERTIFICATE", caDER), writePEM("client.pem", "CERTIFICATE", der), writePEM("client.key", "EC PRIVATE KEY", keyDER)
+}
+
+func TestQUICListenerMapsNodeFromClientCert(t *testing.T) {
+	certFile, keyFile := writeSelfSignedCert(t)
+	caFile, clientCert, clientKey := writeClientCertChain(t, "42")
+	const alpn = "myflowhub-test"
+
+	l := New(Options{
+		Addr:              "127.0.0.1:0",
+		ALPN:              alpn,
+		CertFile:          certFile,
+		KeyFile:           keyFile,
+		ClientCAFile:      caFile,
+		RequireClientCert: true,
+		CertBinder:        CommonNameBinder,
+	})
+	cm := connmgr.New()
+	added := make(chan core.IConnection, 1)
+	cm.SetHooks(core.ConnectionHooks{OnAdd: func(c core.IConnection) { added <- c }})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = l.Listen(ctx, cm) }()
+
+	var addr string
+	for deadline := time.Now().Add(3 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if a, ok := l.Addr().(*Addr); ok && a.Address != "" {
+			addr = a.Address
+			break
+		}
+	}
+	if addr == "" {
+		t.Fatalf("listener addr unavailable")
+	}
+	client, err := Dial(ctx, DialOptions{Addr: addr, ALPN: alpn, Insecure: true, ClientCertFile: clientCert, ClientKeyFile: clientKey})
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer client.Close()
+	// QUIC 在首个 stream 数据到达时才交付给服务端，发一帧触发接入。
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(2).WithMsgID(1)
+	if err := client.SendWithHeader(hdr, nil, header.HeaderTcpCodec{}); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	select {
+	case conn := <-added:
+		// 身份只作为待绑定项随连接交给服务端，按登录流程绑定，不在加入管理器时直接入索引。
+		if id, ok := core.ConnCertIdentity(conn); !ok || id.NodeID != 42 {
+			t.Fatalf("conn cert identity=%+v ok=%v, want node 42", id, ok)
+		}
+		if core.ConnNodeID(conn) != 0 {
+			t.Fatalf("conn node=%d, want identity left for the login routine", core.ConnNodeID(conn))
+		}
+		if _, ok := cm.GetByNode(42); ok {
+			t.Fatal("node index built before the login routine bound the connection")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("server connection not added")
+	}
+}
+
+func TestBindPeerCertRequiresVerifiedChain(t *testing.T) {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "lamp-1"}}
+	conn, _ := NewQUICConnection(&quicPipe{}, &Addr{Address: "l"}, &Addr{Address: "r"})
+	if bindPeerCert(conn, tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}, CommonNameBinder) {
+		t.Fatal("unverified certificate was bound")
+	}
+	state := tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	if !bindPeerCert(conn, state, CommonNameBinder) {
+		t.Fatal("verified certificate not mapped")
+	}
+	if id, _ := core.ConnCertIdentity(conn); id != (core.CertIdentity{DeviceID: "lamp-1"}) {
+		t.Fatalf("device cert identity=%+v", id)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	quic "github.com/quic-go/quic-go"
 	core "github.com/yttydcs/myflowhub-core"
@@ -29,6 +30,11 @@ func (p *quicPipe) Write(b []byte) (int, error) {
 	return p.stream.Write(b)
 }
 
+// SetReadDeadline 透传到 stream，供读取循环做空闲/慢帧保护。
+func (p *quicPipe) SetReadDeadline(t time.Time) error {
+	return p.stream.SetReadDeadline(t)
+}
+
 // Close 同时关闭 stream 与底层 quic 连接，避免只关单边留下会话泄漏。
 func (p *quicPipe) Close() error {
 	var closeErr error
@@ -55,6 +61,8 @@ type quicConnection struct {
 	meta   map[string]any
 	recvH  core.ReceiveHandler
 	reader core.IReader
+
+	core.ActivityClock
 }
 
 var quicConnSeq atomic.Uint64
@@ -65,13 +73,15 @@ func NewQUICConnection(pipe core.IPipe, local, remote net.Addr) (*quicConnection
 		return nil, errors.New("nil pipe")
 	}
 	id := fmt.Sprintf("quic#%d", quicConnSeq.Add(1))
-	return &quicConnection{
+	c := &quicConnection{
 		pipe:   pipe,
 		id:     id,
 		local:  local,
 		remote: remote,
 		meta:   make(map[string]any),
-	}, nil
+	}
+	c.MarkConnected()
+	return c, nil
 }
 
 var _ core.IConnection = (*quicConnection)(nil)
@@ -129,6 +139,7 @@ func (c *quicConnection) SetReader(r core.IReader) {
 
 // DispatchReceive 把解码后的帧交给当前连接绑定的 receive handler。
 func (c *quicConnection) DispatchReceive(h core.IHeader, payload []byte) {
+	c.Touch()
 	c.mu.RLock()
 	recv := c.recvH
 	c.mu.RUnlock()
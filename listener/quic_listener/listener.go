@@ -27,6 +27,9 @@ type Options struct {
 
 	ClientCAFile      string
 	RequireClientCert bool
+	// CertBinder 非空时，用已校验的客户端证书映射 nodeID/deviceID（见 CommonNameBinder），由服务端在开始读取前
+	// 按登录流程绑定；需配合 ClientCAFile 使用，未校验或映射失败的连接照常走 login。
+	CertBinder CertBinder
 }
 
 // setDefaults 补齐监听侧默认 ALPN 与日志器。
@@ -55,7 +58,7 @@ func (o Options) Validate() error {
 
 type QUICListener struct {
 	opts Options
-	ln   *quic.Listener
+	ln   atomic.Pointer[quic.Listener] // Listen 写入，Addr/Close 可能在其他 goroutine 并发读取
 
 	closed atomic.Bool
 }
@@ -71,10 +74,11 @@ var _ core.IListener = (*QUICListener)(nil)
 func (l *QUICListener) Protocol() string { return "quic" }
 
 func (l *QUICListener) Addr() net.Addr {
-	if l.ln == nil {
+	ln := l.ln.Load()
+	if ln == nil {
 		return nil
 	}
-	return &Addr{Address: l.ln.Addr().String(), ALPN: l.opts.ALPN, Role: "listen"}
+	return &Addr{Address: ln.Addr().String(), ALPN: l.opts.ALPN, Role: "listen"}
 }
 
 // Listen 启动 QUIC 监听、接受会话/stream，并把每条流包装为 IConnection 交给管理器。
@@ -101,7 +105,7 @@ func (l *QUICListener) Listen(ctx context.Context, cm core.IConnectionManager) e
 	if err != nil {
 		return err
 	}
-	l.ln = ln
+	l.ln.Store(ln)
 	log := l.opts.Logger
 	log.Info("quic listener started", "addr", ln.Addr().String(), "alpn", l.opts.ALPN)
 
@@ -146,6 +150,10 @@ func (l *QUICListener) Listen(ctx context.Context, cm core.IConnectionManager) e
 			log.Warn("quic new connection wrapper failed", "err", err)
 			continue
 		}
+		if l.opts.CertBinder != nil && bindPeerCert(wrapped, conn.ConnectionState().TLS, l.opts.CertBinder) {
+			id, _ := core.ConnCertIdentity(wrapped)
+			log.Debug("quic connection identity from client cert", "remote", remote.String(), "node", id.NodeID, "device", id.DeviceID)
+		}
 		if err := cm.Add(wrapped); err != nil {
 			log.Warn("failed to add quic connection to manager", "remote", remote.String(), "err", err)
 			_ = wrapped.Close()
@@ -157,8 +165,8 @@ func (l *QUICListener) Listen(ctx context.Context, cm core.IConnectionManager) e
 // Close 关闭底层 QUIC listener，使 Accept 尽快退出。
 func (l *QUICListener) Close() error {
 	l.closed.Store(true)
-	if l.ln != nil {
-		return l.ln.Close()
+	if ln := l.ln.Load(); ln != nil {
+		return ln.Close()
 	}
 	return nil
 }
@@ -23,6 +23,8 @@ type rfcommConnection struct {
 	meta   map[string]any
 	recvH  core.ReceiveHandler
 	reader core.IReader
+
+	core.ActivityClock
 }
 
 var rfcommConnSeq atomic.Uint64
@@ -33,13 +35,15 @@ func NewRFCOMMConnection(pipe core.IPipe, local, remote net.Addr) (*rfcommConnec
 		return nil, errors.New("nil pipe")
 	}
 	id := fmt.Sprintf("rfcomm#%d", rfcommConnSeq.Add(1))
-	return &rfcommConnection{
+	c := &rfcommConnection{
 		pipe:   pipe,
 		id:     id,
 		local:  local,
 		remote: remote,
 		meta:   make(map[string]any),
-	}, nil
+	}
+	c.MarkConnected()
+	return c, nil
 }
 
 // Compile-time assertions.
@@ -85,6 +89,7 @@ func (c *rfcommConnection) SetReader(r core.IReader) { c.mu.Lock(); c.reader = r
 
 // DispatchReceive 把读取器解码出的帧投递给连接绑定的 receive handler。
 func (c *rfcommConnection) DispatchReceive(h core.IHeader, payload []byte) {
+	c.Touch()
 	c.mu.RLock()
 	recv := c.recvH
 	c.mu.RUnlock()
@@ -3,10 +3,12 @@ package tcp_listener
 // 本文件承载 Core 框架中与 `connection` 相关的通用逻辑。
 
 import (
-	"fmt"
+	"errors"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 )
@@ -20,30 +22,62 @@ func (p *tcpPipe) Read(b []byte) (int, error)  { return p.conn.Read(b) }
 func (p *tcpPipe) Write(b []byte) (int, error) { return p.conn.Write(b) }
 func (p *tcpPipe) Close() error                { return p.conn.Close() }
 
+// SetReadDeadline 暴露读超时能力，供读取循环做空闲/慢帧保护。
+func (p *tcpPipe) SetReadDeadline(t time.Time) error { return p.conn.SetReadDeadline(t) }
+
+// SetWriteDeadline 让发送端可以按调用方 ctx 限制写出耗时。
+func (p *tcpPipe) SetWriteDeadline(t time.Time) error { return p.conn.SetWriteDeadline(t) }
+
+// WriteBuffers 把多段数据交给 net.Buffers，在 *net.TCPConn 上走 writev 一次写出。
+func (p *tcpPipe) WriteBuffers(bufs *net.Buffers) (int64, error) { return bufs.WriteTo(p.conn) }
+
+var _ core.IReadDeadlinePipe = (*tcpPipe)(nil)
+var _ core.IWriteDeadlinePipe = (*tcpPipe)(nil)
+var _ core.IBuffersPipe = (*tcpPipe)(nil)
+
 // tcpConnection 是针对 TCP 的 IConnection 实现。
 type tcpConnection struct {
-	conn   net.Conn
-	pipe   core.IPipe
-	id     string
-	mu     sync.RWMutex
-	meta   map[string]any
-	recvH  core.ReceiveHandler
-	reader core.IReader
+	conn net.Conn
+	pipe core.IPipe
+	id   string
+	mu   sync.RWMutex
+	meta map[string]any
+	// maxMeta 为元数据条目上限，0 表示不限制（见 SetMaxMeta）。
+	maxMeta     int
+	metaDropped atomic.Uint64
+	recvH       core.ReceiveHandler
+	recvS       core.StreamReceiveHandler
+	reader      core.IReader
+
+	core.ActivityClock
 }
 
-// NewTCPConnection 把 `net.Conn` 包装为框架层统一的 `IConnection`。
+// NewTCPConnection 把 `net.Conn` 包装为框架层统一的 `IConnection`，ID 为 "local->remote"。
 func NewTCPConnection(c net.Conn) *tcpConnection {
-	return &tcpConnection{
+	return NewTCPConnectionWithID(c, nil)
+}
+
+// NewTCPConnectionWithID 与 NewTCPConnection 相同，但用 gen 生成连接 ID；gen 为 nil 时使用 core.AddrConnID。
+func NewTCPConnectionWithID(c net.Conn, gen core.ConnIDGenerator) *tcpConnection {
+	if gen == nil {
+		gen = core.AddrConnID
+	}
+	tc := &tcpConnection{
 		conn: c,
 		pipe: &tcpPipe{conn: c},
-		id:   fmt.Sprintf("%s->%s", c.LocalAddr().String(), c.RemoteAddr().String()),
+		id:   gen(c.LocalAddr(), c.RemoteAddr()),
 		meta: make(map[string]any),
 	}
+	tc.MarkConnected()
+	return tc
 }
 
 // 编译期断言实现接口
 var _ core.IConnection = (*tcpConnection)(nil)
 var _ core.ISender = (*tcpConnection)(nil)
+var _ core.IActivityTracker = (*tcpConnection)(nil)
+var _ core.IStreamReceiver = (*tcpConnection)(nil)
+var _ core.IHalfCloser = (*tcpConnection)(nil)
 
 func (c *tcpConnection) ID() string { return c.id }
 
@@ -51,9 +85,46 @@ func (c *tcpConnection) Pipe() core.IPipe { return c.pipe }
 
 func (c *tcpConnection) Close() error { return c.conn.Close() }
 
+// CloseRead 关闭读方向；底层连接不支持（如 net.Pipe）时返回 errors.ErrUnsupported。
+func (c *tcpConnection) CloseRead() error {
+	if cr, ok := c.conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return errors.ErrUnsupported
+}
+
+// CloseWrite 关闭写方向并向对端发送 FIN，读方向不受影响。
+func (c *tcpConnection) CloseWrite() error {
+	if cw, ok := c.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return errors.ErrUnsupported
+}
+
 func (c *tcpConnection) OnReceive(h core.ReceiveHandler) { c.mu.Lock(); c.recvH = h; c.mu.Unlock() }
 
-func (c *tcpConnection) SetMeta(key string, val any) { c.mu.Lock(); c.meta[key] = val; c.mu.Unlock() }
+// SetMeta 写入元数据。设置了上限（SetMaxMeta）且已达上限时，已有键照常更新，新键被拒绝并计入
+// MetaDropped——不淘汰旧键，以免挤掉 nodeID、角色等框架绑定的身份信息；框架保留键
+// （core.ReservedMetaKey）不受上限约束，始终写入。
+func (c *tcpConnection) SetMeta(key string, val any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.meta[key]; !ok && c.maxMeta > 0 && len(c.meta) >= c.maxMeta && !core.ReservedMetaKey(key) {
+		c.metaDropped.Add(1)
+		return
+	}
+	c.meta[key] = val
+}
+
+// SetMaxMeta 设置元数据条目上限，n<=0 表示不限制；已超出上限的现有条目保留。
+func (c *tcpConnection) SetMaxMeta(n int) {
+	c.mu.Lock()
+	c.maxMeta = max(n, 0)
+	c.mu.Unlock()
+}
+
+// MetaDropped 返回因达到条目上限而被拒绝的元数据写入次数。
+func (c *tcpConnection) MetaDropped() uint64 { return c.metaDropped.Load() }
 
 func (c *tcpConnection) GetMeta(key string) (any, bool) {
 	c.mu.RLock()
@@ -80,6 +151,7 @@ func (c *tcpConnection) SetReader(r core.IReader) { c.mu.Lock(); c.reader = r; c
 
 // DispatchReceive 把读取器解码出的帧转交给连接级 receive handler。
 func (c *tcpConnection) DispatchReceive(h core.IHeader, payload []byte) {
+	c.Touch()
 	c.mu.RLock()
 	recv := c.recvH
 	c.mu.RUnlock()
@@ -88,6 +160,26 @@ func (c *tcpConnection) DispatchReceive(h core.IHeader, payload []byte) {
 	}
 }
 
+// OnReceiveStream 注册流式接收回调，供读取循环交付带 FlagStreamed 的大帧。
+func (c *tcpConnection) OnReceiveStream(h core.StreamReceiveHandler) {
+	c.mu.Lock()
+	c.recvS = h
+	c.mu.Unlock()
+}
+
+// DispatchStream 把流式帧的 body 交给流式回调；未注册时返回 false。
+func (c *tcpConnection) DispatchStream(h core.IHeader, body io.Reader) bool {
+	c.mu.RLock()
+	recv := c.recvS
+	c.mu.RUnlock()
+	if recv == nil {
+		return false
+	}
+	c.Touch()
+	recv(c, h, body)
+	return true
+}
+
 // Send 直接透传原始字节写入 TCP 连接。
 func (c *tcpConnection) Send(data []byte) error {
 	_, err := c.conn.Write(data)
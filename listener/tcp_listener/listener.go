@@ -5,25 +5,52 @@ package tcp_listener
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
 )
 
 // Options 配置 TCPListener 的行为。
 type Options struct {
 	// Addr 监听地址，例如 ":9000" 或 "127.0.0.1:9000"。
 	Addr string
+	// Addrs 额外的监听地址；与 Addr 合并去重后逐一绑定，所有地址接受的连接进入同一连接管理器。
+	Addrs []string
 	// KeepAlive 是否对接受到的 TCP 连接开启 KeepAlive（默认取 New 的入参策略）。
 	KeepAlive bool
 	// KeepAlivePeriod KeepAlive 周期（默认 30s；仅在 KeepAlive 为 true 时生效）。
 	KeepAlivePeriod time.Duration
 	// Logger 可选日志器；若为空使用 slog.Default()。
 	Logger *slog.Logger
+	// AcceptBackoffMin/AcceptBackoffMax 可恢复 Accept 错误（如 EMFILE）后的退避区间，
+	// 连续失败时从 Min 翻倍到 Max（默认 5ms / 1s）。
+	AcceptBackoffMin time.Duration
+	AcceptBackoffMax time.Duration
+	// MaxAcceptFailures 连续可恢复错误达到该次数后放弃并返回错误；0 表示一直重试。
+	MaxAcceptFailures int
+	// MaxConnections 连接管理器中的连接数达到该值时拒绝新连接；0 表示不限制，运行期可用 SetMaxConnections 调整。
+	MaxConnections int
+	// RejectWithErrFrame 拒绝时先尽力写出一帧 MajorErrResp 再关闭，便于对端区分“满载”与网络故障。
+	RejectWithErrFrame bool
+	// ProxyProtocol 开启后每条新连接先解析 PROXY protocol v1/v2 前导，RemoteAddr 返回其中的真实客户端地址。
+	ProxyProtocol bool
+	// ProxyProtocolStrict 前导缺失或非法时直接关闭连接；为 false 时沿用 socket 地址继续服务。
+	ProxyProtocolStrict bool
+	// ProxyHeaderTimeout 等待前导的最长时间（默认 5s）。
+	ProxyHeaderTimeout time.Duration
+	// IDGenerator 为接受的连接生成 ID；为空时沿用 "local->remote"（core.AddrConnID）。
+	// 开启 ProxyProtocol 时生成器拿到的 remote 为前导中的真实客户端地址。
+	IDGenerator core.ConnIDGenerator
+	// MaxMetaEntries 限制每条连接的元数据条目数，超出时新键被拒绝（框架保留键除外，见 tcpConnection.SetMeta）；0 表示不限制。
+	MaxMetaEntries int
 }
 
 // setDefaults 补齐 TCP listener 的默认 keepalive 周期与日志器。
@@ -34,17 +61,54 @@ func (o *Options) setDefaults() {
 	if o.Logger == nil {
 		o.Logger = slog.Default()
 	}
+	if o.AcceptBackoffMin <= 0 {
+		o.AcceptBackoffMin = 5 * time.Millisecond
+	}
+	if o.AcceptBackoffMax < o.AcceptBackoffMin {
+		o.AcceptBackoffMax = max(time.Second, o.AcceptBackoffMin)
+	}
+	if o.MaxAcceptFailures < 0 {
+		o.MaxAcceptFailures = 0
+	}
+	if o.ProxyHeaderTimeout <= 0 {
+		o.ProxyHeaderTimeout = 5 * time.Second
+	}
+}
+
+// addrs 返回合并去重后的监听地址：Addr 在前，其后按 Addrs 顺序，空串忽略；
+// 端口为 0 的地址每次绑定得到不同端口，因此不参与去重。
+func (o *Options) addrs() []string {
+	out := make([]string, 0, 1+len(o.Addrs))
+	seen := make(map[string]struct{}, 1+len(o.Addrs))
+	for _, a := range append([]string{o.Addr}, o.Addrs...) {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		if _, dup := seen[a]; dup && !strings.HasSuffix(a, ":0") {
+			continue
+		}
+		seen[a] = struct{}{}
+		out = append(out, a)
+	}
+	return out
 }
 
 // TCPListener 实现 core.IListener，用于接受 TCP 连接并交由连接管理器管理。
 type TCPListener struct {
 	opts   Options
-	ln     net.Listener
+	mu     sync.Mutex
+	lns    []net.Listener
 	closed atomic.Bool
+
+	maxConns atomic.Int64
+	rejected atomic.Uint64
+
+	listen func(network, addr string) (net.Listener, error) // 测试可替换
 }
 
 // New 创建一个 TCPListener。
-// 如果未传入 Options，则默认开启 KeepAlive。
+// 如果未传入 Options，则默认开启 KeepAlive；addr 可为空，此时只绑定 Options.Addrs。
 func New(addr string, opts ...Options) *TCPListener {
 	var o Options
 	if len(opts) > 0 {
@@ -55,35 +119,68 @@ func New(addr string, opts ...Options) *TCPListener {
 	}
 	o.Addr = addr
 	o.setDefaults()
-	return &TCPListener{opts: o}
+	l := &TCPListener{opts: o, listen: net.Listen}
+	l.maxConns.Store(int64(max(o.MaxConnections, 0)))
+	return l
 }
 
 // Protocol 返回协议标识。
 func (l *TCPListener) Protocol() string { return "tcp" }
 
-// Addr 返回监听地址（在 Listen 成功后可用）。
+// Addr 返回首个监听地址（在 Listen 成功后可用）。
 func (l *TCPListener) Addr() net.Addr {
-	if l.ln != nil {
-		return l.ln.Addr()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.lns) > 0 {
+		return l.lns[0].Addr()
 	}
 	return nil
 }
 
-// Listen 启动监听并在接受到新连接时创建 IConnection 并添加到 cm。
+// Addrs 返回全部监听地址，顺序与 Options.Addr、Options.Addrs 一致（在 Listen 成功后可用）。
+func (l *TCPListener) Addrs() []net.Addr {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]net.Addr, 0, len(l.lns))
+	for _, ln := range l.lns {
+		out = append(out, ln.Addr())
+	}
+	return out
+}
+
+// Listen 在全部地址上启动监听，并把各地址接受到的连接统一加入 cm。
+// 任一地址绑定失败时已绑定的地址会被关闭；任一地址的 Accept 不可恢复地失败时停止全部监听并返回该错误。
 func (l *TCPListener) Listen(ctx context.Context, cm core.IConnectionManager) error {
 	if l.closed.Load() {
 		return errors.New("tcp listener already closed")
 	}
-	if l.opts.Addr == "" {
+	addrs := l.opts.addrs()
+	if len(addrs) == 0 {
 		return errors.New("tcp listener addr is empty")
 	}
-	ln, err := net.Listen("tcp", l.opts.Addr)
-	if err != nil {
-		return err
+	lns := make([]net.Listener, 0, len(addrs))
+	for _, addr := range addrs {
+		ln, err := l.listen("tcp", addr)
+		if err != nil {
+			closeListeners(lns)
+			if len(addrs) > 1 {
+				return fmt.Errorf("listen %s: %w", addr, err)
+			}
+			return err
+		}
+		lns = append(lns, ln)
+	}
+	l.mu.Lock()
+	l.lns = lns
+	l.mu.Unlock()
+	if l.closed.Load() { // Close 与绑定并发发生
+		closeListeners(lns)
+		return nil
 	}
-	l.ln = ln
 	log := l.opts.Logger
-	log.Info("tcp listener started", "addr", ln.Addr().String())
+	for _, ln := range lns {
+		log.Info("tcp listener started", "addr", ln.Addr().String())
+	}
 
 	// 监控 ctx，取消时关闭监听器以唤醒 Accept
 	ctxDone := make(chan struct{})
@@ -97,10 +194,34 @@ func (l *TCPListener) Listen(ctx context.Context, cm core.IConnectionManager) er
 
 	defer func() {
 		close(ctxDone)
-		_ = ln.Close()
+		closeListeners(lns)
 		log.Info("tcp listener stopped")
 	}()
 
+	if len(lns) == 1 {
+		return l.acceptLoop(ctx, lns[0], cm)
+	}
+	errs := make(chan error, len(lns))
+	for _, ln := range lns {
+		go func(ln net.Listener) { errs <- l.acceptLoop(ctx, ln, cm) }(ln)
+	}
+	var first error
+	for range lns {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+			closeListeners(lns) // 唤醒其余地址的 Accept，它们会按“已关闭”正常退出
+		}
+	}
+	return first
+}
+
+// acceptLoop 在单个 net.Listener 上循环 Accept，直到关闭、ctx 取消或出现不可恢复错误。
+func (l *TCPListener) acceptLoop(ctx context.Context, ln net.Listener, cm core.IConnectionManager) error {
+	log := l.opts.Logger
+	var (
+		failures int
+		delay    time.Duration
+	)
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -108,15 +229,35 @@ func (l *TCPListener) Listen(ctx context.Context, cm core.IConnectionManager) er
 			if l.closed.Load() || ctx.Err() != nil {
 				return nil
 			}
-			if ne, ok := err.(net.Error); ok && ne.Temporary() {
-				log.Warn("accept temporary error", "err", ne)
-				time.Sleep(100 * time.Millisecond)
-				continue
+			if errors.Is(err, net.ErrClosed) || strings.Contains(strings.ToLower(err.Error()), "closed") {
+				return nil
+			}
+			if !isRecoverableAcceptErr(err) {
+				return err
+			}
+			failures++
+			if l.opts.MaxAcceptFailures > 0 && failures >= l.opts.MaxAcceptFailures {
+				log.Error("accept keeps failing, giving up", "addr", ln.Addr().String(), "failures", failures, "err", err)
+				return err
+			}
+			if delay == 0 {
+				delay = l.opts.AcceptBackoffMin
+			} else {
+				delay = min(delay*2, l.opts.AcceptBackoffMax)
 			}
-			if strings.Contains(strings.ToLower(err.Error()), "closed") {
+			log.Warn("accept recoverable error, backing off", "addr", ln.Addr().String(), "err", err, "failures", failures, "wait", delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
 				return nil
 			}
-			return err
+			continue
+		}
+		failures, delay = 0, 0
+
+		if l.atCapacity(cm) {
+			l.reject(conn)
+			continue
 		}
 
 		// 设置 TCP KeepAlive
@@ -127,22 +268,108 @@ func (l *TCPListener) Listen(ctx context.Context, cm core.IConnectionManager) er
 			}
 		}
 
-		// 包装为 core.IConnection 并加入连接管理器
-		c := NewTCPConnection(conn)
-		if err := cm.Add(c); err != nil {
-			log.Warn("failed to add connection to manager", "remote", conn.RemoteAddr().String(), "err", err)
-			_ = conn.Close()
+		if l.opts.ProxyProtocol {
+			// 前导读取可能阻塞到超时，放到独立协程以免拖住 Accept 循环。
+			go l.admitProxied(conn, cm)
 			continue
 		}
-		log.Debug("new connection accepted", "remote", conn.RemoteAddr().String())
+		l.admit(conn, cm, "")
+	}
+}
+
+// closeListeners 关闭一组监听器并忽略错误。
+func closeListeners(lns []net.Listener) {
+	for _, ln := range lns {
+		_ = ln.Close()
+	}
+}
+
+// admit 把 net.Conn 包装为 core.IConnection 并加入连接管理器；proxyPeer 非空时记入元数据。
+func (l *TCPListener) admit(conn net.Conn, cm core.IConnectionManager, proxyPeer string) {
+	log := l.opts.Logger
+	c := NewTCPConnectionWithID(conn, l.opts.IDGenerator)
+	c.SetMaxMeta(l.opts.MaxMetaEntries)
+	if proxyPeer != "" {
+		c.SetMeta(MetaProxyPeerKey, proxyPeer)
+	}
+	if err := cm.Add(c); err != nil {
+		log.Warn("failed to add connection to manager", "remote", conn.RemoteAddr().String(), "err", err)
+		_ = conn.Close()
+		return
+	}
+	log.Debug("new connection accepted", "conn", c.ID(), "remote", conn.RemoteAddr().String())
+}
+
+// admitProxied 解析 PROXY 前导后再加入管理器，解析失败（含严格模式下缺失）时关闭连接。
+func (l *TCPListener) admitProxied(conn net.Conn, cm core.IConnectionManager) {
+	peer := conn.RemoteAddr().String()
+	wrapped, err := l.readProxyHeader(conn)
+	if err != nil {
+		l.opts.Logger.Warn("proxy protocol header rejected", "remote", peer, "err", err)
+		_ = conn.Close()
+		return
 	}
+	l.admit(wrapped, cm, peer)
 }
 
-// Close 停止监听。
+// SetMaxConnections 在运行期调整连接上限；n<=0 表示不限制。
+func (l *TCPListener) SetMaxConnections(n int) {
+	l.maxConns.Store(int64(max(n, 0)))
+}
+
+// Rejected 返回因连接数达到上限而被拒绝的累计次数。
+func (l *TCPListener) Rejected() uint64 { return l.rejected.Load() }
+
+// atCapacity 判断连接管理器是否已达到上限。
+func (l *TCPListener) atCapacity(cm core.IConnectionManager) bool {
+	limit := l.maxConns.Load()
+	return limit > 0 && int64(cm.Count()) >= limit
+}
+
+// rejectWriteTimeout 限制拒绝帧的写出耗时，避免慢速对端拖住 Accept 循环。
+const rejectWriteTimeout = 100 * time.Millisecond
+
+// reject 关闭超出上限的新连接，按需先写出一帧 MajorErrResp。
+func (l *TCPListener) reject(conn net.Conn) {
+	n := l.rejected.Add(1)
+	l.opts.Logger.Warn("connection limit reached, reject", "remote", conn.RemoteAddr().String(), "limit", l.maxConns.Load(), "rejected_total", n)
+	if l.opts.RejectWithErrFrame {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorErrResp)
+		if frame, err := (header.HeaderTcpCodec{}).Encode(hdr, []byte("too many connections")); err == nil {
+			_ = conn.SetWriteDeadline(time.Now().Add(rejectWriteTimeout))
+			_, _ = conn.Write(frame)
+		}
+	}
+	_ = conn.Close()
+}
+
+// isRecoverableAcceptErr 判断 Accept 错误是否值得退避重试：fd/内存耗尽、握手前被对端中止，
+// 以及实现标记为超时或临时的网络错误。
+func isRecoverableAcceptErr(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var ne net.Error
+	if errors.As(err, &ne) {
+		// Temporary 虽已弃用，但仍是部分实现唯一的可恢复标记。
+		return ne.Timeout() || ne.Temporary()
+	}
+	return false
+}
+
+// Close 停止全部地址上的监听。
 func (l *TCPListener) Close() error {
 	l.closed.Store(true)
-	if l.ln != nil {
-		return l.ln.Close()
+	l.mu.Lock()
+	lns := l.lns
+	l.mu.Unlock()
+	var first error
+	for _, ln := range lns {
+		if err := ln.Close(); err != nil && first == nil {
+			first = err
+		}
 	}
-	return nil
+	return first
 }
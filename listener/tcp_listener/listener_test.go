@@ -0,0 +1,372 @@
+package tcp_listener
+
+// 本文件覆盖 Core 框架中与 `listener` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// scriptedListener 依次返回预设的 Accept 错误，之后交付 incoming 中的连接，无连接时阻塞到 Close。
+type scriptedListener struct {
+	mu       sync.Mutex
+	errs     []error
+	calls    int
+	incoming chan net.Conn
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func newScriptedListener(errs ...error) *scriptedListener {
+	return &scriptedListener{errs: errs, incoming: make(chan net.Conn, 16), closed: make(chan struct{})}
+}
+
+func (l *scriptedListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	l.calls++
+	if len(l.errs) > 0 {
+		err := l.errs[0]
+		l.errs = l.errs[1:]
+		l.mu.Unlock()
+		return nil, err
+	}
+	l.mu.Unlock()
+	select {
+	case conn := <-l.incoming:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *scriptedListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *scriptedListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+func (l *scriptedListener) acceptCalls() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.calls
+}
+
+func emfile() error {
+	return &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+}
+
+func newScriptedTCPListener(sl *scriptedListener, opts Options) *TCPListener {
+	l := New("scripted", opts)
+	l.listen = func(string, string) (net.Listener, error) { return sl, nil }
+	return l
+}
+
+func TestListenBacksOffOnEMFILEThenAccepts(t *testing.T) {
+	server, client := net.Pipe()
+	t.Cleanup(func() { _ = server.Close(); _ = client.Close() })
+	sl := newScriptedListener(emfile(), emfile(), emfile())
+	sl.incoming <- server
+	l := newScriptedTCPListener(sl, Options{AcceptBackoffMin: time.Millisecond, AcceptBackoffMax: 4 * time.Millisecond, MaxAcceptFailures: 5})
+
+	cm := connmgr.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Listen(ctx, cm) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cm.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	if cm.Count() != 1 {
+		t.Fatalf("connections=%d after EMFILE storm, want 1", cm.Count())
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Listen exited early: %v", err)
+	default:
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Listen err=%v after cancel, want nil", err)
+	}
+	if got := sl.acceptCalls(); got < 5 {
+		t.Fatalf("accept calls=%d, want >=5 (3 failures + conn + blocking)", got)
+	}
+}
+
+func TestListenGivesUpAfterMaxAcceptFailures(t *testing.T) {
+	sl := newScriptedListener(emfile(), emfile(), emfile(), emfile())
+	l := newScriptedTCPListener(sl, Options{AcceptBackoffMin: time.Millisecond, MaxAcceptFailures: 3})
+	err := l.Listen(context.Background(), connmgr.New())
+	if !errors.Is(err, syscall.EMFILE) {
+		t.Fatalf("Listen err=%v, want EMFILE after max failures", err)
+	}
+	if got := sl.acceptCalls(); got != 3 {
+		t.Fatalf("accept calls=%d, want 3", got)
+	}
+}
+
+func TestListenReturnsUnrecoverableAcceptError(t *testing.T) {
+	fatal := errors.New("listener broken")
+	sl := newScriptedListener(fatal)
+	l := newScriptedTCPListener(sl, Options{})
+	if err := l.Listen(context.Background(), connmgr.New()); !errors.Is(err, fatal) {
+		t.Fatalf("Listen err=%v, want %v", err, fatal)
+	}
+}
+
+// pipeAddr/addrConn 为 net.Pipe 提供可区分的远端地址，使连接 ID 唯一。
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+type addrConn struct {
+	net.Conn
+	remote pipeAddr
+}
+
+func (c addrConn) RemoteAddr() net.Addr { return c.remote }
+
+var pipeSeq atomic.Int32
+
+// pipePair 返回服务端一侧连接与对端，测试结束时统一关闭。
+func pipePair(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { _ = server.Close(); _ = client.Close() })
+	return addrConn{Conn: server, remote: pipeAddr(fmt.Sprintf("peer-%d", pipeSeq.Add(1)))}, client
+}
+
+func TestListenRejectsConnectionsBeyondLimit(t *testing.T) {
+	var servers, clients []net.Conn
+	for i := 0; i < 4; i++ {
+		s, c := pipePair(t)
+		servers, clients = append(servers, s), append(clients, c)
+	}
+	sl := newScriptedListener()
+	for _, s := range servers {
+		sl.incoming <- s
+	}
+	l := newScriptedTCPListener(sl, Options{MaxConnections: 2, RejectWithErrFrame: true})
+
+	cm := connmgr.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- l.Listen(ctx, cm) }()
+
+	// 超出上限的两条连接先收到 ErrResp 帧，随后被关闭。
+	for _, c := range clients[2:] {
+		_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+		hdr, payload, err := header.HeaderTcpCodec{}.Decode(c)
+		if err != nil {
+			t.Fatalf("read reject frame: %v", err)
+		}
+		if hdr.Major() != header.MajorErrResp || string(payload) != "too many connections" {
+			t.Fatalf("reject frame major=%d payload=%q", hdr.Major(), payload)
+		}
+		if _, err := c.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+			t.Fatalf("rejected conn read err=%v, want EOF", err)
+		}
+	}
+	if cm.Count() != 2 || l.Rejected() != 2 {
+		t.Fatalf("count=%d rejected=%d, want 2 and 2", cm.Count(), l.Rejected())
+	}
+	// 已接纳的连接不受影响。
+	go func() { _, _ = servers[0].Write([]byte("ok")) }()
+	_ = clients[0].SetReadDeadline(time.Now().Add(2 * time.Second))
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(clients[0], buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("accepted conn read=%q err=%v", buf, err)
+	}
+
+	// 运行期放宽上限后，新连接可以进入。
+	l.SetMaxConnections(3)
+	extra, _ := pipePair(t)
+	sl.incoming <- extra
+	deadline := time.Now().Add(2 * time.Second)
+	for cm.Count() < 3 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	if cm.Count() != 3 || l.Rejected() != 2 {
+		t.Fatalf("after raising limit count=%d rejected=%d, want 3 and 2", cm.Count(), l.Rejected())
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Listen err=%v", err)
+	}
+}
+
+// admitAll 通过 scripted listener 送入 conns，等待管理器计数稳定后返回已接纳的连接 ID。
+func admitAll(t *testing.T, opts Options, conns []net.Conn, want int) map[string]bool {
+	t.Helper()
+	sl := newScriptedListener()
+	l := newScriptedTCPListener(sl, opts)
+	cm := connmgr.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = l.Listen(ctx, cm) }()
+	for _, c := range conns {
+		sl.incoming <- c
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for cm.Count() < want && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	ids := make(map[string]bool)
+	cm.Range(func(c core.IConnection) bool { ids[c.ID()] = true; return true })
+	return ids
+}
+
+func TestListenIDGeneratorUniqueAcrossSameRemote(t *testing.T) {
+	const n = 50
+	gens := map[string]core.ConnIDGenerator{"counter": core.CounterConnID("c-"), "uuid": core.UUIDConnID}
+	for name, gen := range gens {
+		t.Run(name, func(t *testing.T) {
+			conns := make([]net.Conn, 0, n)
+			for i := 0; i < n; i++ {
+				server, client := net.Pipe() // 全部为 pipe->pipe，地址 ID 会冲突
+				t.Cleanup(func() { _ = server.Close(); _ = client.Close() })
+				conns = append(conns, server)
+			}
+			if ids := admitAll(t, Options{IDGenerator: gen}, conns, n); len(ids) != n {
+				t.Fatalf("admitted %d unique conns, want %d", len(ids), n)
+			}
+		})
+	}
+}
+
+func TestListenIDGeneratorCustomHonored(t *testing.T) {
+	server, _ := pipePair(t)
+	gen := func(_, remote net.Addr) string { return "custom:" + remote.String() }
+	ids := admitAll(t, Options{IDGenerator: gen}, []net.Conn{server}, 1)
+	if want := "custom:" + server.RemoteAddr().String(); !ids[want] {
+		t.Fatalf("ids=%v, want %q", ids, want)
+	}
+	// 缺省仍为 local->remote。
+	server2, _ := pipePair(t)
+	ids = admitAll(t, Options{}, []net.Conn{server2}, 1)
+	if want := "pipe->" + server2.RemoteAddr().String(); !ids[want] {
+		t.Fatalf("ids=%v, want %q", ids, want)
+	}
+}
+
+func TestListenMultipleAddrsFeedOneManager(t *testing.T) {
+	l := New("127.0.0.1:0", Options{Addrs: []string{"127.0.0.1:0"}})
+	cm := connmgr.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- l.Listen(ctx, cm) }()
+
+	var addrs []net.Addr
+	deadline := time.Now().Add(2 * time.Second)
+	for len(addrs) < 2 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+		addrs = l.Addrs()
+	}
+	if len(addrs) != 2 || addrs[0].String() == addrs[1].String() {
+		t.Fatalf("listening on %v, want two distinct addrs", addrs)
+	}
+	for _, a := range addrs {
+		c, err := net.Dial("tcp", a.String())
+		if err != nil {
+			t.Fatalf("dial %s: %v", a, err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+	}
+	for cm.Count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	locals := map[string]bool{}
+	cm.Range(func(c core.IConnection) bool {
+		locals[c.LocalAddr().String()] = true
+		return true
+	})
+	if cm.Count() != 2 || !locals[addrs[0].String()] || !locals[addrs[1].String()] {
+		t.Fatalf("count=%d locals=%v, want one conn per addr %v", cm.Count(), locals, addrs)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Listen err=%v after Close, want nil", err)
+	}
+	for _, a := range addrs {
+		if c, err := net.DialTimeout("tcp", a.String(), 200*time.Millisecond); err == nil {
+			_ = c.Close()
+			t.Fatalf("%s still accepting after Close", a)
+		}
+	}
+}
+
+func TestListenMultipleAddrsBindFailureReleasesOthers(t *testing.T) {
+	first := newScriptedListener()
+	l := New("a", Options{Addrs: []string{"b"}})
+	boom := errors.New("address in use")
+	l.listen = func(_, addr string) (net.Listener, error) {
+		if addr == "a" {
+			return first, nil
+		}
+		return nil, boom
+	}
+	if err := l.Listen(context.Background(), connmgr.New()); !errors.Is(err, boom) {
+		t.Fatalf("Listen err=%v, want %v", err, boom)
+	}
+	select {
+	case <-first.closed:
+	default:
+		t.Fatal("listener bound before the failure was not closed")
+	}
+}
+
+func TestConnectionMetaCapRejectsNewKeys(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	c := NewTCPConnection(a)
+	c.SetMaxMeta(2)
+
+	c.SetMeta("nodeID", uint32(7))
+	c.SetMeta("role", "node")
+	c.SetMeta("flood", 1) // 超出上限，被拒绝
+	c.SetMeta("nodeID", uint32(8))
+
+	if _, ok := c.GetMeta("flood"); ok {
+		t.Fatal("key beyond the cap was stored")
+	}
+	if v, _ := c.GetMeta("nodeID"); v != uint32(8) {
+		t.Fatalf("existing key not updated at cap: %v", v)
+	}
+	if n := len(c.Metadata()); n != 2 || c.MetaDropped() != 1 {
+		t.Fatalf("entries=%d dropped=%d, want 2 and 1", n, c.MetaDropped())
+	}
+
+	// 已达上限后框架保留的身份键仍须写入，否则登录绑定会被静默丢弃。
+	c.SetMeta(core.MetaDeviceIDKey, "dev-7")
+	if v, _ := c.GetMeta(core.MetaDeviceIDKey); v != "dev-7" || c.MetaDropped() != 1 {
+		t.Fatalf("reserved key at cap: value=%v dropped=%d", v, c.MetaDropped())
+	}
+
+	c.SetMaxMeta(0)
+	c.SetMeta("flood", 1)
+	if _, ok := c.GetMeta("flood"); !ok {
+		t.Fatal("SetMaxMeta(0) should lift the cap")
+	}
+}
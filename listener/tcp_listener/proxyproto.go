@@ -0,0 +1,171 @@
+package tcp_listener
+
+// 本文件承载 Core 框架中与 `proxyproto` 相关的通用逻辑。
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PROXY protocol（HAProxy 规范 v1 文本 / v2 二进制）：L4 负载均衡在连接开头写入一段前导，
+// 描述真实客户端地址。解析后通过包装连接的 RemoteAddr 暴露真实地址，负载均衡地址记入 MetaProxyPeerKey。
+
+// MetaProxyPeerKey 连接元数据中记录 socket 层对端（即负载均衡）地址的键，值为 string。
+const MetaProxyPeerKey = "proxyPeer"
+
+var (
+	// ErrProxyHeaderMissing 表示严格模式下连接未以 PROXY 前导开头。
+	ErrProxyHeaderMissing = errors.New("proxy protocol header missing")
+	// ErrProxyHeaderMalformed 表示 PROXY 前导格式非法。
+	ErrProxyHeaderMalformed = errors.New("proxy protocol header malformed")
+)
+
+var (
+	proxyV1Prefix = []byte("PROXY ")
+	proxyV2Sig    = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// proxyV1MaxLen 规范给出的 v1 行最大长度（含 CRLF）。
+const proxyV1MaxLen = 107
+
+// proxyConn 以解析出的真实客户端地址覆盖 RemoteAddr，并先回放前导之后已缓冲的字节。
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) { return c.r.Read(b) }
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.remote != nil {
+		return c.remote
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// readProxyHeader 在 timeout 内从 conn 开头读取 PROXY 前导，返回包装后的连接。
+// 严格模式下前导缺失或非法都返回错误；宽松模式沿用 socket 地址：缺失时已窥视的字节按普通数据回放，
+// 非法时丢弃已读出的前导部分。读取本身失败（超时、对端关闭）在两种模式下都返回错误。
+func (l *TCPListener) readProxyHeader(conn net.Conn) (net.Conn, error) {
+	strict := l.opts.ProxyProtocolStrict
+	if timeout := l.opts.ProxyHeaderTimeout; timeout > 0 {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	}
+	br := bufio.NewReaderSize(conn, proxyV1MaxLen+1)
+	pc := &proxyConn{Conn: conn, r: br}
+	first, err := br.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	var remote net.Addr
+	switch first[0] {
+	case proxyV1Prefix[0]:
+		if !peekPrefix(br, proxyV1Prefix) {
+			return absentProxyHeader(pc, strict)
+		}
+		remote, err = parseProxyV1(br)
+	case proxyV2Sig[0]:
+		if !peekPrefix(br, proxyV2Sig) {
+			return absentProxyHeader(pc, strict)
+		}
+		remote, err = parseProxyV2(br)
+	default:
+		return absentProxyHeader(pc, strict)
+	}
+	if errors.Is(err, ErrProxyHeaderMalformed) && !strict {
+		l.opts.Logger.Warn("malformed proxy header, fallback to socket address", "remote", conn.RemoteAddr().String(), "err", err)
+		return pc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	pc.remote = remote
+	return pc, nil
+}
+
+// absentProxyHeader 处理没有 PROXY 前导的连接。
+func absentProxyHeader(pc *proxyConn, strict bool) (net.Conn, error) {
+	if strict {
+		return nil, ErrProxyHeaderMissing
+	}
+	return pc, nil
+}
+
+// peekPrefix 判断缓冲开头是否为 prefix；对端提前结束时视为不匹配。
+func peekPrefix(br *bufio.Reader, prefix []byte) bool {
+	b, err := br.Peek(len(prefix))
+	return err == nil && bytes.Equal(b, prefix)
+}
+
+// parseProxyV1 解析 "PROXY TCP4|TCP6 src dst sport dport\r\n"；UNKNOWN 返回 nil 地址（沿用 socket 地址）。
+func parseProxyV1(br *bufio.Reader) (net.Addr, error) {
+	line, err := br.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, fmt.Errorf("%w: v1 line too long", ErrProxyHeaderMalformed)
+		}
+		return nil, err
+	}
+	if len(line) > proxyV1MaxLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, fmt.Errorf("%w: v1 line not CRLF terminated", ErrProxyHeaderMalformed)
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("%w: v1 fields %q", ErrProxyHeaderMalformed, fields)
+	}
+	ip := net.ParseIP(fields[2])
+	port, perr := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || perr != nil || (fields[1] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: v1 source %s:%s", ErrProxyHeaderMalformed, fields[2], fields[4])
+	}
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseProxyV2 解析二进制前导；LOCAL 命令与非 TCP/IP 地址族返回 nil 地址，附带的 TLV 一并跳过。
+func parseProxyV2(br *bufio.Reader) (net.Addr, error) {
+	var fixed [16]byte
+	if _, err := io.ReadFull(br, fixed[:]); err != nil {
+		return nil, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, fmt.Errorf("%w: v2 version %d", ErrProxyHeaderMalformed, fixed[12]>>4)
+	}
+	cmd := fixed[12] & 0x0F
+	if cmd > 1 {
+		return nil, fmt.Errorf("%w: v2 command %d", ErrProxyHeaderMalformed, cmd)
+	}
+	body := make([]byte, binary.BigEndian.Uint16(fixed[14:16]))
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, err
+	}
+	if cmd == 0 {
+		return nil, nil
+	}
+	switch fixed[13] {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, fmt.Errorf("%w: v2 ipv4 address block too short", ErrProxyHeaderMalformed)
+		}
+		return &net.TCPAddr{IP: net.IP(append([]byte(nil), body[0:4]...)), Port: int(binary.BigEndian.Uint16(body[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, fmt.Errorf("%w: v2 ipv6 address block too short", ErrProxyHeaderMalformed)
+		}
+		return &net.TCPAddr{IP: net.IP(append([]byte(nil), body[0:16]...)), Port: int(binary.BigEndian.Uint16(body[32:34]))}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,170 @@
+package tcp_listener
+
+// 本文件覆盖 Core 框架中与 `proxyproto` 相关的行为。
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// proxyV2Preamble 构造一段 PROXY 命令的 v2 前导，tlv 附加在地址块之后。
+func proxyV2Preamble(src net.IP, srcPort uint16, tlv []byte) []byte {
+	fam, dst := byte(0x11), net.IPv4(10, 0, 0, 1).To4()
+	if src.To4() == nil {
+		fam, dst = 0x21, net.ParseIP("fd00::1")
+	} else {
+		src = src.To4()
+	}
+	body := append(append([]byte{}, src...), dst...)
+	body = binary.BigEndian.AppendUint16(body, srcPort)
+	body = binary.BigEndian.AppendUint16(body, 9000)
+	body = append(body, tlv...)
+	out := append(append([]byte{}, proxyV2Sig...), 0x21, fam)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(body)))
+	return append(out, body...)
+}
+
+func testFrame(t *testing.T, payload string) []byte {
+	t.Helper()
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2)
+	frame, err := header.HeaderTcpCodec{}.Encode(hdr, []byte(payload))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return frame
+}
+
+// listenOne 以给定选项启动 listener，送入一条连接并由对端写出 preamble+frame，返回被接纳的连接。
+func listenOne(t *testing.T, opts Options, preamble []byte) (core.IConnection, *TCPListener) {
+	t.Helper()
+	server, client := pipePair(t)
+	sl := newScriptedListener()
+	sl.incoming <- server
+	l := newScriptedTCPListener(sl, opts)
+	cm := connmgr.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = l.Listen(ctx, cm) }()
+	go func() { _, _ = client.Write(append(preamble, testFrame(t, "hello")...)) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for cm.Count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(2 * time.Millisecond)
+	}
+	var got core.IConnection
+	cm.Range(func(c core.IConnection) bool { got = c; return false })
+	if got == nil {
+		t.Fatalf("connection not admitted")
+	}
+	return got, l
+}
+
+// assertFrameIntact 确认前导之后的帧没有被解析过程吞掉。
+func assertFrameIntact(t *testing.T, conn core.IConnection) {
+	t.Helper()
+	_, payload, err := header.HeaderTcpCodec{}.Decode(conn.Pipe())
+	if err != nil || string(payload) != "hello" {
+		t.Fatalf("frame after preamble payload=%q err=%v", payload, err)
+	}
+}
+
+func TestListenProxyV1ExposesClientAddr(t *testing.T) {
+	conn, _ := listenOne(t, Options{ProxyProtocol: true, ProxyProtocolStrict: true},
+		[]byte("PROXY TCP4 203.0.113.7 10.0.0.1 51234 9000\r\n"))
+	if got := conn.RemoteAddr().String(); got != "203.0.113.7:51234" {
+		t.Fatalf("RemoteAddr=%s, want 203.0.113.7:51234", got)
+	}
+	if peer, _ := conn.GetMeta(MetaProxyPeerKey); peer == nil || peer == "203.0.113.7:51234" {
+		t.Fatalf("proxy peer meta=%v, want balancer address", peer)
+	}
+	assertFrameIntact(t, conn)
+}
+
+func TestListenProxyV2ExposesClientAddr(t *testing.T) {
+	tlv := []byte{0x04, 0x00, 0x02, 0xAA, 0xBB} // PP2_TYPE_NOOP，应被跳过
+	conn, _ := listenOne(t, Options{ProxyProtocol: true, ProxyProtocolStrict: true},
+		proxyV2Preamble(net.ParseIP("2001:db8::42"), 4433, tlv))
+	if got := conn.RemoteAddr().String(); got != "[2001:db8::42]:4433" {
+		t.Fatalf("RemoteAddr=%s, want [2001:db8::42]:4433", got)
+	}
+	assertFrameIntact(t, conn)
+}
+
+func TestReadProxyHeaderV2IPv4(t *testing.T) {
+	l := New("unused", Options{ProxyProtocol: true, ProxyProtocolStrict: true})
+	server, client := pipePair(t)
+	go func() { _, _ = client.Write(proxyV2Preamble(net.IPv4(198, 51, 100, 9), 61000, nil)) }()
+	wrapped, err := l.readProxyHeader(server)
+	if err != nil {
+		t.Fatalf("readProxyHeader: %v", err)
+	}
+	if got := wrapped.RemoteAddr().String(); got != "198.51.100.9:61000" {
+		t.Fatalf("RemoteAddr=%s, want 198.51.100.9:61000", got)
+	}
+}
+
+func TestReadProxyHeaderStrictness(t *testing.T) {
+	cases := []struct {
+		name     string
+		preamble []byte
+	}{
+		{"absent", nil},
+		{"malformed", []byte("PROXY TCP4 not-an-ip 10.0.0.1 1 2\r\n")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name+"/strict", func(t *testing.T) {
+			l := New("unused", Options{ProxyProtocol: true, ProxyProtocolStrict: true})
+			server, client := pipePair(t)
+			go func() { _, _ = client.Write(append(tc.preamble, testFrame(t, "hello")...)) }()
+			_, err := l.readProxyHeader(server)
+			if !errors.Is(err, ErrProxyHeaderMissing) && !errors.Is(err, ErrProxyHeaderMalformed) {
+				t.Fatalf("strict err=%v, want missing/malformed", err)
+			}
+		})
+		t.Run(tc.name+"/permissive", func(t *testing.T) {
+			l := New("unused", Options{ProxyProtocol: true})
+			server, client := pipePair(t)
+			go func() { _, _ = client.Write(append(tc.preamble, testFrame(t, "hello")...)) }()
+			wrapped, err := l.readProxyHeader(server)
+			if err != nil {
+				t.Fatalf("permissive err=%v", err)
+			}
+			if wrapped.RemoteAddr() != server.RemoteAddr() {
+				t.Fatalf("RemoteAddr=%v, want socket address %v", wrapped.RemoteAddr(), server.RemoteAddr())
+			}
+			_, payload, err := header.HeaderTcpCodec{}.Decode(wrapped)
+			if err != nil || string(payload) != "hello" {
+				t.Fatalf("frame payload=%q err=%v", payload, err)
+			}
+		})
+	}
+}
+
+func TestListenProxyStrictClosesConnWithoutHeader(t *testing.T) {
+	server, client := pipePair(t)
+	sl := newScriptedListener()
+	sl.incoming <- server
+	l := newScriptedTCPListener(sl, Options{ProxyProtocol: true, ProxyProtocolStrict: true})
+	cm := connmgr.New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = l.Listen(ctx, cm) }()
+
+	go func() { _, _ = client.Write(testFrame(t, "hello")) }()
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		t.Fatalf("client read err=%v, want EOF after strict rejection", err)
+	}
+	if cm.Count() != 0 {
+		t.Fatalf("count=%d, want 0", cm.Count())
+	}
+}
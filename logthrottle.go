@@ -0,0 +1,85 @@
+package core
+
+// 本文件承载 Core 框架中与 `logthrottle` 相关的通用逻辑。
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultLogThrottle 热点告警路径默认的限流窗口。
+const DefaultLogThrottle = time.Second
+
+// ThrottledLogger 包装 slog.Logger，同一消息键在 interval 内只输出一次，避免故障期间日志刷屏。
+// 窗口结束后的下一条会附带 "suppressed" 字段，记录上个窗口内被吞掉的条数。
+type ThrottledLogger struct {
+	logger   *slog.Logger
+	interval time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*throttleState
+	now  func() time.Time // 测试可替换
+}
+
+type throttleState struct {
+	last       time.Time
+	suppressed int
+}
+
+// NewThrottledLogger 创建限流日志器；logger 为 nil 时使用 slog.Default，interval<=0 时不限流。
+func NewThrottledLogger(logger *slog.Logger, interval time.Duration) *ThrottledLogger {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &ThrottledLogger{logger: logger, interval: interval, keys: make(map[string]*throttleState), now: time.Now}
+}
+
+// Warn 以消息文本为键输出 Warn 日志。
+func (l *ThrottledLogger) Warn(msg string, args ...any) {
+	l.Log(context.Background(), slog.LevelWarn, msg, msg, args...)
+}
+
+// Error 以消息文本为键输出 Error 日志。
+func (l *ThrottledLogger) Error(msg string, args ...any) {
+	l.Log(context.Background(), slog.LevelError, msg, msg, args...)
+}
+
+// Log 以 key 限流输出日志；同一消息需要按类别分别限流时（如按错误类型）可传入更细的 key。
+func (l *ThrottledLogger) Log(ctx context.Context, level slog.Level, key, msg string, args ...any) {
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	suppressed, ok := l.allow(key)
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		args = append(args, "suppressed", suppressed)
+	}
+	l.logger.Log(ctx, level, msg, args...)
+}
+
+// allow 判断 key 当前是否可以输出，并返回上个窗口内被抑制的条数。
+func (l *ThrottledLogger) allow(key string) (int, bool) {
+	if l.interval <= 0 {
+		return 0, true
+	}
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	st, ok := l.keys[key]
+	if !ok {
+		l.keys[key] = &throttleState{last: now}
+		return 0, true
+	}
+	if now.Sub(st.last) < l.interval {
+		st.suppressed++
+		return 0, false
+	}
+	n := st.suppressed
+	st.last = now
+	st.suppressed = 0
+	return n, true
+}
@@ -0,0 +1,47 @@
+package core
+
+// 本文件覆盖 Core 框架中与 `logthrottle` 相关的行为。
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThrottledLoggerLogsOncePerWindowPerKey(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewThrottledLogger(slog.New(slog.NewTextHandler(&buf, nil)), time.Second)
+	now := time.Unix(1000, 0)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 100; i++ {
+		l.Warn("process queue full, drop frame", "queue", 0)
+	}
+	l.Log(context.Background(), slog.LevelWarn, "read loop exit:timeout", "read loop exit", "kind", "timeout")
+	l.Log(context.Background(), slog.LevelWarn, "read loop exit:timeout", "read loop exit", "kind", "timeout")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines within window, want one per key:\n%s", len(lines), buf.String())
+	}
+
+	buf.Reset()
+	now = now.Add(time.Second)
+	l.Warn("process queue full, drop frame", "queue", 0)
+	if out := buf.String(); strings.Count(out, "\n") != 1 || !strings.Contains(out, "suppressed=99") {
+		t.Fatalf("after window got %q, want one line with suppressed=99", out)
+	}
+}
+
+func TestThrottledLoggerZeroIntervalDisablesThrottle(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewThrottledLogger(slog.New(slog.NewTextHandler(&buf, nil)), 0)
+	for i := 0; i < 3; i++ {
+		l.Error("boom")
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 3 {
+		t.Fatalf("got %d lines, want 3", n)
+	}
+}
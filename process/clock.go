@@ -0,0 +1,55 @@
+package process
+
+// 本文件承载 Core 框架中与 `clock` 相关的通用逻辑。
+
+import (
+	"context"
+	"time"
+)
+
+// Clock 抽象调度器与 server 使用的时间源，默认走真实时间；测试可注入假时钟推进时间，
+// 无需真实 sleep 即可确定性地触发入队超时、panic 退避、父链路重连等待等行为。
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	// Sleep 等待 d 或 ctx 结束，返回 false 表示 ctx 已取消；d<=0 时立即返回。
+	Sleep(ctx context.Context, d time.Duration) bool
+}
+
+// Timer 是 Clock 创建的一次性定时器，语义与 *time.Timer 一致。
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// RealClock 基于 time 包的默认实现。
+type RealClock struct{}
+
+// Now 返回当前真实时间。
+func (RealClock) Now() time.Time { return time.Now() }
+
+// NewTimer 创建真实定时器。
+func (RealClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+// Sleep 按真实时间等待。
+func (c RealClock) Sleep(ctx context.Context, d time.Duration) bool { return SleepWith(ctx, c, d) }
+
+// SleepWith 用 clock 的定时器实现 Clock.Sleep，供自定义时钟复用。
+func SleepWith(ctx context.Context, clock Clock, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
@@ -0,0 +1,186 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `clock` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// fakeClock 只在 Advance 时推进时间并触发到期的定时器。
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	deadline time.Time
+	c        chan time.Time
+	stopped  bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	return t
+}
+
+// Advance 推进时间并触发所有已到期且未停止的定时器。
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		switch {
+		case t.stopped:
+		case !t.deadline.After(c.now):
+			t.c <- c.now
+		default:
+			pending = append(pending, t)
+		}
+	}
+	c.timers = pending
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	was := !t.stopped
+	t.stopped = true
+	return was
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) bool { return SleepWith(ctx, c, d) }
+
+// waiting 返回尚未触发且未停止的定时器数量，测试据此判断被测协程已进入等待。
+func (c *fakeClock) waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if !t.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		runtime.Gosched()
+	}
+}
+
+func TestFakeClockSleep(t *testing.T) {
+	clock := newFakeClock()
+	done := make(chan bool, 1)
+	go func() { done <- clock.Sleep(context.Background(), time.Hour) }()
+	waitFor(t, "sleep timer", func() bool { return clock.waiting() == 1 })
+	clock.Advance(time.Hour)
+	if !<-done {
+		t.Fatal("Sleep returned false after the clock advanced")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { done <- clock.Sleep(ctx, time.Hour) }()
+	waitFor(t, "sleep timer", func() bool { return clock.waiting() == 1 })
+	cancel()
+	if <-done {
+		t.Fatal("Sleep returned true after ctx was cancelled")
+	}
+}
+
+func TestConnWriterEnqueueTimeoutWithFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	d, err := NewSendDispatcher(SendOptions{ConnBuffer: 1, EnqueueTimeout: time.Minute, Clock: clock})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	defer close(release)
+	conn := &blockingSendConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &blockingPipe{release: release}}
+	hdr := &header.HeaderTcp{}
+	// a 被 writer 取走并阻塞在写出，b 占满单连接队列，c 在转交 writer 时等待入队超时。
+	results := make(chan error, 1)
+	for _, body := range []string{"a", "b", "c"} {
+		var cb func(error)
+		if body == "c" {
+			cb = func(err error) { results <- err }
+		}
+		if err := d.Dispatch(context.Background(), conn, hdr, []byte(body), header.HeaderTcpCodec{}, cb); err != nil {
+			t.Fatalf("Dispatch %s: %v", body, err)
+		}
+	}
+	waitFor(t, "writer enqueue timer", func() bool { return clock.waiting() == 1 })
+	select {
+	case err := <-results:
+		t.Fatalf("frame c finished before timeout: %v", err)
+	default:
+	}
+	clock.Advance(time.Minute)
+	select {
+	case err := <-results:
+		if !errors.Is(err, errEnqueueTimeout) {
+			t.Fatalf("frame c err=%v, want %v", err, errEnqueueTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame c never timed out")
+	}
+}
+
+func TestDispatcherPanicBackoffWithFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	p, err := NewDispatcher(DispatchOptions{
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ChannelCount:    1,
+		WorkersPerChan:  1,
+		ChannelBuffer:   4,
+		PanicBackoff:    time.Hour,
+		PanicBackoffMax: time.Hour,
+		Clock:           clock,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	defer p.Shutdown()
+	sub := &panickingSubProcess{}
+	if err := p.RegisterHandler(sub); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	conn := newPrerouteStubConn("c1")
+	p.OnReceive(context.Background(), conn, priorityHeader(1, 0), nil)
+	p.OnReceive(context.Background(), conn, priorityHeader(2, 0), nil)
+	waitFor(t, "panic backoff", func() bool { return sub.calls.Load() == 1 && clock.waiting() == 1 })
+	clock.Advance(time.Hour)
+	waitFor(t, "second frame", func() bool { return sub.calls.Load() == 2 })
+}
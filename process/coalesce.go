@@ -0,0 +1,121 @@
+package process
+
+// 本文件承载 Core 框架中与 `coalesce` 相关的通用逻辑。
+
+import (
+	"net"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// defaultCoalesceMaxBytes 为开启合并但未指定字节预算时的默认值。
+const defaultCoalesceMaxBytes = 64 << 10
+
+// drain 写出 first；开启合并时顺带取走连接队列中已就绪的帧，凑成一次写出。
+// 取帧顺序与逐帧写出时完全一致（高优先级先、同优先级 FIFO），每帧的回调仍各自触发且只触发一次。
+func (w *connWriter) drain(first sendTask) {
+	if w.coalesceFrames <= 1 {
+		first.finish(w.write(first), w.log)
+		return
+	}
+	batch := append(w.batch[:0], first)
+	size := len(first.payload)
+	for len(batch) < w.coalesceFrames && size < w.coalesceBytes {
+		task, ok := w.lanes.poll()
+		if !ok {
+			break
+		}
+		batch = append(batch, task)
+		size += len(task.payload)
+	}
+	if len(batch) == 1 {
+		first.finish(w.write(first), w.log)
+	} else {
+		w.writeBatch(batch)
+	}
+	clear(batch) // 释放对 payload/回调的引用
+	w.batch = batch[:0]
+}
+
+// writeBatch 把一批帧编码为多段缓冲后一次写出；编码失败或 ctx 已取消的帧单独回调错误，不影响其余帧。
+// 批内最早的 ctx deadline 作为整次写出的截止时间。
+func (w *connWriter) writeBatch(batch []sendTask) {
+	errs := make([]error, len(batch))
+	var bufs net.Buffers
+	var deadline time.Time
+	for i, task := range batch {
+		if errs[i] = taskCtxErr(task); errs[i] != nil {
+			continue
+		}
+		if d, ok := taskDeadline(task); ok && (deadline.IsZero() || d.Before(deadline)) {
+			deadline = d
+		}
+		bufs, errs[i] = appendTaskBuffers(bufs, task, w.encodeInWriter)
+	}
+	var werr error
+	if pipe := w.conn.Pipe(); pipe == nil {
+		werr = errNilPipe
+	} else if len(bufs) > 0 {
+		if !deadline.IsZero() {
+			defer setWriteDeadline(pipe, deadline)()
+		}
+		werr = writeBuffers(pipe, bufs)
+		w.closeOnWriteTimeout(werr)
+	}
+	for i, task := range batch {
+		if errs[i] == nil {
+			errs[i] = werr
+		}
+		task.finish(errs[i], w.log)
+	}
+}
+
+// appendTaskBuffers 把单个任务的线上字节追加到 bufs，HeaderTcp 帧的 payload 不做拷贝。
+func appendTaskBuffers(bufs net.Buffers, task sendTask, encodeInWriter bool) (net.Buffers, error) {
+	if task.codec == nil {
+		return bufs, errNilCodec
+	}
+	if !encodeInWriter {
+		return append(bufs, task.payload), nil
+	}
+	var codec header.HeaderTcpCodec
+	switch c := task.codec.(type) {
+	case header.HeaderTcpCodec:
+		codec = c
+	case *header.HeaderTcpCodec:
+		codec = *c
+	default:
+		encoded, err := task.codec.Encode(task.hdr, task.payload)
+		if err != nil {
+			return bufs, err
+		}
+		return append(bufs, encoded), nil
+	}
+	hdr, err := codec.EncodeHeader(header.CloneToTCP(task.hdr), len(task.payload))
+	if err != nil {
+		return bufs, err
+	}
+	if len(task.payload) == 0 {
+		return append(bufs, hdr), nil
+	}
+	return append(bufs, hdr, task.payload), nil
+}
+
+// writeBuffers 优先使用 pipe 的多段写能力（TCP 上为 writev），否则拼成一段后单次写出。
+func writeBuffers(pipe core.IPipe, bufs net.Buffers) error {
+	if bp, ok := pipe.(core.IBuffersPipe); ok {
+		_, err := bp.WriteBuffers(&bufs)
+		return err
+	}
+	total := 0
+	for _, b := range bufs {
+		total += len(b)
+	}
+	flat := make([]byte, 0, total)
+	for _, b := range bufs {
+		flat = append(flat, b...)
+	}
+	return core.WriteAll(pipe, flat)
+}
@@ -0,0 +1,135 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `coalesce` 相关的行为。
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// countingPipe 统计 Write 调用次数；gate 非空时首次写入阻塞到 gate 关闭，让后续帧在队列中堆积。
+type countingPipe struct {
+	sendStubPipe
+	writes  atomic.Int64
+	gate    chan struct{}
+	discard bool
+	once    sync.Once
+}
+
+func (p *countingPipe) Write(b []byte) (int, error) {
+	if p.gate != nil {
+		p.once.Do(func() { <-p.gate })
+	}
+	p.writes.Add(1)
+	if p.discard {
+		return len(b), nil
+	}
+	return p.sendStubPipe.Write(b)
+}
+
+type countingConn struct {
+	*prerouteStubConn
+	pipe *countingPipe
+}
+
+func (c *countingConn) Pipe() core.IPipe { return c.pipe }
+
+func TestSendDispatcherCoalescePreservesOrderAndCallbacks(t *testing.T) {
+	const n = 64
+	d, err := NewSendDispatcher(SendOptions{ConnBuffer: n, CoalesceMaxFrames: 16})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	gate := make(chan struct{})
+	conn := &countingConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &countingPipe{gate: gate}}
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	cbErrs := make(map[uint32]error)
+	const badID = 10 // 该帧的 codec 为空，应单独失败而不影响同批其他帧
+	for i := uint32(1); i <= n; i++ {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(i)
+		var codec core.IHeaderCodec = header.HeaderTcpCodec{}
+		if i == badID {
+			codec = nil
+		}
+		wg.Add(1)
+		id := i
+		if err := d.Dispatch(context.Background(), conn, hdr, []byte{byte(i)}, codec, func(err error) {
+			mu.Lock()
+			cbErrs[id] = err
+			mu.Unlock()
+			wg.Done()
+		}); err != nil {
+			t.Fatalf("Dispatch %d: %v", i, err)
+		}
+	}
+	close(gate)
+	wg.Wait()
+
+	if len(cbErrs) != n {
+		t.Fatalf("callbacks=%d, want %d", len(cbErrs), n)
+	}
+	for id, err := range cbErrs {
+		if (id == badID) != (err != nil) {
+			t.Fatalf("frame %d callback err=%v", id, err)
+		}
+	}
+	if !errors.Is(cbErrs[badID], errNilCodec) {
+		t.Fatalf("bad frame err=%v, want errNilCodec", cbErrs[badID])
+	}
+	r := bytes.NewReader(conn.pipe.Bytes())
+	for want := uint32(1); want <= n; want++ {
+		if want == badID {
+			continue
+		}
+		hdr, payload, err := header.HeaderTcpCodec{}.Decode(r)
+		if err != nil {
+			t.Fatalf("decode frame %d: %v", want, err)
+		}
+		if hdr.GetMsgID() != want || payload[0] != byte(want) {
+			t.Fatalf("frame order: got msgID %d, want %d", hdr.GetMsgID(), want)
+		}
+	}
+	if w := conn.pipe.writes.Load(); w >= n-1 {
+		t.Fatalf("writes=%d for %d frames, want coalesced", w, n)
+	}
+}
+
+func benchmarkCoalesce(b *testing.B, maxFrames int) {
+	d, err := NewSendDispatcher(SendOptions{ConnBuffer: 256, CoalesceMaxFrames: maxFrames})
+	if err != nil {
+		b.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	conn := &countingConn{prerouteStubConn: newPrerouteStubConn("bench"), pipe: &countingPipe{discard: true}}
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1)
+	payload := bytes.Repeat([]byte{0xAB}, 32)
+	var wg sync.WaitGroup
+	wg.Add(b.N)
+	cb := func(error) { wg.Done() }
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := d.Dispatch(context.Background(), conn, hdr, payload, header.HeaderTcpCodec{}, cb); err != nil {
+			b.Fatalf("Dispatch: %v", err)
+		}
+	}
+	wg.Wait()
+	b.StopTimer()
+	b.ReportMetric(float64(conn.pipe.writes.Load())/float64(b.N), "writes/frame")
+}
+
+// BenchmarkSendDispatcherSmallFrames 逐帧写出：每帧 header 与 payload 各一次 Write。
+func BenchmarkSendDispatcherSmallFrames(b *testing.B) { benchmarkCoalesce(b, 0) }
+
+// BenchmarkSendDispatcherSmallFramesCoalesced 合并已排队的帧，writes/frame 明显下降。
+func BenchmarkSendDispatcherSmallFramesCoalesced(b *testing.B) { benchmarkCoalesce(b, 64) }
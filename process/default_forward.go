@@ -0,0 +1,147 @@
+package process
+
+// 本文件承载 Core 框架中与 `default_forward` 相关的通用逻辑。
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// DefaultForwardOptions 配置 DefaultForwardHandler。
+type DefaultForwardOptions struct {
+	Logger *slog.Logger
+	// Target 为未在 ByProto 中列出的子协议的转发目标节点，0 表示不转发。
+	Target uint32
+	// ByProto 按子协议指定转发目标，优先于 Target。
+	ByProto map[uint8]uint32
+	// PreserveSource 为 true 时保留原始 SourceID（透明转发，回包可直接回到发送方）；
+	// 为 false 时改写为本节点，回包先回到本节点。
+	PreserveSource bool
+	// Routes 用于查找目标的下一跳，nil 时只查连接索引并回落到父链路。
+	Routes *RoutingTable
+}
+
+// DefaultForwardHandler 作为 DispatcherProcess 的默认处理器（RegisterDefaultHandler），把本地没有 handler 的帧
+// 转发到配置的目标节点。转发克隆经 header.CloneToTCPForForward 递减 hop_limit，耗尽时丢弃，
+// 两个互为默认转发目标的节点因此不会无限互转。
+type DefaultForwardHandler struct {
+	log            *slog.Logger
+	target         uint32
+	byProto        map[uint8]uint32
+	preserveSource bool
+	routes         *RoutingTable
+}
+
+// NewDefaultForwardHandler 创建默认转发处理器。
+func NewDefaultForwardHandler(opts DefaultForwardOptions) *DefaultForwardHandler {
+	log := opts.Logger
+	if log == nil {
+		log = slog.Default()
+	}
+	return &DefaultForwardHandler{
+		log:            log,
+		target:         opts.Target,
+		byProto:        opts.ByProto,
+		preserveSource: opts.PreserveSource,
+		routes:         opts.Routes,
+	}
+}
+
+// DefaultForwardFromConfig 按 routing.default_forward_* 创建默认转发处理器；未开启时返回 nil。
+func DefaultForwardFromConfig(cfg core.IConfig, log *slog.Logger) *DefaultForwardHandler {
+	if cfg == nil {
+		return nil
+	}
+	if raw, _ := cfg.Get(coreconfig.KeyDefaultForwardEnable); !core.ParseBool(raw, false) {
+		return nil
+	}
+	opts := DefaultForwardOptions{Logger: log}
+	if raw, ok := cfg.Get(coreconfig.KeyDefaultForwardTarget); ok {
+		if v, err := strconv.ParseUint(strings.TrimSpace(raw), 10, 32); err == nil {
+			opts.Target = uint32(v)
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyDefaultForwardMap); ok {
+		opts.ByProto = parseDefaultForwardMap(raw)
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyDefaultForwardPreserveSource); ok {
+		opts.PreserveSource = core.ParseBool(raw, false)
+	}
+	return NewDefaultForwardHandler(opts)
+}
+
+// parseDefaultForwardMap 解析 "子协议:节点;子协议:节点"，非法条目忽略。
+func parseDefaultForwardMap(raw string) map[uint8]uint32 {
+	out := make(map[uint8]uint32)
+	for _, item := range strings.Split(raw, ";") {
+		sub, node, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			continue
+		}
+		s, err1 := strconv.ParseUint(strings.TrimSpace(sub), 10, 8)
+		n, err2 := strconv.ParseUint(strings.TrimSpace(node), 10, 32)
+		if err1 != nil || err2 != nil || n == 0 {
+			continue
+		}
+		out[uint8(s)] = uint32(n)
+	}
+	return out
+}
+
+// SubProto/Init/AcceptCmd 满足 core.ISubProcess：作为默认处理器不绑定子协议，也不截获 Cmd。
+func (h *DefaultForwardHandler) SubProto() uint8 { return 0 }
+func (h *DefaultForwardHandler) Init() bool      { return true }
+func (h *DefaultForwardHandler) AcceptCmd() bool { return false }
+
+// AllowSourceMismatch 为 false：转发前照常经分发层校验登录状态、会话有效期与来源，
+// 子树中其他节点的帧只有在子连接的路由索引确实拥有该 SourceID 时才放行，避免未登录或伪造来源的帧
+// 被中继上行（PreserveSource=false 时更会被改写成本节点身份）。
+func (h *DefaultForwardHandler) AllowSourceMismatch() bool { return false }
+
+// targetFor 返回子协议 sub 的转发目标，0 表示不转发。
+func (h *DefaultForwardHandler) targetFor(sub uint8) uint32 {
+	if t, ok := h.byProto[sub]; ok {
+		return t
+	}
+	return h.target
+}
+
+// OnReceive 把帧改写为发往转发目标的克隆并交给下一跳；来自未登录连接、目标为本节点、无路由或 hop_limit 耗尽时丢弃。
+func (h *DefaultForwardHandler) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil || hdr == nil {
+		return
+	}
+	if core.ConnNodeID(conn) == 0 {
+		h.log.Warn("drop default-forward frame: connection not logged in", "trace_id", hdr.GetTraceID(), "subproto", hdr.SubProto(), "source", hdr.SourceID())
+		return
+	}
+	target := h.targetFor(hdr.SubProto())
+	local := srv.NodeID()
+	if target == 0 || target == local {
+		return
+	}
+	fwd, ok := header.CloneToTCPForForward(hdr)
+	if !ok {
+		h.log.Warn("drop default-forward frame: hop_limit exhausted", "trace_id", hdr.GetTraceID(), "subproto", hdr.SubProto(), "source", hdr.SourceID(), "target", target)
+		return
+	}
+	fwd.WithTargetID(target)
+	if !h.preserveSource {
+		fwd.WithSourceID(local)
+	}
+	hop, ok := h.routes.Lookup(srv.ConnManager(), target)
+	if !ok {
+		h.log.Warn("drop default-forward frame: target not found", "trace_id", hdr.GetTraceID(), "subproto", hdr.SubProto(), "target", target)
+		return
+	}
+	if err := srv.Send(ctx, hop.Conn.ID(), fwd, payload); err != nil {
+		h.log.Warn("default forward failed", "trace_id", hdr.GetTraceID(), "conn", hop.Conn.ID(), "target", target, "err", err)
+	}
+}
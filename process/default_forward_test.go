@@ -0,0 +1,139 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `default_forward` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func quietForwarder(opts DefaultForwardOptions) *DefaultForwardHandler {
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	return NewDefaultForwardHandler(opts)
+}
+
+// forwardHub 返回节点 local 的桩 server，其中 nodeID 为 peer 的连接 "to-<peer>" 已建索引。
+func forwardHub(t *testing.T, local, peer uint32, connID string) (*prerouteStubServer, *prerouteStubConn) {
+	t.Helper()
+	cm := connmgr.New()
+	c := newPrerouteStubConn(connID)
+	core.SetConnNodeID(c, peer)
+	if err := cm.Add(c); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	cm.UpdateNodeIndex(peer, c)
+	return newPrerouteStubServer(local, cm), c
+}
+
+func TestDefaultForwardSourceModes(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		preserve bool
+		wantSrc  uint32
+	}{
+		{name: "rewrite", preserve: false, wantSrc: 1},
+		{name: "preserve", preserve: true, wantSrc: 11},
+	} {
+		srv, _ := forwardHub(t, 1, 2, "to-2")
+		h := quietForwarder(DefaultForwardOptions{Target: 2, PreserveSource: tc.preserve})
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(42).WithSourceID(11).WithTargetID(1).WithHopLimit(5).WithTraceID(9)
+		in := newPrerouteStubConn("in")
+		core.SetConnNodeID(in, 11)
+		h.OnReceive(core.WithServerContext(context.Background(), srv), in, hdr, []byte("x"))
+		if len(srv.sends) != 1 {
+			t.Fatalf("%s: sends=%d, want 1", tc.name, len(srv.sends))
+		}
+		got := srv.sends[0]
+		if got.connID != "to-2" || got.targetID != 2 || got.hdr.SourceID() != tc.wantSrc || got.hopLimit != 4 || got.hdr.GetTraceID() != 9 {
+			t.Fatalf("%s: forwarded conn=%s target=%d source=%d hop=%d", tc.name, got.connID, got.targetID, got.hdr.SourceID(), got.hopLimit)
+		}
+		if hdr.SourceID() != 11 || hdr.GetHopLimit() != 5 {
+			t.Fatalf("%s: original header modified", tc.name)
+		}
+	}
+}
+
+// loopHub 把 Send 直接投递给对端 hub 的默认转发处理器，模拟两个互为默认转发目标的节点。
+type loopHub struct {
+	*prerouteStubServer
+	h    *DefaultForwardHandler
+	in   core.IConnection
+	peer *loopHub
+}
+
+func (s *loopHub) Send(ctx context.Context, connID string, hdr core.IHeader, payload []byte) error {
+	_ = s.prerouteStubServer.Send(ctx, connID, hdr, payload)
+	s.peer.h.OnReceive(core.WithServerContext(ctx, s.peer), s.peer.in, hdr, payload)
+	return nil
+}
+
+func TestDefaultForwardLoopEndsWhenHopLimitExhausted(t *testing.T) {
+	srvA, toB := forwardHub(t, 1, 2, "to-2")
+	srvB, toA := forwardHub(t, 2, 1, "to-1")
+	a := &loopHub{prerouteStubServer: srvA, h: quietForwarder(DefaultForwardOptions{Target: 2, PreserveSource: true}), in: toB}
+	b := &loopHub{prerouteStubServer: srvB, h: quietForwarder(DefaultForwardOptions{Target: 1, PreserveSource: true}), in: toA}
+	a.peer, b.peer = b, a
+
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(42).WithSourceID(11).WithTargetID(1)
+	client := newPrerouteStubConn("client")
+	core.SetConnNodeID(client, 11)
+	a.h.OnReceive(core.WithServerContext(context.Background(), a), client, hdr, nil)
+
+	// hop_limit 0 按 DefaultHopLimit 计，每次转发递减 1，降到 1 时不再转发。
+	if n := len(srvA.sends) + len(srvB.sends); n != int(header.DefaultHopLimit)-1 {
+		t.Fatalf("frame bounced %d times, want %d", n, header.DefaultHopLimit-1)
+	}
+}
+
+func TestDefaultForwardRejectsUnverifiedSources(t *testing.T) {
+	srv, _ := forwardHub(t, 1, 2, "to-2")
+	child := newPrerouteStubConn("child-11")
+	core.SetConnNodeID(child, 11)
+	if err := srv.cm.Add(child); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	srv.cm.UpdateNodeIndex(11, child)
+	ctx := core.WithServerContext(context.Background(), srv)
+	h := quietForwarder(DefaultForwardOptions{Target: 2})
+	mk := func(src uint32) core.IHeader {
+		return (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(42).WithSourceID(src).WithTargetID(1)
+	}
+
+	anon := newPrerouteStubConn("anon")
+	if !sourceMismatch(ctx, h, anon, mk(11)) {
+		t.Fatal("frame from a connection without nodeID passed the dispatcher source check")
+	}
+	if !sourceMismatch(ctx, h, child, mk(2)) {
+		t.Fatal("child claiming a node it does not own passed the dispatcher source check")
+	}
+	if sourceMismatch(ctx, h, child, mk(11)) {
+		t.Fatal("child's own frame rejected")
+	}
+
+	h.OnReceive(ctx, anon, mk(11), nil)
+	if len(srv.sends) != 0 {
+		t.Fatalf("sends=%d, want unauthenticated frame dropped", len(srv.sends))
+	}
+}
+
+func TestDefaultForwardFromConfig(t *testing.T) {
+	if DefaultForwardFromConfig(config.NewMap(nil), nil) != nil {
+		t.Fatal("handler created while routing.default_forward_enable is off")
+	}
+	h := DefaultForwardFromConfig(config.NewMap(map[string]string{
+		config.KeyDefaultForwardEnable:         "true",
+		config.KeyDefaultForwardTarget:         "2",
+		config.KeyDefaultForwardMap:            "5:9; 6:bad; x:3",
+		config.KeyDefaultForwardPreserveSource: "true",
+	}), nil)
+	if h == nil || !h.preserveSource || h.targetFor(5) != 9 || h.targetFor(6) != 2 || h.targetFor(42) != 2 || len(h.byProto) != 1 {
+		t.Fatalf("handler from config = %+v", h)
+	}
+}
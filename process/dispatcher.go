@@ -9,9 +9,11 @@ import (
 	"log/slog"
 	"strconv"
 	"sync"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/events"
 	"github.com/yttydcs/myflowhub-core/header"
 )
 
@@ -20,9 +22,24 @@ type DispatchOptions struct {
 	Logger         *slog.Logger
 	ChannelCount   int
 	WorkersPerChan int
-	ChannelBuffer  int
+	ChannelBuffer  int // 每个队列中单个优先级通道的容量。
 	Base           core.IProcess
 	Strategy       QueueSelectStrategy
+	// PanicBackoff 为 handler panic 后 worker 的初始暂停时长，连续 panic 时翻倍至 PanicBackoffMax；0 表示不暂停。
+	PanicBackoff    time.Duration
+	PanicBackoffMax time.Duration
+	// NoHandler 决定子协议没有专用 handler 时的处理方式，缺省 NoHandlerFallback。
+	NoHandler NoHandlerPolicy
+	// ReplyNoHandler 在 NoHandlerFallback 下且未注册默认处理器时，对本节点的 Cmd 帧回 protoerr.CodeNoHandler，
+	// 而不是静默丢弃（NoHandlerError 总是回错，不受此项影响）。
+	ReplyNoHandler bool
+	// LatencyHistogram 开启后 Metrics 额外按 HandlerLatencyBuckets 统计 handler 耗时分布。
+	LatencyHistogram bool
+	// Clock 为 handler 计时、panic 退避与会话过期判断使用的时间源，nil 表示真实时间。
+	Clock Clock
+	// EnqueueTimeout >0 时队列满不立即丢帧，而是阻塞调用 OnReceive 的读取协程至多该时长：
+	// 读取停止后内核接收缓冲与 TCP 窗口随之收满，对端自然减速；超时仍无空位才丢弃。0 表示立即丢弃。
+	EnqueueTimeout time.Duration
 }
 
 type dispatchEvent struct {
@@ -33,18 +50,30 @@ type dispatchEvent struct {
 }
 
 // DispatcherProcess 提供基于子协议路由的处理管线，支持多通道+多 worker 并发。
+// 每个队列按帧优先级（header.PriorityOf）拆分通道，worker 总是先处理高优先级帧。
 type DispatcherProcess struct {
 	log      *slog.Logger
+	hotLog   *core.ThrottledLogger // 队列满等热点告警的限流日志
 	base     core.IProcess
 	handlers map[uint8]core.ISubProcess
 	fallback core.ISubProcess
 
-	queues         []chan dispatchEvent
+	queues         []*priorityLanes[dispatchEvent]
 	chanCount      int
 	workersPerChan int
 
 	strategy QueueSelectStrategy
 
+	panicBackoff    time.Duration
+	panicBackoffMax time.Duration
+	noHandler       NoHandlerPolicy
+	replyNoHandler  bool
+	clock           Clock
+	enqueueTimeout  time.Duration
+
+	metrics     [64]subProtoStats // 按子协议号统计，见 Metrics
+	latencyHist bool
+
 	startOnce  sync.Once
 	runtimeCtx context.Context
 	cancel     context.CancelFunc
@@ -67,21 +96,32 @@ func NewDispatcher(opts DispatchOptions) (*DispatcherProcess, error) {
 	if log == nil {
 		log = slog.Default()
 	}
-	queues := make([]chan dispatchEvent, opts.ChannelCount)
+	queues := make([]*priorityLanes[dispatchEvent], opts.ChannelCount)
 	for i := range queues {
-		queues[i] = make(chan dispatchEvent, opts.ChannelBuffer)
+		queues[i] = newPriorityLanes[dispatchEvent](opts.ChannelBuffer)
 	}
 	if opts.Strategy == nil { // 预留策略扩展点，缺省时保持连接哈希语义。
 		opts.Strategy = ConnHashStrategy{}
 	}
+	if opts.Clock == nil {
+		opts.Clock = RealClock{}
+	}
 	return &DispatcherProcess{
-		log:            log,
-		base:           opts.Base,
-		handlers:       make(map[uint8]core.ISubProcess),
-		queues:         queues,
-		chanCount:      opts.ChannelCount,
-		workersPerChan: opts.WorkersPerChan,
-		strategy:       opts.Strategy,
+		log:             log,
+		hotLog:          core.NewThrottledLogger(log, core.DefaultLogThrottle),
+		base:            opts.Base,
+		handlers:        make(map[uint8]core.ISubProcess),
+		queues:          queues,
+		chanCount:       opts.ChannelCount,
+		workersPerChan:  opts.WorkersPerChan,
+		strategy:        opts.Strategy,
+		panicBackoff:    opts.PanicBackoff,
+		panicBackoffMax: opts.PanicBackoffMax,
+		noHandler:       opts.NoHandler,
+		replyNoHandler:  opts.ReplyNoHandler,
+		latencyHist:     opts.LatencyHistogram,
+		clock:           opts.Clock,
+		enqueueTimeout:  opts.EnqueueTimeout,
 	}, nil
 }
 
@@ -93,13 +133,31 @@ func NewDispatcherFromConfig(cfg core.IConfig, base core.IProcess, logger *slog.
 			rawStrategy = v
 		}
 	}
+	strategy := StrategyFromConfig(rawStrategy)
+	if threshold := readPositiveInt(cfg, coreconfig.KeyProcLargeFrameBytes, 0); threshold > 0 {
+		strategy = NewSizeAwareStrategy(uint32(threshold), strategy)
+	}
 	opts := DispatchOptions{
-		Logger:         logger,
-		Base:           base,
-		ChannelCount:   readPositiveInt(cfg, coreconfig.KeyProcChannelCount, 1),
-		WorkersPerChan: readPositiveInt(cfg, coreconfig.KeyProcWorkersPerChan, 1),
-		ChannelBuffer:  readPositiveInt(cfg, coreconfig.KeyProcChannelBuffer, 64),
-		Strategy:       StrategyFromConfig(rawStrategy),
+		Logger:          logger,
+		Base:            base,
+		ChannelCount:    readPositiveInt(cfg, coreconfig.KeyProcChannelCount, 1),
+		WorkersPerChan:  readPositiveInt(cfg, coreconfig.KeyProcWorkersPerChan, 1),
+		ChannelBuffer:   readPositiveInt(cfg, coreconfig.KeyProcChannelBuffer, 64),
+		Strategy:        strategy,
+		PanicBackoff:    readDurationMs(cfg, coreconfig.KeyProcPanicBackoffMS, 10),
+		PanicBackoffMax: readDurationMs(cfg, coreconfig.KeyProcPanicBackoffMaxMS, 1000),
+		EnqueueTimeout:  readDurationMs(cfg, coreconfig.KeyProcEnqueueTimeoutMS, 0),
+	}
+	if cfg != nil {
+		if v, ok := cfg.Get(coreconfig.KeyProcNoHandlerPolicy); ok {
+			opts.NoHandler = ParseNoHandlerPolicy(v)
+		}
+		if v, ok := cfg.Get(coreconfig.KeyProcReplyNoHandler); ok {
+			opts.ReplyNoHandler = core.ParseBool(v, false)
+		}
+		if v, ok := cfg.Get(coreconfig.KeyProcLatencyHistogram); ok {
+			opts.LatencyHistogram = core.ParseBool(v, false)
+		}
 	}
 	return NewDispatcher(opts)
 }
@@ -144,26 +202,27 @@ func (p *DispatcherProcess) ensureRuntime(ctx context.Context) {
 		runtimeCtx, cancel := context.WithCancel(ctx)
 		p.runtimeCtx = runtimeCtx
 		p.cancel = cancel
+		done := runtimeCtx.Done()
 		for i := range p.queues {
-			queue := p.queues[i]
-			p.wg.Add(1)
-			go func(q chan dispatchEvent) {
-				defer p.wg.Done()
-				workers := p.workersPerChan
-				var wg sync.WaitGroup
-				wg.Add(workers)
-				for k := 0; k < workers; k++ {
-					go func() {
-						defer wg.Done()
-						for evt := range q {
-							p.route(evt)
+			q := p.queues[i]
+			for k := 0; k < p.workersPerChan; k++ {
+				p.wg.Add(1)
+				go func() {
+					defer p.wg.Done()
+					// 每个 worker 独立退避，避免一个 panic 风暴拖慢其他 worker。
+					backoff := newPanicBackoff(p.panicBackoff, p.panicBackoffMax, p.clock)
+					// runtime 关闭后继续排空已入队事件再退出。
+					for {
+						evt, ok := q.next(done)
+						if !ok {
+							return
 						}
-					}()
-				}
-				<-runtimeCtx.Done()
-				close(q)
-				wg.Wait()
-			}(queue)
+						if p.route(evt) {
+							backoff.pause(done)
+						}
+					}
+				}()
+			}
 		}
 	})
 }
@@ -185,57 +244,77 @@ func (p *DispatcherProcess) preRoute(ctx context.Context, conn core.IConnection,
 	return true
 }
 
-// selectHandler 先按子协议号命中专用 handler，未命中时回退到默认处理器。
+// selectHandler 先按子协议号命中专用 handler，未命中时按 NoHandlerFallback 策略回退到默认处理器。
 func (p *DispatcherProcess) selectHandler(hdr core.IHeader) (core.ISubProcess, uint8) {
+	var h core.ISubProcess
 	sub, ok := extractSubProto(hdr)
-	if !ok {
-		return p.getFallback(), 0
+	if ok {
+		h = p.getHandler(sub)
+	}
+	if h == nil && (!ok || p.noHandler == NoHandlerFallback) {
+		h = p.getFallback()
 	}
-	h := p.getHandler(sub)
 	if h == nil {
-		return p.getFallback(), sub
+		p.stats(sub).noHandler.Add(1)
 	}
 	return h, sub
 }
 
 // callHandler 在单个 worker 内调用具体 handler，并把 panic 收敛到日志，避免拖垮整条分发管线。
-func (p *DispatcherProcess) callHandler(ctx context.Context, handler core.ISubProcess, conn core.IConnection, hdr core.IHeader, payload []byte) {
+// 返回 true 表示 handler 发生了 panic。
+func (p *DispatcherProcess) callHandler(ctx context.Context, handler core.ISubProcess, conn core.IConnection, hdr core.IHeader, payload []byte) (panicked bool) {
 	if handler == nil {
-		return
+		return false
 	}
+	sub, _ := extractSubProto(hdr)
+	start := p.clock.Now()
 	// panic 防护，避免单个 handler 崩溃影响整个 worker。
 	defer func() {
 		if r := recover(); r != nil {
+			panicked = true
 			p.log.Error("handler panic", "recover", r, "subproto", handler.SubProto(), "conn", conn.ID())
 		}
+		p.observeHandler(sub, p.clock.Now().Sub(start), panicked)
 	}()
 	handler.OnReceive(ctx, conn, hdr, payload)
+	return false
 }
 
-// route 串起选路、来源校验和最终调用，是 worker 实际消费事件时的核心路径。
-func (p *DispatcherProcess) route(evt dispatchEvent) {
+// route 串起选路、来源校验和最终调用，是 worker 实际消费事件时的核心路径；返回 handler 是否 panic。
+func (p *DispatcherProcess) route(evt dispatchEvent) bool {
 	handler, sub := p.selectHandler(evt.hdr)
+	p.stats(sub).received.Add(1)
 	if handler == nil {
-		p.log.Warn("no handler for sub proto", "subproto", sub, "conn", evt.conn.ID())
-		return
+		p.handleNoHandler(evt, sub)
+		return false
+	}
+
+	if p.rejectExpiredSession(evt, handler, sub) {
+		p.stats(sub).sessionExpired.Add(1)
+		return false
 	}
 
 	if sourceMismatch(evt.ctx, handler, evt.conn, evt.hdr) {
+		p.stats(sub).sourceMismatch.Add(1)
 		if p.log != nil {
-			p.log.Warn("drop frame due to source mismatch", "subproto", sub, "conn", evt.conn.ID(), "hdr_source", evt.hdr.SourceID(), "meta_node", extractNodeID(evt.conn))
+			p.log.Warn("drop frame due to source mismatch", "subproto", sub, "conn", evt.conn.ID(), "hdr_source", evt.hdr.SourceID(), "meta_node", core.ConnNodeID(evt.conn))
 		}
-		return
+		return false
 	}
 
+	if !handler.AllowSourceMismatch() {
+		// 来源已通过上面的校验，鉴权可信任 hdr.SourceID。
+		evt.ctx = core.WithSourceVerified(evt.ctx)
+	}
 	cont := p.preRoute(evt.ctx, evt.conn, evt.hdr, evt.payload)
 	if cont {
-		p.callHandler(evt.ctx, handler, evt.conn, evt.hdr, evt.payload)
-		return
+		return p.callHandler(evt.ctx, handler, evt.conn, evt.hdr, evt.payload)
 	}
 	// preRoute 已处理/转发。若是 Cmd 帧且 handler 声明接受 Cmd，则仍本地处理一次（不影响转发）。
 	if shouldInterceptCmd(handler, evt.hdr) {
-		p.callHandler(evt.ctx, handler, evt.conn, evt.hdr, evt.payload)
+		return p.callHandler(evt.ctx, handler, evt.conn, evt.hdr, evt.payload)
 	}
+	return false
 }
 
 // extractSubProto 统一处理空 header 场景，避免后续分支重复判空。
@@ -270,7 +349,7 @@ func sourceMismatch(ctx context.Context, h core.ISubProcess, conn core.IConnecti
 	if h.AllowSourceMismatch() {
 		return false
 	}
-	metaNode := extractNodeID(conn)
+	metaNode := core.ConnNodeID(conn)
 	// 未绑定 nodeID 视为未登录，拒绝处理（登录类 handler 可通过 AllowSourceMismatch 放行）
 	if metaNode == 0 {
 		return true
@@ -320,7 +399,7 @@ func (p *DispatcherProcess) ConfigSnapshot() (channels, workers, buffer int) {
 	channels = len(p.queues)
 	workers = p.workersPerChan
 	if channels > 0 {
-		buffer = cap(p.queues[0])
+		buffer = p.queues[0].capacity()
 	}
 	return
 }
@@ -346,16 +425,46 @@ func (p *DispatcherProcess) OnReceive(ctx context.Context, conn core.IConnection
 	idx := p.selectQueue(conn, hdr)
 	evt := dispatchEvent{ctx: ctx, conn: conn, hdr: hdr, payload: payload}
 	select {
-	case p.queues[idx] <- evt:
-		// 成功入队
 	case <-ctx.Done():
 		// 上下文取消
+		return
 	case <-p.runtimeCtx.Done():
 		// runtime 已关闭
+		return
 	default:
-		// 队列已满（非阻塞保护）
-		p.log.Warn("process queue full, drop frame", "queue", idx, "conn", conn.ID())
 	}
+	prio := header.PriorityOf(hdr)
+	q := p.queues[idx]
+	if q.tryPush(prio, evt) {
+		return
+	}
+	if p.enqueueTimeout > 0 {
+		// 背压：阻塞读取协程等待空位，而不是在此丢帧。
+		p.stats(hdr.SubProto()).queueWaits.Add(1)
+		err := q.push(prio, evt, p.runtimeCtx.Done(), p.enqueueTimeout, p.clock)
+		if err == nil || errors.Is(err, errDispatcherClosed) {
+			return
+		}
+	}
+	// 队列已满（非阻塞保护或等待超时）
+	p.stats(hdr.SubProto()).queueFull.Add(1)
+	p.hotLog.Warn("process queue full, drop frame", "queue", idx, "priority", prio, "conn", conn.ID())
+	publishQueueFull(ctx, conn, hdr, idx, prio)
+}
+
+// publishQueueFull 经 ctx 中 Server 的事件总线非阻塞发布 dispatcher.queue_full，无 Server 时跳过。
+func publishQueueFull(ctx context.Context, conn core.IConnection, hdr core.IHeader, queue int, prio uint8) {
+	srv := core.ServerFromContext(ctx)
+	if srv == nil || srv.EventBus() == nil {
+		return
+	}
+	srv.EventBus().TryPublish(ctx, events.DispatcherQueueFull, events.DispatcherQueueFullData{
+		ConnID:   conn.ID(),
+		Queue:    queue,
+		Priority: prio,
+		SubProto: hdr.SubProto(),
+		MsgID:    hdr.GetMsgID(),
+	}, nil)
 }
 
 // OnSend 把发送前钩子透明委托给基础流程，便于在同一处做审计或补字段。
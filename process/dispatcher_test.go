@@ -0,0 +1,107 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `dispatcher` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func TestDispatcherEnqueueTimeoutBlocksReaderInsteadOfDropping(t *testing.T) {
+	clock := newFakeClock()
+	p, err := NewDispatcher(DispatchOptions{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ChannelCount:   1,
+		WorkersPerChan: 1,
+		ChannelBuffer:  1,
+		EnqueueTimeout: time.Second,
+		Clock:          clock,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	defer p.Shutdown()
+	gate := &gateSubProcess{loginSubProcess: loginSubProcess{strictSubProcess{sub: 3}}, entered: make(chan struct{}, 8), release: make(chan struct{})}
+	if err := p.RegisterHandler(gate); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	conn := newPrerouteStubConn("c1")
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(3)
+	ctx := context.Background()
+
+	p.OnReceive(ctx, conn, hdr, nil)
+	<-gate.entered
+	p.OnReceive(ctx, conn, hdr, nil) // 占满唯一的队列槽位
+
+	// 读取协程在队列满时被挂起，而不是丢帧。
+	read := make(chan struct{})
+	go func() {
+		p.OnReceive(ctx, conn, hdr, nil)
+		close(read)
+	}()
+	waitFor(t, "reader blocked on full queue", func() bool { return clock.waiting() == 1 })
+	select {
+	case <-read:
+		t.Fatal("reader returned while queue was full")
+	default:
+	}
+	close(gate.release)
+	select {
+	case <-read:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader not resumed after queue drained")
+	}
+	waitFor(t, "all frames handled", func() bool { return p.Metrics()[3].Handled == 3 })
+	if m := p.Metrics()[3]; m.DropQueueFull != 0 || m.QueueWaits != 1 {
+		t.Fatalf("metrics=%+v, want no drops and 1 wait", m)
+	}
+}
+
+func TestDispatcherEnqueueTimeoutDropsAfterDeadline(t *testing.T) {
+	clock := newFakeClock()
+	p, err := NewDispatcher(DispatchOptions{
+		Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+		ChannelCount:   1,
+		WorkersPerChan: 1,
+		ChannelBuffer:  1,
+		EnqueueTimeout: 50 * time.Millisecond,
+		Clock:          clock,
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	defer p.Shutdown()
+	gate := &gateSubProcess{loginSubProcess: loginSubProcess{strictSubProcess{sub: 3}}, entered: make(chan struct{}, 8), release: make(chan struct{})}
+	if err := p.RegisterHandler(gate); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	defer close(gate.release)
+	conn := newPrerouteStubConn("c1")
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(3)
+	ctx := context.Background()
+
+	p.OnReceive(ctx, conn, hdr, nil)
+	<-gate.entered
+	p.OnReceive(ctx, conn, hdr, nil)
+
+	read := make(chan struct{})
+	go func() {
+		p.OnReceive(ctx, conn, hdr, nil)
+		close(read)
+	}()
+	waitFor(t, "reader blocked on full queue", func() bool { return clock.waiting() == 1 })
+	clock.Advance(50 * time.Millisecond)
+	select {
+	case <-read:
+	case <-time.After(2 * time.Second):
+		t.Fatal("reader not released after enqueue timeout")
+	}
+	if m := p.Metrics()[3]; m.DropQueueFull != 1 || m.QueueWaits != 1 {
+		t.Fatalf("metrics=%+v, want 1 drop after 1 wait", m)
+	}
+}
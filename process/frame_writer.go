@@ -3,8 +3,8 @@ package process
 // 本文件承载 Core 框架中与 `frame_writer` 相关的通用逻辑。
 
 import (
-	"encoding/binary"
 	"io"
+	"math"
 
 	core "github.com/yttydcs/myflowhub-core"
 	"github.com/yttydcs/myflowhub-core/header"
@@ -41,30 +41,37 @@ func WriteFrame(dst io.Writer, codec core.IHeaderCodec, frame core.Frame) error
 	}
 }
 
-func writeTCPFrame(dst io.Writer, _ header.HeaderTcpCodec, frame core.Frame) error {
-	tcpHdr := header.CloneToTCP(frame.Header)
-	if tcpHdr == nil {
-		return errNilCodec
+func writeTCPFrame(dst io.Writer, codec header.HeaderTcpCodec, frame core.Frame) error {
+	hdr, err := codec.EncodeHeader(header.CloneToTCP(frame.Header), len(frame.Payload))
+	if err != nil {
+		return err
 	}
-	if tcpHdr.HopLimit == 0 {
-		tcpHdr.HopLimit = header.DefaultHopLimit
+	return core.WriteAllBuffers(dst, hdr, frame.Payload)
+}
+
+// WriteStreamFrame 以流式帧写出 size 字节的 body：头部带 header.FlagStreamed，payload 直接从 body 拷贝，
+// 不在内存中拼出整帧。流式帧不受 codec.MaxPayload 约束，但长度仍受 PayloadLen（uint32）上限限制；
+// body 提前结束时返回 io.ErrUnexpectedEOF，此时连接上的帧已不完整，调用方应关闭连接。
+func WriteStreamFrame(dst io.Writer, codec header.HeaderTcpCodec, hdr core.IHeader, body io.Reader, size int64) error {
+	if size < 0 || size > math.MaxUint32 {
+		return header.ErrPayloadTooLarge
+	}
+	h := header.CloneToTCP(hdr)
+	h.Flags |= header.FlagStreamed
+	codec.MaxPayload = 0
+	head, err := codec.EncodeHeader(h, int(size))
+	if err != nil {
+		return err
+	}
+	if err := core.WriteAll(dst, head); err != nil {
+		return err
+	}
+	n, err := io.Copy(dst, io.LimitReader(body, size))
+	if err != nil {
+		return err
 	}
-	if uint32(len(frame.Payload)) != tcpHdr.PayloadLen {
-		tcpHdr.PayloadLen = uint32(len(frame.Payload))
+	if n < size {
+		return io.ErrUnexpectedEOF
 	}
-	buf := make([]byte, 32)
-	binary.BigEndian.PutUint16(buf[0:2], header.HeaderTcpMagicV2)
-	buf[2] = header.HeaderTcpVersionV2
-	buf[3] = 32
-	buf[4] = tcpHdr.TypeFmt
-	buf[5] = tcpHdr.Flags
-	buf[6] = tcpHdr.HopLimit
-	buf[7] = tcpHdr.RouteFlags
-	binary.BigEndian.PutUint32(buf[8:12], tcpHdr.MsgID)
-	binary.BigEndian.PutUint32(buf[12:16], tcpHdr.Source)
-	binary.BigEndian.PutUint32(buf[16:20], tcpHdr.Target)
-	binary.BigEndian.PutUint32(buf[20:24], tcpHdr.TraceID)
-	binary.BigEndian.PutUint32(buf[24:28], tcpHdr.Timestamp)
-	binary.BigEndian.PutUint32(buf[28:32], tcpHdr.PayloadLen)
-	return core.WriteAllBuffers(dst, buf, frame.Payload)
+	return nil
 }
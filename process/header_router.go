@@ -16,6 +16,7 @@ const (
 	RouteDecisionLocalDispatch
 	RouteDecisionFastForward
 	RouteDecisionBroadcastChildren
+	RouteDecisionDeviceForward
 )
 
 // String 返回决策类型的稳定字符串，便于日志和调试输出。
@@ -31,6 +32,8 @@ func (k RouteDecisionKind) String() string {
 		return "fast_forward"
 	case RouteDecisionBroadcastChildren:
 		return "broadcast_children"
+	case RouteDecisionDeviceForward:
+		return "device_forward"
 	default:
 		return "unknown"
 	}
@@ -65,11 +68,21 @@ func (r *HeaderRouter) Decide(localNodeID uint32, ingress core.ILink, hdr core.I
 	if hdr.Major() == header.MajorCmd {
 		return RouteDecision{Kind: RouteDecisionHopDispatch, Reason: "major_cmd"}
 	}
+	if header.IsLocalOnly(hdr) {
+		if t := hdr.TargetID(); t != 0 && t != localNodeID {
+			return RouteDecision{Kind: RouteDecisionDrop, Reason: "local_only_remote_target"}
+		}
+		return RouteDecision{Kind: RouteDecisionLocalDispatch, Reason: "local_only"}
+	}
+	// 已明确投递给本节点的帧先于设备目标判定，避免残留的 TargetDevice 把它再转发出去。
+	if t := hdr.TargetID(); t != 0 && t == localNodeID {
+		return RouteDecision{Kind: RouteDecisionLocalDispatch, Reason: "local_target"}
+	}
+	if header.TargetDevice(hdr) != "" {
+		return RouteDecision{Kind: RouteDecisionDeviceForward, Reason: "device_target"}
+	}
 	if hdr.TargetID() == 0 {
 		return RouteDecision{Kind: RouteDecisionBroadcastChildren, Reason: "broadcast_children"}
 	}
-	if hdr.TargetID() != localNodeID {
-		return RouteDecision{Kind: RouteDecisionFastForward, Reason: "remote_target"}
-	}
-	return RouteDecision{Kind: RouteDecisionLocalDispatch, Reason: "local_target"}
+	return RouteDecision{Kind: RouteDecisionFastForward, Reason: "remote_target"}
 }
@@ -30,6 +30,13 @@ func TestHeaderRouterDecide(t *testing.T) {
 		hdr.WithMajor(major).WithSubProto(sub).WithSourceID(source).WithTargetID(target)
 		return &hdr
 	}
+	devHdr := mkHdr(header.MajorMsg, 5, 10, 0)
+	header.SetTargetDevice(devHdr, "lamp-1")
+	devToUs := mkHdr(header.MajorOKResp, 5, 10, 7)
+	header.SetTargetDevice(devToUs, "lamp-1")
+	localOnly := func(h core.IHeader) core.IHeader {
+		return h.WithRouteFlags(h.GetRouteFlags() | header.RouteFlagLocalOnly)
+	}
 
 	cases := []struct {
 		name string
@@ -41,7 +48,12 @@ func TestHeaderRouterDecide(t *testing.T) {
 		{name: "major cmd enters hop dispatch", hdr: mkHdr(header.MajorCmd, 5, 10, 999), want: RouteDecisionHopDispatch},
 		{name: "broadcast children", hdr: mkHdr(header.MajorMsg, 5, 10, 0), want: RouteDecisionBroadcastChildren},
 		{name: "fast forward remote target", hdr: mkHdr(header.MajorOKResp, 5, 10, 9), want: RouteDecisionFastForward},
+		{name: "device target", hdr: devHdr, want: RouteDecisionDeviceForward},
+		{name: "local target wins over device", hdr: devToUs, want: RouteDecisionLocalDispatch},
 		{name: "local dispatch", hdr: mkHdr(header.MajorMsg, 5, 10, 7), want: RouteDecisionLocalDispatch},
+		{name: "local only broadcast stays local", hdr: localOnly(mkHdr(header.MajorMsg, 5, 10, 0)), want: RouteDecisionLocalDispatch},
+		{name: "local only to us", hdr: localOnly(mkHdr(header.MajorMsg, 5, 10, 7)), want: RouteDecisionLocalDispatch},
+		{name: "local only remote target dropped", hdr: localOnly(mkHdr(header.MajorMsg, 5, 10, 9)), want: RouteDecisionDrop},
 	}
 
 	for _, tc := range cases {
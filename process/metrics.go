@@ -0,0 +1,101 @@
+package process
+
+// 本文件承载 Core 框架中与 `metrics` 相关的通用逻辑。
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var handlerLatencyBuckets = [...]time.Duration{
+	100 * time.Microsecond, time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second,
+}
+
+// HandlerLatencyBuckets 返回 handler 耗时直方图的桶上界（含），最后一个桶之外计入 +Inf。
+func HandlerLatencyBuckets() []time.Duration {
+	return append([]time.Duration(nil), handlerLatencyBuckets[:]...)
+}
+
+// subProtoStats 是单个子协议的原子计数，按子协议号（0~63）定长存放，热路径无需加锁。
+type subProtoStats struct {
+	received       atomic.Uint64
+	handled        atomic.Uint64
+	panics         atomic.Uint64
+	queueFull      atomic.Uint64
+	queueWaits     atomic.Uint64
+	sourceMismatch atomic.Uint64
+	noHandler      atomic.Uint64
+	sessionExpired atomic.Uint64
+	handlerNanos   atomic.Uint64
+	buckets        [len(handlerLatencyBuckets) + 1]atomic.Uint64
+}
+
+// SubProtoMetrics 为单个子协议的计数快照。
+type SubProtoMetrics struct {
+	Received           uint64        `json:"received"` // 进入 worker 的帧数，不含入队时即被丢弃的 DropQueueFull
+	Handled            uint64        `json:"handled"`
+	Panics             uint64        `json:"panics"`
+	DropQueueFull      uint64        `json:"drop_queue_full"`
+	QueueWaits         uint64        `json:"queue_waits"` // 队列满时阻塞读取协程等待入队的次数（见 DispatchOptions.EnqueueTimeout）
+	DropSourceMismatch uint64        `json:"drop_source_mismatch"`
+	DropNoHandler      uint64        `json:"drop_no_handler"`
+	DropSessionExpired uint64        `json:"drop_session_expired"`
+	HandlerTime        time.Duration `json:"handler_time"`    // handler 累计耗时
+	LatencyBuckets     []uint64      `json:"latency_buckets"` // 与 HandlerLatencyBuckets 对齐，末位为 +Inf；未开启直方图时为 nil
+}
+
+// stats 返回子协议的计数槽；越界子协议号（理论上不会出现）计入 0 号。
+func (p *DispatcherProcess) stats(sub uint8) *subProtoStats {
+	if int(sub) >= len(p.metrics) {
+		sub = 0
+	}
+	return &p.metrics[sub]
+}
+
+// observeHandler 记录一次 handler 调用的耗时。
+func (p *DispatcherProcess) observeHandler(sub uint8, d time.Duration, panicked bool) {
+	s := p.stats(sub)
+	s.handled.Add(1)
+	if panicked {
+		s.panics.Add(1)
+	}
+	s.handlerNanos.Add(uint64(d))
+	if !p.latencyHist {
+		return
+	}
+	i := 0
+	for i < len(handlerLatencyBuckets) && d > handlerLatencyBuckets[i] {
+		i++
+	}
+	s.buckets[i].Add(1)
+}
+
+// Metrics 返回收到过帧的各子协议计数；各计数独立读取，并发写入时不保证彼此严格一致。
+func (p *DispatcherProcess) Metrics() map[uint8]SubProtoMetrics {
+	out := make(map[uint8]SubProtoMetrics)
+	for i := range p.metrics {
+		s := &p.metrics[i]
+		if s.received.Load() == 0 && s.queueFull.Load() == 0 {
+			continue
+		}
+		m := SubProtoMetrics{
+			Received:           s.received.Load(),
+			Handled:            s.handled.Load(),
+			Panics:             s.panics.Load(),
+			DropQueueFull:      s.queueFull.Load(),
+			QueueWaits:         s.queueWaits.Load(),
+			DropSourceMismatch: s.sourceMismatch.Load(),
+			DropNoHandler:      s.noHandler.Load(),
+			DropSessionExpired: s.sessionExpired.Load(),
+			HandlerTime:        time.Duration(s.handlerNanos.Load()),
+		}
+		if p.latencyHist {
+			m.LatencyBuckets = make([]uint64, len(s.buckets))
+			for j := range s.buckets {
+				m.LatencyBuckets[j] = s.buckets[j].Load()
+			}
+		}
+		out[uint8(i)] = m
+	}
+	return out
+}
@@ -0,0 +1,107 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `metrics` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// gateSubProcess 进入 handler 时通知 entered，并阻塞到 release 关闭。
+type gateSubProcess struct {
+	loginSubProcess
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *gateSubProcess) OnReceive(context.Context, core.IConnection, core.IHeader, []byte) {
+	s.entered <- struct{}{}
+	<-s.release
+}
+
+func TestDispatcherMetricsTallyPerSubProto(t *testing.T) {
+	p, err := NewDispatcher(DispatchOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), LatencyHistogram: true})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	strict := &strictSubProcess{sub: 5}
+	login := &loginSubProcess{strictSubProcess{sub: 2}}
+	for _, h := range []core.ISubProcess{strict, login} {
+		if err := p.RegisterHandler(h); err != nil {
+			t.Fatalf("RegisterHandler: %v", err)
+		}
+	}
+	cm := connmgr.New()
+	conn := newPrerouteStubConn("c1")
+	_ = cm.Add(conn)
+	core.SetConnNodeID(conn, 11)
+	cm.UpdateNodeIndex(11, conn)
+	ctx := core.WithServerContext(context.Background(), newPrerouteStubServer(1, cm))
+	route := func(sub uint8, src uint32) {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(sub).WithSourceID(src).WithTargetID(1)
+		p.route(dispatchEvent{ctx: ctx, conn: conn, hdr: hdr})
+	}
+
+	route(5, 11)
+	route(5, 11)
+	route(5, 99) // 来源与连接绑定不符
+	route(2, 0)  // 登录类 handler 放行
+	route(42, 11)
+
+	m := p.Metrics()
+	if got := m[5]; got.Received != 3 || got.Handled != 2 || got.DropSourceMismatch != 1 || got.DropNoHandler != 0 {
+		t.Fatalf("sub 5 metrics=%+v, want received 3 handled 2 mismatch 1", got)
+	}
+	if got := m[2]; got.Received != 1 || got.Handled != 1 || got.DropSourceMismatch != 0 {
+		t.Fatalf("sub 2 metrics=%+v, want received 1 handled 1", got)
+	}
+	if got := m[42]; got.Received != 1 || got.Handled != 0 || got.DropNoHandler != 1 {
+		t.Fatalf("sub 42 metrics=%+v, want received 1 no-handler 1", got)
+	}
+	var inBuckets uint64
+	for _, n := range m[5].LatencyBuckets {
+		inBuckets += n
+	}
+	if len(m[5].LatencyBuckets) != len(HandlerLatencyBuckets())+1 || inBuckets != 2 {
+		t.Fatalf("sub 5 latency buckets=%v, want 2 observations", m[5].LatencyBuckets)
+	}
+	if _, ok := m[7]; ok {
+		t.Fatal("idle sub proto reported in metrics")
+	}
+}
+
+func TestDispatcherMetricsCountQueueFullDrops(t *testing.T) {
+	p, err := NewDispatcher(DispatchOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil)), ChannelBuffer: 1})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	defer p.Shutdown()
+	gate := &gateSubProcess{loginSubProcess: loginSubProcess{strictSubProcess{sub: 3}}, entered: make(chan struct{}, 4), release: make(chan struct{})}
+	if err := p.RegisterHandler(gate); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	conn := newPrerouteStubConn("c1")
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(3)
+	ctx := context.Background()
+
+	p.OnReceive(ctx, conn, hdr, nil)
+	select {
+	case <-gate.entered:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler not entered")
+	}
+	p.OnReceive(ctx, conn, hdr, nil) // 占满唯一的队列槽位
+	p.OnReceive(ctx, conn, hdr, nil) // 丢弃
+	close(gate.release)
+
+	if got := p.Metrics()[3].DropQueueFull; got != 1 {
+		t.Fatalf("DropQueueFull=%d, want 1", got)
+	}
+}
@@ -0,0 +1,75 @@
+package process
+
+// 本文件承载 Core 框架中与 `nohandler` 相关的通用逻辑。
+
+import (
+	"fmt"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/protoerr"
+)
+
+// NoHandlerPolicy 决定子协议未注册专用 handler 时 DispatcherProcess 如何处理该帧。
+type NoHandlerPolicy uint8
+
+const (
+	// NoHandlerFallback 交给 RegisterDefaultHandler 注册的默认处理器，未注册时丢弃（缺省行为）。
+	NoHandlerFallback NoHandlerPolicy = iota
+	// NoHandlerDrop 记录日志后丢弃，即使注册了默认处理器。
+	NoHandlerDrop
+	// NoHandlerError 对目标为本节点的 Cmd 帧回一帧 protoerr.CodeNoHandler 错误回包，让请求方不必等到超时；其他帧丢弃。
+	NoHandlerError
+)
+
+// String 返回策略在配置中的名字。
+func (p NoHandlerPolicy) String() string {
+	switch p {
+	case NoHandlerDrop:
+		return "drop"
+	case NoHandlerError:
+		return "error"
+	default:
+		return "fallback"
+	}
+}
+
+// ParseNoHandlerPolicy 解析 fallback|drop|error，未知值返回 NoHandlerFallback。
+func ParseNoHandlerPolicy(raw string) NoHandlerPolicy {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "drop":
+		return NoHandlerDrop
+	case "error":
+		return NoHandlerError
+	default:
+		return NoHandlerFallback
+	}
+}
+
+// handleNoHandler 按策略处理找不到 handler 的帧：NoHandlerError，或开启 ReplyNoHandler 且没有默认处理器时，
+// 对目标为本节点的 Cmd 帧回错（带 FlagFireAndForget 的通知帧除外）。
+func (p *DispatcherProcess) handleNoHandler(evt dispatchEvent, sub uint8) {
+	p.hotLog.Warn("no handler for sub proto", "subproto", sub, "conn", evt.conn.ID(), "policy", p.noHandler.String())
+	reply := p.noHandler == NoHandlerError || (p.noHandler == NoHandlerFallback && p.replyNoHandler)
+	if !reply || evt.hdr == nil || evt.hdr.Major() != header.MajorCmd || header.IsFireAndForget(evt.hdr) {
+		return
+	}
+	srv := core.ServerFromContext(evt.ctx)
+	if srv == nil {
+		return
+	}
+	local := srv.NodeID()
+	if target := evt.hdr.TargetID(); target != 0 && target != local {
+		return
+	}
+	resp, payload := protoerr.BuildErrFrameWith(evt.hdr, protoerr.Error{
+		Code:   protoerr.CodeNoHandler,
+		Msg:    fmt.Sprintf("no handler for sub proto %d", sub),
+		Detail: map[string]any{"sub_proto": sub},
+	})
+	resp.WithSourceID(local)
+	if err := srv.Send(evt.ctx, evt.conn.ID(), resp, payload); err != nil {
+		p.log.Debug("no-handler error response failed", "subproto", sub, "conn", evt.conn.ID(), "err", err)
+	}
+}
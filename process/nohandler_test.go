@@ -0,0 +1,123 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `nohandler` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/protoerr"
+)
+
+// countingSubProcess 统计收到的帧数，用作默认处理器。
+type countingSubProcess struct{ calls int }
+
+func (s *countingSubProcess) SubProto() uint8           { return 0 }
+func (s *countingSubProcess) Init() bool                { return true }
+func (s *countingSubProcess) AcceptCmd() bool           { return false }
+func (s *countingSubProcess) AllowSourceMismatch() bool { return true }
+func (s *countingSubProcess) OnReceive(context.Context, core.IConnection, core.IHeader, []byte) {
+	s.calls++
+}
+
+// routeUnknown 以指定策略把一帧未注册子协议的帧交给 route，返回默认处理器调用次数与发出的帧。
+func routeUnknown(t *testing.T, policy NoHandlerPolicy, hdr core.IHeader) (int, []prerouteSendCall) {
+	t.Helper()
+	return routeUnknownWith(t, DispatchOptions{NoHandler: policy}, true, hdr)
+}
+
+// routeUnknownWith 与 routeUnknown 相同，但可指定完整选项并选择是否注册默认处理器。
+func routeUnknownWith(t *testing.T, opts DispatchOptions, withFallback bool, hdr core.IHeader) (int, []prerouteSendCall) {
+	t.Helper()
+	opts.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	p, err := NewDispatcher(opts)
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	fallback := &countingSubProcess{}
+	if withFallback {
+		p.RegisterDefaultHandler(fallback)
+	}
+	srv := newPrerouteStubServer(7, connmgr.New())
+	conn := newPrerouteStubConn("c1")
+	p.route(dispatchEvent{ctx: core.WithServerContext(context.Background(), srv), conn: conn, hdr: hdr})
+	return fallback.calls, srv.sends
+}
+
+func unknownFrame(major uint8, target uint32) core.IHeader {
+	return (&header.HeaderTcp{}).WithMajor(major).WithSubProto(42).WithSourceID(11).WithTargetID(target).WithMsgID(5)
+}
+
+func TestNoHandlerPolicyFallbackUsesDefaultHandler(t *testing.T) {
+	calls, sends := routeUnknown(t, NoHandlerFallback, unknownFrame(header.MajorCmd, 7))
+	if calls != 1 || len(sends) != 0 {
+		t.Fatalf("fallback calls=%d sends=%d, want 1/0", calls, len(sends))
+	}
+}
+
+func TestNoHandlerPolicyDropIgnoresDefaultHandler(t *testing.T) {
+	calls, sends := routeUnknown(t, NoHandlerDrop, unknownFrame(header.MajorCmd, 7))
+	if calls != 0 || len(sends) != 0 {
+		t.Fatalf("drop calls=%d sends=%d, want 0/0", calls, len(sends))
+	}
+}
+
+func TestNoHandlerPolicyErrorRespondsToLocalCmd(t *testing.T) {
+	calls, sends := routeUnknown(t, NoHandlerError, unknownFrame(header.MajorCmd, 7))
+	if calls != 0 || len(sends) != 1 {
+		t.Fatalf("error calls=%d sends=%d, want 0/1", calls, len(sends))
+	}
+	resp := sends[0].hdr
+	if sends[0].connID != "c1" || resp.Major() != header.MajorErrResp || resp.SubProto() != 42 ||
+		resp.TargetID() != 11 || resp.SourceID() != 7 || resp.GetMsgID() != 5 {
+		t.Fatalf("error response conn=%s hdr=%+v", sends[0].connID, resp)
+	}
+	if e, err := protoerr.Decode(sends[0].payload); err != nil || e.Code != protoerr.CodeNoHandler {
+		t.Fatalf("error payload %s: %+v %v", sends[0].payload, e, err)
+	}
+
+	for name, hdr := range map[string]core.IHeader{
+		"msg frame":       unknownFrame(header.MajorMsg, 7),
+		"remote cmd":      unknownFrame(header.MajorCmd, 99),
+		"zero target cmd": unknownFrame(header.MajorCmd, 0),
+	} {
+		_, sends := routeUnknown(t, NoHandlerError, hdr)
+		want := 0
+		if hdr.TargetID() == 0 {
+			want = 1 // target 0 视为发给本节点
+		}
+		if len(sends) != want {
+			t.Fatalf("%s: sends=%d, want %d", name, len(sends), want)
+		}
+	}
+	if ParseNoHandlerPolicy(" Error ") != NoHandlerError || ParseNoHandlerPolicy("bogus") != NoHandlerFallback {
+		t.Fatal("ParseNoHandlerPolicy mismatch")
+	}
+}
+
+func TestReplyNoHandlerOnlyWithoutFallback(t *testing.T) {
+	opts := DispatchOptions{ReplyNoHandler: true}
+	_, sends := routeUnknownWith(t, opts, false, unknownFrame(header.MajorCmd, 7))
+	if len(sends) != 1 || sends[0].major != header.MajorErrResp {
+		t.Fatalf("sends=%+v, want one 4040 error response", sends)
+	}
+	if e, err := protoerr.Decode(sends[0].payload); err != nil || e.Code != protoerr.CodeNoHandler || e.Detail["sub_proto"] != float64(42) {
+		t.Fatalf("error payload %s: %+v %v", sends[0].payload, e, err)
+	}
+
+	if calls, sends := routeUnknownWith(t, opts, true, unknownFrame(header.MajorCmd, 7)); calls != 1 || len(sends) != 0 {
+		t.Fatalf("with fallback calls=%d sends=%d, want 1/0", calls, len(sends))
+	}
+	if _, sends := routeUnknownWith(t, DispatchOptions{}, false, unknownFrame(header.MajorCmd, 7)); len(sends) != 0 {
+		t.Fatalf("ReplyNoHandler off: sends=%d, want 0", len(sends))
+	}
+	notify := unknownFrame(header.MajorCmd, 7).(*header.HeaderTcp).WithFireAndForget(true)
+	if _, sends := routeUnknownWith(t, opts, false, notify); len(sends) != 0 {
+		t.Fatalf("fire-and-forget frame answered: sends=%d", len(sends))
+	}
+}
@@ -0,0 +1,64 @@
+package process
+
+// 本文件承载 Core 框架中与 `panicbackoff` 相关的通用逻辑。
+
+import "time"
+
+// panicBackoff 为单个 worker 在 handler panic 后计算暂停时长：连续 panic 时间隔翻倍直到 max，
+// 距上次 panic 超过 max 的安静期后回到 base，用于抑制 panic 风暴而不影响偶发异常。
+type panicBackoff struct {
+	base time.Duration
+	max  time.Duration
+
+	streak int
+	last   time.Time
+	now    func() time.Time
+	clock  Clock
+}
+
+// newPanicBackoff 在 base<=0 时返回 nil，表示不启用退避；max<base 时取 base；clock 为 nil 时使用真实时间。
+func newPanicBackoff(base, max time.Duration, clock Clock) *panicBackoff {
+	if base <= 0 {
+		return nil
+	}
+	if max < base {
+		max = base
+	}
+	if clock == nil {
+		clock = RealClock{}
+	}
+	return &panicBackoff{base: base, max: max, now: clock.Now, clock: clock}
+}
+
+// onPanic 记录一次 panic 并返回本次应暂停的时长。
+func (b *panicBackoff) onPanic() time.Duration {
+	now := b.now()
+	if !b.last.IsZero() && now.Sub(b.last) > b.max {
+		b.streak = 0
+	}
+	b.last = now
+	d := b.base
+	for i := 0; i < b.streak && d < b.max; i++ {
+		d *= 2
+	}
+	if d > b.max {
+		d = b.max
+	}
+	b.streak++
+	return d
+}
+
+// pause 按退避暂停当前 worker，done 关闭时立即返回以便尽快排空队列。
+func (b *panicBackoff) pause(done <-chan struct{}) time.Duration {
+	if b == nil {
+		return 0
+	}
+	d := b.onPanic()
+	timer := b.clock.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C():
+	case <-done:
+	}
+	return d
+}
@@ -0,0 +1,84 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `panicbackoff` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+func TestPanicBackoffEscalatesAndResetsAfterQuietPeriod(t *testing.T) {
+	now := time.Unix(0, 0)
+	b := newPanicBackoff(10*time.Millisecond, 80*time.Millisecond, nil)
+	b.now = func() time.Time { return now }
+	want := []time.Duration{10, 20, 40, 80, 80}
+	for i, w := range want {
+		if got := b.onPanic(); got != w*time.Millisecond {
+			t.Fatalf("panic #%d backoff=%s, want %s", i+1, got, w*time.Millisecond)
+		}
+		now = now.Add(time.Millisecond)
+	}
+	now = now.Add(100 * time.Millisecond)
+	if got := b.onPanic(); got != 10*time.Millisecond {
+		t.Fatalf("backoff after quiet period=%s, want 10ms", got)
+	}
+	if newPanicBackoff(0, time.Second, nil) != nil {
+		t.Fatalf("zero base should disable backoff")
+	}
+}
+
+// panickingSubProcess 每次收到帧都 panic，并统计调用次数。
+type panickingSubProcess struct {
+	calls atomic.Int32
+}
+
+func (s *panickingSubProcess) SubProto() uint8           { return 1 }
+func (s *panickingSubProcess) Init() bool                { return true }
+func (s *panickingSubProcess) AcceptCmd() bool           { return false }
+func (s *panickingSubProcess) AllowSourceMismatch() bool { return true }
+func (s *panickingSubProcess) OnReceive(context.Context, core.IConnection, core.IHeader, []byte) {
+	s.calls.Add(1)
+	panic("boom")
+}
+
+func TestDispatcherPanicBackoffThrottlesPanicStorm(t *testing.T) {
+	const events = 200
+	run := func(backoff time.Duration) int32 {
+		p, err := NewDispatcher(DispatchOptions{
+			Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+			ChannelCount:    1,
+			WorkersPerChan:  1,
+			ChannelBuffer:   events,
+			PanicBackoff:    backoff,
+			PanicBackoffMax: backoff,
+		})
+		if err != nil {
+			t.Fatalf("NewDispatcher: %v", err)
+		}
+		defer p.Shutdown()
+		sub := &panickingSubProcess{}
+		if err := p.RegisterHandler(sub); err != nil {
+			t.Fatalf("RegisterHandler: %v", err)
+		}
+		conn := newPrerouteStubConn("c1")
+		for i := 0; i < events; i++ {
+			p.OnReceive(context.Background(), conn, priorityHeader(uint32(i), 0), nil)
+		}
+		time.Sleep(150 * time.Millisecond)
+		return sub.calls.Load()
+	}
+
+	if got := run(0); got != events {
+		t.Fatalf("without backoff handled %d panicking frames, want all %d", got, events)
+	}
+	// 每次 panic 后暂停 20ms，150ms 内最多处理约 8 帧。
+	if got := run(20 * time.Millisecond); got < 1 || got > 12 {
+		t.Fatalf("with backoff handled %d panicking frames in 150ms, want throttled to <=12", got)
+	}
+}
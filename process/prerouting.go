@@ -5,18 +5,37 @@ package process
 import (
 	"context"
 	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 	coreconfig "github.com/yttydcs/myflowhub-core/config"
 	"github.com/yttydcs/myflowhub-core/header"
 )
 
+// ForwardTransform 在帧被转发到下一跳前改写 header/payload（如跨寻址域翻译 nodeID、剥离内部标志）。
+// hdr 已是本次转发的独立克隆，可直接修改；返回 nil header 表示丢弃该帧。
+type ForwardTransform func(hdr core.IHeader, payload []byte) (core.IHeader, []byte)
+
+// PreRouteGuard 在选路前检查一帧，返回 false 表示丢弃（如限流）；须并发安全且足够轻量。
+type PreRouteGuard func(ctx context.Context, conn core.IConnection, hdr core.IHeader) bool
+
 // PreRoutingProcess 在进入子协议 handler 前做一次仅基于 header 的快速路由。
 type PreRoutingProcess struct {
-	log         *slog.Logger
-	cfg         core.IConfig
-	forwardMode bool
-	router      *HeaderRouter
+	log           *slog.Logger
+	cfg           core.IConfig
+	forwardChild  bool // 向下转发给子连接（含广播复制）
+	forwardParent bool // 向上转发给父连接
+	router        *HeaderRouter
+	routes        *RoutingTable
+	transforms    []ForwardTransform
+	guards        []PreRouteGuard
+	loopDetect    bool
+	pathMax       int
+	dedup         *seenSet    // 最近转发过的广播 (source, msgID)，nil 表示关闭去重
+	routeCache    *routeCache // 精确索引未命中时的选路结果缓存，nil 表示关闭
+	policies      [256]SubProtoPolicy
 }
 
 // NewPreRoutingProcess 创建预路由流程，并默认开启远端转发能力。
@@ -25,29 +44,222 @@ func NewPreRoutingProcess(log *slog.Logger) *PreRoutingProcess {
 		log = slog.Default()
 	}
 	return &PreRoutingProcess{
-		log:         log,
-		forwardMode: true,
-		router:      NewHeaderRouter(),
+		log:           log,
+		forwardChild:  true,
+		forwardParent: true,
+		router:        NewHeaderRouter(),
+		routes:        NewRoutingTable(),
+		routeCache:    newRouteCache(DefaultRouteCacheSize, DefaultRouteCacheNegativeTTL),
 	}
 }
 
-// WithConfig 绑定运行时配置，并同步读取是否允许转发远端目标帧。
+// WithRoutingTable 替换下一跳路由表，便于与其他组件（如子树汇总上报的处理器）共享同一张表。
+func (p *PreRoutingProcess) WithRoutingTable(t *RoutingTable) *PreRoutingProcess {
+	if t != nil {
+		p.routes = t
+	}
+	return p
+}
+
+// RoutingTable 返回当前使用的路由表。
+func (p *PreRoutingProcess) RoutingTable() *RoutingTable { return p.routes }
+
+// WithConfig 绑定运行时配置，并同步读取向下/向上转发开关；
+// routing.forward_to_child / routing.forward_to_parent 留空时沿用 routing.forward_remote。
 func (p *PreRoutingProcess) WithConfig(cfg core.IConfig) *PreRoutingProcess {
 	p.cfg = cfg
 	if cfg != nil {
 		if raw, ok := cfg.Get(coreconfig.KeyRoutingForwardRemote); ok {
-			p.forwardMode = core.ParseBool(raw, true)
+			p.WithForwardMode(core.ParseBool(raw, true))
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingForwardToChild); ok && strings.TrimSpace(raw) != "" {
+			p.forwardChild = core.ParseBool(raw, p.forwardChild)
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingForwardToParent); ok && strings.TrimSpace(raw) != "" {
+			p.forwardParent = core.ParseBool(raw, p.forwardParent)
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingLoopDetect); ok {
+			p.loopDetect = core.ParseBool(raw, false)
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingPathMax); ok {
+			if v, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil {
+				p.pathMax = v
+			}
+		}
+		size, ttl := 0, DefaultBroadcastDedupTTL
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingBroadcastDedupSize); ok {
+			if v, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil {
+				size = v
+			}
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingBroadcastDedupTTLMS); ok {
+			if v, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && v >= 0 {
+				ttl = time.Duration(v) * time.Millisecond
+			}
+		}
+		p.WithBroadcastDedup(size, ttl)
+		cacheSize, negTTL := DefaultRouteCacheSize, DefaultRouteCacheNegativeTTL
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingRouteCacheSize); ok {
+			if v, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil {
+				cacheSize = v
+			}
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingRouteCacheNegTTLMS); ok {
+			if v, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil {
+				negTTL = time.Duration(v) * time.Millisecond
+			}
+		}
+		p.WithRouteCache(cacheSize, negTTL)
+		if raw, ok := cfg.Get(coreconfig.KeyRoutingSubProtoPolicy); ok {
+			for sub, policy := range parseSubProtoPolicies(raw) {
+				p.WithSubProtoPolicy(sub, policy)
+			}
 		}
 	}
 	return p
 }
 
-// WithForwardMode 允许调用方显式覆盖默认转发开关，便于测试或极简节点裁剪。
+// WithBroadcastDedup 设置广播去重：记住最近 size 个 (SourceID, MsgID)，ttl 内重复到达的广播直接丢弃，
+// 避免网状拓扑中同一广播经多条路径反复扩散；size<=0 关闭去重，ttl<=0 表示记录只随容量淘汰。
+// 任一为 0 的帧无法区分，不参与去重；hop_limit 仍作为兜底。默认关闭：源节点重启后 MsgID 可能从头编号，
+// ttl 内合法的新广播会被误丢，开启前应确认网内 (SourceID, MsgID) 不会被这样复用。
+func (p *PreRoutingProcess) WithBroadcastDedup(size int, ttl time.Duration) *PreRoutingProcess {
+	p.dedup = newSeenSet(size, ttl)
+	return p
+}
+
+// WithRouteCache 设置选路结果缓存：对精确索引未命中的目标，记住最近 size 个回落到父链路的决策，
+// 以及 negTTL 内不可达的目标，避免对未知或已失联节点的帧洪泛每帧都扫描连接表。
+// 正向记录在经由的连接关闭、汇总路由变更或该连接不再是活动父链路时失效；size<=0 关闭缓存，negTTL<=0 不缓存不可达结果。
+func (p *PreRoutingProcess) WithRouteCache(size int, negTTL time.Duration) *PreRoutingProcess {
+	p.routeCache = newRouteCache(size, negTTL)
+	return p
+}
+
+// RouteCacheStats 返回选路结果缓存的累计计数，缓存关闭时为零值。
+func (p *PreRoutingProcess) RouteCacheStats() RouteCacheStats { return p.routeCache.stats() }
+
+// MarkUnreachable 把 target 记为不可达（如收到上游对该目标的不可达回包），负向有效期内发往它的帧直接丢弃；
+// target 作为本地直连节点上线或路由表变更时不受影响。缓存关闭时无效果。
+func (p *PreRoutingProcess) MarkUnreachable(target uint32) {
+	if p.routeCache != nil {
+		p.routeCache.markUnreachable(target, p.routes.Version())
+	}
+}
+
+// lookupRoute 为远端目标选下一跳：精确索引命中直接返回，否则先查缓存再完整查表并回填。
+// negative 为 true 表示命中不可达记录。
+func (p *PreRoutingProcess) lookupRoute(cm core.IConnectionManager, target uint32) (hop NextHop, ok, negative bool) {
+	if p.routeCache == nil {
+		hop, ok = p.routes.Lookup(cm, target)
+		return hop, ok, false
+	}
+	if c, found := cm.GetByNode(target); found && c != nil {
+		return NextHop{Conn: c, Kind: RouteDirect}, true, false
+	}
+	version := p.routes.Version()
+	if hop, ok, cached := p.routeCache.get(cm, target, version); cached {
+		return hop, ok, !ok
+	}
+	hop, ok = p.routes.Lookup(cm, target)
+	p.routeCache.put(target, hop, ok, version)
+	return hop, ok, false
+}
+
+// WithForwardMode 允许调用方显式覆盖默认转发开关，同时作用于向下与向上两个方向，便于测试或极简节点裁剪。
 func (p *PreRoutingProcess) WithForwardMode(enable bool) *PreRoutingProcess {
-	p.forwardMode = enable
+	return p.WithForwardDirections(enable, enable)
+}
+
+// WithForwardDirections 分别设置向下（子连接与广播）和向上（父连接）转发开关，
+// 例如只接收下行、从不向上中继的叶子节点可用 (true, false)。
+func (p *PreRoutingProcess) WithForwardDirections(toChild, toParent bool) *PreRoutingProcess {
+	p.forwardChild = toChild
+	p.forwardParent = toParent
+	return p
+}
+
+// WithSubProtoPolicy 为子协议 sub 设置转发策略，SubProtoPolicyDefault 恢复为跟随全局开关。
+// 须在开始收发前配置，运行中修改不保证对并发帧立即可见。
+func (p *PreRoutingProcess) WithSubProtoPolicy(sub uint8, policy SubProtoPolicy) *PreRoutingProcess {
+	p.policies[sub] = policy
 	return p
 }
 
+// SubProtoPolicy 返回子协议 sub 当前的转发策略。
+func (p *PreRoutingProcess) SubProtoPolicy(sub uint8) SubProtoPolicy { return p.policies[sub] }
+
+// directions 返回策略生效后的向下/向上转发开关：SubProtoPolicyForward 忽略全局开关。
+func (p *PreRoutingProcess) directions(policy SubProtoPolicy) (toChild, toParent bool) {
+	if policy == SubProtoPolicyForward {
+		return true, true
+	}
+	return p.forwardChild, p.forwardParent
+}
+
+// WithLoopDetection 开启转发环路检测：转发前把本节点追加到扩展头的途经路径（最多保留 maxPath 个，
+// <=0 取 header.MaxVisitedPath），收到途经路径已包含本节点的帧直接丢弃。
+func (p *PreRoutingProcess) WithLoopDetection(enable bool, maxPath int) *PreRoutingProcess {
+	p.loopDetect = enable
+	p.pathMax = maxPath
+	return p
+}
+
+// markVisited 在开启环路检测时检查原帧是否已途经本节点，并把本节点记入转发克隆；返回 false 表示检测到环路。
+func (p *PreRoutingProcess) markVisited(local uint32, hdr, fwdHdr core.IHeader) bool {
+	if !p.loopDetect {
+		return true
+	}
+	if header.PathContains(hdr, local) {
+		return false
+	}
+	header.AppendVisited(fwdHdr, local, p.pathMax)
+	return true
+}
+
+// appendTraceHop 对路由探测帧（header.RouteFlagTraceRoute）把本节点记录追加到转发 payload，并同步
+// 转发克隆的 PayloadLen；其他帧原样返回。只作用于单播转发路径，广播不追加。
+func appendTraceHop(local uint32, fwdHdr core.IHeader, payload []byte) []byte {
+	if !header.IsTraceRoute(fwdHdr) {
+		return payload
+	}
+	payload = header.AppendTraceHop(payload, local, time.Now())
+	fwdHdr.WithPayloadLength(uint32(len(payload)))
+	return payload
+}
+
+// WithForwardTransforms 按顺序追加转发前变换；未配置时转发帧保持原样。
+// 下一跳仍按变换前的目标选路，变换只影响真正发出的帧。
+func (p *PreRoutingProcess) WithForwardTransforms(ts ...ForwardTransform) *PreRoutingProcess {
+	for _, t := range ts {
+		if t != nil {
+			p.transforms = append(p.transforms, t)
+		}
+	}
+	return p
+}
+
+// WithGuards 按顺序追加选路前的检查（如 permission.RoleRateLimiter.PreRoute），任一拒绝即丢弃该帧。
+func (p *PreRoutingProcess) WithGuards(gs ...PreRouteGuard) *PreRoutingProcess {
+	for _, g := range gs {
+		if g != nil {
+			p.guards = append(p.guards, g)
+		}
+	}
+	return p
+}
+
+// applyTransforms 依次执行转发变换，任一变换返回 nil header 即判定丢弃。
+func (p *PreRoutingProcess) applyTransforms(hdr core.IHeader, payload []byte) (core.IHeader, []byte, bool) {
+	for _, t := range p.transforms {
+		hdr, payload = t(hdr, payload)
+		if hdr == nil {
+			return nil, nil, false
+		}
+	}
+	return hdr, payload, true
+}
+
 // OnListen 记录新连接进入预路由层，便于定位后续转发链路。
 func (p *PreRoutingProcess) OnListen(conn core.IConnection) {
 	p.log.Info("new connection", "id", conn.ID(), "remote", conn.RemoteAddr())
@@ -58,9 +270,11 @@ func (p *PreRoutingProcess) OnSend(_ context.Context, _ core.IConnection, _ core
 	return nil
 }
 
-// OnClose 记录连接离开，方便把转发异常与生命周期事件关联起来。
+// OnClose 记录连接离开，并清理经由该连接的子树汇总路由。
 func (p *PreRoutingProcess) OnClose(conn core.IConnection) {
 	p.log.Info("connection closed", "id", conn.ID())
+	p.routes.RemoveConn(conn.ID())
+	p.routeCache.removeConn(conn.ID())
 }
 
 // OnReceive 兼容 IProcess 入口，内部直接复用 PreRoute 的判定逻辑。
@@ -79,8 +293,16 @@ func (p *PreRoutingProcess) PreRoute(ctx context.Context, conn core.IConnection,
 		p.log.Warn("nil header, skip preroute")
 		return true
 	}
+	for _, g := range p.guards {
+		if !g(ctx, conn, hdr) {
+			p.log.Debug("drop frame: rejected by preroute guard", "subproto", hdr.SubProto(), "source", hdr.SourceID(), "conn", conn.ID())
+			return false
+		}
+	}
 
-	decision := p.router.Decide(srv.NodeID(), conn, hdr)
+	policy := p.policies[hdr.SubProto()]
+	toChild, toParent := p.directions(policy)
+	decision := applySubProtoPolicy(policy, p.router.Decide(srv.NodeID(), conn, hdr))
 	switch decision.Kind {
 	case RouteDecisionDrop:
 		p.log.Debug("drop frame in preroute", "reason", decision.Reason, "subproto", hdr.SubProto(), "source", hdr.SourceID())
@@ -88,58 +310,86 @@ func (p *PreRoutingProcess) PreRoute(ctx context.Context, conn core.IConnection,
 	case RouteDecisionHopDispatch, RouteDecisionLocalDispatch:
 		return true
 	case RouteDecisionBroadcastChildren:
+		if key, ok := broadcastKey(hdr.SourceID(), hdr.GetMsgID()); ok && p.dedup.seen(key) {
+			p.log.Debug("drop broadcast frame: duplicate", "subproto", hdr.SubProto(), "source", hdr.SourceID(), "msg_id", hdr.GetMsgID())
+			return false
+		}
 		fwdHdr, ok := p.cloneForForward(hdr)
 		if !ok {
 			p.log.Warn("drop broadcast frame: hop_limit exhausted", "subproto", hdr.SubProto(), "source", hdr.SourceID())
 			return false
 		}
-		p.handleBroadcast(ctx, srv, conn, fwdHdr, payload)
+		if !p.markVisited(srv.NodeID(), hdr, fwdHdr) {
+			p.log.Warn("drop broadcast frame: forwarding loop detected", "subproto", hdr.SubProto(), "source", hdr.SourceID(), "path", header.VisitedPath(hdr))
+			return false
+		}
+		fwdHdr, fwdPayload, ok := p.applyTransforms(fwdHdr, payload)
+		if !ok {
+			p.log.Debug("drop broadcast frame: rejected by forward transform", "subproto", hdr.SubProto(), "source", hdr.SourceID())
+			return false
+		}
+		p.handleBroadcast(ctx, srv, conn, fwdHdr, fwdPayload, toChild)
 		return false
 	case RouteDecisionFastForward:
 		target := hdr.TargetID()
 		local := srv.NodeID()
-		if !p.forwardMode {
+		if !toChild && !toParent {
 			p.log.Debug("forwarding disabled, drop remote-target frame", "target", target, "local", local)
 			return false
 		}
+		hop, found, negative := p.lookupRoute(srv.ConnManager(), target)
+		if negative {
+			p.log.Debug("drop frame: target cached as unreachable", "target", target, "subproto", hdr.SubProto())
+			return false
+		}
 		fwdHdr, ok := p.cloneForForward(hdr)
 		if !ok {
 			p.log.Warn("drop forwarded frame: hop_limit exhausted", "target", target, "local", local, "subproto", hdr.SubProto(), "source", hdr.SourceID())
 			return false
 		}
-		srcIsParent := isParentConn(conn)
-		if p.forwardToLocalChild(ctx, srv, fwdHdr, payload, target) {
+		if !p.markVisited(local, hdr, fwdHdr) {
+			p.log.Warn("drop forwarded frame: forwarding loop detected", "target", target, "local", local, "subproto", hdr.SubProto(), "path", header.VisitedPath(hdr))
+			return false
+		}
+		fwdHdr, fwdPayload, ok := p.applyTransforms(fwdHdr, appendTraceHop(local, fwdHdr, payload))
+		if !ok {
+			p.log.Debug("drop forwarded frame: rejected by forward transform", "target", target, "subproto", hdr.SubProto())
+			return false
+		}
+		if found && hop.Kind != RouteParent {
+			p.forwardToLocalChild(ctx, srv, hop, fwdHdr, fwdPayload, target, toChild)
 			return false
 		}
-		p.forwardToParent(ctx, srv, fwdHdr, payload, srcIsParent, target)
+		p.forwardToParent(ctx, srv, hop, found, fwdHdr, fwdPayload, isParentConn(conn), target, toParent)
+		return false
+	case RouteDecisionDeviceForward:
+		p.forwardToDevice(ctx, srv, conn, hdr, payload, toChild, toParent)
 		return false
 	default:
 		return true
 	}
 }
 
-// forwardOrDrop 统一包裹实际发送动作，把“关闭转发”与“发送失败记日志”收敛到一处。
+// forwardOrDrop 统一包裹实际发送动作，把发送失败记日志收敛到一处；方向开关由调用方判定。
 func (p *PreRoutingProcess) forwardOrDrop(sendFn func() error) {
-	if !p.forwardMode {
-		return
-	}
 	if err := sendFn(); err != nil {
 		p.log.Error("forward failed", "err", err)
 	}
 }
 
-// handleBroadcast 把广播帧复制给本地子连接，但显式跳过来源连接和父连接，避免回环。
-func (p *PreRoutingProcess) handleBroadcast(ctx context.Context, srv core.IServer, src core.IConnection, hdr core.IHeader, payload []byte) {
+// handleBroadcast 把广播帧复制给本地子连接，但显式跳过来源连接、父连接和本节点的回环连接，避免回环。
+func (p *PreRoutingProcess) handleBroadcast(ctx context.Context, srv core.IServer, src core.IConnection, hdr core.IHeader, payload []byte, toChild bool) {
+	if !toChild {
+		p.log.Debug("child forwarding disabled, drop broadcast frame", "from", hdr.SourceID(), "subproto", hdr.SubProto())
+		return
+	}
 	p.log.Info("broadcast frame", "from", hdr.SourceID(), "subproto", hdr.SubProto())
 	baseHdr := hdr
 	srv.ConnManager().Range(func(c core.IConnection) bool {
 		if c.ID() == src.ID() {
 			return true
 		}
-		if isParentConn(c) {
-			return true
-		}
-		if !p.forwardMode {
+		if isParentConn(c) || core.ConnRole(c) == core.RoleLocal {
 			return true
 		}
 		clone := baseHdr.Clone()
@@ -150,48 +400,121 @@ func (p *PreRoutingProcess) handleBroadcast(ctx context.Context, srv core.IServe
 	})
 }
 
-// forwardToLocalChild 优先命中本地直连或已索引的后代节点，把远端目标就地消化在当前节点。
-func (p *PreRoutingProcess) forwardToLocalChild(ctx context.Context, srv core.IServer, hdr core.IHeader, payload []byte, target uint32) bool {
-	if targetConn, ok := srv.ConnManager().GetByNode(target); ok {
-		p.forwardOrDrop(func() error {
-			return srv.Send(ctx, targetConn.ID(), hdr.Clone(), payload)
-		})
-		return true
+// forwardToLocalChild 把目标位于本地子树（精确索引或子树汇总路由命中）的帧就地消化在当前节点。
+// 向下转发关闭时直接丢弃，不再改走父节点。
+func (p *PreRoutingProcess) forwardToLocalChild(ctx context.Context, srv core.IServer, hop NextHop, hdr core.IHeader, payload []byte, target uint32, toChild bool) {
+	if !toChild {
+		p.log.Debug("child forwarding disabled, drop frame", "target", target)
+		return
 	}
-	var forwarded bool
-	srv.ConnManager().Range(func(c core.IConnection) bool {
-		if nid := extractNodeID(c); nid == target {
-			sendHdr := hdr.Clone()
-			p.forwardOrDrop(func() error {
-				return srv.Send(ctx, c.ID(), sendHdr, payload)
-			})
-			forwarded = true
-			return false
+	p.forwardOrDrop(func() error {
+		if hop.Kind == RouteDirect {
+			return p.sendWithFailover(ctx, srv, hop.Conn, hdr, payload, target)
 		}
-		return true
+		return srv.Send(ctx, hop.Conn.ID(), hdr.Clone(), payload)
 	})
-	return forwarded
+}
+
+// sendWithFailover 先发往 GetByNode 选中的连接；发送失败且管理器支持 IMultiNodeIndex 时，
+// 依次尝试该 nodeID 的其他可达连接，全部失败返回首个错误。
+func (p *PreRoutingProcess) sendWithFailover(ctx context.Context, srv core.IServer, primary core.IConnection, hdr core.IHeader, payload []byte, target uint32) error {
+	firstErr := srv.Send(ctx, primary.ID(), hdr.Clone(), payload)
+	if firstErr == nil {
+		return nil
+	}
+	multi, ok := srv.ConnManager().(core.IMultiNodeIndex)
+	if !ok {
+		return firstErr
+	}
+	for _, c := range multi.GetAllByNode(target) {
+		if c == primary {
+			continue
+		}
+		if err := srv.Send(ctx, c.ID(), hdr.Clone(), payload); err == nil {
+			p.log.Debug("forward failed over to alternate connection", "target", target, "failed", primary.ID(), "conn", c.ID())
+			return nil
+		}
+	}
+	return firstErr
 }
 
 // forwardToParent 在本地找不到目标时把帧继续上送父节点，但会阻止“父节点来的包再回父节点”。
-func (p *PreRoutingProcess) forwardToParent(ctx context.Context, srv core.IServer, hdr core.IHeader, payload []byte, srcIsParent bool, target uint32) {
+func (p *PreRoutingProcess) forwardToParent(ctx context.Context, srv core.IServer, hop NextHop, found bool, hdr core.IHeader, payload []byte, srcIsParent bool, target uint32, toParent bool) {
 	if srcIsParent {
 		p.log.Warn("drop frame from parent: target not found", "target", target)
 		return
 	}
-	if !p.forwardMode {
-		p.log.Warn("forwarding disabled, drop unroutable frame", "target", target)
+	if !toParent {
+		p.log.Warn("parent forwarding disabled, drop unroutable frame", "target", target)
 		return
 	}
-	if parent, ok := findParentConn(srv.ConnManager()); ok {
+	if found && hop.Kind == RouteParent {
 		p.forwardOrDrop(func() error {
-			return srv.Send(ctx, parent.ID(), hdr, payload)
+			return srv.Send(ctx, hop.Conn.ID(), hdr, payload)
 		})
 		return
 	}
 	p.log.Warn("drop frame: target not found", "target", target)
 }
 
+// forwardToDevice 按扩展头中的目标设备 ID 单播：本地设备索引命中时直接发给该连接，
+// 并把帧改写为对其节点 ID 的普通单播（清除设备扩展），未命中时上送父节点，父节点来的帧未命中则丢弃。
+func (p *PreRoutingProcess) forwardToDevice(ctx context.Context, srv core.IServer, src core.IConnection, hdr core.IHeader, payload []byte, toChild, toParent bool) {
+	dev := header.TargetDevice(hdr)
+	fwdHdr, ok := p.cloneForForward(hdr)
+	if !ok {
+		p.log.Warn("drop device frame: hop_limit exhausted", "device", dev, "subproto", hdr.SubProto(), "source", hdr.SourceID())
+		return
+	}
+	if !p.markVisited(srv.NodeID(), hdr, fwdHdr) {
+		p.log.Warn("drop device frame: forwarding loop detected", "device", dev, "subproto", hdr.SubProto(), "path", header.VisitedPath(hdr))
+		return
+	}
+	payload = appendTraceHop(srv.NodeID(), fwdHdr, payload)
+	cm := srv.ConnManager()
+	if c, ok := cm.GetByDevice(dev); ok && c.ID() != src.ID() {
+		if !toChild {
+			p.log.Debug("child forwarding disabled, drop device frame", "device", dev)
+			return
+		}
+		// 交给设备所在连接后设备目标即已解析，无论对端是否登记了 nodeID 都不再携带。
+		header.SetTargetDevice(fwdHdr, "")
+		if nodeID := core.ConnNodeID(c); nodeID != 0 {
+			fwdHdr.WithTargetID(nodeID)
+		}
+		fwdHdr, fwdPayload, ok := p.applyTransforms(fwdHdr, payload)
+		if !ok {
+			p.log.Debug("drop device frame: rejected by forward transform", "device", dev, "subproto", hdr.SubProto())
+			return
+		}
+		p.forwardOrDrop(func() error {
+			return srv.Send(ctx, c.ID(), fwdHdr, fwdPayload)
+		})
+		return
+	}
+	if isParentConn(src) {
+		p.log.Warn("drop device frame from parent: device not found", "device", dev)
+		return
+	}
+	if !toParent {
+		p.log.Warn("parent forwarding disabled, drop device frame", "device", dev)
+		return
+	}
+	parent, ok := findParentConn(cm)
+	if !ok {
+		p.log.Warn("drop device frame: device not found", "device", dev)
+		return
+	}
+	fwdHdr, fwdPayload, ok := p.applyTransforms(fwdHdr, payload)
+	if !ok {
+		p.log.Debug("drop device frame: rejected by forward transform", "device", dev, "subproto", hdr.SubProto())
+		return
+	}
+	p.forwardOrDrop(func() error {
+		return srv.Send(ctx, parent.ID(), fwdHdr, fwdPayload)
+	})
+}
+
 // cloneForForward 克隆并递减 hop_limit，确保每次跨节点转发都会消耗一跳。
 func (p *PreRoutingProcess) cloneForForward(hdr core.IHeader) (core.IHeader, bool) {
 	if hdr == nil {
@@ -211,39 +534,25 @@ func (p *PreRoutingProcess) cloneForForward(hdr core.IHeader) (core.IHeader, boo
 
 // isParentConn 通过连接元数据识别父链路，供转发与来源校验共用。
 func isParentConn(c core.IConnection) bool {
-	if c == nil {
-		return false
-	}
-	if role, ok := c.GetMeta(core.MetaRoleKey); ok {
-		if s, ok2 := role.(string); ok2 && s == core.RoleParent {
-			return true
-		}
-	}
-	return false
+	return core.ConnRole(c) == core.RoleParent
 }
 
-// extractNodeID 从连接元数据提取已登录节点号，未绑定时返回 0。
-func extractNodeID(c core.IConnection) uint32 {
-	if c == nil {
-		return 0
-	}
-	if meta, ok := c.GetMeta("nodeID"); ok {
-		if nid, ok2 := meta.(uint32); ok2 {
-			return nid
-		}
-	}
-	return 0
-}
-
-// findParentConn 在线程安全的连接管理器里查找唯一父连接。
+// findParentConn 在线程安全的连接管理器里查找当前活动父连接；只剩热备链路时退回热备。
 func findParentConn(cm core.IConnectionManager) (core.IConnection, bool) {
 	var parent core.IConnection
 	cm.Range(func(c core.IConnection) bool {
-		if isParentConn(c) {
-			parent = c
-			return false
+		if !isParentConn(c) {
+			return true
 		}
-		return true
+		parent = c
+		return isStandbyParent(c)
 	})
 	return parent, parent != nil
 }
+
+// isStandbyParent 判断父连接是否为热备链路。
+func isStandbyParent(c core.IConnection) bool {
+	v, ok := c.GetMeta(core.MetaParentStandbyKey)
+	standby, _ := v.(bool)
+	return ok && standby
+}
@@ -3,10 +3,15 @@ package process
 // 本文件覆盖 Core 框架中与 `prerouting` 相关的行为。
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"io"
+	"log/slog"
 	"net"
+	"slices"
 	"testing"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 	"github.com/yttydcs/myflowhub-core/config"
@@ -20,6 +25,7 @@ type prerouteStubServer struct {
 	cm     core.IConnectionManager
 	sends  []prerouteSendCall
 	bus    eventbus.IBus
+	fail   map[string]error // 按连接 ID 注入发送失败
 }
 
 type prerouteSendCall struct {
@@ -27,6 +33,8 @@ type prerouteSendCall struct {
 	targetID uint32
 	hopLimit uint8
 	major    uint8
+	hdr      core.IHeader
+	payload  []byte
 }
 
 func newPrerouteStubServer(nodeID uint32, cm core.IConnectionManager) *prerouteStubServer {
@@ -47,14 +55,16 @@ func (s *prerouteStubServer) EventBus() eventbus.IBus {
 	}
 	return s.bus
 }
-func (s *prerouteStubServer) Send(_ context.Context, connID string, hdr core.IHeader, _ []byte) error {
+func (s *prerouteStubServer) Send(_ context.Context, connID string, hdr core.IHeader, payload []byte) error {
 	s.sends = append(s.sends, prerouteSendCall{
 		connID:   connID,
 		targetID: hdr.TargetID(),
 		hopLimit: hdr.GetHopLimit(),
 		major:    hdr.Major(),
+		hdr:      hdr,
+		payload:  payload,
 	})
-	return nil
+	return s.fail[connID]
 }
 
 type prerouteStubConn struct {
@@ -321,3 +331,588 @@ func TestPreRouteFastForwardPrefersDirectChildThenParent(t *testing.T) {
 		}
 	})
 }
+
+func TestPreRouteFastForwardFailsOverToAlternateNodeConn(t *testing.T) {
+	proc := NewPreRoutingProcess(nil)
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+
+	ingress := newPrerouteStubConn("parent-ingress")
+	ingress.SetMeta(core.MetaRoleKey, core.RoleParent)
+	uplinkA := newPrerouteStubConn("hub-uplink-a")
+	uplinkB := newPrerouteStubConn("hub-uplink-b")
+	for _, c := range []core.IConnection{ingress, uplinkA, uplinkB} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	// 子 hub 经两条冗余上行可达；最近绑定的 B 为首选。
+	cm.AppendNodeIndex(8, uplinkA)
+	cm.AppendNodeIndex(8, uplinkB)
+	srv.fail = map[string]error{uplinkB.ID(): errors.New("writer closed")}
+
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(8).WithHopLimit(4)
+	if got := proc.PreRoute(ctx, ingress, hdr, []byte("payload")); got {
+		t.Fatalf("PreRoute()=%v, want false", got)
+	}
+	if len(srv.sends) != 2 {
+		t.Fatalf("send count=%d, want 2 (primary then failover)", len(srv.sends))
+	}
+	if srv.sends[0].connID != uplinkB.ID() || srv.sends[1].connID != uplinkA.ID() {
+		t.Fatalf("send order=%q,%q, want %q then %q", srv.sends[0].connID, srv.sends[1].connID, uplinkB.ID(), uplinkA.ID())
+	}
+}
+
+func TestPreRouteForwardTransformRewritesTarget(t *testing.T) {
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+
+	ingress := newPrerouteStubConn("parent-ingress")
+	ingress.SetMeta(core.MetaRoleKey, core.RoleParent)
+	child := newPrerouteStubConn("child-8")
+	child.SetMeta("nodeID", uint32(8))
+	for _, c := range []core.IConnection{ingress, child} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+
+	var order []string
+	proc := NewPreRoutingProcess(nil).WithForwardTransforms(
+		func(h core.IHeader, p []byte) (core.IHeader, []byte) {
+			order = append(order, "translate")
+			// 子域内节点 8 的地址为 108。
+			if h.TargetID() == 8 {
+				h.WithTargetID(108)
+			}
+			return h, p
+		},
+		func(h core.IHeader, p []byte) (core.IHeader, []byte) {
+			order = append(order, "strip")
+			return h.WithFlags(0), p
+		},
+	)
+
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(8).WithHopLimit(4).WithFlags(header.FlagACKRequired)
+	if got := proc.PreRoute(ctx, ingress, hdr, []byte("payload")); got {
+		t.Fatalf("PreRoute()=%v, want false", got)
+	}
+	if len(srv.sends) != 1 {
+		t.Fatalf("send count=%d, want 1", len(srv.sends))
+	}
+	if srv.sends[0].connID != child.ID() {
+		t.Fatalf("sent to %q, want %q (route by original target)", srv.sends[0].connID, child.ID())
+	}
+	if srv.sends[0].targetID != 108 {
+		t.Fatalf("forwarded target=%d, want 108", srv.sends[0].targetID)
+	}
+	if hdr.TargetID() != 8 || hdr.GetFlags() != header.FlagACKRequired {
+		t.Fatalf("transform must not mutate the ingress header")
+	}
+	if len(order) != 2 || order[0] != "translate" || order[1] != "strip" {
+		t.Fatalf("transform order=%v, want [translate strip]", order)
+	}
+
+	srv.sends = nil
+	drop := NewPreRoutingProcess(nil).WithForwardTransforms(func(core.IHeader, []byte) (core.IHeader, []byte) { return nil, nil })
+	if got := drop.PreRoute(ctx, ingress, hdr, []byte("payload")); got {
+		t.Fatalf("PreRoute()=%v, want false", got)
+	}
+	if len(srv.sends) != 0 {
+		t.Fatalf("transform returning nil header should drop the frame, sends=%v", srv.sends)
+	}
+}
+
+func TestPreRouteLoopDetectionPassesReplyThroughHub(t *testing.T) {
+	// 请求 11→9 经 hub 7 转发，处理方以 BuildTCPResponse 回包，回程再次经过 hub 7。
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	client := newPrerouteStubConn("client-11")
+	client.SetMeta("nodeID", uint32(11))
+	handler := newPrerouteStubConn("handler-9")
+	handler.SetMeta("nodeID", uint32(9))
+	for _, c := range []core.IConnection{client, handler} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	ctx := core.WithServerContext(context.Background(), srv)
+	proc := NewPreRoutingProcess(nil).WithLoopDetection(true, 8)
+	codec := header.HeaderTcpCodec{}
+
+	req := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(9).WithHopLimit(16)
+	if proc.PreRoute(ctx, client, req, nil) || len(srv.sends) != 1 || srv.sends[0].connID != "handler-9" {
+		t.Fatalf("request sends=%+v, want forwarded to handler-9", srv.sends)
+	}
+	raw, err := codec.Encode(srv.sends[0].hdr, nil)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	atHandler, _, err := codec.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if !header.PathContains(atHandler, 7) {
+		t.Fatalf("request path=%v, want hub 7 recorded", header.VisitedPath(atHandler))
+	}
+
+	resp := header.BuildTCPResponse(atHandler, 0, atHandler.SubProto())
+	if proc.PreRoute(ctx, handler, resp, nil) {
+		t.Fatalf("PreRoute()=true for reply, want forwarded")
+	}
+	if len(srv.sends) != 2 || srv.sends[1].connID != "client-11" {
+		t.Fatalf("reply sends=%+v, want forwarded to client-11", srv.sends)
+	}
+}
+
+func TestPreRouteLoopDetectionDropsReturningFrame(t *testing.T) {
+	// 两个 hub 的索引都把节点 99 指向对方，构成转发环路。
+	newHub := func(local uint32, peer string) (*prerouteStubServer, context.Context, core.IConnection) {
+		cm := connmgr.New()
+		srv := newPrerouteStubServer(local, cm)
+		in := newPrerouteStubConn("ingress")
+		in.SetMeta("nodeID", uint32(11))
+		out := newPrerouteStubConn(peer)
+		out.SetMeta("nodeID", uint32(99))
+		for _, c := range []core.IConnection{in, out} {
+			if err := cm.Add(c); err != nil {
+				t.Fatalf("Add(%s): %v", c.ID(), err)
+			}
+		}
+		return srv, core.WithServerContext(context.Background(), srv), in
+	}
+	srvA, ctxA, inA := newHub(7, "to-b")
+	srvB, ctxB, inB := newHub(5, "to-a")
+	procA := NewPreRoutingProcess(nil).WithLoopDetection(true, 8)
+	procB := NewPreRoutingProcess(nil).WithLoopDetection(true, 8)
+
+	// 每跳都经过编解码，确认途经路径随扩展头上线传输。
+	wire := func(h core.IHeader) core.IHeader {
+		codec := header.HeaderTcpCodec{}
+		raw, err := codec.Encode(h, nil)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		got, _, err := codec.Decode(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return got
+	}
+
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(99).WithHopLimit(16)
+	if procA.PreRoute(ctxA, inA, hdr, nil) || len(srvA.sends) != 1 {
+		t.Fatalf("hub A sends=%d, want 1", len(srvA.sends))
+	}
+	atB := wire(srvA.sends[0].hdr)
+	if got := header.VisitedPath(atB); !slices.Equal(got, []uint32{7}) {
+		t.Fatalf("path at B=%v, want [7]", got)
+	}
+	if procB.PreRoute(ctxB, inB, atB, nil) || len(srvB.sends) != 1 {
+		t.Fatalf("hub B sends=%d, want 1", len(srvB.sends))
+	}
+	backAtA := wire(srvB.sends[0].hdr)
+	if got := header.VisitedPath(backAtA); !slices.Equal(got, []uint32{7, 5}) {
+		t.Fatalf("path back at A=%v, want [7 5]", got)
+	}
+	if procA.PreRoute(ctxA, inA, backAtA, nil) {
+		t.Fatalf("PreRoute()=true for looping frame, want false")
+	}
+	if len(srvA.sends) != 1 {
+		t.Fatalf("hub A sends=%d after loop, want frame dropped", len(srvA.sends))
+	}
+}
+
+func TestPreRouteForwardDirections(t *testing.T) {
+	type paths struct{ child, parent, broadcast int }
+	run := func(t *testing.T, proc *PreRoutingProcess) paths {
+		t.Helper()
+		cm := connmgr.New()
+		srv := newPrerouteStubServer(7, cm)
+		ctx := core.WithServerContext(context.Background(), srv)
+		parent := newPrerouteStubConn("parent")
+		parent.SetMeta(core.MetaRoleKey, core.RoleParent)
+		sibling := newPrerouteStubConn("child-11")
+		sibling.SetMeta(core.MetaRoleKey, core.RoleChild)
+		sibling.SetMeta("nodeID", uint32(11))
+		target := newPrerouteStubConn("child-8")
+		target.SetMeta(core.MetaRoleKey, core.RoleChild)
+		target.SetMeta("nodeID", uint32(8))
+		for _, c := range []*prerouteStubConn{parent, sibling, target} {
+			if err := cm.Add(c); err != nil {
+				t.Fatalf("Add(%s): %v", c.ID(), err)
+			}
+		}
+		frame := func(target, msgID uint32) core.IHeader {
+			return (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).
+				WithSourceID(11).WithTargetID(target).WithMsgID(msgID).WithHopLimit(4)
+		}
+		var got paths
+		count := func(fn func()) int {
+			before := len(srv.sends)
+			fn()
+			return len(srv.sends) - before
+		}
+		got.child = count(func() { proc.PreRoute(ctx, sibling, frame(8, 1), nil) })
+		got.parent = count(func() { proc.PreRoute(ctx, sibling, frame(99, 2), nil) })
+		got.broadcast = count(func() { proc.PreRoute(ctx, parent, frame(0, 3), nil) })
+		return got
+	}
+
+	cases := []struct {
+		name          string
+		child, parent bool
+		want          paths
+	}{
+		{"both", true, true, paths{1, 1, 2}},
+		{"child only", true, false, paths{1, 0, 2}},
+		{"parent only", false, true, paths{0, 1, 0}},
+		{"none", false, false, paths{0, 0, 0}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := run(t, NewPreRoutingProcess(nil).WithForwardDirections(tc.child, tc.parent))
+			if got != tc.want {
+				t.Fatalf("sends=%+v, want %+v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("config keys override forward_remote", func(t *testing.T) {
+		cfg := config.NewMap(map[string]string{
+			config.KeyRoutingForwardRemote:   "false",
+			config.KeyRoutingForwardToChild:  "true",
+			config.KeyRoutingForwardToParent: "",
+		})
+		if got := run(t, NewPreRoutingProcess(nil).WithConfig(cfg)); got != (paths{1, 0, 2}) {
+			t.Fatalf("sends=%+v, want child-only", got)
+		}
+	})
+}
+
+func TestPreRouteUnicastByDeviceID(t *testing.T) {
+	setup := func(t *testing.T) (*prerouteStubServer, context.Context, *prerouteStubConn) {
+		t.Helper()
+		cm := connmgr.New()
+		srv := newPrerouteStubServer(7, cm)
+		parent := newPrerouteStubConn("parent")
+		parent.SetMeta(core.MetaRoleKey, core.RoleParent)
+		ingress := newPrerouteStubConn("child-11")
+		ingress.SetMeta(core.MetaRoleKey, core.RoleChild)
+		ingress.SetMeta("nodeID", uint32(11))
+		lamp := newPrerouteStubConn("child-8")
+		lamp.SetMeta(core.MetaRoleKey, core.RoleChild)
+		lamp.SetMeta("nodeID", uint32(8))
+		core.SetConnDeviceID(lamp, "lamp-1")
+		plug := newPrerouteStubConn("child-plug")
+		plug.SetMeta(core.MetaRoleKey, core.RoleChild)
+		core.SetConnDeviceID(plug, "plug-3")
+		for _, c := range []*prerouteStubConn{parent, ingress, lamp, plug} {
+			if err := cm.Add(c); err != nil {
+				t.Fatalf("Add(%s): %v", c.ID(), err)
+			}
+		}
+		return srv, core.WithServerContext(context.Background(), srv), ingress
+	}
+	frame := func(device string) core.IHeader {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithHopLimit(4)
+		header.SetTargetDevice(hdr, device)
+		return hdr
+	}
+	proc := NewPreRoutingProcess(nil)
+
+	t.Run("known device", func(t *testing.T) {
+		srv, ctx, ingress := setup(t)
+		if got := proc.PreRoute(ctx, ingress, frame("lamp-1"), nil); got {
+			t.Fatal("device frame dispatched locally")
+		}
+		if len(srv.sends) != 1 || srv.sends[0].connID != "child-8" {
+			t.Fatalf("sends=%+v, want one to child-8", srv.sends)
+		}
+		sent := srv.sends[0].hdr
+		if sent.TargetID() != 8 || header.TargetDevice(sent) != "" || sent.GetHopLimit() != 3 {
+			t.Fatalf("last hop target=%d device=%q hop=%d, want plain unicast to 8", sent.TargetID(), header.TargetDevice(sent), sent.GetHopLimit())
+		}
+	})
+
+	t.Run("device without node id", func(t *testing.T) {
+		srv, ctx, ingress := setup(t)
+		proc.PreRoute(ctx, ingress, frame("plug-3"), nil)
+		if len(srv.sends) != 1 || srv.sends[0].connID != "child-plug" {
+			t.Fatalf("sends=%+v, want one to child-plug", srv.sends)
+		}
+		if header.TargetDevice(srv.sends[0].hdr) != "" {
+			t.Fatal("device target still set after handing frame to the device's conn")
+		}
+	})
+
+	t.Run("unknown device goes to parent", func(t *testing.T) {
+		srv, ctx, ingress := setup(t)
+		proc.PreRoute(ctx, ingress, frame("fridge-2"), nil)
+		if len(srv.sends) != 1 || srv.sends[0].connID != "parent" {
+			t.Fatalf("sends=%+v, want one to parent", srv.sends)
+		}
+		if header.TargetDevice(srv.sends[0].hdr) != "fridge-2" {
+			t.Fatal("device target lost when forwarding upward")
+		}
+	})
+
+	t.Run("unknown device from parent dropped", func(t *testing.T) {
+		srv, ctx, _ := setup(t)
+		parent, _ := srv.cm.Get("parent")
+		proc.PreRoute(ctx, parent, frame("fridge-2"), nil)
+		if len(srv.sends) != 0 {
+			t.Fatalf("sends=%+v, want none", srv.sends)
+		}
+	})
+}
+
+func TestPreRouteGuardRejectsBeforeRouting(t *testing.T) {
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+	ingress := newPrerouteStubConn("child-ingress")
+	core.SetConnNodeID(ingress, 8)
+	target := newPrerouteStubConn("child-9")
+	core.SetConnNodeID(target, 9)
+	for _, c := range []core.IConnection{ingress, target} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	cm.UpdateNodeIndex(9, target)
+
+	allow := false
+	proc := NewPreRoutingProcess(nil).WithGuards(nil, func(_ context.Context, conn core.IConnection, _ core.IHeader) bool {
+		return allow || core.ConnNodeID(conn) != 8
+	})
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(3).WithSourceID(8).WithTargetID(9)
+	if proc.PreRoute(ctx, ingress, hdr, []byte("x")) || len(srv.sends) != 0 {
+		t.Fatalf("guarded frame should be dropped, sends=%+v", srv.sends)
+	}
+	allow = true
+	if proc.PreRoute(ctx, ingress, hdr, []byte("x")) || len(srv.sends) != 1 {
+		t.Fatalf("allowed frame should be fast-forwarded, sends=%+v", srv.sends)
+	}
+}
+
+func TestPreRouteLocalOnlyNeverForwards(t *testing.T) {
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+	ingress := newPrerouteStubConn("child-ingress")
+	core.SetConnRole(ingress, core.RoleChild)
+	child := newPrerouteStubConn("child-9")
+	core.SetConnRole(child, core.RoleChild)
+	core.SetConnNodeID(child, 9)
+	parent := newPrerouteStubConn("parent")
+	core.SetConnRole(parent, core.RoleParent)
+	for _, c := range []core.IConnection{ingress, child, parent} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	cm.UpdateNodeIndex(9, child)
+	proc := NewPreRoutingProcess(nil)
+
+	for _, tc := range []struct {
+		name      string
+		target    uint32
+		wantLocal bool
+	}{
+		{name: "to local node", target: 7, wantLocal: true},
+		{name: "broadcast", target: 0, wantLocal: true},
+		{name: "to child", target: 9},
+		{name: "unknown target", target: 88},
+	} {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).
+			WithTargetID(tc.target).WithRouteFlags(header.RouteFlagLocalOnly | header.PriorityHigh)
+		if got := proc.PreRoute(ctx, ingress, hdr, []byte("diag")); got != tc.wantLocal {
+			t.Fatalf("%s: PreRoute()=%v, want %v", tc.name, got, tc.wantLocal)
+		}
+		if len(srv.sends) != 0 {
+			t.Fatalf("%s: local-only frame forwarded: %+v", tc.name, srv.sends)
+		}
+	}
+
+	// 未带标志的同一帧照常转发给子连接，确认上面的断言不是因为缺少路由。
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(9)
+	if proc.PreRoute(ctx, ingress, hdr, []byte("x")) || len(srv.sends) != 1 || srv.sends[0].connID != child.ID() {
+		t.Fatalf("unflagged frame sends=%+v, want one to %s", srv.sends, child.ID())
+	}
+}
+
+func TestPreRouteTraceRouteAppendsHopOnForward(t *testing.T) {
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+	ingress := newPrerouteStubConn("child-ingress")
+	core.SetConnRole(ingress, core.RoleChild)
+	child := newPrerouteStubConn("child-9")
+	core.SetConnRole(child, core.RoleChild)
+	core.SetConnNodeID(child, 9)
+	for _, c := range []core.IConnection{ingress, child} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	cm.UpdateNodeIndex(9, child)
+	proc := NewPreRoutingProcess(nil)
+
+	prev := header.AppendTraceHop(nil, 3, time.UnixMilli(1000))
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).
+		WithTargetID(9).WithRouteFlags(header.RouteFlagTraceRoute).WithPayloadLength(uint32(len(prev)))
+	if proc.PreRoute(ctx, ingress, hdr, prev) {
+		t.Fatal("probe for a remote target dispatched locally")
+	}
+	if len(srv.sends) != 1 || srv.sends[0].connID != "child-9" {
+		t.Fatalf("sends=%+v, want one forward to child-9", srv.sends)
+	}
+	sent := srv.sends[0]
+	hops, err := header.ParseTraceHops(sent.payload)
+	if err != nil || len(hops) != 2 || hops[0].NodeID != 3 || hops[1].NodeID != 7 {
+		t.Fatalf("forwarded hops=%+v err=%v, want [3 7]", hops, err)
+	}
+	if sent.hdr.PayloadLength() != uint32(len(sent.payload)) || hdr.PayloadLength() != uint32(len(prev)) || len(prev) != header.TraceHopSize {
+		t.Fatalf("payload len fwd=%d/%d orig=%d/%d", sent.hdr.PayloadLength(), len(sent.payload), hdr.PayloadLength(), len(prev))
+	}
+
+	// 未带标志的帧 payload 原样转发。
+	plain := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(9)
+	proc.PreRoute(ctx, ingress, plain, []byte("data"))
+	if got := srv.sends[1].payload; string(got) != "data" {
+		t.Fatalf("plain frame payload=%q, want unchanged", got)
+	}
+}
+
+func TestPreRouteSubProtoPolicies(t *testing.T) {
+	type result struct {
+		local bool
+		sends []string
+	}
+	run := func(t *testing.T, proc *PreRoutingProcess, sub uint8, target uint32) result {
+		t.Helper()
+		cm := connmgr.New()
+		srv := newPrerouteStubServer(7, cm)
+		ctx := core.WithServerContext(context.Background(), srv)
+		ingress := newPrerouteStubConn("child-11")
+		core.SetConnRole(ingress, core.RoleChild)
+		child := newPrerouteStubConn("child-9")
+		core.SetConnRole(child, core.RoleChild)
+		core.SetConnNodeID(child, 9)
+		parent := newPrerouteStubConn("parent")
+		core.SetConnRole(parent, core.RoleParent)
+		for _, c := range []core.IConnection{ingress, child, parent} {
+			if err := cm.Add(c); err != nil {
+				t.Fatalf("Add(%s): %v", c.ID(), err)
+			}
+		}
+		cm.UpdateNodeIndex(9, child)
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(sub).
+			WithSourceID(11).WithTargetID(target).WithMsgID(1).WithHopLimit(4)
+		res := result{local: proc.PreRoute(ctx, ingress, hdr, nil)}
+		for _, s := range srv.sends {
+			res.sends = append(res.sends, s.connID)
+		}
+		return res
+	}
+	check := func(t *testing.T, name string, got result, local bool, sends ...string) {
+		t.Helper()
+		if got.local != local || !slices.Equal(got.sends, sends) {
+			t.Fatalf("%s: local=%v sends=%v, want local=%v sends=%v", name, got.local, got.sends, local, sends)
+		}
+	}
+
+	t.Run("forward ignores disabled forwarding", func(t *testing.T) {
+		proc := NewPreRoutingProcess(nil).WithForwardMode(false).WithSubProtoPolicy(5, SubProtoPolicyForward)
+		check(t, "to child", run(t, proc, 5, 9), false, "child-9")
+		check(t, "to parent", run(t, proc, 5, 88), false, "parent")
+		check(t, "broadcast", run(t, proc, 5, 0), false, "child-9")
+		check(t, "unlisted", run(t, proc, 6, 9), false)
+	})
+	t.Run("local_only keeps frames on this hub", func(t *testing.T) {
+		proc := NewPreRoutingProcess(nil).WithSubProtoPolicy(7, SubProtoPolicyLocalOnly)
+		check(t, "to child", run(t, proc, 7, 9), false)
+		check(t, "to parent", run(t, proc, 7, 88), false)
+		check(t, "broadcast", run(t, proc, 7, 0), true)
+		check(t, "to local", run(t, proc, 7, 7), true)
+		check(t, "unlisted", run(t, proc, 6, 9), false, "child-9")
+	})
+	t.Run("no_broadcast drops broadcasts only", func(t *testing.T) {
+		proc := NewPreRoutingProcess(nil).WithSubProtoPolicy(9, SubProtoPolicyNoBroadcast)
+		check(t, "broadcast", run(t, proc, 9, 0), false)
+		check(t, "to child", run(t, proc, 9, 9), false, "child-9")
+		check(t, "unlisted broadcast", run(t, proc, 6, 0), false, "child-9")
+	})
+	t.Run("default restores global behavior", func(t *testing.T) {
+		proc := NewPreRoutingProcess(nil).WithSubProtoPolicy(7, SubProtoPolicyLocalOnly).WithSubProtoPolicy(7, SubProtoPolicyDefault)
+		check(t, "to child", run(t, proc, 7, 9), false, "child-9")
+	})
+	t.Run("config", func(t *testing.T) {
+		cfg := config.NewMap(map[string]string{
+			config.KeyRoutingSubProtoPolicy: " 5:forward; 7:LOCAL_ONLY;9:no_broadcast;bad;300:forward;4:nope",
+		})
+		proc := NewPreRoutingProcess(nil).WithConfig(cfg)
+		want := map[uint8]SubProtoPolicy{5: SubProtoPolicyForward, 7: SubProtoPolicyLocalOnly, 9: SubProtoPolicyNoBroadcast}
+		for sub := 0; sub < 256; sub++ {
+			if got := proc.SubProtoPolicy(uint8(sub)); got != want[uint8(sub)] {
+				t.Fatalf("SubProtoPolicy(%d)=%s, want %s", sub, got, want[uint8(sub)])
+			}
+		}
+	})
+}
+
+func TestDispatcherAppliesSubProtoPolicies(t *testing.T) {
+	cfg := config.NewMap(map[string]string{
+		config.KeyRoutingForwardRemote:  "false",
+		config.KeyRoutingSubProtoPolicy: "5:forward;7:local_only;9:no_broadcast",
+	})
+	p, err := NewDispatcher(DispatchOptions{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Base:   NewPreRoutingProcess(slog.New(slog.NewTextHandler(io.Discard, nil))).WithConfig(cfg),
+	})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	local := &countingSubProcess{}
+	p.RegisterDefaultHandler(local)
+
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+	ingress := newPrerouteStubConn("child-11")
+	core.SetConnRole(ingress, core.RoleChild)
+	child := newPrerouteStubConn("child-9")
+	core.SetConnRole(child, core.RoleChild)
+	core.SetConnNodeID(child, 9)
+	for _, c := range []core.IConnection{ingress, child} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	cm.UpdateNodeIndex(9, child)
+
+	for _, tc := range []struct {
+		name      string
+		sub       uint8
+		target    uint32
+		wantLocal int
+		wantSends int
+	}{
+		{name: "forward to child despite forward_remote=false", sub: 5, target: 9, wantSends: 1},
+		{name: "unlisted follows forward_remote", sub: 6, target: 9},
+		{name: "local_only remote target dropped", sub: 7, target: 9},
+		{name: "local_only broadcast handled locally", sub: 7, target: 0, wantLocal: 1},
+		{name: "no_broadcast dropped", sub: 9, target: 0},
+	} {
+		local.calls, srv.sends = 0, nil
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(tc.sub).
+			WithSourceID(11).WithTargetID(tc.target).WithMsgID(uint32(tc.sub)).WithHopLimit(4)
+		p.route(dispatchEvent{ctx: ctx, conn: ingress, hdr: hdr})
+		if local.calls != tc.wantLocal || len(srv.sends) != tc.wantSends {
+			t.Fatalf("%s: local calls=%d sends=%d, want %d/%d", tc.name, local.calls, len(srv.sends), tc.wantLocal, tc.wantSends)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package process
+
+// 本文件承载 Core 框架中与 `priority` 相关的通用逻辑。
+
+import (
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// priorityLanes 为单个队列按帧优先级拆出的一组通道，下标即优先级（0..3）。
+// 消费方总是先取高优先级通道；同一优先级内保持 FIFO，不同优先级之间允许高优先级插队。
+type priorityLanes[T any] struct {
+	lanes [header.PriorityLevels]chan T
+}
+
+// newPriorityLanes 为每个优先级各分配一条容量为 buffer 的通道。
+func newPriorityLanes[T any](buffer int) *priorityLanes[T] {
+	if buffer < 0 {
+		buffer = 0
+	}
+	l := &priorityLanes[T]{}
+	for i := range l.lanes {
+		l.lanes[i] = make(chan T, buffer)
+	}
+	return l
+}
+
+// lane 返回优先级对应的通道，超出范围按低两位截断。
+func (l *priorityLanes[T]) lane(prio uint8) chan T {
+	return l.lanes[prio&header.RoutePriorityMask]
+}
+
+// capacity 返回单条优先级通道的容量。
+func (l *priorityLanes[T]) capacity() int { return cap(l.lanes[0]) }
+
+// queued 返回各优先级通道中排队元素的总数，并发入队/出队时为近似值。
+func (l *priorityLanes[T]) queued() int {
+	n := 0
+	for _, ch := range l.lanes {
+		n += len(ch)
+	}
+	return n
+}
+
+// tryPush 非阻塞入队，通道已满时返回 false。
+func (l *priorityLanes[T]) tryPush(prio uint8, v T) bool {
+	select {
+	case l.lane(prio) <- v:
+		return true
+	default:
+		return false
+	}
+}
+
+// push 阻塞入队，直到成功、done 关闭或超时（timeout<=0 表示不限时），超时按 clock 计时。
+func (l *priorityLanes[T]) push(prio uint8, v T, done <-chan struct{}, timeout time.Duration, clock Clock) error {
+	ch := l.lane(prio)
+	if timeout <= 0 {
+		select {
+		case ch <- v:
+			return nil
+		case <-done:
+			return errDispatcherClosed
+		}
+	}
+	timer := clock.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case ch <- v:
+		return nil
+	case <-timer.C():
+		return errEnqueueTimeout
+	case <-done:
+		return errDispatcherClosed
+	}
+}
+
+// poll 非阻塞地按优先级从高到低取出一个元素。
+func (l *priorityLanes[T]) poll() (T, bool) {
+	for i := len(l.lanes) - 1; i >= 0; i-- {
+		select {
+		case v := <-l.lanes[i]:
+			return v, true
+		default:
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// next 取出下一个待处理元素：优先返回已排队的最高优先级元素，否则阻塞等待任一通道。
+// done 关闭后不再阻塞，只返回剩余元素，全部取完时 ok=false。
+func (l *priorityLanes[T]) next(done <-chan struct{}) (T, bool) {
+	if v, ok := l.poll(); ok {
+		return v, true
+	}
+	var v T
+	select {
+	case v = <-l.lanes[3]:
+	case v = <-l.lanes[2]:
+	case v = <-l.lanes[1]:
+	case v = <-l.lanes[0]:
+	case <-done:
+		return l.poll()
+	}
+	// 被唤醒时直接返回该元素；若同时有更高优先级到达，下一轮 next 会先取到它。
+	return v, true
+}
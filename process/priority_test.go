@@ -0,0 +1,188 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `priority` 相关的行为。
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// interleaved 为两条路径共用的乱序输入：msgID -> priority，期望按优先级降序、同级按入队顺序消费。
+var interleaved = []struct {
+	msgID uint32
+	prio  uint8
+}{
+	{1, header.PriorityNormal},
+	{2, header.PriorityUrgent},
+	{3, header.PriorityElevated},
+	{4, header.PriorityUrgent},
+	{5, header.PriorityHigh},
+	{6, header.PriorityNormal},
+}
+
+var interleavedWant = []uint32{2, 4, 5, 3, 1, 6}
+
+func priorityHeader(msgID uint32, prio uint8) core.IHeader {
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(msgID)
+	return h.(*header.HeaderTcp).WithPriority(prio)
+}
+
+// orderSubProcess 记录处理顺序；msgID 为 0 的帧会阻塞到 gate 关闭，用来堆积后续事件。
+type orderSubProcess struct {
+	gate    chan struct{}
+	started chan struct{}
+	mu      sync.Mutex
+	order   []uint32
+	seen    chan struct{}
+}
+
+func (s *orderSubProcess) SubProto() uint8           { return 1 }
+func (s *orderSubProcess) Init() bool                { return true }
+func (s *orderSubProcess) AcceptCmd() bool           { return false }
+func (s *orderSubProcess) AllowSourceMismatch() bool { return true }
+func (s *orderSubProcess) OnReceive(_ context.Context, _ core.IConnection, hdr core.IHeader, _ []byte) {
+	if hdr.GetMsgID() == 0 {
+		close(s.started)
+		<-s.gate
+		return
+	}
+	s.mu.Lock()
+	s.order = append(s.order, hdr.GetMsgID())
+	s.mu.Unlock()
+	s.seen <- struct{}{}
+}
+
+func TestDispatcherProcessDrainsHigherPriorityFirst(t *testing.T) {
+	p, err := NewDispatcher(DispatchOptions{ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 8})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	defer p.Shutdown()
+	sub := &orderSubProcess{gate: make(chan struct{}), started: make(chan struct{}), seen: make(chan struct{}, len(interleaved))}
+	if err := p.RegisterHandler(sub); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	conn := newPrerouteStubConn("c1")
+	ctx := context.Background()
+
+	p.OnReceive(ctx, conn, priorityHeader(0, header.PriorityNormal), nil)
+	<-sub.started
+	for _, in := range interleaved {
+		p.OnReceive(ctx, conn, priorityHeader(in.msgID, in.prio), nil)
+	}
+	close(sub.gate)
+	for range interleaved {
+		select {
+		case <-sub.seen:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for events, got %v", sub.order)
+		}
+	}
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if !slices.Equal(sub.order, interleavedWant) {
+		t.Fatalf("process order=%v, want %v", sub.order, interleavedWant)
+	}
+}
+
+// gatedPipe 的首次写入阻塞到 gate 关闭，其余写入直接记录。
+type gatedPipe struct {
+	gate    chan struct{}
+	entered chan struct{}
+	once    sync.Once
+	mu      sync.Mutex
+	buf     bytes.Buffer
+}
+
+func (p *gatedPipe) Read([]byte) (int, error) { return 0, errors.New("not readable") }
+func (p *gatedPipe) Write(b []byte) (int, error) {
+	p.once.Do(func() {
+		close(p.entered)
+		<-p.gate
+	})
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.buf.Write(b)
+}
+func (p *gatedPipe) Close() error { return nil }
+
+type gatedSendConn struct {
+	*prerouteStubConn
+	pipe *gatedPipe
+}
+
+func (c *gatedSendConn) Pipe() core.IPipe { return c.pipe }
+
+func TestSendDispatcherWritesHigherPriorityFirst(t *testing.T) {
+	d, err := NewSendDispatcher(SendOptions{ChannelCount: 1, ChannelBuffer: 8, ConnBuffer: 8, EnqueueTimeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	pipe := &gatedPipe{gate: make(chan struct{}), entered: make(chan struct{})}
+	conn := &gatedSendConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: pipe}
+	codec := header.HeaderTcpCodec{}
+
+	var wg sync.WaitGroup
+	send := func(msgID uint32, prio uint8) {
+		wg.Add(1)
+		if err := d.Dispatch(context.Background(), conn, priorityHeader(msgID, prio), nil, codec, func(error) { wg.Done() }); err != nil {
+			t.Fatalf("Dispatch(%d): %v", msgID, err)
+		}
+	}
+	send(0, header.PriorityNormal)
+	<-pipe.entered
+	for _, in := range interleaved {
+		send(in.msgID, in.prio)
+	}
+	waitWriterQueued(t, d, conn.ID(), len(interleaved))
+	close(pipe.gate)
+	wg.Wait()
+
+	pipe.mu.Lock()
+	r := bytes.NewReader(pipe.buf.Bytes())
+	pipe.mu.Unlock()
+	var got []uint32
+	for r.Len() > 0 {
+		hdr, _, err := codec.Decode(r)
+		if err != nil {
+			t.Fatalf("decode written frame: %v", err)
+		}
+		if hdr.GetMsgID() != 0 {
+			got = append(got, hdr.GetMsgID())
+		}
+	}
+	if !slices.Equal(got, interleavedWant) {
+		t.Fatalf("send order=%v, want %v", got, interleavedWant)
+	}
+}
+
+// waitWriterQueued 等待分片队列把任务全部转交给连接 writer，确保排序发生在 writer 内。
+func waitWriterQueued(t *testing.T, d *SendDispatcher, connID string, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		d.mu.RLock()
+		w := d.writers[connID]
+		d.mu.RUnlock()
+		queued := 0
+		if w != nil {
+			for _, ch := range w.lanes.lanes {
+				queued += len(ch)
+			}
+		}
+		if queued == n {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("writer did not receive %d queued tasks", n)
+}
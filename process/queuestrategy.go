@@ -87,10 +87,17 @@ func (SourceTargetStrategy) SelectQueue(_ core.IConnection, hdr core.IHeader, n
 }
 
 // RoundRobinStrategy 简单轮询（不保证顺序性）。
+// 计数器随实例保存，方法均为指针接收者，只有 *RoundRobinStrategy 满足 QueueSelectStrategy；
+// 应通过 NewRoundRobinStrategy 创建并共享同一指针，按值复制会得到各自独立的计数。
 type RoundRobinStrategy struct{ counter uint64 }
 
+var _ QueueSelectStrategy = (*RoundRobinStrategy)(nil)
+
+// NewRoundRobinStrategy 创建从队列 0 开始轮询的策略。
+func NewRoundRobinStrategy() *RoundRobinStrategy { return &RoundRobinStrategy{} }
+
 // Name 返回该策略在配置中的名字。
-func (RoundRobinStrategy) Name() string { return "roundrobin" }
+func (r *RoundRobinStrategy) Name() string { return "roundrobin" }
 
 // SelectQueue 用原子计数轮询分配队列，换取更平均的负载，但不承诺同连接顺序。
 func (r *RoundRobinStrategy) SelectQueue(_ core.IConnection, _ core.IHeader, n int) int {
@@ -103,6 +110,43 @@ func (r *RoundRobinStrategy) SelectQueue(_ core.IConnection, _ core.IHeader, n i
 // nextCounter 原子自增计数。
 func nextCounter(c *uint64) uint64 { return atomic.AddUint64(c, 1) - 1 }
 
+// SizeAwareStrategy 把 payload 不小于 Threshold 的大帧分流到专用的最后一个队列，
+// 其余小帧由 Inner 在前 n-1 个队列中选择，避免大帧的慢处理阻塞同分片上的小控制帧。
+// 大小帧走不同队列后，同一连接的大帧与小帧之间不再保证顺序；队列数 <2 或 Threshold 为 0 时退化为 Inner。
+type SizeAwareStrategy struct {
+	Threshold uint32
+	Inner     QueueSelectStrategy // nil 时使用 ConnHashStrategy
+}
+
+// NewSizeAwareStrategy 以 inner 为小帧策略创建按帧大小分流的策略。
+func NewSizeAwareStrategy(threshold uint32, inner QueueSelectStrategy) *SizeAwareStrategy {
+	if inner == nil {
+		inner = ConnHashStrategy{}
+	}
+	return &SizeAwareStrategy{Threshold: threshold, Inner: inner}
+}
+
+// Name 返回 "size+<inner>"，便于观测时区分是否启用了大帧分流。
+func (s *SizeAwareStrategy) Name() string { return "size+" + s.inner().Name() }
+
+// SelectQueue 大帧固定落到最后一个队列，小帧交给 Inner 在剩余队列中选择。
+func (s *SizeAwareStrategy) SelectQueue(conn core.IConnection, hdr core.IHeader, n int) int {
+	if n <= 1 || s.Threshold == 0 {
+		return s.inner().SelectQueue(conn, hdr, n)
+	}
+	if hdr != nil && hdr.PayloadLength() >= s.Threshold {
+		return n - 1
+	}
+	return s.inner().SelectQueue(conn, hdr, n-1)
+}
+
+func (s *SizeAwareStrategy) inner() QueueSelectStrategy {
+	if s.Inner == nil {
+		return ConnHashStrategy{}
+	}
+	return s.Inner
+}
+
 // StrategyFromConfig 根据配置字符串创建策略实例；未知值返回默认 ConnHashStrategy。
 func StrategyFromConfig(raw string) QueueSelectStrategy {
 	s := strings.ToLower(strings.TrimSpace(raw))
@@ -112,7 +156,7 @@ func StrategyFromConfig(raw string) QueueSelectStrategy {
 	case "source_target":
 		return SourceTargetStrategy{}
 	case "roundrobin":
-		return &RoundRobinStrategy{}
+		return NewRoundRobinStrategy()
 	default:
 		return ConnHashStrategy{}
 	}
@@ -0,0 +1,155 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `queuestrategy` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func sizedHeader(msgID, size uint32) core.IHeader {
+	return (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(msgID).WithPayloadLength(size)
+}
+
+func TestSizeAwareStrategyReservesLastQueueForLargeFrames(t *testing.T) {
+	s := NewSizeAwareStrategy(1024, NewRoundRobinStrategy())
+	conn := newPrerouteStubConn("c1")
+	for i := 0; i < 8; i++ {
+		if got := s.SelectQueue(conn, sizedHeader(1, 100), 4); got < 0 || got > 2 {
+			t.Fatalf("small frame -> queue %d, want [0,3)", got)
+		}
+		if got := s.SelectQueue(conn, sizedHeader(1, 1024), 4); got != 3 {
+			t.Fatalf("large frame -> queue %d, want 3", got)
+		}
+	}
+	if got := s.SelectQueue(conn, sizedHeader(1, 4096), 1); got != 0 {
+		t.Fatalf("single queue -> %d, want 0", got)
+	}
+	if s.Name() != "size+roundrobin" {
+		t.Fatalf("Name()=%q", s.Name())
+	}
+}
+
+func TestRoundRobinStrategyCyclesQueues(t *testing.T) {
+	s := NewRoundRobinStrategy()
+	for i := 0; i < 9; i++ {
+		if got := s.SelectQueue(nil, nil, 3); got != i%3 {
+			t.Fatalf("call %d -> queue %d, want %d", i, got, i%3)
+		}
+	}
+	if got := s.SelectQueue(nil, nil, 1); got != 0 {
+		t.Fatalf("single queue -> %d, want 0", got)
+	}
+	if got, ok := StrategyFromConfig("roundrobin").(*RoundRobinStrategy); !ok || got.Name() != "roundrobin" {
+		t.Fatalf("StrategyFromConfig(roundrobin)=%T", StrategyFromConfig("roundrobin"))
+	}
+}
+
+func TestRoundRobinStrategyConcurrentSelectSpreadsEvenly(t *testing.T) {
+	const (
+		queues     = 4
+		goroutines = 8
+		perG       = 1000
+	)
+	s := NewRoundRobinStrategy()
+	var (
+		wg     sync.WaitGroup
+		counts [queues]atomic.Int64
+	)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				q := s.SelectQueue(nil, nil, queues)
+				if q < 0 || q >= queues {
+					t.Errorf("queue %d out of range", q)
+					return
+				}
+				counts[q].Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	// 计数器原子自增，总调用数是队列数的整数倍时每个队列恰好分到相同份额。
+	for q := range counts {
+		if got := counts[q].Load(); got != goroutines*perG/queues {
+			t.Fatalf("queue %d got %d selections, want %d", q, got, goroutines*perG/queues)
+		}
+	}
+}
+
+// sizeSubProcess 处理大帧时阻塞到 gate 关闭，模拟大 payload 的慢处理；小帧处理后上报 msgID。
+type sizeSubProcess struct {
+	gate  chan struct{}
+	small chan uint32
+}
+
+func (s *sizeSubProcess) SubProto() uint8           { return 1 }
+func (s *sizeSubProcess) Init() bool                { return true }
+func (s *sizeSubProcess) AcceptCmd() bool           { return false }
+func (s *sizeSubProcess) AllowSourceMismatch() bool { return true }
+func (s *sizeSubProcess) OnReceive(_ context.Context, _ core.IConnection, hdr core.IHeader, _ []byte) {
+	if hdr.PayloadLength() >= 1024 {
+		<-s.gate
+		return
+	}
+	s.small <- hdr.GetMsgID()
+}
+
+func TestDispatcherSizeAwareSmallFramesNotBlockedByLarge(t *testing.T) {
+	run := func(strategy QueueSelectStrategy) (handled int) {
+		p, err := NewDispatcher(DispatchOptions{
+			Logger:         slog.New(slog.NewTextHandler(io.Discard, nil)),
+			ChannelCount:   2,
+			WorkersPerChan: 1,
+			ChannelBuffer:  16,
+			Strategy:       strategy,
+		})
+		if err != nil {
+			t.Fatalf("NewDispatcher: %v", err)
+		}
+		sub := &sizeSubProcess{gate: make(chan struct{}), small: make(chan uint32, 16)}
+		defer p.Shutdown()
+		defer close(sub.gate)
+		if err := p.RegisterHandler(sub); err != nil {
+			t.Fatalf("RegisterHandler: %v", err)
+		}
+		conn := newPrerouteStubConn("c1")
+		for i := uint32(1); i <= 6; i++ {
+			size := uint32(16)
+			if i%2 == 1 {
+				size = 4096
+			}
+			p.OnReceive(context.Background(), conn, sizedHeader(i, size), nil)
+		}
+		timeout := time.After(200 * time.Millisecond)
+		for {
+			select {
+			case <-sub.small:
+				handled++
+				if handled == 3 {
+					return handled
+				}
+			case <-timeout:
+				return handled
+			}
+		}
+	}
+
+	// 同一连接在连接哈希下共用一个队列，小帧排在阻塞的大帧之后。
+	if got := run(ConnHashStrategy{}); got != 0 {
+		t.Fatalf("conn strategy handled %d small frames behind a stuck large frame, want 0", got)
+	}
+	if got := run(NewSizeAwareStrategy(1024, ConnHashStrategy{})); got != 3 {
+		t.Fatalf("size-aware strategy handled %d/3 small frames while large frames are stuck", got)
+	}
+}
@@ -0,0 +1,174 @@
+package process
+
+// 本文件承载 Core 框架中与 `routecache` 相关的通用逻辑。
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+const (
+	// DefaultRouteCacheSize 路由决策缓存默认记住的目标数。
+	DefaultRouteCacheSize = 1024
+	// DefaultRouteCacheNegativeTTL 不可达记录的默认有效期。
+	DefaultRouteCacheNegativeTTL = time.Second
+)
+
+// RouteCacheStats 是路由决策缓存的累计计数。
+type RouteCacheStats struct {
+	Hits         uint64 `json:"hits"`          // 命中缓存的父链路回落
+	Misses       uint64 `json:"misses"`        // 未命中（或记录已失效）而完整查表
+	NegativeHits uint64 `json:"negative_hits"` // 命中不可达记录而直接丢弃
+	Evictions    uint64 `json:"evictions"`     // 超出容量被淘汰的记录
+	Size         int    `json:"size"`          // 当前记录数
+}
+
+// routeCache 是有容量上限的 LRU，缓存精确索引未命中后的慢路径结果：
+// 正向记录为 target→父连接 ID，连接关闭、路由表变更或连接不再是活动父链路时失效；
+// 负向记录表示 target 不可达，ttl 内直接丢弃，避免对已失联节点的帧洪泛反复扫描连接表，路由表变更时同样失效。
+type routeCache struct {
+	mu     sync.Mutex
+	size   int
+	negTTL time.Duration
+	order  *list.List // 前端最新
+	items  map[uint32]*list.Element
+	now    func() time.Time // 测试可替换
+
+	hits, misses, negHits, evictions atomic.Uint64
+}
+
+type routeCacheEntry struct {
+	target  uint32
+	connID  string // 为空表示不可达
+	version uint64 // 写入时的路由表版本
+	at      time.Time
+}
+
+// newRouteCache 创建路由决策缓存；size<=0 时返回 nil，表示关闭缓存；negTTL<=0 表示不记录不可达结果。
+func newRouteCache(size int, negTTL time.Duration) *routeCache {
+	if size <= 0 {
+		return nil
+	}
+	return &routeCache{size: size, negTTL: negTTL, order: list.New(), items: make(map[uint32]*list.Element, size), now: time.Now}
+}
+
+// get 返回 target 的缓存结果：cached 为 false 表示需要完整查表；cached 为 true 且 ok 为 false 表示不可达。
+func (c *routeCache) get(cm core.IConnectionManager, target uint32, version uint64) (hop NextHop, ok, cached bool) {
+	c.mu.Lock()
+	el, found := c.items[target]
+	var e routeCacheEntry
+	if found {
+		e = *el.Value.(*routeCacheEntry)
+		c.order.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !found {
+		c.misses.Add(1)
+		return NextHop{}, false, false
+	}
+	if e.version != version {
+		c.remove(target)
+		c.misses.Add(1)
+		return NextHop{}, false, false
+	}
+	if e.connID == "" {
+		if c.now().Sub(e.at) >= c.negTTL {
+			c.remove(target)
+			c.misses.Add(1)
+			return NextHop{}, false, false
+		}
+		c.negHits.Add(1)
+		return NextHop{}, false, true
+	}
+	if conn, ok := cm.Get(e.connID); ok && conn != nil && isParentConn(conn) && !isStandbyParent(conn) {
+		c.hits.Add(1)
+		return NextHop{Conn: conn, Kind: RouteParent}, true, true
+	}
+	c.remove(target)
+	c.misses.Add(1)
+	return NextHop{}, false, false
+}
+
+// put 记录一次慢路径结果；只缓存回落到活动父链路与不可达两种结果，直连与子树路由本身已足够快。
+func (c *routeCache) put(target uint32, hop NextHop, ok bool, version uint64) {
+	e := routeCacheEntry{target: target, version: version, at: c.now()}
+	switch {
+	case !ok && c.negTTL > 0:
+	case ok && hop.Kind == RouteParent && !isStandbyParent(hop.Conn):
+		e.connID = hop.Conn.ID()
+	default:
+		return
+	}
+	c.store(e)
+}
+
+// markUnreachable 写入 target 的不可达记录，version 为当前路由表版本；负向 ttl<=0 时不记录。
+func (c *routeCache) markUnreachable(target uint32, version uint64) {
+	if c.negTTL <= 0 {
+		return
+	}
+	c.store(routeCacheEntry{target: target, version: version, at: c.now()})
+}
+
+func (c *routeCache) store(e routeCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[e.target]; ok {
+		*el.Value.(*routeCacheEntry) = e
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[e.target] = c.order.PushFront(&e)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*routeCacheEntry).target)
+		c.evictions.Add(1)
+	}
+}
+
+func (c *routeCache) remove(target uint32) {
+	c.mu.Lock()
+	if el, ok := c.items[target]; ok {
+		c.order.Remove(el)
+		delete(c.items, target)
+	}
+	c.mu.Unlock()
+}
+
+// removeConn 删除经由 connID 的全部正向记录，通常在连接关闭时调用。
+func (c *routeCache) removeConn(connID string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.order.Front(); el != nil; {
+		next := el.Next()
+		if e := el.Value.(*routeCacheEntry); e.connID == connID {
+			c.order.Remove(el)
+			delete(c.items, e.target)
+		}
+		el = next
+	}
+}
+
+func (c *routeCache) stats() RouteCacheStats {
+	if c == nil {
+		return RouteCacheStats{}
+	}
+	c.mu.Lock()
+	n := c.order.Len()
+	c.mu.Unlock()
+	return RouteCacheStats{
+		Hits:         c.hits.Load(),
+		Misses:       c.misses.Load(),
+		NegativeHits: c.negHits.Load(),
+		Evictions:    c.evictions.Load(),
+		Size:         n,
+	}
+}
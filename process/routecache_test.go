@@ -0,0 +1,226 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `routecache` 相关的行为。
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// routeCacheHub 搭建节点 7：一个子连接（节点 11，作为来源）和可选的父连接。
+type routeCacheHub struct {
+	proc    *PreRoutingProcess
+	cm      *connmgr.Manager
+	srv     *prerouteStubServer
+	ctx     context.Context
+	ingress *prerouteStubConn
+	clock   *fakeClock
+}
+
+func newRouteCacheHub(t testing.TB, withParent bool) *routeCacheHub {
+	t.Helper()
+	h := &routeCacheHub{
+		proc:  NewPreRoutingProcess(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		cm:    connmgr.New(),
+		clock: newFakeClock(),
+	}
+	h.proc.routeCache.now = h.clock.Now
+	h.srv = newPrerouteStubServer(7, h.cm)
+	h.ctx = core.WithServerContext(context.Background(), h.srv)
+	h.ingress = newPrerouteStubConn("child-11")
+	core.SetConnRole(h.ingress, core.RoleChild)
+	h.add(t, h.ingress)
+	if withParent {
+		h.addParent(t, "parent")
+	}
+	return h
+}
+
+func (h *routeCacheHub) add(t testing.TB, c core.IConnection) {
+	t.Helper()
+	if err := h.cm.Add(c); err != nil {
+		t.Fatalf("Add(%s): %v", c.ID(), err)
+	}
+}
+
+func (h *routeCacheHub) addParent(t testing.TB, id string) *prerouteStubConn {
+	t.Helper()
+	parent := newPrerouteStubConn(id)
+	core.SetConnRole(parent, core.RoleParent)
+	h.add(t, parent)
+	return parent
+}
+
+// send 把一帧发往 target 的消息交给 PreRoute，返回实际发往的连接 ID（未发出时为空）。
+func (h *routeCacheHub) send(target uint32) string {
+	before := len(h.srv.sends)
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).
+		WithSourceID(11).WithTargetID(target).WithHopLimit(8)
+	h.proc.PreRoute(h.ctx, h.ingress, hdr, nil)
+	if len(h.srv.sends) == before {
+		return ""
+	}
+	return h.srv.sends[len(h.srv.sends)-1].connID
+}
+
+func TestRouteCacheReusesParentFallback(t *testing.T) {
+	h := newRouteCacheHub(t, true)
+	for i := 0; i < 3; i++ {
+		if got := h.send(99); got != "parent" {
+			t.Fatalf("frame %d sent to %q, want parent", i, got)
+		}
+	}
+	if st := h.proc.RouteCacheStats(); st.Misses != 1 || st.Hits != 2 || st.Size != 1 {
+		t.Fatalf("stats=%+v, want 1 miss / 2 hits / size 1", st)
+	}
+
+	// 目标作为直连子节点上线后立即改走直连，不受缓存的父链路决策影响。
+	child := newPrerouteStubConn("child-99")
+	core.SetConnRole(child, core.RoleChild)
+	core.SetConnNodeID(child, 99)
+	h.add(t, child)
+	h.cm.UpdateNodeIndex(99, child)
+	if got := h.send(99); got != "child-99" {
+		t.Fatalf("after child login sent to %q, want child-99", got)
+	}
+}
+
+func TestRouteCacheInvalidatedByCloseAndRouteChanges(t *testing.T) {
+	h := newRouteCacheHub(t, true)
+	if got := h.send(99); got != "parent" {
+		t.Fatalf("sent to %q, want parent", got)
+	}
+
+	// 父连接关闭：OnClose 清掉经由它的记录，新的父连接随即生效。
+	parent, _ := h.cm.Get("parent")
+	_ = h.cm.Remove("parent")
+	h.proc.OnClose(parent)
+	if st := h.proc.RouteCacheStats(); st.Size != 0 {
+		t.Fatalf("cache size %d after parent closed, want 0", st.Size)
+	}
+	h.addParent(t, "parent-2")
+	if got := h.send(99); got != "parent-2" {
+		t.Fatalf("after failover sent to %q, want parent-2", got)
+	}
+
+	// 登记覆盖目标的汇总路由后，缓存的父链路决策因路由表版本变化而失效。
+	via := newPrerouteStubConn("child-sub")
+	core.SetConnRole(via, core.RoleChild)
+	h.add(t, via)
+	if err := h.proc.RoutingTable().AddSubtree(96, 30, via.ID()); err != nil {
+		t.Fatalf("AddSubtree: %v", err)
+	}
+	if got := h.send(99); got != "child-sub" {
+		t.Fatalf("after subtree route sent to %q, want child-sub", got)
+	}
+}
+
+func TestRouteCacheNegativeEntriesExpire(t *testing.T) {
+	h := newRouteCacheHub(t, false)
+	h.proc.WithRouteCache(8, 500*time.Millisecond)
+	h.proc.routeCache.now = h.clock.Now
+
+	for i := 0; i < 3; i++ {
+		if got := h.send(99); got != "" {
+			t.Fatalf("frame %d sent to %q without any route", i, got)
+		}
+	}
+	if st := h.proc.RouteCacheStats(); st.Misses != 1 || st.NegativeHits != 2 {
+		t.Fatalf("stats=%+v, want 1 miss / 2 negative hits", st)
+	}
+
+	// 父链路恢复后，不可达记录在有效期内仍生效，过期后重新查表。
+	h.addParent(t, "parent")
+	if got := h.send(99); got != "" {
+		t.Fatalf("within ttl sent to %q, want dropped", got)
+	}
+	h.clock.Advance(500 * time.Millisecond)
+	if got := h.send(99); got != "parent" {
+		t.Fatalf("after ttl sent to %q, want parent", got)
+	}
+
+	// MarkUnreachable 可由上游的不可达回包驱动，即使存在父链路也立即止住转发。
+	h.proc.MarkUnreachable(99)
+	if got := h.send(99); got != "" {
+		t.Fatalf("after MarkUnreachable sent to %q, want dropped", got)
+	}
+
+	// 有效期内登记覆盖目标的汇总路由，不可达记录随路由表版本变化立即失效。
+	via := newPrerouteStubConn("child-sub")
+	core.SetConnRole(via, core.RoleChild)
+	h.add(t, via)
+	if err := h.proc.RoutingTable().AddSubtree(96, 30, via.ID()); err != nil {
+		t.Fatalf("AddSubtree: %v", err)
+	}
+	if got := h.send(99); got != "child-sub" {
+		t.Fatalf("after subtree route sent to %q, want child-sub", got)
+	}
+}
+
+func TestRouteCacheBoundedLRU(t *testing.T) {
+	h := newRouteCacheHub(t, true)
+	h.proc.WithRouteCache(2, time.Second)
+	for _, target := range []uint32{91, 92, 91, 93} {
+		h.send(target)
+	}
+	st := h.proc.RouteCacheStats()
+	if st.Size != 2 || st.Evictions != 1 {
+		t.Fatalf("stats=%+v, want size 2 / 1 eviction", st)
+	}
+	// 92 最久未用被淘汰，91 因中途被访问而保留。
+	h.send(91)
+	h.send(92)
+	if got := h.proc.RouteCacheStats(); got.Hits != st.Hits+1 || got.Misses != st.Misses+1 {
+		t.Fatalf("stats=%+v after 91/92, want one more hit and one more miss than %+v", got, st)
+	}
+
+	h.proc.WithRouteCache(0, time.Second)
+	if h.send(91) != "parent" || h.proc.RouteCacheStats() != (RouteCacheStats{}) {
+		t.Fatalf("disabled cache stats=%+v", h.proc.RouteCacheStats())
+	}
+}
+
+// benchmarkUnknownTarget 向同一个本地未知的目标持续转发，连接表中有 children 个无关子连接，
+// 每帧未命中精确索引后都需扫描子树路由并在全部连接中查找父链路。
+func benchmarkUnknownTarget(b *testing.B, cacheSize int, withParent bool) {
+	h := newRouteCacheHub(b, withParent)
+	h.proc.WithRouteCache(cacheSize, time.Minute)
+	for i := 0; i < 256; i++ {
+		c := newPrerouteStubConn(fmt.Sprintf("child-%d", 1000+i))
+		core.SetConnRole(c, core.RoleChild)
+		core.SetConnNodeID(c, uint32(1000+i))
+		h.add(b, c)
+	}
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).
+		WithSourceID(11).WithTargetID(99).WithHopLimit(8)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.proc.PreRoute(h.ctx, h.ingress, hdr, nil)
+		h.srv.sends = h.srv.sends[:0]
+	}
+}
+
+// BenchmarkPreRouteUnknownTargetParentUncached 为基线：每帧完整查表后回落到父链路。
+func BenchmarkPreRouteUnknownTargetParentUncached(b *testing.B) { benchmarkUnknownTarget(b, 0, true) }
+
+// BenchmarkPreRouteUnknownTargetParentCached 复用缓存的父链路决策。
+func BenchmarkPreRouteUnknownTargetParentCached(b *testing.B) {
+	benchmarkUnknownTarget(b, DefaultRouteCacheSize, true)
+}
+
+// BenchmarkPreRouteDeadTargetUncached 为基线：没有父链路时每帧完整查表后丢弃。
+func BenchmarkPreRouteDeadTargetUncached(b *testing.B) { benchmarkUnknownTarget(b, 0, false) }
+
+// BenchmarkPreRouteDeadTargetCached 命中不可达记录直接丢弃。
+func BenchmarkPreRouteDeadTargetCached(b *testing.B) {
+	benchmarkUnknownTarget(b, DefaultRouteCacheSize, false)
+}
@@ -0,0 +1,182 @@
+package process
+
+// 本文件承载 Core 框架中与 `routing_table` 相关的通用逻辑。
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// RouteKind 表示下一跳来自路由表的哪一层。
+type RouteKind uint8
+
+const (
+	RouteNone    RouteKind = iota
+	RouteDirect            // 连接管理器的节点索引精确命中（直连子节点或已索引的后代）
+	RouteSubtree           // 子树汇总路由最长前缀命中
+	RouteParent            // 未命中，回落到默认父链路
+)
+
+// String 返回路由层级的稳定文本，便于日志输出。
+func (k RouteKind) String() string {
+	switch k {
+	case RouteDirect:
+		return "direct"
+	case RouteSubtree:
+		return "subtree"
+	case RouteParent:
+		return "parent"
+	default:
+		return "none"
+	}
+}
+
+// NextHop 是一次查表的结果。
+type NextHop struct {
+	Conn core.IConnection
+	Kind RouteKind
+}
+
+// subtreeRoute 表示一段 nodeID 前缀（高 bits 位与 base 相同）经由 connID 可达。
+type subtreeRoute struct {
+	base   uint32
+	bits   int
+	connID string
+}
+
+func (r subtreeRoute) match(target uint32) bool {
+	return target&prefixMask(r.bits) == r.base
+}
+
+func prefixMask(bits int) uint32 {
+	if bits <= 0 {
+		return 0
+	}
+	return ^uint32(0) << (32 - bits)
+}
+
+// RoutingTable 按目标 nodeID 选择下一跳：先查连接管理器的精确节点索引，再按最长前缀匹配子节点上报的
+// 子树汇总路由，最后回落到默认父链路。汇总路由只记录连接 ID，查表时再经管理器解析，已断开的连接自动失效。
+type RoutingTable struct {
+	mu       sync.RWMutex
+	subtrees []subtreeRoute // 按前缀长度降序，首个命中即最长匹配
+	version  atomic.Uint64  // 每次修改汇总路由递增，供缓存判断记录是否过期
+}
+
+// NewRoutingTable 创建空路由表。
+func NewRoutingTable() *RoutingTable {
+	return &RoutingTable{}
+}
+
+// AddSubtree 登记汇总路由：高 bits 位与 base 相同的 nodeID 经 connID 可达；同一前缀重复登记时覆盖。
+func (t *RoutingTable) AddSubtree(base uint32, bits int, connID string) error {
+	if bits < 1 || bits > 32 {
+		return fmt.Errorf("subtree prefix length %d out of range [1,32]", bits)
+	}
+	if connID == "" {
+		return errors.New("subtree route needs a connection id")
+	}
+	base &= prefixMask(bits)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version.Add(1)
+	for i, r := range t.subtrees {
+		if r.base == base && r.bits == bits {
+			t.subtrees[i].connID = connID
+			return nil
+		}
+	}
+	t.subtrees = append(t.subtrees, subtreeRoute{base: base, bits: bits, connID: connID})
+	sort.SliceStable(t.subtrees, func(i, j int) bool { return t.subtrees[i].bits > t.subtrees[j].bits })
+	return nil
+}
+
+// RemoveSubtree 删除指定前缀的汇总路由。
+func (t *RoutingTable) RemoveSubtree(base uint32, bits int) {
+	base &= prefixMask(bits)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version.Add(1)
+	t.subtrees = slices.DeleteFunc(t.subtrees, func(r subtreeRoute) bool { return r.base == base && r.bits == bits })
+}
+
+// RemoveConn 删除经由 connID 的全部汇总路由，通常在连接关闭时调用。
+func (t *RoutingTable) RemoveConn(connID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.version.Add(1)
+	t.subtrees = slices.DeleteFunc(t.subtrees, func(r subtreeRoute) bool { return r.connID == connID })
+}
+
+// Version 返回汇总路由的修改次数，nil 表视为 0。
+func (t *RoutingTable) Version() uint64 {
+	if t == nil {
+		return 0
+	}
+	return t.version.Load()
+}
+
+// Lookup 返回 target 的下一跳；精确索引、汇总路由与父链路都不可用时返回 false。
+func (t *RoutingTable) Lookup(cm core.IConnectionManager, target uint32) (NextHop, bool) {
+	if cm == nil {
+		return NextHop{}, false
+	}
+	if hop, ok := t.LookupLocal(cm, target); ok {
+		return hop, true
+	}
+	if parent, ok := findParentConn(cm); ok {
+		return NextHop{Conn: parent, Kind: RouteParent}, true
+	}
+	return NextHop{}, false
+}
+
+// LookupLocal 与 Lookup 相同，但不回落到父链路。
+func (t *RoutingTable) LookupLocal(cm core.IConnectionManager, target uint32) (NextHop, bool) {
+	if cm == nil {
+		return NextHop{}, false
+	}
+	if c, ok := cm.GetByNode(target); ok && c != nil {
+		return NextHop{Conn: c, Kind: RouteDirect}, true
+	}
+	if t == nil {
+		return NextHop{}, false
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, r := range t.subtrees {
+		if !r.match(target) {
+			continue
+		}
+		if c, ok := cm.Get(r.connID); ok && c != nil {
+			return NextHop{Conn: c, Kind: RouteSubtree}, true
+		}
+	}
+	return NextHop{}, false
+}
+
+// SubtreeRoute 是一条汇总路由的只读快照，供管理端展示。
+type SubtreeRoute struct {
+	Base   uint32 `json:"base"`
+	Bits   int    `json:"bits"`
+	ConnID string `json:"conn_id"`
+}
+
+// Subtrees 按匹配顺序（前缀长度降序）返回当前全部汇总路由的拷贝。
+func (t *RoutingTable) Subtrees() []SubtreeRoute {
+	if t == nil {
+		return nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]SubtreeRoute, len(t.subtrees))
+	for i, r := range t.subtrees {
+		out[i] = SubtreeRoute{Base: r.base, Bits: r.bits, ConnID: r.connID}
+	}
+	return out
+}
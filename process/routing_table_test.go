@@ -0,0 +1,103 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `routing_table` 相关的行为。
+
+import (
+	"context"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// newRoutingFixture 构造一个父连接、一个直连子节点 8 与一个子树 hub 连接。
+func newRoutingFixture(t *testing.T) (cm core.IConnectionManager, parent, child, hub core.IConnection) {
+	t.Helper()
+	cm = connmgr.New()
+	p := newPrerouteStubConn("parent")
+	core.SetConnRole(p, core.RoleParent)
+	c := newPrerouteStubConn("child-8")
+	core.SetConnRole(c, core.RoleChild)
+	h := newPrerouteStubConn("hub-b")
+	core.SetConnRole(h, core.RoleChild)
+	for _, conn := range []core.IConnection{p, c, h} {
+		if err := cm.Add(conn); err != nil {
+			t.Fatalf("Add(%s): %v", conn.ID(), err)
+		}
+	}
+	cm.UpdateNodeIndex(8, c)
+	return cm, p, c, h
+}
+
+func TestRoutingTableLookup(t *testing.T) {
+	cm, parent, child, hub := newRoutingFixture(t)
+	rt := NewRoutingTable()
+	if err := rt.AddSubtree(0x0100_0000, 8, parent.ID()); err != nil {
+		t.Fatalf("AddSubtree /8: %v", err)
+	}
+	if err := rt.AddSubtree(0x0102_0000, 16, hub.ID()); err != nil {
+		t.Fatalf("AddSubtree /16: %v", err)
+	}
+
+	cases := []struct {
+		name   string
+		target uint32
+		kind   RouteKind
+		conn   core.IConnection
+	}{
+		{"direct hit", 8, RouteDirect, child},
+		{"subtree longest match", 0x0102_00ab, RouteSubtree, hub},
+		{"subtree shorter match", 0x0103_0001, RouteSubtree, parent},
+		{"miss falls back to parent", 0x0200_0001, RouteParent, parent},
+	}
+	for _, tc := range cases {
+		hop, ok := rt.Lookup(cm, tc.target)
+		if !ok || hop.Kind != tc.kind || hop.Conn.ID() != tc.conn.ID() {
+			t.Fatalf("%s: Lookup(%#x)=%v/%s via %v, want %s via %s", tc.name, tc.target, ok, hop.Kind, hop.Conn, tc.kind, tc.conn.ID())
+		}
+	}
+
+	if _, ok := rt.LookupLocal(cm, 0x0200_0001); ok {
+		t.Fatalf("LookupLocal must not fall back to parent")
+	}
+	rt.RemoveConn(hub.ID())
+	if hop, _ := rt.Lookup(cm, 0x0102_00ab); hop.Kind != RouteSubtree || hop.Conn.ID() != parent.ID() {
+		t.Fatalf("after RemoveConn got %s via %v, want /8 summary via parent", hop.Kind, hop.Conn)
+	}
+	if err := rt.AddSubtree(1, 0, hub.ID()); err == nil {
+		t.Fatalf("AddSubtree accepted prefix length 0")
+	}
+}
+
+func TestRoutingTableSkipsRoutesOfClosedConns(t *testing.T) {
+	cm, parent, _, hub := newRoutingFixture(t)
+	rt := NewRoutingTable()
+	_ = rt.AddSubtree(0x0102_0000, 16, hub.ID())
+	if err := cm.Remove(hub.ID()); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if hop, _ := rt.Lookup(cm, 0x0102_0001); hop.Kind != RouteParent || hop.Conn.ID() != parent.ID() {
+		t.Fatalf("got %s via %v, want parent fallback", hop.Kind, hop.Conn)
+	}
+}
+
+func TestPreRouteForwardsViaSubtreeSummary(t *testing.T) {
+	cm, parent, _, hub := newRoutingFixture(t)
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+	proc := NewPreRoutingProcess(nil)
+	if err := proc.RoutingTable().AddSubtree(0x0102_0000, 16, hub.ID()); err != nil {
+		t.Fatalf("AddSubtree: %v", err)
+	}
+
+	for _, target := range []uint32{0x0102_0042, 0x0300_0001} {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(8).WithTargetID(target)
+		if got := proc.PreRoute(ctx, newPrerouteStubConn("ingress"), hdr, nil); got {
+			t.Fatalf("PreRoute(%#x)=true, want forwarded", target)
+		}
+	}
+	if len(srv.sends) != 2 || srv.sends[0].connID != hub.ID() || srv.sends[1].connID != parent.ID() {
+		t.Fatalf("sends=%+v, want hub then parent", srv.sends)
+	}
+}
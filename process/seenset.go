@@ -0,0 +1,73 @@
+package process
+
+// 本文件承载 Core 框架中与 `seenset` 相关的通用逻辑。
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBroadcastDedupSize 是开启广播去重时建议记住的 (source, msgID) 数量；去重默认关闭。
+	DefaultBroadcastDedupSize = 4096
+	// DefaultBroadcastDedupTTL 广播去重记录的默认有效期。
+	DefaultBroadcastDedupTTL = 30 * time.Second
+)
+
+// seenSet 是有容量上限的 LRU：记录最近见过的键，超过 ttl 的记录视为未见过，超出容量时淘汰最旧者。
+type seenSet struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	order *list.List // 前端最新
+	items map[uint64]*list.Element
+	now   func() time.Time // 测试可替换
+}
+
+type seenEntry struct {
+	key uint64
+	at  time.Time
+}
+
+// newSeenSet 创建去重集合；size<=0 时返回 nil，表示关闭去重。
+func newSeenSet(size int, ttl time.Duration) *seenSet {
+	if size <= 0 {
+		return nil
+	}
+	return &seenSet{size: size, ttl: ttl, order: list.New(), items: make(map[uint64]*list.Element, size), now: time.Now}
+}
+
+// seen 报告 key 是否在 ttl 内出现过；未出现（或已过期）时记录下来并返回 false。
+func (s *seenSet) seen(key uint64) bool {
+	if s == nil {
+		return false
+	}
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		e := el.Value.(*seenEntry)
+		if s.ttl <= 0 || now.Sub(e.at) < s.ttl {
+			return true
+		}
+		e.at = now
+		s.order.MoveToFront(el)
+		return false
+	}
+	s.items[key] = s.order.PushFront(&seenEntry{key: key, at: now})
+	for s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*seenEntry).key)
+	}
+	return false
+}
+
+// broadcastKey 以 (source, msgID) 标识一帧广播；任一为 0 时无法区分，返回 false 表示不参与去重。
+func broadcastKey(source, msgID uint32) (uint64, bool) {
+	if source == 0 || msgID == 0 {
+		return 0, false
+	}
+	return uint64(source)<<32 | uint64(msgID), true
+}
@@ -0,0 +1,105 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `seenset` 相关的行为。
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func TestSeenSetTTLAndEviction(t *testing.T) {
+	now := time.Unix(100, 0)
+	s := newSeenSet(2, time.Second)
+	s.now = func() time.Time { return now }
+	if s.seen(1) || !s.seen(1) {
+		t.Fatal("second sighting within ttl not reported")
+	}
+	now = now.Add(time.Second)
+	if s.seen(1) {
+		t.Fatal("expired entry still reported as seen")
+	}
+	s.seen(2)
+	s.seen(3) // 淘汰最旧的 1
+	if s.seen(1) {
+		t.Fatal("evicted entry still reported as seen")
+	}
+	if newSeenSet(0, time.Second) != nil || (*seenSet)(nil).seen(1) {
+		t.Fatal("size 0 should disable dedup")
+	}
+}
+
+func TestPreRouteDropsDuplicateBroadcast(t *testing.T) {
+	proc := NewPreRoutingProcess(nil).WithBroadcastDedup(DefaultBroadcastDedupSize, DefaultBroadcastDedupTTL)
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(7, cm)
+	ctx := core.WithServerContext(context.Background(), srv)
+
+	// 网状拓扑中同一广播先后经两条链路到达。
+	pathA := newPrerouteStubConn("child-a")
+	pathB := newPrerouteStubConn("child-b")
+	target := newPrerouteStubConn("child-c")
+	for _, c := range []*prerouteStubConn{pathA, pathB, target} {
+		c.SetMeta(core.MetaRoleKey, core.RoleChild)
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add(%s): %v", c.ID(), err)
+		}
+	}
+	broadcast := func(msgID uint32) core.IHeader {
+		return (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).
+			WithSourceID(11).WithTargetID(0).WithMsgID(msgID).WithHopLimit(8)
+	}
+
+	proc.PreRoute(ctx, pathA, broadcast(1), nil)
+	first := len(srv.sends)
+	if first != 2 {
+		t.Fatalf("first broadcast sent %d copies, want 2", first)
+	}
+	if got := proc.PreRoute(ctx, pathB, broadcast(1), nil); got || len(srv.sends) != first {
+		t.Fatalf("duplicate broadcast forwarded: PreRoute=%v sends=%d", got, len(srv.sends))
+	}
+	proc.PreRoute(ctx, pathB, broadcast(2), nil)
+	if len(srv.sends) != first+2 {
+		t.Fatalf("new broadcast sent %d copies, want 2", len(srv.sends)-first)
+	}
+
+	// 关闭去重后重复广播照常转发，仍由 hop_limit 兜底。
+	proc.WithBroadcastDedup(0, 0)
+	proc.PreRoute(ctx, pathA, broadcast(2), nil)
+	if len(srv.sends) != first+4 {
+		t.Fatalf("with dedup disabled sent %d copies, want 2", len(srv.sends)-first-2)
+	}
+}
+
+func TestPreRouteBroadcastDedupIsOptIn(t *testing.T) {
+	for name, proc := range map[string]*PreRoutingProcess{
+		"default":     NewPreRoutingProcess(nil),
+		"from_config": NewPreRoutingProcess(nil).WithConfig(config.NewMap(nil)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cm := connmgr.New()
+			srv := newPrerouteStubServer(7, cm)
+			ctx := core.WithServerContext(context.Background(), srv)
+			from := newPrerouteStubConn("child-a")
+			target := newPrerouteStubConn("child-b")
+			for _, c := range []*prerouteStubConn{from, target} {
+				c.SetMeta(core.MetaRoleKey, core.RoleChild)
+				if err := cm.Add(c); err != nil {
+					t.Fatalf("Add(%s): %v", c.ID(), err)
+				}
+			}
+			hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).
+				WithSourceID(11).WithTargetID(0).WithMsgID(1).WithHopLimit(8)
+			proc.PreRoute(ctx, from, hdr, nil)
+			proc.PreRoute(ctx, from, hdr, nil)
+			if len(srv.sends) != 2 {
+				t.Fatalf("repeated broadcast sent %d copies, want 2 with dedup off by default", len(srv.sends))
+			}
+		})
+	}
+}
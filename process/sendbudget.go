@@ -0,0 +1,139 @@
+package process
+
+// 本文件承载 Core 框架中与 `sendbudget` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrSendQueueFull 表示全局发送排队额度已满且溢出策略为丢弃。
+var ErrSendQueueFull = errors.New("send queue full")
+
+// SendOverflowPolicy 定义全局排队额度耗尽时 Dispatch 的行为。
+type SendOverflowPolicy int
+
+const (
+	// SendOverflowBlock 阻塞等待额度释放，受 EnqueueTimeout 与 ctx 约束（默认）。
+	SendOverflowBlock SendOverflowPolicy = iota
+	// SendOverflowDrop 立即返回 ErrSendQueueFull，由调用方决定是否重试。
+	SendOverflowDrop
+)
+
+// String 返回策略在配置中的名字。
+func (p SendOverflowPolicy) String() string {
+	if p == SendOverflowDrop {
+		return "drop"
+	}
+	return "block"
+}
+
+// SendOverflowPolicyFromConfig 解析配置字符串，未知值退回 block。
+func SendOverflowPolicyFromConfig(raw string) SendOverflowPolicy {
+	if strings.EqualFold(strings.TrimSpace(raw), "drop") {
+		return SendOverflowDrop
+	}
+	return SendOverflowBlock
+}
+
+// sendBudget 跨所有 connWriter 统计已排队但尚未写出的帧数与 payload 字节数。
+// 额度在 Dispatch 入队时占用，在 writer 写完（或任务在途中失败）后归还。
+type sendBudget struct {
+	maxFrames int64
+	maxBytes  int64
+
+	frames  atomic.Int64
+	bytes   atomic.Int64
+	waiters atomic.Int32
+
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+// newSendBudget 在两项上限都未启用时返回 nil，调用方据此跳过记账。
+func newSendBudget(maxFrames int, maxBytes int64) *sendBudget {
+	if maxFrames <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	if maxFrames < 0 {
+		maxFrames = 0
+	}
+	if maxBytes < 0 {
+		maxBytes = 0
+	}
+	return &sendBudget{maxFrames: int64(maxFrames), maxBytes: maxBytes, wake: make(chan struct{})}
+}
+
+// tryAcquire 乐观占用一帧额度，超限则回滚；队列为空时放行超过字节上限的单个大帧，避免永久阻塞。
+func (b *sendBudget) tryAcquire(n int64) bool {
+	f := b.frames.Add(1)
+	if b.maxFrames > 0 && f > b.maxFrames {
+		b.frames.Add(-1)
+		return false
+	}
+	v := b.bytes.Add(n)
+	if b.maxBytes > 0 && v > b.maxBytes && v != n {
+		b.bytes.Add(-n)
+		b.frames.Add(-1)
+		return false
+	}
+	return true
+}
+
+// acquire 按溢出策略占用额度：drop 立即失败，block 等到额度释放、超时、ctx 取消或 done 关闭。
+func (b *sendBudget) acquire(ctx context.Context, done <-chan struct{}, n int64, policy SendOverflowPolicy, timeout time.Duration, clock Clock) error {
+	if b.tryAcquire(n) {
+		return nil
+	}
+	if policy == SendOverflowDrop {
+		return ErrSendQueueFull
+	}
+	var timerC <-chan time.Time
+	if timeout > 0 {
+		timer := clock.NewTimer(timeout)
+		defer timer.Stop()
+		timerC = timer.C()
+	}
+	b.waiters.Add(1)
+	defer b.waiters.Add(-1)
+	for {
+		b.mu.Lock()
+		wake := b.wake
+		b.mu.Unlock()
+		// 取到唤醒通道后再试一次，避免与 release 之间丢失通知。
+		if b.tryAcquire(n) {
+			return nil
+		}
+		select {
+		case <-wake:
+		case <-timerC:
+			return errEnqueueTimeout
+		case <-done:
+			return errDispatcherClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release 归还一帧额度，并在有等待者时广播唤醒。
+func (b *sendBudget) release(n int64) {
+	b.frames.Add(-1)
+	b.bytes.Add(-n)
+	if b.waiters.Load() == 0 {
+		return
+	}
+	b.mu.Lock()
+	close(b.wake)
+	b.wake = make(chan struct{})
+	b.mu.Unlock()
+}
+
+// usage 返回当前排队的帧数与字节数。
+func (b *sendBudget) usage() (frames, bytes int64) {
+	return b.frames.Load(), b.bytes.Load()
+}
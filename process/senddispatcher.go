@@ -6,14 +6,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"hash/fnv"
 	"log/slog"
+	"os"
 	"strconv"
 	"sync"
 	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
 )
 
 var (
@@ -34,6 +35,16 @@ type SendOptions struct {
 	ConnBuffer     int           // 单连接发送队列长度。
 	EnqueueTimeout time.Duration // 分片队列与单连接队列共用的入队超时。
 	EncodeInWriter bool          // 是否在单连接 writer goroutine 内完成编码。
+	SyncMode       bool          // 测试模式：Dispatch 在调用方 goroutine 内直接写出，回调先于返回触发。
+	// MaxQueuedFrames/MaxQueuedBytes 为跨所有连接的排队上限（含正在写出的帧），<=0 表示不限制。
+	MaxQueuedFrames int
+	MaxQueuedBytes  int64
+	OverflowPolicy  SendOverflowPolicy // 全局额度耗尽时的行为，默认阻塞等待。
+	// CoalesceMaxFrames>1 时单连接 writer 每次写出会顺带取走已排队的帧（至多该数量）合并为一次写，
+	// 减少小帧的系统调用；CoalesceMaxBytes 为单次合并的 payload 字节预算（默认 64KiB）。
+	CoalesceMaxFrames int
+	CoalesceMaxBytes  int
+	Clock             Clock // 入队超时使用的时间源，nil 表示真实时间。
 }
 
 type sendTask struct {
@@ -43,102 +54,191 @@ type sendTask struct {
 	payload []byte
 	codec   core.IHeaderCodec
 	cb      func(error)
+	budget  *sendBudget // 非 nil 表示该任务占用了全局额度，结束时需归还。
 }
 
+// finish 回调结果并归还全局额度，任务在任何路径上结束都必须且只能调用一次。
+// 回调 panic 会被收敛到日志，避免拖垮分片或单连接 writer 协程、使其队列无人消费。
+func (t sendTask) finish(err error, log *slog.Logger) {
+	if t.budget != nil {
+		t.budget.release(int64(len(t.payload)))
+	}
+	if t.cb == nil {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error("send callback panic", "recover", r, "conn", t.conn.ID())
+		}
+	}()
+	t.cb(err)
+}
+
+// priority 返回任务的帧优先级。
+func (t sendTask) priority() uint8 { return header.PriorityOf(t.hdr) }
+
 type connWriter struct {
 	conn           core.IConnection
-	ch             chan sendTask
+	lanes          *priorityLanes[sendTask]
 	log            *slog.Logger
 	encodeInWriter bool
 	enqueueTimeout time.Duration
+	clock          Clock
+	coalesceFrames int
+	coalesceBytes  int
+	batch          []sendTask // 合并写出时复用的批次缓冲，仅 writer 协程访问
 
 	closeOnce sync.Once
+	done      chan struct{} // 关闭信号：打断阻塞中的 enqueue 与空闲等待。
+	sealed    chan struct{} // 在 closed 置位后关闭，此后不会再有任务入队。
 	closed    bool
 	mu        sync.RWMutex
 	wg        sync.WaitGroup
 }
 
-// start 启动单连接 writer 的后台循环，持续串行消费该连接上的发送任务。
+// start 启动单连接 writer 的后台循环，按优先级串行消费该连接上的发送任务。
 func (w *connWriter) start() {
 	w.wg.Add(1)
 	go func() {
 		defer w.wg.Done()
-		for task := range w.ch {
-			err := w.write(task)
-			if task.cb != nil {
-				task.cb(err)
+		for {
+			task, ok := w.lanes.next(w.done)
+			if !ok {
+				break
+			}
+			w.drain(task)
+		}
+		// 等待入队方全部退出后再排空一次，保证关闭前已入队的任务都会被写出并回调。
+		<-w.sealed
+		for {
+			task, ok := w.lanes.poll()
+			if !ok {
+				return
 			}
+			w.drain(task)
 		}
 	}()
 }
 
 // write 在单连接串行 writer 中真正落盘，确保同一连接上的帧不会并发交错。
+// 排队期间 ctx 已取消的任务直接跳过并回调 ctx.Err()；ctx 带 deadline 时作为本次写出的截止时间。
 func (w *connWriter) write(task sendTask) error {
+	if err := taskCtxErr(task); err != nil {
+		return err
+	}
+	if deadline, ok := taskDeadline(task); ok {
+		defer setWriteDeadline(w.conn.Pipe(), deadline)()
+	}
+	err := writeTask(w.conn, task, w.encodeInWriter)
+	w.closeOnWriteTimeout(err)
+	return err
+}
+
+// closeOnWriteTimeout 在写截止时间打断写出时关闭连接：已写出的半帧使对端无法再找到帧边界，
+// 继续在该连接上写只会让对端解出错帧。
+func (w *connWriter) closeOnWriteTimeout(err error) {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
+	core.MarkCloseReason(w.conn, core.CloseReasonWriteTimeout)
+	if w.log != nil {
+		w.log.Warn("write deadline exceeded, closing connection", "conn", w.conn.ID(), "err", err)
+	}
+	_ = w.conn.Close()
+}
+
+// taskCtxErr 返回任务 ctx 的取消原因，未取消或无 ctx 时为 nil。
+func taskCtxErr(task sendTask) error {
+	if task.ctx == nil {
+		return nil
+	}
+	return task.ctx.Err()
+}
+
+// taskDeadline 返回任务 ctx 的截止时间。
+func taskDeadline(task sendTask) (time.Time, bool) {
+	if task.ctx == nil {
+		return time.Time{}, false
+	}
+	return task.ctx.Deadline()
+}
+
+// setWriteDeadline 在 pipe 支持时设置写截止时间，返回恢复为不限时的函数；超时打断的半帧会使该连接的流失效，
+// writer 随后经 closeOnWriteTimeout 关闭连接。
+func setWriteDeadline(pipe core.IPipe, deadline time.Time) (reset func()) {
+	dl, ok := pipe.(core.IWriteDeadlinePipe)
+	if !ok {
+		return func() {}
+	}
+	_ = dl.SetWriteDeadline(deadline)
+	return func() { _ = dl.SetWriteDeadline(time.Time{}) }
+}
+
+// writeTask 把单个发送任务写到连接 pipe，供异步 writer 与同步模式共用。
+func writeTask(conn core.IConnection, task sendTask, encodeInWriter bool) error {
 	if task.codec == nil {
 		return errNilCodec
 	}
-	pipe := w.conn.Pipe()
+	pipe := conn.Pipe()
 	if pipe == nil {
 		return errNilPipe
 	}
 
-	if w.encodeInWriter {
+	if encodeInWriter {
 		return WriteFrame(pipe, task.codec, core.Frame{Header: task.hdr, Payload: task.payload})
 	}
 	// 非编码模式下认为 payload 已经是最终线上的字节序列。
 	return core.WriteAll(pipe, task.payload)
 }
 
-// enqueue 把发送任务放进该连接私有队列，并在关闭或超时时尽快失败返回。
-func (w *connWriter) enqueue(task sendTask) (err error) {
+// enqueue 把发送任务放进该连接私有队列的对应优先级通道，并在关闭或超时时尽快失败返回。
+// 读锁覆盖整个入队过程，stop 据此确认不再有并发入队。
+func (w *connWriter) enqueue(task sendTask) error {
 	w.mu.RLock()
-	closed := w.closed
-	w.mu.RUnlock()
-	if closed {
+	defer w.mu.RUnlock()
+	if w.closed {
 		return errWriterClosed
 	}
-	defer func() {
-		if r := recover(); r != nil {
-			w.mu.Lock()
-			w.closed = true
-			w.mu.Unlock()
-			err = errWriterClosed
+	if err := w.lanes.push(task.priority(), task, w.done, w.enqueueTimeout, w.clock); err != nil {
+		if errors.Is(err, errDispatcherClosed) {
+			return errWriterClosed
 		}
-	}()
-	if w.enqueueTimeout <= 0 {
-		w.ch <- task
-		return nil
-	}
-	timer := time.NewTimer(w.enqueueTimeout)
-	defer timer.Stop()
-	select {
-	case w.ch <- task:
-		return nil
-	case <-timer.C:
-		return errEnqueueTimeout
+		return err
 	}
+	return nil
 }
 
 // stop 幂等关闭单连接 writer，并等待已经入队的任务消费完成。
 func (w *connWriter) stop() {
 	w.closeOnce.Do(func() {
+		close(w.done)
 		w.mu.Lock()
 		w.closed = true
-		close(w.ch)
 		w.mu.Unlock()
+		close(w.sealed)
 	})
 	w.wg.Wait()
 }
 
 // SendDispatcher 把全局发送请求分流到“按连接串行”的 writer，兼顾并发与单连接有序。
+// 分片队列与连接 writer 都按帧优先级拆分通道：同一优先级内保持顺序，高优先级可插队。
+//
+// 顺序保证：对同一连接、同一优先级的帧，若一次 Dispatch 返回先于另一次 Dispatch 开始
+// （如同一 goroutine 先后调用），则前者必然先写出，与调用方是 Server.Send 还是 Broadcast 无关。
+// 这依赖两点：同一连接 ID 总落在同一分片，且每个分片只有一个消费协程，按 FIFO 转交给连接 writer。
+// 并发调用之间没有先后关系，不作保证；入队失败（超时、额度不足）的帧被丢弃，不会乱序重发。
 type SendDispatcher struct {
 	log            *slog.Logger
-	shards         []chan sendTask
-	shardCount     int
 	workersPerChan int
 	connBuffer     int
 	enqueueTimeout time.Duration
+	clock          Clock
 	encodeInWriter bool
+	syncMode       bool
+	budget         *sendBudget
+	overflow       SendOverflowPolicy
+	coalesceFrames int
+	coalesceBytes  int
 
 	startOnce    sync.Once
 	shutdownOnce sync.Once
@@ -146,6 +246,11 @@ type SendDispatcher struct {
 	cancel       context.CancelFunc
 	wg           sync.WaitGroup
 
+	// topo 保护分片拓扑：Dispatch 持读锁入队，Reconfigure 持写锁排空并替换。
+	topo    sync.RWMutex
+	shards  *sendShards
+	started bool
+
 	mu      sync.RWMutex
 	writers map[string]*connWriter
 }
@@ -173,34 +278,56 @@ func NewSendDispatcher(opts SendOptions) (*SendDispatcher, error) {
 	if !opts.EncodeInWriter {
 		opts.EncodeInWriter = true
 	}
-	shards := make([]chan sendTask, opts.ChannelCount)
-	for i := range shards {
-		shards[i] = make(chan sendTask, opts.ChannelBuffer)
+	if opts.CoalesceMaxBytes <= 0 {
+		opts.CoalesceMaxBytes = defaultCoalesceMaxBytes
+	}
+	if opts.Clock == nil {
+		opts.Clock = RealClock{}
 	}
 	return &SendDispatcher{
 		log:            opts.Logger,
-		shards:         shards,
-		shardCount:     opts.ChannelCount,
+		shards:         newSendShards(opts.ChannelCount, opts.ChannelBuffer),
 		workersPerChan: opts.WorkersPerChan,
 		connBuffer:     opts.ConnBuffer,
 		enqueueTimeout: opts.EnqueueTimeout,
+		clock:          opts.Clock,
 		encodeInWriter: opts.EncodeInWriter,
+		syncMode:       opts.SyncMode,
+		budget:         newSendBudget(opts.MaxQueuedFrames, opts.MaxQueuedBytes),
+		overflow:       opts.OverflowPolicy,
+		coalesceFrames: opts.CoalesceMaxFrames,
+		coalesceBytes:  opts.CoalesceMaxBytes,
 		writers:        make(map[string]*connWriter),
 	}, nil
 }
 
 // NewSendDispatcherFromConfig 从配置读取发送并发参数，供 Server 统一装配。
 func NewSendDispatcherFromConfig(cfg core.IConfig, logger *slog.Logger) (*SendDispatcher, error) {
-	opts := SendOptions{
-		Logger:         logger,
-		ChannelCount:   readPositiveInt(cfg, coreconfig.KeySendChannelCount, 1),
-		WorkersPerChan: readPositiveInt(cfg, coreconfig.KeySendWorkersPerChan, 1),
-		ChannelBuffer:  readPositiveInt(cfg, coreconfig.KeySendChannelBuffer, 64),
-		ConnBuffer:     readPositiveInt(cfg, coreconfig.KeySendConnBuffer, 64),
-		EnqueueTimeout: readDurationMs(cfg, coreconfig.KeySendEnqueueTimeoutMS, 100),
-		EncodeInWriter: true,
-	}
-	return NewSendDispatcher(opts)
+	return NewSendDispatcher(SendOptionsFromConfig(cfg, logger))
+}
+
+// SendOptionsFromConfig 读取 send.* 配置生成 SendOptions，调用方可在此基础上补充 Clock 等非配置项。
+func SendOptionsFromConfig(cfg core.IConfig, logger *slog.Logger) SendOptions {
+	rawPolicy := ""
+	if cfg != nil {
+		if v, ok := cfg.Get(coreconfig.KeySendOverflowPolicy); ok {
+			rawPolicy = v
+		}
+	}
+	return SendOptions{
+		Logger:            logger,
+		ChannelCount:      readPositiveInt(cfg, coreconfig.KeySendChannelCount, 1),
+		WorkersPerChan:    readPositiveInt(cfg, coreconfig.KeySendWorkersPerChan, 1),
+		ChannelBuffer:     readPositiveInt(cfg, coreconfig.KeySendChannelBuffer, 64),
+		ConnBuffer:        readPositiveInt(cfg, coreconfig.KeySendConnBuffer, 64),
+		EnqueueTimeout:    readDurationMs(cfg, coreconfig.KeySendEnqueueTimeoutMS, 100),
+		EncodeInWriter:    true,
+		MaxQueuedFrames:   readPositiveInt(cfg, coreconfig.KeySendMaxQueuedFrames, 0),
+		MaxQueuedBytes:    int64(readPositiveInt(cfg, coreconfig.KeySendMaxQueuedBytes, 0)),
+		OverflowPolicy:    SendOverflowPolicyFromConfig(rawPolicy),
+		CoalesceMaxFrames: readPositiveInt(cfg, coreconfig.KeySendCoalesceMaxFrames, 0),
+		CoalesceMaxBytes:  readPositiveInt(cfg, coreconfig.KeySendCoalesceMaxBytes, defaultCoalesceMaxBytes),
+	}
 }
 
 // ensureStarted 延迟启动分片 worker 和清理协程，避免未使用时提前占用 goroutine。
@@ -209,36 +336,22 @@ func (d *SendDispatcher) ensureStarted(ctx context.Context) {
 		if ctx == nil {
 			ctx = context.Background()
 		}
+		d.topo.Lock()
 		d.ctx, d.cancel = context.WithCancel(ctx)
-		for i := range d.shards {
-			q := d.shards[i]
-			d.wg.Add(1)
-			go func(ch <-chan sendTask) {
-				defer d.wg.Done()
-				for task := range ch {
-					if task.conn == nil {
-						d.log.Warn("nil conn in send task")
-						continue
-					}
-					writer := d.getOrCreateWriter(task.conn)
-					if writer == nil {
-						if task.cb != nil {
-							task.cb(errWriterClosed)
-						}
-						continue
-					}
-					err := writer.enqueue(task)
-					if err != nil && task.cb != nil {
-						task.cb(err)
-					}
-				}
-			}(q)
-		}
+		done := d.ctx.Done()
+		d.startShards(d.shards)
+		d.started = true
+		d.topo.Unlock()
+		d.wg.Add(1)
 		go func() {
-			<-d.ctx.Done()
-			for _, q := range d.shards {
-				close(q)
-			}
+			defer d.wg.Done()
+			<-done
+			d.topo.Lock()
+			shards := d.shards
+			shards.retire()
+			d.topo.Unlock()
+			// 分片 worker 排空后再关闭 writer，避免排空期间新建的 writer 泄漏。
+			shards.wg.Wait()
 			d.mu.Lock()
 			for _, w := range d.writers {
 				w.stop()
@@ -254,12 +367,33 @@ func (d *SendDispatcher) Dispatch(ctx context.Context, conn core.IConnection, hd
 	if conn == nil {
 		return errNilConn
 	}
+	if d.syncMode {
+		return d.dispatchSync(ctx, conn, hdr, payload, codec, cb)
+	}
 	d.ensureStarted(ctx)
-	idx := d.selectQueue(conn, hdr)
 	task := sendTask{ctx: ctx, conn: conn, hdr: hdr, payload: payload, codec: codec, cb: cb}
+	if d.budget != nil {
+		if err := d.budget.acquire(ctx, d.ctx.Done(), int64(len(payload)), d.overflow, d.enqueueTimeout, d.clock); err != nil {
+			return err
+		}
+		task.budget = d.budget
+	}
+	d.topo.RLock()
+	shards := d.shards
+	err := d.enqueueShard(ctx, shards.lanes[shards.selectQueue(conn, hdr)], task)
+	d.topo.RUnlock()
+	if err != nil && task.budget != nil {
+		task.budget.release(int64(len(payload)))
+	}
+	return err
+}
+
+// enqueueShard 把任务放进分片队列的对应优先级通道，受 EnqueueTimeout、调度器关闭与 ctx 约束。
+func (d *SendDispatcher) enqueueShard(ctx context.Context, q *priorityLanes[sendTask], task sendTask) error {
+	ch := q.lane(task.priority())
 	if d.enqueueTimeout <= 0 {
 		select {
-		case d.shards[idx] <- task:
+		case ch <- task:
 			return nil
 		case <-d.ctx.Done():
 			return errDispatcherClosed
@@ -267,12 +401,12 @@ func (d *SendDispatcher) Dispatch(ctx context.Context, conn core.IConnection, hd
 			return ctx.Err()
 		}
 	}
-	timer := time.NewTimer(d.enqueueTimeout)
+	timer := d.clock.NewTimer(d.enqueueTimeout)
 	defer timer.Stop()
 	select {
-	case d.shards[idx] <- task:
+	case ch <- task:
 		return nil
-	case <-timer.C:
+	case <-timer.C():
 		return errEnqueueTimeout
 	case <-d.ctx.Done():
 		return errDispatcherClosed
@@ -281,20 +415,22 @@ func (d *SendDispatcher) Dispatch(ctx context.Context, conn core.IConnection, hd
 	}
 }
 
-// selectQueue 用连接 ID 做稳定分片，尽量让同一连接的 writer 查找命中同一 shard。
-func (d *SendDispatcher) selectQueue(conn core.IConnection, hdr core.IHeader) int {
-	if d.shardCount == 1 {
-		return 0
-	}
-	if conn != nil {
-		h := fnv.New32a()
-		_, _ = h.Write([]byte(conn.ID()))
-		return int(h.Sum32() % uint32(d.shardCount))
+// Queued 返回跨所有连接当前排队中的帧数与 payload 字节数；未启用全局上限时恒为 0。
+func (d *SendDispatcher) Queued() (frames, bytes int64) {
+	if d.budget == nil {
+		return 0, 0
 	}
-	if hdr != nil {
-		return int(hdr.SubProto()) % d.shardCount
+	return d.budget.usage()
+}
+
+// dispatchSync 在调用方 goroutine 内直接写出并返回写错误，用于需要确定性时序的测试。
+func (d *SendDispatcher) dispatchSync(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte, codec core.IHeaderCodec, cb func(error)) error {
+	task := sendTask{ctx: ctx, conn: conn, hdr: hdr, payload: payload, codec: codec, cb: cb}
+	err := writeTask(conn, task, d.encodeInWriter)
+	if cb != nil {
+		cb(err)
 	}
-	return 0
+	return err
 }
 
 // getOrCreateWriter 惰性创建连接专属 writer，避免为短生命周期连接预先分配资源。
@@ -314,10 +450,15 @@ func (d *SendDispatcher) getOrCreateWriter(conn core.IConnection) *connWriter {
 	}
 	w := &connWriter{
 		conn:           conn,
-		ch:             make(chan sendTask, d.connBuffer),
+		lanes:          newPriorityLanes[sendTask](d.connBuffer),
+		done:           make(chan struct{}),
+		sealed:         make(chan struct{}),
 		log:            d.log,
 		encodeInWriter: d.encodeInWriter,
 		enqueueTimeout: d.enqueueTimeout,
+		clock:          d.clock,
+		coalesceFrames: d.coalesceFrames,
+		coalesceBytes:  d.coalesceBytes,
 	}
 	w.start()
 	d.writers[id] = w
@@ -337,6 +478,18 @@ func (d *SendDispatcher) CloseConn(connID string) {
 	}
 }
 
+// WriterSnapshot 返回当前存活的单连接 writer 及其队列中等待写出的任务数（不含正在写出的一帧），
+// 便于排查积压的连接后再决定是否 CloseConn；计数为读取瞬间的近似值。
+func (d *SendDispatcher) WriterSnapshot() map[string]int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make(map[string]int, len(d.writers))
+	for id, w := range d.writers {
+		out[id] = w.lanes.queued()
+	}
+	return out
+}
+
 // Shutdown 关闭全部分片和连接 writer，并等待后台 goroutine 退出。
 func (d *SendDispatcher) Shutdown() {
 	d.shutdownOnce.Do(func() {
@@ -349,10 +502,12 @@ func (d *SendDispatcher) Shutdown() {
 
 // Snapshot 返回当前调度器的并发配置，便于测试和运行时观测。
 func (d *SendDispatcher) Snapshot() (channels, workers, buffer int) {
-	channels = len(d.shards)
+	d.topo.RLock()
+	defer d.topo.RUnlock()
+	channels = len(d.shards.lanes)
 	workers = d.workersPerChan
 	if channels > 0 {
-		buffer = cap(d.shards[0])
+		buffer = d.shards.lanes[0].capacity()
 	}
 	return
 }
@@ -360,7 +515,10 @@ func (d *SendDispatcher) Snapshot() (channels, workers, buffer int) {
 // String 输出调度器关键参数，便于日志或调试时快速识别配置。
 func (d *SendDispatcher) String() string {
 	ch, w, b := d.Snapshot()
-	return fmt.Sprintf("SendDispatcher{channels=%d workers=%d buffer=%d connBuffer=%d enqueueTimeout=%s}", ch, w, b, d.connBuffer, d.enqueueTimeout)
+	d.mu.RLock()
+	connBuffer := d.connBuffer
+	d.mu.RUnlock()
+	return fmt.Sprintf("SendDispatcher{channels=%d workers=%d buffer=%d connBuffer=%d enqueueTimeout=%s}", ch, w, b, connBuffer, d.enqueueTimeout)
 }
 
 // readDurationMs 把毫秒配置解析为 time.Duration，非法值统一退回默认值。
@@ -0,0 +1,546 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `senddispatcher` 相关的行为。
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+type sendStubPipe struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+	err error
+}
+
+func (p *sendStubPipe) Read([]byte) (int, error) { return 0, errors.New("not readable") }
+func (p *sendStubPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return 0, p.err
+	}
+	return p.buf.Write(b)
+}
+func (p *sendStubPipe) Close() error { return nil }
+
+func (p *sendStubPipe) Bytes() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]byte(nil), p.buf.Bytes()...)
+}
+
+type sendStubConn struct {
+	*prerouteStubConn
+	pipe *sendStubPipe
+}
+
+func newSendStubConn(id string) *sendStubConn {
+	return &sendStubConn{prerouteStubConn: newPrerouteStubConn(id), pipe: &sendStubPipe{}}
+}
+
+func (c *sendStubConn) Pipe() core.IPipe { return c.pipe }
+
+func TestSendDispatcherSyncModeCallbackBeforeReturn(t *testing.T) {
+	d, err := NewSendDispatcher(SendOptions{SyncMode: true})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	conn := newSendStubConn("c1")
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithMsgID(9)
+	payload := []byte("sync")
+
+	called := false
+	if err := d.Dispatch(context.Background(), conn, hdr, payload, header.HeaderTcpCodec{}, func(e error) {
+		if e != nil {
+			t.Errorf("callback err: %v", e)
+		}
+		called = true
+	}); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if !called {
+		t.Fatalf("callback did not fire before Dispatch returned")
+	}
+	gotHdr, gotPayload, err := (header.HeaderTcpCodec{}).Decode(bytes.NewReader(conn.pipe.Bytes()))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if gotHdr.GetMsgID() != 9 || !bytes.Equal(gotPayload, payload) {
+		t.Fatalf("unexpected frame: msg=%d payload=%q", gotHdr.GetMsgID(), gotPayload)
+	}
+}
+
+func TestSendDispatcherSyncModeReturnsWriteError(t *testing.T) {
+	d, err := NewSendDispatcher(SendOptions{SyncMode: true})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	conn := newSendStubConn("c1")
+	writeErr := errors.New("broken pipe")
+	conn.pipe.err = writeErr
+
+	var cbErr error
+	err = d.Dispatch(context.Background(), conn, &header.HeaderTcp{}, nil, header.HeaderTcpCodec{}, func(e error) { cbErr = e })
+	if !errors.Is(err, writeErr) {
+		t.Fatalf("Dispatch err=%v, want %v", err, writeErr)
+	}
+	if !errors.Is(cbErr, writeErr) {
+		t.Fatalf("callback err=%v, want %v", cbErr, writeErr)
+	}
+}
+
+// blockingSendConn 的 pipe 在 release 关闭前阻塞所有写入，用来让帧滞留在 writer 中。
+type blockingSendConn struct {
+	*prerouteStubConn
+	pipe *blockingPipe
+}
+
+type blockingPipe struct {
+	release <-chan struct{}
+}
+
+func (p *blockingPipe) Read([]byte) (int, error) { return 0, errors.New("not readable") }
+func (p *blockingPipe) Write(b []byte) (int, error) {
+	<-p.release
+	return len(b), nil
+}
+func (p *blockingPipe) Close() error { return nil }
+
+func (c *blockingSendConn) Pipe() core.IPipe { return c.pipe }
+
+func TestSendDispatcherGlobalQueueCapAcrossConnections(t *testing.T) {
+	const (
+		connCount = 32
+		perConn   = 4
+		globalCap = 10
+	)
+	cases := []struct {
+		name    string
+		policy  SendOverflowPolicy
+		wantErr error
+	}{
+		{name: "drop", policy: SendOverflowDrop, wantErr: ErrSendQueueFull},
+		{name: "block", policy: SendOverflowBlock, wantErr: errEnqueueTimeout},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			release := make(chan struct{})
+			d, err := NewSendDispatcher(SendOptions{
+				ChannelCount:    4,
+				ChannelBuffer:   16,
+				ConnBuffer:      perConn,
+				EnqueueTimeout:  5 * time.Millisecond,
+				MaxQueuedFrames: globalCap,
+				OverflowPolicy:  tc.policy,
+			})
+			if err != nil {
+				t.Fatalf("NewSendDispatcher: %v", err)
+			}
+			defer d.Shutdown()
+
+			var wg sync.WaitGroup
+			var written atomic.Int32
+			accepted, rejected := 0, 0
+			hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1)
+			for i := 0; i < connCount; i++ {
+				conn := &blockingSendConn{prerouteStubConn: newPrerouteStubConn(fmt.Sprintf("c%d", i)), pipe: &blockingPipe{release: release}}
+				for j := 0; j < perConn; j++ {
+					wg.Add(1)
+					err := d.Dispatch(context.Background(), conn, hdr, []byte("x"), header.HeaderTcpCodec{}, func(e error) {
+						if e == nil {
+							written.Add(1)
+						}
+						wg.Done()
+					})
+					switch {
+					case err == nil:
+						accepted++
+					case errors.Is(err, tc.wantErr):
+						wg.Done()
+						rejected++
+					default:
+						t.Fatalf("Dispatch err=%v, want nil or %v", err, tc.wantErr)
+					}
+				}
+			}
+			if accepted != globalCap || rejected != connCount*perConn-globalCap {
+				t.Fatalf("accepted=%d rejected=%d, want %d/%d", accepted, rejected, globalCap, connCount*perConn-globalCap)
+			}
+			if frames, _ := d.Queued(); frames != globalCap {
+				t.Fatalf("Queued frames=%d, want %d", frames, globalCap)
+			}
+
+			close(release)
+			wg.Wait()
+			if got := written.Load(); got != globalCap {
+				t.Fatalf("written=%d, want %d", got, globalCap)
+			}
+			if frames, bytes := d.Queued(); frames != 0 || bytes != 0 {
+				t.Fatalf("Queued after drain=(%d,%d), want (0,0)", frames, bytes)
+			}
+		})
+	}
+}
+
+func TestSendDispatcherBlockPolicyResumesAfterRelease(t *testing.T) {
+	release := make(chan struct{})
+	d, err := NewSendDispatcher(SendOptions{MaxQueuedFrames: 1, OverflowPolicy: SendOverflowBlock, EnqueueTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	conn := &blockingSendConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &blockingPipe{release: release}}
+	hdr := &header.HeaderTcp{}
+	if err := d.Dispatch(context.Background(), conn, hdr, []byte("a"), header.HeaderTcpCodec{}, nil); err != nil {
+		t.Fatalf("first Dispatch: %v", err)
+	}
+	written := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Dispatch(context.Background(), conn, hdr, []byte("b"), header.HeaderTcpCodec{}, func(error) { close(written) })
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("second Dispatch returned early: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("second Dispatch: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("second Dispatch still blocked after budget released")
+	}
+	select {
+	case <-written:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("second frame not written")
+	}
+}
+
+func TestSendDispatcherEnqueueTimeoutWithFakeClock(t *testing.T) {
+	clock := newFakeClock()
+	release := make(chan struct{})
+	d, err := NewSendDispatcher(SendOptions{MaxQueuedFrames: 1, OverflowPolicy: SendOverflowBlock, EnqueueTimeout: time.Minute, Clock: clock})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	defer close(release) // 先放行阻塞的写出，Shutdown 才能排空
+	conn := &blockingSendConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &blockingPipe{release: release}}
+	hdr := &header.HeaderTcp{}
+	if err := d.Dispatch(context.Background(), conn, hdr, []byte("a"), header.HeaderTcpCodec{}, nil); err != nil {
+		t.Fatalf("first Dispatch: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Dispatch(context.Background(), conn, hdr, []byte("b"), header.HeaderTcpCodec{}, nil)
+	}()
+	// 等到第二帧因全局额度耗尽进入等待（此前其超时定时器已创建）再推进时间。
+	for d.budget.waiters.Load() == 0 {
+		runtime.Gosched()
+	}
+	clock.Advance(time.Minute - time.Nanosecond)
+	select {
+	case err := <-done:
+		t.Fatalf("Dispatch returned before timeout: %v", err)
+	default:
+	}
+	clock.Advance(time.Nanosecond)
+	if err := <-done; !errors.Is(err, errEnqueueTimeout) {
+		t.Fatalf("Dispatch err=%v, want %v", err, errEnqueueTimeout)
+	}
+}
+
+func TestSendDispatcherReconfigureUnderLoadKeepsEveryFrame(t *testing.T) {
+	d, err := NewSendDispatcher(SendOptions{ChannelCount: 1, ChannelBuffer: 4, ConnBuffer: 4})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	const perConn = 400
+	conns := make([]*sendStubConn, 4)
+	var written sync.WaitGroup
+	var failed atomic.Int32
+	var senders sync.WaitGroup
+	for i := range conns {
+		conns[i] = newSendStubConn(fmt.Sprintf("c%d", i))
+		senders.Add(1)
+		go func(conn *sendStubConn) {
+			defer senders.Done()
+			for n := 0; n < perConn; n++ {
+				hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(uint32(n))
+				written.Add(1)
+				cb := func(err error) {
+					if err != nil {
+						failed.Add(1)
+					}
+					written.Done()
+				}
+				if err := d.Dispatch(context.Background(), conn, hdr, []byte("x"), header.HeaderTcpCodec{}, cb); err != nil {
+					failed.Add(1)
+					written.Done()
+				}
+			}
+		}(conns[i])
+	}
+
+	for _, tuning := range []SendTuning{
+		{ChannelCount: 4},
+		{ChannelCount: 2, ConnBuffer: 8},
+		{ChannelCount: 8, ChannelBuffer: 16},
+	} {
+		time.Sleep(time.Millisecond)
+		if err := d.Reconfigure(tuning); err != nil {
+			t.Fatalf("Reconfigure(%+v): %v", tuning, err)
+		}
+	}
+	senders.Wait()
+	written.Wait()
+
+	if n := failed.Load(); n != 0 {
+		t.Fatalf("%d sends failed across reconfiguration", n)
+	}
+	if ch, _, buf := d.Snapshot(); ch != 8 || buf != 16 {
+		t.Fatalf("Snapshot channels=%d buffer=%d, want 8/16", ch, buf)
+	}
+	for _, conn := range conns {
+		r := bytes.NewReader(conn.pipe.Bytes())
+		for want := uint32(0); want < perConn; want++ {
+			hdr, _, err := (header.HeaderTcpCodec{}).Decode(r)
+			if err != nil {
+				t.Fatalf("%s: decode frame %d: %v", conn.ID(), want, err)
+			}
+			if got := hdr.GetMsgID(); got != want {
+				t.Fatalf("%s: frame %d has msg_id %d, order broken", conn.ID(), want, got)
+			}
+		}
+		if r.Len() != 0 {
+			t.Fatalf("%s: %d trailing bytes", conn.ID(), r.Len())
+		}
+	}
+}
+
+func TestSendDispatcherSurvivesPanickingCallback(t *testing.T) {
+	d, err := NewSendDispatcher(SendOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+
+	conn := newSendStubConn("c1")
+	done := make(chan uint32, 4)
+	for i := uint32(1); i <= 4; i++ {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(i)
+		cb := func(error) {
+			if i%2 == 1 {
+				panic(fmt.Sprintf("callback %d", i))
+			}
+			done <- i
+		}
+		if err := d.Dispatch(context.Background(), conn, hdr, []byte("x"), header.HeaderTcpCodec{}, cb); err != nil {
+			t.Fatalf("Dispatch %d: %v", i, err)
+		}
+	}
+	for _, want := range []uint32{2, 4} {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Fatalf("callback order: got %d want %d", got, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("callback %d never ran after an earlier callback panicked", want)
+		}
+	}
+	r := bytes.NewReader(conn.pipe.Bytes())
+	for want := uint32(1); want <= 4; want++ {
+		hdr, _, err := (header.HeaderTcpCodec{}).Decode(r)
+		if err != nil || hdr.GetMsgID() != want {
+			t.Fatalf("frame %d: hdr=%v err=%v", want, hdr, err)
+		}
+	}
+}
+
+func TestSendDispatcherSkipsTaskCancelledWhileQueued(t *testing.T) {
+	release := make(chan struct{})
+	d, err := NewSendDispatcher(SendOptions{})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	conn := &blockingSendConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &blockingPipe{release: release}}
+	hdr := &header.HeaderTcp{}
+	first := make(chan error, 1)
+	if err := d.Dispatch(context.Background(), conn, hdr, []byte("a"), header.HeaderTcpCodec{}, func(err error) { first <- err }); err != nil {
+		t.Fatalf("first Dispatch: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	second := make(chan error, 1)
+	if err := d.Dispatch(ctx, conn, hdr, []byte("b"), header.HeaderTcpCodec{}, func(err error) { second <- err }); err != nil {
+		t.Fatalf("second Dispatch: %v", err)
+	}
+	cancel()
+	close(release)
+	for i, want := range []error{nil, context.Canceled} {
+		select {
+		case err := <-[]chan error{first, second}[i]:
+			if !errors.Is(err, want) {
+				t.Fatalf("frame %d callback err=%v, want %v", i, err, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("frame %d callback never ran", i)
+		}
+	}
+}
+
+// deadlineStubPipe 记录写出时生效的写截止时间。
+type deadlineStubPipe struct {
+	sendStubPipe
+	current   time.Time
+	deadlines []time.Time
+}
+
+func (p *deadlineStubPipe) SetWriteDeadline(t time.Time) error { p.current = t; return nil }
+func (p *deadlineStubPipe) Write(b []byte) (int, error) {
+	p.deadlines = append(p.deadlines, p.current)
+	return p.sendStubPipe.Write(b)
+}
+
+type deadlineStubConn struct {
+	*prerouteStubConn
+	pipe *deadlineStubPipe
+}
+
+func (c *deadlineStubConn) Pipe() core.IPipe { return c.pipe }
+
+func TestConnWriterHonoursTaskContext(t *testing.T) {
+	conn := &deadlineStubConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &deadlineStubPipe{}}
+	w := &connWriter{conn: conn, encodeInWriter: true}
+	hdr := &header.HeaderTcp{}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := w.write(sendTask{ctx: cancelled, conn: conn, hdr: hdr, payload: []byte("x"), codec: header.HeaderTcpCodec{}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("write with cancelled ctx: err=%v, want context.Canceled", err)
+	}
+	if n := len(conn.pipe.Bytes()); n != 0 {
+		t.Fatalf("cancelled task wrote %d bytes", n)
+	}
+
+	deadline := time.Now().Add(time.Hour)
+	ctx, cancelDeadline := context.WithDeadline(context.Background(), deadline)
+	defer cancelDeadline()
+	if err := w.write(sendTask{ctx: ctx, conn: conn, hdr: hdr, payload: []byte("x"), codec: header.HeaderTcpCodec{}}); err != nil {
+		t.Fatalf("write with deadline: %v", err)
+	}
+	for _, got := range conn.pipe.deadlines {
+		if !got.Equal(deadline) {
+			t.Fatalf("write deadline=%v, want %v", got, deadline)
+		}
+	}
+	n := len(conn.pipe.deadlines)
+	if err := w.write(sendTask{ctx: context.Background(), conn: conn, hdr: hdr, payload: []byte("y"), codec: header.HeaderTcpCodec{}}); err != nil {
+		t.Fatalf("write without deadline: %v", err)
+	}
+	for _, got := range conn.pipe.deadlines[n:] {
+		if !got.IsZero() {
+			t.Fatalf("deadline %v leaked into a later write", got)
+		}
+	}
+}
+
+func TestSendDispatcherWriterSnapshotReportsQueuedTasks(t *testing.T) {
+	release := make(chan struct{})
+	d, err := NewSendDispatcher(SendOptions{ConnBuffer: 8})
+	if err != nil {
+		t.Fatalf("NewSendDispatcher: %v", err)
+	}
+	defer d.Shutdown()
+	if snap := d.WriterSnapshot(); len(snap) != 0 {
+		t.Fatalf("snapshot before any send = %v", snap)
+	}
+
+	want := map[string]int{"c1": 1, "c2": 3, "c3": 0}
+	for id, backlog := range want {
+		conn := &blockingSendConn{prerouteStubConn: newPrerouteStubConn(id), pipe: &blockingPipe{release: release}}
+		// 第一帧被 writer 取走并阻塞在写出上，其余留在队列里。
+		for i := 0; i <= backlog; i++ {
+			if err := d.Dispatch(context.Background(), conn, &header.HeaderTcp{}, []byte("x"), header.HeaderTcpCodec{}, nil); err != nil {
+				t.Fatalf("Dispatch %s: %v", id, err)
+			}
+		}
+	}
+	var snap map[string]int
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if snap = d.WriterSnapshot(); maps.Equal(snap, want) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !maps.Equal(snap, want) {
+		t.Fatalf("WriterSnapshot = %v, want %v", snap, want)
+	}
+
+	close(release)
+	d.CloseConn("c2")
+	snap = d.WriterSnapshot()
+	if _, ok := snap["c2"]; ok || len(snap) != 2 {
+		t.Fatalf("snapshot after CloseConn = %v", snap)
+	}
+}
+
+// timeoutStubPipe 模拟写截止时间在帧中间到期：只写出一部分即返回超时。
+type timeoutStubPipe struct{ deadlineStubPipe }
+
+func (p *timeoutStubPipe) Write(b []byte) (int, error) {
+	n, _ := p.deadlineStubPipe.Write(b[:len(b)/2])
+	return n, os.ErrDeadlineExceeded
+}
+
+type closeCountConn struct {
+	*prerouteStubConn
+	pipe   core.IPipe
+	closed int
+}
+
+func (c *closeCountConn) Pipe() core.IPipe { return c.pipe }
+func (c *closeCountConn) Close() error     { c.closed++; return nil }
+
+func TestConnWriterClosesConnOnWriteTimeout(t *testing.T) {
+	for _, coalesce := range []int{1, 4} {
+		conn := &closeCountConn{prerouteStubConn: newPrerouteStubConn("c1"), pipe: &timeoutStubPipe{}}
+		w := &connWriter{conn: conn, encodeInWriter: true, coalesceFrames: coalesce, coalesceBytes: 1 << 10}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+		task := sendTask{ctx: ctx, conn: conn, hdr: &header.HeaderTcp{}, payload: []byte("xy"), codec: header.HeaderTcpCodec{}}
+		if coalesce > 1 {
+			w.writeBatch([]sendTask{task, task})
+		} else if err := w.write(task); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("write err=%v, want deadline exceeded", err)
+		}
+		cancel()
+		if conn.closed != 1 || core.CloseReasonOf(conn) != core.CloseReasonWriteTimeout {
+			t.Fatalf("coalesce=%d: closed=%d reason=%s, want connection closed after a cut frame", coalesce, conn.closed, core.CloseReasonOf(conn))
+		}
+	}
+}
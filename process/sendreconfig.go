@@ -0,0 +1,142 @@
+package process
+
+// 本文件承载 Core 框架中与 `sendreconfig` 相关的通用逻辑。
+
+import (
+	"hash/fnv"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+)
+
+// sendShards 是一组分片队列及其消费协程；Reconfigure 以整组排空再替换的方式调整拓扑。
+type sendShards struct {
+	lanes     []*priorityLanes[sendTask]
+	stop      chan struct{} // 关闭后消费协程取完剩余任务即退出。
+	retireOne sync.Once
+	wg        sync.WaitGroup
+}
+
+func newSendShards(count, buffer int) *sendShards {
+	s := &sendShards{lanes: make([]*priorityLanes[sendTask], count), stop: make(chan struct{})}
+	for i := range s.lanes {
+		s.lanes[i] = newPriorityLanes[sendTask](buffer)
+	}
+	return s
+}
+
+// retire 幂等地通知消费协程排空后退出。
+func (s *sendShards) retire() { s.retireOne.Do(func() { close(s.stop) }) }
+
+// selectQueue 用连接 ID 做稳定分片，尽量让同一连接的 writer 查找命中同一 shard。
+func (s *sendShards) selectQueue(conn core.IConnection, hdr core.IHeader) int {
+	n := len(s.lanes)
+	if n == 1 {
+		return 0
+	}
+	if conn != nil {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(conn.ID()))
+		return int(h.Sum32() % uint32(n))
+	}
+	if hdr != nil {
+		return int(hdr.SubProto()) % n
+	}
+	return 0
+}
+
+// startShards 为每个分片启动消费协程，调用方需持有 topo 写锁。
+func (d *SendDispatcher) startShards(s *sendShards) {
+	// 每个分片只启动一个消费协程：多个消费者会让同一连接的帧在转交 writer 时乱序。
+	for _, q := range s.lanes {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			for {
+				task, ok := q.next(s.stop)
+				if !ok {
+					return
+				}
+				if task.conn == nil {
+					d.log.Warn("nil conn in send task")
+					continue
+				}
+				writer := d.getOrCreateWriter(task.conn)
+				if writer == nil {
+					task.finish(errWriterClosed, d.log)
+					continue
+				}
+				if err := writer.enqueue(task); err != nil {
+					task.finish(err, d.log)
+				}
+			}
+		}()
+	}
+}
+
+// SendTuning 是可在运行时调整的发送拓扑参数，<=0 的字段保持当前值。
+type SendTuning struct {
+	ChannelCount   int
+	WorkersPerChan int
+	ChannelBuffer  int
+	ConnBuffer     int // 变化时已有的单连接 writer 会先写完积压再按新长度重建。
+}
+
+// SendTuningFromConfig 读取 send.* 中可热更新的参数，供管理端 config set 后调用 Reconfigure。
+func SendTuningFromConfig(cfg core.IConfig) SendTuning {
+	return SendTuning{
+		ChannelCount:   readPositiveInt(cfg, coreconfig.KeySendChannelCount, 0),
+		WorkersPerChan: readPositiveInt(cfg, coreconfig.KeySendWorkersPerChan, 0),
+		ChannelBuffer:  readPositiveInt(cfg, coreconfig.KeySendChannelBuffer, 0),
+		ConnBuffer:     readPositiveInt(cfg, coreconfig.KeySendConnBuffer, 0),
+	}
+}
+
+// Reconfigure 在运行时调整分片数与队列长度而不丢弃在途发送：
+// 先阻止新的 Dispatch 入队，排空旧分片（已入队任务全部转交连接 writer），必要时排空并重建 writer，
+// 再换上新拓扑放行。排空期间 Dispatch 会阻塞，同一连接的帧顺序保持不变。
+func (d *SendDispatcher) Reconfigure(t SendTuning) error {
+	d.topo.Lock()
+	defer d.topo.Unlock()
+	if d.started && d.ctx.Err() != nil {
+		return errDispatcherClosed
+	}
+	old := d.shards
+	count, buffer := len(old.lanes), old.lanes[0].capacity()
+	if t.ChannelCount > 0 {
+		count = t.ChannelCount
+	}
+	if t.ChannelBuffer > 0 {
+		buffer = t.ChannelBuffer
+	}
+	if t.WorkersPerChan > 0 {
+		d.workersPerChan = t.WorkersPerChan
+	}
+	if d.started {
+		old.retire()
+		old.wg.Wait()
+	}
+
+	var stale []*connWriter
+	d.mu.Lock()
+	if t.ConnBuffer > 0 && t.ConnBuffer != d.connBuffer {
+		d.connBuffer = t.ConnBuffer
+		for id, w := range d.writers {
+			stale = append(stale, w)
+			delete(d.writers, id)
+		}
+	}
+	d.mu.Unlock()
+	// 旧分片已排空，此时只有这些 writer 持有待写任务；写完后再放行，新 writer 不会抢在旧帧之前。
+	for _, w := range stale {
+		w.stop()
+	}
+
+	d.shards = newSendShards(count, buffer)
+	if d.started {
+		d.startShards(d.shards)
+	}
+	d.log.Info("send dispatcher reconfigured", "channels", count, "buffer", buffer, "conn_buffer", d.connBuffer)
+	return nil
+}
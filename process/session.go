@@ -0,0 +1,39 @@
+package process
+
+// 本文件承载 Core 框架中与 `session` 相关的通用逻辑。
+
+import (
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// sessionExpiredMsg 是会话过期时回给客户端的错误说明，客户端据此重新登录。
+const sessionExpiredMsg = "session expired, please re-login"
+
+// rejectExpiredSession 惰性检查会话有效期：已过期的连接被降级为未登录（清除身份与路由索引），
+// 当前帧以 MajorErrResp 拒绝；返回 true 表示该帧已被拒绝。登录类 handler（AllowSourceMismatch）不受影响，以便重新登录。
+func (p *DispatcherProcess) rejectExpiredSession(evt dispatchEvent, handler core.ISubProcess, sub uint8) bool {
+	if handler.AllowSourceMismatch() || !core.SessionExpired(evt.conn, p.clock.Now()) {
+		return false
+	}
+	srv := core.ServerFromContext(evt.ctx)
+	var cm core.IConnectionManager
+	if srv != nil {
+		cm = srv.ConnManager()
+	}
+	nodeID, _ := core.ClearConnIdentity(cm, evt.conn)
+	evt.conn.SetMeta(core.MetaSessionExpiryKey, time.Time{})
+	p.log.Info("session expired", "conn", evt.conn.ID(), "node", nodeID)
+	if srv == nil || evt.hdr == nil || evt.hdr.Major() == header.MajorOKResp || evt.hdr.Major() == header.MajorErrResp {
+		return true
+	}
+	payload := []byte(sessionExpiredMsg)
+	resp := header.BuildTCPResponse(evt.hdr, uint32(len(payload)), sub)
+	resp.WithMajor(header.MajorErrResp).WithSourceID(srv.NodeID())
+	if err := srv.Send(evt.ctx, evt.conn.ID(), resp, payload); err != nil {
+		p.log.Debug("session expired response failed", "conn", evt.conn.ID(), "err", err)
+	}
+	return true
+}
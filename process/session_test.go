@@ -0,0 +1,86 @@
+package process
+
+// 本文件覆盖 Core 框架中与 `session` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// strictSubProcess 要求来源与连接绑定一致，统计收到的帧数。
+type strictSubProcess struct {
+	sub   uint8
+	calls int
+}
+
+func (s *strictSubProcess) SubProto() uint8           { return s.sub }
+func (s *strictSubProcess) Init() bool                { return true }
+func (s *strictSubProcess) AcceptCmd() bool           { return false }
+func (s *strictSubProcess) AllowSourceMismatch() bool { return false }
+func (s *strictSubProcess) OnReceive(context.Context, core.IConnection, core.IHeader, []byte) {
+	s.calls++
+}
+
+// loginSubProcess 模拟登录类 handler：允许未登录来源。
+type loginSubProcess struct{ strictSubProcess }
+
+func (s *loginSubProcess) AllowSourceMismatch() bool { return true }
+
+func TestDispatcherRejectsExpiredSessionAndDemotes(t *testing.T) {
+	p, err := NewDispatcher(DispatchOptions{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	biz := &strictSubProcess{sub: 5}
+	login := &loginSubProcess{strictSubProcess{sub: 2}}
+	for _, h := range []core.ISubProcess{biz, login} {
+		if err := p.RegisterHandler(h); err != nil {
+			t.Fatalf("RegisterHandler: %v", err)
+		}
+	}
+	cm := connmgr.New()
+	srv := newPrerouteStubServer(1, cm)
+	conn := newPrerouteStubConn("c1")
+	_ = cm.Add(conn)
+	core.SetConnNodeID(conn, 11)
+	cm.UpdateNodeIndex(11, conn)
+	ctx := core.WithServerContext(context.Background(), srv)
+	frame := func(sub uint8) dispatchEvent {
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(sub).WithSourceID(11).WithTargetID(1).WithMsgID(3)
+		return dispatchEvent{ctx: ctx, conn: conn, hdr: hdr}
+	}
+
+	core.StartSession(conn, time.Hour, time.Now())
+	p.route(frame(5))
+	if biz.calls != 1 || len(srv.sends) != 0 {
+		t.Fatalf("live session: calls=%d sends=%d, want 1/0", biz.calls, len(srv.sends))
+	}
+
+	core.StartSession(conn, time.Millisecond, time.Now().Add(-time.Second))
+	p.route(frame(5))
+	if biz.calls != 1 {
+		t.Fatal("frame from expired session reached the handler")
+	}
+	if len(srv.sends) != 1 || srv.sends[0].major != header.MajorErrResp || srv.sends[0].targetID != 11 {
+		t.Fatalf("expired session sends=%+v, want one MajorErrResp to node 11", srv.sends)
+	}
+	if core.ConnNodeID(conn) != 0 {
+		t.Fatal("expired connection still bound to its node")
+	}
+	if _, ok := cm.GetByNode(11); ok {
+		t.Fatal("expired node still routable")
+	}
+
+	// 降级后仍可走登录类 handler 重新登录。
+	p.route(frame(2))
+	if login.calls != 1 {
+		t.Fatalf("login handler calls=%d, want 1 after demotion", login.calls)
+	}
+}
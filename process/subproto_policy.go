@@ -0,0 +1,90 @@
+package process
+
+// 本文件承载 Core 框架中与 `subproto_policy` 相关的通用逻辑。
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SubProtoPolicy 是按子协议覆盖预路由转发行为的策略，未登记的子协议为 SubProtoPolicyDefault。
+type SubProtoPolicy uint8
+
+const (
+	SubProtoPolicyDefault     SubProtoPolicy = iota // 沿用全局转发开关
+	SubProtoPolicyForward                           // 忽略 routing.forward_* 开关，始终允许向下/向上转发
+	SubProtoPolicyLocalOnly                         // 从不离开本节点：远端目标丢弃，广播只在本地处理
+	SubProtoPolicyNoBroadcast                       // 丢弃广播，单播照常
+)
+
+// String 返回策略在配置中的名称。
+func (p SubProtoPolicy) String() string {
+	switch p {
+	case SubProtoPolicyDefault:
+		return "default"
+	case SubProtoPolicyForward:
+		return "forward"
+	case SubProtoPolicyLocalOnly:
+		return "local_only"
+	case SubProtoPolicyNoBroadcast:
+		return "no_broadcast"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseSubProtoPolicy 解析策略名称（大小写不敏感），未知名称返回 false。
+func ParseSubProtoPolicy(raw string) (SubProtoPolicy, bool) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "default":
+		return SubProtoPolicyDefault, true
+	case "forward":
+		return SubProtoPolicyForward, true
+	case "local_only":
+		return SubProtoPolicyLocalOnly, true
+	case "no_broadcast":
+		return SubProtoPolicyNoBroadcast, true
+	default:
+		return SubProtoPolicyDefault, false
+	}
+}
+
+// parseSubProtoPolicies 解析 "子协议:策略;子协议:策略"，非法条目忽略。
+func parseSubProtoPolicies(raw string) map[uint8]SubProtoPolicy {
+	out := make(map[uint8]SubProtoPolicy)
+	for _, item := range strings.Split(raw, ";") {
+		sub, name, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			continue
+		}
+		s, err := strconv.ParseUint(strings.TrimSpace(sub), 10, 8)
+		if err != nil {
+			continue
+		}
+		policy, ok := ParseSubProtoPolicy(name)
+		if !ok {
+			continue
+		}
+		out[uint8(s)] = policy
+	}
+	return out
+}
+
+// applySubProtoPolicy 按子协议策略改写 HeaderRouter 的判定；只影响广播与转发类判定，
+// 本地处理与逐跳处理（认证、Cmd）保持不变。
+func applySubProtoPolicy(policy SubProtoPolicy, d RouteDecision) RouteDecision {
+	switch policy {
+	case SubProtoPolicyLocalOnly:
+		switch d.Kind {
+		case RouteDecisionBroadcastChildren:
+			return RouteDecision{Kind: RouteDecisionLocalDispatch, Reason: "policy_local_only"}
+		case RouteDecisionFastForward, RouteDecisionDeviceForward:
+			return RouteDecision{Kind: RouteDecisionDrop, Reason: "policy_local_only_remote_target"}
+		}
+	case SubProtoPolicyNoBroadcast:
+		if d.Kind == RouteDecisionBroadcastChildren {
+			return RouteDecision{Kind: RouteDecisionDrop, Reason: "policy_no_broadcast"}
+		}
+	}
+	return d
+}
@@ -0,0 +1,115 @@
+// Package protoerr 定义跨子协议统一的错误回包格式与标准错误码。
+//
+// 线格式：错误回包为 Major=MajorErrResp 的帧，头部由 header.BuildTCPResponse 自请求头生成
+// （SubProto、MsgID、TraceID 与请求一致，源/目标对调），payload 为 UTF-8 JSON：
+//
+//	{"code":4040,"msg":"no handler for sub proto 42","trace_id":305419896,"detail":{"sub_proto":42}}
+//
+// code 必填；msg 为面向人的说明；trace_id 冗余携带请求的 TraceID，便于只保存 payload 的日志关联；
+// detail 为可选的机器可读补充信息。接收方应忽略未知字段，未知 code 按其百位归类（4xxx 请求方错误，5xxx 本端错误）。
+package protoerr
+
+// 本文件承载 Core 框架中与 `protoerr` 相关的通用逻辑。
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// 标准错误码。4xxx 表示请求方错误，5xxx 表示本端错误；子协议自定义码应避开这些值并经 RegisterCode 登记。
+const (
+	CodeBadPayload   = 4000 // payload 无法解析或字段非法
+	CodeUnregistered = 4001 // 连接尚未登录/注册
+	CodeForbidden    = 4003 // 无权执行该请求
+	CodeNoHandler    = 4040 // 本节点没有处理该子协议的 handler
+	CodeInternal     = 5000 // 本端内部错误
+)
+
+var (
+	codesMu sync.RWMutex
+	codes   = map[int]string{
+		CodeBadPayload:   "bad_payload",
+		CodeUnregistered: "unregistered",
+		CodeForbidden:    "forbidden",
+		CodeNoHandler:    "no_handler",
+		CodeInternal:     "internal",
+	}
+)
+
+// RegisterCode 登记自定义错误码的名称，code 已登记时返回 false 且不覆盖。
+func RegisterCode(code int, name string) bool {
+	codesMu.Lock()
+	defer codesMu.Unlock()
+	if _, ok := codes[code]; ok {
+		return false
+	}
+	codes[code] = name
+	return true
+}
+
+// CodeName 返回已登记错误码的名称，未登记时返回 "code_<n>"。
+func CodeName(code int) string {
+	codesMu.RLock()
+	name, ok := codes[code]
+	codesMu.RUnlock()
+	if ok {
+		return name
+	}
+	return fmt.Sprintf("code_%d", code)
+}
+
+// Error 是错误回包的 payload，同时实现 error 便于在调用链中传递。
+type Error struct {
+	Code    int            `json:"code"`
+	Msg     string         `json:"msg,omitempty"`
+	TraceID uint32         `json:"trace_id,omitempty"`
+	Detail  map[string]any `json:"detail,omitempty"`
+}
+
+// Error 返回 "<code 名称>(<code>): <msg>"。
+func (e Error) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("%s(%d)", CodeName(e.Code), e.Code)
+	}
+	return fmt.Sprintf("%s(%d): %s", CodeName(e.Code), e.Code, e.Msg)
+}
+
+// Encode 把 e 编码为错误回包 payload。
+func Encode(e Error) ([]byte, error) { return json.Marshal(e) }
+
+// Decode 解析错误回包 payload；缺少 code 时返回错误。
+func Decode(payload []byte) (Error, error) {
+	var e Error
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return Error{}, fmt.Errorf("protoerr: decode: %w", err)
+	}
+	if e.Code == 0 {
+		return Error{}, fmt.Errorf("protoerr: missing code")
+	}
+	return e, nil
+}
+
+// BuildErrFrame 构造对 req 的错误回包（Major=MajorErrResp，TraceID 取自 req）。
+// 回包的 SourceID 为 req 的 TargetID，由本节点发出时调用方应改写为本地节点 ID。
+func BuildErrFrame(req core.IHeader, code int, msg string) (*header.HeaderTcp, []byte) {
+	return BuildErrFrameWith(req, Error{Code: code, Msg: msg})
+}
+
+// BuildErrFrameWith 与 BuildErrFrame 相同，但可携带 Detail；e.TraceID 为 0 时取 req 的 TraceID。
+func BuildErrFrameWith(req core.IHeader, e Error) (*header.HeaderTcp, []byte) {
+	if e.TraceID == 0 {
+		e.TraceID = req.GetTraceID()
+	}
+	// Detail 中不可编码的值退化为仅含 code/msg 的回包，保证总能回错。
+	payload, err := Encode(e)
+	if err != nil {
+		payload, _ = Encode(Error{Code: e.Code, Msg: e.Msg, TraceID: e.TraceID})
+	}
+	resp := header.BuildTCPResponse(req, uint32(len(payload)), req.SubProto())
+	resp.WithMajor(header.MajorErrResp)
+	return resp, payload
+}
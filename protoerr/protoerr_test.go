@@ -0,0 +1,66 @@
+package protoerr
+
+// 本文件覆盖 Core 框架中与 `protoerr` 相关的行为。
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func TestBuildErrFrameWireFormat(t *testing.T) {
+	req := (&header.HeaderTcp{}).WithExpectResponse(true).WithMajor(header.MajorCmd).WithSubProto(42).
+		WithSourceID(11).WithTargetID(7).WithMsgID(5).WithTraceID(0x12345678)
+	resp, payload := BuildErrFrameWith(req, Error{Code: CodeNoHandler, Msg: "no handler for sub proto 42", Detail: map[string]any{"sub_proto": 42}})
+
+	const want = `{"code":4040,"msg":"no handler for sub proto 42","trace_id":305419896,"detail":{"sub_proto":42}}`
+	if string(payload) != want {
+		t.Fatalf("payload=%s\nwant    %s", payload, want)
+	}
+	if resp.Major() != header.MajorErrResp || resp.SubProto() != 42 || resp.GetMsgID() != 5 || resp.GetTraceID() != 0x12345678 ||
+		resp.SourceID() != 7 || resp.TargetID() != 11 || resp.PayloadLength() != uint32(len(payload)) || resp.WantsResponse() {
+		t.Fatalf("response header=%+v", resp)
+	}
+
+	raw, err := header.HeaderTcpCodec{}.Encode(resp, payload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	_, body, err := header.HeaderTcpCodec{}.Decode(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("decode frame: %v", err)
+	}
+	got, err := Decode(body)
+	if err != nil || got.Code != CodeNoHandler || got.TraceID != 0x12345678 || got.Detail["sub_proto"] != float64(42) {
+		t.Fatalf("Decode=%+v err=%v", got, err)
+	}
+	if got.Error() != "no_handler(4040): no handler for sub proto 42" {
+		t.Fatalf("Error()=%q", got.Error())
+	}
+}
+
+func TestBuildErrFrameOmitsEmptyFields(t *testing.T) {
+	_, payload := BuildErrFrame(&header.HeaderTcp{}, CodeForbidden, "")
+	if string(payload) != `{"code":4003}` {
+		t.Fatalf("payload=%s, want {\"code\":4003}", payload)
+	}
+	if _, err := Decode([]byte(`{"msg":"x"}`)); err == nil {
+		t.Fatal("payload without code accepted")
+	}
+	if _, err := Decode([]byte(`not json`)); err == nil {
+		t.Fatal("non-JSON payload accepted")
+	}
+}
+
+func TestRegisterCode(t *testing.T) {
+	if RegisterCode(CodeInternal, "other") || CodeName(CodeInternal) != "internal" {
+		t.Fatal("standard code overwritten")
+	}
+	if !RegisterCode(4601, "quota_exceeded") || CodeName(4601) != "quota_exceeded" {
+		t.Fatal("custom code not registered")
+	}
+	if CodeName(4999) != "code_4999" {
+		t.Fatalf("CodeName(unregistered)=%q", CodeName(4999))
+	}
+}
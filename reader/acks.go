@@ -0,0 +1,54 @@
+package reader
+
+// 本文件承载 Core 框架中与 `acks` 相关的通用逻辑。
+
+import "sync"
+
+type ackKey struct {
+	conn  string
+	msgID uint32
+}
+
+// AckWaiters 登记等待控制回执（header.IsControlAck）的发送方；读取循环收到回执时按
+// （连接 ID, MsgID）唤醒对应等待者。可在多条连接的读取循环间共享，并发安全。
+type AckWaiters struct {
+	mu      sync.Mutex
+	waiters map[ackKey]chan struct{}
+}
+
+// NewAckWaiters 创建空的回执等待表。
+func NewAckWaiters() *AckWaiters {
+	return &AckWaiters{waiters: make(map[ackKey]chan struct{})}
+}
+
+// Wait 登记对 connID 上 msgID 回执的等待，返回在回执到达时关闭的通道；
+// 调用方不再等待时必须调用 cancel。同一键重复登记会替换前一个等待者。
+func (w *AckWaiters) Wait(connID string, msgID uint32) (<-chan struct{}, func()) {
+	k := ackKey{conn: connID, msgID: msgID}
+	ch := make(chan struct{})
+	w.mu.Lock()
+	w.waiters[k] = ch
+	w.mu.Unlock()
+	return ch, func() {
+		w.mu.Lock()
+		if w.waiters[k] == ch {
+			delete(w.waiters, k)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// Deliver 唤醒等待 connID 上 msgID 回执的等待者；没有等待者时返回 false。
+func (w *AckWaiters) Deliver(connID string, msgID uint32) bool {
+	k := ackKey{conn: connID, msgID: msgID}
+	w.mu.Lock()
+	ch, ok := w.waiters[k]
+	if ok {
+		delete(w.waiters, k)
+	}
+	w.mu.Unlock()
+	if ok {
+		close(ch)
+	}
+	return ok
+}
@@ -0,0 +1,49 @@
+package reader
+
+// 本文件承载 Core 框架中与 `errors` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// FrameErrorKind 是 ReadLoop 退出错误的分类，供指标统计与“是否拉黑对端”等决策使用。
+type FrameErrorKind string
+
+const (
+	FrameErrNone     FrameErrorKind = ""
+	FrameErrEOF      FrameErrorKind = "eof"      // 对端在帧边界正常关闭
+	FrameErrClosed   FrameErrorKind = "closed"   // 本端已关闭连接
+	FrameErrCanceled FrameErrorKind = "canceled" // 读取循环的 ctx 结束
+	FrameErrTimeout  FrameErrorKind = "timeout"  // 空闲超时或慢帧超时
+	FrameErrProtocol FrameErrorKind = "protocol" // 帧不合法：魔数、版本、头长度或 payload 超限
+	FrameErrIO       FrameErrorKind = "io"       // 其他读取失败，包括帧中途截断
+)
+
+// ClassifyFrameErr 把 ReadLoop 返回的错误归类。ReadLoop 原样返回解码错误，
+// 因此调用方也可以直接对 header.ErrHeaderMagicMismatch、io.EOF 等使用 errors.Is。
+func ClassifyFrameErr(err error) FrameErrorKind {
+	switch {
+	case err == nil:
+		return FrameErrNone
+	case errors.Is(err, io.EOF):
+		return FrameErrEOF
+	case errors.Is(err, net.ErrClosed):
+		return FrameErrClosed
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return FrameErrCanceled
+	case errors.Is(err, ErrReadIdleTimeout), errors.Is(err, ErrFrameTimeout), errors.Is(err, os.ErrDeadlineExceeded):
+		return FrameErrTimeout
+	}
+	switch header.ClassifyCodecErr(err) {
+	case header.CodecErrMagic, header.CodecErrVersion, header.CodecErrLen, header.CodecErrPayloadTooLarge:
+		return FrameErrProtocol
+	default:
+		return FrameErrIO
+	}
+}
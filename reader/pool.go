@@ -0,0 +1,97 @@
+package reader
+
+// 本文件承载 Core 框架中与 `pool` 相关的通用逻辑。
+
+import (
+	"bufio"
+	"io"
+	"sync"
+)
+
+const (
+	// DefaultBufferSize 为读取循环默认的 bufio 缓冲大小。
+	DefaultBufferSize = 4096
+
+	minPooledPayload = 64
+	maxPooledPayload = 64 * 1024
+)
+
+// bufReaderPools 按缓冲大小分池复用 bufio.Reader，避免每条连接各自长期占用缓冲。
+var bufReaderPools sync.Map // size -> *sync.Pool
+
+// acquireBufReader 从池中取出一个绑定到 src 的 bufio.Reader。
+func acquireBufReader(src io.Reader, size int) *bufio.Reader {
+	p, _ := bufReaderPools.LoadOrStore(size, &sync.Pool{})
+	pool := p.(*sync.Pool)
+	if br, ok := pool.Get().(*bufio.Reader); ok {
+		br.Reset(src)
+		return br
+	}
+	return bufio.NewReaderSize(src, size)
+}
+
+// releaseBufReader 解绑底层 reader 后放回池中；未读完的缓冲字节随之丢弃。
+func releaseBufReader(br *bufio.Reader, size int) {
+	if br == nil {
+		return
+	}
+	br.Reset(nil)
+	if p, ok := bufReaderPools.Load(size); ok {
+		p.(*sync.Pool).Put(br)
+	}
+}
+
+// payloadPool 按 2 的幂分级复用 payload 缓冲；超出 maxPooledPayload 的直接分配、不回收。
+type payloadPool struct {
+	classes []sync.Pool
+}
+
+func newPayloadPool() *payloadPool {
+	n := 0
+	for sz := minPooledPayload; sz <= maxPooledPayload; sz <<= 1 {
+		n++
+	}
+	return &payloadPool{classes: make([]sync.Pool, n)}
+}
+
+// classOf 返回能容纳 n 字节的最小分级下标，超出范围返回 -1。
+func classOf(n int) int {
+	idx := 0
+	for sz := minPooledPayload; sz <= maxPooledPayload; sz <<= 1 {
+		if n <= sz {
+			return idx
+		}
+		idx++
+	}
+	return -1
+}
+
+// get 返回长度为 n 的缓冲及其回收句柄；超出分级范围时句柄为 nil（不回收）。
+// 句柄以 *[]byte 形式在池中流转，避免每次归还都产生一次切片头分配。
+func (p *payloadPool) get(n int) ([]byte, *[]byte) {
+	idx := classOf(n)
+	if idx < 0 {
+		return make([]byte, n), nil
+	}
+	if bp, ok := p.classes[idx].Get().(*[]byte); ok {
+		return (*bp)[:n], bp
+	}
+	b := make([]byte, minPooledPayload<<idx)
+	return b[:n], &b
+}
+
+// put 通过句柄归还缓冲。
+func (p *payloadPool) put(bp *[]byte) {
+	if bp == nil {
+		return
+	}
+	idx := classOf(cap(*bp))
+	if idx < 0 || cap(*bp) != minPooledPayload<<idx {
+		return
+	}
+	*bp = (*bp)[:cap(*bp)]
+	p.classes[idx].Put(bp)
+}
+
+// sharedPayloadPool 由所有启用 PayloadPool 的读取循环共享。
+var sharedPayloadPool = newPayloadPool()
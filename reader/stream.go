@@ -0,0 +1,116 @@
+package reader
+
+// 本文件承载 Core 框架中与 `stream` 相关的通用逻辑。
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// 流式接收：开启 Options.StreamReceive 后，读取循环先窥探下一帧的 Flags，带 header.FlagStreamed 的帧
+// 只解码头部，payload 以限长 io.Reader 交给连接的流式回调（core.IStreamReceiver），大 payload 因此
+// 不必整帧驻留内存。需要 codec 实现 core.IHeaderDecoder 且读取循环启用了缓冲（BufferSize>=0）。
+// 连接未注册流式回调时，流式帧退回整帧缓冲后经 DispatchReceive 常规交付（仍受 codec 的 MaxPayload 约束）。
+
+// streamReceiver 返回连接的流式接收能力；未开启或条件不满足时返回 nil。
+func (r *TCPReader) streamReceiver(conn core.IConnection, codec core.IHeaderCodec, br *bufio.Reader) (core.IStreamReceiver, core.IHeaderDecoder) {
+	if !r.streamReceive || br == nil {
+		return nil, nil
+	}
+	sr, ok := conn.(core.IStreamReceiver)
+	if !ok {
+		return nil, nil
+	}
+	dec, ok := codec.(core.IHeaderDecoder)
+	if !ok {
+		return nil, nil
+	}
+	return sr, dec
+}
+
+// readStreamed 处理下一帧为流式帧的情况；handled 为 false 表示该帧应走常规整帧解码。
+// 回调返回后 body 中未读完的部分会被丢弃，以保持帧对齐。
+func (r *TCPReader) readStreamed(conn core.IConnection, sr core.IStreamReceiver, dec core.IHeaderDecoder, br *bufio.Reader, scratch []byte, dl *deadlineReader) (handled bool, err error) {
+	peek, err := br.Peek(6)
+	if err != nil {
+		return false, nil // 由常规解码路径报告同一错误
+	}
+	if binary.BigEndian.Uint16(peek[0:2]) != header.HeaderTcpMagicV2 || peek[5]&header.FlagStreamed == 0 {
+		return false, nil
+	}
+	hdr, err := dec.DecodeHeader(br, scratch)
+	if err != nil {
+		return true, err
+	}
+	size := int64(hdr.PayloadLength())
+	body := &streamBody{r: io.LimitReader(br, size), dl: dl}
+	if dl != nil {
+		dl.streaming = true
+	}
+	if !sr.DispatchStream(hdr, body) {
+		return true, r.dispatchBuffered(conn, dec, hdr, body, size)
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return true, err
+	}
+	if body.n < size {
+		return true, io.ErrUnexpectedEOF
+	}
+	return true, nil
+}
+
+// dispatchBuffered 是未注册流式回调时的退路：把 body 整帧读入后走常规 DispatchReceive。
+// 流式帧在解码头部时不受 MaxPayload 约束，这里补上该上限，超限的帧丢弃（body 仍被读尽以保持帧对齐）。
+func (r *TCPReader) dispatchBuffered(conn core.IConnection, dec core.IHeaderDecoder, hdr core.IHeader, body *streamBody, size int64) error {
+	if c, ok := dec.(header.HeaderTcpCodec); ok && c.MaxPayload > 0 && size > int64(c.MaxPayload) {
+		r.logger.Warn("streamed frame dropped: no stream handler and payload exceeds max", "conn", conn.ID(), "len", size)
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			return err
+		}
+		if body.n < size {
+			return io.ErrUnexpectedEOF
+		}
+		return nil
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(body, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	conn.DispatchReceive(hdr, payload)
+	return nil
+}
+
+// streamBody 是交给流式回调的 payload 视图；每次读取前按空闲超时重新布防 deadline，
+// 因此处理器消费较慢不会被误判为对端空闲，大 payload 也不受单帧超时约束。
+type streamBody struct {
+	r  io.Reader
+	dl *deadlineReader
+	n  int64
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+	if b.dl != nil {
+		b.dl.armStream()
+	}
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	return n, err
+}
+
+// armStream 为流式 payload 的一次读取布防：只计空闲超时，且从本次读取开始计时。
+func (d *deadlineReader) armStream() {
+	var deadline time.Time
+	if d.idleTimeout > 0 {
+		deadline = time.Now().Add(d.idleTimeout)
+	}
+	_ = d.setter.SetReadDeadline(deadline)
+}
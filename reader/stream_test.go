@@ -0,0 +1,186 @@
+package reader
+
+// 本文件覆盖 Core 框架中与 `stream` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/process"
+)
+
+// streamStubConn 在 readerStubConn 基础上实现 core.IStreamReceiver。
+type streamStubConn struct {
+	readerStubConn
+	fn func(core.IHeader, io.Reader)
+}
+
+func (c *streamStubConn) OnReceiveStream(core.StreamReceiveHandler) {}
+func (c *streamStubConn) DispatchStream(h core.IHeader, body io.Reader) bool {
+	if c.fn == nil {
+		return false
+	}
+	c.fn(h, body)
+	return true
+}
+
+// patternReader 产出确定性的伪随机字节，不占用与总长度成比例的内存。
+type patternReader struct {
+	x uint32
+}
+
+func (p *patternReader) Read(b []byte) (int, error) {
+	for i := range b {
+		p.x = p.x*1664525 + 1013904223
+		b[i] = byte(p.x >> 24)
+	}
+	return len(b), nil
+}
+
+func runStreamLoop(t *testing.T, codec header.HeaderTcpCodec, fn func(core.IHeader, io.Reader)) (*streamStubConn, net.Conn, <-chan error) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close(); _ = server.Close() })
+	conn := &streamStubConn{readerStubConn: readerStubConn{pipe: server}, fn: fn}
+	r := NewTCPWithOptions(Options{StreamReceive: true, IdleTimeout: 5 * time.Second, FrameTimeout: 100 * time.Millisecond})
+	done := make(chan error, 1)
+	go func() { done <- r.ReadLoop(context.Background(), conn, codec) }()
+	return conn, client, done
+}
+
+func TestReadLoopStreamReceiveBoundedMemory(t *testing.T) {
+	const size = 64 << 20
+	codec := header.HeaderTcpCodec{MaxPayload: 1 << 20} // 远小于流式帧，整帧路径会拒绝
+
+	type result struct {
+		n   int64
+		sum uint32
+		err error
+	}
+	got := make(chan result, 1)
+	_, client, done := runStreamLoop(t, codec, func(h core.IHeader, body io.Reader) {
+		crc := crc32.NewIEEE()
+		n, err := io.Copy(crc, body)
+		got <- result{n: n, sum: crc.Sum32(), err: err}
+	})
+
+	want := crc32.NewIEEE()
+	_, _ = io.CopyN(want, &patternReader{x: 7}, size)
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2)
+	writeErr := make(chan error, 1)
+	go func() {
+		writeErr <- process.WriteStreamFrame(client, header.HeaderTcpCodec{}, h, &patternReader{x: 7}, size)
+	}()
+
+	var res result
+	select {
+	case res = <-got:
+	case <-time.After(30 * time.Second):
+		t.Fatal("stream handler not invoked")
+	}
+	if err := <-writeErr; err != nil {
+		t.Fatalf("WriteStreamFrame: %v", err)
+	}
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+
+	if res.err != nil || res.n != size {
+		t.Fatalf("stream read n=%d err=%v, want %d bytes", res.n, res.err, size)
+	}
+	if res.sum != want.Sum32() {
+		t.Fatal("streamed payload corrupted")
+	}
+	// 流经 64MiB，而整个过程中的分配总量应与 payload 大小无关。
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 8<<20 {
+		t.Fatalf("allocated %d bytes while streaming %d bytes", alloc, size)
+	}
+
+	_ = client.Close()
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadLoop err=%v, want EOF", err)
+	}
+}
+
+func TestReadLoopStreamReceiveDiscardsUnreadBody(t *testing.T) {
+	conn, client, done := runStreamLoop(t, header.HeaderTcpCodec{}, func(h core.IHeader, body io.Reader) {
+		_, _ = io.ReadFull(body, make([]byte, 10)) // 只读前 10 字节
+	})
+
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2)
+	go func() {
+		if err := process.WriteStreamFrame(client, header.HeaderTcpCodec{}, h, &patternReader{x: 1}, 1<<20); err != nil {
+			return
+		}
+		_, _ = client.Write(encodeFrame(t, 42, []byte("after")))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.frameCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn.mu.Lock()
+	frames := conn.frames
+	conn.mu.Unlock()
+	if len(frames) != 1 || frames[0].Header.GetMsgID() != 42 || string(frames[0].Payload) != "after" {
+		t.Fatalf("frame after partially consumed stream not decoded: %+v", frames)
+	}
+	_ = client.Close()
+	_ = waitLoop(t, done, 2*time.Second)
+}
+
+func TestReadLoopStreamReceiveTruncatedBody(t *testing.T) {
+	_, client, done := runStreamLoop(t, header.HeaderTcpCodec{}, func(h core.IHeader, body io.Reader) {
+		_, _ = io.Copy(io.Discard, body)
+	})
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2).WithFlags(header.FlagStreamed)
+	head, err := (header.HeaderTcpCodec{}).EncodeHeader(h, 1000)
+	if err != nil {
+		t.Fatalf("encode header: %v", err)
+	}
+	go func() {
+		_, _ = client.Write(head)
+		_, _ = client.Write(make([]byte, 100))
+		_ = client.Close()
+	}()
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("ReadLoop err=%v, want ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReadLoopStreamReceiveFallsBackWithoutHandler(t *testing.T) {
+	conn, client, done := runStreamLoop(t, header.HeaderTcpCodec{}, nil)
+
+	payload := make([]byte, 64<<10)
+	_, _ = io.ReadFull(&patternReader{x: 3}, payload)
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2).WithMsgID(7)
+	go func() {
+		_ = process.WriteStreamFrame(client, header.HeaderTcpCodec{}, h, &patternReader{x: 3}, int64(len(payload)))
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.frameCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	conn.mu.Lock()
+	frames := conn.frames
+	conn.mu.Unlock()
+	if len(frames) != 1 || frames[0].Header.GetMsgID() != 7 || string(frames[0].Payload) != string(payload) {
+		t.Fatalf("streamed frame without handler not dispatched buffered: %d frames", len(frames))
+	}
+	_ = client.Close()
+	_ = waitLoop(t, done, 2*time.Second)
+}
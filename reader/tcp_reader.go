@@ -3,31 +3,150 @@ package reader
 // 本文件承载 Core 框架中与 `tcp_reader` 相关的通用逻辑。
 
 import (
+	"bufio"
 	"context"
 	"errors"
+	"io"
 	"log/slog"
+	"os"
+	"strconv"
 	"sync"
+	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
 )
 
+var (
+	// ErrReadIdleTimeout 表示连接在 IdleTimeout 内没有任何入站字节。
+	ErrReadIdleTimeout = errors.New("read idle timeout")
+	// ErrFrameTimeout 表示单帧从首字节到 payload 完整的耗时超过 FrameTimeout（慢速成帧）。
+	ErrFrameTimeout = errors.New("frame read timeout")
+)
+
+// Options 配置 TCPReader 的缓冲与超时保护；超时零值表示不启用对应保护。
+//
+// 超时依赖 pipe 实现 core.IReadDeadlinePipe，不支持的承载会忽略这两项。
+//
+// Payload 所有权：默认每帧 payload 为独立分配，DispatchReceive 的消费者可以任意持有。
+// 开启 PayloadPool 后，payload 缓冲在 DispatchReceive 返回后即被回收复用，
+// 消费者若需在回调返回后继续使用（包括投递到异步队列），必须自行拷贝；
+// 无法保证这一点的部署可同时开启 CopyOnDispatch，由读取循环在分发前拷贝一份独立的 payload；
+// server.New 构建默认读取器时，处理器未声明 core.ISyncPayloadProcess 即自动开启。
+type Options struct {
+	Logger *slog.Logger
+	// IdleTimeout 两次入站字节之间允许的最长间隔；帧间与帧内都会按最近一次活动顺延。
+	IdleTimeout time.Duration
+	// FrameTimeout 单帧从首字节到 payload 读完的最长耗时，防止逐字节“慢速成帧”占住读取协程。
+	FrameTimeout time.Duration
+	// BufferSize 每条连接 bufio.Reader 的大小（取自共享池）；0 使用 DefaultBufferSize，<0 关闭缓冲。
+	BufferSize int
+	// PayloadPool 是否从共享池分配 payload 缓冲（见上方所有权说明）。
+	PayloadPool bool
+	// CopyOnDispatch 开启 PayloadPool 时在 DispatchReceive 前拷贝 payload，池化缓冲随即归还；
+	// 关闭（默认）即受信任的快速路径，消费者须在回调内用完 payload。未开启 PayloadPool 时无影响。
+	CopyOnDispatch bool
+	// StreamReceive 开启后带 header.FlagStreamed 的帧以 io.Reader 交给连接的流式回调（见 stream.go），
+	// 连接未实现 core.IStreamReceiver 或未注册流式回调时仍按常规整帧交付。
+	StreamReceive bool
+	// HeartbeatSubProto 非 0 时启用心跳：空闲超时先发一次 ping 并再等一个 IdleTimeout，期间仍无入站才断开；
+	// 收到同一子协议上的 ping 直接回 pong。心跳帧不会分发给连接。需 IdleTimeout>0 才会主动 ping。
+	HeartbeatSubProto uint8
+	// HeartbeatExtendsSession 开启后收到心跳 ping/pong 会为连接的登录会话续期（见 core.RefreshSession），默认不续期。
+	HeartbeatExtendsSession bool
+	// Acks 非 nil 时，收到与已登记等待者匹配的控制回执（header.IsControlAck）直接唤醒等待者而不分发。
+	Acks *AckWaiters
+	// LocalNodeID 返回本节点 ID；非 nil 时只有 TargetID 为 0 或本节点的控制请求在读取循环内直接回执，
+	// 发往其他节点的照常分发以便路由，避免 hub 代远端节点应答。nil 表示端点（不转发），全部直接回执。
+	LocalNodeID func() uint32
+}
+
 // TCPReader 保留历史名称，但底层已改为从任意 pipe 读取传输无关的帧。
 type TCPReader struct {
-	logger      *slog.Logger
-	frameReader core.IFrameReader
+	logger        *slog.Logger
+	frameReader   core.IFrameReader
+	idleTimeout   time.Duration
+	frameTimeout  time.Duration
+	bufferSize    int
+	payloadPool   bool
+	copyPayload   bool
+	streamReceive bool
+	heartbeat     uint8
+	hbExtends     bool
+	acks          *AckWaiters
+	localNodeID   func() uint32
 }
 
 // NewTCP 创建读取循环，并默认挂上通用的 StreamFrameReader。
 func NewTCP(logger *slog.Logger) *TCPReader {
-	if logger == nil {
-		logger = slog.Default()
+	return NewTCPWithOptions(Options{Logger: logger})
+}
+
+// NewTCPWithOptions 创建带读超时保护的读取循环。
+func NewTCPWithOptions(opts Options) *TCPReader {
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	if opts.IdleTimeout < 0 {
+		opts.IdleTimeout = 0
+	}
+	if opts.FrameTimeout < 0 {
+		opts.FrameTimeout = 0
+	}
+	if opts.BufferSize == 0 {
+		opts.BufferSize = DefaultBufferSize
 	}
 	return &TCPReader{
-		logger:      logger,
-		frameReader: NewStreamFrameReader(),
+		logger:        opts.Logger,
+		frameReader:   NewStreamFrameReader(),
+		idleTimeout:   opts.IdleTimeout,
+		frameTimeout:  opts.FrameTimeout,
+		bufferSize:    opts.BufferSize,
+		payloadPool:   opts.PayloadPool,
+		copyPayload:   opts.PayloadPool && opts.CopyOnDispatch,
+		streamReceive: opts.StreamReceive,
+		heartbeat:     opts.HeartbeatSubProto,
+		hbExtends:     opts.HeartbeatExtendsSession,
+		acks:          opts.Acks,
+		localNodeID:   opts.LocalNodeID,
 	}
 }
 
+// OptionsFromConfig 从配置读取 reader.* 相关键。
+func OptionsFromConfig(cfg core.IConfig, logger *slog.Logger) Options {
+	opts := Options{
+		Logger:       logger,
+		IdleTimeout:  readSeconds(cfg, coreconfig.KeyReaderReadTimeoutSec),
+		FrameTimeout: readSeconds(cfg, coreconfig.KeyReaderFrameTimeoutSec),
+	}
+	if cfg != nil {
+		if raw, ok := cfg.Get(coreconfig.KeyReaderBufferSize); ok {
+			if v, err := strconv.Atoi(raw); err == nil {
+				opts.BufferSize = v
+			}
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyReaderPayloadPool); ok {
+			opts.PayloadPool = core.ParseBool(raw, false)
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyReaderCopyOnDispatch); ok {
+			opts.CopyOnDispatch = core.ParseBool(raw, false)
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyReaderStreamReceive); ok {
+			opts.StreamReceive = core.ParseBool(raw, false)
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyReaderHeartbeatSubProto); ok {
+			if v, err := strconv.Atoi(raw); err == nil && v > 0 && v <= 63 {
+				opts.HeartbeatSubProto = uint8(v)
+			}
+		}
+		if raw, ok := cfg.Get(coreconfig.KeyAuthSessionHeartbeatExtends); ok {
+			opts.HeartbeatExtendsSession = core.ParseBool(raw, false)
+		}
+	}
+	return opts
+}
+
 // ReadLoop 持续从连接 pipe 读取帧并回调连接分发，ctx 取消时会主动关闭 pipe 以打断阻塞读取。
 func (r *TCPReader) ReadLoop(ctx context.Context, conn core.IConnection, codec core.IHeaderCodec) error {
 	pipe := conn.Pipe()
@@ -41,6 +160,21 @@ func (r *TCPReader) ReadLoop(ctx context.Context, conn core.IConnection, codec c
 			closeOnce.Do(func() { _ = pipe.Close() })
 		}
 	}()
+
+	var src io.Reader = pipe
+	dl := r.wrapDeadline(pipe)
+	if dl != nil {
+		src = dl
+	}
+	var br *bufio.Reader
+	if r.bufferSize > 0 {
+		br = acquireBufReader(src, r.bufferSize)
+		defer releaseBufReader(br, r.bufferSize)
+		src = br
+	}
+	fd := r.newFrameDecoder(codec)
+	sr, hdec := r.streamReceiver(conn, codec, br)
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -48,10 +182,274 @@ func (r *TCPReader) ReadLoop(ctx context.Context, conn core.IConnection, codec c
 			return ctx.Err()
 		default:
 		}
-		frame, err := r.frameReader.ReadFrame(pipe, codec)
+		if dl != nil {
+			dl.beginFrame()
+		}
+		var (
+			frame core.Frame
+			err   error
+		)
+		streamed := false
+		if sr != nil {
+			streamed, err = r.readStreamed(conn, sr, hdec, br, fd.scratchBuf(), dl)
+		}
+		if !streamed {
+			frame, err = fd.read(src)
+		}
 		if err != nil {
+			if dl != nil {
+				err = dl.classify(err)
+				if errors.Is(err, errDeadlineRetry) {
+					continue
+				}
+				if errors.Is(err, ErrReadIdleTimeout) && r.ping(conn, codec, dl) {
+					continue
+				}
+			}
 			return err
 		}
-		conn.DispatchReceive(frame.Header, frame.Payload)
+		if streamed {
+			continue
+		}
+		if r.copyPayload {
+			frame.Payload = append([]byte(nil), frame.Payload...)
+			fd.release()
+		}
+		if !r.handleControl(conn, codec, frame.Header) && !r.handleHeartbeat(conn, codec, frame) {
+			conn.DispatchReceive(frame.Header, frame.Payload)
+		}
+		fd.release()
+	}
+}
+
+// ping 在空闲超时时发送一次心跳，成功则为对端再留一个 IdleTimeout；自上次入站以来已 ping 过则返回 false。
+func (r *TCPReader) ping(conn core.IConnection, codec core.IHeaderCodec, dl *deadlineReader) bool {
+	if r.heartbeat == 0 || dl.pinged || dl.streaming {
+		return false
+	}
+	hdr, payload := header.NewPingFrame(r.heartbeat)
+	if err := conn.SendWithHeader(hdr, payload, codec); err != nil {
+		r.logger.Debug("heartbeat ping failed", "conn", conn.ID(), "err", err)
+		return false
+	}
+	dl.pinged = true
+	dl.lastActivity = time.Now()
+	return true
+}
+
+// handleControl 是控制帧的快速路径：发给本节点的控制请求直接回 ack，命中等待者的 ack 直接唤醒；
+// 返回 true 表示该帧不再分发。其余控制帧（如 bye）仍交给连接分发。
+func (r *TCPReader) handleControl(conn core.IConnection, codec core.IHeaderCodec, hdr core.IHeader) bool {
+	switch {
+	case !header.IsControl(hdr):
+		return false
+	case header.IsControlRequest(hdr):
+		if !r.controlForLocal(hdr) {
+			return false
+		}
+		if err := conn.SendWithHeader(header.NewControlAck(hdr), nil, codec); err != nil {
+			r.logger.Debug("control ack failed", "conn", conn.ID(), "err", err)
+		}
+		return true
+	case header.IsControlAck(hdr):
+		return r.acks != nil && r.acks.Deliver(conn.ID(), hdr.GetMsgID())
+	default:
+		return false
+	}
+}
+
+// controlForLocal 判断控制请求是否由本节点应答：逐跳（TargetID=0）或目标为本节点。
+func (r *TCPReader) controlForLocal(hdr core.IHeader) bool {
+	if r.localNodeID == nil {
+		return true
+	}
+	t := hdr.TargetID()
+	return t == 0 || t == r.localNodeID()
+}
+
+// handleHeartbeat 消化心跳帧：ping 回 pong，pong 记入连接元数据（见 header.LastPong）；返回 true 表示该帧不再分发。
+func (r *TCPReader) handleHeartbeat(conn core.IConnection, codec core.IHeaderCodec, frame core.Frame) bool {
+	if r.heartbeat == 0 {
+		return false
+	}
+	ping, ok := header.ParseHeartbeat(frame.Header, frame.Payload, r.heartbeat)
+	if !ok {
+		return false
+	}
+	if r.hbExtends {
+		core.RefreshSession(conn, time.Now())
+	}
+	if !ping {
+		header.MarkPong(conn)
+		return true
+	}
+	hdr, payload := header.NewPongFrame(r.heartbeat)
+	if err := conn.SendWithHeader(hdr, payload, codec); err != nil {
+		r.logger.Debug("heartbeat pong failed", "conn", conn.ID(), "err", err)
+	}
+	return true
+}
+
+// frameDecoder 持有单条读取循环复用的头部暂存区与 payload 回收句柄。
+type frameDecoder struct {
+	codec       core.IHeaderCodec
+	pooled      core.IPooledFrameDecoder
+	frameReader core.IFrameReader
+	scratch     []byte
+	alloc       func(n int) []byte
+	held        *[]byte
+}
+
+// newFrameDecoder 在 codec 支持 IPooledFrameDecoder 时复用缓冲，否则退回通用 IFrameReader。
+func (r *TCPReader) newFrameDecoder(codec core.IHeaderCodec) *frameDecoder {
+	fd := &frameDecoder{codec: codec, frameReader: r.frameReader}
+	if pooled, ok := codec.(core.IPooledFrameDecoder); ok {
+		fd.pooled = pooled
+		fd.scratch = make([]byte, 255)
+		if r.payloadPool {
+			fd.alloc = func(n int) []byte {
+				b, h := sharedPayloadPool.get(n)
+				fd.held = h
+				return b
+			}
+		}
+	}
+	return fd
+}
+
+// read 解出一帧；开启 payload 池时，缓冲在下一次 release 前保持有效。
+func (fd *frameDecoder) read(src io.Reader) (core.Frame, error) {
+	if fd.pooled == nil {
+		return fd.frameReader.ReadFrame(src, fd.codec)
+	}
+	hdr, payload, err := fd.pooled.DecodeWith(src, fd.scratch, fd.alloc)
+	if err != nil {
+		fd.release()
+		return core.Frame{}, err
+	}
+	return core.Frame{Header: hdr, Payload: payload}, nil
+}
+
+// scratchBuf 返回头部暂存区，供流式接收只解码帧头时复用。
+func (fd *frameDecoder) scratchBuf() []byte {
+	if fd.scratch == nil {
+		fd.scratch = make([]byte, 255)
+	}
+	return fd.scratch
+}
+
+// release 归还上一帧的 payload 缓冲（未启用池时为空操作）。
+func (fd *frameDecoder) release() {
+	if fd.held != nil {
+		sharedPayloadPool.put(fd.held)
+		fd.held = nil
+	}
+}
+
+// wrapDeadline 在启用超时且 pipe 支持读超时时返回带 deadline 管理的读取器，否则返回 nil。
+func (r *TCPReader) wrapDeadline(pipe core.IPipe) *deadlineReader {
+	if r.idleTimeout <= 0 && r.frameTimeout <= 0 {
+		return nil
+	}
+	dl, ok := pipe.(core.IReadDeadlinePipe)
+	if !ok {
+		r.logger.Debug("pipe has no read deadline support, timeouts disabled")
+		return nil
+	}
+	return &deadlineReader{
+		pipe:         pipe,
+		setter:       dl,
+		idleTimeout:  r.idleTimeout,
+		frameTimeout: r.frameTimeout,
+		lastActivity: time.Now(),
+	}
+}
+
+// errDeadlineRetry 表示帧间等待触发了 deadline 但连接近期仍有活动，读取循环应重新布防后继续。
+var errDeadlineRetry = errors.New("deadline retry")
+
+// classify 把 deadline 触发的超时归类为空闲或慢帧错误，其他错误原样返回。
+func (d *deadlineReader) classify(err error) error {
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		return err
+	}
+	if d.streaming {
+		return ErrReadIdleTimeout
+	}
+	if d.started {
+		// 半帧已被消费，流已无法对齐，只能终止。
+		return ErrFrameTimeout
+	}
+	if d.idleTimeout > 0 && time.Since(d.lastActivity) < d.idleTimeout {
+		return errDeadlineRetry
+	}
+	return ErrReadIdleTimeout
+}
+
+// deadlineReader 包装 pipe，在每次读取前按“空闲顺延 + 单帧上限”计算 deadline。
+type deadlineReader struct {
+	pipe         io.Reader
+	setter       core.IReadDeadlinePipe
+	idleTimeout  time.Duration
+	frameTimeout time.Duration
+
+	lastActivity time.Time
+	frameStart   time.Time
+	started      bool
+	pinged       bool // 自上次入站以来是否已发过心跳
+	streaming    bool // 正在消费流式 payload：超时一律视为空闲超时
+}
+
+// beginFrame 重置单帧状态，并布防帧间空闲 deadline。
+func (d *deadlineReader) beginFrame() {
+	d.started = false
+	d.streaming = false
+	d.frameStart = time.Time{}
+	d.arm()
+}
+
+// arm 取空闲 deadline 与单帧 deadline 中较早者下发给 pipe。
+func (d *deadlineReader) arm() {
+	var deadline time.Time
+	if d.idleTimeout > 0 {
+		deadline = d.lastActivity.Add(d.idleTimeout)
+	}
+	if d.started && d.frameTimeout > 0 && !d.streaming {
+		frameDeadline := d.frameStart.Add(d.frameTimeout)
+		if deadline.IsZero() || frameDeadline.Before(deadline) {
+			deadline = frameDeadline
+		}
+	}
+	_ = d.setter.SetReadDeadline(deadline)
+}
+
+// Read 记录活动时间；首个字节到达即开始计算单帧耗时。
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	n, err := d.pipe.Read(p)
+	if n > 0 {
+		now := time.Now()
+		d.lastActivity = now
+		d.pinged = false
+		if !d.started {
+			d.started = true
+			d.frameStart = now
+		}
+		if err == nil {
+			d.arm()
+		}
+	}
+	return n, err
+}
+
+// readSeconds 把秒级配置解析为 time.Duration，非法或缺失返回 0（不启用）。
+func readSeconds(cfg core.IConfig, key string) time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	if raw, ok := cfg.Get(key); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			return time.Duration(v) * time.Second
+		}
 	}
+	return 0
 }
@@ -0,0 +1,478 @@
+package reader
+
+// 本文件覆盖 Core 框架中与 `tcp_reader` 相关的行为。
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+type readerStubConn struct {
+	pipe    core.IPipe
+	discard bool
+
+	mu     sync.Mutex
+	frames []core.Frame
+}
+
+func (c *readerStubConn) ID() string                    { return "stub" }
+func (c *readerStubConn) Pipe() core.IPipe              { return c.pipe }
+func (c *readerStubConn) Close() error                  { return c.pipe.Close() }
+func (c *readerStubConn) OnReceive(core.ReceiveHandler) {}
+func (c *readerStubConn) SetMeta(string, any)           {}
+func (c *readerStubConn) GetMeta(string) (any, bool)    { return nil, false }
+func (c *readerStubConn) Metadata() map[string]any      { return nil }
+func (c *readerStubConn) LocalAddr() net.Addr           { return nil }
+func (c *readerStubConn) RemoteAddr() net.Addr          { return nil }
+func (c *readerStubConn) Reader() core.IReader          { return nil }
+func (c *readerStubConn) SetReader(core.IReader)        {}
+func (c *readerStubConn) Send([]byte) error             { return nil }
+func (c *readerStubConn) SendWithHeader(core.IHeader, []byte, core.IHeaderCodec) error {
+	return nil
+}
+func (c *readerStubConn) DispatchReceive(h core.IHeader, payload []byte) {
+	if c.discard {
+		return
+	}
+	c.mu.Lock()
+	c.frames = append(c.frames, core.Frame{Header: h, Payload: payload})
+	c.mu.Unlock()
+}
+
+func (c *readerStubConn) frameCount() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.frames)
+}
+
+// runReadLoop 在后台启动 ReadLoop，返回服务端连接、客户端一端与结果通道。
+func runReadLoop(t *testing.T, opts Options) (*readerStubConn, net.Conn, <-chan error) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close(); _ = server.Close() })
+	conn := &readerStubConn{pipe: server}
+	r := NewTCPWithOptions(opts)
+	done := make(chan error, 1)
+	go func() { done <- r.ReadLoop(context.Background(), conn, header.HeaderTcpCodec{}) }()
+	return conn, client, done
+}
+
+func waitLoop(t *testing.T, done <-chan error, within time.Duration) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(within):
+		t.Fatalf("ReadLoop did not exit within %s", within)
+		return nil
+	}
+}
+
+func encodeFrame(t *testing.T, msgID uint32, payload []byte) []byte {
+	t.Helper()
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1).WithTargetID(2).WithMsgID(msgID)
+	frame, err := (header.HeaderTcpCodec{}).Encode(h, payload)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	return frame
+}
+
+func TestReadLoopIdleTimeout(t *testing.T) {
+	_, _, done := runReadLoop(t, Options{IdleTimeout: 50 * time.Millisecond})
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, ErrReadIdleTimeout) {
+		t.Fatalf("ReadLoop err=%v, want ErrReadIdleTimeout", err)
+	}
+}
+
+func TestReadLoopPartialHeaderStall(t *testing.T) {
+	_, client, done := runReadLoop(t, Options{IdleTimeout: 50 * time.Millisecond})
+	frame := encodeFrame(t, 1, []byte("abc"))
+	if _, err := client.Write(frame[:4]); err != nil {
+		t.Fatalf("write prefix: %v", err)
+	}
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, ErrFrameTimeout) {
+		t.Fatalf("ReadLoop err=%v, want ErrFrameTimeout", err)
+	}
+}
+
+func TestReadLoopSlowFrameBounded(t *testing.T) {
+	_, client, done := runReadLoop(t, Options{IdleTimeout: time.Second, FrameTimeout: 100 * time.Millisecond})
+	frame := encodeFrame(t, 1, []byte("slowloris"))
+	go func() {
+		for _, b := range frame {
+			if _, err := client.Write([]byte{b}); err != nil {
+				return
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, ErrFrameTimeout) {
+		t.Fatalf("ReadLoop err=%v, want ErrFrameTimeout", err)
+	}
+}
+
+func TestReadLoopDeliversFramesWithinTimeouts(t *testing.T) {
+	conn, client, done := runReadLoop(t, Options{IdleTimeout: 200 * time.Millisecond, FrameTimeout: 200 * time.Millisecond})
+	for i := 1; i <= 3; i++ {
+		if _, err := client.Write(encodeFrame(t, uint32(i), []byte("ok"))); err != nil {
+			t.Fatalf("write frame %d: %v", i, err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, ErrReadIdleTimeout) {
+		t.Fatalf("ReadLoop err=%v, want ErrReadIdleTimeout after traffic stops", err)
+	}
+	if got := conn.frameCount(); got != 3 {
+		t.Fatalf("dispatched frames=%d, want 3", got)
+	}
+}
+
+func TestReadLoopPayloadPoolDeliversIntactFrames(t *testing.T) {
+	var stream []byte
+	for i := 1; i <= 20; i++ {
+		stream = append(stream, encodeFrame(t, uint32(i), bytes.Repeat([]byte{byte(i)}, 10*i))...)
+	}
+	got := make(map[uint32][]byte)
+	conn := &recvFuncConn{readerStubConn: readerStubConn{pipe: &bytesPipe{r: bytes.NewReader(stream)}}}
+	conn.fn = func(h core.IHeader, payload []byte) {
+		// 开启池后 payload 仅在回调内有效，保留需拷贝。
+		got[h.GetMsgID()] = append([]byte(nil), payload...)
+	}
+	r := NewTCPWithOptions(Options{BufferSize: 128, PayloadPool: true})
+	if err := r.ReadLoop(context.Background(), conn, header.HeaderTcpCodec{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadLoop err=%v, want EOF", err)
+	}
+	if len(got) != 20 {
+		t.Fatalf("frames=%d, want 20", len(got))
+	}
+	for i := 1; i <= 20; i++ {
+		if !bytes.Equal(got[uint32(i)], bytes.Repeat([]byte{byte(i)}, 10*i)) {
+			t.Fatalf("frame %d payload corrupted: %v", i, got[uint32(i)])
+		}
+	}
+}
+
+func TestReadLoopCopyOnDispatchAllowsRetainingPayload(t *testing.T) {
+	const n = 50
+	var stream []byte
+	for i := 1; i <= n; i++ {
+		stream = append(stream, encodeFrame(t, uint32(i), bytes.Repeat([]byte{byte(i)}, 32))...)
+	}
+	type retained struct {
+		id      uint32
+		payload []byte
+	}
+	// 消费者不拷贝，直接把 payload 交给另一个 goroutine 稍后读取；
+	// 若读取循环复用了该缓冲，-race 会报告数据竞争，内容校验也会失败。
+	queue := make(chan retained, n)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var corrupted []uint32
+	go func() {
+		defer wg.Done()
+		for r := range queue {
+			time.Sleep(100 * time.Microsecond)
+			if !bytes.Equal(r.payload, bytes.Repeat([]byte{byte(r.id)}, 32)) {
+				corrupted = append(corrupted, r.id)
+			}
+		}
+	}()
+	conn := &recvFuncConn{readerStubConn: readerStubConn{pipe: &bytesPipe{r: bytes.NewReader(stream)}}}
+	conn.fn = func(h core.IHeader, payload []byte) { queue <- retained{id: h.GetMsgID(), payload: payload} }
+	r := NewTCPWithOptions(Options{BufferSize: 64, PayloadPool: true, CopyOnDispatch: true})
+	if err := r.ReadLoop(context.Background(), conn, header.HeaderTcpCodec{}); !errors.Is(err, io.EOF) {
+		t.Fatalf("ReadLoop err=%v, want EOF", err)
+	}
+	close(queue)
+	wg.Wait()
+	if len(corrupted) > 0 {
+		t.Fatalf("retained payloads corrupted: %v", corrupted)
+	}
+}
+
+// recvFuncConn 把 DispatchReceive 转交给自定义回调。
+type recvFuncConn struct {
+	readerStubConn
+	fn func(core.IHeader, []byte)
+}
+
+func (c *recvFuncConn) DispatchReceive(h core.IHeader, payload []byte) { c.fn(h, payload) }
+
+// bytesPipe 以内存字节流充当 pipe，读完返回 EOF。
+type bytesPipe struct {
+	r *bytes.Reader
+}
+
+func (p *bytesPipe) Read(b []byte) (int, error)  { return p.r.Read(b) }
+func (p *bytesPipe) Write(b []byte) (int, error) { return len(b), nil }
+func (p *bytesPipe) Close() error                { return nil }
+
+func benchmarkReadLoop(b *testing.B, opts Options) {
+	frame := encodeFrame(&testing.T{}, 1, bytes.Repeat([]byte{0xAB}, 64))
+	stream := bytes.Repeat(frame, b.N)
+	conn := &readerStubConn{pipe: &bytesPipe{r: bytes.NewReader(stream)}, discard: true}
+	r := NewTCPWithOptions(opts)
+	b.SetBytes(int64(len(frame)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := r.ReadLoop(context.Background(), conn, header.HeaderTcpCodec{}); !errors.Is(err, io.EOF) {
+		b.Fatalf("ReadLoop err=%v", err)
+	}
+}
+
+// BenchmarkReadLoop64B_Unbuffered 为基线：直接在 pipe 上逐段读取，每帧独立分配。
+func BenchmarkReadLoop64B_Unbuffered(b *testing.B) {
+	benchmarkReadLoop(b, Options{BufferSize: -1})
+}
+
+// BenchmarkReadLoop64B_Buffered 使用池化 bufio 与头部暂存区。
+func BenchmarkReadLoop64B_Buffered(b *testing.B) {
+	benchmarkReadLoop(b, Options{})
+}
+
+// BenchmarkReadLoop64B_BufferedPooled 进一步复用 payload 缓冲。
+func BenchmarkReadLoop64B_BufferedPooled(b *testing.B) {
+	benchmarkReadLoop(b, Options{PayloadPool: true})
+}
+
+// wireConn 在 readerStubConn 基础上把 SendWithHeader 真正写回 pipe，供心跳测试观察 ping/pong。
+type wireConn struct {
+	readerStubConn
+	wmu sync.Mutex
+}
+
+func (c *wireConn) SendWithHeader(h core.IHeader, payload []byte, codec core.IHeaderCodec) error {
+	frame, err := codec.Encode(h, payload)
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.pipe.Write(frame)
+	return err
+}
+
+func runHeartbeatLoop(t *testing.T, opts Options) (*wireConn, net.Conn, <-chan error) {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close(); _ = server.Close() })
+	conn := &wireConn{readerStubConn: readerStubConn{pipe: server}}
+	r := NewTCPWithOptions(opts)
+	done := make(chan error, 1)
+	go func() { done <- r.ReadLoop(context.Background(), conn, header.HeaderTcpCodec{}) }()
+	return conn, client, done
+}
+
+func TestReadLoopHeartbeatPingsThenClosesSilentPeer(t *testing.T) {
+	const idle = 60 * time.Millisecond
+	_, client, done := runHeartbeatLoop(t, Options{IdleTimeout: idle, HeartbeatSubProto: 9})
+	start := time.Now()
+
+	// 对端读到 ping 但从不应答。
+	hdr, payload, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil {
+		t.Fatalf("read ping: %v", err)
+	}
+	if ping, ok := header.ParseHeartbeat(hdr, payload, 9); !ok || !ping {
+		t.Fatalf("first frame is not a heartbeat ping: major=%d sub=%d payload=%q", hdr.Major(), hdr.SubProto(), payload)
+	}
+	if err := waitLoop(t, done, 2*time.Second); !errors.Is(err, ErrReadIdleTimeout) {
+		t.Fatalf("ReadLoop err=%v, want ErrReadIdleTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed < 2*idle-10*time.Millisecond {
+		t.Fatalf("loop exited after %s, want at least two idle intervals (%s)", elapsed, 2*idle)
+	}
+}
+
+func TestReadLoopHeartbeatPongKeepsConnectionAlive(t *testing.T) {
+	const idle = 40 * time.Millisecond
+	conn, client, done := runHeartbeatLoop(t, Options{IdleTimeout: idle, HeartbeatSubProto: 9})
+
+	// 对端对每个 ping 应答 pong，连接应存活远超单个空闲间隔。
+	go func() {
+		for {
+			hdr, payload, err := header.HeaderTcpCodec{}.Decode(client)
+			if err != nil {
+				return
+			}
+			if ping, ok := header.ParseHeartbeat(hdr, payload, 9); ok && ping {
+				h, p := header.NewPongFrame(9)
+				frame, _ := header.HeaderTcpCodec{}.Encode(h, p)
+				if _, err := client.Write(frame); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("ReadLoop exited early: %v", err)
+	case <-time.After(6 * idle):
+	}
+	if got := conn.frameCount(); got != 0 {
+		t.Fatalf("heartbeat frames dispatched=%d, want 0", got)
+	}
+	_ = client.Close()
+	if err := waitLoop(t, done, 2*time.Second); err == nil {
+		t.Fatalf("ReadLoop returned nil after peer closed")
+	}
+}
+
+func TestReadLoopAnswersPeerPing(t *testing.T) {
+	_, client, _ := runHeartbeatLoop(t, Options{HeartbeatSubProto: 9})
+	h, p := header.NewPingFrame(9)
+	frame, _ := header.HeaderTcpCodec{}.Encode(h, p)
+	go func() { _, _ = client.Write(frame) }()
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	hdr, payload, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil {
+		t.Fatalf("read pong: %v", err)
+	}
+	if ping, ok := header.ParseHeartbeat(hdr, payload, 9); !ok || ping {
+		t.Fatalf("reply is not a pong: payload=%q", payload)
+	}
+}
+
+// sessionWireConn 在 wireConn 之上保存元数据，用于观察会话续期。
+type sessionWireConn struct {
+	*wireConn
+	metaMu sync.Mutex
+	meta   map[string]any
+}
+
+func (c *sessionWireConn) SetMeta(k string, v any) { c.metaMu.Lock(); c.meta[k] = v; c.metaMu.Unlock() }
+func (c *sessionWireConn) GetMeta(k string) (any, bool) {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	v, ok := c.meta[k]
+	return v, ok
+}
+
+func TestReadLoopHeartbeatExtendsSessionOnlyWhenEnabled(t *testing.T) {
+	for _, extends := range []bool{false, true} {
+		server, client := net.Pipe()
+		conn := &sessionWireConn{wireConn: &wireConn{readerStubConn: readerStubConn{pipe: server}}, meta: map[string]any{}}
+		before := core.StartSession(conn, time.Hour, time.Now().Add(-30*time.Minute))
+		r := NewTCPWithOptions(Options{HeartbeatSubProto: 9, HeartbeatExtendsSession: extends})
+		go func() { _ = r.ReadLoop(context.Background(), conn, header.HeaderTcpCodec{}) }()
+
+		h, p := header.NewPingFrame(9)
+		frame, _ := header.HeaderTcpCodec{}.Encode(h, p)
+		go func() { _, _ = client.Write(frame) }()
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := (header.HeaderTcpCodec{}).Decode(client); err != nil {
+			t.Fatalf("read pong: %v", err)
+		}
+		after, _ := core.ConnSessionExpiry(conn)
+		if extended := after.After(before); extended != extends {
+			t.Fatalf("extends=%v: expiry moved from %v to %v", extends, before, after)
+		}
+		_ = client.Close()
+		_ = server.Close()
+	}
+}
+
+func TestReadLoopControlFastPath(t *testing.T) {
+	acks := NewAckWaiters()
+	conn, client, _ := runHeartbeatLoop(t, Options{Acks: acks})
+	codec := header.HeaderTcpCodec{}
+	write := func(h core.IHeader) {
+		frame, _ := codec.Encode(h, nil)
+		go func() { _, _ = client.Write(frame) }()
+	}
+
+	// 控制请求由读取循环直接回 ack，不进入分发。
+	write(header.NewControlFrame(6, header.FlagACKRequired).WithMsgID(5).WithSourceID(2).WithTargetID(1))
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	hdr, payload, err := codec.Decode(client)
+	if err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+	if !header.IsControlAck(hdr) || hdr.GetMsgID() != 5 || len(payload) != 0 {
+		t.Fatalf("reply is not a control ack for msg 5: hdr=%+v payload=%q", hdr, payload)
+	}
+
+	// 命中等待者的 ack 只唤醒等待者；无人等待的 ack 照常分发。
+	waitCh, cancel := acks.Wait(conn.ID(), 8)
+	defer cancel()
+	write(header.NewControlAck(header.NewControlFrame(6, header.FlagACKRequired).WithMsgID(8)))
+	select {
+	case <-waitCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ack did not satisfy waiter")
+	}
+	write(header.NewControlAck(header.NewControlFrame(6, header.FlagACKRequired).WithMsgID(9)))
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.frameCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("dispatched frames=%d, want only the unmatched ack", conn.frameCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestReadLoopControlRequestForRemoteNodeIsDispatched(t *testing.T) {
+	conn, client, _ := runHeartbeatLoop(t, Options{LocalNodeID: func() uint32 { return 1 }})
+	codec := header.HeaderTcpCodec{}
+	write := func(h core.IHeader) {
+		frame, _ := codec.Encode(h, nil)
+		go func() { _, _ = client.Write(frame) }()
+	}
+
+	// 发往节点 7 的控制请求交给分发去路由，本节点不代为回执。
+	write(header.NewControlFrame(6, header.FlagACKRequired).WithMsgID(5).WithSourceID(2).WithTargetID(7))
+	deadline := time.Now().Add(2 * time.Second)
+	for conn.frameCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("dispatched frames=%d, want the remote control request", conn.frameCount())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	write(header.NewControlFrame(6, header.FlagACKRequired).WithMsgID(6).WithSourceID(2).WithTargetID(1))
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	hdr, _, err := codec.Decode(client)
+	if err != nil {
+		t.Fatalf("read ack: %v", err)
+	}
+	if !header.IsControlAck(hdr) || hdr.GetMsgID() != 6 || hdr.SourceID() != 1 {
+		t.Fatalf("reply=%+v, want local ack for msg 6", hdr)
+	}
+	if conn.frameCount() != 1 {
+		t.Fatalf("dispatched frames=%d, want local request answered in the read loop", conn.frameCount())
+	}
+}
+
+func TestClassifyFrameErr(t *testing.T) {
+	cases := []struct {
+		err  error
+		want FrameErrorKind
+	}{
+		{nil, FrameErrNone},
+		{io.EOF, FrameErrEOF},
+		{io.ErrUnexpectedEOF, FrameErrIO},
+		{fmt.Errorf("read: %w", net.ErrClosed), FrameErrClosed},
+		{context.Canceled, FrameErrCanceled},
+		{ErrReadIdleTimeout, FrameErrTimeout},
+		{ErrFrameTimeout, FrameErrTimeout},
+		{header.ErrHeaderMagicMismatch, FrameErrProtocol},
+		{header.ErrPayloadTooLarge, FrameErrProtocol},
+		{errors.New("boom"), FrameErrIO},
+	}
+	for _, tc := range cases {
+		if got := ClassifyFrameErr(tc.err); got != tc.want {
+			t.Fatalf("ClassifyFrameErr(%v)=%q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
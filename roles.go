@@ -5,6 +5,8 @@ package core
 // Metadata keys and values for connection roles.
 const (
 	MetaRoleKey = "role"
+	// MetaParentStandbyKey 标记热备父链路（bool）；转发优先选择未标记的活动父链路。
+	MetaParentStandbyKey = "parentStandby"
 
 	RoleParent = "parent"
 	RoleChild  = "child"
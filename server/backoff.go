@@ -0,0 +1,15 @@
+package server
+
+// 本文件承载 Core 框架中与 `backoff` 相关的通用逻辑。
+
+import (
+	"context"
+	"time"
+
+	"github.com/yttydcs/myflowhub-core/process"
+)
+
+// sleepCtx 等待 d 或 ctx 结束，返回 false 表示 ctx 已取消。
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	return process.RealClock{}.Sleep(ctx, d)
+}
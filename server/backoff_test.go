@@ -0,0 +1,84 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `backoff` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+)
+
+func TestServerParentLinkBackoffGrowsThenResets(t *testing.T) {
+	conn, parentSide := newPipeConn(t)
+	var dials atomic.Int32
+	dialer := func(context.Context, string) (core.IConnection, error) {
+		// 前三次失败，第四次成功，之后持续失败。
+		if dials.Add(1) == 4 {
+			return conn, nil
+		}
+		return nil, errors.New("parent down")
+	}
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Config = config.NewMap(map[string]string{
+			config.KeyParentEnable:          "true",
+			config.KeyParentAddr:            "fake",
+			config.KeyParentReconnectMinSec: "1",
+			config.KeyParentReconnectMaxSec: "4",
+			config.KeyParentReconnectJitter: "0",
+		})
+		o.ParentDialer = dialer
+	})
+
+	var clock atomic.Int64
+	srv.now = func() time.Time { return time.Unix(0, clock.Load()) }
+	var mu sync.Mutex
+	var waits []time.Duration
+	finished := make(chan struct{})
+	srv.sleep = func(_ context.Context, d time.Duration) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		waits = append(waits, d)
+		if len(waits) == 4 {
+			close(finished)
+			return false
+		}
+		return true
+	}
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := srv.ConnManager().Get(conn.ID()); ok {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if _, ok := srv.ConnManager().Get(conn.ID()); !ok {
+		t.Fatalf("parent connection not added")
+	}
+	// 让连接“存活”满 max 后断开，退避应回到 min。
+	clock.Add(int64(4 * time.Second))
+	_ = parentSide.Close()
+
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("reconnect loop did not reach expected waits")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, time.Second}
+	if !slices.Equal(waits, want) {
+		t.Fatalf("waits=%v, want %v", waits, want)
+	}
+}
@@ -0,0 +1,24 @@
+package server
+
+// 本文件承载 Core 框架中与 `certbind` 相关的通用逻辑。
+
+import (
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// bindCertIdentity 在读取开始前绑定监听器从客户端证书映射出的身份：与 login 走同一例程
+// （core.BindConnIdentity），因此同样受重复连接/冲突策略约束并发布 conn.authenticated。
+// 绑定被拒绝时返回错误，调用方应关闭该连接。
+func (s *Server) bindCertIdentity(conn core.IConnection) error {
+	id, ok := core.ConnCertIdentity(conn)
+	if !ok {
+		return nil
+	}
+	conn.SetMeta(core.MetaCertIdentityKey, nil)
+	conn.SetMeta(core.MetaCertBoundKey, true)
+	if err := core.BindConnIdentity(s.cm, conn, id.NodeID, id.DeviceID); err != nil {
+		conn.SetMeta(core.MetaCertBoundKey, false)
+		return err
+	}
+	return nil
+}
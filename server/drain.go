@@ -0,0 +1,54 @@
+package server
+
+// 本文件承载 Core 框架中与 `drain` 相关的通用逻辑。
+
+import (
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// DrainConnection 把连接置为排空状态：此后收到的帧不再分发，已分发的请求继续处理并回包；
+// grace 结束后冲刷发送队列并关闭连接（关闭原因 drained）。连接不存在时返回 false，重复排空不会重复计时。
+func (s *Server) DrainConnection(connID string, grace time.Duration) bool {
+	conn, ok := s.cm.Get(connID)
+	if !ok {
+		return false
+	}
+	s.drain(conn, grace)
+	return true
+}
+
+// DrainAll 排空除父链路外的全部连接，返回本次新进入排空的连接数；父链路由 Stop 负责断开。
+func (s *Server) DrainAll(grace time.Duration) int {
+	var conns []core.IConnection
+	s.cm.Range(func(c core.IConnection) bool {
+		if !isParentRole(c) && !core.ConnDraining(c) {
+			conns = append(conns, c)
+		}
+		return true
+	})
+	for _, c := range conns {
+		s.drain(c, grace)
+	}
+	return len(conns)
+}
+
+// drain 标记连接并在宽限期后关闭；服务先于宽限期停止时由 Stop 统一关闭。
+func (s *Server) drain(conn core.IConnection, grace time.Duration) {
+	if core.ConnDraining(conn) {
+		return
+	}
+	core.SetConnDraining(conn)
+	s.log.Info("conn draining", "conn", conn.ID(), "node", core.ConnNodeID(conn), "grace", grace)
+	ctx := s.eventCtx()
+	go func() {
+		if !s.sleep(ctx, grace) {
+			return
+		}
+		core.MarkCloseReason(conn, core.CloseReasonDrained)
+		if err := s.cm.Remove(conn.ID()); err != nil {
+			s.log.Debug("remove drained conn", "conn", conn.ID(), "err", err)
+		}
+	}()
+}
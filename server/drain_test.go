@@ -0,0 +1,142 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `drain` 相关的行为。
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/process"
+)
+
+// gatedReplyProcess 记录收到的帧，并在 release 关闭后异步回包，模拟排空时仍在处理中的请求。
+type gatedReplyProcess struct {
+	*process.SimpleProcess
+	recv    chan uint32
+	release chan struct{}
+}
+
+func (p *gatedReplyProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ []byte) {
+	p.recv <- hdr.GetMsgID()
+	srv := core.ServerFromContext(ctx)
+	go func() {
+		<-p.release
+		resp := header.BuildTCPResponse(hdr, 4, hdr.SubProto())
+		_ = srv.Send(context.Background(), conn.ID(), resp, []byte("done"))
+	}()
+}
+
+func TestServerDrainConnectionRejectsNewFramesAndFinishesInFlight(t *testing.T) {
+	conn, client := newPipeConn(t)
+	proc := &gatedReplyProcess{SimpleProcess: process.NewSimple(nil), recv: make(chan uint32, 4), release: make(chan struct{})}
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) { o.Process = proc })
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	send := func(msgID uint32) {
+		req := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(5).WithMsgID(msgID)
+		frame, _ := header.HeaderTcpCodec{}.Encode(req, []byte("req"))
+		if _, err := client.Write(frame); err != nil {
+			t.Fatalf("client write %d: %v", msgID, err)
+		}
+	}
+	send(1)
+	select {
+	case <-proc.recv:
+	case <-time.After(time.Second):
+		t.Fatal("in-flight request never dispatched")
+	}
+
+	if !srv.DrainConnection(conn.ID(), 300*time.Millisecond) {
+		t.Fatal("DrainConnection returned false for a live conn")
+	}
+	if srv.DrainConnection("missing", time.Second) {
+		t.Fatal("DrainConnection returned true for an unknown conn")
+	}
+	send(2)
+	close(proc.release)
+
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	hdr, body, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil || hdr.GetMsgID() != 1 || string(body) != "done" {
+		t.Fatalf("in-flight reply hdr=%v body=%q err=%v", hdr, body, err)
+	}
+	if _, _, err := (header.HeaderTcpCodec{}).Decode(client); err == nil {
+		t.Fatal("conn still open after the drain grace")
+	}
+	select {
+	case id := <-proc.recv:
+		t.Fatalf("frame %d dispatched on a draining conn", id)
+	default:
+	}
+	if _, ok := srv.ConnManager().Get(conn.ID()); ok {
+		t.Fatal("drained conn still in manager")
+	}
+	if r := core.CloseReasonOf(conn); r != core.CloseReasonDrained {
+		t.Fatalf("close reason=%q, want drained", r)
+	}
+}
+
+func TestServerDrainAllSkipsParentLink(t *testing.T) {
+	child, _ := newNamedPipeConn(t, "child")
+	parent, _ := newNamedPipeConn(t, "parent")
+	core.SetConnRole(parent, core.RoleParent)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{child, parent}}, nil)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.ConnManager().Count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := srv.DrainAll(time.Hour); n != 1 || !core.ConnDraining(child) || core.ConnDraining(parent) {
+		t.Fatalf("DrainAll=%d child=%v parent=%v", n, core.ConnDraining(child), core.ConnDraining(parent))
+	}
+	if n := srv.DrainAll(time.Hour); n != 0 {
+		t.Fatalf("second DrainAll=%d, want 0", n)
+	}
+}
+
+// instantClock 记录 Sleep 的时长并立即返回，其余方法沿用真实时间。
+type instantClock struct {
+	process.RealClock
+	slept chan time.Duration
+}
+
+func (c *instantClock) Sleep(ctx context.Context, d time.Duration) bool {
+	c.slept <- d
+	return ctx.Err() == nil
+}
+
+func TestServerDrainUsesOptionsClock(t *testing.T) {
+	conn, _ := newPipeConn(t)
+	clock := &instantClock{slept: make(chan time.Duration, 1)}
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) { o.Clock = clock })
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.ConnManager().Count() < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !srv.DrainConnection(conn.ID(), time.Hour) {
+		t.Fatal("DrainConnection returned false for a live conn")
+	}
+	if d := <-clock.slept; d != time.Hour {
+		t.Fatalf("drain slept %s, want the 1h grace", d)
+	}
+	for time.Now().Before(deadline) {
+		if _, ok := srv.ConnManager().Get(conn.ID()); !ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("conn not removed after the clock skipped the grace")
+}
@@ -0,0 +1,72 @@
+package server
+
+// 本文件承载 Core 框架中与 `events` 相关的通用逻辑。
+
+import (
+	"context"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/events"
+)
+
+// eventCtx 返回携带 Server 的事件上下文；Start 之前退回 Background。
+func (s *Server) eventCtx() context.Context {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return core.WithServerContext(ctx, s)
+}
+
+// publishEvent 非阻塞发布生命周期事件（见 events 包），队列已满时按总线溢出策略丢弃，只记调试日志。
+func (s *Server) publishEvent(name string, data any) {
+	if s.eb == nil {
+		return
+	}
+	if !s.eb.TryPublish(s.eventCtx(), name, data, nil) {
+		s.log.Debug("event dropped", "event", name)
+	}
+}
+
+// publishConnAdded 发布 conn.added；父链路由本节点拨出，不归属任何监听器。
+func (s *Server) publishConnAdded(c core.IConnection) {
+	data := events.ConnAddedData{ConnID: c.ID(), Role: core.ConnRole(c)}
+	if addr := c.RemoteAddr(); addr != nil {
+		data.RemoteAddr = addr.String()
+	}
+	if !isParentRole(c) {
+		data.Protocol = s.lst.Protocol()
+	}
+	s.publishEvent(events.ConnAdded, data)
+}
+
+// publishConnAuthenticated 在登录流程以连接自身 nodeID 绑定索引后发布 conn.authenticated。
+func (s *Server) publishConnAuthenticated(nodeID uint32, c core.IConnection) {
+	s.publishEvent(events.ConnAuthenticated, events.ConnAuthenticatedData{
+		ConnID:   c.ID(),
+		NodeID:   nodeID,
+		DeviceID: core.ConnDeviceID(c),
+	})
+}
+
+// sendFailedNotifier 返回上报发送结果的回调，失败时至多发布一次 send.failed；
+// 同步发送模式下回调与返回值会报告同一个错误，由 once 去重。
+func (s *Server) sendFailedNotifier(conn core.IConnection, hdr core.IHeader) func(error) {
+	var once sync.Once
+	subProto, msgID := hdr.SubProto(), hdr.GetMsgID()
+	return func(err error) {
+		if err == nil {
+			return
+		}
+		once.Do(func() {
+			s.publishEvent(events.SendFailed, events.SendFailedData{
+				ConnID:   conn.ID(),
+				NodeID:   core.ConnNodeID(conn),
+				SubProto: subProto,
+				MsgID:    msgID,
+				Error:    err.Error(),
+			})
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `events` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/events"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+)
+
+// eventRecorder 订阅一组事件名，按名字等待事件，不依赖不同事件桶之间的投递顺序。
+type eventRecorder struct {
+	ch   chan eventbus.Event
+	seen []eventbus.Event
+}
+
+func recordEvents(bus eventbus.IBus, names ...string) *eventRecorder {
+	r := &eventRecorder{ch: make(chan eventbus.Event, 64)}
+	for _, name := range names {
+		bus.Subscribe(name, func(_ context.Context, evt eventbus.Event) { r.ch <- evt })
+	}
+	return r
+}
+
+// wait 返回名为 name 的下一条事件载荷，期间收到的其他事件留待后续 wait。
+func (r *eventRecorder) wait(t *testing.T, name string) any {
+	t.Helper()
+	for i, evt := range r.seen {
+		if evt.Name == name {
+			r.seen = append(r.seen[:i], r.seen[i+1:]...)
+			return evt.Data
+		}
+	}
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case evt := <-r.ch:
+			if evt.Name == name {
+				return evt.Data
+			}
+			r.seen = append(r.seen, evt)
+		case <-timeout:
+			t.Fatalf("event %q not published", name)
+			return nil
+		}
+	}
+}
+
+// failWriteConn 读取正常但任何写出都失败，用于触发 send.failed。
+type failWriteConn struct {
+	net.Conn
+}
+
+func (failWriteConn) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+// loginProcess 模拟登录 handler：收到 SubProto=2 后写入 nodeID/deviceID 元数据并绑定节点索引。
+type loginProcess struct {
+	*process.SimpleProcess
+}
+
+func (p *loginProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ []byte) {
+	if hdr.SubProto() != 2 {
+		return
+	}
+	core.SetConnNodeID(conn, hdr.SourceID())
+	core.SetConnDeviceID(conn, "dev-21")
+	core.ServerFromContext(ctx).ConnManager().UpdateNodeIndex(hdr.SourceID(), conn)
+}
+
+func TestServerPublishesLifecycleEvents(t *testing.T) {
+	srvSide, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close(); _ = srvSide.Close() })
+	conn := tcp_listener.NewTCPConnection(failWriteConn{Conn: srvSide})
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Name = "hub"
+		o.NodeID = 5
+		o.Process = &loginProcess{SimpleProcess: process.NewSimple(nil)}
+	})
+	rec := recordEvents(srv.EventBus(),
+		events.ServerStarted, events.ConnAdded, events.ConnAuthenticated, events.SendFailed, events.ServerStopping)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	started := rec.wait(t, events.ServerStarted).(events.ServerStartedData)
+	if started.Name != "hub" || started.NodeID != 5 || started.Protocol != "stub" {
+		t.Fatalf("server.started=%+v", started)
+	}
+	added := rec.wait(t, events.ConnAdded).(events.ConnAddedData)
+	if added.ConnID != conn.ID() || added.Protocol != "stub" || added.Role != core.RoleChild || added.RemoteAddr == "" {
+		t.Fatalf("conn.added=%+v", added)
+	}
+
+	login := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(2).WithSourceID(21).WithMsgID(1)
+	frame, _ := header.HeaderTcpCodec{}.Encode(login, []byte(`{"action":"login"}`))
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("client write: %v", err)
+	}
+	auth := rec.wait(t, events.ConnAuthenticated).(events.ConnAuthenticatedData)
+	if auth.ConnID != conn.ID() || auth.NodeID != 21 || auth.DeviceID != "dev-21" {
+		t.Fatalf("conn.authenticated=%+v", auth)
+	}
+
+	msg := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithTargetID(21).WithMsgID(7)
+	_ = srv.Send(context.Background(), conn.ID(), msg, []byte("x"))
+	failed := rec.wait(t, events.SendFailed).(events.SendFailedData)
+	if failed.ConnID != conn.ID() || failed.NodeID != 21 || failed.SubProto != 5 || failed.MsgID != 7 ||
+		!strings.Contains(failed.Error, "broken pipe") {
+		t.Fatalf("send.failed=%+v", failed)
+	}
+
+	if err := srv.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	stopping := rec.wait(t, events.ServerStopping).(events.ServerStoppingData)
+	if stopping.Name != "hub" || stopping.Connections != 1 {
+		t.Fatalf("server.stopping=%+v", stopping)
+	}
+}
+
+func TestServerStartsSessionOnNodeBound(t *testing.T) {
+	conn, client := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Process = &loginProcess{SimpleProcess: process.NewSimple(nil)}
+		o.Config = config.NewMap(map[string]string{config.KeyAuthSessionTTLSec: "60"})
+	})
+	rec := recordEvents(srv.EventBus(), events.ConnAuthenticated)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	before := time.Now()
+	login := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(2).WithSourceID(21).WithMsgID(1)
+	frame, _ := header.HeaderTcpCodec{}.Encode(login, []byte(`{"action":"login"}`))
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("client write: %v", err)
+	}
+	rec.wait(t, events.ConnAuthenticated)
+	expiry, ok := core.ConnSessionExpiry(conn)
+	if !ok || expiry.Before(before.Add(60*time.Second)) || expiry.After(time.Now().Add(60*time.Second)) {
+		t.Fatalf("session expiry=%v ok=%v, want now+60s after login", expiry, ok)
+	}
+}
+
+func TestServerBindsCertIdentityThroughLoginRoutine(t *testing.T) {
+	owner, _ := newNamedPipeConn(t, "owner")
+	core.SetConnNodeID(owner, 42)
+	dup, dupClient := newNamedPipeConn(t, "dup")
+	dup.SetMeta(core.MetaCertIdentityKey, core.CertIdentity{NodeID: 42})
+	fresh, _ := newNamedPipeConn(t, "fresh")
+	fresh.SetMeta(core.MetaCertIdentityKey, core.CertIdentity{NodeID: 43, DeviceID: "dev-43"})
+
+	mgr := connmgr.New()
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{owner, dup, fresh}}, func(o *Options) {
+		o.Manager = mgr
+		o.Config = config.NewMap(map[string]string{config.KeyAuthDuplicateLoginPolicy: "reject_new"})
+	})
+	rec := recordEvents(srv.EventBus(), events.ConnAuthenticated)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	auth := rec.wait(t, events.ConnAuthenticated).(events.ConnAuthenticatedData)
+	if auth.ConnID != fresh.ID() || auth.NodeID != 43 || auth.DeviceID != "dev-43" || !core.ConnCertBound(fresh) {
+		t.Fatalf("conn.authenticated=%+v certBound=%v", auth, core.ConnCertBound(fresh))
+	}
+	if got, ok := mgr.GetByDevice("dev-43"); !ok || got != fresh {
+		t.Fatal("device index not built for cert-bound connection")
+	}
+	// 重复的 nodeID 按 DuplicateRejectNew 被拒绝，连接随即关闭，原连接保持索引。
+	_ = dupClient.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err := dupClient.Read(make([]byte, 1)); err == nil {
+		t.Fatal("duplicate cert-bound connection not closed")
+	}
+	if got, ok := mgr.GetByNode(42); !ok || got != owner {
+		t.Fatal("duplicate cert-bound connection took over the node index")
+	}
+	if core.CloseReasonOf(dup) != core.CloseReasonBindRejected || core.ConnCertBound(dup) {
+		t.Fatalf("dup close reason=%q certBound=%v", core.CloseReasonOf(dup), core.ConnCertBound(dup))
+	}
+}
+
+// blockingSubProcess 在 release 关闭前阻塞 worker，使分发队列被填满。
+type blockingSubProcess struct {
+	release chan struct{}
+	once    sync.Once
+}
+
+func (h *blockingSubProcess) SubProto() uint8           { return 5 }
+func (h *blockingSubProcess) Init() bool                { return true }
+func (h *blockingSubProcess) AcceptCmd() bool           { return false }
+func (h *blockingSubProcess) AllowSourceMismatch() bool { return true }
+func (h *blockingSubProcess) OnReceive(context.Context, core.IConnection, core.IHeader, []byte) {
+	<-h.release
+}
+func (h *blockingSubProcess) unblock() { h.once.Do(func() { close(h.release) }) }
+
+func TestServerPublishesDispatcherQueueFull(t *testing.T) {
+	conn, client := newPipeConn(t)
+	disp, err := process.NewDispatcher(process.DispatchOptions{ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 1})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	handler := &blockingSubProcess{release: make(chan struct{})}
+	if err := disp.RegisterHandler(handler); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) { o.Process = disp })
+	rec := recordEvents(srv.EventBus(), events.DispatcherQueueFull)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+	defer handler.unblock()
+
+	// 一帧占住 worker、一帧占满队列，之后的帧被丢弃。
+	for i := uint32(1); i <= 4; i++ {
+		h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(1).WithMsgID(i)
+		frame, _ := header.HeaderTcpCodec{}.Encode(h, nil)
+		if _, err := client.Write(frame); err != nil {
+			t.Fatalf("client write: %v", err)
+		}
+	}
+	full := rec.wait(t, events.DispatcherQueueFull).(events.DispatcherQueueFullData)
+	if full.ConnID != conn.ID() || full.SubProto != 5 || full.MsgID < 2 {
+		t.Fatalf("dispatcher.queue_full=%+v", full)
+	}
+}
+
+func TestServerPublishesParentConnectedAndLost(t *testing.T) {
+	f := newParentFixture(t, "primary", "secondary")
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Config = config.NewMap(map[string]string{
+			config.KeyParentEnable: "true",
+			config.KeyParentAddrs:  "primary, secondary",
+		})
+		o.ParentDialer = f.dial
+	})
+	srv.sleep = func(ctx context.Context, _ time.Duration) bool { return sleepCtx(ctx, 5*time.Millisecond) }
+	rec := recordEvents(srv.EventBus(), events.ParentConnected, events.ParentLost)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	up := rec.wait(t, events.ParentConnected).(events.ParentConnectedData)
+	if up.Addr != "primary" || up.ConnID == "" || up.Promoted {
+		t.Fatalf("first parent.connected=%+v", up)
+	}
+	f.kill("primary")
+	lost := rec.wait(t, events.ParentLost).(events.ParentLostData)
+	if lost.Addr != "primary" || lost.ConnID != up.ConnID {
+		t.Fatalf("parent.lost=%+v, want primary conn %q", lost, up.ConnID)
+	}
+	up = rec.wait(t, events.ParentConnected).(events.ParentConnectedData)
+	if up.Addr != "secondary" {
+		t.Fatalf("second parent.connected=%+v, want secondary", up)
+	}
+}
+
+func TestServerStopDrainsGoodbyeFrames(t *testing.T) {
+	conn, client := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, nil)
+	srv.EventBus().Subscribe(events.ServerStopping, func(ctx context.Context, _ eventbus.Event) {
+		bye, payload := header.NewByeFrame("shutdown")
+		_ = srv.Send(ctx, conn.ID(), bye, payload)
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	for deadline := time.Now().Add(2 * time.Second); srv.ConnManager().Count() == 0 && time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	got := make(chan string, 1)
+	go func() {
+		hdr, payload, err := header.HeaderTcpCodec{}.Decode(client)
+		if err != nil {
+			got <- "err: " + err.Error()
+			return
+		}
+		reason, _ := header.ParseBye(hdr, payload)
+		got <- reason
+	}()
+	if err := srv.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	select {
+	case reason := <-got:
+		if reason != "shutdown" {
+			t.Fatalf("client got %q, want the goodbye frame", reason)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("goodbye frame not delivered before shutdown")
+	}
+}
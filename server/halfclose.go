@@ -0,0 +1,53 @@
+package server
+
+// 本文件承载 Core 框架中与 `halfclose` 相关的通用逻辑。
+
+import (
+	"strconv"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/reader"
+)
+
+// buildHalfCloseGrace 读取 conn.half_close_grace_ms；缺省或非法时为 0（不启用）。
+func buildHalfCloseGrace(cfg core.IConfig) time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	raw, ok := cfg.Get(coreconfig.KeyConnHalfCloseGraceMS)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Millisecond
+}
+
+// drainHalfClosed 在对端半关闭（读到 EOF）后停止读取，留出宽限期让仍在处理的请求把响应送出，
+// 随后冲刷发送队列并发送 FIN；连接不支持半关闭、未启用宽限期或服务正在停止时直接返回。
+func (s *Server) drainHalfClosed(conn core.IConnection, readErr error) {
+	if s.halfCloseGrace <= 0 || reader.ClassifyFrameErr(readErr) != reader.FrameErrEOF {
+		return
+	}
+	hc, ok := conn.(core.IHalfCloser)
+	if !ok || s.ctx.Err() != nil {
+		return
+	}
+	if err := hc.CloseRead(); err != nil {
+		s.log.Debug("half-close read", "conn", conn.ID(), "err", err)
+		return
+	}
+	if !s.sleep(s.ctx, s.halfCloseGrace) {
+		return
+	}
+	if s.sender != nil {
+		s.sender.CloseConn(conn.ID())
+	}
+	if err := hc.CloseWrite(); err != nil {
+		s.log.Debug("half-close write", "conn", conn.ID(), "err", err)
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+// 本文件承载 Core 框架中与 `history` 相关的通用逻辑。
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// FrameRecord 为接收历史中的一帧：解码后的头部副本，以及可选的截断 payload 副本。
+type FrameRecord struct {
+	Time       time.Time
+	Header     core.IHeader
+	PayloadLen int    // 原始 payload 长度
+	Payload    []byte // 至多 debug.recent_payload_bytes 字节；未开启时为 nil
+}
+
+// historyConfig 控制每条连接保留的接收历史。
+type historyConfig struct {
+	frames       int // 每条连接保留的帧数，0 表示关闭
+	payloadBytes int // 每帧保留的 payload 前缀字节数
+}
+
+// buildHistoryConfig 读取 debug.recent_frames 与 debug.recent_payload_bytes。
+func buildHistoryConfig(cfg core.IConfig) historyConfig {
+	var hc historyConfig
+	if cfg == nil {
+		return hc
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyDebugRecentFrames); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			hc.frames = v
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyDebugRecentPayloadBytes); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			hc.payloadBytes = v
+		}
+	}
+	return hc
+}
+
+// ring 是定长环形缓冲，写满后覆盖最旧的元素；并发安全。
+type ring[T any] struct {
+	mu   sync.Mutex
+	buf  []T
+	next int
+	full bool
+}
+
+func newRing[T any](size int) *ring[T] {
+	return &ring[T]{buf: make([]T, size)}
+}
+
+// add 追加一个元素。
+func (r *ring[T]) add(v T) {
+	r.mu.Lock()
+	r.buf[r.next] = v
+	r.next++
+	if r.next == len(r.buf) {
+		r.next, r.full = 0, true
+	}
+	r.mu.Unlock()
+}
+
+// snapshot 按从旧到新的顺序返回当前内容的副本。
+func (r *ring[T]) snapshot() []T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]T(nil), r.buf[:r.next]...)
+	}
+	out := make([]T, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+// recordFrame 把一帧记入连接的接收历史。payload 只在回调期间有效（见 core.IConnection.DispatchReceive），
+// 因此头部与 payload 前缀都在这里复制。
+func (s *Server) recordFrame(conn core.IConnection, hdr core.IHeader, payload []byte) {
+	if s.historyCfg.frames == 0 {
+		return
+	}
+	v, ok := s.history.Load(conn.ID())
+	if !ok {
+		return
+	}
+	rec := FrameRecord{Time: s.now(), Header: header.CloneToTCP(hdr), PayloadLen: len(payload)}
+	if n := min(len(payload), s.historyCfg.payloadBytes); n > 0 {
+		rec.Payload = append([]byte(nil), payload[:n]...)
+	}
+	v.(*ring[FrameRecord]).add(rec)
+}
+
+// RecentFrames 返回连接最近收到的帧（从旧到新，至多 debug.recent_frames 条）；
+// 连接不存在或未开启接收历史时返回 false。
+func (s *Server) RecentFrames(connID string) ([]FrameRecord, bool) {
+	v, ok := s.history.Load(connID)
+	if !ok {
+		return nil, false
+	}
+	return v.(*ring[FrameRecord]).snapshot(), true
+}
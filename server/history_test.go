@@ -0,0 +1,86 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `history` 相关的行为。
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func TestRingKeepsMostRecentInOrder(t *testing.T) {
+	r := newRing[int](3)
+	if got := r.snapshot(); len(got) != 0 {
+		t.Fatalf("empty ring snapshot=%v", got)
+	}
+	r.add(1)
+	r.add(2)
+	if got := fmt.Sprint(r.snapshot()); got != "[1 2]" {
+		t.Fatalf("snapshot=%s, want [1 2]", got)
+	}
+	for i := 3; i <= 7; i++ {
+		r.add(i)
+	}
+	if got := fmt.Sprint(r.snapshot()); got != "[5 6 7]" {
+		t.Fatalf("snapshot=%s, want [5 6 7]", got)
+	}
+}
+
+func TestServerRecentFramesReturnsLatestFramesInOrder(t *testing.T) {
+	conn, client := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Config = config.NewMap(map[string]string{
+			config.KeyDebugRecentFrames:       "3",
+			config.KeyDebugRecentPayloadBytes: "4",
+		})
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	for i := uint32(1); i <= 5; i++ {
+		h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(7).WithTargetID(1).WithMsgID(i)
+		frame, err := header.HeaderTcpCodec{}.Encode(h, []byte(fmt.Sprintf("payload-%d", i)))
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		if _, err := client.Write(frame); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	var recs []FrameRecord
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		recs, _ = srv.RecentFrames(conn.ID())
+		if len(recs) == 3 && recs[2].Header.GetMsgID() == 5 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("RecentFrames len=%d, want 3", len(recs))
+	}
+	for i, rec := range recs {
+		want := uint32(i + 3)
+		if rec.Header.GetMsgID() != want || rec.PayloadLen != len("payload-0") || string(rec.Payload) != "payl" {
+			t.Fatalf("record %d msg=%d len=%d payload=%q, want msg %d with truncated payload", i, rec.Header.GetMsgID(), rec.PayloadLen, rec.Payload, want)
+		}
+	}
+
+	_ = client.Close()
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, ok := srv.RecentFrames(conn.ID()); !ok {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatal("history not released after connection closed")
+}
@@ -0,0 +1,95 @@
+package server
+
+// 本文件承载 Core 框架中与 `kick` 相关的通用逻辑。
+
+import (
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// byeWriteTimeout 限制告别帧的写出等待，避免对端不读时阻塞踢除流程。
+const byeWriteTimeout = 200 * time.Millisecond
+
+// KickNode 断开 nodeID 的全部直连（连接元数据中的 nodeID 等于该值），返回是否踢掉了至少一条连接。
+// 经下游 Hub 间接可达的连接承载着其他节点，不会因此被关闭。
+// kick.send_bye 开启时（默认），关闭前会尽力发送一帧携带 reason 的告别帧。
+func (s *Server) KickNode(nodeID uint32, reason string) bool {
+	if nodeID == 0 {
+		return false
+	}
+	var candidates []core.IConnection
+	if multi, ok := s.cm.(core.IMultiNodeIndex); ok {
+		candidates = multi.GetAllByNode(nodeID)
+	} else if c, ok := s.cm.GetByNode(nodeID); ok {
+		candidates = []core.IConnection{c}
+	}
+	sendBye := s.kickSendBye()
+	kicked := false
+	for _, conn := range candidates {
+		if core.ConnNodeID(conn) != nodeID {
+			continue
+		}
+		core.MarkCloseReason(conn, core.CloseReasonKicked)
+		if sendBye {
+			s.sendBye(conn, reason)
+		}
+		if err := s.cm.Remove(conn.ID()); err != nil {
+			continue
+		}
+		s.log.Info("node kicked", "node", nodeID, "conn", conn.ID(), "reason", reason)
+		kicked = true
+	}
+	return kicked
+}
+
+// KickConn 按连接 ID 断开单条连接（如管理端按 list_conns 结果踢除），关闭前的告别帧与 KickNode 相同；
+// 连接不存在时返回 false。
+func (s *Server) KickConn(connID, reason string) bool {
+	conn, ok := s.cm.Get(connID)
+	if !ok {
+		return false
+	}
+	core.MarkCloseReason(conn, core.CloseReasonKicked)
+	if s.kickSendBye() {
+		s.sendBye(conn, reason)
+	}
+	if err := s.cm.Remove(connID); err != nil {
+		return false
+	}
+	s.log.Info("conn kicked", "conn", connID, "node", core.ConnNodeID(conn), "reason", reason)
+	return true
+}
+
+// kickSendBye 读取 kick.send_bye，缺省开启。
+func (s *Server) kickSendBye() bool {
+	if s.cfg == nil {
+		return true
+	}
+	raw, ok := s.cfg.Get(coreconfig.KeyKickSendBye)
+	if !ok {
+		return true
+	}
+	return core.ParseBool(raw, true)
+}
+
+// sendBye 绕过发送调度器直接写出告别帧，确保它先于连接关闭到达；超时后放弃等待，
+// 随后的关闭会打断仍阻塞的写入。
+func (s *Server) sendBye(conn core.IConnection, reason string) {
+	hdr, payload := header.NewByeFrame(reason)
+	codec := s.codecFor(conn)
+	done := make(chan error, 1)
+	go func() { done <- conn.SendWithHeader(hdr, payload, codec) }()
+	timer := time.NewTimer(byeWriteTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			s.log.Debug("send bye failed", "conn", conn.ID(), "err", err)
+		}
+	case <-timer.C:
+		s.log.Debug("send bye timed out", "conn", conn.ID())
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+// 本文件承载 Core 框架中与 `loopback` 相关的通用逻辑。
+
+import (
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+)
+
+// loopbackAddr 是回环连接两端的地址。
+type loopbackAddr struct{}
+
+func (loopbackAddr) Network() string { return "loopback" }
+func (loopbackAddr) String() string  { return "self" }
+
+// loopbackPipe 是内存中的 net.Conn：写入的字节原样从自身读出。写入在对端（即本连接的读取循环）
+// 读走前阻塞，与真实连接的背压一致；不支持截止时间，回环连接因此不会触发空闲读超时。
+type loopbackPipe struct {
+	r *io.PipeReader
+	w *io.PipeWriter
+}
+
+func newLoopbackPipe() *loopbackPipe {
+	r, w := io.Pipe()
+	return &loopbackPipe{r: r, w: w}
+}
+
+func (p *loopbackPipe) Read(b []byte) (int, error)  { return p.r.Read(b) }
+func (p *loopbackPipe) Write(b []byte) (int, error) { return p.w.Write(b) }
+
+// Close 同时关闭读写两端：读取循环收到 EOF 退出，后续写入返回 io.ErrClosedPipe。
+func (p *loopbackPipe) Close() error {
+	_ = p.w.Close()
+	return p.r.Close()
+}
+
+func (p *loopbackPipe) LocalAddr() net.Addr              { return loopbackAddr{} }
+func (p *loopbackPipe) RemoteAddr() net.Addr             { return loopbackAddr{} }
+func (p *loopbackPipe) SetDeadline(time.Time) error      { return nil }
+func (p *loopbackPipe) SetReadDeadline(time.Time) error  { return nil }
+func (p *loopbackPipe) SetWriteDeadline(time.Time) error { return nil }
+
+var _ net.Conn = (*loopbackPipe)(nil)
+
+// loopbackConnID 读取 conn.loopback_id，空串表示不注册回环连接。
+func loopbackConnID(cfg core.IConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	raw, _ := cfg.Get(coreconfig.KeyConnLoopbackID)
+	return strings.TrimSpace(raw)
+}
+
+// addLoopback 注册代表本节点自身的回环连接：角色为 core.RoleLocal，nodeID 为本节点，
+// 因此 Send(id, ...) 与 SendToNode(NodeID(), ...) 发出的帧经常规读取循环回到本地 process，
+// 按发往本节点的帧在本地分发。回环连接不参与广播复制，也不做头版本协商。
+func (s *Server) addLoopback(id string) {
+	conn := tcp_listener.NewTCPConnectionWithID(newLoopbackPipe(), func(net.Addr, net.Addr) string { return id })
+	core.SetConnRole(conn, core.RoleLocal)
+	core.SetConnNodeID(conn, s.NodeID())
+	if err := s.cm.Add(conn); err != nil {
+		s.log.Warn("register loopback conn failed", "conn", id, "err", err)
+		return
+	}
+	s.loopback.Store(conn)
+}
+
+// rebindLoopback 在本节点 ID 变化后把回环连接改绑到新 nodeID。
+func (s *Server) rebindLoopback(id uint32) {
+	conn, _ := s.loopback.Load().(core.IConnection)
+	if conn == nil {
+		return
+	}
+	old := core.ConnNodeID(conn)
+	if old == id {
+		return
+	}
+	core.SetConnNodeID(conn, id)
+	if c, ok := s.cm.GetByNode(old); ok && c == conn {
+		s.cm.RemoveNodeIndex(old)
+	}
+	s.cm.UpdateNodeIndex(id, conn)
+}
+
+// isLoopbackConn 判断连接是否为本节点的回环连接。
+func isLoopbackConn(c core.IConnection) bool {
+	return core.ConnRole(c) == core.RoleLocal
+}
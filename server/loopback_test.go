@@ -0,0 +1,108 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `loopback` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/process"
+)
+
+type loopbackFrame struct {
+	connID  string
+	source  uint32
+	payload string
+}
+
+// loopbackHandler 记录在本地分发到的帧。
+type loopbackHandler struct{ got chan loopbackFrame }
+
+func (h *loopbackHandler) SubProto() uint8           { return 9 }
+func (h *loopbackHandler) Init() bool                { return true }
+func (h *loopbackHandler) AcceptCmd() bool           { return false }
+func (h *loopbackHandler) AllowSourceMismatch() bool { return false }
+func (h *loopbackHandler) OnReceive(_ context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	h.got <- loopbackFrame{connID: conn.ID(), source: hdr.SourceID(), payload: string(payload)}
+}
+
+func TestLoopbackSendToLocalNodeDispatchesLocally(t *testing.T) {
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	disp, err := process.NewDispatcher(process.DispatchOptions{Logger: log, ChannelCount: 1, WorkersPerChan: 1, ChannelBuffer: 16, Base: process.NewPreRoutingProcess(log)})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	h := &loopbackHandler{got: make(chan loopbackFrame, 4)}
+	if err := disp.RegisterHandler(h); err != nil {
+		t.Fatalf("RegisterHandler: %v", err)
+	}
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Logger = log
+		o.Process = disp
+		o.NodeID = 3
+		o.Config = config.NewMap(map[string]string{config.KeyConnLoopbackID: "self"})
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+
+	send := func(target uint32, body string) {
+		t.Helper()
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(9).WithSourceID(srv.NodeID()).WithTargetID(target)
+		if err := srv.SendToNode(context.Background(), target, hdr, []byte(body)); err != nil {
+			t.Fatalf("SendToNode(%d): %v", target, err)
+		}
+	}
+	expect := func(source uint32, body string) {
+		t.Helper()
+		select {
+		case f := <-h.got:
+			if f.connID != "self" || f.source != source || f.payload != body {
+				t.Fatalf("local handler got %+v, want conn self source %d payload %q", f, source, body)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("local handler not invoked for %q", body)
+		}
+	}
+
+	send(3, "hello")
+	expect(3, "hello")
+
+	// 节点 ID 变化后回环连接随之改绑。
+	srv.UpdateNodeID(5)
+	if _, ok := srv.ConnManager().GetByNode(3); ok {
+		t.Fatal("old node id still bound to loopback")
+	}
+	send(5, "renamed")
+	expect(5, "renamed")
+
+	// 广播不复制到回环连接。
+	bcast := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(9).WithSourceID(5)
+	if err := srv.Broadcast(context.Background(), bcast, []byte("bcast")); err != nil {
+		t.Fatalf("Broadcast: %v", err)
+	}
+	select {
+	case f := <-h.got:
+		t.Fatalf("broadcast delivered to loopback: %+v", f)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLoopbackDisabledByDefault(t *testing.T) {
+	srv := newTestServer(t, &stubListener{}, nil)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(9).WithSourceID(1).WithTargetID(1)
+	if err := srv.SendToNode(context.Background(), srv.NodeID(), hdr, nil); err != ErrNodeNotFound {
+		t.Fatalf("SendToNode(local) err=%v, want ErrNodeNotFound", err)
+	}
+}
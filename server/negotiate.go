@@ -0,0 +1,203 @@
+package server
+
+// 本文件承载 Core 框架中与 `negotiate` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// negotiateConfig 描述头版本协商参数；enable=false 时连接一律使用 Options.Codec。
+type negotiateConfig struct {
+	enable   bool
+	versions []uint8
+	timeout  time.Duration
+	// firstRead 为子连接首帧的读取期限：配置了 reader.read_timeout_sec 时沿用空闲超时，否则使用 timeout。
+	firstRead time.Duration
+}
+
+// buildNegotiateConfig 从配置读取 header.negotiate / header.versions / header.negotiate_timeout_ms，
+// 以及决定首帧读取期限的 reader.read_timeout_sec。
+func buildNegotiateConfig(cfg core.IConfig) negotiateConfig {
+	nc := negotiateConfig{
+		versions:  header.SupportedVersions(),
+		timeout:   2 * time.Second,
+		firstRead: 2 * time.Second,
+	}
+	if cfg == nil {
+		return nc
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyHeaderNegotiate); ok {
+		nc.enable = core.ParseBool(raw, false)
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyHeaderVersions); ok {
+		if vs := parseVersions(raw); len(vs) > 0 {
+			nc.versions = vs
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyHeaderNegotiateTimeoutMS); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			nc.timeout = time.Duration(v) * time.Millisecond
+		}
+	}
+	nc.firstRead = nc.timeout
+	if raw, ok := cfg.Get(coreconfig.KeyReaderReadTimeoutSec); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			nc.firstRead = time.Duration(v) * time.Second
+		}
+	}
+	return nc
+}
+
+// parseVersions 解析 "2,1" 形式的版本列表，忽略本实现不支持的版本。
+func parseVersions(raw string) []uint8 {
+	var out []uint8
+	for _, part := range strings.Split(raw, ",") {
+		v, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || v <= 0 || v > 255 {
+			continue
+		}
+		if header.CodecForVersion(uint8(v)) == nil {
+			continue
+		}
+		out = append(out, uint8(v))
+	}
+	return out
+}
+
+// connHeaderVersion 读取连接上协商出的头版本，未协商时返回 0。
+func connHeaderVersion(c core.IConnection) uint8 {
+	if c == nil {
+		return 0
+	}
+	if v, ok := c.GetMeta(header.MetaHeaderVersionKey); ok {
+		if ver, ok2 := v.(uint8); ok2 {
+			return ver
+		}
+	}
+	return 0
+}
+
+// codecFor 返回连接应使用的 codec：优先 CodecFactory，其次协商结果，最后回退 Options.Codec。
+func (s *Server) codecFor(c core.IConnection) core.IHeaderCodec {
+	if s.cFac != nil && c != nil {
+		if codec := s.cFac(c); codec != nil {
+			return codec
+		}
+	}
+	if ver := connHeaderVersion(c); ver != 0 {
+		if codec := header.CodecForVersion(ver); codec != nil {
+			return codec
+		}
+	}
+	return s.codec
+}
+
+// metaPendingFrameKey 暂存父链路协商时读到的非报价首帧（pendingFrame），连接开始服务时补发分发。
+const metaPendingFrameKey = "negotiatePendingFrame"
+
+type pendingFrame struct {
+	hdr     core.IHeader
+	payload []byte
+}
+
+// negotiateParent 在父链路加入管理器前发起头版本协商；对端不应答时回退 v2。
+// 对端首帧不是报价时回退 v2，并暂存该帧待连接开始服务时分发。
+// 无共同版本或首帧只读到一半时返回错误，调用方应放弃该连接。
+func (s *Server) negotiateParent(conn core.IConnection) error {
+	if !s.negotiate.enable {
+		return nil
+	}
+	pipe := conn.Pipe()
+	dl, ok := pipe.(core.IReadDeadlinePipe)
+	if pipe == nil || !ok {
+		s.log.Warn("parent pipe has no read deadline, skip header negotiation", "conn", conn.ID())
+		return nil
+	}
+	_ = dl.SetReadDeadline(time.Now().Add(s.negotiate.timeout))
+	ver, hdr, payload, err := header.OfferVersions(pipe, s.negotiate.versions)
+	_ = dl.SetReadDeadline(time.Time{})
+	switch {
+	case err == nil:
+	case errors.Is(err, header.ErrNoCommonVersion), errors.Is(err, header.ErrOfferReplyTruncated):
+		return err
+	default:
+		s.log.Warn("header negotiation failed, fallback to v2", "conn", conn.ID(), "err", err)
+		ver = header.HeaderTcpVersionV2
+		if hdr != nil {
+			conn.SetMeta(metaPendingFrameKey, pendingFrame{hdr: hdr, payload: payload})
+		}
+	}
+	conn.SetMeta(header.MetaHeaderVersionKey, ver)
+	return nil
+}
+
+// dispatchPendingFrame 分发协商阶段暂存的首帧（若有），需在连接的接收回调就绪后调用。
+func dispatchPendingFrame(conn core.IConnection) {
+	v, ok := conn.GetMeta(metaPendingFrameKey)
+	if !ok {
+		return
+	}
+	conn.SetMeta(metaPendingFrameKey, nil)
+	if f, ok := v.(pendingFrame); ok {
+		conn.DispatchReceive(f.hdr, f.payload)
+	}
+}
+
+// answerNegotiation 在子连接读取循环开始前窥视首帧：若为版本报价则应答并记录协商结果，
+// 否则把该帧按普通帧分发。首帧始终按 v2 解码（报价帧以 v2 承载），读取受 firstRead 期限约束，
+// 返回前清除该期限，读取循环按自身的超时配置重新设置。期限内一字节都未收到时视为不发起协商的
+// 旧版子节点（可能只等下行帧），直接进入读取循环；已读到部分字节后超时仍返回错误。
+func (s *Server) answerNegotiation(conn core.IConnection) error {
+	pipe := conn.Pipe()
+	if pipe == nil {
+		return errors.New("nil pipe")
+	}
+	stop := context.AfterFunc(s.ctx, func() { _ = pipe.Close() })
+	defer stop()
+	if dl, ok := pipe.(core.IReadDeadlinePipe); ok && s.negotiate.firstRead > 0 {
+		_ = dl.SetReadDeadline(time.Now().Add(s.negotiate.firstRead))
+		defer func() { _ = dl.SetReadDeadline(time.Time{}) }()
+	}
+	cr := &countingReader{r: pipe}
+	hdr, payload, err := header.HeaderTcpCodec{}.Decode(cr)
+	if err != nil {
+		if cr.n == 0 && errors.Is(err, os.ErrDeadlineExceeded) {
+			s.log.Debug("no version offer from child, keep default codec", "conn", conn.ID())
+			return nil
+		}
+		return err
+	}
+	remote, err := header.ParseVersionOffer(hdr, payload)
+	if err != nil {
+		conn.DispatchReceive(hdr, payload)
+		return nil
+	}
+	ver, err := header.AnswerVersionOffer(pipe, s.negotiate.versions, remote)
+	if err != nil {
+		return err
+	}
+	conn.SetMeta(header.MetaHeaderVersionKey, ver)
+	return nil
+}
+
+// countingReader 记录已读字节数，用于区分“子节点沉默”与“首帧读到一半”。
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,56 @@
+package server
+
+// 本文件承载 Core 框架中与 `parent_auth` 相关的通用逻辑。
+
+import (
+	"context"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/bootstrap"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+)
+
+// authenticateParent 在父链路加入管理器前执行 SubProto=2 的 register（可选 login），
+// 返回父节点分配的 node_id。未配置 parent.self_id 时跳过并返回 0，保持旧行为。
+func (s *Server) authenticateParent(ctx context.Context, conn core.IConnection) (uint32, error) {
+	if s.parent == nil || s.parent.selfID == "" {
+		return 0, nil
+	}
+	nodeID, cred, err := bootstrap.RegisterOnConn(ctx, conn, bootstrap.SelfRegisterOptions{
+		SelfID:     s.parent.selfID,
+		JoinPermit: s.parent.joinPermit,
+		DoLogin:    s.parent.login,
+		Timeout:    s.parent.authTimeout,
+		Logger:     s.log,
+		Codec:      s.codecFor(conn),
+		Credential: s.parentCredential(),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if cred != "" && s.cfg != nil {
+		s.cfg.Set(coreconfig.KeyParentCredential, cred)
+	}
+	return nodeID, nil
+}
+
+// parentCredential 每次握手时读取 parent.credential，使运行期写入（如 bootstrap.RegisterAndBind）立即生效。
+func (s *Server) parentCredential() string {
+	if s.cfg == nil {
+		return ""
+	}
+	raw, _ := s.cfg.Get(coreconfig.KeyParentCredential)
+	return strings.TrimSpace(raw)
+}
+
+// adoptParentNodeID 采用活动父链路分配的 node_id；0 表示未注册，保持原值。
+func (s *Server) adoptParentNodeID(nodeID uint32) {
+	if nodeID == 0 {
+		return
+	}
+	if nodeID != s.NodeID() {
+		s.log.Info("node id assigned by parent", "old", s.NodeID(), "new", nodeID)
+	}
+	s.UpdateNodeID(nodeID)
+}
@@ -0,0 +1,125 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `parent_auth` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// stubParent 模拟父节点：要求首帧必须是 register，应答分配的 node_id 后才下发业务帧。
+type stubParent struct {
+	mu   sync.Mutex
+	regs []string // 收到的 register 的 device_id
+	errs chan error
+}
+
+func (p *stubParent) serve(side net.Conn, nodeID uint32, closeAfter bool) {
+	codec := header.HeaderTcpCodec{}
+	hdr, payload, err := codec.Decode(side)
+	if err != nil {
+		p.errs <- fmt.Errorf("read first frame: %w", err)
+		return
+	}
+	var msg struct {
+		Action string `json:"action"`
+		Data   struct {
+			DeviceID string `json:"device_id"`
+		} `json:"data"`
+	}
+	_ = json.Unmarshal(payload, &msg)
+	if hdr.SubProto() != 2 || hdr.Major() != header.MajorCmd || msg.Action != "register" {
+		p.errs <- fmt.Errorf("first frame is not register: subproto=%d major=%d action=%q", hdr.SubProto(), hdr.Major(), msg.Action)
+		return
+	}
+	p.mu.Lock()
+	p.regs = append(p.regs, msg.Data.DeviceID)
+	p.mu.Unlock()
+
+	resp, _ := json.Marshal(map[string]any{
+		"action": "register_resp",
+		"data":   map[string]any{"code": 1, "node_id": nodeID, "status": "approved"},
+	})
+	respHdr := (&header.HeaderTcp{}).WithMajor(header.MajorOKResp).WithSubProto(2).WithSourceID(1).WithTargetID(0).WithMsgID(hdr.GetMsgID())
+	frame, _ := codec.Encode(respHdr, resp)
+	if _, err := side.Write(frame); err != nil {
+		p.errs <- fmt.Errorf("write register resp: %w", err)
+		return
+	}
+	// 握手完成后下发一条业务帧，子节点应能收到。
+	data := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(1).WithTargetID(nodeID).WithMsgID(100 + nodeID)
+	frame, _ = codec.Encode(data, []byte("hello"))
+	if _, err := side.Write(frame); err != nil {
+		p.errs <- fmt.Errorf("write data frame: %w", err)
+		return
+	}
+	if closeAfter {
+		time.Sleep(20 * time.Millisecond)
+		_ = side.Close()
+	}
+}
+
+func TestServerParentLinkRegistersBeforeFramesFlowAndOnReconnect(t *testing.T) {
+	conn1, side1 := newNamedPipeConn(t, "parent-1")
+	conn2, side2 := newNamedPipeConn(t, "parent-2")
+	parent := &stubParent{errs: make(chan error, 4)}
+	go parent.serve(side1, 42, true)
+	go parent.serve(side2, 43, false)
+
+	var dials atomic.Int32
+	proc := newRecordProcess()
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Process = proc
+		o.Config = config.NewMap(map[string]string{
+			config.KeyParentEnable: "true",
+			config.KeyParentAddr:   "stub",
+			config.KeyParentSelfID: "hub-self",
+		})
+		o.ParentDialer = func(context.Context, string) (core.IConnection, error) {
+			if dials.Add(1) == 1 {
+				return conn1, nil
+			}
+			return conn2, nil
+		}
+	})
+	srv.sleep = func(ctx context.Context, _ time.Duration) bool { return ctx.Err() == nil }
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	for _, wantNode := range []uint32{42, 43} {
+		select {
+		case hdr := <-proc.recv:
+			if hdr.GetMsgID() != 100+wantNode {
+				t.Fatalf("received msg=%d, want %d", hdr.GetMsgID(), 100+wantNode)
+			}
+		case err := <-parent.errs:
+			t.Fatalf("stub parent: %v", err)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("data frame for node %d not received", wantNode)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for srv.NodeID() != 43 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if srv.NodeID() != 43 {
+		t.Fatalf("NodeID=%d, want 43 after re-register", srv.NodeID())
+	}
+	parent.mu.Lock()
+	defer parent.mu.Unlock()
+	if len(parent.regs) != 2 || parent.regs[0] != "hub-self" || parent.regs[1] != "hub-self" {
+		t.Fatalf("registrations=%v, want two registrations as hub-self", parent.regs)
+	}
+}
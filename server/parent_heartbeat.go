@@ -0,0 +1,62 @@
+package server
+
+// 本文件承载 Core 框架中与 `parent_heartbeat` 相关的通用逻辑。
+
+import (
+	"context"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// watchParentHeartbeat 按 parent.heartbeat_sec 向活动父链路发送心跳 ping；连续 heartbeatMisses 次
+// ping 之后都没有收到 pong 时，认为父节点在应用层已失去响应（即使 socket 仍然打开），主动关闭链路，
+// 由 runParentLink 的移除等待照常走热备提升或退避重连。pong 由读取循环记入连接元数据（header.LastPong）。
+// 返回的 stop 会等待监视协程退出。
+func (s *Server) watchParentHeartbeat(ctx context.Context, link *parentLink) (stop func()) {
+	interval, limit, sub := s.parent.heartbeatInterval, s.parent.heartbeatMisses, s.parent.heartbeatSub
+	if interval <= 0 || sub == 0 {
+		return func() {}
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var lastPing time.Time
+		misses := 0
+		for {
+			select {
+			case <-wctx.Done():
+				return
+			case <-link.down:
+				return
+			case <-ticker.C:
+			}
+			if !lastPing.IsZero() {
+				if header.LastPong(link.conn).Before(lastPing) {
+					misses++
+				} else {
+					misses = 0
+				}
+			}
+			if misses >= limit {
+				s.log.Warn("parent heartbeat lost, closing link", "addr", link.addr, "conn", link.conn.ID(), "missed", misses)
+				core.MarkCloseReason(link.conn, core.CloseReasonHeartbeat)
+				_ = link.conn.Close()
+				return
+			}
+			hdr, payload := header.NewPingFrame(sub)
+			lastPing = time.Now()
+			if err := link.conn.SendWithHeader(hdr, payload, s.codecFor(link.conn)); err != nil {
+				s.log.Debug("parent heartbeat ping failed", "conn", link.conn.ID(), "err", err)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
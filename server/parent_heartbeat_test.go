@@ -0,0 +1,73 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `parent_heartbeat` 相关的行为。
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/events"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/reader"
+)
+
+func TestParentHeartbeatMissedPongsTriggerReconnect(t *testing.T) {
+	const hbSub = 9
+	f := newParentFixture(t, "primary", "secondary")
+	// primary 的 socket 保持打开并照常读取，但从不回 pong，模拟应用层失去响应。
+	go func() { _, _ = io.Copy(io.Discard, f.sides["primary"]) }()
+	// secondary 由带心跳的读取循环应答 ping。
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	peer := tcp_listener.NewTCPConnection(f.sides["secondary"])
+	go func() {
+		_ = reader.NewTCPWithOptions(reader.Options{HeartbeatSubProto: hbSub}).ReadLoop(ctx, peer, header.HeaderTcpCodec{})
+	}()
+
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Config = config.NewMap(map[string]string{
+			config.KeyParentEnable:            "true",
+			config.KeyParentAddrs:             "primary, secondary",
+			config.KeyReaderHeartbeatSubProto: "9",
+			config.KeyParentHeartbeatMisses:   "2",
+		})
+		o.ParentDialer = f.dial
+	})
+	srv.parent.heartbeatInterval = 10 * time.Millisecond
+	srv.sleep = func(ctx context.Context, _ time.Duration) bool { return sleepCtx(ctx, 5*time.Millisecond) }
+	rec := recordEvents(srv.EventBus(), events.ParentConnected, events.ParentLost)
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	first := rec.wait(t, events.ParentConnected).(events.ParentConnectedData)
+	if first.Addr != "primary" {
+		t.Fatalf("first parent.connected=%+v, want primary", first)
+	}
+	lost := rec.wait(t, events.ParentLost).(events.ParentLostData)
+	if lost.ConnID != first.ConnID {
+		t.Fatalf("parent.lost=%+v, want primary conn %q", lost, first.ConnID)
+	}
+	if reason := core.CloseReasonOf(f.conns["primary"]); reason != core.CloseReasonHeartbeat {
+		t.Fatalf("primary close reason=%q, want %q", reason, core.CloseReasonHeartbeat)
+	}
+	second := rec.wait(t, events.ParentConnected).(events.ParentConnectedData)
+	if second.Addr != "secondary" {
+		t.Fatalf("second parent.connected=%+v, want secondary", second)
+	}
+
+	// 应答 pong 的父节点在多个心跳周期后仍保持连接。
+	time.Sleep(100 * time.Millisecond)
+	if _, ok := srv.ConnManager().Get(second.ConnID); !ok {
+		t.Fatalf("responsive parent link %q was dropped", second.ConnID)
+	}
+	if !header.LastPong(f.conns["secondary"]).After(time.Now().Add(-50 * time.Millisecond)) {
+		t.Fatalf("no recent pong recorded on the secondary link")
+	}
+}
@@ -0,0 +1,289 @@
+package server
+
+// 本文件承载 Core 框架中与 `parent_link` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/bootstrap"
+	"github.com/yttydcs/myflowhub-core/events"
+)
+
+// parentLink 描述一条已完成协商/注册的父链路。
+type parentLink struct {
+	conn   core.IConnection
+	addr   string
+	idx    int    // 在 parent.addrs 中的下标
+	nodeID uint32 // 该父节点分配的 node_id，0 表示未注册
+	down   chan struct{}
+}
+
+type parentState struct {
+	parentConfig
+	mu      sync.Mutex
+	active  *parentLink
+	standby *parentLink
+}
+
+// hasParent 判断当前配置是否真的启用了父链路，而不是只保留了默认空值。
+func (p *parentState) hasParent() bool {
+	return p != nil && p.enable && len(p.addrs) > 0
+}
+
+// track 在连接加入管理器前登记为活动或热备链路，确保随后的移除事件一定能唤醒等待方。
+func (p *parentState) track(l *parentLink, standby bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if standby {
+		p.standby = l
+	} else {
+		p.active = l
+	}
+}
+
+// untrack 撤销尚未生效的登记（如加入管理器失败）。
+func (p *parentState) untrack(l *parentLink) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active == l {
+		p.active = nil
+	}
+	if p.standby == l {
+		p.standby = nil
+	}
+}
+
+// takeStandby 把热备链路提升为活动链路并清除其热备标记；无热备时返回 nil。
+func (p *parentState) takeStandby() *parentLink {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	l := p.standby
+	if l == nil {
+		return nil
+	}
+	p.standby = nil
+	p.active = l
+	l.conn.SetMeta(core.MetaParentStandbyKey, false)
+	return l
+}
+
+// standbyLink 返回当前热备链路。
+func (p *parentState) standbyLink() *parentLink {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.standby
+}
+
+// notifyDown 在父连接被移除时关闭对应的等待通道，唤醒重连或热备循环。
+func (p *parentState) notifyDown(id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id == "" {
+		return
+	}
+	if p.active != nil && p.active.conn.ID() == id {
+		close(p.active.down)
+		p.active = nil
+	}
+	if p.standby != nil && p.standby.conn.ID() == id {
+		close(p.standby.down)
+		p.standby = nil
+	}
+}
+
+// runParentLink 维持父链路的长连接与重连循环，使边节点在父节点可用后自动重新挂回。
+// 配置多个地址时按顺序连接第一个可达者；断开后从下一个地址开始尝试，若有热备则直接提升。
+func (s *Server) runParentLink(ctx context.Context) {
+	if s.parent == nil || !s.parent.hasParent() {
+		return
+	}
+	dial := s.opts.ParentDialer
+	if dial == nil {
+		dial = defaultTCPParentDialer(s.opts.ConnIDGenerator)
+	}
+	backoff := bootstrap.NewReconnectBackoff(s.parent.reconnectMin, s.parent.reconnectMax, s.parent.jitter)
+	// wait 按退避等待下一次重连，返回 false 表示服务已停止。
+	wait := func() bool {
+		d := backoff.Next()
+		s.log.Debug("parent reconnect backoff", "addrs", s.parent.addrs, "wait", d)
+		return s.sleep(ctx, d)
+	}
+	start := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+		link := s.parent.takeStandby()
+		promoted := link != nil
+		if promoted {
+			s.adoptParentNodeID(link.nodeID)
+			s.log.Info("parent standby promoted", "addr", link.addr, "conn", link.conn.ID())
+		} else if link = s.connectParent(ctx, dial, start, -1, false); link == nil {
+			if !wait() {
+				return
+			}
+			continue
+		} else {
+			s.log.Info("parent connected", "addr", link.addr, "conn", link.conn.ID())
+		}
+		connectedAt := s.now()
+		s.publishParentReady(link)
+		s.publishEvent(events.ParentConnected, events.ParentConnectedData{
+			Addr:     link.addr,
+			ConnID:   link.conn.ID(),
+			NodeID:   link.nodeID,
+			Promoted: promoted,
+		})
+		stopStandby := s.startParentStandby(ctx, dial, link.idx)
+		stopHeartbeat := s.watchParentHeartbeat(ctx, link)
+		select {
+		case <-ctx.Done():
+			stopStandby()
+			s.eb.ClearRetained(EventParentReady)
+			_ = link.conn.Close()
+			stopHeartbeat()
+			return
+		case <-link.down:
+			stopStandby()
+			stopHeartbeat()
+			s.eb.ClearRetained(EventParentReady)
+			s.publishEvent(events.ParentLost, events.ParentLostData{
+				Addr:   link.addr,
+				ConnID: link.conn.ID(),
+				NodeID: link.nodeID,
+			})
+			backoff.Connected(s.now().Sub(connectedAt))
+			start = (link.idx + 1) % len(s.parent.addrs)
+			if s.parent.standbyLink() != nil {
+				s.log.Warn("parent connection closed, failing over to standby", "addr", link.addr)
+				continue
+			}
+			s.log.Warn("parent connection closed, retrying", "addr", link.addr)
+			if !wait() {
+				return
+			}
+		}
+	}
+}
+
+// EventParentReady 父链路建立（含热备提升）时以保留方式发布的事件名，断开时清除；
+// 晚于链路建立才订阅的组件也能立即得知当前父节点。数据为 {"addr","conn_id","node_id"}。
+const EventParentReady = events.ParentReady
+
+// publishParentReady 发布保留的 parent.ready 事件。
+func (s *Server) publishParentReady(link *parentLink) {
+	err := s.eb.PublishRetained(core.WithServerContext(s.ctx, s), EventParentReady, map[string]any{
+		"addr":    link.addr,
+		"conn_id": link.conn.ID(),
+		"node_id": link.nodeID,
+	}, nil)
+	if err != nil {
+		s.log.Debug("parent.ready event not delivered", "err", err)
+	}
+}
+
+// startParentStandby 在启用热备且存在其他地址时，于后台维持一条到下一个可达父节点的热备链路。
+// 返回的 stop 会等待后台循环退出，但保留已建立的热备链路以便随后提升。
+func (s *Server) startParentStandby(ctx context.Context, dial ParentDialer, activeIdx int) (stop func()) {
+	if !s.parent.hotStandby || len(s.parent.addrs) < 2 {
+		return func() {}
+	}
+	sctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		backoff := bootstrap.NewReconnectBackoff(s.parent.reconnectMin, s.parent.reconnectMax, s.parent.jitter)
+		for sctx.Err() == nil {
+			link := s.parent.standbyLink()
+			if link == nil {
+				link = s.connectParent(sctx, dial, activeIdx+1, activeIdx, true)
+			}
+			if link == nil {
+				if !s.sleep(sctx, backoff.Next()) {
+					return
+				}
+				continue
+			}
+			backoff.Reset()
+			select {
+			case <-sctx.Done():
+				return
+			case <-link.down:
+				s.log.Warn("parent standby closed", "addr", link.addr)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// connectParent 从 start 开始按顺序尝试各地址（跳过 exclude），返回第一条成功加入管理器的链路；
+// 全部失败时返回 nil。
+func (s *Server) connectParent(ctx context.Context, dial ParentDialer, start, exclude int, standby bool) *parentLink {
+	n := len(s.parent.addrs)
+	for i := 0; i < n; i++ {
+		idx := (start + i) % n
+		if idx == exclude {
+			continue
+		}
+		addr := s.parent.addrs[idx]
+		conn, nodeID, err := s.dialParent(ctx, dial, addr, standby)
+		if err != nil {
+			s.log.Warn("connect parent failed", "addr", addr, "standby", standby, "err", err)
+			if ctx.Err() != nil {
+				return nil
+			}
+			continue
+		}
+		link := &parentLink{conn: conn, addr: addr, idx: idx, nodeID: nodeID, down: make(chan struct{})}
+		if !standby {
+			s.adoptParentNodeID(nodeID)
+		}
+		s.parent.track(link, standby)
+		if err := s.cm.Add(conn); err != nil {
+			s.parent.untrack(link)
+			s.log.Warn("add parent connection failed", "addr", addr, "err", err)
+			_ = conn.Close()
+			continue
+		}
+		if standby {
+			s.log.Info("parent standby connected", "addr", addr, "conn", conn.ID())
+		}
+		return link
+	}
+	return nil
+}
+
+// dialParent 拨号并完成头版本协商与注册，返回尚未加入管理器的父连接及分配的 node_id。
+func (s *Server) dialParent(ctx context.Context, dial ParentDialer, addr string, standby bool) (core.IConnection, uint32, error) {
+	conn, err := dial(ctx, addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	if conn == nil {
+		return nil, 0, errors.New("dial parent returned nil conn")
+	}
+	core.SetConnRole(conn, core.RoleParent)
+	if standby {
+		conn.SetMeta(core.MetaParentStandbyKey, true)
+	}
+	if err := s.negotiateParent(conn); err != nil {
+		_ = conn.Close()
+		return nil, 0, fmt.Errorf("header negotiation: %w", err)
+	}
+	// 每次（重）连都重新注册，通过后才加入管理器开始收发业务帧。
+	nodeID, err := s.authenticateParent(ctx, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, 0, fmt.Errorf("register: %w", err)
+	}
+	return conn, nodeID, nil
+}
@@ -0,0 +1,197 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `parent_link` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/process"
+)
+
+// parentFixture 为每个父地址准备一条 pipe 连接，并可模拟地址不可达。
+type parentFixture struct {
+	mu    sync.Mutex
+	conns map[string]core.IConnection
+	sides map[string]net.Conn
+	dead  map[string]bool
+	dials map[string]int
+}
+
+func newParentFixture(t *testing.T, addrs ...string) *parentFixture {
+	f := &parentFixture{conns: map[string]core.IConnection{}, sides: map[string]net.Conn{}, dead: map[string]bool{}, dials: map[string]int{}}
+	for _, addr := range addrs {
+		f.conns[addr], f.sides[addr] = newNamedPipeConn(t, addr)
+	}
+	return f
+}
+
+func (f *parentFixture) dial(_ context.Context, addr string) (core.IConnection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dials[addr]++
+	if f.dead[addr] || f.dials[addr] > 1 {
+		return nil, errors.New("unreachable")
+	}
+	return f.conns[addr], nil
+}
+
+// kill 模拟父节点宕机：断开现有链路且不再接受拨号。
+func (f *parentFixture) kill(addr string) {
+	f.mu.Lock()
+	f.dead[addr] = true
+	f.mu.Unlock()
+	_ = f.sides[addr].Close()
+}
+
+func (f *parentFixture) dialCount(addr string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.dials[addr]
+}
+
+// startMultiParentServer 启动带两个父地址的 hub，子连接 node 11 的帧经 PreRouting 上送父节点。
+func startMultiParentServer(t *testing.T, f *parentFixture, hotStandby string) (*Server, net.Conn) {
+	t.Helper()
+	child, childSide := newNamedPipeConn(t, "child-11")
+	core.SetConnNodeID(child, 11)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{child}}, func(o *Options) {
+		o.Process = process.NewPreRoutingProcess(nil)
+		o.Config = config.NewMap(map[string]string{
+			config.KeyParentEnable:     "true",
+			config.KeyParentAddrs:      "primary, secondary",
+			config.KeyParentHotStandby: hotStandby,
+		})
+		o.ParentDialer = f.dial
+	})
+	srv.sleep = func(ctx context.Context, _ time.Duration) bool { return sleepCtx(ctx, 5*time.Millisecond) }
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+	return srv, childSide
+}
+
+// sendUpstream 让子节点发出一帧本地不可达的消息，预期被转发给活动父节点。
+func sendUpstream(t *testing.T, childSide net.Conn, msgID uint32) {
+	t.Helper()
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(11).WithTargetID(99).WithMsgID(msgID)
+	frame, err := header.HeaderTcpCodec{}.Encode(h, []byte("up"))
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if _, err := childSide.Write(frame); err != nil {
+		t.Fatalf("child write: %v", err)
+	}
+}
+
+func expectUpstream(t *testing.T, side net.Conn, msgID uint32) {
+	t.Helper()
+	_ = side.SetReadDeadline(time.Now().Add(2 * time.Second))
+	hdr, _, err := header.HeaderTcpCodec{}.Decode(side)
+	if err != nil {
+		t.Fatalf("read upstream frame: %v", err)
+	}
+	if hdr.GetMsgID() != msgID {
+		t.Fatalf("upstream msg=%d, want %d", hdr.GetMsgID(), msgID)
+	}
+}
+
+func waitParentActive(t *testing.T, srv *Server, addr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		srv.parent.mu.Lock()
+		active := srv.parent.active
+		srv.parent.mu.Unlock()
+		if active != nil && active.addr == addr {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("parent %q did not become active", addr)
+}
+
+func TestServerParentFailoverToSecondaryAddress(t *testing.T) {
+	f := newParentFixture(t, "primary", "secondary")
+	srv, childSide := startMultiParentServer(t, f, "false")
+
+	waitParentActive(t, srv, "primary")
+	if n := f.dialCount("secondary"); n != 0 {
+		t.Fatalf("secondary dialed %d times before failover, want 0", n)
+	}
+	sendUpstream(t, childSide, 1)
+	expectUpstream(t, f.sides["primary"], 1)
+
+	f.kill("primary")
+	waitParentActive(t, srv, "secondary")
+	sendUpstream(t, childSide, 2)
+	expectUpstream(t, f.sides["secondary"], 2)
+}
+
+func TestServerParentHotStandbyPromotedOnPrimaryLoss(t *testing.T) {
+	f := newParentFixture(t, "primary", "secondary")
+	srv, childSide := startMultiParentServer(t, f, "true")
+
+	waitParentActive(t, srv, "primary")
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.parent.standbyLink() == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if srv.parent.standbyLink() == nil {
+		t.Fatalf("hot standby to secondary not established")
+	}
+	// 两条父链路同时在线时，转发只走活动链路。
+	sendUpstream(t, childSide, 1)
+	expectUpstream(t, f.sides["primary"], 1)
+
+	f.kill("primary")
+	waitParentActive(t, srv, "secondary")
+	if n := f.dialCount("secondary"); n != 1 {
+		t.Fatalf("secondary dialed %d times, want 1 (standby promoted without redial)", n)
+	}
+	sendUpstream(t, childSide, 2)
+	expectUpstream(t, f.sides["secondary"], 2)
+}
+
+// nextParentReady 订阅 parent.ready 并返回收到的第一条事件中的父地址。
+func nextParentReady(t *testing.T, srv *Server) string {
+	t.Helper()
+	got := make(chan string, 4)
+	tok := srv.EventBus().Subscribe(EventParentReady, func(_ context.Context, evt eventbus.Event) {
+		got <- evt.Data.(map[string]any)["addr"].(string)
+	})
+	defer srv.EventBus().Unsubscribe(EventParentReady, tok)
+	select {
+	case addr := <-got:
+		return addr
+	case <-time.After(2 * time.Second):
+		t.Fatal("parent.ready not delivered")
+		return ""
+	}
+}
+
+func TestServerParentReadyRetainedForLateSubscribers(t *testing.T) {
+	f := newParentFixture(t, "primary", "secondary")
+	srv, _ := startMultiParentServer(t, f, "false")
+
+	waitParentActive(t, srv, "primary")
+	// 链路建立之后才订阅，仍能立即拿到当前父节点。
+	if addr := nextParentReady(t, srv); addr != "primary" {
+		t.Fatalf("parent.ready addr=%q, want primary", addr)
+	}
+
+	f.kill("primary")
+	waitParentActive(t, srv, "secondary")
+	if addr := nextParentReady(t, srv); addr != "secondary" {
+		t.Fatalf("parent.ready addr=%q after failover, want secondary", addr)
+	}
+}
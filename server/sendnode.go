@@ -0,0 +1,67 @@
+package server
+
+// 本文件承载 Core 框架中与 `sendnode` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+)
+
+var (
+	// ErrConnNotFound 表示 Send 指定的连接不在连接管理器中。
+	ErrConnNotFound = errors.New("conn not found")
+	// ErrNodeNotFound 表示 SendToNode 在全部尝试内都没有找到绑定该 nodeID 的连接。
+	ErrNodeNotFound = errors.New("node not found")
+)
+
+// nodeRetryConfig 控制 SendToNode 对短暂不可达节点的重试。
+type nodeRetryConfig struct {
+	attempts int           // 首次之外的重试次数
+	delay    time.Duration // 每次重试前的等待
+}
+
+// buildNodeRetryConfig 读取 send.node_retry_attempts / send.node_retry_delay_ms；缺省不重试。
+func buildNodeRetryConfig(cfg core.IConfig) nodeRetryConfig {
+	var rc nodeRetryConfig
+	if cfg == nil {
+		return rc
+	}
+	if raw, ok := cfg.Get(coreconfig.KeySendNodeRetryAttempts); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			rc.attempts = v
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeySendNodeRetryDelayMS); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v >= 0 {
+			rc.delay = time.Duration(v) * time.Millisecond
+		}
+	}
+	return rc
+}
+
+// SendToNode 按节点索引查找 nodeID 当前绑定的连接并经 Send 发出。
+// 节点刚重连时索引可能短暂缺失（旧连接已移除、新连接尚未完成绑定），因此在找不到节点或连接
+// 在查找与发送之间被移除时，按 send.node_retry_attempts 重试，每次等待 send.node_retry_delay_ms 后重新查找；
+// 其余错误不重试。全部尝试失败返回 ErrNodeNotFound，ctx 取消时返回 ctx.Err()。
+func (s *Server) SendToNode(ctx context.Context, nodeID uint32, hdr core.IHeader, payload []byte) error {
+	for attempt := 0; ; attempt++ {
+		err := ErrNodeNotFound
+		if conn, ok := s.cm.GetByNode(nodeID); ok && conn != nil {
+			err = s.Send(ctx, conn.ID(), hdr, payload)
+		}
+		if !errors.Is(err, ErrNodeNotFound) && !errors.Is(err, ErrConnNotFound) {
+			return err
+		}
+		if attempt >= s.nodeRetry.attempts {
+			return ErrNodeNotFound
+		}
+		if !s.sleep(ctx, s.nodeRetry.delay) {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `sendnode` 相关的行为。
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+func TestSendToNodeRetriesUntilNodeRebinds(t *testing.T) {
+	conn, client := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Config = config.NewMap(map[string]string{
+			config.KeySendNodeRetryAttempts: "2",
+			config.KeySendNodeRetryDelayMS:  "30",
+		})
+	})
+	// 首次查找失败后的等待期间节点完成重连绑定。
+	var slept []time.Duration
+	srv.sleep = func(ctx context.Context, d time.Duration) bool {
+		slept = append(slept, d)
+		if len(slept) == 1 {
+			core.SetConnNodeID(conn, 9)
+			if err := srv.ConnManager().Add(conn); err != nil {
+				t.Errorf("Add: %v", err)
+			}
+			srv.ConnManager().UpdateNodeIndex(9, conn)
+		}
+		return ctx.Err() == nil
+	}
+
+	got := make(chan core.IHeader, 1)
+	go func() {
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		hdr, _, err := header.HeaderTcpCodec{}.Decode(client)
+		if err == nil {
+			got <- hdr
+		}
+		close(got)
+	}()
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithTargetID(9).WithMsgID(3)
+	if err := srv.SendToNode(context.Background(), 9, hdr, []byte("x")); err != nil {
+		t.Fatalf("SendToNode: %v", err)
+	}
+	if len(slept) != 1 || slept[0] != 30*time.Millisecond {
+		t.Fatalf("slept=%v, want one 30ms wait", slept)
+	}
+	if h := <-got; h == nil || h.GetMsgID() != 3 {
+		t.Fatalf("frame not delivered after rebind: %v", h)
+	}
+}
+
+func TestSendToNodeGivesUpAfterAttempts(t *testing.T) {
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Config = config.NewMap(map[string]string{config.KeySendNodeRetryAttempts: "2"})
+	})
+	waits := 0
+	srv.sleep = func(context.Context, time.Duration) bool { waits++; return true }
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithTargetID(9)
+	if err := srv.SendToNode(context.Background(), 9, hdr, nil); !errors.Is(err, ErrNodeNotFound) || waits != 2 {
+		t.Fatalf("err=%v waits=%d, want ErrNodeNotFound after 2 retries", err, waits)
+	}
+
+	// 缺省不重试。
+	plain := newTestServer(t, &stubListener{}, nil)
+	plain.sleep = func(context.Context, time.Duration) bool {
+		t.Fatal("retried without send.node_retry_attempts")
+		return false
+	}
+	if err := plain.SendToNode(context.Background(), 9, hdr, nil); !errors.Is(err, ErrNodeNotFound) {
+		t.Fatalf("err=%v, want ErrNodeNotFound", err)
+	}
+}
@@ -10,13 +10,16 @@ import (
 	"log/slog"
 	"net"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	core "github.com/yttydcs/myflowhub-core"
 	coreconfig "github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
 	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/events"
 	"github.com/yttydcs/myflowhub-core/header"
 	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
 	"github.com/yttydcs/myflowhub-core/process"
@@ -26,6 +29,10 @@ import (
 // ReaderFactory 创建 IReader。
 type ReaderFactory func(conn core.IConnection) core.IReader
 
+// CodecFactory 按连接选择帧编解码器，通常读取握手阶段写入的连接元数据。
+// 返回 nil 表示沿用默认选择（协商出的头版本，否则 Options.Codec）。
+type CodecFactory func(conn core.IConnection) core.IHeaderCodec
+
 // ParentDialer 抽象父链路的拨号方式。
 //
 // 返回的连接必须已经满足加入连接管理器的条件。
@@ -34,70 +41,70 @@ type ParentDialer func(ctx context.Context, addr string) (core.IConnection, erro
 
 // Options 配置 Server。
 type Options struct {
-	Name          string
-	Logger        *slog.Logger
-	Process       core.IProcess
-	Codec         core.IHeaderCodec
-	Listener      core.IListener
-	Config        core.IConfig
-	Manager       core.IConnectionManager
-	ReaderFactory ReaderFactory
-	ParentDialer  ParentDialer
-	NodeID        uint32 // 可选：节点 ID，缺省为 1
+	Name            string
+	Logger          *slog.Logger
+	Process         core.IProcess
+	Codec           core.IHeaderCodec
+	Listener        core.IListener
+	Config          core.IConfig
+	Manager         core.IConnectionManager
+	ReaderFactory   ReaderFactory
+	CodecFactory    CodecFactory // 可选：按连接选择 codec，缺省对所有连接使用 Codec
+	ParentDialer    ParentDialer
+	NodeID          uint32               // 可选：节点 ID，缺省为 1
+	ConnIDGenerator core.ConnIDGenerator // 可选：默认 TCP 父链路拨号使用的连接 ID 生成器，缺省为 "local->remote"
+	EventBus        eventbus.IBus        // 可选：自定义事件总线（溢出策略、缓冲等），缺省为 eventbus.New(Options{})
+	Clock           process.Clock        // 可选：父链路重连/排空等待与发送入队超时使用的时间源，缺省为真实时间
+	FreezeConfig    bool                 // 可选：Config() 返回只读视图（config.Freeze），子协议经 Server 取到的配置无法改写
 }
 
 type parentConfig struct {
-	enable    bool
-	addr      string
-	reconnect time.Duration
-}
-
-type parentState struct {
-	parentConfig
-	mu     sync.Mutex
-	connID string
-	down   chan struct{}
-}
-
-// hasParent 判断当前配置是否真的启用了父链路，而不是只保留了默认空值。
-func (p *parentState) hasParent() bool {
-	return p != nil && p.enable && p.addr != ""
-}
-
-// setConn 记录当前父连接 ID，并返回一个会在该连接断开时关闭的信号通道。
-func (p *parentState) setConn(id string) <-chan struct{} {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	p.connID = id
-	p.down = make(chan struct{})
-	return p.down
-}
-
-// notifyDown 在父连接被移除时关闭等待通道，唤醒重连循环。
-func (p *parentState) notifyDown(id string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	if id != "" && id == p.connID && p.down != nil {
-		close(p.down)
-		p.down = nil
-		p.connID = ""
-	}
+	enable       bool
+	addrs        []string // 按优先级排列的父节点地址
+	hotStandby   bool     // 是否为下一个可达地址保持一条热备链路
+	joinPermit   string
+	selfID       string // 非空时启用父链路注册
+	login        bool
+	authTimeout  time.Duration
+	reconnectMin time.Duration
+	reconnectMax time.Duration
+	jitter       float64
+
+	heartbeatInterval time.Duration // 父链路应用层心跳间隔，0 表示关闭
+	heartbeatMisses   int           // 连续未收到 pong 的 ping 次数上限
+	heartbeatSub      uint8         // 心跳子协议，与 reader.heartbeat_subproto 一致
 }
 
 // Server 是 IServer 的具体实现，负责协调 listener/manager/process。
 type Server struct {
 	opts   Options
 	log    *slog.Logger
+	hotLog *core.ThrottledLogger // 读取错误等热点告警的限流日志
 	cm     core.IConnectionManager
 	proc   core.IProcess
 	codec  core.IHeaderCodec
 	cfg    core.IConfig
+	cfgRO  core.IConfig // FreezeConfig 时 Config() 返回的只读视图
 	lst    core.IListener
 	rFac   ReaderFactory
+	cFac   CodecFactory
 	nodeID atomic.Uint32
 	sender *process.SendDispatcher
 
-	parent *parentState
+	parent    *parentState
+	negotiate negotiateConfig
+
+	halfCloseGrace time.Duration // 对端半关闭后继续发送的宽限期，0 表示不启用
+	sessionTTL     time.Duration // 登录绑定时签发的会话有效期，0 表示不过期
+	nodeRetry      nodeRetryConfig
+	loopback       atomic.Value // core.IConnection，仅在配置 conn.loopback_id 时注册
+
+	historyCfg historyConfig
+	history    sync.Map // connID -> *ring[FrameRecord]，仅在开启 debug.recent_frames 时填充
+
+	// 以下钩子取自 Options.Clock，测试也可直接替换。
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) bool
 
 	eb eventbus.IBus
 
@@ -128,6 +135,26 @@ func nextTraceID() uint32 {
 	return v
 }
 
+// defaultReaderFactory 按 reader.* 配置构建读取循环；控制帧快速路径只应答发给本节点（或逐跳）的请求。
+func (s *Server) defaultReaderFactory() ReaderFactory {
+	readerOpts := reader.OptionsFromConfig(s.cfg, s.log)
+	readerOpts.LocalNodeID = s.NodeID
+	if readerOpts.PayloadPool && !readerOpts.CopyOnDispatch && !consumesPayloadSync(s.proc) {
+		// 处理器会在 OnReceive 返回后继续使用 payload（如 DispatcherProcess 排队交给 worker），池化缓冲必须先拷贝。
+		s.log.Info("reader.payload_pool with an asynchronous process, enabling reader.copy_on_dispatch")
+		readerOpts.CopyOnDispatch = true
+	}
+	return func(core.IConnection) core.IReader {
+		return reader.NewTCPWithOptions(readerOpts)
+	}
+}
+
+// consumesPayloadSync 判断处理器是否声明在 OnReceive 内用完 payload（见 core.ISyncPayloadProcess）。
+func consumesPayloadSync(p core.IProcess) bool {
+	sp, ok := p.(core.ISyncPayloadProcess)
+	return ok && sp.ConsumesPayloadSync()
+}
+
 // New 构建 Server。
 func New(opts Options) (*Server, error) {
 	if opts.Listener == nil {
@@ -148,36 +175,59 @@ func New(opts Options) (*Server, error) {
 	if opts.Logger == nil {
 		opts.Logger = slog.Default()
 	}
-	if opts.ReaderFactory == nil {
-		opts.ReaderFactory = func(core.IConnection) core.IReader {
-			return reader.NewTCP(opts.Logger)
-		}
-	}
 	if opts.NodeID == 0 {
 		opts.NodeID = 1
 	}
-	// 初始化发送调度器（使用同一配置来源）
-	var sendDisp *process.SendDispatcher
-	if sd, err := process.NewSendDispatcherFromConfig(opts.Config, opts.Logger); err == nil {
-		sendDisp = sd
-	} else {
+	if opts.Clock == nil {
+		opts.Clock = process.RealClock{}
+	}
+	// 初始化发送调度器（使用同一配置来源与时钟）
+	sendOpts := process.SendOptionsFromConfig(opts.Config, opts.Logger)
+	sendOpts.Clock = opts.Clock
+	sendDisp, err := process.NewSendDispatcher(sendOpts)
+	if err != nil {
 		return nil, err
 	}
 	parent := buildParentState(opts.Config)
 	s := &Server{
-		opts:   opts,
-		log:    opts.Logger,
-		cm:     opts.Manager,
-		proc:   opts.Process,
-		codec:  opts.Codec,
-		cfg:    opts.Config,
-		lst:    opts.Listener,
-		rFac:   opts.ReaderFactory,
-		sender: sendDisp,
-		parent: parent,
-		eb:     eventbus.New(eventbus.Options{}),
+		opts:           opts,
+		log:            opts.Logger,
+		hotLog:         core.NewThrottledLogger(opts.Logger, core.DefaultLogThrottle),
+		cm:             opts.Manager,
+		proc:           opts.Process,
+		codec:          opts.Codec,
+		cfg:            opts.Config,
+		lst:            opts.Listener,
+		rFac:           opts.ReaderFactory,
+		cFac:           opts.CodecFactory,
+		sender:         sendDisp,
+		parent:         parent,
+		negotiate:      buildNegotiateConfig(opts.Config),
+		historyCfg:     buildHistoryConfig(opts.Config),
+		halfCloseGrace: buildHalfCloseGrace(opts.Config),
+		sessionTTL:     buildSessionTTL(opts.Config),
+		nodeRetry:      buildNodeRetryConfig(opts.Config),
+		eb:             opts.EventBus,
+		now:            opts.Clock.Now,
+		sleep:          opts.Clock.Sleep,
+	}
+	if s.eb == nil {
+		s.eb = eventbus.New(eventbus.Options{})
 	}
 	s.nodeID.Store(opts.NodeID)
+	if s.rFac == nil {
+		s.rFac = s.defaultReaderFactory()
+	}
+	if opts.FreezeConfig {
+		s.cfgRO = coreconfig.Freeze(opts.Config)
+	}
+	if dp, ok := opts.Manager.(interface {
+		SetDuplicatePolicy(connmgr.DuplicatePolicy)
+	}); ok {
+		if raw, ok := opts.Config.Get(coreconfig.KeyAuthDuplicateLoginPolicy); ok {
+			dp.SetDuplicatePolicy(connmgr.DuplicatePolicyFromConfig(raw))
+		}
+	}
 	return s, nil
 }
 
@@ -192,13 +242,22 @@ func (s *Server) Start(ctx context.Context) error {
 	s.ctx = core.WithServerContext(s.ctx, s)
 	onAdd := func(c core.IConnection) {
 		if _, ok := c.GetMeta(core.MetaRoleKey); !ok {
-			c.SetMeta(core.MetaRoleKey, core.RoleChild)
+			core.SetConnRole(c, core.RoleChild)
+		}
+		if s.historyCfg.frames > 0 {
+			s.history.Store(c.ID(), newRing[FrameRecord](s.historyCfg.frames))
 		}
 		c.OnReceive(func(c core.IConnection, hdr core.IHeader, payload []byte) {
+			s.recordFrame(c, hdr, payload)
+			if core.ConnDraining(c) {
+				s.log.Debug("drop frame on draining conn", "conn", c.ID(), "subproto", hdr.SubProto())
+				return
+			}
 			ctx2 := core.WithServerContext(s.ctx, s)
 			s.proc.OnReceive(ctx2, c, hdr, payload)
 		})
 		s.proc.OnListen(c)
+		s.publishConnAdded(c)
 		s.wg.Add(1)
 		go s.serveConn(c)
 	}
@@ -207,17 +266,37 @@ func (s *Server) Start(ctx context.Context) error {
 			s.sender.CloseConn(c.ID())
 		}
 		s.proc.OnClose(c)
+		s.history.Delete(c.ID())
 		if s.parent != nil {
 			s.parent.notifyDown(c.ID())
 		}
-		if s.eb != nil {
-			_ = s.eb.Publish(core.WithServerContext(s.ctx, s), "conn.closed", map[string]any{
-				"conn_id": c.ID(),
-				"node_id": extractConnNodeID(c),
-			}, nil)
+		// 拆除路径不能被慢订阅者拖住：队列已满时按总线的溢出策略丢弃而不是阻塞。
+		if s.eb != nil && !s.eb.TryPublish(core.WithServerContext(s.ctx, s), "conn.closed", map[string]any{
+			"conn_id": c.ID(),
+			"node_id": core.ConnNodeID(c),
+			"reason":  string(core.CloseReasonOf(c)),
+		}, nil) {
+			s.log.Debug("conn.closed event dropped", "conn", c.ID())
+		}
+	}, OnReplaced: func(old, c core.IConnection) {
+		if s.eb != nil && !s.eb.TryPublish(core.WithServerContext(s.ctx, s), "conn.replaced", map[string]any{
+			"old_conn_id": old.ID(),
+			"new_conn_id": c.ID(),
+			"node_id":     core.ConnNodeID(c),
+			"device_id":   core.ConnDeviceID(c),
+		}, nil) {
+			s.log.Debug("conn.replaced event dropped", "old", old.ID(), "new", c.ID())
 		}
-	}})
+	}, OnNodeBound: s.onNodeBound})
+	if id := loopbackConnID(s.cfg); id != "" {
+		s.addLoopback(id)
+	}
 	s.start = true
+	s.publishEvent(events.ServerStarted, events.ServerStartedData{
+		Name:     s.opts.Name,
+		NodeID:   s.NodeID(),
+		Protocol: s.lst.Protocol(),
+	})
 	if s.parent.hasParent() {
 		go s.runParentLink(s.ctx)
 	}
@@ -242,14 +321,57 @@ func (s *Server) serveConn(conn core.IConnection) {
 		s.log.Error("no reader available", "conn", conn.ID())
 		return
 	}
-	if err := r.ReadLoop(s.ctx, conn, s.codec); err != nil {
-		s.log.Warn("read loop exit", "conn", conn.ID(), "err", err)
+	if err := s.bindCertIdentity(conn); err != nil {
+		s.log.Warn("cert identity bind rejected", "conn", conn.ID(), "err", err)
+		core.MarkCloseReason(conn, core.CloseReasonBindRejected)
+		if err := s.cm.Remove(conn.ID()); err != nil {
+			s.log.Debug("remove conn", "conn", conn.ID(), "err", err)
+		}
+		return
+	}
+	var err error
+	if s.negotiate.enable && !isParentRole(conn) && !isLoopbackConn(conn) {
+		err = s.answerNegotiation(conn)
+	}
+	dispatchPendingFrame(conn)
+	if err == nil {
+		err = r.ReadLoop(s.ctx, conn, s.codecFor(conn))
+	}
+	if err != nil {
+		kind := reader.ClassifyFrameErr(err)
+		// 按错误类别分别限流，故障期间大量连接同时断开也不会刷屏。
+		s.hotLog.Log(s.ctx, slog.LevelWarn, "read loop exit:"+string(kind), "read loop exit", "conn", conn.ID(), "kind", string(kind), "err", err)
+		if s.eb != nil {
+			s.eb.TryPublish(core.WithServerContext(s.ctx, s), "frame.error", map[string]any{
+				"conn_id": conn.ID(),
+				"node_id": core.ConnNodeID(conn),
+				"kind":    string(kind),
+				"error":   err.Error(),
+			}, nil)
+		}
 	}
+	s.drainHalfClosed(conn, err)
+	core.MarkCloseReason(conn, s.closeReasonFromReadErr(err))
 	if err := s.cm.Remove(conn.ID()); err != nil {
 		s.log.Debug("remove conn", "conn", conn.ID(), "err", err)
 	}
 }
 
+// closeReasonFromReadErr 把读取循环的退出错误归类为关闭原因。
+func (s *Server) closeReasonFromReadErr(err error) core.CloseReason {
+	if s.ctx != nil && s.ctx.Err() != nil {
+		return core.CloseReasonServerShutdown
+	}
+	switch reader.ClassifyFrameErr(err) {
+	case reader.FrameErrNone, reader.FrameErrEOF, reader.FrameErrClosed:
+		return core.CloseReasonClientEOF
+	case reader.FrameErrTimeout:
+		return core.CloseReasonIdleTimeout
+	default:
+		return core.CloseReasonReadError
+	}
+}
+
 // Stop 停止服务并释放资源。
 func (s *Server) Stop(ctx context.Context) error {
 	s.mu.Lock()
@@ -262,15 +384,30 @@ func (s *Server) Stop(ctx context.Context) error {
 	s.cancel = nil
 	s.mu.Unlock()
 
-	if cancel != nil {
-		cancel()
+	// 同步发布，订阅者可在连接被拆除前完成收尾（如向对端发告别帧）。
+	if s.eb != nil {
+		s.eb.PublishSync(s.eventCtx(), events.ServerStopping, events.ServerStoppingData{
+			Name:        s.opts.Name,
+			NodeID:      s.NodeID(),
+			Connections: s.cm.Count(),
+		}, nil)
 	}
+
+	s.cm.Range(func(c core.IConnection) bool {
+		core.MarkCloseReason(c, core.CloseReasonServerShutdown)
+		return true
+	})
+	// 先排空处理器与发送队列再取消服务 ctx：排队中的回包与 server.stopping 订阅者发出的告别帧
+	// 都携带派生自 s.ctx 的 ctx，提前取消会让它们以 context.Canceled 被跳过。
 	if d, ok := s.proc.(interface{ Shutdown() }); ok {
 		d.Shutdown()
 	}
 	if s.sender != nil {
 		s.sender.Shutdown()
 	}
+	if cancel != nil {
+		cancel()
+	}
 	_ = s.lst.Close()
 	if s.eb != nil {
 		s.eb.Close()
@@ -285,11 +422,19 @@ func (s *Server) Stop(ctx context.Context) error {
 	case <-ctx.Done():
 		return ctx.Err()
 	}
+	if c, ok := s.cm.(core.IContextCloser); ok {
+		return c.CloseAllContext(ctx)
+	}
 	return s.cm.CloseAll()
 }
 
-// Config 暴露运行时配置，供子协议或外部装配读取。
-func (s *Server) Config() core.IConfig { return s.cfg }
+// Config 暴露运行时配置，供子协议或外部装配读取；开启 Options.FreezeConfig 时为只读视图。
+func (s *Server) Config() core.IConfig {
+	if s.cfgRO != nil {
+		return s.cfgRO
+	}
+	return s.cfg
+}
 
 // ConnManager 返回连接管理器，供预路由和业务模块查询连接拓扑。
 func (s *Server) ConnManager() core.IConnectionManager { return s.cm }
@@ -297,9 +442,60 @@ func (s *Server) ConnManager() core.IConnectionManager { return s.cm }
 // Process 返回当前挂载的处理流程。
 func (s *Server) Process() core.IProcess { return s.proc }
 
-// HeaderCodec 返回当前发送/接收共用的帧编解码器。
+// HeaderCodec 返回默认帧编解码器；具体连接实际使用的 codec 见 CodecFor。
 func (s *Server) HeaderCodec() core.IHeaderCodec { return s.codec }
 
+// CodecFor 返回指定连接收发使用的帧编解码器。
+func (s *Server) CodecFor(conn core.IConnection) core.IHeaderCodec { return s.codecFor(conn) }
+
+// ConnectionNodes 返回绑定到 connID 的全部 nodeID（升序）；连接不存在时返回 false。
+// 连接管理器未实现 core.IConnNodeIndex 时只能给出连接元数据中的直连 nodeID。
+func (s *Server) ConnectionNodes(connID string) ([]uint32, bool) {
+	conn, ok := s.cm.Get(connID)
+	if !ok {
+		return nil, false
+	}
+	if idx, ok := s.cm.(core.IConnNodeIndex); ok {
+		return idx.NodesOfConn(connID), true
+	}
+	if nid := core.ConnNodeID(conn); nid != 0 {
+		return []uint32{nid}, true
+	}
+	return nil, true
+}
+
+// SnapshotConnections 返回全部连接的只读快照，供嵌入方的管理端展示；
+// 连接管理器未实现 core.IConnSnapshotter 时退回遍历连接元数据。
+func (s *Server) SnapshotConnections() []core.ConnInfo {
+	if snap, ok := s.cm.(core.IConnSnapshotter); ok {
+		return snap.SnapshotConnections()
+	}
+	var out []core.ConnInfo
+	s.cm.Range(func(c core.IConnection) bool {
+		out = append(out, core.ConnInfoOf(c))
+		return true
+	})
+	return out
+}
+
+// SnapshotIndexes 返回 node/device 索引的纯数据拷贝；不支持快照的管理器按连接元数据近似重建。
+func (s *Server) SnapshotIndexes() core.ConnIndexSnapshot {
+	if snap, ok := s.cm.(core.IConnSnapshotter); ok {
+		return snap.SnapshotIndexes()
+	}
+	out := core.ConnIndexSnapshot{Nodes: map[uint32][]string{}, Devices: map[string]string{}}
+	s.cm.Range(func(c core.IConnection) bool {
+		if nid := core.ConnNodeID(c); nid != 0 {
+			out.Nodes[nid] = append(out.Nodes[nid], c.ID())
+		}
+		if dev := core.ConnDeviceID(c); dev != "" {
+			out.Devices[dev] = c.ID()
+		}
+		return true
+	})
+	return out
+}
+
 // NodeID 返回当前节点号；该值可能在登录或配置同步后被更新。
 func (s *Server) NodeID() uint32 { return s.nodeID.Load() }
 
@@ -312,144 +508,129 @@ func (s *Server) UpdateNodeID(id uint32) {
 		return
 	}
 	s.nodeID.Store(id)
+	s.rebindLoopback(id)
 }
 
 // Send 为单连接发送补齐安全默认字段，并统一经过 process/sender 两层管线。
+// OnSend 对 hdr 的改写会原样编码写出；ctx 带 core.WithSendAudited 标记时跳过 OnSend。
+// 同一 goroutine 先后经 Send/Broadcast 发往同一连接的同优先级帧按调用顺序写出（见 process.SendDispatcher）。
 func (s *Server) Send(ctx context.Context, connID string, hdr core.IHeader, payload []byte) error {
 	if hdr == nil {
 		return errors.New("header required")
 	}
 	conn, ok := s.cm.Get(connID)
 	if !ok {
-		return errors.New("conn not found")
+		return ErrConnNotFound
 	}
-	// 安全默认：若发送侧未设置则自动补齐。
-	if hdr.GetHopLimit() == 0 {
-		hdr.WithHopLimit(header.DefaultHopLimit)
-	}
-	if hdr.GetTraceID() == 0 {
-		hdr.WithTraceID(nextTraceID())
-	}
-	if err := s.proc.OnSend(ctx, conn, hdr, payload); err != nil {
-		return err
+	fillSendDefaults(hdr)
+	if !core.SendAudited(ctx) {
+		if err := s.proc.OnSend(ctx, conn, hdr, payload); err != nil {
+			return err
+		}
 	}
+	codec := s.codecFor(conn)
+	notify := s.sendFailedNotifier(conn, hdr)
+	var err error
 	if s.sender == nil {
-		return conn.SendWithHeader(hdr, payload, s.codec)
+		err = conn.SendWithHeader(hdr, payload, codec)
+	} else {
+		err = s.sender.Dispatch(ctx, conn, hdr, payload, codec, notify)
 	}
-	return s.sender.Dispatch(ctx, conn, hdr, payload, s.codec, nil)
+	notify(err)
+	return err
 }
 
-// Broadcast 通过发送调度器广播一帧（不触发 OnSend 钩子对每个连接重复调用，仅一次校验）。
+// Broadcast 通过发送调度器广播一帧：默认字段只补齐一次，随后为每条连接克隆 hdr 并调用 OnSend，
+// 各连接的改写互不影响；OnSend 报错的连接跳过并计入返回错误。ctx 带 core.WithSendAudited 标记时
+// 不调用 OnSend 且所有连接共享同一 hdr。
+// 对每条连接而言，广播帧与该连接上的 Send 共用同一 writer，顺序保证与 Send 一致。
+// 返回值只包含 OnSend、入队阶段的错误以及返回前已完成写出的错误。
 func (s *Server) Broadcast(ctx context.Context, hdr core.IHeader, payload []byte) error {
 	if s.sender == nil {
 		return s.cm.Broadcast(payload) // 回退：原始 payload（假设已编码）
 	}
-	var firstErr error
+	if hdr == nil {
+		return errors.New("header required")
+	}
+	fillSendDefaults(hdr)
+	audited := core.SendAudited(ctx)
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	record := func(e error) {
+		if e == nil {
+			return
+		}
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = e
+		}
+		mu.Unlock()
+	}
 	s.cm.Range(func(c core.IConnection) bool {
-		// 不为每个连接重复调用 OnSend，假设 hdr/payload 已审计
-		if err := s.sender.Dispatch(ctx, c, hdr, payload, s.codec, func(e error) {
-			if e != nil && firstErr == nil {
-				firstErr = e
+		if isLoopbackConn(c) {
+			return true
+		}
+		frameHdr := hdr
+		if !audited {
+			frameHdr = hdr.Clone()
+			if err := s.proc.OnSend(ctx, c, frameHdr, payload); err != nil {
+				record(err)
+				return true
 			}
-		}); err != nil && firstErr == nil {
-			firstErr = err
 		}
+		notify := s.sendFailedNotifier(c, frameHdr)
+		cb := func(e error) {
+			record(e)
+			notify(e)
+		}
+		cb(s.sender.Dispatch(ctx, c, frameHdr, payload, s.codecFor(c), cb))
 		return true
 	})
+	mu.Lock()
+	defer mu.Unlock()
 	return firstErr
 }
 
-// runParentLink 维持父链路的长连接与重连循环，使边节点在父节点可用后自动重新挂回。
-func (s *Server) runParentLink(ctx context.Context) {
-	if s.parent == nil || !s.parent.hasParent() {
-		return
-	}
-	dial := s.opts.ParentDialer
-	if dial == nil {
-		dial = defaultTCPParentDialer
-	}
-	retry := s.parent.reconnect
-	if retry <= 0 {
-		retry = 3 * time.Second
+// fillSendDefaults 补齐发送侧未设置的 hop_limit 与 trace_id。
+func fillSendDefaults(hdr core.IHeader) {
+	if hdr.GetHopLimit() == 0 {
+		hdr.WithHopLimit(header.DefaultHopLimit)
 	}
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-		}
-		conn, err := dial(ctx, s.parent.addr)
-		if err != nil {
-			s.log.Warn("dial parent failed", "addr", s.parent.addr, "err", err)
-			time.Sleep(retry)
-			continue
-		}
-		if conn == nil {
-			s.log.Warn("dial parent returned nil conn", "addr", s.parent.addr)
-			time.Sleep(retry)
-			continue
-		}
-		conn.SetMeta(core.MetaRoleKey, core.RoleParent)
-		if err := s.cm.Add(conn); err != nil {
-			s.log.Warn("add parent connection failed", "addr", s.parent.addr, "err", err)
-			_ = conn.Close()
-			time.Sleep(retry)
-			continue
-		}
-		down := s.parent.setConn(conn.ID())
-		s.log.Info("parent connected", "addr", s.parent.addr, "conn", conn.ID())
-		select {
-		case <-ctx.Done():
-			_ = conn.Close()
-			return
-		case <-down:
-			s.log.Warn("parent connection closed, retrying", "addr", s.parent.addr)
-			time.Sleep(retry)
-		}
+	if hdr.GetTraceID() == 0 {
+		hdr.WithTraceID(nextTraceID())
 	}
 }
 
 // defaultTCPParentDialer 提供默认的 TCP 父链路拨号实现，供未注入自定义 dialer 时使用。
-func defaultTCPParentDialer(ctx context.Context, addr string) (core.IConnection, error) {
-	var d net.Dialer
-	raw, err := d.DialContext(ctx, "tcp", addr)
-	if err != nil {
-		return nil, err
+func defaultTCPParentDialer(gen core.ConnIDGenerator) ParentDialer {
+	return func(ctx context.Context, addr string) (core.IConnection, error) {
+		var d net.Dialer
+		raw, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return tcp_listener.NewTCPConnectionWithID(raw, gen), nil
 	}
-	return tcp_listener.NewTCPConnection(raw), nil
 }
 
-// extractConnNodeID 从连接元数据里提取节点号，兼容若干常见整数类型。
-func extractConnNodeID(c core.IConnection) uint32 {
-	if c == nil {
-		return 0
-	}
-	if v, ok := c.GetMeta("nodeID"); ok {
-		switch vv := v.(type) {
-		case uint32:
-			return vv
-		case uint64:
-			return uint32(vv)
-		case int:
-			if vv >= 0 {
-				return uint32(vv)
-			}
-		case int64:
-			if vv >= 0 {
-				return uint32(vv)
-			}
-		}
-	}
-	return 0
+// isParentRole 判断连接是否为本节点主动拨出的父链路。
+func isParentRole(c core.IConnection) bool {
+	return core.ConnRole(c) == core.RoleParent
 }
 
 // buildParentState 从配置构造父链路运行参数，保证缺省时仍有稳定的重连策略。
 func buildParentState(cfg core.IConfig) *parentState {
 	p := &parentState{
 		parentConfig: parentConfig{
-			enable:    false,
-			addr:      "",
-			reconnect: 3 * time.Second,
+			enable:       false,
+			reconnectMin: 3 * time.Second,
+			reconnectMax: 60 * time.Second,
+			jitter:       0.2,
+			authTimeout:  10 * time.Second,
+
+			heartbeatMisses: 3,
 		},
 	}
 	if cfg == nil {
@@ -458,12 +639,70 @@ func buildParentState(cfg core.IConfig) *parentState {
 	if raw, ok := cfg.Get(coreconfig.KeyParentEnable); ok {
 		p.enable = core.ParseBool(raw, false)
 	}
-	if raw, ok := cfg.Get(coreconfig.KeyParentAddr); ok {
-		p.addr = raw
+	// parent.addrs 优先；未配置时退回单地址 parent.addr。
+	if raw, ok := cfg.Get(coreconfig.KeyParentAddrs); ok {
+		for _, addr := range strings.Split(raw, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				p.addrs = append(p.addrs, addr)
+			}
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentAddr); ok && len(p.addrs) == 0 {
+		if addr := strings.TrimSpace(raw); addr != "" {
+			p.addrs = []string{addr}
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentHotStandby); ok {
+		p.hotStandby = core.ParseBool(raw, false)
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentJoinPermit); ok {
+		p.joinPermit = strings.TrimSpace(raw)
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentSelfID); ok {
+		p.selfID = strings.TrimSpace(raw)
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentLogin); ok {
+		p.login = core.ParseBool(raw, false)
 	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentAuthTimeoutSec); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			p.authTimeout = time.Duration(v) * time.Second
+		}
+	}
+	// parent.reconnect_sec 为旧版固定间隔，作为 reconnect_min_sec 未设置时的最小间隔。
 	if raw, ok := cfg.Get(coreconfig.KeyParentReconnectSec); ok {
 		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
-			p.reconnect = time.Duration(v) * time.Second
+			p.reconnectMin = time.Duration(v) * time.Second
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentReconnectMinSec); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			p.reconnectMin = time.Duration(v) * time.Second
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentReconnectMaxSec); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			p.reconnectMax = time.Duration(v) * time.Second
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentReconnectJitter); ok {
+		if v, err := strconv.ParseFloat(raw, 64); err == nil && v >= 0 {
+			p.jitter = v
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentHeartbeatSec); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			p.heartbeatInterval = time.Duration(v) * time.Second
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyParentHeartbeatMisses); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 {
+			p.heartbeatMisses = v
+		}
+	}
+	if raw, ok := cfg.Get(coreconfig.KeyReaderHeartbeatSubProto); ok {
+		if v, err := strconv.Atoi(raw); err == nil && v > 0 && v <= 63 {
+			p.heartbeatSub = uint8(v)
 		}
 	}
 	return p
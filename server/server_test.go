@@ -0,0 +1,876 @@
+package server
+
+// 本文件覆盖 Core 框架中与 `server` 相关的行为。
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/config"
+	"github.com/yttydcs/myflowhub-core/connmgr"
+	"github.com/yttydcs/myflowhub-core/eventbus"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+	"github.com/yttydcs/myflowhub-core/process"
+	"github.com/yttydcs/myflowhub-core/reader"
+)
+
+// stubListener 在 Listen 时把预先准备好的连接加入管理器，然后阻塞到 ctx 结束。
+type stubListener struct {
+	conns []core.IConnection
+}
+
+func (l *stubListener) Protocol() string { return "stub" }
+func (l *stubListener) Addr() net.Addr   { return nil }
+func (l *stubListener) Close() error     { return nil }
+func (l *stubListener) Listen(ctx context.Context, cm core.IConnectionManager) error {
+	for _, c := range l.conns {
+		if err := cm.Add(c); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// namedPipeAddr 给 net.Pipe 两端赋予可区分的地址，使连接 ID 唯一。
+type namedPipeAddr string
+
+func (a namedPipeAddr) Network() string { return "pipe" }
+func (a namedPipeAddr) String() string  { return string(a) }
+
+type namedPipeConn struct {
+	net.Conn
+	remote namedPipeAddr
+}
+
+func (c namedPipeConn) RemoteAddr() net.Addr { return c.remote }
+
+// newPipeConn 返回服务端包装好的连接与客户端一端。
+func newPipeConn(t *testing.T) (core.IConnection, net.Conn) {
+	t.Helper()
+	srvSide, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close(); _ = srvSide.Close() })
+	return tcp_listener.NewTCPConnection(srvSide), client
+}
+
+// newNamedPipeConn 与 newPipeConn 相同，但以 remote 区分连接 ID，便于同一服务挂多条连接。
+func newNamedPipeConn(t *testing.T, remote string) (core.IConnection, net.Conn) {
+	t.Helper()
+	srvSide, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close(); _ = srvSide.Close() })
+	return tcp_listener.NewTCPConnection(namedPipeConn{Conn: srvSide, remote: namedPipeAddr(remote)}), client
+}
+
+func newTestServer(t *testing.T, lst core.IListener, mutate func(*Options)) *Server {
+	t.Helper()
+	opts := Options{
+		Process:  process.NewSimple(nil),
+		Codec:    header.HeaderTcpCodec{},
+		Listener: lst,
+		Config:   config.NewMap(nil),
+		Manager:  connmgr.New(),
+	}
+	if mutate != nil {
+		mutate(&opts)
+	}
+	srv, err := New(opts)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return srv
+}
+
+func TestServerConnClosedEventCarriesIdleTimeoutReason(t *testing.T) {
+	conn, _ := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.ReaderFactory = func(core.IConnection) core.IReader {
+			return reader.NewTCPWithOptions(reader.Options{IdleTimeout: 50 * time.Millisecond})
+		}
+	})
+
+	events := make(chan map[string]any, 1)
+	srv.EventBus().Subscribe("conn.closed", func(_ context.Context, evt eventbus.Event) {
+		if data, ok := evt.Data.(map[string]any); ok {
+			events <- data
+		}
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	select {
+	case data := <-events:
+		if data["conn_id"] != conn.ID() {
+			t.Fatalf("conn_id=%v, want %v", data["conn_id"], conn.ID())
+		}
+		if data["reason"] != string(core.CloseReasonIdleTimeout) {
+			t.Fatalf("reason=%v, want %q", data["reason"], core.CloseReasonIdleTimeout)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("conn.closed event not published")
+	}
+}
+
+func TestServerConnClosedEventCarriesClientEOFReason(t *testing.T) {
+	conn, client := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, nil)
+
+	events := make(chan map[string]any, 1)
+	srv.EventBus().Subscribe("conn.closed", func(_ context.Context, evt eventbus.Event) {
+		if data, ok := evt.Data.(map[string]any); ok {
+			events <- data
+		}
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	time.Sleep(20 * time.Millisecond)
+	_ = client.Close()
+	select {
+	case data := <-events:
+		if data["reason"] != string(core.CloseReasonClientEOF) {
+			t.Fatalf("reason=%v, want %q", data["reason"], core.CloseReasonClientEOF)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("conn.closed event not published")
+	}
+}
+
+// frameErrorKindFor 启动只挂一条连接的服务，执行 act 后返回 frame.error 事件携带的分类。
+func frameErrorKindFor(t *testing.T, act func(client net.Conn)) string {
+	t.Helper()
+	conn, client := newPipeConn(t)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, nil)
+	events := make(chan map[string]any, 1)
+	srv.EventBus().Subscribe("frame.error", func(_ context.Context, evt eventbus.Event) {
+		if data, ok := evt.Data.(map[string]any); ok {
+			events <- data
+		}
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	time.Sleep(20 * time.Millisecond)
+	act(client)
+	select {
+	case data := <-events:
+		if data["conn_id"] != conn.ID() {
+			t.Fatalf("conn_id=%v, want %v", data["conn_id"], conn.ID())
+		}
+		kind, _ := data["kind"].(string)
+		return kind
+	case <-time.After(2 * time.Second):
+		t.Fatalf("frame.error event not published")
+		return ""
+	}
+}
+
+func TestServerFrameErrorEventClassifiesCorruptFrameAndEOF(t *testing.T) {
+	corrupt := frameErrorKindFor(t, func(client net.Conn) {
+		frame, err := header.HeaderTcpCodec{}.Encode((&header.HeaderTcp{}).WithMajor(header.MajorMsg), []byte("x"))
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		frame[0] ^= 0xFF
+		go func() { _, _ = client.Write(frame) }()
+	})
+	if corrupt != string(reader.FrameErrProtocol) {
+		t.Fatalf("corrupt frame kind=%q, want %q", corrupt, reader.FrameErrProtocol)
+	}
+	eof := frameErrorKindFor(t, func(client net.Conn) { _ = client.Close() })
+	if eof != string(reader.FrameErrEOF) {
+		t.Fatalf("EOF kind=%q, want %q", eof, reader.FrameErrEOF)
+	}
+}
+
+// recordProcess 记录收到的帧头，供断言协商后的解码结果。
+type recordProcess struct {
+	*process.SimpleProcess
+	recv chan core.IHeader
+}
+
+func newRecordProcess() *recordProcess {
+	return &recordProcess{SimpleProcess: process.NewSimple(nil), recv: make(chan core.IHeader, 8)}
+}
+
+func (p *recordProcess) OnReceive(_ context.Context, _ core.IConnection, hdr core.IHeader, _ []byte) {
+	p.recv <- hdr
+}
+
+// ctxProcess 记录 OnReceive 中经 core.ServerFromContext 取到的服务实例。
+type ctxProcess struct {
+	*process.SimpleProcess
+	got chan core.IServer
+}
+
+func (p *ctxProcess) OnReceive(ctx context.Context, _ core.IConnection, _ core.IHeader, _ []byte) {
+	p.got <- core.ServerFromContext(ctx)
+}
+
+// payloadProcess 在 OnReceive 返回后才读取 payload，模拟排队异步处理的处理器。
+type payloadProcess struct {
+	*process.SimpleProcess
+	got chan []byte
+}
+
+func (p *payloadProcess) OnReceive(_ context.Context, _ core.IConnection, _ core.IHeader, payload []byte) {
+	p.got <- payload
+}
+
+func TestServerPayloadPoolCopiesForAsyncProcess(t *testing.T) {
+	conn, client := newPipeConn(t)
+	proc := &payloadProcess{SimpleProcess: process.NewSimple(nil), got: make(chan []byte, 2)}
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Process = proc
+		o.Config = config.NewMap(map[string]string{config.KeyReaderPayloadPool: "true"})
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	for _, body := range []string{"aaaaaaaa", "bbbbbbbb"} {
+		h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(3)
+		frame, _ := header.HeaderTcpCodec{}.Encode(h, []byte(body))
+		if _, err := client.Write(frame); err != nil {
+			t.Fatalf("client write: %v", err)
+		}
+	}
+	var got [][]byte
+	for range 2 {
+		select {
+		case p := <-proc.got:
+			got = append(got, p)
+		case <-time.After(2 * time.Second):
+			t.Fatal("frame not received")
+		}
+	}
+	// 两帧都交付后再读，第一帧的 payload 不能已被第二帧复用覆盖。
+	if string(got[0]) != "aaaaaaaa" || string(got[1]) != "bbbbbbbb" {
+		t.Fatalf("payloads=%q, want independent copies", got)
+	}
+}
+
+func TestServerFromContextResolvesInOnReceive(t *testing.T) {
+	conn, client := newPipeConn(t)
+	proc := &ctxProcess{SimpleProcess: process.NewSimple(nil), got: make(chan core.IServer, 1)}
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) { o.Process = proc })
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithMsgID(1)
+	frame, _ := header.HeaderTcpCodec{}.Encode(h, nil)
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("client write: %v", err)
+	}
+	select {
+	case got := <-proc.got:
+		if got != core.IServer(srv) {
+			t.Fatalf("ServerFromContext=%v, want the serving Server", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame not received")
+	}
+}
+
+func TestServerAnswersHeaderNegotiationFromV1Child(t *testing.T) {
+	conn, client := newPipeConn(t)
+	proc := newRecordProcess()
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Process = proc
+		o.Config = config.NewMap(map[string]string{config.KeyHeaderNegotiate: "true"})
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	ver, _, _, err := header.OfferVersions(client, []uint8{header.HeaderTcpVersionV1})
+	if err != nil {
+		t.Fatalf("OfferVersions: %v", err)
+	}
+	if ver != header.HeaderTcpVersionV1 {
+		t.Fatalf("negotiated version=%d, want 1", ver)
+	}
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(4).WithSourceID(9).WithTargetID(1).WithMsgID(77)
+	frame, _ := header.HeaderTcpV1Codec{}.Encode(hdr, []byte("v1"))
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("write v1 frame: %v", err)
+	}
+	select {
+	case got := <-proc.recv:
+		if got.GetMsgID() != 77 || got.SubProto() != 4 || got.SourceID() != 9 {
+			t.Fatalf("unexpected decoded header: %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("v1 frame not received")
+	}
+	if _, ok := srv.codecFor(conn).(header.HeaderTcpV1Codec); !ok {
+		t.Fatalf("codecFor(conn)=%T, want HeaderTcpV1Codec", srv.codecFor(conn))
+	}
+}
+
+func TestServerNegotiationSilentChildFallsThrough(t *testing.T) {
+	conn, client := newPipeConn(t)
+	proc := newRecordProcess()
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Process = proc
+		o.Config = config.NewMap(map[string]string{
+			config.KeyHeaderNegotiate:          "true",
+			config.KeyHeaderNegotiateTimeoutMS: "50",
+		})
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	// 旧版子节点接入后先沉默超过首帧期限，连接应保持，之后的帧照常按默认 codec 分发。
+	time.Sleep(200 * time.Millisecond)
+	hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(4).WithSourceID(9).WithTargetID(1).WithMsgID(78)
+	frame, _ := header.HeaderTcpCodec{}.Encode(hdr, []byte("late"))
+	_ = client.SetWriteDeadline(time.Now().Add(2 * time.Second))
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("write after silence: %v", err)
+	}
+	select {
+	case got := <-proc.recv:
+		if got.GetMsgID() != 78 {
+			t.Fatalf("unexpected decoded header: %+v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("frame after silent first-read window not dispatched")
+	}
+}
+
+func TestServerParentNegotiationSelectsPeerVersion(t *testing.T) {
+	cases := []struct {
+		name    string
+		answer  bool
+		wantVer uint8
+	}{
+		{name: "v1_only_parent", answer: true, wantVer: header.HeaderTcpVersionV1},
+		{name: "silent_parent_fallback", answer: false, wantVer: header.HeaderTcpVersionV2},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, parentSide := newPipeConn(t)
+			go func() {
+				hdr, payload, err := header.HeaderTcpCodec{}.Decode(parentSide)
+				if err != nil || !tc.answer {
+					return
+				}
+				remote, err := header.ParseVersionOffer(hdr, payload)
+				if err != nil {
+					return
+				}
+				_, _ = header.AnswerVersionOffer(parentSide, []uint8{header.HeaderTcpVersionV1}, remote)
+			}()
+			mgr := connmgr.New()
+			srv := newTestServer(t, &stubListener{}, func(o *Options) {
+				o.Manager = mgr
+				o.Config = config.NewMap(map[string]string{
+					config.KeyHeaderNegotiate:          "true",
+					config.KeyHeaderNegotiateTimeoutMS: "100",
+					config.KeyParentEnable:             "true",
+					config.KeyParentAddr:               "pipe",
+				})
+				o.ParentDialer = func(context.Context, string) (core.IConnection, error) { return conn, nil }
+			})
+			if err := srv.Start(context.Background()); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			defer func() { _ = srv.Stop(context.Background()) }()
+
+			deadline := time.Now().Add(2 * time.Second)
+			for time.Now().Before(deadline) {
+				if _, ok := mgr.Get(conn.ID()); ok {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if _, ok := mgr.Get(conn.ID()); !ok {
+				t.Fatalf("parent connection not added")
+			}
+			if got := connHeaderVersion(conn); got != tc.wantVer {
+				t.Fatalf("negotiated version=%d, want %d", got, tc.wantVer)
+			}
+		})
+	}
+}
+
+func TestServerParentNegotiationDispatchesLegacyFirstFrame(t *testing.T) {
+	conn, parentSide := newPipeConn(t)
+	go func() {
+		// 未实现协商的父节点：读走报价后直接发一帧普通业务帧。
+		if _, _, err := (header.HeaderTcpCodec{}).Decode(parentSide); err != nil {
+			return
+		}
+		h := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(5).WithSourceID(1).WithMsgID(31)
+		frame, _ := header.HeaderTcpCodec{}.Encode(h, nil)
+		_, _ = parentSide.Write(frame)
+	}()
+	proc := newRecordProcess()
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Process = proc
+		o.Config = config.NewMap(map[string]string{
+			config.KeyHeaderNegotiate:          "true",
+			config.KeyHeaderNegotiateTimeoutMS: "1000",
+			config.KeyParentEnable:             "true",
+			config.KeyParentAddr:               "pipe",
+		})
+		o.ParentDialer = func(context.Context, string) (core.IConnection, error) { return conn, nil }
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	select {
+	case got := <-proc.recv:
+		if got.GetMsgID() != 31 {
+			t.Fatalf("dispatched msg=%d, want 31", got.GetMsgID())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("parent's first frame was not dispatched")
+	}
+	if got := connHeaderVersion(conn); got != header.HeaderTcpVersionV2 {
+		t.Fatalf("negotiated version=%d, want fallback 2", got)
+	}
+}
+
+func TestServerCodecFactorySelectsCodecPerConnection(t *testing.T) {
+	legacy, legacyClient := newNamedPipeConn(t, "legacy")
+	modern, modernClient := newNamedPipeConn(t, "modern")
+	legacy.SetMeta("proto", "v1")
+	proc := newRecordProcess()
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{legacy, modern}}, func(o *Options) {
+		o.Process = proc
+		o.CodecFactory = func(c core.IConnection) core.IHeaderCodec {
+			if v, ok := c.GetMeta("proto"); ok && v == "v1" {
+				return header.HeaderTcpV1Codec{}
+			}
+			return nil
+		}
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	cases := []struct {
+		name   string
+		conn   core.IConnection
+		client net.Conn
+		codec  core.IHeaderCodec
+		msgID  uint32
+	}{
+		{name: "v1", conn: legacy, client: legacyClient, codec: header.HeaderTcpV1Codec{}, msgID: 11},
+		{name: "v2", conn: modern, client: modernClient, codec: header.HeaderTcpCodec{}, msgID: 22},
+	}
+	for _, tc := range cases {
+		if got := srv.CodecFor(tc.conn); got != tc.codec {
+			t.Fatalf("%s: CodecFor=%T, want %T", tc.name, got, tc.codec)
+		}
+		hdr := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(3).WithSourceID(5).WithTargetID(1).WithMsgID(tc.msgID)
+		frame, err := tc.codec.Encode(hdr, []byte(tc.name))
+		if err != nil {
+			t.Fatalf("%s: encode: %v", tc.name, err)
+		}
+		if _, err := tc.client.Write(frame); err != nil {
+			t.Fatalf("%s: write: %v", tc.name, err)
+		}
+		select {
+		case got := <-proc.recv:
+			if got.GetMsgID() != tc.msgID {
+				t.Fatalf("%s: received msg=%d, want %d", tc.name, got.GetMsgID(), tc.msgID)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s: frame not received", tc.name)
+		}
+
+		reply := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(3).WithSourceID(1).WithTargetID(5).WithMsgID(tc.msgID + 1)
+		if err := srv.Send(context.Background(), tc.conn.ID(), reply, []byte("ack")); err != nil {
+			t.Fatalf("%s: Send: %v", tc.name, err)
+		}
+		_ = tc.client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		gotHdr, payload, err := tc.codec.Decode(tc.client)
+		if err != nil {
+			t.Fatalf("%s: decode reply: %v", tc.name, err)
+		}
+		if gotHdr.GetMsgID() != tc.msgID+1 || string(payload) != "ack" {
+			t.Fatalf("%s: reply msg=%d payload=%q", tc.name, gotHdr.GetMsgID(), payload)
+		}
+	}
+}
+
+func TestServerConnectionNodesReturnsAllBoundNodes(t *testing.T) {
+	srv := newTestServer(t, &stubListener{}, nil)
+	conn, _ := newNamedPipeConn(t, "gateway")
+	cm := srv.ConnManager()
+	if err := cm.Add(conn); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	cm.UpdateNodeIndex(7, conn)
+	cm.(core.IMultiNodeIndex).AppendNodeIndex(3, conn)
+
+	nodes, ok := srv.ConnectionNodes(conn.ID())
+	if !ok || !slices.Equal(nodes, []uint32{3, 7}) {
+		t.Fatalf("ConnectionNodes=%v,%v, want [3 7],true", nodes, ok)
+	}
+	cm.RemoveNodeIndex(7)
+	if nodes, _ := srv.ConnectionNodes(conn.ID()); !slices.Equal(nodes, []uint32{3}) {
+		t.Fatalf("after unbinding 7 ConnectionNodes=%v, want [3]", nodes)
+	}
+	if _, ok := srv.ConnectionNodes("missing"); ok {
+		t.Fatalf("ConnectionNodes(missing) ok=true, want false")
+	}
+}
+
+func TestServerKickNodeSendsByeAndRemovesConn(t *testing.T) {
+	srv := newTestServer(t, &stubListener{}, nil)
+	conn, client := newNamedPipeConn(t, "victim")
+	core.SetConnNodeID(conn, 9)
+	cm := srv.ConnManager()
+	if err := cm.Add(conn); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	cm.UpdateNodeIndex(9, conn)
+
+	got := make(chan string, 1)
+	go func() {
+		hdr, payload, err := header.HeaderTcpCodec{}.Decode(client)
+		if err != nil {
+			return
+		}
+		if reason, ok := header.ParseBye(hdr, payload); ok {
+			got <- reason
+		}
+	}()
+
+	if !srv.KickNode(9, "evicted by admin") {
+		t.Fatalf("KickNode returned false for bound node")
+	}
+	select {
+	case reason := <-got:
+		if reason != "evicted by admin" {
+			t.Fatalf("bye reason=%q", reason)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("bye frame not received")
+	}
+	if _, ok := cm.Get(conn.ID()); ok {
+		t.Fatalf("kicked conn still in manager")
+	}
+	if _, ok := cm.GetByNode(9); ok {
+		t.Fatalf("node 9 still indexed after kick")
+	}
+	if r := core.CloseReasonOf(conn); r != core.CloseReasonKicked {
+		t.Fatalf("close reason=%q, want kicked", r)
+	}
+	if srv.KickNode(9, "again") {
+		t.Fatalf("KickNode on unbound node returned true")
+	}
+}
+
+func TestServerPublishesConnReplacedOnDuplicateLogin(t *testing.T) {
+	srv := newTestServer(t, &stubListener{}, nil)
+	events := make(chan map[string]any, 1)
+	srv.EventBus().Subscribe("conn.replaced", func(_ context.Context, evt eventbus.Event) {
+		if data, ok := evt.Data.(map[string]any); ok {
+			events <- data
+		}
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	cm := srv.ConnManager()
+	oldConn, _ := newNamedPipeConn(t, "sock-old")
+	newConn, _ := newNamedPipeConn(t, "sock-new")
+	for _, c := range []core.IConnection{oldConn, newConn} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		core.SetConnDeviceID(c, "dev-1")
+		cm.UpdateDeviceIndex("dev-1", c)
+	}
+	select {
+	case data := <-events:
+		if data["old_conn_id"] != oldConn.ID() || data["new_conn_id"] != newConn.ID() {
+			t.Fatalf("conn.replaced data=%v", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("conn.replaced event not published")
+	}
+	if _, ok := cm.Get(oldConn.ID()); ok {
+		t.Fatalf("old conn still registered")
+	}
+}
+
+func TestServerTeardownNotStalledBySlowConnClosedSubscriber(t *testing.T) {
+	bus := eventbus.New(eventbus.Options{DefaultBuffer: 1})
+	defer bus.Close()
+	release := make(chan struct{})
+	defer close(release)
+	bus.Subscribe("conn.closed", func(context.Context, eventbus.Event) { <-release })
+	srv := newTestServer(t, &stubListener{}, func(o *Options) { o.EventBus = bus })
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	cm := srv.ConnManager()
+	const n = 8
+	conns := make([]core.IConnection, 0, n)
+	for i := 0; i < n; i++ {
+		c, _ := newNamedPipeConn(t, fmt.Sprintf("slow-%d", i))
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+		conns = append(conns, c)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, c := range conns {
+			_ = cm.Remove(c.ID())
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("connection teardown stalled behind sleeping conn.closed subscriber")
+	}
+	if st := bus.Stats().Topics["conn.closed"]; st.Dropped == 0 || st.Published+st.Dropped != n {
+		t.Fatalf("conn.closed stats=%+v, want %d publishes with drops", st, n)
+	}
+}
+
+func TestServerSendAndBroadcastPreserveOrderPerConn(t *testing.T) {
+	srv := newTestServer(t, &stubListener{}, nil)
+	cm := srv.ConnManager()
+	target, client := newNamedPipeConn(t, "target")
+	other, otherClient := newNamedPipeConn(t, "other")
+	for _, c := range []core.IConnection{target, other} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	go func() { _, _ = io.Copy(io.Discard, otherClient) }()
+
+	const n = 200
+	got := make(chan []uint32, 1)
+	go func() {
+		var ids []uint32
+		for len(ids) < 2*n {
+			hdr, _, err := header.HeaderTcpCodec{}.Decode(client)
+			if err != nil {
+				break
+			}
+			ids = append(ids, hdr.GetMsgID())
+		}
+		got <- ids
+	}()
+
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		send := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(uint32(2 * i))
+		if err := srv.Send(ctx, target.ID(), send, []byte("s")); err != nil {
+			t.Fatalf("Send %d: %v", i, err)
+		}
+		bcast := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithMsgID(uint32(2*i + 1))
+		if err := srv.Broadcast(ctx, bcast, []byte("b")); err != nil {
+			t.Fatalf("Broadcast %d: %v", i, err)
+		}
+	}
+
+	select {
+	case ids := <-got:
+		if len(ids) != 2*n {
+			t.Fatalf("received %d frames, want %d", len(ids), 2*n)
+		}
+		for i, id := range ids {
+			if id != uint32(i) {
+				t.Fatalf("frame %d has msg_id %d: Send/Broadcast reordered", i, id)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("frames not received")
+	}
+}
+
+// stampProcess 在 OnSend 中按连接改写 SourceID，并拒绝发往 denyConn 的帧。
+type stampProcess struct {
+	*process.SimpleProcess
+	stamp    map[string]uint32
+	denyConn string
+}
+
+func (p *stampProcess) OnSend(_ context.Context, conn core.IConnection, hdr core.IHeader, _ []byte) error {
+	if conn.ID() == p.denyConn {
+		return fmt.Errorf("send to %s denied", conn.ID())
+	}
+	hdr.WithSourceID(p.stamp[conn.ID()])
+	return nil
+}
+
+func TestServerOnSendRewriteReachesWire(t *testing.T) {
+	proc := &stampProcess{SimpleProcess: process.NewSimple(nil), stamp: map[string]uint32{}}
+	srv := newTestServer(t, &stubListener{}, func(o *Options) { o.Process = proc })
+	cm := srv.ConnManager()
+	a, clientA := newNamedPipeConn(t, "a")
+	b, clientB := newNamedPipeConn(t, "b")
+	denied, clientDenied := newNamedPipeConn(t, "denied")
+	for _, c := range []core.IConnection{a, b, denied} {
+		if err := cm.Add(c); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	proc.stamp[a.ID()], proc.stamp[b.ID()] = 100, 200
+	proc.denyConn = denied.ID()
+	deniedBytes := make(chan int, 1)
+	go func() {
+		n, _ := io.Copy(io.Discard, clientDenied)
+		deniedBytes <- int(n)
+	}()
+
+	read := func(client net.Conn) core.IHeader {
+		t.Helper()
+		_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		hdr, _, err := header.HeaderTcpCodec{}.Decode(client)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		return hdr
+	}
+
+	ctx := context.Background()
+	send := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1)
+	go func() { _ = srv.Send(ctx, a.ID(), send, []byte("s")) }()
+	if got := read(clientA).SourceID(); got != 100 {
+		t.Fatalf("Send wrote source=%d, want OnSend stamp 100", got)
+	}
+
+	bcast := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(1)
+	errCh := make(chan error, 1)
+	go func() { errCh <- srv.Broadcast(ctx, bcast, []byte("b")) }()
+	if gotA, gotB := read(clientA).SourceID(), read(clientB).SourceID(); gotA != 100 || gotB != 200 {
+		t.Fatalf("Broadcast wrote sources a=%d b=%d, want per-connection stamps 100/200", gotA, gotB)
+	}
+	if err := <-errCh; err == nil {
+		t.Fatal("Broadcast did not report OnSend rejection")
+	}
+	if bcast.SourceID() != 1 {
+		t.Fatalf("Broadcast mutated caller header source=%d", bcast.SourceID())
+	}
+
+	// 已审计快速路径：跳过 OnSend，原样写出。
+	audited := (&header.HeaderTcp{}).WithMajor(header.MajorMsg).WithSubProto(1).WithSourceID(7)
+	go func() { _ = srv.Send(core.WithSendAudited(ctx), a.ID(), audited, nil) }()
+	if got := read(clientA).SourceID(); got != 7 {
+		t.Fatalf("audited Send wrote source=%d, want untouched 7", got)
+	}
+
+	_ = clientDenied.Close()
+	if n := <-deniedBytes; n != 0 {
+		t.Fatalf("denied connection received %d bytes", n)
+	}
+}
+
+// lateReplyProcess 在收到帧后异步延迟回包，模拟对端半关闭时仍在处理中的请求。
+type lateReplyProcess struct {
+	*process.SimpleProcess
+	delay time.Duration
+}
+
+func (p *lateReplyProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ []byte) {
+	srv := core.ServerFromContext(ctx)
+	go func() {
+		time.Sleep(p.delay)
+		resp := header.BuildTCPResponse(hdr, 4, hdr.SubProto())
+		_ = srv.Send(context.Background(), conn.ID(), resp, []byte("late"))
+	}()
+}
+
+func TestServerHalfCloseFlushesQueuedResponses(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer client.Close()
+	srvSide, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("Accept: %v", err)
+	}
+	conn := tcp_listener.NewTCPConnection(srvSide)
+	srv := newTestServer(t, &stubListener{conns: []core.IConnection{conn}}, func(o *Options) {
+		o.Process = &lateReplyProcess{SimpleProcess: process.NewSimple(nil), delay: 50 * time.Millisecond}
+		o.Config = config.NewMap(map[string]string{config.KeyConnHalfCloseGraceMS: "200"})
+	})
+	if err := srv.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	defer func() { _ = srv.Stop(context.Background()) }()
+
+	req := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(5).WithMsgID(9)
+	frame, _ := header.HeaderTcpCodec{}.Encode(req, []byte("ping"))
+	if _, err := client.Write(frame); err != nil {
+		t.Fatalf("client write: %v", err)
+	}
+	if err := client.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatalf("CloseWrite: %v", err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	hdr, body, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil {
+		t.Fatalf("response lost after half-close: %v", err)
+	}
+	if hdr.GetMsgID() != 9 || string(body) != "late" {
+		t.Fatalf("response msg_id=%d body=%q, want 9/late", hdr.GetMsgID(), body)
+	}
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after response err=%v, want io.EOF from server FIN", err)
+	}
+}
+
+func TestServerFreezeConfigHandsOutReadOnlyView(t *testing.T) {
+	cfg := config.NewMap(map[string]string{"custom.k": "v"})
+	srv := newTestServer(t, &stubListener{}, func(o *Options) {
+		o.Config = cfg
+		o.FreezeConfig = true
+	})
+	view := srv.Config()
+	view.Set("custom.k", "changed")
+	if v, _ := cfg.Get("custom.k"); v != "v" || !config.IsFrozen(view) {
+		t.Fatalf("custom.k=%q frozen=%v, want unchanged read-only view", v, config.IsFrozen(view))
+	}
+	cfg.Set("custom.k", "v2")
+	if v, _ := view.Get("custom.k"); v != "v2" {
+		t.Fatalf("view custom.k=%q, want v2 from the underlying config", v)
+	}
+	if config.IsFrozen(newTestServer(t, &stubListener{}, nil).Config()) {
+		t.Fatal("config frozen without Options.FreezeConfig")
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+// 本文件承载 Core 框架中与 `session` 相关的通用逻辑。
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	coreconfig "github.com/yttydcs/myflowhub-core/config"
+)
+
+// buildSessionTTL 读取 auth.session_ttl_sec；缺省或非法时为 0（会话不过期）。
+func buildSessionTTL(cfg core.IConfig) time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	raw, ok := cfg.Get(coreconfig.KeyAuthSessionTTLSec)
+	if !ok {
+		return 0
+	}
+	v, err := strconv.Atoi(strings.TrimSpace(raw))
+	if err != nil || v <= 0 {
+		return 0
+	}
+	return time.Duration(v) * time.Second
+}
+
+// onNodeBound 在连接完成登录绑定时按 auth.session_ttl_sec 签发会话，再发布 conn.authenticated。
+// 登录 handler 已自行签发会话时保留其结果。
+func (s *Server) onNodeBound(nodeID uint32, c core.IConnection) {
+	if _, ok := core.ConnSessionExpiry(c); !ok && s.sessionTTL > 0 {
+		core.StartSession(c, s.sessionTTL, s.now())
+	}
+	s.publishConnAuthenticated(nodeID, c)
+}
@@ -0,0 +1,59 @@
+package core
+
+// 本文件承载 Core 框架中与 `session` 相关的通用逻辑。
+
+import "time"
+
+// 会话相关的连接元数据键：到期时间（time.Time）与签发时的有效期（time.Duration）。
+const (
+	MetaSessionExpiryKey = "sessionExpiry"
+	MetaSessionTTLKey    = "sessionTTL"
+)
+
+// StartSession 在登录成功后为连接签发会话，记录有效期并返回到期时间；ttl<=0 表示不限期，清除已有到期时间。
+func StartSession(conn IConnection, ttl time.Duration, now time.Time) time.Time {
+	if conn == nil {
+		return time.Time{}
+	}
+	if ttl <= 0 {
+		conn.SetMeta(MetaSessionTTLKey, time.Duration(0))
+		conn.SetMeta(MetaSessionExpiryKey, time.Time{})
+		return time.Time{}
+	}
+	expiry := now.Add(ttl)
+	conn.SetMeta(MetaSessionTTLKey, ttl)
+	conn.SetMeta(MetaSessionExpiryKey, expiry)
+	return expiry
+}
+
+// RefreshSession 按签发时的有效期把会话续到 now+ttl；未签发限期会话或已过期时返回 false，需重新登录。
+func RefreshSession(conn IConnection, now time.Time) (time.Time, bool) {
+	expiry, ok := ConnSessionExpiry(conn)
+	if !ok || !now.Before(expiry) {
+		return time.Time{}, false
+	}
+	v, _ := conn.GetMeta(MetaSessionTTLKey)
+	ttl, _ := v.(time.Duration)
+	if ttl <= 0 {
+		return time.Time{}, false
+	}
+	expiry = now.Add(ttl)
+	conn.SetMeta(MetaSessionExpiryKey, expiry)
+	return expiry, true
+}
+
+// ConnSessionExpiry 返回连接会话的到期时间；未签发或不限期时 ok=false。
+func ConnSessionExpiry(conn IConnection) (time.Time, bool) {
+	if conn == nil {
+		return time.Time{}, false
+	}
+	v, _ := conn.GetMeta(MetaSessionExpiryKey)
+	expiry, _ := v.(time.Time)
+	return expiry, !expiry.IsZero()
+}
+
+// SessionExpired 判断连接是否持有已到期的限期会话；未签发会话的连接（如父链路）恒为 false。
+func SessionExpired(conn IConnection, now time.Time) bool {
+	expiry, ok := ConnSessionExpiry(conn)
+	return ok && !now.Before(expiry)
+}
@@ -0,0 +1,44 @@
+package core
+
+// 本文件覆盖 Core 框架中与 `session` 相关的行为。
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionRefreshExtendsOnlyLiveSessions(t *testing.T) {
+	c := &metaConn{meta: map[string]any{}}
+	now := time.Unix(1000, 0)
+	if SessionExpired(c, now) {
+		t.Fatal("connection without session reported expired")
+	}
+	if _, ok := RefreshSession(c, now); ok {
+		t.Fatal("refresh succeeded without a session")
+	}
+
+	expiry := StartSession(c, time.Minute, now)
+	if !expiry.Equal(now.Add(time.Minute)) {
+		t.Fatalf("expiry=%v, want now+1m", expiry)
+	}
+	later := now.Add(50 * time.Second)
+	if SessionExpired(c, later) {
+		t.Fatal("session expired before its TTL")
+	}
+	if got, ok := RefreshSession(c, later); !ok || !got.Equal(later.Add(time.Minute)) {
+		t.Fatalf("refresh=%v,%v, want later+1m", got, ok)
+	}
+
+	past := later.Add(2 * time.Minute)
+	if !SessionExpired(c, past) {
+		t.Fatal("session not expired after TTL")
+	}
+	if _, ok := RefreshSession(c, past); ok {
+		t.Fatal("expired session must not be refreshable")
+	}
+
+	StartSession(c, 0, past)
+	if _, ok := ConnSessionExpiry(c); ok || SessionExpired(c, past.Add(time.Hour)) {
+		t.Fatal("ttl<=0 must leave the session unlimited")
+	}
+}
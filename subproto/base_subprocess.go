@@ -29,10 +29,16 @@ func (BaseSubProcess) AcceptCmd() bool { return false }
 func (BaseSubProcess) AllowSourceMismatch() bool { return false }
 
 // ActionBaseSubProcess 扩展 BaseSubProcess，内置 action 注册表与注册方法。
-// 适用于 action+data 模式的子协议处理器。
+// 适用于 action+data 模式的子协议处理器：嵌入后只需覆盖 SubProto 并注册 action，OnReceive 默认完成分发与错误回包。
 type ActionBaseSubProcess struct {
 	BaseSubProcess
 	Actions map[string]core.SubProcessAction
+	// Envelope 为未在连接元数据中指定编码时使用的 envelope 编码，nil 表示 JSON。
+	Envelope EnvelopeCodec
+	// Perms 非 nil 时 DispatchAction 对 RequireAuth 的 action 做权限判定（见 DispatchAction）。
+	Perms core.IPermissionChecker
+	// Auth 非 nil 时取代 Perms 与默认鉴权函数（见 SetDefaultAuthFunc）。
+	Auth AuthFunc
 }
 
 // ResetActions 初始化或清空内置 action 表。
@@ -0,0 +1,200 @@
+package subproto
+
+// 本文件承载 Core 框架中与 `dispatch` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/protoerr"
+)
+
+var (
+	// ErrBadEnvelope 表示 payload 无法解析为 envelope 或缺少 action。
+	ErrBadEnvelope = errors.New("subproto: bad envelope")
+	// ErrActionPanic 表示 action 的 Handle 发生 panic，已被 DispatchAction 收敛。
+	ErrActionPanic = errors.New("subproto: action panic")
+)
+
+// 错误回包使用的 code，与各 action 协议的约定一致：1 表示成功，4xxx 为请求方错误，5xxx 为本端错误；
+// 与 protoerr 的标准码取值一致，CodeNotFound 专指子协议内未注册的 action。
+const (
+	CodeOK         = 1
+	CodeBadRequest = protoerr.CodeBadPayload
+	CodeDenied     = protoerr.CodeForbidden
+	CodeNotFound   = 4004
+	CodeInternal   = protoerr.CodeInternal
+)
+
+func init() { protoerr.RegisterCode(CodeNotFound, "unknown_action") }
+
+// ActionError 为 payload 无法解析出 action 时错误回包使用的 action 名（回包为 "error_resp"）。
+const ActionError = "error"
+
+// ErrorResp 是 OnReceive 自动生成的错误回包 data：{"code":4004,"msg":"..."}。
+type ErrorResp struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg,omitempty"`
+}
+
+// ErrorCode 把 DispatchAction 返回的错误映射为回包 code。
+func ErrorCode(err error) int {
+	switch {
+	case err == nil:
+		return CodeOK
+	case errors.Is(err, ErrPermissionDenied):
+		return CodeDenied
+	case errors.Is(err, ErrUnknownAction):
+		return CodeNotFound
+	case errors.Is(err, ErrActionPanic):
+		return CodeInternal
+	default:
+		return CodeBadRequest
+	}
+}
+
+// RespAction 返回 action 的回包名 "<action>_resp"，action 为空时为 "error_resp"。
+func RespAction(action string) string {
+	action = strings.TrimSpace(action)
+	if action == "" {
+		action = ActionError
+	}
+	return action + "_resp"
+}
+
+// AuthFunc 判定帧来源能否调用 RequireAuth 的 act，返回 false 时 DispatchAction 以 ErrPermissionDenied 拒绝。
+type AuthFunc func(ctx context.Context, conn core.IConnection, hdr core.IHeader, act core.SubProcessAction) bool
+
+var defaultAuth atomic.Pointer[AuthFunc]
+
+// SetDefaultAuthFunc 设置未配置 Auth/Perms 的处理器使用的鉴权函数，nil 表示放行；
+// 导入 kit/permission 时会注册基于 permission.SharedConfig 的实现。
+func SetDefaultAuthFunc(f AuthFunc) {
+	if f == nil {
+		defaultAuth.Store(nil)
+		return
+	}
+	defaultAuth.Store(&f)
+}
+
+// CheckPermission 判定帧来源能否执行 act 所需权限：主体默认为连接绑定的 nodeID，
+// 仅当分发层已校验来源（core.SourceVerified）时才采用 hdr.SourceID（如经子连接中继的后代节点）；
+// 主体为 0（未登录）时一律拒绝。
+func CheckPermission(ctx context.Context, perms core.IPermissionChecker, conn core.IConnection, hdr core.IHeader, act core.SubProcessAction) bool {
+	var nodeID uint32
+	pc := core.PermContext{Action: act.Name()}
+	if conn != nil {
+		pc.ConnID = conn.ID()
+		nodeID = core.ConnNodeID(conn)
+	}
+	if hdr != nil {
+		pc.SubProto = hdr.SubProto()
+		if src := hdr.SourceID(); src != 0 && core.SourceVerified(ctx) {
+			nodeID = src
+		}
+	}
+	if nodeID == 0 {
+		return false
+	}
+	return perms.HasCtx(nodeID, ActionPermission(act), pc)
+}
+
+// authorize 依次使用 Auth、Perms 与 SetDefaultAuthFunc 注册的默认实现判定 act，均未配置时放行。
+func (a *ActionBaseSubProcess) authorize(ctx context.Context, conn core.IConnection, hdr core.IHeader, act core.SubProcessAction) bool {
+	switch {
+	case a.Auth != nil:
+		return a.Auth(ctx, conn, hdr, act)
+	case a.Perms != nil:
+		return CheckPermission(ctx, a.Perms, conn, hdr, act)
+	}
+	if f := defaultAuth.Load(); f != nil {
+		return (*f)(ctx, conn, hdr, act)
+	}
+	return true
+}
+
+// Reply 把 data 包装为 "<action>_resp" envelope 回给当前请求方。
+type Reply func(data any) error
+
+type replyKey struct{}
+
+// ReplyFromContext 返回 DispatchAction 为当前 action 注入的 Reply，不在 action 调用链内时返回 false。
+func ReplyFromContext(ctx context.Context) (Reply, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	r, ok := ctx.Value(replyKey{}).(Reply)
+	return r, ok && r != nil
+}
+
+// DispatchAction 按连接选定的编码解析 payload 并调用对应 action：
+//   - payload 无法解析或缺少 action 时返回 ErrBadEnvelope，未注册的 action 返回 ErrUnknownAction；
+//   - RequireAuth 的 action 先经 authorize 判定，未通过返回 ErrPermissionDenied；登录状态等其他鉴权仍由调用方判断；
+//   - action 的 ctx 带有 ReplyFromContext 可取的 Reply；Handle 的 panic 被收敛为 ErrActionPanic。
+func (a *ActionBaseSubProcess) DispatchAction(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) error {
+	env, err := a.EnvelopeCodec(conn).Decode(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadEnvelope, err)
+	}
+	if strings.TrimSpace(env.Action) == "" {
+		return fmt.Errorf("%w: missing action", ErrBadEnvelope)
+	}
+	act, ok := a.LookupAction(env.Action)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownAction, env.Action)
+	}
+	if act.RequireAuth() && !a.authorize(ctx, conn, hdr, act) {
+		return fmt.Errorf("%w: %q", ErrPermissionDenied, act.Name())
+	}
+	if hdr != nil && conn != nil {
+		ctx = context.WithValue(ctx, replyKey{}, Reply(func(data any) error {
+			return a.SendReply(ctx, conn, hdr, act.Name(), data)
+		}))
+	}
+	return a.invoke(ctx, conn, hdr, act, env)
+}
+
+func (a *ActionBaseSubProcess) invoke(ctx context.Context, conn core.IConnection, hdr core.IHeader, act core.SubProcessAction, env Envelope) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %q: %v", ErrActionPanic, act.Name(), r)
+		}
+	}()
+	act.Handle(ctx, conn, hdr, env.Data)
+	return nil
+}
+
+// OnReceive 是 action 模式处理器的默认入口：交给 DispatchAction 分发，失败时以 ErrorResp
+// 回 "<action>_resp"（code 见 ErrorCode）。响应帧与带 FlagFireAndForget 的通知帧出错时只丢弃，
+// 避免两端互相回错形成环路。
+func (a *ActionBaseSubProcess) OnReceive(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) {
+	err := a.DispatchAction(ctx, conn, hdr, payload)
+	if err == nil || conn == nil || hdr == nil {
+		return
+	}
+	if m := hdr.Major(); m == header.MajorOKResp || m == header.MajorErrResp || header.IsFireAndForget(hdr) {
+		return
+	}
+	env, _ := a.EnvelopeCodec(conn).Decode(payload)
+	_ = a.SendReply(ctx, conn, hdr, env.Action, ErrorResp{Code: ErrorCode(err), Msg: err.Error()})
+}
+
+// SendReply 以 "<action>_resp" 包装 data 回复 req：回包头由 header.BuildTCPResponse 生成，
+// 经 ctx 中 server 的发送管线发出（SourceID 为本节点）；取不到 server 时直接写连接。
+func (a *ActionBaseSubProcess) SendReply(ctx context.Context, conn core.IConnection, req core.IHeader, action string, data any) error {
+	payload, err := a.EncodeAction(conn, RespAction(action), data)
+	if err != nil {
+		return err
+	}
+	resp := header.BuildTCPResponse(req, uint32(len(payload)), req.SubProto())
+	if srv := core.ServerFromContext(ctx); srv != nil {
+		resp.WithSourceID(srv.NodeID())
+		return srv.Send(ctx, conn.ID(), resp, payload)
+	}
+	return conn.SendWithHeader(resp, payload, header.HeaderTcpCodec{})
+}
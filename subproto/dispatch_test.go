@@ -0,0 +1,122 @@
+package subproto
+
+// 本文件覆盖 Core 框架中与 `dispatch` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+)
+
+type funcAction struct {
+	BaseAction
+	name   string
+	auth   bool
+	handle func(ctx context.Context, data json.RawMessage)
+}
+
+func (a funcAction) Name() string      { return a.name }
+func (a funcAction) RequireAuth() bool { return a.auth }
+func (a funcAction) Handle(ctx context.Context, _ core.IConnection, _ core.IHeader, data json.RawMessage) {
+	a.handle(ctx, data)
+}
+
+// roundTrip 在 conn 上以 major 投递 payload，返回客户端一端收到的回包；timeout 内无回包时 ok=false。
+func roundTrip(t *testing.T, p *ActionBaseSubProcess, conn core.IConnection, client net.Conn, major uint8, payload string) (core.IHeader, Envelope, bool) {
+	t.Helper()
+	req := (&header.HeaderTcp{}).WithMajor(major).WithSubProto(9).WithSourceID(7).WithTargetID(1).WithMsgID(42)
+	go p.OnReceive(context.Background(), conn, req, []byte(payload))
+	_ = client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	hdr, body, err := header.HeaderTcpCodec{}.Decode(client)
+	if err != nil {
+		return nil, Envelope{}, false
+	}
+	var env Envelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		t.Fatalf("reply envelope %q: %v", body, err)
+	}
+	return hdr, env, true
+}
+
+func TestActionBaseOnReceiveRepliesAndReportsErrors(t *testing.T) {
+	srvSide, client := net.Pipe()
+	defer client.Close()
+	defer srvSide.Close()
+	conn := tcp_listener.NewTCPConnection(srvSide)
+
+	p := &ActionBaseSubProcess{Auth: func(_ context.Context, _ core.IConnection, hdr core.IHeader, _ core.SubProcessAction) bool {
+		return hdr.SourceID() == 1
+	}}
+	p.RegisterAction(funcAction{name: "get", handle: func(ctx context.Context, data json.RawMessage) {
+		reply, ok := ReplyFromContext(ctx)
+		if !ok {
+			panic("no reply in ctx")
+		}
+		_ = reply(map[string]any{"code": CodeOK, "echo": data})
+	}})
+	p.RegisterAction(funcAction{name: "admin", auth: true, handle: func(context.Context, json.RawMessage) {}})
+	p.RegisterAction(funcAction{name: "boom", handle: func(context.Context, json.RawMessage) { panic("boom") }})
+
+	hdr, env, ok := roundTrip(t, p, conn, client, header.MajorCmd, `{"action":"get","data":{"k":"v"}}`)
+	if !ok || env.Action != "get_resp" || string(env.Data) != `{"code":1,"echo":{"k":"v"}}` {
+		t.Fatalf("get reply ok=%v env=%s %s", ok, env.Action, env.Data)
+	}
+	if hdr.Major() != header.MajorOKResp || hdr.SubProto() != 9 || hdr.GetMsgID() != 42 || hdr.TargetID() != 7 {
+		t.Fatalf("reply header major=%d sub=%d msg=%d target=%d", hdr.Major(), hdr.SubProto(), hdr.GetMsgID(), hdr.TargetID())
+	}
+
+	for _, tc := range []struct {
+		payload, action string
+		code            int
+	}{
+		{payload: `not json`, action: "error_resp", code: CodeBadRequest},
+		{payload: `{"data":{}}`, action: "error_resp", code: CodeBadRequest},
+		{payload: `{"action":"nope"}`, action: "nope_resp", code: CodeNotFound},
+		{payload: `{"action":"admin"}`, action: "admin_resp", code: CodeDenied},
+		{payload: `{"action":"boom"}`, action: "boom_resp", code: CodeInternal},
+	} {
+		_, env, ok := roundTrip(t, p, conn, client, header.MajorCmd, tc.payload)
+		var resp ErrorResp
+		if ok {
+			_ = json.Unmarshal(env.Data, &resp)
+		}
+		if !ok || env.Action != tc.action || resp.Code != tc.code || resp.Msg == "" {
+			t.Fatalf("%s: reply ok=%v action=%q resp=%+v, want %s code %d", tc.payload, ok, env.Action, resp, tc.action, tc.code)
+		}
+	}
+
+	// 响应帧分发失败时不回错，避免两端互相回错。
+	if _, env, ok := roundTrip(t, p, conn, client, header.MajorOKResp, `{"action":"nope_resp"}`); ok {
+		t.Fatalf("error reply %q sent for a response frame", env.Action)
+	}
+	// 通知帧（FlagFireAndForget）同样不回错。
+	notify := (&header.HeaderTcp{}).WithFireAndForget(true).WithMajor(header.MajorMsg).WithSubProto(9).WithSourceID(7).WithTargetID(1)
+	go p.OnReceive(context.Background(), conn, notify, []byte(`{"action":"nope"}`))
+	_ = client.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	if _, _, err := (header.HeaderTcpCodec{}).Decode(client); err == nil {
+		t.Fatal("error reply sent for a fire-and-forget frame")
+	}
+}
+
+func TestDefaultAuthFuncAppliesWithoutAuthOrPerms(t *testing.T) {
+	t.Cleanup(func() { SetDefaultAuthFunc(nil) })
+	var p ActionBaseSubProcess
+	p.RegisterAction(funcAction{name: "admin", auth: true, handle: func(context.Context, json.RawMessage) {}})
+	if err := p.DispatchAction(context.Background(), nil, nil, []byte(`{"action":"admin"}`)); err != nil {
+		t.Fatalf("without a default auth func: %v", err)
+	}
+	SetDefaultAuthFunc(func(context.Context, core.IConnection, core.IHeader, core.SubProcessAction) bool { return false })
+	if err := p.DispatchAction(context.Background(), nil, nil, []byte(`{"action":"admin"}`)); ErrorCode(err) != CodeDenied {
+		t.Fatalf("with a denying default auth func: %v", err)
+	}
+	p.Auth = func(context.Context, core.IConnection, core.IHeader, core.SubProcessAction) bool { return true }
+	if err := p.DispatchAction(context.Background(), nil, nil, []byte(`{"action":"admin"}`)); err != nil {
+		t.Fatalf("Auth should override the default: %v", err)
+	}
+}
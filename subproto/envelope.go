@@ -0,0 +1,169 @@
+package subproto
+
+// 本文件承载 Core 框架中与 `envelope` 相关的通用逻辑。
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	core "github.com/yttydcs/myflowhub-core"
+)
+
+// MetaEnvelopeCodecKey 连接元数据中记录 envelope 编码名（"json"/"msgpack"）的键，
+// 设置后该连接上的 action 收发都使用对应编码。
+const MetaEnvelopeCodecKey = "envelopeCodec"
+
+// ErrUnknownAction 表示 envelope 中的 action 未注册。
+var ErrUnknownAction = errors.New("subproto: unknown action")
+
+// ErrPermissionDenied 表示 RequireAuth 的 action 未通过 ActionBaseSubProcess.Perms 的权限判定。
+var ErrPermissionDenied = errors.New("subproto: permission denied")
+
+// PermissionAction 可由 action 实现以声明所需权限；未实现或返回空串时以 action 名作为权限。
+type PermissionAction interface {
+	Permission() string
+}
+
+// ActionPermission 返回 act 所需的权限字符串。
+func ActionPermission(act core.SubProcessAction) string {
+	if pa, ok := act.(PermissionAction); ok {
+		if perm := strings.TrimSpace(pa.Permission()); perm != "" {
+			return perm
+		}
+	}
+	return act.Name()
+}
+
+// Envelope 为 action+data 模式的消息体；Data 始终以 JSON 形式交给 action，
+// 因此 action 的实现与 wire 上采用哪种编码无关。
+type Envelope struct {
+	Action string          `json:"action"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// EnvelopeCodec 负责 Envelope 与 wire 字节之间的转换。
+type EnvelopeCodec interface {
+	Name() string
+	Encode(Envelope) ([]byte, error)
+	Decode([]byte) (Envelope, error)
+}
+
+// JSONEnvelopeCodec 为默认编码：{"action":"...","data":{...}}。
+type JSONEnvelopeCodec struct{}
+
+// Name 返回编码名。
+func (JSONEnvelopeCodec) Name() string { return "json" }
+
+// Encode 以 JSON 编码 envelope。
+func (JSONEnvelopeCodec) Encode(env Envelope) ([]byte, error) { return json.Marshal(env) }
+
+// Decode 解析 JSON envelope。
+func (JSONEnvelopeCodec) Decode(b []byte) (Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return Envelope{}, err
+	}
+	return env, nil
+}
+
+// MsgpackEnvelopeCodec 以 msgpack map {"action":str,"data":any} 编码 envelope，适合带宽敏感的链路。
+// data 在边界上与 JSON 互转：二进制（bin）字段在 JSON 侧表现为 base64 字符串。
+type MsgpackEnvelopeCodec struct{}
+
+// Name 返回编码名。
+func (MsgpackEnvelopeCodec) Name() string { return "msgpack" }
+
+// Encode 把 envelope 编码为 msgpack。
+func (MsgpackEnvelopeCodec) Encode(env Envelope) ([]byte, error) {
+	m := map[string]any{"action": env.Action}
+	if len(bytes.TrimSpace(env.Data)) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(env.Data))
+		dec.UseNumber()
+		var data any
+		if err := dec.Decode(&data); err != nil {
+			return nil, fmt.Errorf("msgpack envelope: invalid data: %w", err)
+		}
+		m["data"] = data
+	}
+	return appendMsgpack(nil, m)
+}
+
+// Decode 解析 msgpack envelope。
+func (MsgpackEnvelopeCodec) Decode(b []byte) (Envelope, error) {
+	d := &msgpackDecoder{buf: b}
+	v, err := d.decode(0)
+	if err != nil {
+		return Envelope{}, err
+	}
+	if d.off != len(b) {
+		return Envelope{}, errors.New("msgpack envelope: trailing bytes")
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return Envelope{}, fmt.Errorf("msgpack envelope: want map, got %T", v)
+	}
+	action, _ := m["action"].(string)
+	env := Envelope{Action: action}
+	if data, ok := m["data"]; ok {
+		if env.Data, err = json.Marshal(data); err != nil {
+			return Envelope{}, err
+		}
+	}
+	return env, nil
+}
+
+// EnvelopeCodecByName 按名称返回内置编码，未知名称返回 false。
+func EnvelopeCodecByName(name string) (EnvelopeCodec, bool) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "json":
+		return JSONEnvelopeCodec{}, true
+	case "msgpack":
+		return MsgpackEnvelopeCodec{}, true
+	default:
+		return nil, false
+	}
+}
+
+// SetConnEnvelopeCodec 为连接选择 envelope 编码。
+func SetConnEnvelopeCodec(conn core.IConnection, name string) {
+	if conn != nil {
+		conn.SetMeta(MetaEnvelopeCodecKey, strings.ToLower(strings.TrimSpace(name)))
+	}
+}
+
+// EnvelopeCodec 返回处理器在该连接上使用的编码：连接元数据优先，其次为 a.Envelope，缺省 JSON。
+func (a *ActionBaseSubProcess) EnvelopeCodec(conn core.IConnection) EnvelopeCodec {
+	if conn != nil {
+		if v, ok := conn.GetMeta(MetaEnvelopeCodecKey); ok {
+			if name, ok := v.(string); ok {
+				if c, ok := EnvelopeCodecByName(name); ok {
+					return c
+				}
+			}
+		}
+	}
+	if a != nil && a.Envelope != nil {
+		return a.Envelope
+	}
+	return JSONEnvelopeCodec{}
+}
+
+// EncodeAction 按连接选定的编码把 action 与 data 打包；data 为 nil 时省略。
+func (a *ActionBaseSubProcess) EncodeAction(conn core.IConnection, action string, data any) ([]byte, error) {
+	env := Envelope{Action: action}
+	if data != nil {
+		raw, ok := data.(json.RawMessage)
+		if !ok {
+			b, err := json.Marshal(data)
+			if err != nil {
+				return nil, err
+			}
+			raw = b
+		}
+		env.Data = raw
+	}
+	return a.EnvelopeCodec(conn).Encode(env)
+}
@@ -0,0 +1,112 @@
+package subproto
+
+// 本文件覆盖 Core 框架中与 `envelope` 相关的行为。
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+)
+
+type recordAction struct {
+	BaseAction
+	got chan json.RawMessage
+}
+
+func (recordAction) Name() string { return "Set" }
+
+func (a recordAction) Handle(_ context.Context, _ core.IConnection, _ core.IHeader, data json.RawMessage) {
+	a.got <- data
+}
+
+func TestEnvelopeCodecsRoundTrip(t *testing.T) {
+	data := json.RawMessage(`{"big":18446744073709551615,"flag":true,"key":"k","list":[1,-1,-200,70000,-3000000000,1.5,null,"` + longString + `"],"nested":{"n":{}}}`)
+	for _, codec := range []EnvelopeCodec{JSONEnvelopeCodec{}, MsgpackEnvelopeCodec{}} {
+		t.Run(codec.Name(), func(t *testing.T) {
+			for _, env := range []Envelope{{Action: "set", Data: data}, {Action: "ping"}} {
+				wire, err := codec.Encode(env)
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+				got, err := codec.Decode(wire)
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if got.Action != env.Action || !jsonEqual(t, got.Data, env.Data) {
+					t.Fatalf("round trip=%+v (%s), want %+v", got, got.Data, env)
+				}
+			}
+		})
+	}
+}
+
+const longString = "a string longer than thirty-one bytes to exercise str8"
+
+func jsonEqual(t *testing.T, a, b json.RawMessage) bool {
+	t.Helper()
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	norm := func(raw json.RawMessage) string {
+		var v any
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("invalid json %s: %v", raw, err)
+		}
+		out, _ := json.Marshal(v)
+		return string(out)
+	}
+	return norm(a) == norm(b)
+}
+
+func TestMsgpackEnvelopeIsSmallerAndRejectsGarbage(t *testing.T) {
+	env := Envelope{Action: "set", Data: json.RawMessage(`{"id":1,"values":[1,2,3,4,5,6,7,8]}`)}
+	j, _ := JSONEnvelopeCodec{}.Encode(env)
+	m, _ := MsgpackEnvelopeCodec{}.Encode(env)
+	if len(m) >= len(j) {
+		t.Fatalf("msgpack %d bytes, json %d bytes", len(m), len(j))
+	}
+	for _, bad := range [][]byte{nil, m[:len(m)-1], append(append([]byte{}, m...), 0x00), {0x93, 0x01}, {0xc1}} {
+		if _, err := (MsgpackEnvelopeCodec{}).Decode(bad); err == nil {
+			t.Fatalf("decode % x succeeded", bad)
+		}
+	}
+}
+
+func TestDispatchActionSelectsCodecPerConnection(t *testing.T) {
+	srvSide, client := net.Pipe()
+	defer client.Close()
+	defer srvSide.Close()
+	conn := tcp_listener.NewTCPConnection(srvSide)
+
+	var p ActionBaseSubProcess
+	act := recordAction{got: make(chan json.RawMessage, 1)}
+	p.RegisterAction(act)
+
+	SetConnEnvelopeCodec(conn, "msgpack")
+	payload, err := p.EncodeAction(conn, "set", map[string]int{"v": 7})
+	if err != nil {
+		t.Fatalf("EncodeAction: %v", err)
+	}
+	if payload[0] == '{' {
+		t.Fatalf("payload %q encoded as JSON, want msgpack", payload)
+	}
+	if err := p.DispatchAction(context.Background(), conn, nil, payload); err != nil {
+		t.Fatalf("DispatchAction: %v", err)
+	}
+	if got := <-act.got; string(got) != `{"v":7}` {
+		t.Fatalf("action data=%s", got)
+	}
+	// 未设置连接编码时退回处理器默认（JSON）。
+	SetConnEnvelopeCodec(conn, "")
+	if err := p.DispatchAction(context.Background(), conn, nil, []byte(`{"action":"nope"}`)); !errors.Is(err, ErrUnknownAction) {
+		t.Fatalf("err=%v, want ErrUnknownAction", err)
+	}
+}
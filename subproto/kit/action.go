@@ -5,9 +5,11 @@ package kit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"strings"
 
 	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/subproto"
 )
 
 // ActionKind 表示 action 在子协议内的语义分类。
@@ -62,11 +64,15 @@ func KindFromName(name string) ActionKind {
 
 type ActionHandler func(context.Context, core.IConnection, core.IHeader, json.RawMessage)
 
+// ReplyHandler 与 ActionHandler 相同，额外接收回复当前请求的 subproto.Reply。
+type ReplyHandler func(context.Context, core.IConnection, core.IHeader, json.RawMessage, subproto.Reply)
+
 // FuncAction 是函数式 action：用闭包代替大量样板结构体。
 // 它实现 core.SubProcessAction。
 type FuncAction struct {
 	name        string
 	requireAuth bool
+	permission  string
 	kind        ActionKind
 	handle      ActionHandler
 }
@@ -79,6 +85,14 @@ func (a *FuncAction) RequireAuth() bool {
 	return a != nil && a.requireAuth
 }
 
+// Permission 返回该 action 声明的权限，空串表示以 action 名作为权限（见 subproto.ActionPermission）。
+func (a *FuncAction) Permission() string {
+	if a == nil {
+		return ""
+	}
+	return a.permission
+}
+
 // Kind 返回工程侧的语义分类，便于做统计、审计或分组展示。
 func (a *FuncAction) Kind() ActionKind {
 	if a == nil {
@@ -106,6 +120,16 @@ func WithRequireAuth(required bool) ActionOption {
 	}
 }
 
+// WithPermission 声明 action 所需的权限（如 permission.AuthRevoke），并隐含 requireAuth=true。
+func WithPermission(perm string) ActionOption {
+	return func(a *FuncAction) {
+		if a != nil {
+			a.permission = strings.TrimSpace(perm)
+			a.requireAuth = true
+		}
+	}
+}
+
 // WithKind 手动指定语义分类，覆盖默认的名字推导结果。
 func WithKind(kind ActionKind) ActionOption {
 	return func(a *FuncAction) {
@@ -135,3 +159,20 @@ func NewAction(name string, handler ActionHandler, opts ...ActionOption) core.Su
 	}
 	return act
 }
+
+// NewReplyAction 构造一个把 subproto.Reply 传给 handler 的函数式 action，选项同 NewAction。
+// 不经 ActionBaseSubProcess.DispatchAction 调用时 reply 返回错误而不发送。
+func NewReplyAction(name string, handler ReplyHandler, opts ...ActionOption) core.SubProcessAction {
+	if handler == nil {
+		return NewAction(name, nil, opts...)
+	}
+	return NewAction(name, func(ctx context.Context, conn core.IConnection, hdr core.IHeader, data json.RawMessage) {
+		reply, ok := subproto.ReplyFromContext(ctx)
+		if !ok {
+			reply = func(any) error { return errNoReply }
+		}
+		handler(ctx, conn, hdr, data, reply)
+	}, opts...)
+}
+
+var errNoReply = errors.New("kit: action not dispatched by DispatchAction, cannot reply")
@@ -31,17 +31,16 @@ func BuildResponse(req core.IHeader, payloadLen uint32, sub uint8) core.IHeader
 
 // SendResponse 编码并通过发送管线发送响应；若无法取得 server，则回退直接写连接。
 func SendResponse(ctx context.Context, log *slog.Logger, conn core.IConnection, req core.IHeader, payload []byte, sub uint8) {
-	codec := header.HeaderTcpCodec{}
 	resp := BuildResponse(req, uint32(len(payload)), sub)
-	if srv := core.ServerFromContext(ctx); srv != nil {
-		if err := srv.Send(ctx, conn.ID(), resp, payload); err != nil && log != nil {
-			log.Error("发送响应失败", "err", err)
-		}
-		return
+	if err := sendFrame(ctx, conn, resp, payload); err != nil && log != nil {
+		log.Error("发送响应失败", "err", err)
 	}
-	if err := conn.SendWithHeader(resp, payload, codec); err != nil {
-		if log != nil {
-			log.Error("发送响应失败", "err", err)
-		}
+}
+
+// sendFrame 优先经 server 发送管线发出一帧，取不到 server 时直接写连接。
+func sendFrame(ctx context.Context, conn core.IConnection, hdr core.IHeader, payload []byte) error {
+	if srv := core.ServerFromContext(ctx); srv != nil {
+		return srv.Send(ctx, conn.ID(), hdr, payload)
 	}
+	return conn.SendWithHeader(hdr, payload, header.HeaderTcpCodec{})
 }
@@ -0,0 +1,61 @@
+package kit
+
+// 本文件承载 Core 框架中与 `stream` 相关的通用逻辑。
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+)
+
+// ErrResponseClosed 表示 ResponseWriter 已发出终止帧，不能再写。
+var ErrResponseClosed = errors.New("response stream closed")
+
+// ResponseWriter 把一个请求的多帧响应依次发回请求方：每帧都复用请求的 MsgID，
+// Write 发出的帧带 header.FlagMore，Close 发出清除该位的终止帧；请求方读到 !header.HasMore 即可结束拼装。
+// 同一 ResponseWriter 不可并发使用。
+type ResponseWriter struct {
+	ctx    context.Context
+	log    *slog.Logger
+	conn   core.IConnection
+	req    core.IHeader
+	sub    uint8
+	closed bool
+}
+
+// NewResponseWriter 在 handler 内为当前请求创建多帧响应写出器，发送路径与 SendResponse 相同。
+func NewResponseWriter(ctx context.Context, log *slog.Logger, conn core.IConnection, req core.IHeader, sub uint8) *ResponseWriter {
+	return &ResponseWriter{ctx: ctx, log: log, conn: conn, req: req, sub: sub}
+}
+
+// Write 发出一帧中间结果。
+func (w *ResponseWriter) Write(payload []byte) error {
+	return w.send(payload, true)
+}
+
+// Close 发出终止帧（payload 可为空）；重复调用返回 ErrResponseClosed。
+func (w *ResponseWriter) Close(payload []byte) error {
+	return w.send(payload, false)
+}
+
+func (w *ResponseWriter) send(payload []byte, more bool) error {
+	if w.closed {
+		return ErrResponseClosed
+	}
+	resp := BuildResponse(w.req, uint32(len(payload)), w.sub)
+	flags := resp.GetFlags() &^ header.FlagMore
+	if more {
+		flags |= header.FlagMore
+	} else {
+		w.closed = true
+	}
+	resp.WithFlags(flags)
+	err := sendFrame(w.ctx, w.conn, resp, payload)
+	if err != nil && w.log != nil {
+		w.log.Error("发送流式响应失败", "more", more, "err", err)
+	}
+	return err
+}
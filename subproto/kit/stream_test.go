@@ -0,0 +1,70 @@
+package kit
+
+// 本文件覆盖 Core 框架中与 `stream` 相关的行为。
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	core "github.com/yttydcs/myflowhub-core"
+	"github.com/yttydcs/myflowhub-core/header"
+	"github.com/yttydcs/myflowhub-core/listener/tcp_listener"
+)
+
+func TestResponseWriterStreamsFramesUntilClose(t *testing.T) {
+	srvSide, client := net.Pipe()
+	defer srvSide.Close()
+	defer client.Close()
+	conn := tcp_listener.NewTCPConnection(srvSide)
+
+	results := []string{"r1", "r2", "r3"}
+	act := NewAction("query", func(ctx context.Context, conn core.IConnection, hdr core.IHeader, _ json.RawMessage) {
+		w := NewResponseWriter(ctx, nil, conn, hdr, 9)
+		for _, r := range results {
+			if err := w.Write([]byte(r)); err != nil {
+				t.Errorf("Write: %v", err)
+				return
+			}
+		}
+		if err := w.Close(nil); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		if err := w.Write([]byte("late")); !errors.Is(err, ErrResponseClosed) {
+			t.Errorf("Write after Close err=%v, want ErrResponseClosed", err)
+		}
+	})
+	req := (&header.HeaderTcp{}).WithMajor(header.MajorCmd).WithSubProto(9).WithSourceID(3).WithTargetID(1).WithMsgID(77)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		act.Handle(context.Background(), conn, req, nil)
+	}()
+
+	// 请求方按 MsgID 收集，直到读到不带 FlagMore 的终止帧。
+	var got []string
+	_ = client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		hdr, payload, err := header.HeaderTcpCodec{}.Decode(client)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if hdr.GetMsgID() != 77 || hdr.Major() != header.MajorOKResp || hdr.TargetID() != 3 {
+			t.Fatalf("frame msg_id=%d major=%d target=%d, want response to request 77", hdr.GetMsgID(), hdr.Major(), hdr.TargetID())
+		}
+		if !header.HasMore(hdr) {
+			if len(payload) != 0 {
+				t.Fatalf("terminal frame payload=%q, want empty", payload)
+			}
+			break
+		}
+		got = append(got, string(payload))
+	}
+	<-done
+	if len(got) != len(results) || got[0] != "r1" || got[2] != "r3" {
+		t.Fatalf("reassembled %v, want %v", got, results)
+	}
+}
@@ -0,0 +1,276 @@
+package subproto
+
+// 本文件承载 Core 框架中与 `msgpack` 相关的通用逻辑。
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// 这里只实现 envelope 所需的 msgpack 子集：nil/bool/整数/浮点/字符串/二进制/数组/map，
+// 与 JSON 数据模型一一对应，不支持 ext 类型。避免为一个可选编码引入第三方依赖。
+
+var errMsgpackTruncated = errors.New("msgpack: truncated input")
+
+// msgpackMaxDepth 限制嵌套深度，防止恶意输入耗尽栈。
+const msgpackMaxDepth = 64
+
+// appendMsgpack 把 JSON 数据模型中的值（json.Unmarshal 到 any 且 UseNumber 的结果）编码追加到 dst。
+func appendMsgpack(dst []byte, v any) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(dst, 0xc0), nil
+	case bool:
+		if x {
+			return append(dst, 0xc3), nil
+		}
+		return append(dst, 0xc2), nil
+	case json.Number:
+		if i, err := x.Int64(); err == nil {
+			return appendMsgpackInt(dst, i), nil
+		}
+		if u, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			return binary.BigEndian.AppendUint64(append(dst, 0xcf), u), nil
+		}
+		f, err := x.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("msgpack: invalid number %q", x)
+		}
+		return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(f)), nil
+	case string:
+		return appendMsgpackStr(dst, x), nil
+	case []any:
+		dst = appendMsgpackLen(dst, len(x), 0x90, 0xdc, 0xdd)
+		var err error
+		for _, e := range x {
+			if dst, err = appendMsgpack(dst, e); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	case map[string]any:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // 输出稳定，便于比较与缓存
+		dst = appendMsgpackLen(dst, len(x), 0x80, 0xde, 0xdf)
+		var err error
+		for _, k := range keys {
+			dst = appendMsgpackStr(dst, k)
+			if dst, err = appendMsgpack(dst, x[k]); err != nil {
+				return nil, err
+			}
+		}
+		return dst, nil
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %T", v)
+	}
+}
+
+func appendMsgpackInt(dst []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= 0x7f:
+		return append(dst, byte(i))
+	case i < 0 && i >= -32:
+		return append(dst, byte(int8(i)))
+	case i >= math.MinInt8 && i <= math.MaxInt8:
+		return append(dst, 0xd0, byte(int8(i)))
+	case i >= math.MinInt16 && i <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(int16(i)))
+	case i >= math.MinInt32 && i <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(int32(i)))
+	default:
+		return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(i))
+	}
+}
+
+func appendMsgpackStr(dst []byte, s string) []byte {
+	if len(s) <= 31 {
+		dst = append(dst, 0xa0|byte(len(s)))
+	} else if len(s) <= math.MaxUint8 {
+		dst = append(dst, 0xd9, byte(len(s)))
+	} else {
+		dst = appendMsgpackLen(dst, len(s), 0, 0xda, 0xdb)
+	}
+	return append(dst, s...)
+}
+
+// appendMsgpackLen 写入数组/map/str 的长度前缀；fix 为 0 表示该类型不使用 fix 形式。
+func appendMsgpackLen(dst []byte, n int, fix, c16, c32 byte) []byte {
+	switch {
+	case fix != 0 && n <= 15:
+		return append(dst, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, c16), uint16(n))
+	default:
+		return binary.BigEndian.AppendUint32(append(dst, c32), uint32(n))
+	}
+}
+
+// msgpackDecoder 把 msgpack 解码为 JSON 数据模型：map 键统一转为字符串，bin 解为 []byte。
+type msgpackDecoder struct {
+	buf []byte
+	off int
+}
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.buf)-d.off < n {
+		return nil, errMsgpackTruncated
+	}
+	b := d.buf[d.off : d.off+n]
+	d.off += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) uint(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+func (d *msgpackDecoder) decode(depth int) (any, error) {
+	if depth > msgpackMaxDepth {
+		return nil, errors.New("msgpack: nesting too deep")
+	}
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c&0x0f), depth)
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c&0x0f), depth)
+	case c&0xe0 == 0xa0:
+		return d.decodeStr(int(c & 0x1f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		raw, err := d.next(int(n))
+		if err != nil {
+			return nil, err
+		}
+		return bytes.Clone(raw), nil
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if v > math.MaxInt64 {
+			return v, nil
+		}
+		return int64(v), nil
+	case 0xd0:
+		v, err := d.uint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := d.uint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := d.uint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := d.uint(8)
+		return int64(v), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeStr(int(n))
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(int(n), depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(int(n), depth)
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type byte 0x%02x", c)
+	}
+}
+
+func (d *msgpackDecoder) decodeStr(n int) (any, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (d *msgpackDecoder) decodeArray(n, depth int) (any, error) {
+	if n > len(d.buf)-d.off { // 每个元素至少 1 字节
+		return nil, errMsgpackTruncated
+	}
+	out := make([]any, 0, n)
+	for i := 0; i < n; i++ {
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (d *msgpackDecoder) decodeMap(n, depth int) (any, error) {
+	if 2*n > len(d.buf)-d.off {
+		return nil, errMsgpackTruncated
+	}
+	out := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.decode(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := k.(string); ok {
+			out[s] = v
+		} else {
+			out[fmt.Sprint(k)] = v
+		}
+	}
+	return out, nil
+}